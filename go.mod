@@ -8,8 +8,10 @@ require (
 	github.com/go-chi/cors v1.2.2
 	github.com/imroc/req/v3 v3.56.0
 	github.com/mattn/go-sqlite3 v1.14.32
+	golang.org/x/net v0.47.0
 	golang.org/x/sync v0.18.0
 	golang.org/x/time v0.14.0
+	google.golang.org/protobuf v1.36.11
 )
 
 require (
@@ -25,8 +27,6 @@ require (
 	github.com/refraction-networking/utls v1.8.1 // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
 	golang.org/x/crypto v0.45.0 // indirect
-	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
-	google.golang.org/protobuf v1.36.11 // indirect
 )
@@ -0,0 +1,273 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/weather"
+)
+
+const (
+	// arrivals within this many minutes of schedule count as on time in the daily summaries
+	onTimeThresholdMin = 15
+
+	// trains closer than this are bunched, gaps of maxHeadwayMin or more are not headways
+	bunchingMin   = 5
+	maxHeadwayMin = 180
+
+	// delay gained on a segment is inherited when the run left within propagationGapMin
+	// of the train ahead and arrived no more than followMin behind it
+	propagationGapMin = 30
+	followMin         = 10
+)
+
+type Config struct {
+	RunHour            int // hour of day (in loc) the nightly jobs start
+	SegmentWindowDays  int
+	SegmentMaxSpeedKmh float64
+	SummaryWindowDays  int              // late station events keep arriving, so recent runs are re-summarised
+	ApproachMin        int              // a train counts towards station congestion this long before it arrives
+	ProfileWindowDays  int              // history used for the delay profiles behind ETA prediction
+	CoverageGapMin     int              // fixes further apart than this count as a gap in run coverage
+	Weather            weather.Provider // nil disables weather enrichment
+	WeatherWindowDays  int
+}
+
+// Job is a single aggregation step, run once per night in registration order. An
+// Atomic job runs in one transaction, readers never see it half done.
+type Job struct {
+	Name   string
+	Run    func(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error
+	Atomic bool
+}
+
+func jobs() []Job {
+	return []Job{
+		{Name: "segment_stats", Run: refreshSegmentStats, Atomic: true},
+		{Name: "run_delay_summaries", Run: refreshRunDelaySummaries},
+		{Name: "station_congestion", Run: refreshStationCongestion},
+		{Name: "delay_profiles", Run: refreshDelayProfiles},
+		{Name: "run_encounters", Run: detectRunEncounters},
+		{Name: "headway_stats", Run: refreshHeadwayStats},
+		{Name: "delay_attribution", Run: refreshDelayAttribution},
+		{Name: "run_coverage", Run: refreshRunCoverage},
+		{Name: "run_quality_scores", Run: refreshRunQualityScores},
+		// daily summaries cover closed days only and depend on run_delay_summaries
+		{Name: "daily_train_summaries", Run: refreshDailyTrainSummaries},
+		{Name: "daily_station_summaries", Run: refreshDailyStationSummaries},
+		{Name: "daily_zone_summaries", Run: refreshDailyZoneSummaries},
+		// monthly rollups fold the daily summaries, so they run after them
+		{Name: "monthly_train_summaries", Run: refreshMonthlyTrainSummaries},
+		{Name: "monthly_station_summaries", Run: refreshMonthlyStationSummaries},
+		{Name: "monthly_zone_summaries", Run: refreshMonthlyZoneSummaries},
+		{Name: "division_weather", Run: refreshDivisionWeather},
+	}
+}
+
+// Start blocks until ctx is cancelled
+// Runs every job once a day at cfg.RunHour
+func Start(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.Logger, cfg Config, loc *time.Location) {
+	if cfg.RunHour < 0 || cfg.RunHour > 23 {
+		cfg.RunHour = 2
+	}
+	if cfg.SegmentWindowDays <= 0 {
+		cfg.SegmentWindowDays = 30
+	}
+	if cfg.SegmentMaxSpeedKmh <= 0 {
+		cfg.SegmentMaxSpeedKmh = 200
+	}
+	if cfg.SummaryWindowDays <= 0 {
+		cfg.SummaryWindowDays = 3
+	}
+	if cfg.ApproachMin < 0 {
+		cfg.ApproachMin = 10
+	}
+	if cfg.ProfileWindowDays <= 0 {
+		cfg.ProfileWindowDays = 90
+	}
+	if cfg.CoverageGapMin <= 0 {
+		cfg.CoverageGapMin = 15
+	}
+	if cfg.WeatherWindowDays <= 0 {
+		cfg.WeatherWindowDays = 7
+	}
+
+	nextRun := nextRunTime(loc, cfg.RunHour)
+	logger.Printf("analytics: next run at %s (in %v)", nextRun.Format(time.RFC3339), time.Until(nextRun))
+
+	select {
+	case <-time.After(time.Until(nextRun)):
+		RunAll(ctx, queries, sqlDB, logger, cfg, time.Now().In(loc))
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tick := <-ticker.C:
+			RunAll(ctx, queries, sqlDB, logger, cfg, tick.In(loc))
+		}
+	}
+}
+
+// RunAll executes every job once; a failing job is logged and does not stop the rest
+func RunAll(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.Logger, cfg Config, now time.Time) {
+	for _, job := range jobs() {
+		if ctx.Err() != nil {
+			return
+		}
+		start := time.Now()
+		if err := runJob(ctx, queries, sqlDB, cfg, now, job); err != nil {
+			logger.Printf("analytics: %s failed: %v", job.Name, err)
+			continue
+		}
+		logger.Printf("analytics: %s completed in %v", job.Name, time.Since(start))
+	}
+}
+
+func runJob(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, cfg Config, now time.Time, job Job) error {
+	if !job.Atomic {
+		return job.Run(ctx, queries, cfg, now)
+	}
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := job.Run(ctx, queries.WithTx(tx), cfg, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func nextRunTime(loc *time.Location, hour int) time.Time {
+	now := time.Now().In(loc)
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, loc)
+	if now.After(next) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// refreshSegmentStats recomputes the segments with samples in the window and drops
+// the ones left without any, which would otherwise keep their old speeds for good
+func refreshSegmentStats(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	// the same clock and format as the CURRENT_TIMESTAMP the refresh writes
+	refreshedAt := time.Now().UTC().Format(time.DateTime)
+	if err := queries.RefreshSegmentStats(ctx, db.RefreshSegmentStatsParams{
+		SinceDate:   now.AddDate(0, 0, -cfg.SegmentWindowDays).Format(time.DateOnly),
+		MaxSpeedKmh: cfg.SegmentMaxSpeedKmh,
+	}); err != nil {
+		return err
+	}
+	_, err := queries.DeleteStaleSegmentStats(ctx, refreshedAt)
+	return err
+}
+
+func refreshRunDelaySummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshRunDelaySummaries(ctx, now.AddDate(0, 0, -cfg.SummaryWindowDays).Format(time.DateOnly))
+}
+
+// refreshStationCongestion rebuilds the hourly buckets of the summary window,
+// hours are aligned to local clock hours of now's zone
+func refreshStationCongestion(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	_, offset := now.Zone()
+	return queries.RefreshStationCongestion(ctx, db.RefreshStationCongestionParams{
+		ApproachSec: int64(cfg.ApproachMin) * 60,
+		SinceTm:     now.AddDate(0, 0, -cfg.SummaryWindowDays).Unix(),
+		TzOffsetSec: int64(offset),
+	})
+}
+
+func refreshDelayProfiles(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshTrainStationDelayProfiles(ctx, now.AddDate(0, 0, -cfg.ProfileWindowDays).Format(time.DateOnly))
+}
+
+func detectRunEncounters(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.DetectRunEncounters(ctx, now.AddDate(0, 0, -cfg.SummaryWindowDays).Format(time.DateOnly))
+}
+
+func refreshDelayAttribution(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshRunDelayAttribution(ctx, db.RefreshRunDelayAttributionParams{
+		SinceDate: now.AddDate(0, 0, -cfg.SummaryWindowDays).Format(time.DateOnly),
+		MaxGapSec: propagationGapMin * 60,
+		FollowSec: followMin * 60,
+	})
+}
+
+func refreshRunCoverage(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshRunCoverage(ctx, db.RefreshRunCoverageParams{
+		SinceDate: now.AddDate(0, 0, -cfg.SummaryWindowDays).Format(time.DateOnly),
+		GapSec:    cfg.CoverageGapMin * 60,
+	})
+}
+
+func refreshRunQualityScores(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshRunQualityScores(ctx, now.AddDate(0, 0, -cfg.SummaryWindowDays).Format(time.DateOnly))
+}
+
+func refreshHeadwayStats(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshHeadwayStats(ctx, db.RefreshHeadwayStatsParams{
+		SinceDate:     now.AddDate(0, 0, -cfg.SegmentWindowDays).Format(time.DateOnly),
+		BunchingMin:   bunchingMin,
+		MaxHeadwayMin: maxHeadwayMin,
+	})
+}
+
+// summaryWindow returns [since, until) as local midnights, until being the start of today
+func summaryWindow(cfg Config, now time.Time) (time.Time, time.Time) {
+	until := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return until.AddDate(0, 0, -cfg.SummaryWindowDays), until
+}
+
+func refreshDailyTrainSummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	since, until := summaryWindow(cfg, now)
+	return queries.RefreshDailyTrainSummaries(ctx, db.RefreshDailyTrainSummariesParams{
+		OnTimeThresholdMin: sql.NullInt64{Int64: onTimeThresholdMin, Valid: true},
+		SinceDate:          since.Format(time.DateOnly),
+		UntilDate:          until.Format(time.DateOnly),
+	})
+}
+
+func refreshDailyStationSummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	since, until := summaryWindow(cfg, now)
+	_, offset := now.Zone()
+	return queries.RefreshDailyStationSummaries(ctx, db.RefreshDailyStationSummariesParams{
+		TzOffsetSec:        offset,
+		OnTimeThresholdMin: onTimeThresholdMin,
+		SinceTm:            since.Unix(),
+		UntilTm:            until.Unix(),
+	})
+}
+
+func refreshDailyZoneSummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	since, _ := summaryWindow(cfg, now)
+	return queries.RefreshDailyZoneSummaries(ctx, since.Format(time.DateOnly))
+}
+
+// rollupStart is the first day of the month the summary window starts in, every
+// month from there on may have had a daily summary rebuilt
+func rollupStart(cfg Config, now time.Time) string {
+	since, _ := summaryWindow(cfg, now)
+	return time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, since.Location()).Format(time.DateOnly)
+}
+
+func refreshMonthlyTrainSummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshMonthlyTrainSummaries(ctx, rollupStart(cfg, now))
+}
+
+func refreshMonthlyStationSummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshMonthlyStationSummaries(ctx, rollupStart(cfg, now))
+}
+
+func refreshMonthlyZoneSummaries(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	return queries.RefreshMonthlyZoneSummaries(ctx, rollupStart(cfg, now))
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// refreshDivisionWeather stores the weather of the last cfg.WeatherWindowDays closed
+// days at every division's centroid. Days are refetched each night since providers
+// revise recent observations. A no-op unless a provider is configured.
+func refreshDivisionWeather(ctx context.Context, queries *db.Queries, cfg Config, now time.Time) error {
+	if cfg.Weather == nil {
+		return nil
+	}
+
+	divisions, err := queries.ListDivisionCentroids(ctx)
+	if err != nil {
+		return fmt.Errorf("list division centroids: %w", err)
+	}
+
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, 1-cfg.WeatherWindowDays)
+
+	var failed int
+	var lastErr error
+	for _, div := range divisions {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		days, err := cfg.Weather.Daily(ctx, div.Lat, div.Lng, from, to, now.Location())
+		if err != nil {
+			failed++
+			lastErr = fmt.Errorf("%s: %w", div.Division.String, err)
+			continue
+		}
+
+		for _, day := range days {
+			err := queries.UpsertDivisionWeather(ctx, db.UpsertDivisionWeatherParams{
+				Division:        div.Division.String,
+				WeatherDate:     day.Date,
+				Condition:       day.Condition(),
+				WeatherCode:     nullInt(day.WeatherCode),
+				TempMaxC:        nullFloat(day.TempMaxC),
+				TempMinC:        nullFloat(day.TempMinC),
+				PrecipitationMm: nullFloat(day.PrecipitationMm),
+				Provider:        cfg.Weather.Name(),
+			})
+			if err != nil {
+				return fmt.Errorf("upsert weather for %s: %w", div.Division.String, err)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("weather fetch failed for %d of %d divisions, last: %w", failed, len(divisions), lastErr)
+	}
+	return nil
+}
+
+func nullInt(v *int64) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}
+}
+
+func nullFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
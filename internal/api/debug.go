@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"trano/internal/metrics"
+)
+
+// DebugServer serves pprof, expvar and metrics on a listener of its own, meant for a
+// loopback or private address that the public API address never exposes
+type DebugServer struct {
+	logger *log.Logger
+	srv    *http.Server
+}
+
+func NewDebugServer(addr string, logger *log.Logger) *DebugServer {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+
+	return &DebugServer{
+		logger: logger,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+			// CPU profiles and traces run for ?seconds= before answering, so no write timeout
+		},
+	}
+}
+
+// Run serves until ctx is cancelled
+func (d *DebugServer) Run(ctx context.Context) error {
+	if host, _, err := net.SplitHostPort(d.srv.Addr); err == nil {
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			d.logger.Printf("debug: warning, %s listens on every interface, profiles expose process internals", d.srv.Addr)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := d.srv.Shutdown(shutdownCtx); err != nil {
+			d.logger.Printf("debug: server shutdown error: %v", err)
+		}
+	}()
+
+	d.logger.Printf("debug: serving pprof and expvar on %s", d.srv.Addr)
+	if err := d.srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/gtfs"
+	"trano/internal/iri"
+	"trano/internal/poller"
+)
+
+type AdminHandler struct {
+	queries  *db.Queries
+	db       *sql.DB
+	syncJobs *iri.Jobs // nil when IRI is not synced, as under the simulator
+	onDemand *poller.OnDemand
+	control  *poller.Control // nil leaves the poller endpoints answering 409
+	logger   *log.Logger
+	loc      *time.Location
+}
+
+func NewAdminHandler(queries *db.Queries, dbConn *sql.DB, syncJobs *iri.Jobs, onDemand *poller.OnDemand, control *poller.Control, logger *log.Logger, loc *time.Location) *AdminHandler {
+	return &AdminHandler{
+		queries:  queries,
+		db:       dbConn,
+		syncJobs: syncJobs,
+		onDemand: onDemand,
+		control:  control,
+		logger:   logger,
+		loc:      loc,
+	}
+}
+
+// GET /admin/gtfs.zip?days=365
+// Static GTFS feed of the timetable with service from today
+func (h *AdminHandler) ExportGTFS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	opts := gtfs.DefaultOptions(h.loc)
+	opts.Days = queryInt(r, "days", opts.Days, 1, 730)
+
+	// built in memory so a failure halfway still gets a proper error status
+	var buf bytes.Buffer
+	stats, err := gtfs.Write(ctx, h.queries, &buf, opts)
+	if err != nil {
+		logf(h.logger, r, "handler: gtfs export failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	logf(h.logger, r, "handler: gtfs export | trips: %d | stop_times: %d | bytes: %d", stats.Trips, stats.StopTimes, buf.Len())
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gtfs_`+opts.Start.Format("20060102")+`.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
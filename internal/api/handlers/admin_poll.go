@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"trano/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// POST /admin/runs/{run_id}/poll
+// Polls the run against whereismytrain now, ignoring its start time, the poll window
+// and the error thresholds that would keep the poller away, and answers with the result
+func (h *AdminHandler) PollRun(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+
+	result, err := h.onDemand.Poll(r.Context(), runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: forced poll of %s failed: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: run %s polled by key %d | success: %t", runID, issuer.ID, result.Success)
+	writeJSON(w, h.logger, http.StatusOK, result)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"trano/internal/auth"
+	"trano/internal/poller"
+)
+
+// GET /admin/poller
+// Whether the poller is paused and the settings it currently works to
+func (h *AdminHandler) GetPoller(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.logger, http.StatusOK, h.control.Status())
+}
+
+// POST /admin/poller/pause
+// No new cycles start until resumed, the one in progress finishes. Meant for upstream
+// blocks, the process and the rest of the service keep running.
+func (h *AdminHandler) PausePoller(w http.ResponseWriter, r *http.Request) {
+	changed, err := h.control.Pause()
+	h.controlled(w, r, "paused", changed, err)
+}
+
+// POST /admin/poller/resume
+// Starts a cycle straight away
+func (h *AdminHandler) ResumePoller(w http.ResponseWriter, r *http.Request) {
+	changed, err := h.control.Resume()
+	h.controlled(w, r, "resumed", changed, err)
+}
+
+// PATCH /admin/poller/config
+// Changes the given settings until the next restart, which goes back to the
+// environment. Durations are Go durations such as "90s".
+func (h *AdminHandler) TunePoller(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Concurrency          *int16  `json:"concurrency"`
+		PreDepartureWorkers  *int16  `json:"pre_departure_workers"`
+		Window               *string `json:"window"`
+		StaticErrorThreshold *int8   `json:"static_error_threshold"`
+		StallThreshold       *string `json:"stall_threshold"`
+		MaxRunsPerCycle      *int    `json:"max_runs_per_cycle"`
+		BackoffBase          *string `json:"backoff_base"`
+		BackoffMax           *string `json:"backoff_max"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	durations := map[string]*string{
+		"window":          body.Window,
+		"stall_threshold": body.StallThreshold,
+		"backoff_base":    body.BackoffBase,
+		"backoff_max":     body.BackoffMax,
+	}
+	parsed := make(map[string]time.Duration, len(durations))
+	for name, v := range durations {
+		if v == nil {
+			continue
+		}
+		d, err := time.ParseDuration(*v)
+		if err != nil {
+			httpError(w, r, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+			return
+		}
+		parsed[name] = d
+	}
+
+	tuning, err := h.control.Tune(func(t *poller.Tuning) {
+		if body.Concurrency != nil {
+			t.Concurrency = *body.Concurrency
+		}
+		if body.PreDepartureWorkers != nil {
+			t.PreDepartureWorkers = *body.PreDepartureWorkers
+		}
+		if body.StaticErrorThreshold != nil {
+			t.StaticErrorThreshold = *body.StaticErrorThreshold
+		}
+		if body.MaxRunsPerCycle != nil {
+			t.MaxRunsPerCycle = *body.MaxRunsPerCycle
+		}
+		if d, ok := parsed["window"]; ok {
+			t.Window = d
+		}
+		if d, ok := parsed["stall_threshold"]; ok {
+			t.StallThreshold = d
+		}
+		if d, ok := parsed["backoff_base"]; ok {
+			t.BackoffBase = d
+		}
+		if d, ok := parsed["backoff_max"]; ok {
+			t.BackoffMax = d
+		}
+	})
+	if errors.Is(err, poller.ErrNotRunning) {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: poller retuned by key %d | %s", issuer.ID, tuning)
+	writeJSON(w, h.logger, http.StatusOK, h.control.Status())
+}
+
+func (h *AdminHandler) controlled(w http.ResponseWriter, r *http.Request, action string, changed bool, err error) {
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	if changed {
+		issuer, _ := auth.FromContext(r.Context())
+		logf(h.logger, r, "handler: poller %s by key %d", action, issuer.ID)
+	}
+	writeJSON(w, h.logger, http.StatusOK, h.control.Status())
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"trano/internal/iri"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// most trains an on demand sync may name, the full list is the body-less request
+const maxSyncTrains = 500
+
+// POST /admin/sync {"train_nos": [12951, 12952]}
+// Syncs the named trains from IRI now, or every train without a body. Answers 202 with
+// the job, its progress is at the Location header.
+func (h *AdminHandler) StartSync(w http.ResponseWriter, r *http.Request) {
+	if h.syncJobs == nil {
+		httpError(w, r, "iri sync is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		TrainNos []int64 `json:"train_nos"`
+	}
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &body); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(body.TrainNos) > maxSyncTrains {
+		httpError(w, r, "at most "+strconv.Itoa(maxSyncTrains)+" train_nos, send no body to sync every train", http.StatusBadRequest)
+		return
+	}
+
+	// trains are synced from the page they were first seeded from
+	var urls, unknown []string
+	for _, trainNo := range body.TrainNos {
+		url, err := h.queries.GetTrainSourceURL(r.Context(), trainNo)
+		if errors.Is(err, sql.ErrNoRows) {
+			unknown = append(unknown, strconv.FormatInt(trainNo, 10))
+			continue
+		}
+		if err != nil {
+			logf(h.logger, r, "handler: train %d source url query failed: %v", trainNo, err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		urls = append(urls, url)
+	}
+	if len(unknown) > 0 {
+		httpError(w, r, "unknown train_nos: "+strings.Join(unknown, ", "), http.StatusNotFound)
+		return
+	}
+
+	job, err := h.syncJobs.Start(urls)
+	if errors.Is(err, iri.ErrSyncRunning) {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: sync start failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/admin/sync/"+job.ID)
+	writeJSON(w, h.logger, http.StatusAccepted, job)
+}
+
+// GET /admin/sync/{job_id}
+func (h *AdminHandler) GetSync(w http.ResponseWriter, r *http.Request) {
+	if h.syncJobs == nil {
+		httpError(w, r, "iri sync is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	job, ok := h.syncJobs.Get(chi.URLParam(r, "job_id"))
+	if !ok {
+		httpError(w, r, "sync job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusOK, job)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AnalyticsHandler serves the aggregated tables maintained by internal/analytics
+type AnalyticsHandler struct {
+	queries *db.Queries
+	db      *sql.DB
+	logger  *log.Logger
+	loc     *time.Location
+}
+
+func NewAnalyticsHandler(queries *db.Queries, dbConn *sql.DB, logger *log.Logger, loc *time.Location) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		queries: queries,
+		db:      dbConn,
+		logger:  logger,
+		loc:     loc,
+	}
+}
+
+// GET /v1/segments/{from}/{to}
+func (h *AnalyticsHandler) GetSegmentSpeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	from := strings.ToUpper(chi.URLParam(r, "from"))
+	to := strings.ToUpper(chi.URLParam(r, "to"))
+
+	stats, err := h.queries.GetSegmentStats(ctx, db.GetSegmentStatsParams{
+		FromStationCode: from,
+		ToStationCode:   to,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "no observations for segment", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: segment stats query failed for %s-%s: %v", from, to, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "segment_"+from+"_"+to+".csv", stats, func() csvTable {
+		return segmentsTable([]db.SegmentStat{stats})
+	})
+}
+
+// GET /v1/segments/slowest?limit=50&min_samples=5
+func (h *AnalyticsHandler) ListSlowestSegments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit := queryInt(r, "limit", 50, 1, 1000)
+	minSamples := queryInt(r, "min_samples", 5, 1, 100000)
+
+	segments, err := h.queries.ListSlowestSegments(ctx, db.ListSlowestSegmentsParams{
+		MinSamples: int64(minSamples),
+		Limit:      int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: slowest segments query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "slowest_segments.csv", map[string]any{
+		"total":    len(segments),
+		"segments": segments,
+	}, func() csvTable {
+		return segmentsTable(segments)
+	})
+}
+
+func segmentsTable(segments []db.SegmentStat) csvTable {
+	table := csvTable{Header: []string{
+		"from_station_code", "to_station_code", "distance_km", "samples", "avg_speed_kmh",
+		"min_speed_kmh", "max_speed_kmh", "avg_runtime_min", "updated_at",
+	}}
+	for _, s := range segments {
+		table.Rows = append(table.Rows, []string{
+			s.FromStationCode,
+			s.ToStationCode,
+			csvFloat(&s.DistanceKm),
+			strconv.FormatInt(s.Samples, 10),
+			csvFloat(&s.AvgSpeedKmh),
+			csvFloat(&s.MinSpeedKmh),
+			csvFloat(&s.MaxSpeedKmh),
+			csvFloat(&s.AvgRuntimeMin),
+			s.UpdatedAt,
+		})
+	}
+	return table
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Anomaly struct {
+	RunID       string   `json:"run_id"`
+	TrainNo     int64    `json:"train_no"`
+	TrainName   string   `json:"train_name"`
+	TrainType   string   `json:"train_type"`
+	Kind        string   `json:"kind"`
+	StationCode *string  `json:"station_code"`
+	StationName *string  `json:"station_name"`
+	Lat         *float64 `json:"lat"`
+	Lng         *float64 `json:"lng"`
+	DistanceKm  *float64 `json:"distance_km"`
+	Since       string   `json:"since"`
+	DurationMin int64    `json:"duration_min"`
+	DetectedAt  string   `json:"detected_at"`
+}
+
+// GET /v1/anomalies?kind=stalled
+func (h *RunHandler) ListAnomalies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	kind := r.URL.Query().Get("kind")
+
+	rows, err := h.queries.ListOpenAnomalies(ctx)
+	if err != nil {
+		logf(h.logger, r, "handler: open anomalies query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	anomalies := make([]Anomaly, 0, len(rows))
+	for _, row := range rows {
+		if kind != "" && row.Kind != kind {
+			continue
+		}
+		a := Anomaly{
+			RunID:       row.RunID,
+			TrainNo:     row.TrainNo,
+			TrainName:   row.TrainName,
+			TrainType:   row.TrainType,
+			Kind:        row.Kind,
+			StationCode: nullString(row.StationCode),
+			StationName: nullString(row.StationName),
+			Lat:         u6ToFloat(row.LatU6),
+			Lng:         u6ToFloat(row.LngU6),
+			DistanceKm:  u4ToFloat(row.DistanceKmU4),
+			Since:       row.SinceTs,
+			DetectedAt:  row.DetectedAt,
+		}
+		if since, err := time.Parse(time.RFC3339, row.SinceTs); err == nil {
+			a.DurationMin = int64(now.Sub(since).Minutes())
+		}
+		anomalies = append(anomalies, a)
+	}
+
+	respond(w, r, h.logger, "anomalies.csv", map[string]any{
+		"total":     len(anomalies),
+		"anomalies": anomalies,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "train_no", "train_name", "train_type", "kind", "station_code", "station_name",
+			"lat", "lng", "distance_km", "since", "duration_min", "detected_at",
+		}}
+		for _, a := range anomalies {
+			table.Rows = append(table.Rows, []string{
+				a.RunID,
+				strconv.FormatInt(a.TrainNo, 10),
+				a.TrainName,
+				a.TrainType,
+				a.Kind,
+				csvString(a.StationCode),
+				csvString(a.StationName),
+				csvFloat(a.Lat),
+				csvFloat(a.Lng),
+				csvFloat(a.DistanceKm),
+				a.Since,
+				strconv.FormatInt(a.DurationMin, 10),
+				a.DetectedAt,
+			})
+		}
+		return table
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"trano/internal/auth"
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type APIKey struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	KeyPrefix  string   `json:"key_prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	RevokedAt  *string  `json:"revoked_at"`
+}
+
+// GET /admin/keys
+func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.queries.ListAPIKeys(r.Context())
+	if err != nil {
+		logf(h.logger, r, "handler: api keys query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, APIKey{
+			ID:         row.ID,
+			Name:       row.Name,
+			KeyPrefix:  row.KeyPrefix,
+			Scopes:     strings.Fields(row.Scopes),
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: nullString(row.LastUsedAt),
+			RevokedAt:  nullString(row.RevokedAt),
+		})
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"total": len(keys),
+		"keys":  keys,
+	})
+}
+
+// POST /admin/keys {"name": "...", "scopes": ["admin"]}
+// The key is only in this response, the database keeps its hash
+func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		httpError(w, r, "name is required", http.StatusBadRequest)
+		return
+	}
+	scopes, err := auth.ParseScopes(strings.Join(body.Scopes, " "))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := auth.NewKey()
+	if err != nil {
+		logf(h.logger, r, "handler: api key generation failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	row, err := h.queries.CreateAPIKey(r.Context(), db.CreateAPIKeyParams{
+		Name:      body.Name,
+		KeyHash:   auth.Hash(key),
+		KeyPrefix: auth.Display(key),
+		Scopes:    strings.Join(scopes, " "),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: api key insert failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: api key %d (%s) created by key %d | scopes: %s", row.ID, body.Name, issuer.ID, strings.Join(scopes, " "))
+
+	writeJSON(w, h.logger, http.StatusCreated, map[string]any{
+		"id":         row.ID,
+		"name":       body.Name,
+		"key":        key,
+		"key_prefix": auth.Display(key),
+		"scopes":     scopes,
+		"created_at": row.CreatedAt,
+	})
+}
+
+// DELETE /admin/keys/{key_id}
+func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "key_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid key id", http.StatusBadRequest)
+		return
+	}
+
+	n, err := h.queries.RevokeAPIKey(r.Context(), db.RevokeAPIKeyParams{
+		RevokedAt: time.Now().UTC().Format(time.RFC3339),
+		ID:        id,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: api key %d revoke failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpError(w, r, "no active key with that id", http.StatusNotFound)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: api key %d revoked by key %d", id, issuer.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// the day's weekday is in the bitmap but the run was reported off
+	calendarNotRunning = "not_running"
+	calendarCancelled  = "cancelled"
+	// the weekday is not in the bitmap, or its bit was cleared, yet the train ran
+	calendarExtraRun = "extra_run"
+)
+
+type CalendarDay struct {
+	Date        string  `json:"date"`
+	Weekday     string  `json:"weekday"`
+	Runs        bool    `json:"runs"`
+	ScheduleIDs []int64 `json:"schedule_ids"` // schedules whose running days include the weekday
+	RunID       *string `json:"run_id"`
+	Status      *string `json:"status"`    // current_status of the run, when there is one
+	Exception   *string `json:"exception"` // not_running, cancelled or extra_run
+}
+
+// GET /v1/trains/{train_no}/calendar?month=YYYY-MM
+// The dates of a month the train leaves its origin. Running days come from the
+// schedule bitmaps, which the poller clears for weekdays upstream reports the train
+// not running on, and the runs recorded for the month mark the exceptions.
+func (h *RunHandler) GetTrainCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	trainNo, err := strconv.ParseInt(chi.URLParam(r, "train_no"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid train_no", http.StatusBadRequest)
+		return
+	}
+
+	month := time.Now().In(h.loc)
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, h.loc)
+	if raw := r.URL.Query().Get("month"); raw != "" {
+		month, err = time.ParseInLocation("2006-01", raw, h.loc)
+		if err != nil {
+			httpError(w, r, fmt.Sprintf("invalid month %q, expected YYYY-MM", raw), http.StatusBadRequest)
+			return
+		}
+	}
+	last := month.AddDate(0, 1, -1)
+
+	schedules, err := h.queries.ListTrainSchedules(ctx, trainNo)
+	if err != nil {
+		logf(h.logger, r, "handler: train %d schedules query failed: %v", trainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(schedules) == 0 {
+		httpError(w, r, "train has no schedule", http.StatusNotFound)
+		return
+	}
+
+	runs, err := h.queries.ListTrainRunDates(ctx, db.ListTrainRunDatesParams{
+		TrainNo:  trainNo,
+		FromDate: month.Format(time.DateOnly),
+		ToDate:   last.Format(time.DateOnly),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: train %d runs query failed: %v", trainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	runsByDate := make(map[string]db.ListTrainRunDatesRow, len(runs))
+	for _, run := range runs {
+		runsByDate[run.RunDate] = run
+	}
+
+	days := make([]CalendarDay, 0, last.Day())
+	running, exceptions := 0, 0
+	for d := month; !d.After(last); d = d.AddDate(0, 0, 1) {
+		date := d.Format(time.DateOnly)
+		day := CalendarDay{Date: date, Weekday: d.Weekday().String()[:3], ScheduleIDs: []int64{}}
+		for _, s := range schedules {
+			if s.RunningDaysBitmap&(1<<int(d.Weekday())) != 0 {
+				day.ScheduleIDs = append(day.ScheduleIDs, s.ScheduleID)
+			}
+		}
+		day.Runs = len(day.ScheduleIDs) > 0
+
+		if run, ok := runsByDate[date]; ok {
+			day.RunID, day.Status = &run.RunID, &run.CurrentStatus
+			var exception string
+			switch status := strings.ToLower(run.CurrentStatus); {
+			case status == "not_running_today":
+				exception = calendarNotRunning
+			case status == "cancelled":
+				exception = calendarCancelled
+			case !day.Runs && run.HasStarted == 1:
+				exception = calendarExtraRun
+			}
+			if exception != "" {
+				day.Exception = &exception
+				day.Runs = exception == calendarExtraRun
+				exceptions++
+			}
+		}
+		if day.Runs {
+			running++
+		}
+		days = append(days, day)
+	}
+
+	respond(w, r, h.logger, fmt.Sprintf("calendar_%d_%s.csv", trainNo, month.Format("2006-01")), map[string]any{
+		"train_no":     trainNo,
+		"month":        month.Format("2006-01"),
+		"running_days": runningDaysFrom(unionBitmap(schedules), 0),
+		"runs":         running,
+		"exceptions":   exceptions,
+		"days":         days,
+	}, func() csvTable {
+		table := csvTable{Header: []string{"train_no", "date", "weekday", "runs", "run_id", "status", "exception"}}
+		for _, d := range days {
+			table.Rows = append(table.Rows, []string{
+				strconv.FormatInt(trainNo, 10),
+				d.Date,
+				d.Weekday,
+				strconv.FormatBool(d.Runs),
+				csvString(d.RunID),
+				csvString(d.Status),
+				csvString(d.Exception),
+			})
+		}
+		return table
+	})
+}
+
+// unionBitmap is the running days of any of the schedules
+func unionBitmap(schedules []db.ListTrainSchedulesRow) int64 {
+	var bitmap int64
+	for _, s := range schedules {
+		bitmap |= s.RunningDaysBitmap
+	}
+	return bitmap
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "trano/internal/api/schema/v1"
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// zoom levels at or below this cluster without being asked to
+	clusterMaxZoom = 8
+	// grid cells across one map tile when the zoom is known, about 32px at 256px tiles
+	clusterCellsPerTile = 8
+	// grid cells across the viewport when only cluster=true is given
+	clusterViewportCells = 16
+)
+
+// clusterParams reads zoom and cluster. Clustering is on for cluster=true, or for a
+// zoom at or below clusterMaxZoom unless cluster=false. The grid cell in degrees is
+// zero when it has to come from the extent of the trains.
+func clusterParams(r *http.Request, box *bbox) (on bool, cellDeg float64) {
+	q := r.URL.Query()
+	zoom, err := strconv.Atoi(q.Get("zoom"))
+	hasZoom := err == nil && zoom >= 0 && zoom <= 22
+
+	switch strings.ToLower(q.Get("cluster")) {
+	case "true", "1":
+		on = true
+	case "false", "0":
+		return false, 0
+	default:
+		on = hasZoom && zoom <= clusterMaxZoom
+	}
+	if !on {
+		return false, 0
+	}
+
+	switch {
+	case hasZoom:
+		cellDeg = 360 / math.Exp2(float64(zoom)) / clusterCellsPerTile
+	case box != nil:
+		cellDeg = max(box.MaxLat-box.MinLat, box.MaxLng-box.MinLng) / clusterViewportCells
+	}
+	return true, cellDeg
+}
+
+// trainCluster aggregates the trains that fell into one grid cell
+type trainCluster struct {
+	latSum, lngSum                         float64
+	count                                  int
+	minLatU6, minLngU6, maxLatU6, maxLngU6 int64
+	types                                  map[string]int
+	rows                                   []int // indexes into the clustered rows
+}
+
+func (c *trainCluster) add(i int, latU6, lngU6 int64, trainType string) {
+	if c.count == 0 {
+		c.minLatU6, c.maxLatU6, c.minLngU6, c.maxLngU6 = latU6, latU6, lngU6, lngU6
+		c.types = map[string]int{}
+	}
+	c.latSum += float64(latU6)
+	c.lngSum += float64(lngU6)
+	c.count++
+	c.minLatU6, c.maxLatU6 = min(c.minLatU6, latU6), max(c.maxLatU6, latU6)
+	c.minLngU6, c.maxLngU6 = min(c.minLngU6, lngU6), max(c.maxLngU6, lngU6)
+	c.types[trainType]++
+	c.rows = append(c.rows, i)
+}
+
+func (c *trainCluster) centroidU6() (int64, int64) {
+	return int64(math.Round(c.latSum / float64(c.count))), int64(math.Round(c.lngSum / float64(c.count)))
+}
+
+// dominantType is the most common train type, ties go to the first by name
+func (c *trainCluster) dominantType() string {
+	best, bestN := "", 0
+	for t, n := range c.types {
+		if n > bestN || (n == bestN && t < best) {
+			best, bestN = t, n
+		}
+	}
+	return best
+}
+
+// clusterLiveTrains bins the trains with a position into a grid of cellDeg degrees,
+// picking a cell that splits their extent into clusterViewportCells when cellDeg is 0.
+// Cells holding one train give it back as single, the rest come back as clusters in
+// grid order. Trains without a position are always single.
+func clusterLiveTrains(rows []db.GetLiveTrainsRow, cellDeg float64) (single []db.GetLiveTrainsRow, clusters []*trainCluster) {
+	if cellDeg <= 0 {
+		minLat, minLng, maxLat, maxLng := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, r := range rows {
+			if r.LatU6.Valid && r.LngU6.Valid {
+				lat, lng := float64(r.LatU6.Int64)/1e6, float64(r.LngU6.Int64)/1e6
+				minLat, maxLat = min(minLat, lat), max(maxLat, lat)
+				minLng, maxLng = min(minLng, lng), max(maxLng, lng)
+			}
+		}
+		cellDeg = max(maxLat-minLat, maxLng-minLng) / clusterViewportCells
+		if !(cellDeg > 0) {
+			return rows, nil
+		}
+	}
+
+	type cell struct{ y, x int64 }
+	cells := map[cell]*trainCluster{}
+	for i, r := range rows {
+		if !r.LatU6.Valid || !r.LngU6.Valid {
+			single = append(single, r)
+			continue
+		}
+		k := cell{
+			y: int64(math.Floor(float64(r.LatU6.Int64) / 1e6 / cellDeg)),
+			x: int64(math.Floor(float64(r.LngU6.Int64) / 1e6 / cellDeg)),
+		}
+		c, ok := cells[k]
+		if !ok {
+			c = &trainCluster{}
+			cells[k] = c
+		}
+		c.add(i, r.LatU6.Int64, r.LngU6.Int64, r.TrainType)
+	}
+
+	keys := make([]cell, 0, len(cells))
+	for k := range cells {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].y != keys[j].y {
+			return keys[i].y < keys[j].y
+		}
+		return keys[i].x < keys[j].x
+	})
+	for _, k := range keys {
+		c := cells[k]
+		if c.count == 1 {
+			single = append(single, rows[c.rows[0]])
+			continue
+		}
+		clusters = append(clusters, c)
+	}
+	return single, clusters
+}
+
+// clusteredLiveTrains is mapLiveTrains for single trains plus the clusters, whose
+// dominant type indexes the same type table. Total still counts every train.
+func clusteredLiveTrains(single []db.GetLiveTrainsRow, clusters []*trainCluster, total int) *v1.LiveTrainsResponse {
+	resp := mapLiveTrains(single)
+	resp.Total = uint32(total)
+
+	typeIDs := map[string]uint32{}
+	for _, t := range resp.Types {
+		typeIDs[t.Type] = t.Id
+	}
+	for _, c := range clusters {
+		trainType := c.dominantType()
+		typeID, ok := typeIDs[trainType]
+		if !ok {
+			typeID = uint32(len(resp.Types) + 1)
+			typeIDs[trainType] = typeID
+			resp.Types = append(resp.Types, &v1.TrainType{Id: typeID, Type: trainType})
+		}
+		lat, lng := c.centroidU6()
+		resp.Clusters = append(resp.Clusters, &v1.TrainCluster{
+			LatU6:    uint32(lat),
+			LngU6:    uint32(lng),
+			Count:    uint32(c.count),
+			TypeId:   typeID,
+			MinLatU6: uint32(c.minLatU6),
+			MinLngU6: uint32(c.minLngU6),
+			MaxLatU6: uint32(c.maxLatU6),
+			MaxLngU6: uint32(c.maxLngU6),
+		})
+	}
+	return resp
+}
+
+// clusteredLiveTrainsGeoJSON adds a point per cluster to the single train features,
+// with cluster, point_count and dominant_type properties the way supercluster has them
+func clusteredLiveTrainsGeoJSON(single []db.GetLiveTrainsRow, clusters []*trainCluster) *geoFeatureCollection {
+	fc := liveTrainsGeoJSON(single)
+	for _, c := range clusters {
+		lat, lng := c.centroidU6()
+		fc.addPoint(float64(lat)/1e6, float64(lng)/1e6, map[string]any{
+			"cluster":       true,
+			"point_count":   c.count,
+			"dominant_type": c.dominantType(),
+			"bbox": []float64{
+				float64(c.minLatU6) / 1e6, float64(c.minLngU6) / 1e6,
+				float64(c.maxLatU6) / 1e6, float64(c.maxLngU6) / 1e6,
+			},
+		})
+	}
+	return fc
+}
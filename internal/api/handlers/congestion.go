@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /v1/stations/{station_code}/congestion?period=7d
+func (h *AnalyticsHandler) GetStationCongestion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stationCode := strings.ToUpper(chi.URLParam(r, "station_code"))
+
+	period, sinceDate, err := parsePeriod(r, "7d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hours, err := h.queries.ListStationCongestionByHour(ctx, db.ListStationCongestionByHourParams{
+		StationCode: stationCode,
+		SinceDate:   sinceDate,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: station congestion query failed for %s: %v", stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// live count comes straight from the latest fixes, not the nightly buckets
+	atStation, err := h.queries.CountTrainsAtStation(ctx, stationCode)
+	if err != nil {
+		logf(h.logger, r, "handler: trains at station query failed for %s: %v", stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var peak db.ListStationCongestionByHourRow
+	for _, hr := range hours {
+		if hr.PeakTrains > peak.PeakTrains || (hr.PeakTrains == peak.PeakTrains && hr.AvgTrains > peak.AvgTrains) {
+			peak = hr
+		}
+	}
+
+	respond(w, r, h.logger, "congestion_"+stationCode+"_"+period+".csv", map[string]any{
+		"station_code":      stationCode,
+		"period":            period,
+		"since":             sinceDate,
+		"trains_at_station": atStation,
+		"peak_hour":         peak.Hour,
+		"peak_trains":       peak.PeakTrains,
+		"hours":             hours,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"hour", "days_observed", "avg_trains_seen", "avg_trains", "avg_peak_trains", "peak_trains",
+		}}
+		for _, hr := range hours {
+			table.Rows = append(table.Rows, []string{
+				strconv.FormatInt(hr.Hour, 10),
+				strconv.FormatInt(hr.DaysObserved, 10),
+				csvFloat(&hr.AvgTrainsSeen),
+				csvFloat(&hr.AvgTrains),
+				csvFloat(&hr.AvgPeakTrains),
+				strconv.FormatInt(hr.PeakTrains, 10),
+			})
+		}
+		return table
+	})
+}
+
+// GET /v1/reports/congestion?period=7d&limit=20
+func (h *AnalyticsHandler) ListCongestedStations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	period, sinceDate, err := parsePeriod(r, "7d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := queryInt(r, "limit", 20, 1, 500)
+
+	stations, err := h.queries.ListCongestedStations(ctx, db.ListCongestedStationsParams{
+		SinceDate: sinceDate,
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: congested stations query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "congestion_"+period+".csv", map[string]any{
+		"period":   period,
+		"since":    sinceDate,
+		"total":    len(stations),
+		"stations": stations,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "station_name", "peak_trains", "avg_trains", "train_hours",
+		}}
+		for _, s := range stations {
+			table.Rows = append(table.Rows, []string{
+				s.StationCode,
+				s.StationName,
+				strconv.FormatInt(s.PeakTrains, 10),
+				csvFloat(&s.AvgTrains),
+				strconv.FormatInt(s.TrainHours, 10),
+			})
+		}
+		return table
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	coverageByDay   = "day"
+	coverageByTrain = "train"
+	coverageByRun   = "run"
+)
+
+type RunCoverage struct {
+	Group             string   `json:"group"`
+	Runs              int64    `json:"runs"`
+	Polls             int64    `json:"polls"`
+	SuccessfulPolls   int64    `json:"successful_polls"`
+	ExpectedPolls     int64    `json:"expected_polls"`
+	PollSuccessPct    *float64 `json:"poll_success_pct"`
+	PollCoveragePct   *float64 `json:"poll_coverage_pct"`
+	LocationPoints    int64    `json:"location_points"`
+	AvgPointsPerHour  *float64 `json:"avg_points_per_hour"`
+	Gaps              int64    `json:"gaps"`
+	LongestGapMin     *float64 `json:"longest_gap_min"`
+	StationActualsPct float64  `json:"station_actuals_pct"`
+}
+
+// GET /v1/reports/coverage?group_by=day|train|run&period=7d&train_no=12951
+// How completely runs were observed: polls made against the poller's schedule,
+// location density and gaps, and the share of scheduled stops with recorded actuals
+func (h *AnalyticsHandler) GetCoverage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = coverageByDay
+	}
+	if groupBy != coverageByDay && groupBy != coverageByTrain && groupBy != coverageByRun {
+		httpError(w, r, "invalid group_by, expected day, train or run", http.StatusBadRequest)
+		return
+	}
+
+	period, sinceDate, err := parsePeriod(r, "7d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trainNo := int64(queryInt(r, "train_no", 0, 0, 99999))
+
+	rows, err := h.queries.ListRunCoverage(ctx, db.ListRunCoverageParams{
+		GroupBy:   groupBy,
+		SinceDate: sinceDate,
+		TrainNo:   trainNo,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: run coverage query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	groups := make([]RunCoverage, 0, len(rows))
+	for _, row := range rows {
+		groups = append(groups, RunCoverage{
+			Group:             row.GroupKey,
+			Runs:              row.Runs,
+			Polls:             row.Polls,
+			SuccessfulPolls:   row.SuccessfulPolls,
+			ExpectedPolls:     row.ExpectedPolls,
+			PollSuccessPct:    pct(row.SuccessfulPolls, row.Polls),
+			PollCoveragePct:   pct(row.Polls, row.ExpectedPolls),
+			LocationPoints:    row.LocationPoints,
+			AvgPointsPerHour:  nullFloat(row.AvgPointsPerHour),
+			Gaps:              row.Gaps,
+			LongestGapMin:     nullFloat(row.LongestGapMin),
+			StationActualsPct: row.StationActualsPct,
+		})
+	}
+
+	respond(w, r, h.logger, "coverage_"+groupBy+"_"+period+".csv", map[string]any{
+		"group_by": groupBy,
+		"period":   period,
+		"since":    sinceDate,
+		"total":    len(groups),
+		"groups":   groups,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"group", "runs", "polls", "successful_polls", "expected_polls", "poll_success_pct", "poll_coverage_pct",
+			"location_points", "avg_points_per_hour", "gaps", "longest_gap_min", "station_actuals_pct",
+		}}
+		for _, g := range groups {
+			table.Rows = append(table.Rows, []string{
+				g.Group,
+				strconv.FormatInt(g.Runs, 10),
+				strconv.FormatInt(g.Polls, 10),
+				strconv.FormatInt(g.SuccessfulPolls, 10),
+				strconv.FormatInt(g.ExpectedPolls, 10),
+				csvFloat(g.PollSuccessPct),
+				csvFloat(g.PollCoveragePct),
+				strconv.FormatInt(g.LocationPoints, 10),
+				csvFloat(g.AvgPointsPerHour),
+				strconv.FormatInt(g.Gaps, 10),
+				csvFloat(g.LongestGapMin),
+				csvFloat(&g.StationActualsPct),
+			})
+		}
+		return table
+	})
+}
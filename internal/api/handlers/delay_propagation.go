@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	db "trano/internal/db/sqlc"
+)
+
+// GET /v1/reports/delay-propagation?period=7d&train_no=12951&limit=50
+// Per run breakdown of delay gained en route into delay inherited from the
+// train ahead on the same segment and delay of the run's own making
+func (h *AnalyticsHandler) GetDelayPropagation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	period, sinceDate, err := parsePeriod(r, "7d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trainNo := int64(queryInt(r, "train_no", 0, 0, 99999))
+	limit := queryInt(r, "limit", 50, 1, 1000)
+
+	runs, err := h.queries.ListRunDelayAttribution(ctx, db.ListRunDelayAttributionParams{
+		SinceDate: sinceDate,
+		TrainNo:   trainNo,
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: delay propagation query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var gained, inherited int64
+	for _, run := range runs {
+		gained += run.GainedMin
+		inherited += run.InheritedMin
+	}
+
+	respond(w, r, h.logger, "delay_propagation_"+period+".csv", map[string]any{
+		"period":        period,
+		"since":         sinceDate,
+		"total":         len(runs),
+		"gained_min":    gained,
+		"inherited_min": inherited,
+		"own_min":       gained - inherited,
+		"inherited_pct": pct(inherited, gained),
+		"runs":          runs,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "train_no", "train_name", "run_date", "segments", "gained_min", "inherited_min", "own_min",
+		}}
+		for _, run := range runs {
+			table.Rows = append(table.Rows, []string{
+				run.RunID,
+				strconv.FormatInt(run.TrainNo, 10),
+				run.TrainName,
+				run.RunDate,
+				strconv.FormatInt(run.Segments, 10),
+				strconv.FormatInt(run.GainedMin, 10),
+				strconv.FormatInt(run.InheritedMin, 10),
+				strconv.FormatInt(run.OwnMin, 10),
+			})
+		}
+		return table
+	})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+type DelayedRun struct {
+	RunID         string  `json:"run_id"`
+	TrainNo       int64   `json:"train_no"`
+	TrainName     string  `json:"train_name"`
+	TrainType     string  `json:"train_type"`
+	Zone          *string `json:"zone"`
+	RunDate       string  `json:"run_date"`
+	Status        string  `json:"status"`
+	Arrived       bool    `json:"arrived"`
+	DelayMin      int64   `json:"delay_min"`       // at the current station as of the last poll
+	AtStationCode *string `json:"at_station_code"` // the current station
+	LastUpdate    *string `json:"last_update"`
+}
+
+// GET /v1/stats/delays?date=YYYY-MM-DD&limit=20
+// The most delayed trains running now, or the runs of a past date by the delay they
+// last reported, which for finished runs is their delay at the terminus
+func (h *AnalyticsHandler) ListMostDelayedRuns(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date != "" {
+		if _, err := time.ParseInLocation(time.DateOnly, date, h.loc); err != nil {
+			httpError(w, r, fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", date), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := queryInt(r, "limit", 20, 1, 200)
+
+	rows, err := h.queries.ListMostDelayedRuns(r.Context(), db.ListMostDelayedRunsParams{
+		RunDate: date,
+		Limit:   int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: delayed runs query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	runs := make([]DelayedRun, 0, len(rows))
+	for _, row := range rows {
+		run := DelayedRun{
+			RunID:      row.RunID,
+			TrainNo:    row.TrainNo,
+			TrainName:  row.TrainName,
+			TrainType:  row.TrainType,
+			Zone:       nullString(row.Zone),
+			RunDate:    row.RunDate,
+			Status:     row.CurrentStatus,
+			Arrived:    row.HasArrived == 1,
+			DelayMin:   row.DelayMin,
+			LastUpdate: nullString(row.LastUpdateTimestampIso),
+		}
+		// last_updated_sno is "sno|station_code|..."
+		if parts := strings.SplitN(row.LastUpdatedSno.String, "|", 3); len(parts) >= 2 && parts[1] != "" {
+			run.AtStationCode = &parts[1]
+		}
+		runs = append(runs, run)
+	}
+
+	scope := "live"
+	if date != "" {
+		scope = date
+	}
+	respond(w, r, h.logger, "delays_"+scope+".csv", map[string]any{
+		"date":  nullableDate(date),
+		"total": len(runs),
+		"runs":  runs,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"rank", "run_id", "train_no", "train_name", "train_type", "zone", "run_date", "status", "arrived",
+			"delay_min", "at_station_code", "last_update",
+		}}
+		for i, run := range runs {
+			table.Rows = append(table.Rows, []string{
+				strconv.Itoa(i + 1),
+				run.RunID,
+				strconv.FormatInt(run.TrainNo, 10),
+				run.TrainName,
+				run.TrainType,
+				csvString(run.Zone),
+				run.RunDate,
+				run.Status,
+				strconv.FormatBool(run.Arrived),
+				strconv.FormatInt(run.DelayMin, 10),
+				csvString(run.AtStationCode),
+				csvString(run.LastUpdate),
+			})
+		}
+		return table
+	})
+}
+
+// nullableDate is nil for an empty date so the JSON says null
+func nullableDate(date string) *string {
+	if date == "" {
+		return nil
+	}
+	return &date
+}
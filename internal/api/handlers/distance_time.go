@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type DistanceTimePoint struct {
+	Timestamp           string   `json:"timestamp"`
+	DistanceKm          float64  `json:"distance_km"`
+	ScheduledDistanceKm *float64 `json:"scheduled_distance_km"`
+}
+
+type ScheduledPoint struct {
+	StationCode string  `json:"station_code"`
+	Timestamp   string  `json:"timestamp"`
+	DistanceKm  float64 `json:"distance_km"`
+
+	at time.Time
+}
+
+// GET /v1/runs/{run_id}/distance-time
+// Series for a string (Marey) diagram: actual fixes with the distance the timetable
+// expected at the same instant, plus the timetable line itself
+func (h *RunHandler) GetRunDistanceTime(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID := chi.URLParam(r, "run_id")
+
+	run, err := h.queries.GetRunPredictionContext(ctx, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: run context query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	route, err := h.queries.ListScheduleRoute(ctx, run.ScheduleID)
+	if err != nil {
+		logf(h.logger, r, "handler: schedule route query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	fixes, err := h.queries.ListRunLocations(ctx, runID)
+	if err != nil {
+		logf(h.logger, r, "handler: run locations query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	runDate, err := time.ParseInLocation(time.DateOnly, run.RunDate, h.loc)
+	if err != nil {
+		logf(h.logger, r, "handler: bad run date %q for %s: %v", run.RunDate, runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	originDeparture := runDate.Add(time.Duration(run.OriginSchDepartureMin) * time.Minute)
+
+	// arrival and departure per station give a stepped line (flat while dwelling)
+	scheduled := make([]ScheduledPoint, 0, 2*len(route))
+	for _, stn := range route {
+		arr := originDeparture.Add(time.Duration(stn.SchArrivalMinFromStart) * time.Minute)
+		dep := originDeparture.Add(time.Duration(stn.SchDepartureMinFromStart) * time.Minute)
+		scheduled = append(scheduled, ScheduledPoint{StationCode: stn.StationCode, Timestamp: arr.Format(time.RFC3339), DistanceKm: stn.DistanceKm, at: arr})
+		if dep.After(arr) {
+			scheduled = append(scheduled, ScheduledPoint{StationCode: stn.StationCode, Timestamp: dep.Format(time.RFC3339), DistanceKm: stn.DistanceKm, at: dep})
+		}
+	}
+
+	points := make([]DistanceTimePoint, 0, len(fixes))
+	for _, fix := range fixes {
+		p := DistanceTimePoint{
+			Timestamp:  fix.TimestampIso,
+			DistanceKm: float64(fix.DistanceKmU4) / 1e4,
+		}
+		if ts, err := time.Parse(time.RFC3339, fix.TimestampIso); err == nil {
+			p.ScheduledDistanceKm = scheduledDistanceAt(scheduled, ts)
+		}
+		points = append(points, p)
+	}
+
+	respond(w, r, h.logger, "distance_time_"+runID+".csv", map[string]any{
+		"run_id":    runID,
+		"points":    points,
+		"scheduled": scheduled,
+	}, func() csvTable {
+		table := csvTable{Header: []string{"run_id", "timestamp", "distance_km", "scheduled_distance_km"}}
+		for _, p := range points {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				p.Timestamp,
+				strconv.FormatFloat(p.DistanceKm, 'f', -1, 64),
+				csvFloat(p.ScheduledDistanceKm),
+			})
+		}
+		return table
+	})
+}
+
+// scheduledDistanceAt interpolates the timetable line at t, nil outside the timetable
+func scheduledDistanceAt(line []ScheduledPoint, t time.Time) *float64 {
+	for i := 1; i < len(line); i++ {
+		t0, t1 := line[i-1].at, line[i].at
+		if t.Before(t0) || t.After(t1) {
+			continue
+		}
+		d := line[i-1].DistanceKm
+		if t1.After(t0) {
+			d = lerp(d, line[i].DistanceKm, t.Sub(t0).Seconds()/t1.Sub(t0).Seconds())
+		}
+		return &d
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Encounter struct {
+	Kind            string  `json:"kind"`
+	Role            string  `json:"role"` // overtook, overtaken_by or crossed
+	OtherRunID      string  `json:"other_run_id"`
+	OtherTrainNo    int64   `json:"other_train_no"`
+	OtherTrainName  string  `json:"other_train_name"`
+	OtherTrainType  string  `json:"other_train_type"`
+	FromStationCode string  `json:"from_station_code"`
+	ToStationCode   string  `json:"to_station_code"`
+	At              *string `json:"at"`
+}
+
+// GET /v1/runs/{run_id}/encounters
+func (h *RunHandler) GetRunEncounters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID := chi.URLParam(r, "run_id")
+
+	rows, err := h.queries.ListRunEncounters(ctx, runID)
+	if err != nil {
+		logf(h.logger, r, "handler: run encounters query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	encounters := make([]Encounter, 0, len(rows))
+	for _, row := range rows {
+		e := Encounter{
+			Kind:            row.Kind,
+			OtherRunID:      row.OtherRunID,
+			OtherTrainNo:    row.OtherTrainNo,
+			OtherTrainName:  row.OtherTrainName,
+			OtherTrainType:  row.OtherTrainType,
+			FromStationCode: row.FromStationCode,
+			ToStationCode:   row.ToStationCode,
+			At:              unixToTime(sql.NullInt64{Int64: row.EncounterTm, Valid: true}, h.loc),
+		}
+		switch {
+		case row.Kind == "crossing":
+			e.Role = "crossed"
+			// segments are stored in the direction of run a
+			if row.IsA == 0 {
+				e.FromStationCode, e.ToStationCode = row.ToStationCode, row.FromStationCode
+			}
+		case row.IsA == 1:
+			e.Role = "overtook"
+		default:
+			e.Role = "overtaken_by"
+		}
+		encounters = append(encounters, e)
+	}
+
+	respond(w, r, h.logger, "encounters_"+runID+".csv", map[string]any{
+		"run_id":     runID,
+		"total":      len(encounters),
+		"encounters": encounters,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "kind", "role", "other_run_id", "other_train_no", "other_train_name", "other_train_type",
+			"from_station_code", "to_station_code", "at",
+		}}
+		for _, e := range encounters {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				e.Kind,
+				e.Role,
+				e.OtherRunID,
+				strconv.FormatInt(e.OtherTrainNo, 10),
+				e.OtherTrainName,
+				e.OtherTrainType,
+				e.FromStationCode,
+				e.ToStationCode,
+				csvString(e.At),
+			})
+		}
+		return table
+	})
+}
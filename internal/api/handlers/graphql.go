@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/graphql"
+	"trano/internal/iri"
+)
+
+const maxGraphQLRuns = 500
+
+type GraphQLHandler struct {
+	queries *db.Queries
+	logger  *log.Logger
+	loc     *time.Location
+	schema  *graphql.Schema
+}
+
+func NewGraphQLHandler(queries *db.Queries, logger *log.Logger, loc *time.Location) *GraphQLHandler {
+	h := &GraphQLHandler{queries: queries, logger: logger, loc: loc}
+	h.schema = h.buildSchema()
+	return h
+}
+
+// POST /graphql {"query": "...", "variables": {...}, "operationName": "..."}
+// GET /graphql?query=...&variables=... runs a query too, without one it serves the
+// schema as SDL. Errors in the query answer 400, errors while resolving come back
+// next to the data with 200 as GraphQL clients expect.
+func (h *GraphQLHandler) ServeGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		if q.Get("query") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			fmt.Fprint(w, h.schema.SDL())
+			return
+		}
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if raw := q.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				httpError(w, r, "invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := readJSON(w, r, &req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// trains and stations are fetched once per request however often they are nested
+	ctx := context.WithValue(r.Context(), graphQLLoaderKey{}, &graphQLLoader{
+		trains:   map[int64]map[string]any{},
+		stations: map[string]map[string]any{},
+	})
+	resp := h.schema.Execute(ctx, req)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, h.logger, status, resp)
+}
+
+type graphQLLoaderKey struct{}
+
+type graphQLLoader struct {
+	trains   map[int64]map[string]any
+	stations map[string]map[string]any
+}
+
+func loaderFrom(ctx context.Context) *graphQLLoader {
+	return ctx.Value(graphQLLoaderKey{}).(*graphQLLoader)
+}
+
+// errResolve is what resolvers report for database failures, the cause is logged
+var errResolve = errors.New("internal server error")
+
+func (h *GraphQLHandler) train(ctx context.Context, trainNo int64) (any, error) {
+	cache := loaderFrom(ctx).trains
+	if t, ok := cache[trainNo]; ok {
+		return nilIfEmpty(t), nil
+	}
+	row, err := h.queries.GetTrain(ctx, trainNo)
+	if errors.Is(err, sql.ErrNoRows) {
+		cache[trainNo] = nil
+		return nil, nil
+	}
+	if err != nil {
+		logContextf(h.logger, ctx, "handler: graphql train %d query failed: %v", trainNo, err)
+		return nil, errResolve
+	}
+	t := map[string]any{
+		"train_no":        row.TrainNo,
+		"train_name":      row.TrainName,
+		"train_type":      row.TrainType,
+		"zone":            nullString(row.Zone),
+		"return_train_no": nullInt(row.ReturnTrainNo),
+	}
+	cache[trainNo] = t
+	return t, nil
+}
+
+func (h *GraphQLHandler) station(ctx context.Context, code string) (any, error) {
+	cache := loaderFrom(ctx).stations
+	if s, ok := cache[code]; ok {
+		return nilIfEmpty(s), nil
+	}
+	row, err := h.queries.GetStation(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		cache[code] = nil
+		return nil, nil
+	}
+	if err != nil {
+		logContextf(h.logger, ctx, "handler: graphql station %s query failed: %v", code, err)
+		return nil, errResolve
+	}
+	s := map[string]any{
+		"station_code":        row.StationCode,
+		"station_name":        row.StationName,
+		"zone":                nullString(row.Zone),
+		"division":            nullString(row.Division),
+		"address":             nullString(row.Address),
+		"elevation_m":         nullFloat(row.ElevationM),
+		"lat":                 nullFloat(row.Lat),
+		"lng":                 nullFloat(row.Lng),
+		"number_of_platforms": nullInt(row.NumberOfPlatforms),
+		"station_type":        nullString(row.StationType),
+		"station_category":    nullString(row.StationCategory),
+		"track_type":          nullString(row.TrackType),
+	}
+	cache[code] = s
+	return s, nil
+}
+
+// nilIfEmpty keeps a cached miss from reading as an empty object
+func nilIfEmpty(m map[string]any) any {
+	if m == nil {
+		return nil
+	}
+	return m
+}
+
+func (h *GraphQLHandler) run(ctx context.Context, trainNo int64, date string) (any, error) {
+	runDate, err := time.ParseInLocation(time.DateOnly, date, h.loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	rows, err := h.queries.ListRunsByIDs(ctx, []string{fmt.Sprintf("%d_%s", trainNo, runDate.Format(time.DateOnly))})
+	if err != nil {
+		logContextf(h.logger, ctx, "handler: graphql run query failed: %v", err)
+		return nil, errResolve
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	run := batchRunSummary(rows[0])
+	return &run, nil
+}
+
+func (h *GraphQLHandler) buildSchema() *graphql.Schema {
+	station := &graphql.Object{
+		Name: "Station",
+		Fields: []*graphql.Field{
+			{Name: "station_code", Type: "String!"},
+			{Name: "station_name", Type: "String!"},
+			{Name: "zone", Type: "String"},
+			{Name: "division", Type: "String"},
+			{Name: "address", Type: "String"},
+			{Name: "elevation_m", Type: "Float"},
+			{Name: "lat", Type: "Float"},
+			{Name: "lng", Type: "Float"},
+			{Name: "number_of_platforms", Type: "Int"},
+			{Name: "station_type", Type: "String"},
+			{Name: "station_category", Type: "String"},
+			{Name: "track_type", Type: "String"},
+		},
+	}
+	stationOf := func(key string) func(p graphql.Params) (any, error) {
+		return func(p graphql.Params) (any, error) {
+			return h.station(p.Ctx, p.Source.(map[string]any)[key].(string))
+		}
+	}
+
+	stop := &graphql.Object{
+		Name:        "Stop",
+		Description: "A station on a schedule's route. Minutes count from the origin departure.",
+		Fields: []*graphql.Field{
+			{Name: "station_code", Type: "String!"},
+			{Name: "station_name", Type: "String!"},
+			{Name: "distance_km", Type: "Float!"},
+			{Name: "halt", Type: "Boolean!", Description: "false where the train only passes through"},
+			{Name: "arrival_min", Type: "Int!"},
+			{Name: "departure_min", Type: "Int!"},
+			{Name: "arrival", Type: "String!", Description: "HH:MM local"},
+			{Name: "departure", Type: "String!", Description: "HH:MM local"},
+			{Name: "day", Type: "Int!", Description: "1 on the origin date"},
+			{Name: "station", Type: "Station", Object: station, Resolve: stationOf("station_code")},
+		},
+	}
+
+	schedule := &graphql.Object{
+		Name: "Schedule",
+		Fields: []*graphql.Field{
+			{Name: "schedule_id", Type: "Int!"},
+			{Name: "origin_station_code", Type: "String!"},
+			{Name: "terminus_station_code", Type: "String!"},
+			{Name: "origin_departure", Type: "String!", Description: "HH:MM local"},
+			{Name: "running_days", Type: "[String!]!", Description: "weekdays it leaves the origin"},
+			{Name: "origin", Type: "Station", Object: station, Resolve: stationOf("origin_station_code")},
+			{Name: "terminus", Type: "Station", Object: station, Resolve: stationOf("terminus_station_code")},
+			{Name: "route", Type: "[Stop!]!", Object: stop, Resolve: func(p graphql.Params) (any, error) {
+				sch := p.Source.(map[string]any)
+				scheduleID, originMin := sch["schedule_id"].(int64), sch["origin_min"].(int64)
+				rows, err := h.queries.ListScheduleRoute(p.Ctx, scheduleID)
+				if err != nil {
+					logContextf(h.logger, p.Ctx, "handler: graphql schedule %d route query failed: %v", scheduleID, err)
+					return nil, errResolve
+				}
+				stops := make([]map[string]any, 0, len(rows))
+				for _, row := range rows {
+					arr := originMin + row.SchArrivalMinFromStart
+					stops = append(stops, map[string]any{
+						"station_code":  row.StationCode,
+						"station_name":  row.StationName,
+						"distance_km":   row.DistanceKm,
+						"halt":          row.Stops == 1,
+						"arrival_min":   row.SchArrivalMinFromStart,
+						"departure_min": row.SchDepartureMinFromStart,
+						"arrival":       clockMin(arr),
+						"departure":     clockMin(originMin + row.SchDepartureMinFromStart),
+						"day":           arr/1440 + 1,
+					})
+				}
+				return stops, nil
+			}},
+		},
+	}
+	coach := &graphql.Object{
+		Name: "Coach",
+		Fields: []*graphql.Field{
+			{Name: "position", Type: "Int!", Description: "from 1 at the locomotive end"},
+			{Name: "code", Type: "String!"},
+			{Name: "class", Type: "String!", Description: "empty for non passenger coaches"},
+			{Name: "kind", Type: "String!"},
+		},
+	}
+
+	run := &graphql.Object{
+		Name: "Run",
+		Fields: []*graphql.Field{
+			{Name: "run_id", Type: "String!"},
+			{Name: "train_no", Type: "Int!"},
+			{Name: "train_name", Type: "String!"},
+			{Name: "train_type", Type: "String!"},
+			{Name: "run_date", Type: "String!"},
+			{Name: "origin_station_code", Type: "String!"},
+			{Name: "terminus_station_code", Type: "String!"},
+			{Name: "has_started", Type: "Boolean!"},
+			{Name: "has_arrived", Type: "Boolean!"},
+			{Name: "status", Type: "String!"},
+			{Name: "lat", Type: "Float"},
+			{Name: "lng", Type: "Float"},
+			{Name: "distance_km", Type: "Float"},
+			{Name: "last_update", Type: "String"},
+			{Name: "anomaly", Type: "String"},
+			{Name: "quality_score", Type: "Int"},
+			{Name: "carried_by", Type: "String", Description: "run id of the train carrying this one"},
+		},
+	}
+
+	train := &graphql.Object{
+		Name: "Train",
+		Fields: []*graphql.Field{
+			{Name: "train_no", Type: "Int!"},
+			{Name: "train_name", Type: "String!"},
+			{Name: "train_type", Type: "String!"},
+			{Name: "zone", Type: "String"},
+			{Name: "return_train_no", Type: "Int"},
+			{Name: "schedules", Type: "[Schedule!]!", Object: schedule, Resolve: func(p graphql.Params) (any, error) {
+				trainNo := p.Source.(map[string]any)["train_no"].(int64)
+				rows, err := h.queries.ListTrainSchedules(p.Ctx, trainNo)
+				if err != nil {
+					logContextf(h.logger, p.Ctx, "handler: graphql train %d schedules query failed: %v", trainNo, err)
+					return nil, errResolve
+				}
+				schedules := make([]map[string]any, 0, len(rows))
+				for _, row := range rows {
+					schedules = append(schedules, map[string]any{
+						"schedule_id":           row.ScheduleID,
+						"origin_station_code":   row.OriginStationCode,
+						"terminus_station_code": row.TerminusStationCode,
+						"origin_departure":      clockMin(row.OriginSchDepartureMin),
+						"origin_min":            row.OriginSchDepartureMin,
+						"running_days":          runningDaysFrom(row.RunningDaysBitmap, 0),
+					})
+				}
+				return schedules, nil
+			}},
+			{Name: "coaches", Type: "[Coach!]!", Object: coach, Resolve: func(p graphql.Params) (any, error) {
+				trainNo := p.Source.(map[string]any)["train_no"].(int64)
+				rows, err := h.queries.ListTrainCoaches(p.Ctx, trainNo)
+				if err != nil {
+					logContextf(h.logger, p.Ctx, "handler: graphql train %d coaches query failed: %v", trainNo, err)
+					return nil, errResolve
+				}
+				coaches := make([]iri.Coach, 0, len(rows))
+				for _, row := range rows {
+					coaches = append(coaches, iri.Coach{Position: int(row.Position), Code: row.CoachCode, Class: row.Class.String, Kind: row.Kind})
+				}
+				return coaches, nil
+			}},
+			{Name: "run", Type: "Run", Object: run, Description: "the run leaving the origin on date",
+				Args: []graphql.Arg{{Name: "date", Type: "String!", Description: "YYYY-MM-DD"}},
+				Resolve: func(p graphql.Params) (any, error) {
+					return h.run(p.Ctx, p.Source.(map[string]any)["train_no"].(int64), p.Args["date"].(string))
+				}},
+		},
+	}
+	// Run and Train refer to each other
+	run.Fields = append(run.Fields, &graphql.Field{Name: "train", Type: "Train", Object: train, Resolve: func(p graphql.Params) (any, error) {
+		return h.train(p.Ctx, p.Source.(*RunSummary).TrainNo)
+	}})
+
+	live := &graphql.Object{
+		Name: "LiveTrain",
+		Fields: []*graphql.Field{
+			{Name: "train_no", Type: "Int!"},
+			{Name: "train_name", Type: "String!"},
+			{Name: "train_type", Type: "String!"},
+			{Name: "lat", Type: "Float"},
+			{Name: "lng", Type: "Float"},
+			{Name: "bearing_deg", Type: "Int"},
+			{Name: "status", Type: "String!"},
+			{Name: "delay_min", Type: "Int", Description: "late at the current station, negative when early"},
+			{Name: "speed_kmh", Type: "Float", Description: "between the last two fixes"},
+			{Name: "avg_speed_kmh", Type: "Float", Description: "over the last few fixes"},
+			{Name: "extrapolated", Type: "Boolean!", Description: "the position is dead reckoned from the last fix along the route"},
+			{Name: "last_update", Type: "String"},
+			{Name: "linked_train_nos", Type: "[Int!]!", Description: "trains riding on this one"},
+			{Name: "train", Type: "Train", Object: train, Resolve: func(p graphql.Params) (any, error) {
+				return h.train(p.Ctx, p.Source.(map[string]any)["train_no"].(int64))
+			}},
+		},
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.Field{
+			{Name: "train", Type: "Train", Object: train,
+				Args: []graphql.Arg{{Name: "train_no", Type: "Int!"}},
+				Resolve: func(p graphql.Params) (any, error) {
+					return h.train(p.Ctx, p.Args["train_no"].(int64))
+				}},
+			{Name: "station", Type: "Station", Object: station,
+				Args: []graphql.Arg{{Name: "code", Type: "String!"}},
+				Resolve: func(p graphql.Params) (any, error) {
+					return h.station(p.Ctx, strings.ToUpper(p.Args["code"].(string)))
+				}},
+			{Name: "run", Type: "Run", Object: run,
+				Args: []graphql.Arg{{Name: "train_no", Type: "Int!"}, {Name: "date", Type: "String!", Description: "YYYY-MM-DD"}},
+				Resolve: func(p graphql.Params) (any, error) {
+					return h.run(p.Ctx, p.Args["train_no"].(int64), p.Args["date"].(string))
+				}},
+			{Name: "runs", Type: "[Run!]!", Object: run, Description: "runs leaving their origin on date, in train number order",
+				Args: []graphql.Arg{
+					{Name: "date", Type: "String", Description: "YYYY-MM-DD, today by default"},
+					{Name: "status", Type: "String", Description: "scheduled, running, completed or cancelled"},
+					{Name: "limit", Type: "Int", Default: int64(100)},
+				},
+				Resolve: h.resolveRuns},
+			{Name: "live_trains", Type: "[LiveTrain!]!", Object: live, Description: "trains reporting a position in the last 15 minutes",
+				Args: []graphql.Arg{
+					{Name: "min_lat", Type: "Float"}, {Name: "min_lng", Type: "Float"},
+					{Name: "max_lat", Type: "Float"}, {Name: "max_lng", Type: "Float"},
+				},
+				Resolve: h.resolveLiveTrains},
+		},
+	}
+	return &graphql.Schema{Query: query}
+}
+
+func (h *GraphQLHandler) resolveRuns(p graphql.Params) (any, error) {
+	runDate := time.Now().In(h.loc).Format(time.DateOnly)
+	if date, ok := p.Args["date"].(string); ok {
+		d, err := time.ParseInLocation(time.DateOnly, date, h.loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+		runDate = d.Format(time.DateOnly)
+	}
+	status, _ := p.Args["status"].(string)
+	status = strings.ToLower(status)
+	if status != "" && !runStatusFilters[status] {
+		return nil, errors.New("invalid status, expected scheduled, running, completed or cancelled")
+	}
+	limit, _ := p.Args["limit"].(int64)
+	if limit < 1 || limit > maxGraphQLRuns {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxGraphQLRuns)
+	}
+
+	rows, err := h.queries.ListRunsByDate(p.Ctx, db.ListRunsByDateParams{
+		RunDate:    runDate,
+		MinQuality: 0,
+		Status:     status,
+		HasStarted: -1,
+		Limit:      limit,
+	})
+	if err != nil {
+		logContextf(h.logger, p.Ctx, "handler: graphql runs query failed: %v", err)
+		return nil, errResolve
+	}
+	runs := make([]RunSummary, 0, len(rows))
+	for _, row := range rows {
+		runs = append(runs, runSummary(row))
+	}
+	return runs, nil
+}
+
+func (h *GraphQLHandler) resolveLiveTrains(p graphql.Params) (any, error) {
+	var box *bbox
+	keys := []string{"min_lat", "min_lng", "max_lat", "max_lng"}
+	var v [4]float64
+	given := 0
+	for i, key := range keys {
+		if f, ok := p.Args[key].(float64); ok {
+			v[i] = f
+			given++
+		}
+	}
+	switch given {
+	case 0:
+	case 4:
+		var err error
+		if box, err = newBBox(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("min_lat, min_lng, max_lat and max_lng go together")
+	}
+
+	rows, err := h.queries.GetLiveTrains(p.Ctx)
+	if err != nil {
+		logContextf(h.logger, p.Ctx, "handler: graphql live trains query failed: %v", err)
+		return nil, errResolve
+	}
+	trains := make([]map[string]any, 0, len(rows))
+	for _, r := range rows {
+		if box != nil && !(r.LatU6.Valid && r.LngU6.Valid && box.containsU6(r.LatU6.Int64, r.LngU6.Int64)) {
+			continue
+		}
+		linked := []int64{}
+		for _, no := range parseTrainNos(r.LinkedTrainNos) {
+			linked = append(linked, int64(no))
+		}
+		trains = append(trains, map[string]any{
+			"train_no":         r.TrainNo,
+			"train_name":       r.TrainName,
+			"train_type":       r.TrainType,
+			"lat":              u6ToFloat(r.LatU6),
+			"lng":              u6ToFloat(r.LngU6),
+			"bearing_deg":      nullInt(r.BearingDeg),
+			"status":           statusString(r.CurrentStatus),
+			"delay_min":        nullInt(r.CurrentDelayMin),
+			"speed_kmh":        nullFloat(r.SpeedKmh),
+			"avg_speed_kmh":    nullFloat(r.AvgSpeedKmh),
+			"extrapolated":     r.Extrapolated != 0,
+			"last_update":      nullString(r.LastUpdateTimestampIso),
+			"linked_train_nos": linked,
+		})
+	}
+	return trains, nil
+}
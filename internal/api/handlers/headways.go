@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GET /v1/stations/{station_code}/headways
+func (h *AnalyticsHandler) GetStationHeadways(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stationCode := strings.ToUpper(chi.URLParam(r, "station_code"))
+
+	headways, err := h.queries.ListStationHeadways(ctx, stationCode)
+	if err != nil {
+		logf(h.logger, r, "handler: station headways query failed for %s: %v", stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "headways_"+stationCode+".csv", map[string]any{
+		"station_code": stationCode,
+		"total":        len(headways),
+		"directions":   headways,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "next_station_code", "next_station_name", "samples", "min_headway_min",
+			"avg_headway_min", "max_headway_min", "bunched", "updated_at",
+		}}
+		for _, hw := range headways {
+			table.Rows = append(table.Rows, []string{
+				hw.StationCode,
+				hw.NextStationCode,
+				hw.NextStationName,
+				strconv.FormatInt(hw.Samples, 10),
+				csvFloat(&hw.MinHeadwayMin),
+				csvFloat(&hw.AvgHeadwayMin),
+				csvFloat(&hw.MaxHeadwayMin),
+				strconv.FormatInt(hw.Bunched, 10),
+				hw.UpdatedAt,
+			})
+		}
+		return table
+	})
+}
+
+// GET /v1/reports/headways?min_samples=50&limit=50
+func (h *AnalyticsHandler) ListBunchedHeadways(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	minSamples := queryInt(r, "min_samples", 50, 1, 100000)
+	limit := queryInt(r, "limit", 50, 1, 1000)
+
+	headways, err := h.queries.ListBunchedHeadways(ctx, db.ListBunchedHeadwaysParams{
+		MinSamples: int64(minSamples),
+		Limit:      int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: bunched headways query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "headways_bunched.csv", map[string]any{
+		"total":      len(headways),
+		"directions": headways,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "station_name", "next_station_code", "samples", "min_headway_min",
+			"avg_headway_min", "max_headway_min", "bunched", "bunched_pct",
+		}}
+		for _, hw := range headways {
+			table.Rows = append(table.Rows, []string{
+				hw.StationCode,
+				hw.StationName,
+				hw.NextStationCode,
+				strconv.FormatInt(hw.Samples, 10),
+				csvFloat(&hw.MinHeadwayMin),
+				csvFloat(&hw.AvgHeadwayMin),
+				csvFloat(&hw.MaxHeadwayMin),
+				strconv.FormatInt(hw.Bunched, 10),
+				csvFloat(&hw.BunchedPct),
+			})
+		}
+		return table
+	})
+}
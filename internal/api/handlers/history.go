@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	snapshotInterpolated = "interpolated"
+	snapshotLastFix      = "last_fix"
+)
+
+type SnapshotTrain struct {
+	RunID       string  `json:"run_id"`
+	TrainNo     int64   `json:"train_no"`
+	TrainName   string  `json:"train_name"`
+	TrainType   string  `json:"train_type"`
+	Lat         float64 `json:"lat"`
+	Lng         float64 `json:"lng"`
+	DistanceKm  float64 `json:"distance_km"`
+	StationCode string  `json:"station_code"`
+	AtStation   bool    `json:"at_station"`
+	Source      string  `json:"source"`
+	FixAgeSec   int64   `json:"fix_age_sec"`
+}
+
+// GET /v1/history/{date}/snapshot?time=14:30&max_gap_min=30&min_quality=60
+// Reconstructs every train's position at a past instant from the location log,
+// interpolating between the fixes either side of it
+func (h *RunHandler) GetHistorySnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	date, err := time.ParseInLocation(time.DateOnly, chi.URLParam(r, "date"), h.loc)
+	if err != nil {
+		httpError(w, r, "invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	clock, err := time.Parse("15:04", r.URL.Query().Get("time"))
+	if err != nil {
+		httpError(w, r, "invalid time, expected HH:MM", http.StatusBadRequest)
+		return
+	}
+	at := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, h.loc)
+	if at.After(time.Now()) {
+		httpError(w, r, "snapshot time is in the future", http.StatusBadRequest)
+		return
+	}
+
+	// a train is only placed when it reported within max_gap of the instant
+	maxGap := time.Duration(queryInt(r, "max_gap_min", 30, 1, 180)) * time.Minute
+
+	rows, err := h.queries.ListLocationsBetween(ctx, db.ListLocationsBetweenParams{
+		FromTs:     at.Add(-maxGap).Format(time.RFC3339),
+		ToTs:       at.Add(maxGap).Format(time.RFC3339),
+		MinQuality: queryInt(r, "min_quality", 0, 0, 100),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: history snapshot query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	trains := snapshotAt(rows, at)
+
+	respond(w, r, h.logger, "snapshot_"+at.Format("2006-01-02T1504")+".csv", map[string]any{
+		"at":     at.Format(time.RFC3339),
+		"total":  len(trains),
+		"trains": trains,
+	}, func() csvTable { return snapshotTable(trains) })
+}
+
+// GET /v1/history/positions?at=2025-05-10T14:30:00+05:30&max_age_min=30&min_quality=60
+// Where every train was at a past instant as its last fix at or before it, without
+// interpolation. Trains silent for longer than max_age before the instant are left out.
+func (h *RunHandler) GetHistoryPositions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	at, err := time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+	if err != nil {
+		httpError(w, r, "invalid at, expected an RFC3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	if at.After(time.Now()) {
+		httpError(w, r, "at is in the future", http.StatusBadRequest)
+		return
+	}
+	// fixes are logged in local time and compared as text
+	at = at.In(h.loc)
+	maxAge := time.Duration(queryInt(r, "max_age_min", 30, 1, 180)) * time.Minute
+
+	rows, err := h.queries.ListPositionsAt(ctx, db.ListPositionsAtParams{
+		FromTs:     at.Add(-maxAge).Format(time.RFC3339),
+		AtTs:       at.Format(time.RFC3339),
+		MinQuality: queryInt(r, "min_quality", 0, 0, 100),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: history positions query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	trains := make([]SnapshotTrain, 0, len(rows))
+	for _, row := range rows {
+		fix := db.ListLocationsBetweenRow(row)
+		ts, err := time.Parse(time.RFC3339, fix.TimestampIso)
+		if err != nil {
+			continue
+		}
+		lat, lng := fixPosition(&fix)
+		trains = append(trains, SnapshotTrain{
+			RunID:       fix.RunID,
+			TrainNo:     fix.TrainNo,
+			TrainName:   fix.TrainName,
+			TrainType:   fix.TrainType,
+			Lat:         lat,
+			Lng:         lng,
+			DistanceKm:  float64(fix.DistanceKmU4) / 1e4,
+			StationCode: fix.SegmentStationCode,
+			AtStation:   fix.AtStation == 1,
+			Source:      snapshotLastFix,
+			FixAgeSec:   int64(at.Sub(ts).Seconds()),
+		})
+	}
+
+	if wantsGeoJSON(r) {
+		fc := newFeatureCollection(len(trains))
+		for _, t := range trains {
+			fc.addPoint(t.Lat, t.Lng, map[string]any{
+				"run_id":       t.RunID,
+				"train_no":     t.TrainNo,
+				"train_name":   t.TrainName,
+				"train_type":   t.TrainType,
+				"distance_km":  t.DistanceKm,
+				"station_code": t.StationCode,
+				"at_station":   t.AtStation,
+				"fix_age_sec":  t.FixAgeSec,
+			})
+		}
+		writeGeoJSON(w, h.logger, fc)
+		return
+	}
+
+	respond(w, r, h.logger, "positions_"+at.Format("2006-01-02T150405")+".csv", map[string]any{
+		"at":     at.Format(time.RFC3339),
+		"total":  len(trains),
+		"trains": trains,
+	}, func() csvTable { return snapshotTable(trains) })
+}
+
+func snapshotTable(trains []SnapshotTrain) csvTable {
+	table := csvTable{Header: []string{
+		"run_id", "train_no", "train_name", "train_type", "lat", "lng", "distance_km",
+		"station_code", "at_station", "source", "fix_age_sec",
+	}}
+	for _, t := range trains {
+		table.Rows = append(table.Rows, []string{
+			t.RunID,
+			strconv.FormatInt(t.TrainNo, 10),
+			t.TrainName,
+			t.TrainType,
+			csvFloat(&t.Lat),
+			csvFloat(&t.Lng),
+			csvFloat(&t.DistanceKm),
+			t.StationCode,
+			strconv.FormatBool(t.AtStation),
+			t.Source,
+			strconv.FormatInt(t.FixAgeSec, 10),
+		})
+	}
+	return table
+}
+
+// snapshotAt picks, per run, the fixes just before and after at (rows are ordered
+// by run and time) and interpolates between them. Runs with no fix before at are
+// skipped since they had not started reporting yet.
+func snapshotAt(rows []db.ListLocationsBetweenRow, at time.Time) []SnapshotTrain {
+	trains := []SnapshotTrain{}
+
+	for i := 0; i < len(rows); {
+		j := i
+		for j < len(rows) && rows[j].RunID == rows[i].RunID {
+			j++
+		}
+
+		var prev, next *db.ListLocationsBetweenRow
+		var prevTs, nextTs time.Time
+		for k := i; k < j; k++ {
+			ts, err := time.Parse(time.RFC3339, rows[k].TimestampIso)
+			if err != nil {
+				continue
+			}
+			if !ts.After(at) {
+				prev, prevTs = &rows[k], ts
+			} else if next == nil {
+				next, nextTs = &rows[k], ts
+			}
+		}
+		i = j
+
+		if prev == nil {
+			continue
+		}
+
+		lat, lng := fixPosition(prev)
+		t := SnapshotTrain{
+			RunID:       prev.RunID,
+			TrainNo:     prev.TrainNo,
+			TrainName:   prev.TrainName,
+			TrainType:   prev.TrainType,
+			Lat:         lat,
+			Lng:         lng,
+			DistanceKm:  float64(prev.DistanceKmU4) / 1e4,
+			StationCode: prev.SegmentStationCode,
+			AtStation:   prev.AtStation == 1,
+			Source:      snapshotLastFix,
+			FixAgeSec:   int64(at.Sub(prevTs).Seconds()),
+		}
+
+		if next != nil && at.After(prevTs) {
+			frac := at.Sub(prevTs).Seconds() / nextTs.Sub(prevTs).Seconds()
+			nextLat, nextLng := fixPosition(next)
+			t.Lat = lerp(lat, nextLat, frac)
+			t.Lng = lerp(lng, nextLng, frac)
+			t.DistanceKm = lerp(t.DistanceKm, float64(next.DistanceKmU4)/1e4, frac)
+			t.Source = snapshotInterpolated
+			t.FixAgeSec = int64(math.Min(at.Sub(prevTs).Seconds(), nextTs.Sub(at).Seconds()))
+		}
+
+		trains = append(trains, t)
+	}
+
+	return trains
+}
+
+// fixPosition prefers the route-snapped position when the poller could snap the fix
+func fixPosition(row *db.ListLocationsBetweenRow) (float64, float64) {
+	if row.SnappedLatU6.Valid && row.SnappedLngU6.Valid {
+		return float64(row.SnappedLatU6.Int64) / 1e6, float64(row.SnappedLngU6.Int64) / 1e6
+	}
+	return float64(row.LatU6) / 1e6, float64(row.LngU6) / 1e6
+}
+
+func lerp(a, b, frac float64) float64 {
+	return a + (b-a)*frac
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	db "trano/internal/db/sqlc"
+)
+
+type JourneyTimeStats struct {
+	TrainNo      int64   `json:"train_no,omitempty"`
+	TrainName    string  `json:"train_name,omitempty"`
+	Runs         int     `json:"runs"`
+	ScheduledMin float64 `json:"scheduled_min"`
+	MinMin       float64 `json:"min_min"`
+	P50Min       float64 `json:"p50_min"`
+	P90Min       float64 `json:"p90_min"`
+	P99Min       float64 `json:"p99_min"`
+	MaxMin       float64 `json:"max_min"`
+}
+
+// GET /v1/reports/journey-time?from=NDLS&to=BCT&train_no=12951&period=90d&min_quality=60
+// Observed journey times (departure from `from` to arrival at `to`) over recent runs,
+// overall and per train
+func (h *AnalyticsHandler) GetJourneyTime(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	from := strings.ToUpper(r.URL.Query().Get("from"))
+	to := strings.ToUpper(r.URL.Query().Get("to"))
+	if from == "" || to == "" || from == to {
+		httpError(w, r, "from and to must be two different station codes", http.StatusBadRequest)
+		return
+	}
+	trainNo := int64(queryInt(r, "train_no", 0, 0, 99999))
+
+	period, sinceDate, err := parsePeriod(r, "90d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.queries.ListJourneyTimes(ctx, db.ListJourneyTimesParams{
+		FromCode:   from,
+		ToCode:     to,
+		SinceDate:  sinceDate,
+		TrainNo:    trainNo,
+		MinQuality: queryInt(r, "min_quality", 0, 0, 100),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: journey times query failed for %s-%s: %v", from, to, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// rows are ordered by train, so each train is a contiguous block
+	trains := []JourneyTimeStats{}
+	for i := 0; i < len(rows); {
+		j := i
+		for j < len(rows) && rows[j].TrainNo == rows[i].TrainNo {
+			j++
+		}
+		stats := journeyStats(rows[i:j])
+		stats.TrainNo = rows[i].TrainNo
+		stats.TrainName = rows[i].TrainName
+		trains = append(trains, stats)
+		i = j
+	}
+
+	var overall *JourneyTimeStats
+	if len(rows) > 0 {
+		stats := journeyStats(rows)
+		overall = &stats
+	}
+
+	respond(w, r, h.logger, "journey_time_"+from+"_"+to+"_"+period+".csv", map[string]any{
+		"from":    from,
+		"to":      to,
+		"period":  period,
+		"since":   sinceDate,
+		"overall": overall,
+		"trains":  trains,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"from", "to", "train_no", "train_name", "runs", "scheduled_min", "min_min", "p50_min", "p90_min", "p99_min", "max_min",
+		}}
+		for _, s := range trains {
+			table.Rows = append(table.Rows, []string{
+				from,
+				to,
+				strconv.FormatInt(s.TrainNo, 10),
+				s.TrainName,
+				strconv.Itoa(s.Runs),
+				csvFloat(&s.ScheduledMin),
+				csvFloat(&s.MinMin),
+				csvFloat(&s.P50Min),
+				csvFloat(&s.P90Min),
+				csvFloat(&s.P99Min),
+				csvFloat(&s.MaxMin),
+			})
+		}
+		return table
+	})
+}
+
+// journeyStats summarises a non-empty set of runs in minutes, the scheduled time is
+// the median since a train's timetable can change within the period
+func journeyStats(rows []db.ListJourneyTimesRow) JourneyTimeStats {
+	actual := make([]float64, 0, len(rows))
+	scheduled := make([]float64, 0, len(rows))
+	for _, row := range rows {
+		actual = append(actual, float64(row.JourneySec)/60)
+		scheduled = append(scheduled, float64(row.ScheduledSec)/60)
+	}
+	slices.Sort(actual)
+	slices.Sort(scheduled)
+
+	return JourneyTimeStats{
+		Runs:         len(rows),
+		ScheduledMin: percentile(scheduled, 50),
+		MinMin:       actual[0],
+		P50Min:       percentile(actual, 50),
+		P90Min:       percentile(actual, 90),
+		P99Min:       percentile(actual, 99),
+		MaxMin:       actual[len(actual)-1],
+	}
+}
+
+// percentile uses the nearest-rank method on sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
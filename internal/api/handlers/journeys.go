@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+type Journey struct {
+	TrainNo             int64    `json:"train_no"`
+	TrainName           string   `json:"train_name"`
+	TrainType           string   `json:"train_type"`
+	OriginStationCode   string   `json:"origin_station_code"`
+	TerminusStationCode string   `json:"terminus_station_code"`
+	RunID               string   `json:"run_id"`   // the run this journey is part of
+	RunDate             string   `json:"run_date"` // date at origin, earlier than the journey date on overnight trains
+	Departure           string   `json:"departure"`
+	Arrival             string   `json:"arrival"`
+	DurationMin         int64    `json:"duration_min"`
+	DistanceKm          float64  `json:"distance_km"`
+	RunningDays         []string `json:"running_days"` // weekdays it departs `from`
+}
+
+// runningDaysFrom shifts a schedule's running days (Sun to Sat, bits 0 to 6, at the
+// origin) by the days it takes to reach a station
+func runningDaysFrom(bitmap, offsetDays int64) []string {
+	days := []string{}
+	for d := range int64(7) {
+		if bitmap&(1<<d) != 0 {
+			days = append(days, time.Weekday((d + offsetDays) % 7).String()[:3])
+		}
+	}
+	return days
+}
+
+// GET /v1/journeys?from=NDLS&to=CNB&date=YYYY-MM-DD
+// Trains departing `from` on date and calling at `to` later on the same run
+func (h *StationHandler) ListJourneys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	from := strings.ToUpper(r.URL.Query().Get("from"))
+	to := strings.ToUpper(r.URL.Query().Get("to"))
+	if from == "" || to == "" || from == to {
+		httpError(w, r, "from and to must be two different station codes", http.StatusBadRequest)
+		return
+	}
+
+	date, err := parseDateParam(r, "date", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	day, _ := time.ParseInLocation(time.DateOnly, date, h.loc)
+
+	rows, err := h.queries.ListSchedulesBetween(ctx, db.ListSchedulesBetweenParams{
+		FromCode: from,
+		ToCode:   to,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: schedules between %s-%s query failed: %v", from, to, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	journeys := make([]Journey, 0, len(rows))
+	for _, row := range rows {
+		depMin := row.OriginSchDepartureMin + row.FromDepartureMin
+		offsetDays := depMin / 1440
+
+		// the run left its origin offsetDays before the journey date, and only runs
+		// on the weekdays in its bitmap
+		runDate := day.AddDate(0, 0, -int(offsetDays))
+		if row.RunningDaysBitmap&(1<<int(runDate.Weekday())) == 0 {
+			continue
+		}
+
+		departure := runDate.Add(time.Duration(depMin) * time.Minute)
+		arrival := runDate.Add(time.Duration(row.OriginSchDepartureMin+row.ToArrivalMin) * time.Minute)
+
+		journeys = append(journeys, Journey{
+			TrainNo:             row.TrainNo,
+			TrainName:           row.TrainName,
+			TrainType:           row.TrainType,
+			OriginStationCode:   row.OriginStationCode,
+			TerminusStationCode: row.TerminusStationCode,
+			RunID:               fmt.Sprintf("%d_%s", row.TrainNo, runDate.Format(time.DateOnly)),
+			RunDate:             runDate.Format(time.DateOnly),
+			Departure:           departure.Format(time.RFC3339),
+			Arrival:             arrival.Format(time.RFC3339),
+			DurationMin:         row.ToArrivalMin - row.FromDepartureMin,
+			DistanceKm:          row.DistanceKm,
+			RunningDays:         runningDaysFrom(row.RunningDaysBitmap, offsetDays),
+		})
+	}
+
+	respond(w, r, h.logger, "journeys_"+from+"_"+to+"_"+date+".csv", map[string]any{
+		"from":     from,
+		"to":       to,
+		"date":     date,
+		"total":    len(journeys),
+		"journeys": journeys,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"from", "to", "train_no", "train_name", "train_type", "origin", "terminus", "run_id", "run_date",
+			"departure", "arrival", "duration_min", "distance_km", "running_days",
+		}}
+		for _, j := range journeys {
+			table.Rows = append(table.Rows, []string{
+				from,
+				to,
+				strconv.FormatInt(j.TrainNo, 10),
+				j.TrainName,
+				j.TrainType,
+				j.OriginStationCode,
+				j.TerminusStationCode,
+				j.RunID,
+				j.RunDate,
+				j.Departure,
+				j.Arrival,
+				strconv.FormatInt(j.DurationMin, 10),
+				strconv.FormatFloat(j.DistanceKm, 'f', -1, 64),
+				strings.Join(j.RunningDays, " "),
+			})
+		}
+		return table
+	})
+}
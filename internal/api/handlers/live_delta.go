@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// how far back a delta reaches, clients that were away longer take a fresh snapshot
+	maxLiveDeltaAge = 30 * time.Minute
+	// seconds /v1/live/wait holds a request by default and at most, below the usual
+	// 60 second idle timeout of proxies
+	liveWaitDefault = 25
+	liveWaitMax     = 55
+)
+
+// GET /v1/live/delta?since=
+// since is the timestamp of the client's last LiveTrainsResponse, from this endpoint or
+// /v1/trains/live. The response holds only the trains whose position or status changed
+// since then, removed_train_nos for trains that left the live set and terminal_run_ids
+// for runs that ended. Its timestamp is the since of the next call. Runs written again
+// after they ended, such as by the nightly quality scoring, can show up more than once.
+func (h *TrainHandler) GetLiveDelta(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseLiveSince(w, r)
+	if !ok {
+		return
+	}
+	h.serveLiveDelta(w, r, since)
+}
+
+// GET /v1/live/wait?since=&timeout=
+// Long-polling form of /v1/live/delta for clients behind proxies that block websockets
+// and event streams: the request is held until the poller finishes a cycle after since,
+// or for timeout seconds, and then answered with the delta since then.
+func (h *TrainHandler) WaitLiveDelta(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseLiveSince(w, r)
+	if !ok {
+		return
+	}
+	wait := time.Duration(queryInt(r, "timeout", liveWaitDefault, 1, liveWaitMax)) * time.Second
+
+	// the server write timeout is meant for requests answered straight away
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + liveWriteTimeout)); err != nil {
+		logf(h.logger, r, "handler: live wait cannot extend write deadline: %v", err)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	// since is whole seconds, a cycle in the same second may finish before the client's
+	// snapshot was taken
+	select {
+	case <-r.Context().Done():
+		return
+	case <-h.cycles.After(since.Add(time.Second)):
+	case <-timer.C:
+	}
+	h.serveLiveDelta(w, r, since)
+}
+
+// parseLiveSince reads the since of the delta endpoints, answering bad ones
+func parseLiveSince(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	raw := r.URL.Query().Get("since")
+	if raw == "" {
+		httpError(w, r, "since is required", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	since, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("invalid since %q, expected the timestamp of a previous response", raw), http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	if time.Since(since) > maxLiveDeltaAge {
+		httpError(w, r, "since is too old, fetch /v1/trains/live for a full snapshot", http.StatusGone)
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+func (h *TrainHandler) serveLiveDelta(w http.ResponseWriter, r *http.Request, since time.Time) {
+	ctx := r.Context()
+
+	// taken before reading, writes racing the queries are sent again next time
+	now := time.Now().UTC()
+	w.Header().Add("Vary", "Accept")
+
+	changes, err := h.queries.ListLiveChangesSince(ctx, since.UTC().Format(time.DateTime))
+	if err != nil {
+		logf(h.logger, r, "handler: live changes query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	var live []db.GetLiveTrainsRow
+	if len(changes) > 0 {
+		live, err = h.queries.GetLiveTrains(ctx)
+		if err != nil {
+			logf(h.logger, r, "handler: live trains query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := mapLiveTrains(liveDelta(live, changes))
+	isLive := make(map[int64]bool, len(live))
+	for _, t := range live {
+		isLive[t.TrainNo] = true
+	}
+	removed := map[int64]bool{}
+	for _, c := range changes {
+		if c.HasArrived == 1 {
+			resp.TerminalRunIds = append(resp.TerminalRunIds, c.RunID)
+		}
+		// runs written without ever getting a position were never on the map
+		if (c.HasArrived == 1 || c.WentStale == 1) && !isLive[c.TrainNo] && !removed[c.TrainNo] {
+			resp.RemovedTrainNos = append(resp.RemovedTrainNos, uint32(c.TrainNo))
+			removed[c.TrainNo] = true
+		}
+	}
+	resp.Timestamp = now.Format(time.RFC3339)
+
+	writeProto(w, r, h.logger, resp)
+}
+
+// liveDelta keeps the live trains that one of changes touched
+func liveDelta(live []db.GetLiveTrainsRow, changes []db.ListLiveChangesSinceRow) []db.GetLiveTrainsRow {
+	touched := make(map[int64]bool, len(changes))
+	for _, c := range changes {
+		touched[c.TrainNo] = true
+	}
+	var changed []db.GetLiveTrainsRow
+	for _, t := range live {
+		if touched[t.TrainNo] {
+			changed = append(changed, t)
+		}
+	}
+	return changed
+}
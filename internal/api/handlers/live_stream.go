@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	db "trano/internal/db/sqlc"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// how often the live set is re-read while anyone is subscribed, the poller writes
+	// each run about once a window so this only decides how soon an update goes out
+	liveStreamInterval = 5 * time.Second
+	liveWriteTimeout   = 10 * time.Second
+	// frames a subscriber may fall behind by before it is dropped
+	liveSubscriberBuffer = 16
+)
+
+// errLiveStreamEnded is returned to followers that fell behind or outlived the stream,
+// they get a fresh snapshot when they subscribe again
+var errLiveStreamEnded = errors.New("live stream ended")
+
+// LiveStream watches GetLiveTrains and fans changes out to websocket and gRPC
+// subscribers. It only queries while someone is subscribed.
+type LiveStream struct {
+	queries *db.Queries
+	logger  *log.Logger
+
+	mu      sync.Mutex
+	subs    map[*liveSubscriber]struct{}
+	last    map[int64]db.GetLiveTrainsRow // live set as of the last tick, nil before the first
+	running bool
+	closed  bool
+}
+
+type liveSubscriber struct {
+	box     *bbox
+	json    bool           // text frames of the JSON mapping instead of binary protobuf
+	visible map[int64]bool // trains this subscriber currently has on its map
+	frames  chan []byte
+	done    chan struct{}
+}
+
+// liveSubscription is what clients send to change their viewport, a null bbox
+// subscribes to every train
+type liveSubscription struct {
+	BBox *[4]float64 `json:"bbox"` // min_lat, min_lng, max_lat, max_lng
+}
+
+func NewLiveStream(queries *db.Queries, logger *log.Logger) *LiveStream {
+	return &LiveStream{
+		queries: queries,
+		logger:  logger,
+		subs:    map[*liveSubscriber]struct{}{},
+	}
+}
+
+// Close ends every subscription, hijacked connections are not closed by server shutdown
+func (ls *LiveStream) Close() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.closed = true
+	for sub := range ls.subs {
+		close(sub.done)
+		delete(ls.subs, sub)
+	}
+}
+
+// serve runs one websocket connection until either side goes away
+func (ls *LiveStream) serve(ws *websocket.Conn, box *bbox, asJSON bool) {
+	ws.PayloadType = websocket.BinaryFrame
+	if asJSON {
+		ws.PayloadType = websocket.TextFrame
+	}
+	// the server's read/write timeouts were set for a plain request, not a stream
+	_ = ws.SetDeadline(time.Time{})
+
+	sub := newLiveSubscriber(box, asJSON)
+	if !ls.subscribe(sub) {
+		return
+	}
+	defer ls.unsubscribe(sub)
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			var msg liveSubscription
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			var box *bbox
+			if msg.BBox != nil {
+				b, err := newBBox(*msg.BBox)
+				if err != nil {
+					continue
+				}
+				box = b
+			}
+			ls.setBox(sub, box)
+		}
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-sub.done:
+			return
+		case frame := <-sub.frames:
+			_ = ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := websocket.Message.Send(ws, frame); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// follow sends protobuf frames for box to send until ctx ends or the stream drops
+// the subscriber, errLiveStreamEnded in the latter case
+func (ls *LiveStream) follow(ctx context.Context, box *bbox, send func(frame []byte) error) error {
+	sub := newLiveSubscriber(box, false)
+	if !ls.subscribe(sub) {
+		return errLiveStreamEnded
+	}
+	defer ls.unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sub.done:
+			return errLiveStreamEnded
+		case frame := <-sub.frames:
+			if err := send(frame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func newLiveSubscriber(box *bbox, asJSON bool) *liveSubscriber {
+	return &liveSubscriber{
+		box:     box,
+		json:    asJSON,
+		visible: map[int64]bool{},
+		frames:  make(chan []byte, liveSubscriberBuffer),
+		done:    make(chan struct{}),
+	}
+}
+
+func (ls *LiveStream) subscribe(sub *liveSubscriber) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.closed {
+		return false
+	}
+	ls.subs[sub] = struct{}{}
+	// with a loop already running the snapshot comes from its last tick, otherwise
+	// the first tick sends everything
+	ls.resync(sub)
+	if !ls.running {
+		ls.running = true
+		go ls.loop()
+	}
+	return true
+}
+
+func (ls *LiveStream) unsubscribe(sub *liveSubscriber) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.subs[sub]; ok {
+		close(sub.done)
+		delete(ls.subs, sub)
+	}
+}
+
+func (ls *LiveStream) setBox(sub *liveSubscriber, box *bbox) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.subs[sub]; !ok {
+		return
+	}
+	sub.box = box
+	ls.resync(sub)
+}
+
+// resync sends what changed for sub between what it has and the last tick, the
+// caller holds ls.mu
+func (ls *LiveStream) resync(sub *liveSubscriber) {
+	if ls.last == nil {
+		return
+	}
+
+	var rows []db.GetLiveTrainsRow
+	var removed []uint32
+	for trainNo, row := range ls.last {
+		in := sub.box.containsU6(row.LatU6.Int64, row.LngU6.Int64)
+		switch {
+		case in && !sub.visible[trainNo]:
+			rows = append(rows, row)
+			sub.visible[trainNo] = true
+		case !in && sub.visible[trainNo]:
+			removed = append(removed, uint32(trainNo))
+			delete(sub.visible, trainNo)
+		}
+	}
+	for trainNo := range sub.visible {
+		if _, ok := ls.last[trainNo]; !ok {
+			removed = append(removed, uint32(trainNo))
+			delete(sub.visible, trainNo)
+		}
+	}
+	ls.send(sub, rows, removed)
+}
+
+func (ls *LiveStream) loop() {
+	ticker := time.NewTicker(liveStreamInterval)
+	defer ticker.Stop()
+
+	for {
+		ls.tick()
+
+		ls.mu.Lock()
+		if len(ls.subs) == 0 || ls.closed {
+			// the next subscriber starts from a fresh read
+			ls.running = false
+			ls.last = nil
+			ls.mu.Unlock()
+			return
+		}
+		ls.mu.Unlock()
+
+		<-ticker.C
+	}
+}
+
+func (ls *LiveStream) tick() {
+	ctx, cancel := context.WithTimeout(context.Background(), liveStreamInterval)
+	defer cancel()
+
+	rows, err := ls.queries.GetLiveTrains(ctx)
+	if err != nil {
+		ls.logger.Printf("handler: live stream query failed: %v", err)
+		return
+	}
+
+	cur := make(map[int64]db.GetLiveTrainsRow, len(rows))
+	for _, row := range rows {
+		cur[row.TrainNo] = row
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var changed []db.GetLiveTrainsRow
+	for trainNo, row := range cur {
+		if prev, ok := ls.last[trainNo]; !ok || !sameLiveTrain(prev, row) {
+			changed = append(changed, row)
+		}
+	}
+	var gone []int64
+	for trainNo := range ls.last {
+		if _, ok := cur[trainNo]; !ok {
+			gone = append(gone, trainNo)
+		}
+	}
+	ls.last = cur
+
+	for sub := range ls.subs {
+		var rows []db.GetLiveTrainsRow
+		var removed []uint32
+		for _, row := range changed {
+			if sub.box.containsU6(row.LatU6.Int64, row.LngU6.Int64) {
+				rows = append(rows, row)
+				sub.visible[row.TrainNo] = true
+			} else if sub.visible[row.TrainNo] {
+				// moved out of the viewport
+				removed = append(removed, uint32(row.TrainNo))
+				delete(sub.visible, row.TrainNo)
+			}
+		}
+		for _, trainNo := range gone {
+			if sub.visible[trainNo] {
+				removed = append(removed, uint32(trainNo))
+				delete(sub.visible, trainNo)
+			}
+		}
+		ls.send(sub, rows, removed)
+	}
+}
+
+// send queues a frame for sub and drops subscribers that fell too far behind, they
+// get a fresh snapshot when they reconnect. The caller holds ls.mu.
+func (ls *LiveStream) send(sub *liveSubscriber, rows []db.GetLiveTrainsRow, removed []uint32) {
+	if len(rows) == 0 && len(removed) == 0 {
+		return
+	}
+
+	frame := mapLiveTrains(rows)
+	frame.RemovedTrainNos = removed
+	marshal := proto.Marshal
+	if sub.json {
+		marshal = protoJSON.Marshal
+	}
+	data, err := marshal(frame)
+	if err != nil {
+		ls.logger.Printf("handler: failed to marshal live frame: %v", err)
+		return
+	}
+
+	select {
+	case sub.frames <- data:
+	default:
+		close(sub.done)
+		delete(ls.subs, sub)
+	}
+}
+
+// sameLiveTrain compares what a map marker shows
+func sameLiveTrain(a, b db.GetLiveTrainsRow) bool {
+	return a.LatU6 == b.LatU6 &&
+		a.LngU6 == b.LngU6 &&
+		a.BearingDeg == b.BearingDeg &&
+		a.CurrentDelayMin == b.CurrentDelayMin &&
+		a.SpeedKmh == b.SpeedKmh &&
+		a.Extrapolated == b.Extrapolated &&
+		statusString(a.CurrentStatus) == statusString(b.CurrentStatus) &&
+		a.LinkedTrainNos == b.LinkedTrainNos
+}
+
+// GET /v1/live/ws?min_lat=&min_lng=&max_lat=&max_lng=&format=
+// Binary frames are LiveTrainsResponse messages holding only trains that changed, the
+// first one everything in view, or text frames of their JSON mapping for format=json. Trains that stopped reporting or left the viewport
+// come back in removed_train_nos. Clients change their viewport by sending
+// {"bbox":[min_lat,min_lng,max_lat,max_lng]}, or {"bbox":null} for every train.
+func (h *TrainHandler) StreamLiveTrains(w http.ResponseWriter, r *http.Request) {
+	box, err := parseBBox(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	srv := websocket.Server{
+		// positions are public, any origin may subscribe
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			cfg.Origin, _ = websocket.Origin(cfg, r)
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			h.live.serve(ws, box, wantsProtoJSON(r))
+		},
+	}
+	srv.ServeHTTP(w, r)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/tiles"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// route shapes below this zoom are a tangle of lines across the country
+const routesMinZoom = 5
+
+// GET /v1/tiles/live/{z}/{x}/{y}.mvt?routes=true
+// Mapbox vector tile with a "trains" point layer, thinned at low zooms, and with
+// routes=true a "routes" layer of the live trains' routes through their stops
+func (h *TrainHandler) GetLiveTile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	z, errZ := strconv.ParseUint(chi.URLParam(r, "z"), 10, 32)
+	x, errX := strconv.ParseUint(chi.URLParam(r, "x"), 10, 32)
+	y, errY := strconv.ParseUint(chi.URLParam(r, "y"), 10, 32)
+	if errZ != nil || errX != nil || errY != nil {
+		httpError(w, r, "invalid tile coordinates", http.StatusBadRequest)
+		return
+	}
+	tile, err := tiles.New(uint32(z), uint32(x), uint32(y))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.liveNotModified(w, r, "mvt") {
+		return
+	}
+
+	trains, err := h.queries.GetLiveTrains(ctx)
+	if err != nil {
+		logf(h.logger, r, "handler: live trains query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	layers := []*tiles.Layer{liveTrainsLayer(tile, trains)}
+
+	if routes, _ := strconv.ParseBool(r.URL.Query().Get("routes")); routes && tile.Z >= routesMinZoom {
+		minLat, minLng, maxLat, maxLng := tile.Bounds()
+		stops, err := h.queries.ListLiveRouteShapes(ctx, db.ListLiveRouteShapesParams{
+			MinLat: minLat,
+			MaxLat: maxLat,
+			MinLng: minLng,
+			MaxLng: maxLng,
+		})
+		if err != nil {
+			logf(h.logger, r, "handler: live route shapes query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		layers = append(layers, liveRoutesLayer(tile, stops))
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	// positions move every poll window, a few seconds of caching only saves re-renders
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	w.WriteHeader(http.StatusOK)
+	w.Write(tiles.Encode(layers...))
+}
+
+func liveTrainsLayer(tile tiles.Tile, rows []db.GetLiveTrainsRow) *tiles.Layer {
+	// stable order so thinning keeps the same trains from one request to the next
+	sort.Slice(rows, func(i, j int) bool { return rows[i].TrainNo < rows[j].TrainNo })
+
+	spacing := tiles.PointSpacing(tile.Z)
+	taken := map[[2]int64]bool{}
+
+	layer := tiles.NewLayer("trains")
+	for _, row := range rows {
+		if !row.LatU6.Valid || !row.LngU6.Valid {
+			continue
+		}
+		px, py := tile.Project(float64(row.LatU6.Int64)/1e6, float64(row.LngU6.Int64)/1e6)
+		if !tile.Contains(px, py) {
+			continue
+		}
+		if spacing > 0 {
+			cell := [2]int64{floorDiv(px, spacing), floorDiv(py, spacing)}
+			if taken[cell] {
+				continue
+			}
+			taken[cell] = true
+		}
+
+		props := map[string]any{
+			"train_no": row.TrainNo,
+			"name":     row.TrainName,
+			"type":     row.TrainType,
+			"status":   statusString(row.CurrentStatus),
+		}
+		if row.BearingDeg.Valid {
+			props["bearing_deg"] = row.BearingDeg.Int64
+		}
+		if row.CurrentDelayMin.Valid {
+			props["delay_min"] = row.CurrentDelayMin.Int64
+		}
+		if row.SpeedKmh.Valid {
+			props["speed_kmh"] = row.SpeedKmh.Float64
+		}
+		if row.AvgSpeedKmh.Valid {
+			props["avg_speed_kmh"] = row.AvgSpeedKmh.Float64
+		}
+		if row.Extrapolated != 0 {
+			props["extrapolated"] = true
+		}
+		if row.LinkedTrainNos != "" {
+			props["linked_train_nos"] = strings.ReplaceAll(row.LinkedTrainNos, ",", " ")
+		}
+		layer.AddPoint(uint64(row.TrainNo), px, py, props)
+	}
+	return layer
+}
+
+// liveRoutesLayer draws one line per train through its stops, rows are ordered by
+// train and then along the route
+func liveRoutesLayer(tile tiles.Tile, rows []db.ListLiveRouteShapesRow) *tiles.Layer {
+	layer := tiles.NewLayer("routes")
+	for i := 0; i < len(rows); {
+		trainNo := rows[i].TrainNo
+		var pts [][2]int64
+		for ; i < len(rows) && rows[i].TrainNo == trainNo; i++ {
+			px, py := tile.Project(rows[i].Lat, rows[i].Lng)
+			pts = append(pts, [2]int64{px, py})
+		}
+		layer.AddLineString(uint64(trainNo), pts, map[string]any{"train_no": trainNo})
+	}
+	return layer
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
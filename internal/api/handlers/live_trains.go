@@ -4,51 +4,186 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	v1 "trano/internal/api/schema/v1"
 	db "trano/internal/db/sqlc"
-
-	"google.golang.org/protobuf/proto"
+	"trano/internal/poller"
 )
 
 type TrainHandler struct {
 	queries *db.Queries
 	db      *sql.DB
 	logger  *log.Logger
+	live    *LiveStream
+	cycles  *poller.Cycles
 }
 
-func NewTrainHandler(queries *db.Queries, dbConn *sql.DB, logger *log.Logger) *TrainHandler {
+func NewTrainHandler(queries *db.Queries, dbConn *sql.DB, cycles *poller.Cycles, logger *log.Logger) *TrainHandler {
 	return &TrainHandler{
 		queries: queries,
 		db:      dbConn,
 		logger:  logger,
+		live:    NewLiveStream(queries, logger),
+		cycles:  cycles,
+	}
+}
+
+// Close ends open live streams
+func (h *TrainHandler) Close() {
+	h.live.Close()
+}
+
+// liveNotModified answers 304 when the live set has not changed since the client's
+// copy, variant tells apart representations of the same URL. A failed version check
+// just serves the full response.
+func (h *TrainHandler) liveNotModified(w http.ResponseWriter, r *http.Request, variant string) bool {
+	v, err := h.queries.GetLiveVersion(r.Context())
+	if err != nil {
+		logf(h.logger, r, "handler: live version query failed: %v", err)
+		return false
 	}
+	return notModified(w, r, v.MaxUpdatedAt, v.LiveRuns, v.PositionSum, variant)
 }
 
+// GET /v1/trains/live?min_lat=&min_lng=&max_lat=&max_lng=&zoom=&cluster=&type=&zone=&status=&limit=
+// Protobuf LiveTrainsResponse, its JSON mapping for format=json / Accept:
+// application/json, or a GeoJSON FeatureCollection of points for format=geojson /
+// Accept: application/geo+json. Answers If-None-Match with 304 while
+// the live set is unchanged. Zoomed out viewports (or cluster=true) get grid clusters
+// in place of the trains they hold. type, zone and status take comma separated values,
+// limit caps the trains returned in train number order while total counts all matches.
 func (h *TrainHandler) GetLiveTrains(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	trains, err := h.queries.GetLiveTrains(ctx)
+	box, err := parseBBox(r)
 	if err != nil {
-		h.logger.Printf("handler: live trains query failed: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
+	cluster, cellDeg := clusterParams(r, box)
+	filter := parseLiveFilter(r)
 
-	resp := mapLiveTrains(trains)
+	// the encoding follows Accept, caches have to key on it
+	w.Header().Add("Vary", "Accept")
+	variant := "protobuf"
+	switch {
+	case wantsGeoJSON(r):
+		variant = "geojson"
+	case wantsProtoJSON(r):
+		variant = "json"
+	}
+	if h.liveNotModified(w, r, variant) {
+		return
+	}
 
-	// Marshal to binary using protobuf
-	data, err := proto.Marshal(resp)
+	// the timestamp is the since of a later /v1/live/delta, so it is taken before reading
+	now := time.Now().UTC()
+	trains, err := h.queries.GetLiveTrains(ctx)
 	if err != nil {
-		h.logger.Printf("handler: failed to marshal protobuf: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		logf(h.logger, r, "handler: live trains query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	trains = filter.apply(liveTrainsInView(trains, box))
+
+	var resp *v1.LiveTrainsResponse
+	switch {
+	case cluster:
+		single, clusters := clusterLiveTrains(trains, cellDeg)
+		if wantsGeoJSON(r) {
+			writeGeoJSON(w, h.logger, clusteredLiveTrainsGeoJSON(single, clusters))
+			return
+		}
+		resp = clusteredLiveTrains(single, clusters, len(trains))
+	case wantsGeoJSON(r):
+		writeGeoJSON(w, h.logger, liveTrainsGeoJSON(filter.cut(trains)))
+		return
+	default:
+		resp = mapLiveTrains(filter.cut(trains))
+		resp.Total = uint32(len(trains))
+	}
+	resp.Timestamp = now.Format(time.RFC3339)
+
+	writeProto(w, r, h.logger, resp)
+}
+
+// liveTrainsInView keeps the trains with a position inside box, all of them for a nil box
+func liveTrainsInView(trains []db.GetLiveTrainsRow, box *bbox) []db.GetLiveTrainsRow {
+	if box == nil {
+		return trains
+	}
+	inView := trains[:0]
+	for _, t := range trains {
+		if t.LatU6.Valid && t.LngU6.Valid && box.containsU6(t.LatU6.Int64, t.LngU6.Int64) {
+			inView = append(inView, t)
+		}
+	}
+	return inView
+}
+
+// maxLiveLimit bounds limit, the whole country is a few thousand trains at most
+const maxLiveLimit = 10000
+
+// liveFilter narrows the live set beyond the viewport, empty lists match every train
+type liveFilter struct {
+	types    []string // upper case
+	zones    []string // upper case
+	statuses []string // lower case
+	limit    int      // 0 for no limit, clusters are never limited
+}
+
+func parseLiveFilter(r *http.Request) liveFilter {
+	q := r.URL.Query()
+	return liveFilter{
+		types:    splitQueryList(q.Get("type"), strings.ToUpper),
+		zones:    splitQueryList(q.Get("zone"), strings.ToUpper),
+		statuses: splitQueryList(q.Get("status"), strings.ToLower),
+		limit:    queryInt(r, "limit", 0, 1, maxLiveLimit),
+	}
+}
+
+// splitQueryList reads a comma separated query value, normalised by norm
+func splitQueryList(raw string, norm func(string) string) []string {
+	var values []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, norm(part))
+		}
+	}
+	return values
+}
+
+// apply keeps the trains matching every given list, in place
+func (f liveFilter) apply(trains []db.GetLiveTrainsRow) []db.GetLiveTrainsRow {
+	if len(f.types) == 0 && len(f.zones) == 0 && len(f.statuses) == 0 {
+		return trains
+	}
+	kept := trains[:0]
+	for _, t := range trains {
+		if len(f.types) > 0 && !slices.Contains(f.types, strings.ToUpper(t.TrainType)) {
+			continue
+		}
+		if len(f.zones) > 0 && !slices.Contains(f.zones, strings.ToUpper(t.Zone.String)) {
+			continue
+		}
+		if len(f.statuses) > 0 && !slices.Contains(f.statuses, strings.ToLower(statusString(t.CurrentStatus))) {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
 
-	w.Header().Set("Content-Type", "application/x-protobuf")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+// cut applies the limit, the rows come in a stable order so the same trains are kept
+func (f liveFilter) cut(trains []db.GetLiveTrainsRow) []db.GetLiveTrainsRow {
+	if f.limit > 0 && len(trains) > f.limit {
+		return trains[:f.limit]
+	}
+	return trains
 }
 
 func mapLiveTrains(
@@ -112,6 +247,20 @@ func mapLiveTrains(
 		if r.BearingDeg.Valid {
 			train.BearingDeg = uint32(r.BearingDeg.Int64)
 		}
+		if r.CurrentDelayMin.Valid {
+			delay := int32(r.CurrentDelayMin.Int64)
+			train.DelayMin = &delay
+		}
+		if r.SpeedKmh.Valid {
+			speed := float32(r.SpeedKmh.Float64)
+			train.SpeedKmh = &speed
+		}
+		if r.AvgSpeedKmh.Valid {
+			avg := float32(r.AvgSpeedKmh.Float64)
+			train.AvgSpeedKmh = &avg
+		}
+		train.Extrapolated = r.Extrapolated != 0
+		train.LinkedTrainNos = parseTrainNos(r.LinkedTrainNos)
 
 		trains = append(trains, train)
 	}
@@ -124,3 +273,43 @@ func mapLiveTrains(
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 }
+
+// parseTrainNos reads the comma separated list group_concat produces
+func parseTrainNos(s string) []uint32 {
+	if s == "" {
+		return nil
+	}
+	var nos []uint32
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			continue
+		}
+		nos = append(nos, uint32(n))
+	}
+	return nos
+}
+
+// liveTrainsGeoJSON maps each train with a position to a point feature
+func liveTrainsGeoJSON(rows []db.GetLiveTrainsRow) *geoFeatureCollection {
+	fc := newFeatureCollection(len(rows))
+	for _, r := range rows {
+		if !r.LatU6.Valid || !r.LngU6.Valid {
+			continue
+		}
+		fc.addPoint(float64(r.LatU6.Int64)/1e6, float64(r.LngU6.Int64)/1e6, map[string]any{
+			"train_no":         r.TrainNo,
+			"name":             r.TrainName,
+			"type":             r.TrainType,
+			"status":           statusString(r.CurrentStatus),
+			"bearing_deg":      nullInt(r.BearingDeg),
+			"delay_min":        nullInt(r.CurrentDelayMin),
+			"speed_kmh":        nullFloat(r.SpeedKmh),
+			"avg_speed_kmh":    nullFloat(r.AvgSpeedKmh),
+			"extrapolated":     r.Extrapolated != 0,
+			"linked_train_nos": parseTrainNos(r.LinkedTrainNos),
+			"last_update":      nullString(r.LastUpdateTimestampIso),
+		})
+	}
+	return fc
+}
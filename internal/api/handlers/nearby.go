@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+type NearbyTrain struct {
+	RunID        string   `json:"run_id"`
+	TrainNo      int64    `json:"train_no"`
+	TrainName    string   `json:"train_name"`
+	TrainType    string   `json:"train_type"`
+	Lat          float64  `json:"lat"`
+	Lng          float64  `json:"lng"`
+	DistanceKm   float64  `json:"distance_km"`   // from the point asked about
+	DirectionDeg int64    `json:"direction_deg"` // from the point asked about to the train
+	BearingDeg   *int64   `json:"bearing_deg"`   // heading of the train along its route
+	RouteKm      *float64 `json:"route_km"`      // from its origin
+	Status       string   `json:"status"`
+	DelayMin     *int64   `json:"delay_min"` // late at the current station, negative when early
+	LastUpdate   *string  `json:"last_update"`
+}
+
+// GET /v1/trains/nearby?lat=&lng=&radius_km=10&limit=50
+// Live trains around a point by geodesic distance from their snapped position, nearest first
+func (h *TrainHandler) ListNearbyTrains(w http.ResponseWriter, r *http.Request) {
+	lat, lng, radiusKm, err := parseRadius(r, 10, 100)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := queryInt(r, "limit", 50, 1, 200)
+
+	box := radiusBox(lat, lng, radiusKm)
+	rows, err := h.queries.ListNearbyTrains(r.Context(), db.ListNearbyTrainsParams{
+		Lat:      lat,
+		Lng:      lng,
+		MinLatU6: int64(math.Floor(box.MinLat * 1e6)),
+		MaxLatU6: int64(math.Ceil(box.MaxLat * 1e6)),
+		MinLngU6: int64(math.Floor(box.MinLng * 1e6)),
+		MaxLngU6: int64(math.Ceil(box.MaxLng * 1e6)),
+		RadiusM:  radiusKm * 1000,
+		Limit:    int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: nearby trains query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	trains := make([]NearbyTrain, 0, len(rows))
+	for _, row := range rows {
+		t := NearbyTrain{
+			RunID:      row.RunID,
+			TrainNo:    row.TrainNo,
+			TrainName:  row.TrainName,
+			TrainType:  row.TrainType,
+			Lat:        float64(row.LatU6.Int64) / 1e6,
+			Lng:        float64(row.LngU6.Int64) / 1e6,
+			DistanceKm: math.Round(row.DistanceM) / 1000,
+			BearingDeg: nullInt(row.BearingDeg),
+			Status:     row.CurrentStatus,
+			DelayMin:   nullInt(row.CurrentDelayMin),
+			LastUpdate: nullString(row.LastUpdateTimestampIso),
+		}
+		t.DirectionDeg = bearingDeg(lat, lng, t.Lat, t.Lng)
+		if row.DistanceKmU4.Valid {
+			km := float64(row.DistanceKmU4.Int64) / 1e4
+			t.RouteKm = &km
+		}
+		trains = append(trains, t)
+	}
+
+	if wantsGeoJSON(r) {
+		fc := newFeatureCollection(len(trains))
+		for _, t := range trains {
+			fc.addPoint(t.Lat, t.Lng, map[string]any{
+				"run_id":        t.RunID,
+				"train_no":      t.TrainNo,
+				"name":          t.TrainName,
+				"type":          t.TrainType,
+				"distance_km":   t.DistanceKm,
+				"direction_deg": t.DirectionDeg,
+				"bearing_deg":   t.BearingDeg,
+				"status":        t.Status,
+				"delay_min":     t.DelayMin,
+				"last_update":   t.LastUpdate,
+			})
+		}
+		writeGeoJSON(w, h.logger, fc)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"lat":       lat,
+		"lng":       lng,
+		"radius_km": radiusKm,
+		"total":     len(trains),
+		"trains":    trains,
+	})
+}
+
+type NearbyStation struct {
+	StationCode     string  `json:"station_code"`
+	StationName     string  `json:"station_name"`
+	Zone            *string `json:"zone"`
+	Division        *string `json:"division"`
+	Lat             float64 `json:"lat"`
+	Lng             float64 `json:"lng"`
+	DistanceKm      float64 `json:"distance_km"`
+	DirectionDeg    int64   `json:"direction_deg"` // from the point asked about to the station
+	Platforms       *int64  `json:"platforms"`
+	StationType     *string `json:"station_type"`
+	StationCategory *string `json:"station_category"`
+}
+
+// GET /v1/stations/nearby?lat=&lng=&radius_km=10&limit=20
+// Stations around a point by geodesic distance, nearest first. Stations without
+// coordinates are never found.
+func (h *StationHandler) ListNearbyStations(w http.ResponseWriter, r *http.Request) {
+	lat, lng, radiusKm, err := parseRadius(r, 10, 100)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := queryInt(r, "limit", 20, 1, 200)
+
+	box := radiusBox(lat, lng, radiusKm)
+	rows, err := h.queries.ListNearbyStations(r.Context(), db.ListNearbyStationsParams{
+		Lat:     lat,
+		Lng:     lng,
+		MinLat:  box.MinLat,
+		MinLng:  box.MinLng,
+		MaxLat:  box.MaxLat,
+		MaxLng:  box.MaxLng,
+		RadiusM: radiusKm * 1000,
+		Limit:   int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: nearby stations query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	stations := make([]NearbyStation, 0, len(rows))
+	for _, row := range rows {
+		s := NearbyStation{
+			StationCode:     row.StationCode,
+			StationName:     row.StationName,
+			Zone:            nullString(row.Zone),
+			Division:        nullString(row.Division),
+			Lat:             row.Lat.Float64,
+			Lng:             row.Lng.Float64,
+			DistanceKm:      math.Round(row.DistanceM) / 1000,
+			Platforms:       nullInt(row.NumberOfPlatforms),
+			StationType:     nullString(row.StationType),
+			StationCategory: nullString(row.StationCategory),
+		}
+		s.DirectionDeg = bearingDeg(lat, lng, s.Lat, s.Lng)
+		stations = append(stations, s)
+	}
+
+	if wantsGeoJSON(r) {
+		fc := newFeatureCollection(len(stations))
+		for _, s := range stations {
+			fc.addPoint(s.Lat, s.Lng, map[string]any{
+				"station_code":     s.StationCode,
+				"name":             s.StationName,
+				"distance_km":      s.DistanceKm,
+				"direction_deg":    s.DirectionDeg,
+				"platforms":        s.Platforms,
+				"station_type":     s.StationType,
+				"station_category": s.StationCategory,
+			})
+		}
+		writeGeoJSON(w, h.logger, fc)
+		return
+	}
+
+	respond(w, r, h.logger, "stations_nearby.csv", map[string]any{
+		"lat":       lat,
+		"lng":       lng,
+		"radius_km": radiusKm,
+		"total":     len(stations),
+		"stations":  stations,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "station_name", "zone", "division", "lat", "lng", "distance_km", "direction_deg",
+			"platforms", "station_type", "station_category",
+		}}
+		for _, s := range stations {
+			table.Rows = append(table.Rows, []string{
+				s.StationCode,
+				s.StationName,
+				csvString(s.Zone),
+				csvString(s.Division),
+				strconv.FormatFloat(s.Lat, 'f', -1, 64),
+				strconv.FormatFloat(s.Lng, 'f', -1, 64),
+				strconv.FormatFloat(s.DistanceKm, 'f', -1, 64),
+				strconv.FormatInt(s.DirectionDeg, 10),
+				csvInt(s.Platforms),
+				csvString(s.StationType),
+				csvString(s.StationCategory),
+			})
+		}
+		return table
+	})
+}
+
+const (
+	// stations whose boards are looked at, nearest first
+	departuresMaxStations = 10
+	departuresMaxWithin   = 3 * time.Hour
+)
+
+type NearbyDeparture struct {
+	StationCode       string  `json:"station_code"`
+	StationName       string  `json:"station_name"`
+	StationDistanceKm float64 `json:"station_distance_km"` // from the point asked about
+	LiveBoardEntry
+}
+
+// GET /v1/departures/nearby?lat=&lng=&radius_km=3&within=45m&limit=50
+// Trains leaving the stations around a point within the next while, by expected
+// departure: the live boards of the nearest stations merged. Trains ending their run
+// at a station are left out, there is nothing to catch.
+func (h *StationHandler) ListNearbyDepartures(w http.ResponseWriter, r *http.Request) {
+	lat, lng, radiusKm, err := parseRadius(r, 3, 20)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	within := 45 * time.Minute
+	if raw := r.URL.Query().Get("within"); raw != "" {
+		within, err = time.ParseDuration(raw)
+		if err != nil || within <= 0 {
+			httpError(w, r, "invalid within, expected a duration such as 45m or 2h", http.StatusBadRequest)
+			return
+		}
+		within = min(within, departuresMaxWithin)
+	}
+	limit := queryInt(r, "limit", 50, 1, 200)
+
+	box := radiusBox(lat, lng, radiusKm)
+	stations, err := h.queries.ListNearbyStations(r.Context(), db.ListNearbyStationsParams{
+		Lat:     lat,
+		Lng:     lng,
+		MinLat:  box.MinLat,
+		MinLng:  box.MinLng,
+		MaxLat:  box.MaxLat,
+		MaxLng:  box.MaxLng,
+		RadiusM: radiusKm * 1000,
+		Limit:   departuresMaxStations,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: nearby stations query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(h.loc)
+	until := now.Add(within)
+	departures := []NearbyDeparture{}
+	for _, st := range stations {
+		rows, err := h.queries.GetStationLiveBoard(r.Context(), db.GetStationLiveBoardParams{
+			StationCode: st.StationCode,
+			FromTime:    now.Add(-boardLookback).Format(time.DateTime),
+			ToTime:      until.Format(time.DateTime),
+		})
+		if err != nil {
+			logf(h.logger, r, "handler: live board query failed for %s: %v", st.StationCode, err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, e := range h.liveBoardEntries(rows, st.StationCode, now, until) {
+			if e.Kind == "arrival" {
+				continue
+			}
+			// due within the window by its arrival, but leaving after it
+			if dep, err := time.Parse(time.RFC3339, e.ExpDeparture); err != nil || dep.After(until) {
+				continue
+			}
+			departures = append(departures, NearbyDeparture{
+				StationCode:       st.StationCode,
+				StationName:       st.StationName,
+				StationDistanceKm: math.Round(st.DistanceM) / 1000,
+				LiveBoardEntry:    e,
+			})
+		}
+	}
+
+	// all in h.loc, so RFC3339 sorts as text
+	sort.SliceStable(departures, func(i, j int) bool {
+		return departures[i].ExpDeparture < departures[j].ExpDeparture
+	})
+	departures = departures[:min(len(departures), limit)]
+
+	respond(w, r, h.logger, "departures_nearby.csv", map[string]any{
+		"lat":        lat,
+		"lng":        lng,
+		"radius_km":  radiusKm,
+		"from":       now.Format(time.RFC3339),
+		"until":      until.Format(time.RFC3339),
+		"total":      len(departures),
+		"departures": departures,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "station_name", "station_distance_km", "run_id", "train_no", "train_name", "train_type",
+			"origin", "terminus", "kind", "sch_departure", "exp_departure", "delay_min", "status",
+		}}
+		for _, d := range departures {
+			table.Rows = append(table.Rows, []string{
+				d.StationCode,
+				d.StationName,
+				strconv.FormatFloat(d.StationDistanceKm, 'f', -1, 64),
+				d.RunID,
+				strconv.FormatInt(d.TrainNo, 10),
+				d.TrainName,
+				d.TrainType,
+				d.OriginStationCode,
+				d.TerminusStationCode,
+				d.Kind,
+				d.SchDeparture,
+				d.ExpDeparture,
+				csvInt(d.DelayMin),
+				d.Status,
+			})
+		}
+		return table
+	})
+}
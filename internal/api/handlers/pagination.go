@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// page is a limit plus an opaque cursor. The cursor carries the sort key of the last
+// item of the previous page, so pages stay consistent while rows are being added.
+type page struct {
+	Limit int
+	After []string // nil on the first page
+}
+
+// parsePage reads limit and cursor. CSV exports without a limit get up to hi rows in
+// one go, they have nowhere to put a cursor but the X-Next-Cursor header.
+func parsePage(r *http.Request, def, hi, keyLen int) (page, error) {
+	p := page{Limit: queryInt(r, "limit", def, 1, hi)}
+	if wantsCSV(r) && !r.URL.Query().Has("limit") {
+		p.Limit = hi
+	}
+
+	raw := r.URL.Query().Get("cursor")
+	if raw == "" {
+		return p, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err == nil {
+		err = json.Unmarshal(b, &p.After)
+	}
+	if err != nil || len(p.After) != keyLen {
+		return page{}, fmt.Errorf("invalid cursor")
+	}
+	return p, nil
+}
+
+// afterInt is key part i of the cursor as an integer, 0 on the first page
+func (p page) afterInt(i int) int64 {
+	if p.After == nil {
+		return 0
+	}
+	v, _ := strconv.ParseInt(p.After[i], 10, 64)
+	return v
+}
+
+// afterString is key part i of the cursor, empty on the first page
+func (p page) afterString(i int) string {
+	if p.After == nil {
+		return ""
+	}
+	return p.After[i]
+}
+
+// fetch is how many rows to ask for, one past the page tells whether another follows
+func (p page) fetch() int64 {
+	return int64(p.Limit) + 1
+}
+
+// pageOf trims rows fetched with p.fetch() to the page and returns the cursor of the
+// next page, nil on the last one. The cursor also goes out as X-Next-Cursor.
+func pageOf[T any](w http.ResponseWriter, rows []T, p page, key func(T) []string) ([]T, *string) {
+	if len(rows) <= p.Limit {
+		return rows, nil
+	}
+	rows = rows[:p.Limit]
+
+	b, _ := json.Marshal(key(rows[len(rows)-1]))
+	next := base64.RawURLEncoding.EncodeToString(b)
+	w.Header().Set("X-Next-Cursor", next)
+	return rows, &next
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// runs one device can follow at a time, subscriptions go two days after their run
+	maxDeviceSubscriptions = 20
+	maxDeviceTokenLen      = 4096
+)
+
+type DeviceSubscription struct {
+	Token   string `json:"token"` // FCM registration token
+	TrainNo int64  `json:"train_no"`
+	Date    string `json:"date"` // run date, YYYY-MM-DD
+}
+
+// readDeviceSubscription reads and checks the body of both push endpoints, normalising the date
+func (h *RunHandler) readDeviceSubscription(w http.ResponseWriter, r *http.Request) (DeviceSubscription, bool) {
+	var sub DeviceSubscription
+	if err := readJSON(w, r, &sub); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return sub, false
+	}
+	sub.Token = strings.TrimSpace(sub.Token)
+	if sub.Token == "" || len(sub.Token) > maxDeviceTokenLen {
+		httpError(w, r, "token is required", http.StatusBadRequest)
+		return sub, false
+	}
+	if sub.TrainNo <= 0 {
+		httpError(w, r, "invalid train_no", http.StatusBadRequest)
+		return sub, false
+	}
+	date, err := time.ParseInLocation(time.DateOnly, sub.Date, h.loc)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", sub.Date), http.StatusBadRequest)
+		return sub, false
+	}
+	sub.Date = date.Format(time.DateOnly)
+	return sub, true
+}
+
+// POST /v1/push/subscriptions {"token": "...", "train_no": 12951, "date": "2026-10-16"}
+// The device gets a push whenever the run's status changes or its delay moves materially.
+func (h *RunHandler) SubscribePush(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.readDeviceSubscription(w, r)
+	if !ok {
+		return
+	}
+	yesterday := time.Now().In(h.loc).AddDate(0, 0, -1).Format(time.DateOnly)
+	if sub.Date < yesterday {
+		httpError(w, r, "date is in the past", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.queries.GetTrain(r.Context(), sub.TrainNo); errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "train not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logf(h.logger, r, "handler: train %d query failed: %v", sub.TrainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	count, err := h.queries.CountDeviceSubscriptions(r.Context(), sub.Token)
+	if err != nil {
+		logf(h.logger, r, "handler: device subscriptions query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxDeviceSubscriptions {
+		httpError(w, r, fmt.Sprintf("a device can follow at most %d runs", maxDeviceSubscriptions), http.StatusConflict)
+		return
+	}
+
+	if err := h.queries.AddDeviceSubscription(r.Context(), db.AddDeviceSubscriptionParams{
+		Token:   sub.Token,
+		TrainNo: sub.TrainNo,
+		RunDate: sub.Date,
+	}); err != nil {
+		logf(h.logger, r, "handler: add device subscription failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, h.logger, http.StatusCreated, sub)
+}
+
+// DELETE /v1/push/subscriptions {"token": "...", "train_no": 12951, "date": "2026-10-16"}
+func (h *RunHandler) UnsubscribePush(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.readDeviceSubscription(w, r)
+	if !ok {
+		return
+	}
+	n, err := h.queries.DeleteDeviceSubscription(r.Context(), db.DeleteDeviceSubscriptionParams{
+		Token:   sub.Token,
+		TrainNo: sub.TrainNo,
+		RunDate: sub.Date,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: delete device subscription failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpError(w, r, "subscription not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// Indian Railways counts an arrival within 15 minutes as on time
+	defaultOnTimeThresholdMin = 15
+
+	metricOnTime   = "on_time"
+	metricAvgDelay = "avg_delay"
+
+	// ranges at least this long read whole months from the monthly rollups
+	rollupMinDays = 60
+)
+
+var periodRe = regexp.MustCompile(`^(\d{1,3})d$`)
+
+// parsePeriod turns "30d" into the first run date included in the period
+func parsePeriod(r *http.Request, def string, loc *time.Location) (string, string, error) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = def
+	}
+	m := periodRe.FindStringSubmatch(period)
+	if m == nil {
+		return "", "", fmt.Errorf("invalid period %q, expected e.g. 30d", period)
+	}
+	days, _ := strconv.Atoi(m[1])
+	if days < 1 || days > 366 {
+		return "", "", fmt.Errorf("period must be between 1d and 366d")
+	}
+	return period, time.Now().In(loc).AddDate(0, 0, -days).Format(time.DateOnly), nil
+}
+
+// rollupBoundary returns the first of the month after sinceDate when the range is long
+// enough for the monthly rollups to pay off, whole months from there on are read from
+// the rollups and the days before from the daily summaries. Empty for short ranges.
+func rollupBoundary(sinceDate string, loc *time.Location) string {
+	since, err := time.ParseInLocation(time.DateOnly, sinceDate, loc)
+	if err != nil || time.Since(since) < rollupMinDays*24*time.Hour {
+		return ""
+	}
+	if since.Day() == 1 {
+		return sinceDate
+	}
+	return time.Date(since.Year(), since.Month()+1, 1, 0, 0, 0, 0, loc).Format(time.DateOnly)
+}
+
+type LeaderboardEntry struct {
+	TrainNo             int64   `json:"train_no"`
+	TrainName           string  `json:"train_name"`
+	TrainType           string  `json:"train_type"`
+	Runs                int64   `json:"runs"`
+	OnTimeRuns          int64   `json:"on_time_runs"`
+	OnTimePct           float64 `json:"on_time_pct"`
+	AvgTerminalDelayMin float64 `json:"avg_terminal_delay_min"`
+}
+
+// GET /v1/reports/leaderboard?metric=on_time&period=30d&limit=10&min_runs=3&min_quality=60
+func (h *AnalyticsHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = metricOnTime
+	}
+	if metric != metricOnTime && metric != metricAvgDelay {
+		httpError(w, r, "invalid metric, expected on_time or avg_delay", http.StatusBadRequest)
+		return
+	}
+
+	period, sinceDate, err := parsePeriod(r, "30d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := queryInt(r, "limit", 10, 1, 100)
+	minRuns := queryInt(r, "min_runs", 3, 1, 1000)
+	threshold := queryInt(r, "threshold_min", defaultOnTimeThresholdMin, 0, 600)
+
+	rows, err := h.queries.ListTrainPunctuality(ctx, db.ListTrainPunctualityParams{
+		OnTimeThresholdMin: sql.NullInt64{Int64: int64(threshold), Valid: true},
+		SinceDate:          sinceDate,
+		MinQuality:         queryInt(r, "min_quality", 0, 0, 100),
+		MinRuns:            int64(minRuns),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: punctuality query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, LeaderboardEntry{
+			TrainNo:             row.TrainNo,
+			TrainName:           row.TrainName,
+			TrainType:           row.TrainType,
+			Runs:                row.Runs,
+			OnTimeRuns:          row.OnTimeRuns,
+			OnTimePct:           100 * float64(row.OnTimeRuns) / float64(row.Runs),
+			AvgTerminalDelayMin: row.AvgTerminalDelayMin,
+		})
+	}
+
+	// best first; ties broken by the other metric, then train number for stable output
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if metric == metricOnTime && a.OnTimePct != b.OnTimePct {
+			return a.OnTimePct > b.OnTimePct
+		}
+		if a.AvgTerminalDelayMin != b.AvgTerminalDelayMin {
+			return a.AvgTerminalDelayMin < b.AvgTerminalDelayMin
+		}
+		if a.OnTimePct != b.OnTimePct {
+			return a.OnTimePct > b.OnTimePct
+		}
+		return a.TrainNo < b.TrainNo
+	})
+
+	n := min(limit, len(entries))
+	best := entries[:n]
+	worst := make([]LeaderboardEntry, 0, n)
+	for i := len(entries) - 1; i >= len(entries)-n; i-- {
+		worst = append(worst, entries[i])
+	}
+
+	respond(w, r, h.logger, "leaderboard_"+metric+"_"+period+".csv", map[string]any{
+		"metric":        metric,
+		"period":        period,
+		"since":         sinceDate,
+		"threshold_min": threshold,
+		"trains_ranked": len(entries),
+		"best":          best,
+		"worst":         worst,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"rank_side", "rank", "train_no", "train_name", "train_type", "runs", "on_time_runs", "on_time_pct", "avg_terminal_delay_min",
+		}}
+		add := func(side string, list []LeaderboardEntry) {
+			for i, e := range list {
+				table.Rows = append(table.Rows, []string{
+					side,
+					strconv.Itoa(i + 1),
+					strconv.FormatInt(e.TrainNo, 10),
+					e.TrainName,
+					e.TrainType,
+					strconv.FormatInt(e.Runs, 10),
+					strconv.FormatInt(e.OnTimeRuns, 10),
+					csvFloat(&e.OnTimePct),
+					csvFloat(&e.AvgTerminalDelayMin),
+				})
+			}
+		}
+		add("best", best)
+		add("worst", worst)
+		return table
+	})
+}
+
+type HeatmapBucket struct {
+	Lat             float64 `json:"lat"`
+	Lng             float64 `json:"lng"`
+	StationCode     string  `json:"station_code,omitempty"`
+	StationName     string  `json:"station_name,omitempty"`
+	Stations        int     `json:"stations"`
+	Samples         int64   `json:"samples"`
+	AvgDelayMin     float64 `json:"avg_delay_min"`
+	MaxDelayMin     int64   `json:"max_delay_min"`
+	AvgDelayGainMin float64 `json:"avg_delay_gain_min"`
+}
+
+// GET /v1/reports/delay-heatmap?from=YYYY-MM-DD&to=YYYY-MM-DD&resolution=station|<degrees>
+func (h *AnalyticsHandler) GetDelayHeatmap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	toDate, err := parseDateParam(r, "to", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, _ := time.ParseInLocation(time.DateOnly, toDate, h.loc)
+	fromDate := to.AddDate(0, 0, -6).Format(time.DateOnly)
+	if r.URL.Query().Get("from") != "" {
+		if fromDate, err = parseDateParam(r, "from", h.loc); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	from, _ := time.ParseInLocation(time.DateOnly, fromDate, h.loc)
+	if from.After(to) || to.Sub(from) > 92*24*time.Hour {
+		httpError(w, r, "from must be before to and the range at most 92 days", http.StatusBadRequest)
+		return
+	}
+
+	// resolution is either per-station or a grid cell size in degrees
+	resolution := r.URL.Query().Get("resolution")
+	gridDeg := 0.0
+	if resolution == "" {
+		resolution = "station"
+	}
+	if resolution != "station" {
+		gridDeg, err = strconv.ParseFloat(resolution, 64)
+		if err != nil || gridDeg < 0.05 || gridDeg > 5 {
+			httpError(w, r, "invalid resolution, expected station or a grid size in degrees (0.05-5)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := h.queries.ListStationDelayBuckets(ctx, db.ListStationDelayBucketsParams{
+		FromDate: fromDate,
+		ToDate:   toDate,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: delay heatmap query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	buckets := bucketDelays(rows, gridDeg)
+
+	respond(w, r, h.logger, "delay_heatmap_"+fromDate+"_"+toDate+".csv", map[string]any{
+		"from":       fromDate,
+		"to":         toDate,
+		"resolution": resolution,
+		"total":      len(buckets),
+		"buckets":    buckets,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"lat", "lng", "station_code", "station_name", "stations", "samples", "avg_delay_min", "max_delay_min", "avg_delay_gain_min",
+		}}
+		for _, b := range buckets {
+			table.Rows = append(table.Rows, []string{
+				csvFloat(&b.Lat),
+				csvFloat(&b.Lng),
+				b.StationCode,
+				b.StationName,
+				strconv.Itoa(b.Stations),
+				strconv.FormatInt(b.Samples, 10),
+				csvFloat(&b.AvgDelayMin),
+				strconv.FormatInt(b.MaxDelayMin, 10),
+				csvFloat(&b.AvgDelayGainMin),
+			})
+		}
+		return table
+	})
+}
+
+// bucketDelays merges per-station aggregates into grid cells (sample-weighted);
+// gridDeg == 0 keeps one bucket per station. Stations without coordinates are skipped.
+func bucketDelays(rows []db.ListStationDelayBucketsRow, gridDeg float64) []HeatmapBucket {
+	type cellKey struct{ x, y int64 }
+
+	var buckets []HeatmapBucket
+	cells := map[cellKey]int{}
+
+	for _, row := range rows {
+		if !row.Lat.Valid || !row.Lng.Valid {
+			continue
+		}
+
+		if gridDeg == 0 {
+			buckets = append(buckets, HeatmapBucket{
+				Lat:             row.Lat.Float64,
+				Lng:             row.Lng.Float64,
+				StationCode:     row.StationCode,
+				StationName:     row.StationName,
+				Stations:        1,
+				Samples:         row.Samples,
+				AvgDelayMin:     row.AvgDelayMin,
+				MaxDelayMin:     row.MaxDelayMin,
+				AvgDelayGainMin: row.AvgDelayGainMin,
+			})
+			continue
+		}
+
+		key := cellKey{
+			x: int64(math.Floor(row.Lng.Float64 / gridDeg)),
+			y: int64(math.Floor(row.Lat.Float64 / gridDeg)),
+		}
+		idx, ok := cells[key]
+		if !ok {
+			idx = len(buckets)
+			cells[key] = idx
+			buckets = append(buckets, HeatmapBucket{
+				Lat: (float64(key.y) + 0.5) * gridDeg,
+				Lng: (float64(key.x) + 0.5) * gridDeg,
+			})
+		}
+
+		b := &buckets[idx]
+		total := float64(b.Samples + row.Samples)
+		b.AvgDelayMin = (b.AvgDelayMin*float64(b.Samples) + row.AvgDelayMin*float64(row.Samples)) / total
+		b.AvgDelayGainMin = (b.AvgDelayGainMin*float64(b.Samples) + row.AvgDelayGainMin*float64(row.Samples)) / total
+		b.Samples += row.Samples
+		b.MaxDelayMin = max(b.MaxDelayMin, row.MaxDelayMin)
+		b.Stations++
+	}
+
+	if buckets == nil {
+		buckets = []HeatmapBucket{}
+	}
+	return buckets
+}
+
+const (
+	groupZone     = "zone"
+	groupDivision = "division"
+	groupRakeZone = "rake_zone"
+)
+
+type ZonePunctuality struct {
+	Group          string   `json:"group"`
+	Zone           string   `json:"zone"`
+	Stations       *int64   `json:"stations,omitempty"`
+	Trains         *int64   `json:"trains,omitempty"`
+	Observations   int64    `json:"observations"`
+	OnTime         int64    `json:"on_time"`
+	OnTimePct      *float64 `json:"on_time_pct"`
+	AvgDelayMin    float64  `json:"avg_delay_min"`
+	MaxDelayMin    *int64   `json:"max_delay_min,omitempty"`
+	CancelledRuns  *int64   `json:"cancelled_runs,omitempty"`
+	CoveragePct    *float64 `json:"coverage_pct,omitempty"`
+	ObservationsOf string   `json:"observations_of"`
+}
+
+// GET /v1/reports/zones?group_by=zone|division|rake_zone&period=30d
+// zone and division group station arrivals by where they happen, rake_zone groups
+// terminal arrivals of runs by the zone owning the train
+func (h *AnalyticsHandler) GetZonePunctuality(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = groupZone
+	}
+	if groupBy != groupZone && groupBy != groupDivision && groupBy != groupRakeZone {
+		httpError(w, r, "invalid group_by, expected zone, division or rake_zone", http.StatusBadRequest)
+		return
+	}
+
+	period, sinceDate, err := parsePeriod(r, "30d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rollupFrom := rollupBoundary(sinceDate, h.loc)
+
+	groups := []ZonePunctuality{}
+	if groupBy == groupRakeZone {
+		rows, err := h.queries.ListRakeZonePunctuality(ctx, db.ListRakeZonePunctualityParams{
+			SinceDate:  sinceDate,
+			RollupFrom: rollupFrom,
+		})
+		if err != nil {
+			logf(h.logger, r, "handler: rake zone punctuality query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, row := range rows {
+			groups = append(groups, ZonePunctuality{
+				Group:          row.Zone,
+				Zone:           row.Zone,
+				Trains:         &row.Trains,
+				Observations:   row.TrackedRuns,
+				OnTime:         row.OnTimeRuns,
+				OnTimePct:      pct(row.OnTimeRuns, row.TrackedRuns),
+				AvgDelayMin:    row.AvgTerminalDelayMin,
+				CancelledRuns:  &row.CancelledRuns,
+				CoveragePct:    &row.CoveragePct,
+				ObservationsOf: "runs",
+			})
+		}
+	} else {
+		rows, err := h.queries.ListStationGroupPunctuality(ctx, db.ListStationGroupPunctualityParams{
+			GroupBy:    groupBy,
+			SinceDate:  sinceDate,
+			RollupFrom: rollupFrom,
+		})
+		if err != nil {
+			logf(h.logger, r, "handler: station group punctuality query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, row := range rows {
+			groups = append(groups, ZonePunctuality{
+				Group:          row.GroupKey,
+				Zone:           row.Zone,
+				Stations:       &row.Stations,
+				Observations:   row.Arrivals,
+				OnTime:         row.OnTimeArrivals,
+				OnTimePct:      pct(row.OnTimeArrivals, row.Arrivals),
+				AvgDelayMin:    row.AvgDelayMin,
+				MaxDelayMin:    &row.MaxDelayMin,
+				ObservationsOf: "station_arrivals",
+			})
+		}
+	}
+
+	respond(w, r, h.logger, "zones_"+groupBy+"_"+period+".csv", map[string]any{
+		"group_by": groupBy,
+		"period":   period,
+		"since":    sinceDate,
+		"total":    len(groups),
+		"groups":   groups,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"group", "zone", "stations", "trains", "observations", "observations_of", "on_time", "on_time_pct",
+			"avg_delay_min", "max_delay_min", "cancelled_runs", "coverage_pct",
+		}}
+		for _, g := range groups {
+			table.Rows = append(table.Rows, []string{
+				g.Group,
+				g.Zone,
+				csvInt(g.Stations),
+				csvInt(g.Trains),
+				strconv.FormatInt(g.Observations, 10),
+				g.ObservationsOf,
+				strconv.FormatInt(g.OnTime, 10),
+				csvFloat(g.OnTimePct),
+				csvFloat(&g.AvgDelayMin),
+				csvInt(g.MaxDelayMin),
+				csvInt(g.CancelledRuns),
+				csvFloat(g.CoveragePct),
+			})
+		}
+		return table
+	})
+}
+
+func pct(part, total int64) *float64 {
+	if total == 0 {
+		return nil
+	}
+	p := 100 * float64(part) / float64(total)
+	return &p
+}
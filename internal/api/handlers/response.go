@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"trano/internal/requestid"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// csvTable is the flattened form of a response, header first
+type csvTable struct {
+	Header []string
+	Rows   [][]string
+}
+
+// httpError answers with msg, tagged with the request ID
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	requestid.Error(w, r, msg, code)
+}
+
+// logf logs a handler line tagged with the request ID
+func logf(logger *log.Logger, r *http.Request, format string, args ...any) {
+	logContextf(logger, r.Context(), format, args...)
+}
+
+// logContextf is logf for code that only has the request's context
+func logContextf(logger *log.Logger, ctx context.Context, format string, args ...any) {
+	if id := requestid.From(ctx); id != "" {
+		format = "[" + id + "] " + format
+	}
+	logger.Printf(format, args...)
+}
+
+func writeJSON(w http.ResponseWriter, logger *log.Logger, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Printf("handler: failed to encode response: %v", err)
+	}
+}
+
+// request bodies are small JSON documents
+const maxBodyBytes = 1 << 20
+
+// readJSON decodes a JSON request body into v, unknown fields are an error so typos
+// do not pass silently
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeCSV(w http.ResponseWriter, logger *log.Logger, filename string, table csvTable) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(table.Header); err != nil {
+		logger.Printf("handler: failed to write csv header: %v", err)
+		return
+	}
+	if err := cw.WriteAll(table.Rows); err != nil {
+		logger.Printf("handler: failed to write csv rows: %v", err)
+	}
+}
+
+// wantsCSV reports whether the client asked for format=csv
+func wantsCSV(r *http.Request) bool {
+	return strings.EqualFold(r.URL.Query().Get("format"), "csv")
+}
+
+// respond writes either the JSON payload or, for format=csv, the table built by toCSV
+func respond(w http.ResponseWriter, r *http.Request, logger *log.Logger, filename string, payload any, toCSV func() csvTable) {
+	if wantsCSV(r) {
+		writeCSV(w, logger, filename, toCSV())
+		return
+	}
+	writeJSON(w, logger, http.StatusOK, payload)
+}
+
+// wantsProtoJSON reports whether a protobuf endpoint should answer with the JSON
+// mapping: format=json, or an Accept header naming JSON (or a browser's text/html)
+// ahead of application/x-protobuf. Protobuf stays the default.
+func wantsProtoJSON(r *http.Request) bool {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "json":
+		return true
+	case "protobuf":
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/x-protobuf", "application/protobuf":
+			return false
+		case "application/json", "text/html":
+			return true
+		}
+	}
+	return false
+}
+
+var protoJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+// writeProto writes msg as protobuf, or as its JSON mapping when the client asked for
+// JSON
+func writeProto(w http.ResponseWriter, r *http.Request, logger *log.Logger, msg proto.Message) {
+	contentType := "application/x-protobuf"
+	marshal := proto.Marshal
+	if wantsProtoJSON(r) {
+		contentType = "application/json; charset=utf-8"
+		marshal = protoJSON.Marshal
+	}
+	data, err := marshal(msg)
+	if err != nil {
+		logf(logger, r, "handler: failed to marshal %s: %v", contentType, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// wantsGeoJSON reports whether the client asked for format=geojson or accepts
+// application/geo+json
+func wantsGeoJSON(r *http.Request) bool {
+	return strings.EqualFold(r.URL.Query().Get("format"), "geojson") ||
+		strings.Contains(r.Header.Get("Accept"), "application/geo+json")
+}
+
+type geoGeometry struct {
+	Type        string `json:"type"` // "Point" or "LineString"
+	Coordinates any    `json:"coordinates"`
+}
+
+type geoFeature struct {
+	Type       string         `json:"type"`
+	Geometry   geoGeometry    `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+func newFeatureCollection(capacity int) *geoFeatureCollection {
+	return &geoFeatureCollection{Type: "FeatureCollection", Features: make([]geoFeature, 0, capacity)}
+}
+
+// addPoint takes lat/lng, GeoJSON positions are [lng, lat]
+func (fc *geoFeatureCollection) addPoint(lat, lng float64, props map[string]any) {
+	fc.Features = append(fc.Features, geoFeature{
+		Type:       "Feature",
+		Geometry:   geoGeometry{Type: "Point", Coordinates: [2]float64{lng, lat}},
+		Properties: props,
+	})
+}
+
+// addLineString takes [lng, lat] positions, a line needs at least two
+func (fc *geoFeatureCollection) addLineString(coords [][2]float64, props map[string]any) {
+	if len(coords) < 2 {
+		return
+	}
+	fc.Features = append(fc.Features, geoFeature{
+		Type:       "Feature",
+		Geometry:   geoGeometry{Type: "LineString", Coordinates: coords},
+		Properties: props,
+	})
+}
+
+func writeGeoJSON(w http.ResponseWriter, logger *log.Logger, fc *geoFeatureCollection) {
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		logger.Printf("handler: failed to encode geojson: %v", err)
+	}
+}
+
+// notModified sets a weak ETag derived from version, which must cover everything the
+// response depends on, and answers 304 when the client's If-None-Match has it. Weak
+// because gzip changes the bytes but not the content.
+func notModified(w http.ResponseWriter, r *http.Request, version ...any) bool {
+	h := fnv.New64a()
+	fmt.Fprint(h, version...)
+	tag := fmt.Sprintf(`W/"%x"`, h.Sum64())
+	w.Header().Set("ETag", tag)
+
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(tag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ExportCSV forces CSV output, used for the /v1/export routes
+func ExportCSV(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		q.Set("format", "csv")
+		r.URL.RawQuery = q.Encode()
+		next(w, r)
+	}
+}
+
+// parseDateParam reads a YYYY-MM-DD query param, defaulting to today in loc
+func parseDateParam(r *http.Request, key string, loc *time.Location) (string, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return time.Now().In(loc).Format(time.DateOnly), nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, raw, loc)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q, expected YYYY-MM-DD", key, raw)
+	}
+	return t.Format(time.DateOnly), nil
+}
+
+// queryInt reads an integer query param clamped to [lo, hi]
+func queryInt(r *http.Request, key string, def, lo, hi int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return def
+	}
+	return min(max(v, lo), hi)
+}
+
+// bbox is a lat/lng viewport, a nil *bbox covers everything
+type bbox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// parseBBox reads min_lat, min_lng, max_lat and max_lng, all four or none
+func parseBBox(r *http.Request) (*bbox, error) {
+	q := r.URL.Query()
+	keys := []string{"min_lat", "min_lng", "max_lat", "max_lng"}
+	if q.Get(keys[0]) == "" && q.Get(keys[1]) == "" && q.Get(keys[2]) == "" && q.Get(keys[3]) == "" {
+		return nil, nil
+	}
+
+	var v [4]float64
+	for i, key := range keys {
+		f, err := strconv.ParseFloat(q.Get(key), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, expected min_lat, min_lng, max_lat and max_lng together", key)
+		}
+		v[i] = f
+	}
+	return newBBox(v)
+}
+
+func newBBox(v [4]float64) (*bbox, error) {
+	b := &bbox{MinLat: v[0], MinLng: v[1], MaxLat: v[2], MaxLng: v[3]}
+	if b.MinLat > b.MaxLat || b.MinLng > b.MaxLng {
+		return nil, fmt.Errorf("invalid bounding box, min must not exceed max")
+	}
+	return b, nil
+}
+
+// containsU6 takes micro-degrees as stored on runs
+func (b *bbox) containsU6(latU6, lngU6 int64) bool {
+	if b == nil {
+		return true
+	}
+	lat, lng := float64(latU6)/1e6, float64(lngU6)/1e6
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// parseRadius reads lat, lng and radius_km, the radius def when left out and at most
+// maxKm
+func parseRadius(r *http.Request, def, maxKm float64) (lat, lng, radiusKm float64, err error) {
+	q := r.URL.Query()
+	lat, err = strconv.ParseFloat(q.Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, 0, fmt.Errorf("invalid lat, expected degrees between -90 and 90")
+	}
+	lng, err = strconv.ParseFloat(q.Get("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, 0, fmt.Errorf("invalid lng, expected degrees between -180 and 180")
+	}
+	radiusKm = def
+	if raw := q.Get("radius_km"); raw != "" {
+		radiusKm, err = strconv.ParseFloat(raw, 64)
+		if err != nil || radiusKm <= 0 || radiusKm > maxKm {
+			return 0, 0, 0, fmt.Errorf("invalid radius_km, expected more than 0 and at most %g", maxKm)
+		}
+	}
+	return lat, lng, radiusKm, nil
+}
+
+// radiusBox is the box around a circle, wide enough at any latitude short of the poles
+func radiusBox(lat, lng, radiusKm float64) bbox {
+	dLat := radiusKm / 111.32
+	dLng := radiusKm / (111.32 * max(math.Cos(lat*math.Pi/180), 0.01))
+	return bbox{MinLat: lat - dLat, MinLng: lng - dLng, MaxLat: lat + dLat, MaxLng: lng + dLng}
+}
+
+// bearingDeg is the initial bearing from one point to another, 0 to 359 clockwise from north
+func bearingDeg(fromLat, fromLng, toLat, toLng float64) int64 {
+	lat1, lat2 := fromLat*math.Pi/180, toLat*math.Pi/180
+	dLng := (toLng - fromLng) * math.Pi / 180
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+	return (int64(math.Round(math.Atan2(y, x)*180/math.Pi)) + 360) % 360
+}
+
+func statusString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return "unknown"
+}
+
+// fixed-point helpers: u6 = micro-degrees, u4 = 1e-4 km
+func u6ToFloat(v sql.NullInt64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	f := float64(v.Int64) / 1e6
+	return &f
+}
+
+func u4ToFloat(v sql.NullInt64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	f := float64(v.Int64) / 1e4
+	return &f
+}
+
+func nullString(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
+
+func csvFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func csvString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func nullInt(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+// unixToTime renders unix seconds as RFC3339 in loc
+func unixToTime(v sql.NullInt64, loc *time.Location) *string {
+	if !v.Valid || v.Int64 <= 0 {
+		return nil
+	}
+	s := time.Unix(v.Int64, 0).In(loc).Format(time.RFC3339)
+	return &s
+}
+
+func csvInt(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
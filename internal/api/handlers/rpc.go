@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"trano/internal/api/rpc"
+	v1 "trano/internal/api/schema/v1"
+	db "trano/internal/db/sqlc"
+)
+
+// TrainsService implements the trano.api.v1.Trains gRPC service on the same queries
+// and live stream as the HTTP handlers
+type TrainsService struct {
+	queries *db.Queries
+	logger  *log.Logger
+	loc     *time.Location
+	live    *LiveStream
+}
+
+// NewTrainsService shares trains' live stream, so gRPC and websocket subscribers cost
+// one query per tick between them
+func NewTrainsService(queries *db.Queries, trains *TrainHandler, logger *log.Logger, loc *time.Location) *TrainsService {
+	return &TrainsService{
+		queries: queries,
+		logger:  logger,
+		loc:     loc,
+		live:    trains.live,
+	}
+}
+
+// Register adds the service's methods to s
+func (h *TrainsService) Register(s *rpc.Server) {
+	rpc.Unary(s, "LiveTrains", h.LiveTrains)
+	rpc.Unary(s, "GetRun", h.GetRun)
+	rpc.Unary(s, "GetTimetable", h.GetTimetable)
+	rpc.ServerStream(s, "StreamPositions", h.StreamPositions)
+}
+
+// LiveTrains mirrors GET /v1/trains/live without clustering
+func (h *TrainsService) LiveTrains(ctx context.Context, req *v1.LiveTrainsRequest) (*v1.LiveTrainsResponse, error) {
+	box, err := rpcBBox(req)
+	if err != nil {
+		return nil, err
+	}
+	trains, err := h.queries.GetLiveTrains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("live trains query: %w", err)
+	}
+	return mapLiveTrains(liveTrainsInView(trains, box)), nil
+}
+
+func (h *TrainsService) GetRun(ctx context.Context, req *v1.GetRunRequest) (*v1.TrainRun, error) {
+	if req.TrainNo == 0 {
+		return nil, rpc.Errorf(rpc.InvalidArgument, "train_no is required")
+	}
+	date, err := time.ParseInLocation(time.DateOnly, req.RunDate, h.loc)
+	if err != nil {
+		return nil, rpc.Errorf(rpc.InvalidArgument, "invalid run_date %q, expected YYYY-MM-DD", req.RunDate)
+	}
+	runID := fmt.Sprintf("%d_%s", req.TrainNo, date.Format(time.DateOnly))
+
+	rows, err := h.queries.ListRunsByIDs(ctx, []string{runID})
+	if err != nil {
+		return nil, fmt.Errorf("run %s query: %w", runID, err)
+	}
+	if len(rows) == 0 {
+		return nil, rpc.Errorf(rpc.NotFound, "run %s not found", runID)
+	}
+	row := rows[0]
+
+	run := &v1.TrainRun{
+		RunId:      row.RunID,
+		TrainNo:    row.TrainNo,
+		RunDate:    row.RunDate,
+		HasStarted: row.HasStarted == 1,
+		HasArrived: row.HasArrived == 1,
+		Status:     statusString(row.CurrentStatus),
+		UpdatedAt:  row.LastUpdateTimestampIso.String,
+	}
+	if row.LatU6.Valid && row.LngU6.Valid {
+		run.LatU6 = int32(row.LatU6.Int64)
+		run.LngU6 = int32(row.LngU6.Int64)
+	}
+	return run, nil
+}
+
+// GetTimetable mirrors GET /v1/trains/{train_no}/timetable
+func (h *TrainsService) GetTimetable(ctx context.Context, req *v1.GetTimetableRequest) (*v1.Timetable, error) {
+	if req.TrainNo == 0 {
+		return nil, rpc.Errorf(rpc.InvalidArgument, "train_no is required")
+	}
+	rows, err := h.queries.ListTrainTimetable(ctx, int64(req.TrainNo))
+	if err != nil {
+		return nil, fmt.Errorf("train %d timetable query: %w", req.TrainNo, err)
+	}
+	if len(rows) == 0 {
+		return nil, rpc.Errorf(rpc.NotFound, "train %d has no timetable", req.TrainNo)
+	}
+
+	tt := &v1.Timetable{
+		TrainNo:   req.TrainNo,
+		TrainName: rows[0].TrainName,
+		TrainType: rows[0].TrainType,
+	}
+	var sch *v1.TimetableSchedule
+	for _, row := range rows {
+		if sch == nil || sch.ScheduleId != row.ScheduleID {
+			sch = &v1.TimetableSchedule{
+				ScheduleId:          row.ScheduleID,
+				OriginStationCode:   row.OriginStationCode,
+				TerminusStationCode: row.TerminusStationCode,
+				OriginDepartureMin:  int32(row.OriginSchDepartureMin),
+				TotalDistanceKm:     row.TotalDistanceKm,
+				TotalRuntimeMin:     int32(row.TotalRuntimeMin),
+				RunningDays:         runningDaysFrom(row.RunningDaysBitmap, 0),
+			}
+			tt.Schedules = append(tt.Schedules, sch)
+		}
+
+		arr := row.OriginSchDepartureMin + row.SchArrivalMinFromStart
+		sch.Stops = append(sch.Stops, &v1.TimetableStop{
+			StationCode:  row.StationCode,
+			StationName:  row.StationName,
+			DistanceKm:   row.DistanceKm,
+			Halt:         row.Stops == 1,
+			ArrivalMin:   int32(row.SchArrivalMinFromStart),
+			DepartureMin: int32(row.SchDepartureMinFromStart),
+			Day:          int32(arr/1440 + 1),
+		})
+	}
+	return tt, nil
+}
+
+// StreamPositions mirrors /v1/live/ws with a fixed viewport, the frames the live
+// stream marshals for websockets are sent as they are
+func (h *TrainsService) StreamPositions(ctx context.Context, req *v1.LiveTrainsRequest, stream *rpc.Stream) error {
+	box, err := rpcBBox(req)
+	if err != nil {
+		return err
+	}
+	err = h.live.follow(ctx, box, func(frame []byte) error {
+		stream.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		return stream.SendRaw(frame)
+	})
+	if errors.Is(err, errLiveStreamEnded) {
+		return rpc.Errorf(rpc.Unavailable, "live stream ended, call again for a fresh snapshot")
+	}
+	return err
+}
+
+// rpcBBox reads the viewport of a request, all zero bounds meaning every train
+func rpcBBox(req *v1.LiveTrainsRequest) (*bbox, error) {
+	if req.MinLat == 0 && req.MinLng == 0 && req.MaxLat == 0 && req.MaxLng == 0 {
+		return nil, nil
+	}
+	box, err := newBBox([4]float64{req.MinLat, req.MinLng, req.MaxLat, req.MaxLng})
+	if err != nil {
+		return nil, rpc.Errorf(rpc.InvalidArgument, "%v", err)
+	}
+	return box, nil
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	db "trano/internal/db/sqlc"
+)
+
+type StationComparison struct {
+	Sno                  int64    `json:"sno"`
+	StationCode          string   `json:"station_code"`
+	StationName          *string  `json:"station_name"`
+	DistanceKm           float64  `json:"distance_km"`
+	DelayArrivalMin      *int64   `json:"delay_arrival_min"`
+	DelayDepartureMin    *int64   `json:"delay_departure_min"`
+	AvgDelayArrivalMin   *float64 `json:"avg_delay_arrival_min"`
+	AvgDelayDepartureMin *float64 `json:"avg_delay_departure_min"`
+	Samples              int64    `json:"samples"` // earlier runs with a delay recorded here
+	// this run's delay less the average, departure delays where both have one; positive
+	// when the run is doing worse than usual
+	DiffMin *float64 `json:"diff_min"`
+}
+
+type ComparisonSummary struct {
+	RunsCompared int      `json:"runs_compared"`
+	Stations     int      `json:"stations"`
+	AvgDiffMin   *float64 `json:"avg_diff_min"`
+	LastDiffMin  *float64 `json:"last_diff_min"` // at the last station this run reported a delay
+}
+
+// GET /v1/runs/{train_no}/{run_date}/compare?runs=30
+// The delay profile of a run next to the train's average over its last runs before it
+func (h *RunHandler) CompareRun(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID, ok := h.runIDParam(w, r)
+	if !ok {
+		return
+	}
+	runs := queryInt(r, "runs", 30, 1, 90)
+
+	run, err := h.queries.GetRunPredictionContext(ctx, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: run context query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := h.queries.ListRunStationEvents(ctx, runID)
+	if err != nil {
+		logf(h.logger, r, "handler: run delays query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	history, err := h.queries.ListTrainStationDelayHistory(ctx, db.ListTrainStationDelayHistoryParams{
+		TrainNo:    run.TrainNo,
+		BeforeDate: run.RunDate,
+		Runs:       int64(runs),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: delay history query failed for %d: %v", run.TrainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	byStation := make(map[string]db.ListTrainStationDelayHistoryRow, len(history))
+	var summary ComparisonSummary
+	for _, row := range history {
+		byStation[row.StationCode] = row
+		summary.RunsCompared = int(row.Runs)
+	}
+
+	stations := make([]StationComparison, 0, len(events))
+	var diffSum float64
+	var diffCount int
+	for _, e := range events {
+		c := StationComparison{
+			Sno:               e.Sno,
+			StationCode:       e.StationCode,
+			StationName:       nullString(e.StationName),
+			DistanceKm:        float64(e.DistanceKmU4) / 1e4,
+			DelayArrivalMin:   nullInt(e.DelayArrivalMin),
+			DelayDepartureMin: nullInt(e.DelayDepartureMin),
+		}
+		if hist, ok := byStation[e.StationCode]; ok {
+			c.Samples = hist.Samples
+			c.AvgDelayArrivalMin = roundedAvg(hist.AvgDelayArrivalMin)
+			c.AvgDelayDepartureMin = roundedAvg(hist.AvgDelayDepartureMin)
+		}
+
+		// same rule as the delay summary, departure delay wins once the train has left
+		switch {
+		case c.DelayDepartureMin != nil && c.AvgDelayDepartureMin != nil:
+			c.DiffMin = diffMin(*c.DelayDepartureMin, *c.AvgDelayDepartureMin)
+		case c.DelayArrivalMin != nil && c.AvgDelayArrivalMin != nil:
+			c.DiffMin = diffMin(*c.DelayArrivalMin, *c.AvgDelayArrivalMin)
+		}
+		if c.DiffMin != nil {
+			diffSum += *c.DiffMin
+			diffCount++
+			summary.LastDiffMin = c.DiffMin
+		}
+		stations = append(stations, c)
+	}
+	summary.Stations = len(stations)
+	if diffCount > 0 {
+		avg := math.Round(diffSum/float64(diffCount)*10) / 10
+		summary.AvgDiffMin = &avg
+	}
+
+	respond(w, r, h.logger, "compare_"+runID+".csv", map[string]any{
+		"run_id":   runID,
+		"train_no": run.TrainNo,
+		"run_date": run.RunDate,
+		"summary":  summary,
+		"stations": stations,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "sno", "station_code", "station_name", "distance_km", "delay_arrival_min", "delay_departure_min",
+			"avg_delay_arrival_min", "avg_delay_departure_min", "samples", "diff_min",
+		}}
+		for _, s := range stations {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				strconv.FormatInt(s.Sno, 10),
+				s.StationCode,
+				csvString(s.StationName),
+				csvFloat(&s.DistanceKm),
+				csvInt(s.DelayArrivalMin),
+				csvInt(s.DelayDepartureMin),
+				csvFloat(s.AvgDelayArrivalMin),
+				csvFloat(s.AvgDelayDepartureMin),
+				strconv.FormatInt(s.Samples, 10),
+				csvFloat(s.DiffMin),
+			})
+		}
+		return table
+	})
+}
+
+// roundedAvg rounds an average delay to a tenth of a minute
+func roundedAvg(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	f := math.Round(v.Float64*10) / 10
+	return &f
+}
+
+func diffMin(delay int64, avg float64) *float64 {
+	d := math.Round((float64(delay)-avg)*10) / 10
+	return &d
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const maxReplaySpeed = 3600
+
+// ReplayFix is one recorded fix as played back on a replay stream
+type ReplayFix struct {
+	RunLocation
+	OffsetSec int64 `json:"offset_sec"` // recorded seconds since the first fix
+}
+
+// GET /v1/runs/{train_no}/{run_date}/replay?speed=60
+// Server-sent events playing the recorded fixes of a run back on a clock running
+// speed times faster than the original: a "start" event, a "fix" event per fix as
+// its time comes round, then "end".
+func (h *RunHandler) StreamRunReplay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	runID, ok := h.runIDParam(w, r)
+	if !ok {
+		return
+	}
+	speed := queryInt(r, "speed", 60, 1, maxReplaySpeed)
+
+	rows, err := h.queries.ListRunLocations(ctx, runID)
+	if err != nil {
+		logf(h.logger, r, "handler: run locations query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	fixes := make([]ReplayFix, 0, len(rows))
+	var times []time.Time
+	for _, row := range rows {
+		ts, err := time.Parse(time.RFC3339, row.TimestampIso)
+		if err != nil {
+			continue
+		}
+		fixes = append(fixes, ReplayFix{RunLocation: RunLocation{
+			Timestamp:   row.TimestampIso,
+			Lat:         float64(row.LatU6) / 1e6,
+			Lng:         float64(row.LngU6) / 1e6,
+			SnappedLat:  u6ToFloat(row.SnappedLatU6),
+			SnappedLng:  u6ToFloat(row.SnappedLngU6),
+			DistanceKm:  float64(row.DistanceKmU4) / 1e4,
+			StationCode: row.SegmentStationCode,
+			AtStation:   row.AtStation == 1,
+		}})
+		times = append(times, ts)
+	}
+	if len(fixes) == 0 {
+		httpError(w, r, "run has no recorded locations", http.StatusNotFound)
+		return
+	}
+	first, last := times[0], times[len(times)-1]
+
+	rc := http.NewResponseController(w)
+	// the server write timeout is meant for plain requests
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logf(h.logger, r, "handler: replay for %s cannot clear write deadline: %v", runID, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, data any) bool {
+		b, err := json.Marshal(data)
+		if err != nil {
+			logf(h.logger, r, "handler: failed to encode replay event for %s: %v", runID, err)
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send("start", map[string]any{
+		"run_id":       runID,
+		"speed":        speed,
+		"fixes":        len(fixes),
+		"from":         fixes[0].Timestamp,
+		"to":           fixes[len(fixes)-1].Timestamp,
+		"duration_sec": int64(last.Sub(first).Seconds()) / int64(speed),
+	}) {
+		return
+	}
+
+	// each fix is due at its recorded offset scaled down by speed, measured from the
+	// start so slow writes do not add up into drift
+	start := time.Now()
+	keepalive := time.NewTicker(runStreamKeepalive)
+	defer keepalive.Stop()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for i := range fixes {
+		offset := times[i].Sub(first)
+		fixes[i].OffsetSec = int64(offset.Seconds())
+
+		if wait := time.Until(start.Add(offset / time.Duration(speed))); wait > 0 {
+			timer.Reset(wait)
+		sleep:
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-keepalive.C:
+					if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil || rc.Flush() != nil {
+						return
+					}
+				case <-timer.C:
+					break sleep
+				}
+			}
+		}
+		if !send("fix", fixes[i]) {
+			return
+		}
+	}
+
+	send("end", map[string]any{"run_id": runID, "fixes": len(fixes)})
+}
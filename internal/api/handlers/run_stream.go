@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	runStreamInterval = 5 * time.Second
+	// a comment line this often keeps proxies from closing a quiet stream
+	runStreamKeepalive = 30 * time.Second
+)
+
+// RunEvent is one state of a run as sent on its event stream
+type RunEvent struct {
+	RunID       string   `json:"run_id"`
+	HasStarted  bool     `json:"has_started"`
+	HasArrived  bool     `json:"has_arrived"`
+	Status      string   `json:"status"`
+	Sno         *int     `json:"sno"`
+	StationCode *string  `json:"station_code"`
+	Lat         *float64 `json:"lat"`
+	Lng         *float64 `json:"lng"`
+	SnappedLat  *float64 `json:"snapped_lat"`
+	SnappedLng  *float64 `json:"snapped_lng"`
+	DistanceKm  *float64 `json:"distance_km"`
+	BearingDeg  *int64   `json:"bearing_deg"`
+	LastUpdate  *string  `json:"last_update"`
+}
+
+// GET /v1/runs/{train_no}/{run_date}/events
+// Server-sent events: a "run" event with the current state on connect and again
+// whenever status, SNO or coordinates change, then "end" once the run has arrived.
+func (h *RunHandler) StreamRunEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	runID, ok := h.runIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := h.queries.GetRunState(ctx, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: run state query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// the server write timeout is meant for plain requests
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logf(h.logger, r, "handler: run stream for %s cannot clear write deadline: %v", runID, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, data any) bool {
+		b, err := json.Marshal(data)
+		if err != nil {
+			logf(h.logger, r, "handler: failed to encode run event for %s: %v", runID, err)
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send("run", runEvent(state)) {
+		return
+	}
+
+	ticker := time.NewTicker(runStreamInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+
+	for state.HasArrived == 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		next, err := h.queries.GetRunState(ctx, runID)
+		if err != nil {
+			if ctx.Err() == nil {
+				logf(h.logger, r, "handler: run state query failed for %s: %v", runID, err)
+			}
+			return
+		}
+
+		if runStateChanged(state, next) {
+			state = next
+			if !send("run", runEvent(state)) {
+				return
+			}
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= runStreamKeepalive {
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+	}
+
+	send("end", map[string]string{"run_id": runID, "status": state.CurrentStatus})
+}
+
+// runStateChanged looks at what the stream promises to report on
+func runStateChanged(a, b db.GetRunStateRow) bool {
+	return a.CurrentStatus != b.CurrentStatus ||
+		a.HasStarted != b.HasStarted ||
+		a.HasArrived != b.HasArrived ||
+		a.LastUpdatedSno != b.LastUpdatedSno ||
+		a.LatU6 != b.LatU6 ||
+		a.LngU6 != b.LngU6 ||
+		a.SnappedLatU6 != b.SnappedLatU6 ||
+		a.SnappedLngU6 != b.SnappedLngU6
+}
+
+func runEvent(row db.GetRunStateRow) RunEvent {
+	ev := RunEvent{
+		RunID:      row.RunID,
+		HasStarted: row.HasStarted == 1,
+		HasArrived: row.HasArrived == 1,
+		Status:     row.CurrentStatus,
+		Lat:        u6ToFloat(row.LatU6),
+		Lng:        u6ToFloat(row.LngU6),
+		SnappedLat: u6ToFloat(row.SnappedLatU6),
+		SnappedLng: u6ToFloat(row.SnappedLngU6),
+		DistanceKm: u4ToFloat(row.DistanceKmU4),
+		BearingDeg: nullInt(row.BearingDeg),
+		LastUpdate: nullString(row.LastUpdateTimestampIso),
+	}
+
+	// last_updated_sno is "sno|station_code|sch_arr|act_arr|sch_dep|act_dep"
+	if row.LastUpdatedSno.Valid {
+		parts := strings.Split(row.LastUpdatedSno.String, "|")
+		if sno, err := strconv.Atoi(parts[0]); err == nil {
+			ev.Sno = &sno
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			ev.StationCode = &parts[1]
+		}
+	}
+	return ev
+}
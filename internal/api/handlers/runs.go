@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/prediction"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type RunHandler struct {
+	queries   *db.Queries
+	db        *sql.DB
+	logger    *log.Logger
+	loc       *time.Location
+	predictor *prediction.Predictor
+}
+
+func NewRunHandler(queries *db.Queries, dbConn *sql.DB, logger *log.Logger, loc *time.Location) *RunHandler {
+	return &RunHandler{
+		queries:   queries,
+		db:        dbConn,
+		logger:    logger,
+		loc:       loc,
+		predictor: prediction.New(queries, loc),
+	}
+}
+
+type RunSummary struct {
+	RunID               string   `json:"run_id"`
+	TrainNo             int64    `json:"train_no"`
+	TrainName           string   `json:"train_name"`
+	TrainType           string   `json:"train_type"`
+	RunDate             string   `json:"run_date"`
+	OriginStationCode   string   `json:"origin_station_code"`
+	TerminusStationCode string   `json:"terminus_station_code"`
+	HasStarted          bool     `json:"has_started"`
+	HasArrived          bool     `json:"has_arrived"`
+	Status              string   `json:"status"`
+	Lat                 *float64 `json:"lat"`
+	Lng                 *float64 `json:"lng"`
+	DistanceKm          *float64 `json:"distance_km"`
+	LastUpdate          *string  `json:"last_update"`
+	Anomaly             *string  `json:"anomaly"`
+	QualityScore        *int64   `json:"quality_score"`
+	CarriedBy           *string  `json:"carried_by"`
+}
+
+type RunLocation struct {
+	Timestamp   string   `json:"timestamp"`
+	Lat         float64  `json:"lat"`
+	Lng         float64  `json:"lng"`
+	SnappedLat  *float64 `json:"snapped_lat"`
+	SnappedLng  *float64 `json:"snapped_lng"`
+	DistanceKm  float64  `json:"distance_km"`
+	StationCode string   `json:"station_code"`
+	AtStation   bool     `json:"at_station"`
+}
+
+// run states ListRuns filters on with status=
+var runStatusFilters = map[string]bool{
+	"scheduled": true, // not started yet
+	"running":   true,
+	"completed": true, // arrived, or terminated short
+	"cancelled": true, // cancelled or reported not running
+	"no_data":   true, // given up on by the poller, never reported or went silent
+}
+
+// GET /v1/runs?date=YYYY-MM-DD&status=running&has_started=true&min_quality=60&limit=500&cursor=
+// min_quality drops runs scored below it along with unscored ones. Linked trains
+// riding another train report its run as carried_by and share its position.
+// Runs come in train number order, next_cursor fetches the following page.
+func (h *RunHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	runDate, err := parseDateParam(r, "date", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status := strings.ToLower(r.URL.Query().Get("status"))
+	if status != "" && !runStatusFilters[status] {
+		httpError(w, r, "invalid status, expected scheduled, running, completed or cancelled", http.StatusBadRequest)
+		return
+	}
+	hasStarted := int64(-1)
+	if raw := r.URL.Query().Get("has_started"); raw != "" {
+		started, err := strconv.ParseBool(raw)
+		if err != nil {
+			httpError(w, r, "invalid has_started, expected true or false", http.StatusBadRequest)
+			return
+		}
+		hasStarted = 0
+		if started {
+			hasStarted = 1
+		}
+	}
+	p, err := parsePage(r, 500, 10000, 1)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.queries.ListRunsByDate(ctx, db.ListRunsByDateParams{
+		RunDate:      runDate,
+		MinQuality:   queryInt(r, "min_quality", 0, 0, 100),
+		Status:       status,
+		HasStarted:   hasStarted,
+		AfterTrainNo: p.afterInt(0),
+		Limit:        p.fetch(),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: list runs query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	rows, next := pageOf(w, rows, p, func(row db.ListRunsByDateRow) []string {
+		return []string{strconv.FormatInt(row.TrainNo, 10)}
+	})
+
+	runs := make([]RunSummary, 0, len(rows))
+	for _, row := range rows {
+		runs = append(runs, runSummary(row))
+	}
+
+	respond(w, r, h.logger, "runs_"+runDate+".csv", map[string]any{
+		"date":        runDate,
+		"total":       len(runs),
+		"runs":        runs,
+		"next_cursor": next,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "train_no", "train_name", "train_type", "run_date", "origin", "terminus",
+			"has_started", "has_arrived", "status", "lat", "lng", "distance_km", "last_update", "anomaly",
+			"quality_score", "carried_by",
+		}}
+		for _, run := range runs {
+			table.Rows = append(table.Rows, []string{
+				run.RunID,
+				strconv.FormatInt(run.TrainNo, 10),
+				run.TrainName,
+				run.TrainType,
+				run.RunDate,
+				run.OriginStationCode,
+				run.TerminusStationCode,
+				strconv.FormatBool(run.HasStarted),
+				strconv.FormatBool(run.HasArrived),
+				run.Status,
+				csvFloat(run.Lat),
+				csvFloat(run.Lng),
+				csvFloat(run.DistanceKm),
+				csvString(run.LastUpdate),
+				csvString(run.Anomaly),
+				csvInt(run.QualityScore),
+				csvString(run.CarriedBy),
+			})
+		}
+		return table
+	})
+}
+
+func runSummary(row db.ListRunsByDateRow) RunSummary {
+	return RunSummary{
+		RunID:               row.RunID,
+		TrainNo:             row.TrainNo,
+		TrainName:           row.TrainName,
+		TrainType:           row.TrainType,
+		RunDate:             row.RunDate,
+		OriginStationCode:   row.OriginStationCode,
+		TerminusStationCode: row.TerminusStationCode,
+		HasStarted:          row.HasStarted == 1,
+		HasArrived:          row.HasArrived == 1,
+		Status:              statusString(row.CurrentStatus),
+		Lat:                 u6ToFloat(row.LatU6),
+		Lng:                 u6ToFloat(row.LngU6),
+		DistanceKm:          u4ToFloat(row.DistanceKmU4),
+		LastUpdate:          nullString(row.LastUpdateTimestampIso),
+		Anomaly:             nullString(row.Anomaly),
+		QualityScore:        nullInt(row.QualityScore),
+		CarriedBy:           nullString(row.CarriedBy),
+	}
+}
+
+// GET /v1/runs/{run_id}/locations?limit=2000&cursor=
+// Fixes in chronological order, next_cursor fetches the following page
+func (h *RunHandler) GetRunLocations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID := chi.URLParam(r, "run_id")
+
+	p, err := parsePage(r, 2000, 10000, 2)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.queries.ListRunLocationsPage(ctx, db.ListRunLocationsPageParams{
+		RunID:          runID,
+		AfterTimestamp: p.afterString(0),
+		AfterID:        p.afterInt(1),
+		Limit:          p.fetch(),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: run locations query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	rows, next := pageOf(w, rows, p, func(row db.ListRunLocationsPageRow) []string {
+		return []string{row.TimestampIso, strconv.FormatInt(row.ID, 10)}
+	})
+
+	locations := make([]RunLocation, 0, len(rows))
+	for _, row := range rows {
+		locations = append(locations, RunLocation{
+			Timestamp:   row.TimestampIso,
+			Lat:         float64(row.LatU6) / 1e6,
+			Lng:         float64(row.LngU6) / 1e6,
+			SnappedLat:  u6ToFloat(row.SnappedLatU6),
+			SnappedLng:  u6ToFloat(row.SnappedLngU6),
+			DistanceKm:  float64(row.DistanceKmU4) / 1e4,
+			StationCode: row.SegmentStationCode,
+			AtStation:   row.AtStation == 1,
+		})
+	}
+
+	if wantsGeoJSON(r) {
+		writeGeoJSON(w, h.logger, runTrackGeoJSON(runID, locations))
+		return
+	}
+
+	respond(w, r, h.logger, "locations_"+runID+".csv", map[string]any{
+		"run_id":      runID,
+		"total":       len(locations),
+		"locations":   locations,
+		"next_cursor": next,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "timestamp", "lat", "lng", "snapped_lat", "snapped_lng", "distance_km", "station_code", "at_station",
+		}}
+		for _, loc := range locations {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				loc.Timestamp,
+				csvFloat(&loc.Lat),
+				csvFloat(&loc.Lng),
+				csvFloat(loc.SnappedLat),
+				csvFloat(loc.SnappedLng),
+				csvFloat(&loc.DistanceKm),
+				loc.StationCode,
+				strconv.FormatBool(loc.AtStation),
+			})
+		}
+		return table
+	})
+}
+
+// runTrackGeoJSON is the track as one line followed by a point per fix, both on the
+// snapped position where there is one
+func runTrackGeoJSON(runID string, locations []RunLocation) *geoFeatureCollection {
+	line := make([][2]float64, 0, len(locations))
+	for _, loc := range locations {
+		lat, lng := trackPosition(loc)
+		line = append(line, [2]float64{lng, lat})
+	}
+
+	fc := newFeatureCollection(len(locations) + 1)
+	fc.addLineString(line, map[string]any{"run_id": runID, "points": len(line)})
+	for _, loc := range locations {
+		lat, lng := trackPosition(loc)
+		fc.addPoint(lat, lng, map[string]any{
+			"run_id":       runID,
+			"timestamp":    loc.Timestamp,
+			"distance_km":  loc.DistanceKm,
+			"station_code": loc.StationCode,
+			"at_station":   loc.AtStation,
+			"snapped":      loc.SnappedLat != nil && loc.SnappedLng != nil,
+		})
+	}
+	return fc
+}
+
+func trackPosition(loc RunLocation) (lat, lng float64) {
+	if loc.SnappedLat != nil && loc.SnappedLng != nil {
+		return *loc.SnappedLat, *loc.SnappedLng
+	}
+	return loc.Lat, loc.Lng
+}
+
+type StationDelay struct {
+	Sno               int64   `json:"sno"`
+	StationCode       string  `json:"station_code"`
+	StationName       *string `json:"station_name"`
+	DistanceKm        float64 `json:"distance_km"`
+	SchArrival        *string `json:"sch_arrival"`
+	ActArrival        *string `json:"act_arrival"`
+	SchDeparture      *string `json:"sch_departure"`
+	ActDeparture      *string `json:"act_departure"`
+	DelayArrivalMin   *int64  `json:"delay_arrival_min"`
+	DelayDepartureMin *int64  `json:"delay_departure_min"`
+	Departed          bool    `json:"departed"`
+}
+
+type DelaySummary struct {
+	Stations        int      `json:"stations"`
+	CurrentDelayMin *int64   `json:"current_delay_min"`
+	MaxDelayMin     *int64   `json:"max_delay_min"`
+	AvgDelayMin     *float64 `json:"avg_delay_min"`
+}
+
+// GET /v1/runs/{run_id}/delays
+func (h *RunHandler) GetRunDelays(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID := chi.URLParam(r, "run_id")
+
+	rows, err := h.queries.ListRunStationEvents(ctx, runID)
+	if err != nil {
+		logf(h.logger, r, "handler: run delays query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	stations := make([]StationDelay, 0, len(rows))
+	var summary DelaySummary
+	var delaySum, delayCount int64
+	for _, row := range rows {
+		stn := StationDelay{
+			Sno:               row.Sno,
+			StationCode:       row.StationCode,
+			StationName:       nullString(row.StationName),
+			DistanceKm:        float64(row.DistanceKmU4) / 1e4,
+			SchArrival:        unixToTime(row.SchArrivalTm, h.loc),
+			ActArrival:        unixToTime(row.ActArrivalTm, h.loc),
+			SchDeparture:      unixToTime(row.SchDepartureTm, h.loc),
+			ActDeparture:      unixToTime(row.ActDepartureTm, h.loc),
+			DelayArrivalMin:   nullInt(row.DelayArrivalMin),
+			DelayDepartureMin: nullInt(row.DelayDepartureMin),
+			Departed:          row.Departed == 1,
+		}
+		stations = append(stations, stn)
+
+		// departure delay wins once the train has left the station
+		delay := stn.DelayArrivalMin
+		if stn.DelayDepartureMin != nil {
+			delay = stn.DelayDepartureMin
+		}
+		if delay != nil {
+			summary.CurrentDelayMin = delay
+			if summary.MaxDelayMin == nil || *delay > *summary.MaxDelayMin {
+				summary.MaxDelayMin = delay
+			}
+			delaySum += *delay
+			delayCount++
+		}
+	}
+	summary.Stations = len(stations)
+	if delayCount > 0 {
+		avg := float64(delaySum) / float64(delayCount)
+		summary.AvgDelayMin = &avg
+	}
+
+	respond(w, r, h.logger, "delays_"+runID+".csv", map[string]any{
+		"run_id":   runID,
+		"summary":  summary,
+		"stations": stations,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "sno", "station_code", "station_name", "distance_km", "sch_arrival", "act_arrival",
+			"sch_departure", "act_departure", "delay_arrival_min", "delay_departure_min", "departed",
+		}}
+		for _, s := range stations {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				strconv.FormatInt(s.Sno, 10),
+				s.StationCode,
+				csvString(s.StationName),
+				csvFloat(&s.DistanceKm),
+				csvString(s.SchArrival),
+				csvString(s.ActArrival),
+				csvString(s.SchDeparture),
+				csvString(s.ActDeparture),
+				csvInt(s.DelayArrivalMin),
+				csvInt(s.DelayDepartureMin),
+				strconv.FormatBool(s.Departed),
+			})
+		}
+		return table
+	})
+}
+
+// runIDParam builds the run id from the {train_no} and {run_date} path params,
+// answering 400 itself when they don't parse
+func (h *RunHandler) runIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	trainNo, err := strconv.ParseInt(chi.URLParam(r, "train_no"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid train_no", http.StatusBadRequest)
+		return "", false
+	}
+	runDate, err := time.ParseInLocation(time.DateOnly, chi.URLParam(r, "run_date"), h.loc)
+	if err != nil {
+		httpError(w, r, "invalid run_date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return "", false
+	}
+	return fmt.Sprintf("%d_%s", trainNo, runDate.Format(time.DateOnly)), true
+}
+
+// GET /v1/runs/{run_id}/eta
+func (h *RunHandler) GetRunETA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID := chi.URLParam(r, "run_id")
+
+	pred, err := h.predictor.PredictRun(ctx, runID)
+	if errors.Is(err, prediction.ErrRunNotFound) {
+		httpError(w, r, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: eta prediction failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "eta_"+runID+".csv", pred, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "station_code", "station_name", "distance_km", "stops", "scheduled_arrival", "predicted_arrival",
+			"earliest_arrival", "latest_arrival", "predicted_delay_min", "history_samples", "method",
+		}}
+		for _, s := range pred.Stations {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				s.StationCode,
+				s.StationName,
+				csvFloat(&s.DistanceKm),
+				strconv.FormatBool(s.Stops),
+				s.ScheduledArrival.Format(time.RFC3339),
+				s.PredictedArrival.Format(time.RFC3339),
+				s.EarliestArrival.Format(time.RFC3339),
+				s.LatestArrival.Format(time.RFC3339),
+				csvFloat(&s.PredictedDelayMin),
+				strconv.FormatInt(s.HistorySamples, 10),
+				s.Method,
+			})
+		}
+		return table
+	})
+}
+
+// GET /v1/runs/{train_no}/{run_date}/eta/{station_code}
+// Arrival prediction at one station ahead of the train, measured from its latest fix
+// when that is past the last station it reported
+func (h *RunHandler) GetRunStationETA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runID, ok := h.runIDParam(w, r)
+	if !ok {
+		return
+	}
+	stationCode := strings.ToUpper(chi.URLParam(r, "station_code"))
+
+	pred, err := h.predictor.PredictStation(ctx, runID, stationCode)
+	switch {
+	case errors.Is(err, prediction.ErrRunNotFound), errors.Is(err, prediction.ErrStationNotOnRoute):
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, prediction.ErrStationPassed):
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		logf(h.logger, r, "handler: eta prediction failed for %s at %s: %v", runID, stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, pred)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const maxBatchRuns = 100
+
+type BatchRunKey struct {
+	TrainNo int64  `json:"train_no"`
+	Date    string `json:"date"` // YYYY-MM-DD the run leaves its origin
+}
+
+// POST /v1/runs/batch {"runs": [{"train_no": 12817, "date": "2025-05-10"}, ...]}
+// The current state of up to maxBatchRuns runs in one go, for apps following a
+// list of saved trains. Runs come back in the order asked, runs that do not exist
+// are listed under not_found.
+func (h *RunHandler) BatchRunStatus(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Runs []BatchRunKey `json:"runs"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body.Runs) == 0 {
+		httpError(w, r, "runs is required", http.StatusBadRequest)
+		return
+	}
+	if len(body.Runs) > maxBatchRuns {
+		httpError(w, r, "at most "+strconv.Itoa(maxBatchRuns)+" runs", http.StatusBadRequest)
+		return
+	}
+
+	keys := make([]BatchRunKey, 0, len(body.Runs))
+	runIDs := make([]string, 0, len(body.Runs))
+	seen := make(map[string]bool, len(body.Runs))
+	for i, key := range body.Runs {
+		if key.TrainNo <= 0 {
+			httpError(w, r, fmt.Sprintf("runs[%d]: invalid train_no", i), http.StatusBadRequest)
+			return
+		}
+		date, err := time.ParseInLocation(time.DateOnly, key.Date, h.loc)
+		if err != nil {
+			httpError(w, r, fmt.Sprintf("runs[%d]: invalid date %q, expected YYYY-MM-DD", i, key.Date), http.StatusBadRequest)
+			return
+		}
+		runID := fmt.Sprintf("%d_%s", key.TrainNo, date.Format(time.DateOnly))
+		if seen[runID] {
+			continue
+		}
+		seen[runID] = true
+		keys = append(keys, BatchRunKey{TrainNo: key.TrainNo, Date: date.Format(time.DateOnly)})
+		runIDs = append(runIDs, runID)
+	}
+
+	rows, err := h.queries.ListRunsByIDs(r.Context(), runIDs)
+	if err != nil {
+		logf(h.logger, r, "handler: batch runs query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]RunSummary, len(rows))
+	for _, row := range rows {
+		byID[row.RunID] = batchRunSummary(row)
+	}
+
+	runs := make([]RunSummary, 0, len(rows))
+	notFound := []BatchRunKey{}
+	for i, runID := range runIDs {
+		if run, ok := byID[runID]; ok {
+			runs = append(runs, run)
+		} else {
+			notFound = append(notFound, keys[i])
+		}
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"total":     len(runs),
+		"runs":      runs,
+		"not_found": notFound,
+	})
+}
+
+func batchRunSummary(row db.ListRunsByIDsRow) RunSummary {
+	return RunSummary{
+		RunID:               row.RunID,
+		TrainNo:             row.TrainNo,
+		TrainName:           row.TrainName,
+		TrainType:           row.TrainType,
+		RunDate:             row.RunDate,
+		OriginStationCode:   row.OriginStationCode,
+		TerminusStationCode: row.TerminusStationCode,
+		HasStarted:          row.HasStarted == 1,
+		HasArrived:          row.HasArrived == 1,
+		Status:              statusString(row.CurrentStatus),
+		Lat:                 u6ToFloat(row.LatU6),
+		Lng:                 u6ToFloat(row.LngU6),
+		DistanceKm:          u4ToFloat(row.DistanceKmU4),
+		LastUpdate:          nullString(row.LastUpdateTimestampIso),
+		Anomaly:             nullString(row.Anomaly),
+		QualityScore:        nullInt(row.QualityScore),
+	}
+}
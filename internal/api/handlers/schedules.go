@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"trano/internal/iri"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	shapeSourceGeometry = "geometry"
+	shapeSourceStations = "stations"
+)
+
+type TimetableStop struct {
+	StationCode  string   `json:"station_code"`
+	StationName  string   `json:"station_name"`
+	DistanceKm   float64  `json:"distance_km"`
+	Halt         bool     `json:"halt"`          // false where the train only passes through
+	ArrivalMin   int64    `json:"arrival_min"`   // minutes after the origin departure
+	DepartureMin int64    `json:"departure_min"` // minutes after the origin departure
+	Arrival      string   `json:"arrival"`       // HH:MM local
+	Departure    string   `json:"departure"`     // HH:MM local
+	Day          int64    `json:"day"`           // 1 on the origin date
+	HaltMin      int64    `json:"halt_min"`
+	RunningDays  []string `json:"running_days"` // weekdays it departs this station
+}
+
+type TimetableSchedule struct {
+	ScheduleID          int64           `json:"schedule_id"`
+	OriginStationCode   string          `json:"origin_station_code"`
+	TerminusStationCode string          `json:"terminus_station_code"`
+	OriginDeparture     string          `json:"origin_departure"` // HH:MM local
+	TotalDistanceKm     float64         `json:"total_distance_km"`
+	TotalRuntimeMin     int64           `json:"total_runtime_min"`
+	RunningDays         []string        `json:"running_days"` // weekdays it leaves the origin
+	Stops               []TimetableStop `json:"stops"`
+}
+
+// clockMin formats minutes after midnight as HH:MM, wrapping past a day
+func clockMin(m int64) string {
+	m %= 1440
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
+
+// GET /v1/trains/{train_no}/timetable
+// Every schedule of the train with its stops in route order, as scraped from IRI
+func (h *TrainHandler) GetTrainTimetable(w http.ResponseWriter, r *http.Request) {
+	trainNo, err := strconv.ParseInt(chi.URLParam(r, "train_no"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid train_no", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.queries.ListTrainTimetable(r.Context(), trainNo)
+	if err != nil {
+		logf(h.logger, r, "handler: train %d timetable query failed: %v", trainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(rows) == 0 {
+		httpError(w, r, "train has no timetable", http.StatusNotFound)
+		return
+	}
+
+	schedules := []TimetableSchedule{}
+	for _, row := range rows {
+		if len(schedules) == 0 || schedules[len(schedules)-1].ScheduleID != row.ScheduleID {
+			schedules = append(schedules, TimetableSchedule{
+				ScheduleID:          row.ScheduleID,
+				OriginStationCode:   row.OriginStationCode,
+				TerminusStationCode: row.TerminusStationCode,
+				OriginDeparture:     clockMin(row.OriginSchDepartureMin),
+				TotalDistanceKm:     row.TotalDistanceKm,
+				TotalRuntimeMin:     row.TotalRuntimeMin,
+				RunningDays:         runningDaysFrom(row.RunningDaysBitmap, 0),
+				Stops:               []TimetableStop{},
+			})
+		}
+		sch := &schedules[len(schedules)-1]
+
+		arr := row.OriginSchDepartureMin + row.SchArrivalMinFromStart
+		dep := row.OriginSchDepartureMin + row.SchDepartureMinFromStart
+		sch.Stops = append(sch.Stops, TimetableStop{
+			StationCode:  row.StationCode,
+			StationName:  row.StationName,
+			DistanceKm:   row.DistanceKm,
+			Halt:         row.Stops == 1,
+			ArrivalMin:   row.SchArrivalMinFromStart,
+			DepartureMin: row.SchDepartureMinFromStart,
+			Arrival:      clockMin(arr),
+			Departure:    clockMin(dep),
+			Day:          arr/1440 + 1,
+			HaltMin:      row.SchDepartureMinFromStart - row.SchArrivalMinFromStart,
+			RunningDays:  runningDaysFrom(row.RunningDaysBitmap, dep/1440),
+		})
+	}
+
+	respond(w, r, h.logger, fmt.Sprintf("timetable_%d.csv", trainNo), map[string]any{
+		"train_no":   trainNo,
+		"train_name": rows[0].TrainName,
+		"train_type": rows[0].TrainType,
+		"schedules":  schedules,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"train_no", "schedule_id", "station_code", "station_name", "distance_km", "halt",
+			"arrival", "departure", "day", "halt_min", "running_days",
+		}}
+		for _, sch := range schedules {
+			for _, stop := range sch.Stops {
+				table.Rows = append(table.Rows, []string{
+					strconv.FormatInt(trainNo, 10),
+					strconv.FormatInt(sch.ScheduleID, 10),
+					stop.StationCode,
+					stop.StationName,
+					strconv.FormatFloat(stop.DistanceKm, 'f', -1, 64),
+					strconv.FormatBool(stop.Halt),
+					stop.Arrival,
+					stop.Departure,
+					strconv.FormatInt(stop.Day, 10),
+					strconv.FormatInt(stop.HaltMin, 10),
+					strings.Join(stop.RunningDays, " "),
+				})
+			}
+		}
+		return table
+	})
+}
+
+// GET /v1/trains/{train_no}/rake
+// The coaches of the train from the locomotive end, as last scraped from IRI
+func (h *TrainHandler) GetTrainRake(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	trainNo, err := strconv.ParseInt(chi.URLParam(r, "train_no"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid train_no", http.StatusBadRequest)
+		return
+	}
+
+	train, err := h.queries.GetTrainRake(ctx, trainNo)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpError(w, r, "train not found", http.StatusNotFound)
+			return
+		}
+		logf(h.logger, r, "handler: train %d rake query failed: %v", trainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.queries.ListTrainCoaches(ctx, trainNo)
+	if err != nil {
+		logf(h.logger, r, "handler: train %d coaches query failed: %v", trainNo, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	coaches := make([]iri.Coach, 0, len(rows))
+	for _, row := range rows {
+		coaches = append(coaches, iri.Coach{
+			Position: int(row.Position),
+			Code:     row.CoachCode,
+			Class:    row.Class.String,
+			Kind:     row.Kind,
+		})
+	}
+	// trains not synced since coaches were stored are parsed on the fly
+	if len(coaches) == 0 {
+		coaches = iri.ParseRake(train.Coachcomposition.String)
+	}
+	if len(coaches) == 0 {
+		httpError(w, r, "train has no coach composition", http.StatusNotFound)
+		return
+	}
+
+	classes := map[string]int{}
+	for _, c := range coaches {
+		if c.Class != "" {
+			classes[c.Class]++
+		}
+	}
+
+	respond(w, r, h.logger, fmt.Sprintf("rake_%d.csv", trainNo), map[string]any{
+		"train_no":    trainNo,
+		"train_name":  train.TrainName,
+		"train_type":  train.TrainType,
+		"composition": train.Coachcomposition.String,
+		"updated_at":  nullString(train.UpdatedAt),
+		"length":      len(coaches),
+		"classes":     classes,
+		"coaches":     coaches,
+	}, func() csvTable {
+		table := csvTable{Header: []string{"train_no", "position", "code", "class", "kind"}}
+		for _, c := range coaches {
+			table.Rows = append(table.Rows, []string{
+				strconv.FormatInt(trainNo, 10),
+				strconv.Itoa(c.Position),
+				c.Code,
+				c.Class,
+				c.Kind,
+			})
+		}
+		return table
+	})
+}
+
+// GET /v1/schedules/{schedule_id}/shape
+// The line the poller snaps fixes onto as an encoded polyline, or the stations joined
+// up when the schedule has no geometry. format=geojson gives a LineString feature.
+func (h *TrainHandler) GetScheduleShape(w http.ResponseWriter, r *http.Request) {
+	scheduleID, err := strconv.ParseInt(chi.URLParam(r, "schedule_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	shape, err := h.queries.GetScheduleShape(r.Context(), scheduleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpError(w, r, "schedule not found", http.StatusNotFound)
+			return
+		}
+		logf(h.logger, r, "handler: schedule %d shape query failed: %v", scheduleID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	source := shapeSourceGeometry
+	var coords [][2]float64
+	if shape.Geojson.Valid {
+		var geom struct {
+			Type        string       `json:"type"`
+			Coordinates [][2]float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal([]byte(shape.Geojson.String), &geom); err != nil || geom.Type != "LineString" {
+			logf(h.logger, r, "handler: schedule %d geometry is not a linestring: %v", scheduleID, err)
+		} else {
+			coords = geom.Coordinates
+		}
+	}
+	if len(coords) < 2 {
+		route, err := h.queries.ListScheduleRoute(r.Context(), scheduleID)
+		if err != nil {
+			logf(h.logger, r, "handler: schedule %d route query failed: %v", scheduleID, err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		source, coords = shapeSourceStations, nil
+		for _, stop := range route {
+			if stop.Lat.Valid && stop.Lng.Valid {
+				coords = append(coords, [2]float64{stop.Lng.Float64, stop.Lat.Float64})
+			}
+		}
+	}
+	if len(coords) < 2 {
+		httpError(w, r, "schedule has no shape", http.StatusNotFound)
+		return
+	}
+
+	// geometries only change with a new schedule
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+
+	if wantsGeoJSON(r) {
+		fc := newFeatureCollection(1)
+		fc.addLineString(coords, map[string]any{
+			"schedule_id": shape.ScheduleID,
+			"train_no":    shape.TrainNo,
+			"source":      source,
+		})
+		writeGeoJSON(w, h.logger, fc)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"schedule_id": shape.ScheduleID,
+		"train_no":    shape.TrainNo,
+		"source":      source,
+		"points":      len(coords),
+		"polyline":    encodePolyline(coords),
+	})
+}
+
+// encodePolyline writes [lng, lat] positions in the Google encoded polyline format,
+// lat first at 5 decimals as every decoder expects
+func encodePolyline(coords [][2]float64) string {
+	var b strings.Builder
+	var prevLat, prevLng int64
+	for _, c := range coords {
+		lat, lng := int64(math.Round(c[1]*1e5)), int64(math.Round(c[0]*1e5))
+		writePolylineValue(&b, lat-prevLat)
+		writePolylineValue(&b, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return b.String()
+}
+
+func writePolylineValue(b *strings.Builder, v int64) {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte(0x20|(u&0x1f)) + 63)
+		u >>= 5
+	}
+	b.WriteByte(byte(u) + 63)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	db "trano/internal/db/sqlc"
+)
+
+type SectionEnd struct {
+	StationCode string   `json:"station_code"`
+	StationName string   `json:"station_name"`
+	Lat         *float64 `json:"lat"`
+	Lng         *float64 `json:"lng"`
+}
+
+type SectionOccupancy struct {
+	From       SectionEnd `json:"from"`
+	To         SectionEnd `json:"to"`
+	Trains     int64      `json:"trains"`
+	TrainsFwd  int64      `json:"trains_from_to"`
+	TrainsBack int64      `json:"trains_to_from"`
+	TrainNos   []int64    `json:"train_nos"`
+}
+
+// GET /v1/sections/occupancy?min_trains=2&limit=100
+// Sections are adjacent stations of each run's route, so the picture is coarse where
+// schedules skip different stations on the same track
+func (h *AnalyticsHandler) ListSectionOccupancy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	minTrains := queryInt(r, "min_trains", 1, 1, 1000)
+	limit := queryInt(r, "limit", 100, 1, 5000)
+
+	rows, err := h.queries.ListSectionOccupancy(ctx, db.ListSectionOccupancyParams{
+		MinTrains: int64(minTrains),
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: section occupancy query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sections := make([]SectionOccupancy, 0, len(rows))
+	for _, row := range rows {
+		s := SectionOccupancy{
+			From: SectionEnd{
+				StationCode: row.StationA,
+				StationName: row.StationAName,
+				Lat:         nullFloat(row.StationALat),
+				Lng:         nullFloat(row.StationALng),
+			},
+			To: SectionEnd{
+				StationCode: row.StationB,
+				StationName: row.StationBName,
+				Lat:         nullFloat(row.StationBLat),
+				Lng:         nullFloat(row.StationBLng),
+			},
+			Trains:     row.Trains,
+			TrainsFwd:  row.TrainsAToB,
+			TrainsBack: row.Trains - row.TrainsAToB,
+			TrainNos:   []int64{},
+		}
+		for _, no := range strings.Split(row.TrainNos, ",") {
+			if n, err := strconv.ParseInt(no, 10, 64); err == nil {
+				s.TrainNos = append(s.TrainNos, n)
+			}
+		}
+		sections = append(sections, s)
+	}
+
+	respond(w, r, h.logger, "section_occupancy.csv", map[string]any{
+		"total":    len(sections),
+		"sections": sections,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"from_station_code", "to_station_code", "trains", "trains_from_to", "trains_to_from", "train_nos",
+		}}
+		for _, s := range sections {
+			nos := make([]string, 0, len(s.TrainNos))
+			for _, n := range s.TrainNos {
+				nos = append(nos, strconv.FormatInt(n, 10))
+			}
+			table.Rows = append(table.Rows, []string{
+				s.From.StationCode,
+				s.To.StationCode,
+				strconv.FormatInt(s.Trains, 10),
+				strconv.FormatInt(s.TrainsFwd, 10),
+				strconv.FormatInt(s.TrainsBack, 10),
+				strings.Join(nos, " "),
+			})
+		}
+		return table
+	})
+}
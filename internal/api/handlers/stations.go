@@ -0,0 +1,518 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	dbtypes "trano/internal/db"
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type StationHandler struct {
+	queries *db.Queries
+	db      *sql.DB
+	logger  *log.Logger
+	loc     *time.Location
+}
+
+func NewStationHandler(queries *db.Queries, dbConn *sql.DB, logger *log.Logger, loc *time.Location) *StationHandler {
+	return &StationHandler{
+		queries: queries,
+		db:      dbConn,
+		logger:  logger,
+		loc:     loc,
+	}
+}
+
+type BoardEntry struct {
+	RunID               string  `json:"run_id"`
+	TrainNo             int64   `json:"train_no"`
+	TrainName           string  `json:"train_name"`
+	TrainType           string  `json:"train_type"`
+	OriginStationCode   string  `json:"origin_station_code"`
+	TerminusStationCode string  `json:"terminus_station_code"`
+	SchArrival          string  `json:"sch_arrival"`
+	SchDeparture        string  `json:"sch_departure"`
+	DistanceKm          float64 `json:"distance_km"`
+	HasStarted          bool    `json:"has_started"`
+	HasArrived          bool    `json:"has_arrived"`
+	Status              string  `json:"status"`
+	StationPlatform
+}
+
+// StationPlatform is where a run calls at the station, as published and as riders
+// reported it; both stay empty until upstream has something
+type StationPlatform struct {
+	Platform     *string                 `json:"platform"`
+	PlatformInfo []dbtypes.PlatformShare `json:"platform_info"`
+}
+
+func stationPlatform(platform, info sql.NullString) StationPlatform {
+	p := StationPlatform{Platform: nullString(platform)}
+	if info.Valid {
+		// written by the poller, a row that does not decode just has no shares
+		_ = json.Unmarshal([]byte(info.String), &p.PlatformInfo)
+	}
+	return p
+}
+
+// GET /v1/stations/{station_code}/board?date=YYYY-MM-DD
+// GET /v1/stations/{station_code}/board?window=2h for the live board
+func (h *StationHandler) GetStationBoard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stationCode := strings.ToUpper(chi.URLParam(r, "station_code"))
+
+	if r.URL.Query().Has("window") {
+		h.getLiveBoard(w, r, stationCode)
+		return
+	}
+
+	boardDate, err := parseDateParam(r, "date", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.queries.GetStationBoard(ctx, db.GetStationBoardParams{
+		StationCode: stationCode,
+		BoardDate:   boardDate,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: station board query failed for %s: %v", stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]BoardEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, BoardEntry{
+			RunID:               row.RunID,
+			TrainNo:             row.TrainNo,
+			TrainName:           row.TrainName,
+			TrainType:           row.TrainType,
+			OriginStationCode:   row.OriginStationCode,
+			TerminusStationCode: row.TerminusStationCode,
+			SchArrival:          row.SchArrival,
+			SchDeparture:        row.SchDeparture,
+			DistanceKm:          row.DistanceKm,
+			HasStarted:          row.HasStarted == 1,
+			HasArrived:          row.HasArrived == 1,
+			Status:              statusString(row.CurrentStatus),
+			StationPlatform:     stationPlatform(row.Platform, row.PlatformInfo),
+		})
+	}
+
+	respond(w, r, h.logger, "board_"+stationCode+"_"+boardDate+".csv", map[string]any{
+		"station_code": stationCode,
+		"date":         boardDate,
+		"total":        len(entries),
+		"trains":       entries,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "run_id", "train_no", "train_name", "train_type", "origin", "terminus",
+			"sch_arrival", "sch_departure", "distance_km", "has_started", "has_arrived", "status", "platform",
+		}}
+		for _, e := range entries {
+			table.Rows = append(table.Rows, []string{
+				stationCode,
+				e.RunID,
+				strconv.FormatInt(e.TrainNo, 10),
+				e.TrainName,
+				e.TrainType,
+				e.OriginStationCode,
+				e.TerminusStationCode,
+				e.SchArrival,
+				e.SchDeparture,
+				strconv.FormatFloat(e.DistanceKm, 'f', -1, 64),
+				strconv.FormatBool(e.HasStarted),
+				strconv.FormatBool(e.HasArrived),
+				e.Status,
+				csvString(e.Platform),
+			})
+		}
+		return table
+	})
+}
+
+const (
+	boardMaxWindow = 12 * time.Hour
+	// trains scheduled this long before now may still be due, running late
+	boardLookback = 6 * time.Hour
+)
+
+type LiveBoardEntry struct {
+	RunID               string `json:"run_id"`
+	TrainNo             int64  `json:"train_no"`
+	TrainName           string `json:"train_name"`
+	TrainType           string `json:"train_type"`
+	OriginStationCode   string `json:"origin_station_code"`
+	TerminusStationCode string `json:"terminus_station_code"`
+	Kind                string `json:"kind"` // "departure" at the origin, "arrival" at the terminus, else "through"
+	SchArrival          string `json:"sch_arrival"`
+	SchDeparture        string `json:"sch_departure"`
+	ExpArrival          string `json:"exp_arrival"`
+	ExpDeparture        string `json:"exp_departure"`
+	DelayMin            *int64 `json:"delay_min"` // nil until the run reports a delay
+	Arrived             bool   `json:"arrived"`   // actual arrival recorded here
+	HasStarted          bool   `json:"has_started"`
+	Status              string `json:"status"`
+	StationPlatform
+}
+
+// getLiveBoard lists trains expected at the station between now and now+window,
+// actual times where recorded and otherwise the schedule shifted by the run's latest delay
+func (h *StationHandler) getLiveBoard(w http.ResponseWriter, r *http.Request, stationCode string) {
+	ctx := r.Context()
+
+	window, err := time.ParseDuration(r.URL.Query().Get("window"))
+	if err != nil || window <= 0 {
+		httpError(w, r, "invalid window, expected a duration such as 2h or 90m", http.StatusBadRequest)
+		return
+	}
+	window = min(window, boardMaxWindow)
+
+	now := time.Now().In(h.loc)
+	until := now.Add(window)
+
+	rows, err := h.queries.GetStationLiveBoard(ctx, db.GetStationLiveBoardParams{
+		StationCode: stationCode,
+		FromTime:    now.Add(-boardLookback).Format(time.DateTime),
+		ToTime:      until.Format(time.DateTime),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: live board query failed for %s: %v", stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	entries := h.liveBoardEntries(rows, stationCode, now, until)
+
+	respond(w, r, h.logger, "board_"+stationCode+"_live.csv", map[string]any{
+		"station_code": stationCode,
+		"from":         now.Format(time.RFC3339),
+		"until":        until.Format(time.RFC3339),
+		"total":        len(entries),
+		"trains":       entries,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "run_id", "train_no", "train_name", "train_type", "origin", "terminus", "kind",
+			"sch_arrival", "sch_departure", "exp_arrival", "exp_departure", "delay_min", "arrived", "has_started", "status", "platform",
+		}}
+		for _, e := range entries {
+			table.Rows = append(table.Rows, []string{
+				stationCode,
+				e.RunID,
+				strconv.FormatInt(e.TrainNo, 10),
+				e.TrainName,
+				e.TrainType,
+				e.OriginStationCode,
+				e.TerminusStationCode,
+				e.Kind,
+				e.SchArrival,
+				e.SchDeparture,
+				e.ExpArrival,
+				e.ExpDeparture,
+				csvInt(e.DelayMin),
+				strconv.FormatBool(e.Arrived),
+				strconv.FormatBool(e.HasStarted),
+				e.Status,
+				csvString(e.Platform),
+			})
+		}
+		return table
+	})
+}
+
+// liveBoardEntries turns the live board rows of a station into the trains still due
+// there between now and until, by expected departure
+func (h *StationHandler) liveBoardEntries(rows []db.GetStationLiveBoardRow, stationCode string, now, until time.Time) []LiveBoardEntry {
+	entries := make([]LiveBoardEntry, 0, len(rows))
+	expected := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		if row.HasArrived == 1 {
+			continue
+		}
+		schArr, err1 := time.ParseInLocation(time.DateTime, row.SchArrival, h.loc)
+		schDep, err2 := time.ParseInLocation(time.DateTime, row.SchDeparture, h.loc)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		var delay time.Duration
+		if row.CurrentDelayMin.Valid {
+			delay = time.Duration(row.CurrentDelayMin.Int64) * time.Minute
+		}
+
+		expArr := schArr.Add(delay)
+		if row.ActArrivalTm.Valid {
+			expArr = time.Unix(row.ActArrivalTm.Int64, 0).In(h.loc)
+		}
+		expDep := schDep.Add(delay)
+		if row.Departed == 1 && row.ActDepartureTm.Valid {
+			expDep = time.Unix(row.ActDepartureTm.Int64, 0).In(h.loc)
+		} else if expDep.Before(expArr) {
+			// arrived late, it still needs its scheduled halt
+			expDep = expArr.Add(schDep.Sub(schArr))
+		}
+
+		// already gone, or not due within the window
+		if expDep.Before(now) || expArr.After(until) {
+			continue
+		}
+
+		kind := "through"
+		switch stationCode {
+		case row.OriginStationCode:
+			kind = "departure"
+		case row.TerminusStationCode:
+			kind = "arrival"
+		}
+
+		var delayMin *int64
+		if row.CurrentDelayMin.Valid || row.ActArrivalTm.Valid {
+			ref, sch := expDep, schDep
+			if kind == "arrival" {
+				ref, sch = expArr, schArr
+			}
+			d := int64(ref.Sub(sch).Round(time.Minute) / time.Minute)
+			delayMin = &d
+		}
+
+		entries = append(entries, LiveBoardEntry{
+			RunID:               row.RunID,
+			TrainNo:             row.TrainNo,
+			TrainName:           row.TrainName,
+			TrainType:           row.TrainType,
+			OriginStationCode:   row.OriginStationCode,
+			TerminusStationCode: row.TerminusStationCode,
+			Kind:                kind,
+			SchArrival:          schArr.Format(time.RFC3339),
+			SchDeparture:        schDep.Format(time.RFC3339),
+			ExpArrival:          expArr.Format(time.RFC3339),
+			ExpDeparture:        expDep.Format(time.RFC3339),
+			DelayMin:            delayMin,
+			Arrived:             row.ActArrivalTm.Valid,
+			HasStarted:          row.HasStarted == 1,
+			Status:              statusString(row.CurrentStatus),
+			StationPlatform:     stationPlatform(row.Platform, row.PlatformInfo),
+		})
+		expected[row.RunID] = expDep
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return expected[entries[i].RunID].Before(expected[entries[j].RunID])
+	})
+	return entries
+}
+
+type AtStationEntry struct {
+	RunID               string  `json:"run_id"`
+	TrainNo             int64   `json:"train_no"`
+	TrainName           string  `json:"train_name"`
+	TrainType           string  `json:"train_type"`
+	OriginStationCode   string  `json:"origin_station_code"`
+	TerminusStationCode string  `json:"terminus_station_code"`
+	SchArrival          *string `json:"sch_arrival"`   // nil when the station is not on the run's route
+	SchDeparture        *string `json:"sch_departure"` // nil there and at the terminus
+	Arrival             string  `json:"arrival"`       // actual arrival, else the first fix at the station
+	ExpDeparture        *string `json:"exp_departure"`
+	DelayMin            *int64  `json:"delay_min"`
+	Status              string  `json:"status"`
+}
+
+// GET /v1/stations/{station_code}/live
+// Trains standing at the station now, by their latest fix, for platform displays.
+// The expected departure is the schedule shifted by the run's delay but no earlier
+// than its scheduled halt after arriving, and no earlier than now while it still stands.
+func (h *StationHandler) ListTrainsAtStation(w http.ResponseWriter, r *http.Request) {
+	stationCode := strings.ToUpper(chi.URLParam(r, "station_code"))
+
+	rows, err := h.queries.ListTrainsAtStation(r.Context(), stationCode)
+	if err != nil {
+		logf(h.logger, r, "handler: trains at station query failed for %s: %v", stationCode, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(h.loc)
+	entries := make([]AtStationEntry, 0, len(rows))
+	for _, row := range rows {
+		arrival, err := time.Parse(time.RFC3339, row.FirstSeenAt)
+		if err != nil {
+			continue
+		}
+		if row.ActArrivalTm.Valid {
+			arrival = time.Unix(row.ActArrivalTm.Int64, 0)
+		}
+		arrival = arrival.In(h.loc)
+
+		e := AtStationEntry{
+			RunID:               row.RunID,
+			TrainNo:             row.TrainNo,
+			TrainName:           row.TrainName,
+			TrainType:           row.TrainType,
+			OriginStationCode:   row.OriginStationCode,
+			TerminusStationCode: row.TerminusStationCode,
+			Arrival:             arrival.Format(time.RFC3339),
+			DelayMin:            nullInt(row.CurrentDelayMin),
+			Status:              row.CurrentStatus,
+		}
+
+		schArr, err1 := time.ParseInLocation(time.DateTime, row.SchArrival.String, h.loc)
+		schDep, err2 := time.ParseInLocation(time.DateTime, row.SchDeparture.String, h.loc)
+		if row.SchArrival.Valid && err1 == nil {
+			v := schArr.Format(time.RFC3339)
+			e.SchArrival = &v
+		}
+		if row.SchDeparture.Valid && err2 == nil && stationCode != row.TerminusStationCode {
+			v := schDep.Format(time.RFC3339)
+			e.SchDeparture = &v
+
+			var delay time.Duration
+			if row.CurrentDelayMin.Valid {
+				delay = time.Duration(row.CurrentDelayMin.Int64) * time.Minute
+			}
+			expDep := schDep.Add(delay)
+			if err1 == nil {
+				expDep = later(expDep, arrival.Add(schDep.Sub(schArr)))
+			}
+			exp := later(expDep, now).Format(time.RFC3339)
+			e.ExpDeparture = &exp
+		}
+		entries = append(entries, e)
+	}
+
+	respond(w, r, h.logger, "at_station_"+stationCode+".csv", map[string]any{
+		"station_code": stationCode,
+		"timestamp":    now.Format(time.RFC3339),
+		"total":        len(entries),
+		"trains":       entries,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "run_id", "train_no", "train_name", "train_type", "origin", "terminus",
+			"sch_arrival", "sch_departure", "arrival", "exp_departure", "delay_min", "status",
+		}}
+		for _, e := range entries {
+			table.Rows = append(table.Rows, []string{
+				stationCode,
+				e.RunID,
+				strconv.FormatInt(e.TrainNo, 10),
+				e.TrainName,
+				e.TrainType,
+				e.OriginStationCode,
+				e.TerminusStationCode,
+				csvString(e.SchArrival),
+				csvString(e.SchDeparture),
+				e.Arrival,
+				csvString(e.ExpDeparture),
+				csvInt(e.DelayMin),
+				e.Status,
+			})
+		}
+		return table
+	})
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+type StationMatch struct {
+	StationCode string   `json:"station_code"`
+	StationName string   `json:"station_name"`
+	Zone        *string  `json:"zone"`
+	Division    *string  `json:"division"`
+	Address     *string  `json:"address"`
+	Lat         *float64 `json:"lat"`
+	Lng         *float64 `json:"lng"`
+	StationType *string  `json:"station_type"`
+	Rank        float64  `json:"rank"` // bm25, lower is better
+}
+
+// stationMatchExpr turns free text into an FTS5 expression where every word must
+// prefix-match, quoting each so user input cannot inject FTS syntax
+func stationMatchExpr(q string) string {
+	words := strings.FieldsFunc(q, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		terms = append(terms, `"`+w+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// GET /v1/stations/search?q=&limit=
+func (h *StationHandler) SearchStations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	limit := queryInt(r, "limit", 20, 1, 100)
+
+	match := stationMatchExpr(q)
+	if match == "" {
+		httpError(w, r, "q must contain at least one letter or digit", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.queries.SearchStations(ctx, db.SearchStationsParams{
+		Match:       match,
+		StationCode: strings.ToUpper(q),
+		Limit:       int64(limit),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: station search failed for %q: %v", q, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	matches := make([]StationMatch, 0, len(rows))
+	for _, row := range rows {
+		matches = append(matches, StationMatch{
+			StationCode: row.StationCode,
+			StationName: row.StationName,
+			Zone:        nullString(row.Zone),
+			Division:    nullString(row.Division),
+			Address:     nullString(row.Address),
+			Lat:         nullFloat(row.Lat),
+			Lng:         nullFloat(row.Lng),
+			StationType: nullString(row.StationType),
+			Rank:        row.Rank,
+		})
+	}
+
+	respond(w, r, h.logger, "station_search.csv", map[string]any{
+		"q":        q,
+		"total":    len(matches),
+		"stations": matches,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"station_code", "station_name", "zone", "division", "address", "lat", "lng", "station_type", "rank",
+		}}
+		for _, m := range matches {
+			table.Rows = append(table.Rows, []string{
+				m.StationCode,
+				m.StationName,
+				csvString(m.Zone),
+				csvString(m.Division),
+				csvString(m.Address),
+				csvFloat(m.Lat),
+				csvFloat(m.Lng),
+				csvString(m.StationType),
+				strconv.FormatFloat(m.Rank, 'f', -1, 64),
+			})
+		}
+		return table
+	})
+}
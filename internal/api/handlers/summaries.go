@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	levelTrain   = "train"
+	levelStation = "station"
+	levelZone    = "zone"
+)
+
+type DailyTrainSummary struct {
+	TrainNo             int64    `json:"train_no"`
+	TrainName           string   `json:"train_name"`
+	TrainType           string   `json:"train_type"`
+	Runs                int64    `json:"runs"`
+	CompletedRuns       int64    `json:"completed_runs"`
+	CancelledRuns       int64    `json:"cancelled_runs"`
+	TrackedRuns         int64    `json:"tracked_runs"`
+	OnTimeRuns          int64    `json:"on_time_runs"`
+	AvgDelayMin         *float64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin *float64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64  `json:"coverage_pct"`
+}
+
+type DailyStationSummary struct {
+	StationCode  string   `json:"station_code"`
+	StationName  string   `json:"station_name"`
+	Trains       int64    `json:"trains"`
+	OnTimeTrains int64    `json:"on_time_trains"`
+	AvgDelayMin  *float64 `json:"avg_delay_min"`
+	MaxDelayMin  *int64   `json:"max_delay_min"`
+}
+
+type DailyZoneSummary struct {
+	Zone                string   `json:"zone"`
+	Trains              int64    `json:"trains"`
+	Runs                int64    `json:"runs"`
+	CompletedRuns       int64    `json:"completed_runs"`
+	CancelledRuns       int64    `json:"cancelled_runs"`
+	TrackedRuns         int64    `json:"tracked_runs"`
+	OnTimeRuns          int64    `json:"on_time_runs"`
+	AvgDelayMin         *float64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin *float64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64  `json:"coverage_pct"`
+}
+
+// GET /v1/reports/daily?date=YYYY-MM-DD&level=zone|train|station
+// Served from the nightly summary tables, date defaults to yesterday (the latest closed day)
+func (h *AnalyticsHandler) GetDailySummary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	date := time.Now().In(h.loc).AddDate(0, 0, -1).Format(time.DateOnly)
+	if r.URL.Query().Get("date") != "" {
+		var err error
+		if date, err = parseDateParam(r, "date", h.loc); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	level := r.URL.Query().Get("level")
+	if level == "" {
+		level = levelZone
+	}
+
+	var (
+		items any
+		table csvTable
+		count int
+	)
+
+	switch level {
+	case levelTrain:
+		rows, err := h.queries.ListDailyTrainSummaries(ctx, date)
+		if err != nil {
+			logf(h.logger, r, "handler: daily train summaries query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		trains := make([]DailyTrainSummary, 0, len(rows))
+		table.Header = []string{
+			"date", "train_no", "train_name", "train_type", "runs", "completed_runs", "cancelled_runs",
+			"tracked_runs", "on_time_runs", "avg_delay_min", "avg_terminal_delay_min", "coverage_pct",
+		}
+		for _, row := range rows {
+			t := DailyTrainSummary{
+				TrainNo:             row.TrainNo,
+				TrainName:           row.TrainName,
+				TrainType:           row.TrainType,
+				Runs:                row.Runs,
+				CompletedRuns:       row.CompletedRuns,
+				CancelledRuns:       row.CancelledRuns,
+				TrackedRuns:         row.TrackedRuns,
+				OnTimeRuns:          row.OnTimeRuns,
+				AvgDelayMin:         nullFloat(row.AvgDelayMin),
+				AvgTerminalDelayMin: nullFloat(row.AvgTerminalDelayMin),
+				CoveragePct:         row.CoveragePct,
+			}
+			trains = append(trains, t)
+			table.Rows = append(table.Rows, []string{
+				date,
+				strconv.FormatInt(t.TrainNo, 10),
+				t.TrainName,
+				t.TrainType,
+				strconv.FormatInt(t.Runs, 10),
+				strconv.FormatInt(t.CompletedRuns, 10),
+				strconv.FormatInt(t.CancelledRuns, 10),
+				strconv.FormatInt(t.TrackedRuns, 10),
+				strconv.FormatInt(t.OnTimeRuns, 10),
+				csvFloat(t.AvgDelayMin),
+				csvFloat(t.AvgTerminalDelayMin),
+				csvFloat(&t.CoveragePct),
+			})
+		}
+		items, count = trains, len(trains)
+
+	case levelStation:
+		rows, err := h.queries.ListDailyStationSummaries(ctx, date)
+		if err != nil {
+			logf(h.logger, r, "handler: daily station summaries query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		stations := make([]DailyStationSummary, 0, len(rows))
+		table.Header = []string{
+			"date", "station_code", "station_name", "trains", "on_time_trains", "avg_delay_min", "max_delay_min",
+		}
+		for _, row := range rows {
+			s := DailyStationSummary{
+				StationCode:  row.StationCode,
+				StationName:  row.StationName,
+				Trains:       row.Trains,
+				OnTimeTrains: row.OnTimeTrains,
+				AvgDelayMin:  nullFloat(row.AvgDelayMin),
+				MaxDelayMin:  nullInt(row.MaxDelayMin),
+			}
+			stations = append(stations, s)
+			table.Rows = append(table.Rows, []string{
+				date,
+				s.StationCode,
+				s.StationName,
+				strconv.FormatInt(s.Trains, 10),
+				strconv.FormatInt(s.OnTimeTrains, 10),
+				csvFloat(s.AvgDelayMin),
+				csvInt(s.MaxDelayMin),
+			})
+		}
+		items, count = stations, len(stations)
+
+	case levelZone:
+		rows, err := h.queries.ListDailyZoneSummaries(ctx, date)
+		if err != nil {
+			logf(h.logger, r, "handler: daily zone summaries query failed: %v", err)
+			httpError(w, r, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		zones := make([]DailyZoneSummary, 0, len(rows))
+		table.Header = []string{
+			"date", "zone", "trains", "runs", "completed_runs", "cancelled_runs", "tracked_runs",
+			"on_time_runs", "avg_delay_min", "avg_terminal_delay_min", "coverage_pct",
+		}
+		for _, row := range rows {
+			z := DailyZoneSummary{
+				Zone:                row.Zone,
+				Trains:              row.Trains,
+				Runs:                row.Runs,
+				CompletedRuns:       row.CompletedRuns,
+				CancelledRuns:       row.CancelledRuns,
+				TrackedRuns:         row.TrackedRuns,
+				OnTimeRuns:          row.OnTimeRuns,
+				AvgDelayMin:         nullFloat(row.AvgDelayMin),
+				AvgTerminalDelayMin: nullFloat(row.AvgTerminalDelayMin),
+				CoveragePct:         row.CoveragePct,
+			}
+			zones = append(zones, z)
+			table.Rows = append(table.Rows, []string{
+				date,
+				z.Zone,
+				strconv.FormatInt(z.Trains, 10),
+				strconv.FormatInt(z.Runs, 10),
+				strconv.FormatInt(z.CompletedRuns, 10),
+				strconv.FormatInt(z.CancelledRuns, 10),
+				strconv.FormatInt(z.TrackedRuns, 10),
+				strconv.FormatInt(z.OnTimeRuns, 10),
+				csvFloat(z.AvgDelayMin),
+				csvFloat(z.AvgTerminalDelayMin),
+				csvFloat(&z.CoveragePct),
+			})
+		}
+		items, count = zones, len(zones)
+
+	default:
+		httpError(w, r, "invalid level, expected zone, train or station", http.StatusBadRequest)
+		return
+	}
+
+	respond(w, r, h.logger, "daily_"+level+"_"+date+".csv", map[string]any{
+		"date":  date,
+		"level": level,
+		"total": count,
+		"items": items,
+	}, func() csvTable {
+		return table
+	})
+}
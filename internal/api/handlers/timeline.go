@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	stopDeparted = "departed"
+	stopArrived  = "arrived"
+	stopPending  = "pending"
+)
+
+type TimelineStop struct {
+	StationCode       string  `json:"station_code"`
+	StationName       string  `json:"station_name"`
+	DistanceKm        float64 `json:"distance_km"`
+	Halt              bool    `json:"halt"` // false where the train only passes through
+	SchArrival        string  `json:"sch_arrival"`
+	ActArrival        *string `json:"act_arrival"`
+	DelayArrivalMin   *int64  `json:"delay_arrival_min"`
+	SchDeparture      string  `json:"sch_departure"`
+	ActDeparture      *string `json:"act_departure"`
+	DelayDepartureMin *int64  `json:"delay_departure_min"`
+	State             string  `json:"state"` // departed, arrived or pending
+}
+
+// GET /v1/runs/{train_no}/{run_date}/timeline
+// Every stop of the run in route order, timetable against the actuals recorded so far.
+// Stops the train has not reached yet only carry the timetable.
+func (h *RunHandler) GetRunTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	runID, ok := h.runIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	run, err := h.queries.GetRunPredictionContext(ctx, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, r, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(h.logger, r, "handler: run context query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	route, err := h.queries.ListScheduleRoute(ctx, run.ScheduleID)
+	if err != nil {
+		logf(h.logger, r, "handler: schedule route query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := h.queries.ListRunStationEvents(ctx, runID)
+	if err != nil {
+		logf(h.logger, r, "handler: run delays query failed for %s: %v", runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	// a run has at most one event per station
+	type actual struct {
+		arr, dep           *string
+		arrDelay, depDelay *int64
+		departed           bool
+	}
+	actuals := make(map[string]actual, len(events))
+	for _, e := range events {
+		actuals[e.StationCode] = actual{
+			arr:      unixToTime(e.ActArrivalTm, h.loc),
+			dep:      unixToTime(e.ActDepartureTm, h.loc),
+			arrDelay: nullInt(e.DelayArrivalMin),
+			depDelay: nullInt(e.DelayDepartureMin),
+			departed: e.Departed == 1,
+		}
+	}
+
+	runDate, err := time.ParseInLocation(time.DateOnly, run.RunDate, h.loc)
+	if err != nil {
+		logf(h.logger, r, "handler: bad run date %q for %s: %v", run.RunDate, runID, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	originDeparture := runDate.Add(time.Duration(run.OriginSchDepartureMin) * time.Minute)
+	stops := make([]TimelineStop, 0, len(route))
+	for _, stn := range route {
+		stop := TimelineStop{
+			StationCode:  stn.StationCode,
+			StationName:  stn.StationName,
+			DistanceKm:   stn.DistanceKm,
+			Halt:         stn.Stops == 1,
+			SchArrival:   originDeparture.Add(time.Duration(stn.SchArrivalMinFromStart) * time.Minute).Format(time.RFC3339),
+			SchDeparture: originDeparture.Add(time.Duration(stn.SchDepartureMinFromStart) * time.Minute).Format(time.RFC3339),
+			State:        stopPending,
+		}
+		if a, ok := actuals[stn.StationCode]; ok {
+			stop.ActArrival, stop.DelayArrivalMin = a.arr, a.arrDelay
+			stop.ActDeparture, stop.DelayDepartureMin = a.dep, a.depDelay
+			stop.State = stopArrived
+			if a.departed {
+				stop.State = stopDeparted
+			}
+		}
+		stops = append(stops, stop)
+	}
+
+	respond(w, r, h.logger, "timeline_"+runID+".csv", map[string]any{
+		"run_id":      runID,
+		"train_no":    run.TrainNo,
+		"run_date":    run.RunDate,
+		"has_started": run.HasStarted == 1,
+		"has_arrived": run.HasArrived == 1,
+		"stops":       stops,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"run_id", "station_code", "station_name", "distance_km", "halt", "sch_arrival", "act_arrival",
+			"delay_arrival_min", "sch_departure", "act_departure", "delay_departure_min", "state",
+		}}
+		for _, s := range stops {
+			table.Rows = append(table.Rows, []string{
+				runID,
+				s.StationCode,
+				s.StationName,
+				strconv.FormatFloat(s.DistanceKm, 'f', -1, 64),
+				strconv.FormatBool(s.Halt),
+				s.SchArrival,
+				csvString(s.ActArrival),
+				csvInt(s.DelayArrivalMin),
+				s.SchDeparture,
+				csvString(s.ActDeparture),
+				csvInt(s.DelayDepartureMin),
+				s.State,
+			})
+		}
+		return table
+	})
+}
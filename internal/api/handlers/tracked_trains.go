@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"trano/internal/auth"
+	db "trano/internal/db/sqlc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type TrackedTrain struct {
+	ID        int64   `json:"id"`
+	SourceURL string  `json:"source_url"`
+	TrainNo   *int64  `json:"train_no"`
+	Enabled   bool    `json:"enabled"`
+	Note      *string `json:"note"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+func toTrackedTrain(row db.TrackedTrain) TrackedTrain {
+	return TrackedTrain{
+		ID:        row.ID,
+		SourceURL: row.SourceUrl,
+		TrainNo:   nullInt(row.TrainNo),
+		Enabled:   row.Enabled == 1,
+		Note:      nullString(row.Note),
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
+
+// GET /admin/tracked-trains
+func (h *AdminHandler) ListTrackedTrains(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.queries.ListTrackedTrains(r.Context())
+	if err != nil {
+		logf(h.logger, r, "handler: tracked trains query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	trains := make([]TrackedTrain, 0, len(rows))
+	enabled := 0
+	for _, row := range rows {
+		trains = append(trains, toTrackedTrain(row))
+		if row.Enabled == 1 {
+			enabled++
+		}
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"total":   len(trains),
+		"enabled": enabled,
+		"trains":  trains,
+	})
+}
+
+// POST /admin/tracked-trains {"source_url": "...", "train_no": 12951, "enabled": true, "note": "..."}
+// Adding a url that is already tracked updates it
+func (h *AdminHandler) AddTrackedTrain(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SourceURL string  `json:"source_url"`
+		TrainNo   *int64  `json:"train_no"`
+		Enabled   *bool   `json:"enabled"`
+		Note      *string `json:"note"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.SourceURL = strings.TrimSpace(body.SourceURL)
+	if u, err := url.Parse(body.SourceURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		httpError(w, r, "source_url must be an http(s) url", http.StatusBadRequest)
+		return
+	}
+
+	params := db.UpsertTrackedTrainParams{
+		SourceUrl: body.SourceURL,
+		Enabled:   1,
+	}
+	if body.TrainNo != nil {
+		params.TrainNo = sql.NullInt64{Int64: *body.TrainNo, Valid: true}
+	}
+	if body.Enabled != nil && !*body.Enabled {
+		params.Enabled = 0
+	}
+	if body.Note != nil {
+		params.Note = sql.NullString{String: *body.Note, Valid: true}
+	}
+
+	row, err := h.queries.UpsertTrackedTrain(r.Context(), params)
+	if err != nil {
+		logf(h.logger, r, "handler: tracked train insert failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: tracked train %d (%s) saved by key %d | enabled: %t", row.ID, row.SourceUrl, issuer.ID, row.Enabled == 1)
+	writeJSON(w, h.logger, http.StatusCreated, toTrackedTrain(row))
+}
+
+// PATCH /admin/tracked-trains/{tracked_id} {"enabled": false}
+// Fields left out keep their value
+func (h *AdminHandler) UpdateTrackedTrain(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "tracked_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid tracked train id", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Enabled *bool   `json:"enabled"`
+		TrainNo *int64  `json:"train_no"`
+		Note    *string `json:"note"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := db.UpdateTrackedTrainParams{ID: id}
+	if body.Enabled != nil {
+		params.Enabled = sql.NullInt64{Valid: true}
+		if *body.Enabled {
+			params.Enabled.Int64 = 1
+		}
+	}
+	if body.TrainNo != nil {
+		params.TrainNo = sql.NullInt64{Int64: *body.TrainNo, Valid: true}
+	}
+	if body.Note != nil {
+		params.Note = sql.NullString{String: *body.Note, Valid: true}
+	}
+
+	n, err := h.queries.UpdateTrackedTrain(r.Context(), params)
+	if err != nil {
+		logf(h.logger, r, "handler: tracked train %d update failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpError(w, r, "tracked train not found", http.StatusNotFound)
+		return
+	}
+
+	row, err := h.queries.GetTrackedTrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpError(w, r, "tracked train not found", http.StatusNotFound)
+			return
+		}
+		logf(h.logger, r, "handler: tracked train %d query failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: tracked train %d updated by key %d | enabled: %t", id, issuer.ID, row.Enabled == 1)
+	writeJSON(w, h.logger, http.StatusOK, toTrackedTrain(row))
+}
+
+// DELETE /admin/tracked-trains/{tracked_id}
+// The train and its schedule stay, the sync just stops refreshing them
+func (h *AdminHandler) DeleteTrackedTrain(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "tracked_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid tracked train id", http.StatusBadRequest)
+		return
+	}
+
+	n, err := h.queries.DeleteTrackedTrain(r.Context(), id)
+	if err != nil {
+		logf(h.logger, r, "handler: tracked train %d delete failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpError(w, r, "tracked train not found", http.StatusNotFound)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: tracked train %d removed by key %d", id, issuer.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
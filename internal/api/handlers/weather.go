@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	db "trano/internal/db/sqlc"
+)
+
+// GET /v1/reports/weather?period=90d&division=DLI
+// Station delays grouped by the weather of the division that day (fog, rain, heat, clear),
+// empty until weather enrichment is enabled
+func (h *AnalyticsHandler) GetWeatherDelays(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	period, sinceDate, err := parsePeriod(r, "90d", h.loc)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	division := strings.ToUpper(r.URL.Query().Get("division"))
+
+	conditions, err := h.queries.ListWeatherDelays(ctx, db.ListWeatherDelaysParams{
+		SinceDate: sinceDate,
+		Division:  division,
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: weather delays query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, h.logger, "weather_"+period+".csv", map[string]any{
+		"period":     period,
+		"since":      sinceDate,
+		"division":   division,
+		"conditions": conditions,
+	}, func() csvTable {
+		table := csvTable{Header: []string{
+			"condition", "division_days", "trains", "on_time_trains", "on_time_pct", "avg_delay_min", "max_delay_min",
+		}}
+		for _, c := range conditions {
+			table.Rows = append(table.Rows, []string{
+				c.Condition,
+				strconv.FormatInt(c.DivisionDays, 10),
+				strconv.FormatInt(c.Trains, 10),
+				strconv.FormatInt(c.OnTimeTrains, 10),
+				csvFloat(pct(c.OnTimeTrains, c.Trains)),
+				csvFloat(&c.AvgDelayMin),
+				strconv.FormatInt(c.MaxDelayMin, 10),
+			})
+		}
+		return table
+	})
+}
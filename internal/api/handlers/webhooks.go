@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"trano/internal/auth"
+	db "trano/internal/db/sqlc"
+	"trano/internal/webhooks"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultDelayThresholdMin = 15
+
+type WebhookSubscription struct {
+	ID                int64    `json:"id"`
+	URL               string   `json:"url"`
+	Events            []string `json:"events"`
+	TrainNo           *int64   `json:"train_no"` // null for every train
+	DelayThresholdMin int64    `json:"delay_threshold_min"`
+	Active            bool     `json:"active"`
+	Note              *string  `json:"note"`
+	CreatedAt         string   `json:"created_at"`
+	UpdatedAt         string   `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID               int64   `json:"id"`
+	Event            string  `json:"event"`
+	RunID            string  `json:"run_id"`
+	DelayMin         *int64  `json:"delay_min"`
+	PreviousDelayMin *int64  `json:"previous_delay_min"`
+	Attempts         int64   `json:"attempts"`
+	NextAttemptAt    *string `json:"next_attempt_at"` // null once delivered or abandoned
+	LastStatus       *int64  `json:"last_status"`
+	LastError        *string `json:"last_error"`
+	DeliveredAt      *string `json:"delivered_at"`
+	AbandonedAt      *string `json:"abandoned_at"`
+	CreatedAt        string  `json:"created_at"`
+}
+
+func toWebhookSubscription(row db.WebhookSubscription) WebhookSubscription {
+	return WebhookSubscription{
+		ID:                row.ID,
+		URL:               row.Url,
+		Events:            strings.Fields(row.Events),
+		TrainNo:           nullInt(row.TrainNo),
+		DelayThresholdMin: row.DelayThresholdMin,
+		Active:            row.Active == 1,
+		Note:              nullString(row.Note),
+		CreatedAt:         row.CreatedAt,
+		UpdatedAt:         row.UpdatedAt,
+	}
+}
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// GET /admin/webhooks
+func (h *AdminHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.queries.ListWebhookSubscriptions(r.Context())
+	if err != nil {
+		logf(h.logger, r, "handler: webhook subscriptions query failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	type subscription struct {
+		WebhookSubscription
+		Pending   int64 `json:"pending"`
+		Delivered int64 `json:"delivered"`
+		Abandoned int64 `json:"abandoned"`
+	}
+	subs := make([]subscription, 0, len(rows))
+	for _, row := range rows {
+		subs = append(subs, subscription{
+			WebhookSubscription: toWebhookSubscription(db.WebhookSubscription{
+				ID:                row.ID,
+				Url:               row.Url,
+				Events:            row.Events,
+				TrainNo:           row.TrainNo,
+				DelayThresholdMin: row.DelayThresholdMin,
+				Active:            row.Active,
+				Note:              row.Note,
+				CreatedAt:         row.CreatedAt,
+				UpdatedAt:         row.UpdatedAt,
+			}),
+			Pending:   row.Pending,
+			Delivered: row.Delivered,
+			Abandoned: row.Abandoned,
+		})
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"total":         len(subs),
+		"subscriptions": subs,
+	})
+}
+
+// POST /admin/webhooks {"url": "...", "events": ["run.started", "run.delay_changed"], "train_no": 12951, "delay_threshold_min": 15}
+// Deliveries are signed with the secret in this response, the only time it is shown.
+// Receivers check X-Trano-Signature, "sha256=" and the hex HMAC-SHA256 of
+// "<X-Trano-Timestamp>.<body>".
+func (h *AdminHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL               string   `json:"url"`
+		Events            []string `json:"events"`
+		TrainNo           *int64   `json:"train_no"`
+		DelayThresholdMin *int64   `json:"delay_threshold_min"`
+		Active            *bool    `json:"active"`
+		Note              *string  `json:"note"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.URL = strings.TrimSpace(body.URL)
+	if !validWebhookURL(body.URL) {
+		httpError(w, r, "url must be an http(s) url", http.StatusBadRequest)
+		return
+	}
+	events, err := webhooks.ParseEvents(body.Events)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := db.CreateWebhookSubscriptionParams{
+		Url:               body.URL,
+		Events:            strings.Join(events, " "),
+		DelayThresholdMin: defaultDelayThresholdMin,
+		Active:            1,
+	}
+	if body.TrainNo != nil {
+		params.TrainNo = sql.NullInt64{Int64: *body.TrainNo, Valid: true}
+	}
+	if body.DelayThresholdMin != nil {
+		if *body.DelayThresholdMin <= 0 {
+			httpError(w, r, "delay_threshold_min must be positive", http.StatusBadRequest)
+			return
+		}
+		params.DelayThresholdMin = *body.DelayThresholdMin
+	}
+	if body.Active != nil && !*body.Active {
+		params.Active = 0
+	}
+	if body.Note != nil {
+		params.Note = sql.NullString{String: *body.Note, Valid: true}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		logf(h.logger, r, "handler: webhook secret generation failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	params.Secret = secret
+
+	row, err := h.queries.CreateWebhookSubscription(r.Context(), params)
+	if err != nil {
+		logf(h.logger, r, "handler: webhook subscription insert failed: %v", err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: webhook %d (%s) created by key %d | events: %s", row.ID, row.Url, issuer.ID, row.Events)
+	writeJSON(w, h.logger, http.StatusCreated, struct {
+		WebhookSubscription
+		Secret string `json:"secret"`
+	}{toWebhookSubscription(row), row.Secret})
+}
+
+// PATCH /admin/webhooks/{webhook_id} {"active": false}
+// Fields left out keep their value
+func (h *AdminHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhook_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		URL               *string  `json:"url"`
+		Events            []string `json:"events"`
+		TrainNo           *int64   `json:"train_no"`
+		DelayThresholdMin *int64   `json:"delay_threshold_min"`
+		Active            *bool    `json:"active"`
+		Note              *string  `json:"note"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := db.UpdateWebhookSubscriptionParams{ID: id}
+	if body.URL != nil {
+		u := strings.TrimSpace(*body.URL)
+		if !validWebhookURL(u) {
+			httpError(w, r, "url must be an http(s) url", http.StatusBadRequest)
+			return
+		}
+		params.Url = sql.NullString{String: u, Valid: true}
+	}
+	if body.Events != nil {
+		events, err := webhooks.ParseEvents(body.Events)
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.Events = sql.NullString{String: strings.Join(events, " "), Valid: true}
+	}
+	if body.TrainNo != nil {
+		params.TrainNo = sql.NullInt64{Int64: *body.TrainNo, Valid: true}
+	}
+	if body.DelayThresholdMin != nil {
+		if *body.DelayThresholdMin <= 0 {
+			httpError(w, r, "delay_threshold_min must be positive", http.StatusBadRequest)
+			return
+		}
+		params.DelayThresholdMin = sql.NullInt64{Int64: *body.DelayThresholdMin, Valid: true}
+	}
+	if body.Active != nil {
+		params.Active = sql.NullInt64{Valid: true}
+		if *body.Active {
+			params.Active.Int64 = 1
+		}
+	}
+	if body.Note != nil {
+		params.Note = sql.NullString{String: *body.Note, Valid: true}
+	}
+
+	n, err := h.queries.UpdateWebhookSubscription(r.Context(), params)
+	if err != nil {
+		logf(h.logger, r, "handler: webhook %d update failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpError(w, r, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	row, err := h.queries.GetWebhookSubscription(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpError(w, r, "webhook not found", http.StatusNotFound)
+			return
+		}
+		logf(h.logger, r, "handler: webhook %d query failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: webhook %d updated by key %d | active: %t", id, issuer.ID, row.Active == 1)
+	writeJSON(w, h.logger, http.StatusOK, toWebhookSubscription(row))
+}
+
+// DELETE /admin/webhooks/{webhook_id}
+// Pending deliveries go with it
+func (h *AdminHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhook_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	n, err := h.queries.DeleteWebhookSubscription(r.Context(), id)
+	if err != nil {
+		logf(h.logger, r, "handler: webhook %d delete failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpError(w, r, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	issuer, _ := auth.FromContext(r.Context())
+	logf(h.logger, r, "handler: webhook %d removed by key %d", id, issuer.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /admin/webhooks/{webhook_id}/deliveries?limit=
+// Latest deliveries newest first, finished ones are kept for a week
+func (h *AdminHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhook_id"), 10, 64)
+	if err != nil {
+		httpError(w, r, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.queries.GetWebhookSubscription(r.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpError(w, r, "webhook not found", http.StatusNotFound)
+			return
+		}
+		logf(h.logger, r, "handler: webhook %d query failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.queries.ListWebhookDeliveries(r.Context(), db.ListWebhookDeliveriesParams{
+		SubscriptionID: id,
+		Limit:          int64(queryInt(r, "limit", 50, 1, 500)),
+	})
+	if err != nil {
+		logf(h.logger, r, "handler: webhook %d deliveries query failed: %v", id, err)
+		httpError(w, r, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		d := WebhookDelivery{
+			ID:               row.ID,
+			Event:            row.Event,
+			RunID:            row.RunID,
+			DelayMin:         nullInt(row.DelayMin),
+			PreviousDelayMin: nullInt(row.PreviousDelayMin),
+			Attempts:         row.Attempts,
+			LastStatus:       nullInt(row.LastStatus),
+			LastError:        nullString(row.LastError),
+			DeliveredAt:      nullString(row.DeliveredAt),
+			AbandonedAt:      nullString(row.AbandonedAt),
+			CreatedAt:        row.CreatedAt,
+		}
+		if d.DeliveredAt == nil && d.AbandonedAt == nil {
+			d.NextAttemptAt = &row.NextAttemptAt
+		}
+		out = append(out, d)
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]any{
+		"webhook_id": id,
+		"total":      len(out),
+		"deliveries": out,
+	})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"trano/internal/health"
+)
+
+// how long the database gets to answer a ping before it counts as down
+const healthPingTimeout = 2 * time.Second
+
+// serveHealthDetail reports the database as pinged now and every background service
+// as of its last run. Only the database being down fails the check, the rest is in
+// the body for whoever is looking.
+func (s *Server) serveHealthDetail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.db.PingContext(ctx)
+	latency := time.Since(start)
+
+	dbHealth := map[string]any{
+		"status":     health.StatusOK,
+		"latency_ms": float64(latency.Microseconds()) / 1000,
+	}
+	if err != nil {
+		dbHealth["status"] = health.StatusDown
+		dbHealth["error"] = err.Error()
+	}
+
+	components := map[string]any{"db": dbHealth}
+	overall := health.StatusOK
+	for name, c := range health.Snapshot() {
+		components[name] = c
+		if c.Status == health.StatusDegraded {
+			overall = health.StatusDegraded
+		}
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		overall, status = health.StatusDown, http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, status, map[string]any{
+		"status":     overall,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+		"components": components,
+	})
+}
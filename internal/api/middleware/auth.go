@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"trano/internal/auth"
+	db "trano/internal/db/sqlc"
+	"trano/internal/requestid"
+)
+
+// RequireScope only lets requests through that carry an active API key holding scope,
+// sent as "Authorization: Bearer <key>" or "X-API-Key: <key>". Missing or unknown keys
+// get a 401, keys without the scope a 403.
+func RequireScope(queries *db.Queries, logger *log.Logger, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := requestKey(r)
+			if raw == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="trano"`)
+				requestid.Error(w, r, "api key required", http.StatusUnauthorized)
+				return
+			}
+
+			row, err := queries.GetActiveAPIKey(r.Context(), auth.Hash(raw))
+			if errors.Is(err, sql.ErrNoRows) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="trano", error="invalid_token"`)
+				requestid.Error(w, r, "invalid api key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logger.Printf("[%s] auth: key lookup failed: %v", requestid.From(r.Context()), err)
+				requestid.Error(w, r, "internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			key := auth.Key{ID: row.ID, Name: row.Name, Scopes: strings.Fields(row.Scopes)}
+			if !key.Has(scope) {
+				requestid.Error(w, r, "api key lacks scope "+scope, http.StatusForbidden)
+				return
+			}
+
+			// at most one write a minute per key, see TouchAPIKey
+			if err := queries.TouchAPIKey(r.Context(), db.TouchAPIKeyParams{
+				UsedAt: time.Now().UTC().Format(time.RFC3339),
+				ID:     key.ID,
+			}); err != nil {
+				logger.Printf("[%s] auth: key %d last used update failed: %v", requestid.From(r.Context()), key.ID, err)
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), key)))
+		})
+	}
+}
+
+func requestKey(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"trano/internal/config"
+
+	"github.com/go-chi/cors"
+)
+
+// headers set by the API that browser code on other origins may read
+var corsExposedHeaders = []string{"Link", "ETag", "X-Request-ID", "X-Processing-Time", "X-Next-Cursor"}
+
+// CORS lets browser frontends on the configured origins call the API. Preflight
+// requests are answered here and cached by the browser for cfg.MaxAge.
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	return cors.Handler(cors.Options{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: cfg.AllowedMethods,
+		AllowedHeaders: cfg.AllowedHeaders,
+		ExposedHeaders: corsExposedHeaders,
+		// browsers refuse credentials with a wildcard origin
+		AllowCredentials: cfg.AllowCredentials && !slices.Contains(cfg.AllowedOrigins, "*"),
+		MaxAge:           int(cfg.MaxAge.Seconds()),
+	})
+}
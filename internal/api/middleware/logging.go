@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"bufio"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
+
+	"trano/internal/requestid"
 )
 
 // wrap an http.ResponseWriter to track response status and size.
@@ -33,15 +37,30 @@ func (r *StatusRecorder) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// lets websocket handlers take over the connection
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	r.Status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// lets http.ResponseController reach the underlying writer to flush streams
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Logging tags each request with an ID, the client's X-Request-ID or a new one, which
+// handlers read back through requestid.From and every response carries
 func Logging(logger *log.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
-			requestID := r.Header.Get("X-Request-ID")
-			if requestID == "" {
-				requestID = fmt.Sprintf("req_%d", start.UnixNano())
-			}
+			requestID := requestid.Sanitize(r.Header.Get("X-Request-ID"), start)
+			r = r.WithContext(requestid.With(r.Context(), requestID))
 
 			rec := &StatusRecorder{
 				ResponseWriter: w,
@@ -52,7 +71,7 @@ func Logging(logger *log.Logger) func(http.Handler) http.Handler {
 			defer func() {
 				if err := recover(); err != nil {
 					logger.Printf("PANIC [%s] %s %s: %v", requestID, r.Method, r.URL.Path, err)
-					http.Error(rec, "Internal Server Error", http.StatusInternalServerError)
+					requestid.Error(rec, r, "Internal Server Error", http.StatusInternalServerError)
 				}
 
 				// Log request details
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"trano/internal/metrics"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	requestDuration = metrics.NewHistogram("trano_http_request_duration_seconds",
+		"API request latency by route pattern.", metrics.DefBuckets, "method", "route", "status")
+	requestsInFlight = metrics.NewGauge("trano_http_requests_in_flight",
+		"API requests being served, streams included.")
+)
+
+// Metrics records request latency by chi route pattern, so /v1/runs/{run_id}/eta is one
+// series however many runs are asked for. It goes right after Logging and reads the
+// status from its StatusRecorder.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		inFlight := requestsInFlight.With()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		next.ServeHTTP(w, r)
+
+		// the pattern is only complete once routing is done
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := "0"
+		if rec, ok := w.(*StatusRecorder); ok {
+			status = strconv.Itoa(rec.Status)
+		}
+		requestDuration.With(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
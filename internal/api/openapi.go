@@ -0,0 +1,757 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"trano/internal/api/handlers"
+	"trano/internal/api/openapi"
+	v1 "trano/internal/api/schema/v1"
+	"trano/internal/auth"
+	db "trano/internal/db/sqlc"
+	"trano/internal/iri"
+	"trano/internal/poller"
+	"trano/internal/prediction"
+)
+
+const apiDescription = `Live positions, run histories and punctuality reports for Indian Railways trains.
+
+Coordinates in protobuf messages and stored fixes are u6 integers (micro-degrees, divide by 1e6),
+distances and route fractions stored as u4 integers are in units of 1e-4 (divide by 1e4).
+JSON responses of the REST endpoints use plain decimal degrees and kilometres.
+
+Every list endpoint also answers format=csv, and has a CSV-only mirror under /v1/export.
+
+Servers started with SERVER_GRAPHQL=true also answer read-only GraphQL queries at /graphql,
+whose schema GET /graphql serves as SDL. With SERVER_GRPC_ADDR set, the trano.api.v1.Trains
+gRPC service (LiveTrains, GetRun, GetTimetable, StreamPositions) is served on that address
+over cleartext HTTP/2, using the same protobuf messages as the live endpoints.`
+
+var period = openapi.Query("period", "string", "Look back window such as 7d or 30d.")
+var minQuality = openapi.Query("min_quality", "integer", "Leave out runs with a data quality score below this, 0 to 100.")
+var trainNo = openapi.Query("train_no", "integer", "Only this train.")
+
+// spec describes the routes of registerRoutes, keep the two in step
+func spec() *openapi.Document {
+	d := openapi.New("Trano API", "1", apiDescription)
+
+	d.AddTag("live", "Current positions of running trains")
+	d.AddTag("runs", "Individual runs of a train, one per origin date")
+	d.AddTag("schedules", "Static timetables and route shapes")
+	d.AddTag("stations", "Station boards, search and journeys")
+	d.AddTag("analytics", "Segment speeds, congestion and headways")
+	d.AddTag("reports", "Punctuality and coverage reports")
+	d.AddTag("admin", "Exports and API keys, require a key. Mounted at /admin, outside the versioned API; /v1/admin/... answers with a 308 to the same path under /admin")
+
+	// live
+	d.Add("GET", "/v1/trains/live", openapi.Op{
+		Tag:         "live",
+		Summary:     "Every train reported in the last 15 minutes",
+		Description: "Protobuf LiveTrainsResponse (schema/v1/api.proto), or the JSON mapping below for Accept: application/json or format=json. Positions are u6; extrapolated marks trains upstream has gone quiet on, moved along their route at their last speed. speed_kmh is the speed between the last two fixes and avg_speed_kmh the average over the last few. Answers If-None-Match with 304 while nothing changed. Zoomed out viewports get clusters, with centroid, count, dominant type and bounds, in place of the trains in them; cells with a single train keep it.",
+		Params: []openapi.Parameter{
+			openapi.Query("min_lat", "number", "Viewport, all four or none."),
+			openapi.Query("min_lng", "number", ""),
+			openapi.Query("max_lat", "number", ""),
+			openapi.Query("max_lng", "number", ""),
+			openapi.Query("zoom", "integer", "Map zoom level, 8 and below cluster and size the grid."),
+			openapi.Query("cluster", "boolean", "Force clustering on or off."),
+			openapi.Query("type", "string", "Only these train types, comma separated, e.g. EXP,SF."),
+			openapi.Query("zone", "string", "Only trains of these zones, comma separated, e.g. ER."),
+			openapi.Query("status", "string", "Only trains in these statuses, comma separated, e.g. running."),
+			openapi.Query("limit", "integer", "Return at most this many trains, lowest train numbers first. total still counts every match, clusters are not limited."),
+		},
+		Response: &v1.LiveTrainsResponse{},
+		Protobuf: true,
+		GeoJSON:  true,
+	})
+	d.Add("GET", "/v1/trains/nearby", openapi.Op{
+		Tag:         "live",
+		Summary:     "Live trains around a point, nearest first",
+		Description: "Distances are geodesic from the snapped position. direction_deg points from the given point to the train, bearing_deg is the heading of the train.",
+		Params: []openapi.Parameter{
+			openapi.Required("lat", "number", "Latitude of the point."),
+			openapi.Required("lng", "number", "Longitude of the point."),
+			openapi.Query("radius_km", "number", "Search radius, 10 by default and at most 100."),
+			openapi.Query("limit", "integer", "At most this many trains, 50 by default."),
+		},
+		Response: openapi.Object{"lat": 0.0, "lng": 0.0, "radius_km": 0.0, "total": 0, "trains": []handlers.NearbyTrain{}},
+		GeoJSON:  true,
+	})
+	d.Add("GET", "/v1/live/ws", openapi.Op{
+		Tag:         "live",
+		Summary:     "WebSocket of live train changes",
+		Description: `Binary frames are LiveTrainsResponse messages with only the trains that changed, the first one everything in view, or text frames of their JSON mapping with format=json. Send {"bbox":[min_lat,min_lng,max_lat,max_lng]} to move the viewport, or {"bbox":null} for every train.`,
+		Params: []openapi.Parameter{
+			openapi.Query("min_lat", "number", "Viewport, all four or none."),
+			openapi.Query("min_lng", "number", ""),
+			openapi.Query("max_lat", "number", ""),
+			openapi.Query("max_lng", "number", ""),
+			openapi.Query("format", "string", "json for text frames of JSON in place of binary protobuf."),
+		},
+		Status: http.StatusSwitchingProtocols,
+	})
+	d.Add("GET", "/v1/live/delta", openapi.Op{
+		Tag:         "live",
+		Summary:     "Live trains that changed since a previous response",
+		Description: "Protobuf LiveTrainsResponse, or its JSON mapping with format=json, holding only the trains whose position or status changed since the given timestamp. Trains that left the live set are listed in removed_train_nos and runs that ended in terminal_run_ids, which may repeat a run written again after it ended. The response timestamp is the since of the next call. Answers 410 when since is more than 30 minutes old.",
+		Params: []openapi.Parameter{
+			openapi.Required("since", "string", "Timestamp of the previous /v1/trains/live or /v1/live/delta response, RFC 3339."),
+		},
+		Response: &v1.LiveTrainsResponse{},
+		Protobuf: true,
+	})
+	d.Add("GET", "/v1/live/wait", openapi.Op{
+		Tag:         "live",
+		Summary:     "Long-polling live delta",
+		Description: "For clients behind proxies that block WebSockets and event streams. Holds the request until the poller finishes a cycle after since, or for timeout seconds, then answers like /v1/live/delta. Pass the response timestamp as the next since.",
+		Params: []openapi.Parameter{
+			openapi.Required("since", "string", "Timestamp of the previous /v1/trains/live, /v1/live/delta or /v1/live/wait response, RFC 3339."),
+			openapi.Query("timeout", "integer", "Seconds to wait at most, 25 by default, up to 55."),
+		},
+		Response: &v1.LiveTrainsResponse{},
+		Protobuf: true,
+	})
+	d.Add("GET", "/v1/tiles/live/{z}/{x}/{y}.mvt", openapi.Op{
+		Tag:         "live",
+		Summary:     "Mapbox vector tile of live trains",
+		Description: `A "trains" point layer, thinned at low zooms, and with routes=true from zoom 5 a "routes" line layer.`,
+		Params:      []openapi.Parameter{openapi.Query("routes", "boolean", "Add the routes layer.")},
+		Response:    []byte{},
+		ContentType: "application/vnd.mapbox-vector-tile",
+	})
+
+	// runs
+	d.Add("GET", "/v1/runs", openapi.Op{
+		Tag:     "runs",
+		Summary: "Runs that started on a date, by status",
+		Params: []openapi.Parameter{
+			openapi.Query("date", "string", "YYYY-MM-DD, today when left out."),
+			openapi.Query("status", "string", "Only runs that are scheduled (not started), running, completed (arrived or terminated), cancelled (including reported not running) or no_data (given up on by the poller)."),
+			openapi.Query("has_started", "boolean", "Only runs that have or have not started."),
+			minQuality,
+		},
+		Response: openapi.Object{"date": "", "total": 0, "runs": []handlers.RunSummary{}, "next_cursor": (*string)(nil)},
+		CSV:      true,
+		Cursor:   true,
+	})
+	d.Add("POST", "/v1/runs/batch", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Status of several runs at once",
+		Description: "Up to 100 runs by train number and date, for following a list of saved trains. Runs come back in the order asked, duplicates once, and runs that do not exist are listed under not_found.",
+		Body:        openapi.Object{"runs": []handlers.BatchRunKey{}},
+		Response:    openapi.Object{"total": 0, "runs": []handlers.RunSummary{}, "not_found": []handlers.BatchRunKey{}},
+	})
+	d.Add("POST", "/v1/push/subscriptions", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Follow a run with push notifications",
+		Description: "Registers an FCM device token for one run. The device gets a notification whenever the run's status changes or its delay moves by PUSH_DELAY_THRESHOLD_MIN since the last one. A device follows at most 20 runs, subscriptions end two days after the run date. Only served when PUSH_FCM_CREDENTIALS is set.",
+		Body:        handlers.DeviceSubscription{},
+		Response:    handlers.DeviceSubscription{},
+		Status:      http.StatusCreated,
+	})
+	d.Add("DELETE", "/v1/push/subscriptions", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Stop following a run",
+		Description: "Only served when PUSH_FCM_CREDENTIALS is set.",
+		Body:        handlers.DeviceSubscription{},
+		Status:      http.StatusNoContent,
+	})
+	d.Add("GET", "/v1/runs/{run_id}/locations", openapi.Op{
+		Tag:      "runs",
+		Summary:  "Position fixes of a run in time order",
+		Response: openapi.Object{"run_id": "", "total": 0, "locations": []handlers.RunLocation{}, "next_cursor": (*string)(nil)},
+		CSV:      true,
+		GeoJSON:  true,
+		Cursor:   true,
+	})
+	d.Add("GET", "/v1/runs/{run_id}/delays", openapi.Op{
+		Tag:      "runs",
+		Summary:  "Scheduled against actual times at each station",
+		Response: openapi.Object{"run_id": "", "summary": handlers.DelaySummary{}, "stations": []handlers.StationDelay{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/runs/{run_id}/eta", openapi.Op{
+		Tag:      "runs",
+		Summary:  "Predicted arrivals at the stations still ahead",
+		Response: prediction.RunPrediction{},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/runs/{run_id}/encounters", openapi.Op{
+		Tag:      "runs",
+		Summary:  "Other trains the run crossed or overtook",
+		Response: openapi.Object{"run_id": "", "total": 0, "encounters": []handlers.Encounter{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/runs/{run_id}/distance-time", openapi.Op{
+		Tag:      "runs",
+		Summary:  "Distance against time, actual and scheduled",
+		Response: openapi.Object{"run_id": "", "points": []handlers.DistanceTimePoint{}, "scheduled": []handlers.ScheduledPoint{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/runs/{train_no}/{run_date}/events", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Server-sent events of one run",
+		Description: "A run event whenever status, station or position changes, and an end event once the run arrives.",
+		Response:    handlers.RunEvent{},
+		ContentType: "text/event-stream",
+	})
+	d.Add("GET", "/v1/runs/{train_no}/{run_date}/replay", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Replay the recorded track of a run",
+		Description: "Server-sent events playing the fixes back on an accelerated clock that keeps their original spacing: a start event, a fix event per fix and an end event.",
+		Params:      []openapi.Parameter{openapi.Query("speed", "integer", "How many times faster than real time, 60 by default, up to 3600.")},
+		Response:    handlers.ReplayFix{},
+		ContentType: "text/event-stream",
+	})
+	d.Add("GET", "/v1/runs/{train_no}/{run_date}/timeline", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Every stop of a run, scheduled against actual",
+		Description: "Stops in route order with the timetable, the recorded actuals and delays. Stops not reached yet are pending and carry only the timetable.",
+		Response: openapi.Object{
+			"run_id": "", "train_no": int64(0), "run_date": "", "has_started": true, "has_arrived": true,
+			"stops": []handlers.TimelineStop{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/runs/{train_no}/{run_date}/compare", openapi.Op{
+		Tag:         "runs",
+		Summary:     "A run's delays against the train's usual",
+		Description: "Per station, the run's delays next to their average over the train's last runs before this one. diff_min is positive where the run does worse than usual.",
+		Params: []openapi.Parameter{
+			openapi.Query("runs", "integer", "Earlier runs to average over, 30 by default and at most 90."),
+		},
+		Response: openapi.Object{
+			"run_id": "", "train_no": int64(0), "run_date": "",
+			"summary": handlers.ComparisonSummary{}, "stations": []handlers.StationComparison{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/runs/{train_no}/{run_date}/eta/{station_code}", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Predicted arrival of a run at one station",
+		Description: "The current delay comes from the latest fix when it is past the last reported station. 404 when the station is not on the route, 409 once the run has reached it.",
+		Response:    prediction.StationPrediction{},
+	})
+	d.Add("GET", "/v1/trains/{train_no}/timetable", openapi.Op{
+		Tag:         "schedules",
+		Summary:     "Full timetable of a train",
+		Description: "Every schedule of the train with its stops in route order. Minutes count from the origin departure, running days are the weekdays the train leaves each station.",
+		Response: openapi.Object{
+			"train_no": int64(0), "train_name": "", "train_type": "", "schedules": []handlers.TimetableSchedule{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/trains/{train_no}/calendar", openapi.Op{
+		Tag:         "schedules",
+		Summary:     "Dates a train runs in a month",
+		Description: "Running days come from the schedule bitmaps, with the weekdays the poller saw reported not running already taken out. Runs reported not running or cancelled on a running day, and runs on other days, are flagged as exceptions.",
+		Params:      []openapi.Parameter{openapi.Query("month", "string", "YYYY-MM, the current month by default.")},
+		Response: openapi.Object{
+			"train_no": int64(0), "month": "", "running_days": []string{}, "runs": 0, "exceptions": 0,
+			"days": []handlers.CalendarDay{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/trains/{train_no}/rake", openapi.Op{
+		Tag:         "schedules",
+		Summary:     "Coach composition of a train",
+		Description: "The coaches from the locomotive end with their class, parsed from the scraped composition. Classes counts the passenger coaches of each class. 404 when the train has no composition.",
+		Response: openapi.Object{
+			"train_no": int64(0), "train_name": "", "train_type": "", "composition": "", "updated_at": "",
+			"length": 0, "classes": map[string]int{}, "coaches": []iri.Coach{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/schedules/{schedule_id}/shape", openapi.Op{
+		Tag:         "schedules",
+		Summary:     "Route line of a schedule",
+		Description: "The geometry fixes are snapped onto as a Google encoded polyline at 5 decimals. Schedules without one fall back to their stations joined up, source tells which.",
+		Response: openapi.Object{
+			"schedule_id": int64(0), "train_no": int64(0), "source": "", "points": 0, "polyline": "",
+		},
+		GeoJSON: true,
+	})
+	d.Add("GET", "/v1/anomalies", openapi.Op{
+		Tag:      "runs",
+		Summary:  "Runs behaving oddly, such as stalled, stuck or diverted trains",
+		Params:   []openapi.Parameter{openapi.Query("kind", "string", "Only anomalies of this kind, stalled or diverted.")},
+		Response: openapi.Object{"total": 0, "anomalies": []handlers.Anomaly{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/history/{date}/snapshot", openapi.Op{
+		Tag:     "runs",
+		Summary: "Where every train was at a past moment",
+		Params: []openapi.Parameter{
+			openapi.Required("time", "string", "HH:MM local time."),
+			openapi.Query("max_gap_min", "integer", "Leave out trains without a fix this close to the time."),
+			minQuality,
+		},
+		Response: openapi.Object{"at": "", "total": 0, "trains": []handlers.SnapshotTrain{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/history/positions", openapi.Op{
+		Tag:         "runs",
+		Summary:     "Last known position of every train at a past instant",
+		Description: "Each train's latest fix at or before the instant, not interpolated, for incident review and time-lapses.",
+		Params: []openapi.Parameter{
+			openapi.Required("at", "string", "RFC3339 timestamp."),
+			openapi.Query("max_age_min", "integer", "Leave out trains whose last fix is older than this, 30 by default."),
+			minQuality,
+		},
+		Response: openapi.Object{"at": "", "total": 0, "trains": []handlers.SnapshotTrain{}},
+		CSV:      true,
+		GeoJSON:  true,
+	})
+
+	// stations
+	d.Add("GET", "/v1/stations/nearby", openapi.Op{
+		Tag:         "stations",
+		Summary:     "Stations around a point, nearest first",
+		Description: "Distances are geodesic. direction_deg points from the given point to the station. Stations without coordinates are left out.",
+		Params: []openapi.Parameter{
+			openapi.Required("lat", "number", "Latitude of the point."),
+			openapi.Required("lng", "number", "Longitude of the point."),
+			openapi.Query("radius_km", "number", "Search radius, 10 by default and at most 100."),
+			openapi.Query("limit", "integer", "At most this many stations, 20 by default."),
+		},
+		Response: openapi.Object{"lat": 0.0, "lng": 0.0, "radius_km": 0.0, "total": 0, "stations": []handlers.NearbyStation{}},
+		CSV:      true,
+		GeoJSON:  true,
+	})
+	d.Add("GET", "/v1/departures/nearby", openapi.Op{
+		Tag:         "stations",
+		Summary:     "Trains leaving near a point soon",
+		Description: "Merges the live boards of the nearest stations, by expected departure. Trains terminating there are left out.",
+		Params: []openapi.Parameter{
+			openapi.Required("lat", "number", "Latitude of the point."),
+			openapi.Required("lng", "number", "Longitude of the point."),
+			openapi.Query("radius_km", "number", "Radius to look for stations in, 3 by default and at most 20."),
+			openapi.Query("within", "string", "Duration such as 45m, the default, at most 3h."),
+			openapi.Query("limit", "integer", "At most this many departures, 50 by default."),
+		},
+		Response: openapi.Object{"lat": 0.0, "lng": 0.0, "radius_km": 0.0, "from": "", "until": "", "total": 0, "departures": []handlers.NearbyDeparture{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/stations/search", openapi.Op{
+		Tag:     "stations",
+		Summary: "Stations by name or code",
+		Params: []openapi.Parameter{
+			openapi.Required("q", "string", "Words of the name or a station code."),
+			openapi.Query("limit", "integer", ""),
+		},
+		Response: openapi.Object{"q": "", "total": 0, "stations": []handlers.StationMatch{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/journeys", openapi.Op{
+		Tag:     "stations",
+		Summary: "Trains from one station to another on a date",
+		Params: []openapi.Parameter{
+			openapi.Required("from", "string", "Station code."),
+			openapi.Required("to", "string", "Station code."),
+			openapi.Query("date", "string", "YYYY-MM-DD of departure from `from`, today when left out."),
+		},
+		Response: openapi.Object{"from": "", "to": "", "date": "", "total": 0, "journeys": []handlers.Journey{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/stations/{station_code}/board", openapi.Op{
+		Tag:         "stations",
+		Summary:     "Trains calling at a station",
+		Description: "The timetable of a date, or with window the live board of the next hours with expected times. Platforms are as published upstream, with the shares riders reported in platform_info.",
+		Params: []openapi.Parameter{
+			openapi.Query("date", "string", "YYYY-MM-DD, today when left out."),
+			openapi.Query("window", "string", "Duration such as 2h, switches to the live board."),
+		},
+		Response: openapi.OneOf{
+			openapi.Object{"station_code": "", "date": "", "total": 0, "trains": []handlers.BoardEntry{}},
+			openapi.Object{"station_code": "", "from": "", "until": "", "total": 0, "trains": []handlers.LiveBoardEntry{}},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/stations/{station_code}/live", openapi.Op{
+		Tag:         "stations",
+		Summary:     "Trains standing at a station",
+		Description: "Active runs whose latest fix has them at the station, with their arrival and expected departure.",
+		Response:    openapi.Object{"station_code": "", "timestamp": "", "total": 0, "trains": []handlers.AtStationEntry{}},
+		CSV:         true,
+	})
+
+	// analytics
+	d.Add("GET", "/v1/stations/{station_code}/congestion", openapi.Op{
+		Tag:     "analytics",
+		Summary: "Trains at a station by hour of day",
+		Params:  []openapi.Parameter{period},
+		Response: openapi.Object{
+			"station_code": "", "period": "", "since": "", "trains_at_station": int64(0),
+			"peak_hour": int64(0), "peak_trains": int64(0), "hours": []db.ListStationCongestionByHourRow{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/stations/{station_code}/headways", openapi.Op{
+		Tag:      "analytics",
+		Summary:  "Gaps between consecutive trains at a station",
+		Response: openapi.Object{"station_code": "", "total": 0, "directions": []db.ListStationHeadwaysRow{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/segments/slowest", openapi.Op{
+		Tag:     "analytics",
+		Summary: "Slowest station to station segments",
+		Params: []openapi.Parameter{
+			openapi.Query("limit", "integer", ""),
+			openapi.Query("min_samples", "integer", "Leave out segments with fewer traversals."),
+		},
+		Response: openapi.Object{"total": 0, "segments": []db.SegmentStat{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/segments/{from}/{to}", openapi.Op{
+		Tag:      "analytics",
+		Summary:  "Speed statistics between two adjacent stations",
+		Response: db.SegmentStat{},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/sections/occupancy", openapi.Op{
+		Tag:     "analytics",
+		Summary: "Sections with several trains on them right now",
+		Params: []openapi.Parameter{
+			openapi.Query("min_trains", "integer", ""),
+			openapi.Query("limit", "integer", ""),
+		},
+		Response: openapi.Object{"total": 0, "sections": []handlers.SectionOccupancy{}},
+		CSV:      true,
+	})
+
+	// reports
+	d.Add("GET", "/v1/stats/delays", openapi.Op{
+		Tag:         "reports",
+		Summary:     "Most delayed trains, now or on a past date",
+		Description: "Without a date, the trains running now by the delay at their current station as of the last poll. With one, every run of that date by the delay it last reported, the terminus delay for finished runs.",
+		Params: []openapi.Parameter{
+			openapi.Query("date", "string", "YYYY-MM-DD run date, the trains running now when left out."),
+			openapi.Query("limit", "integer", "At most this many runs, 20 by default."),
+		},
+		Response: openapi.Object{"date": (*string)(nil), "total": 0, "runs": []handlers.DelayedRun{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/reports/leaderboard", openapi.Op{
+		Tag:     "reports",
+		Summary: "Most and least punctual trains",
+		Params: []openapi.Parameter{
+			openapi.Query("metric", "string", "on_time or avg_delay."),
+			period,
+			openapi.Query("limit", "integer", ""),
+			openapi.Query("min_runs", "integer", ""),
+			openapi.Query("threshold_min", "integer", "Arrivals up to this late count as on time."),
+			minQuality,
+		},
+		Response: openapi.Object{
+			"metric": "", "period": "", "since": "", "threshold_min": 0, "trains_ranked": 0,
+			"best": []handlers.LeaderboardEntry{}, "worst": []handlers.LeaderboardEntry{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/reports/delay-heatmap", openapi.Op{
+		Tag:     "reports",
+		Summary: "Average delay by place",
+		Params: []openapi.Parameter{
+			openapi.Query("from", "string", "YYYY-MM-DD."),
+			openapi.Query("to", "string", "YYYY-MM-DD."),
+			openapi.Query("resolution", "string", "station, or a grid cell size in degrees."),
+		},
+		Response: openapi.Object{"from": "", "to": "", "resolution": "", "total": 0, "buckets": []handlers.HeatmapBucket{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/reports/congestion", openapi.Op{
+		Tag:      "reports",
+		Summary:  "Busiest stations",
+		Params:   []openapi.Parameter{period, openapi.Query("limit", "integer", "")},
+		Response: openapi.Object{"period": "", "since": "", "total": 0, "stations": []db.ListCongestedStationsRow{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/reports/daily", openapi.Op{
+		Tag:     "reports",
+		Summary: "Daily summary by zone, train or station",
+		Params: []openapi.Parameter{
+			openapi.Query("date", "string", "YYYY-MM-DD, yesterday when left out."),
+			openapi.Query("level", "string", "zone, train or station."),
+		},
+		Response: openapi.Object{"date": "", "level": "", "total": 0, "items": openapi.OneOf{
+			[]handlers.DailyZoneSummary{}, []handlers.DailyTrainSummary{}, []handlers.DailyStationSummary{},
+		}},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/reports/zones", openapi.Op{
+		Tag:      "reports",
+		Summary:  "Punctuality by zone, division or rake zone",
+		Params:   []openapi.Parameter{openapi.Query("group_by", "string", "zone, division or rake_zone."), period},
+		Response: openapi.Object{"group_by": "", "period": "", "since": "", "total": 0, "groups": []handlers.ZonePunctuality{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/reports/headways", openapi.Op{
+		Tag:     "reports",
+		Summary: "Directions where trains bunch up",
+		Params: []openapi.Parameter{
+			openapi.Query("min_samples", "integer", ""),
+			openapi.Query("limit", "integer", ""),
+		},
+		Response: openapi.Object{"total": 0, "directions": []db.ListBunchedHeadwaysRow{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/reports/delay-propagation", openapi.Op{
+		Tag:     "reports",
+		Summary: "Delay gained en route against delay inherited from other trains",
+		Params:  []openapi.Parameter{period, trainNo, openapi.Query("limit", "integer", "")},
+		Response: openapi.Object{
+			"period": "", "since": "", "total": 0, "gained_min": int64(0), "inherited_min": int64(0),
+			"own_min": int64(0), "inherited_pct": 0.0, "runs": []db.ListRunDelayAttributionRow{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/reports/weather", openapi.Op{
+		Tag:      "reports",
+		Summary:  "Delays by weather condition",
+		Params:   []openapi.Parameter{period, openapi.Query("division", "string", "Only this division.")},
+		Response: openapi.Object{"period": "", "since": "", "division": "", "conditions": []db.ListWeatherDelaysRow{}},
+		CSV:      true,
+	})
+	d.Add("GET", "/v1/reports/journey-time", openapi.Op{
+		Tag:     "reports",
+		Summary: "Actual journey times between two stations",
+		Params: []openapi.Parameter{
+			openapi.Required("from", "string", "Station code."),
+			openapi.Required("to", "string", "Station code."),
+			trainNo, period, minQuality,
+		},
+		Response: openapi.Object{
+			"from": "", "to": "", "period": "", "since": "",
+			"overall": (*handlers.JourneyTimeStats)(nil), "trains": []handlers.JourneyTimeStats{},
+		},
+		CSV: true,
+	})
+	d.Add("GET", "/v1/reports/coverage", openapi.Op{
+		Tag:     "reports",
+		Summary: "How completely runs were tracked",
+		Params:  []openapi.Parameter{openapi.Query("group_by", "string", "day, train or run."), period, trainNo},
+		Response: openapi.Object{
+			"group_by": "", "period": "", "since": "", "total": 0, "groups": []handlers.RunCoverage{},
+		},
+		CSV: true,
+	})
+
+	// admin
+	d.Add("GET", "/admin/gtfs.zip", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Static GTFS feed of the timetable",
+		Params:      []openapi.Parameter{openapi.Query("days", "integer", "Length of the service calendar from today.")},
+		Response:    []byte{},
+		ContentType: "application/zip",
+		Scope:       auth.ScopeAdmin,
+	})
+	d.Add("POST", "/admin/sync", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Sync trains from IRI now",
+		Description: "Every train when sent without a body. Only one sync runs at a time, a second gets 409.",
+		Body:        openapi.Object{"train_nos": []int64{}},
+		Response:    iri.Job{},
+		Status:      http.StatusAccepted,
+		Scope:       auth.ScopeWrite,
+	})
+	d.Add("GET", "/admin/sync/{job_id}", openapi.Op{
+		Tag:      "admin",
+		Summary:  "Progress of an on demand sync",
+		Response: iri.Job{},
+		Scope:    auth.ScopeWrite,
+	})
+	d.Add("POST", "/admin/runs/{run_id}/poll", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Poll a run now",
+		Description: "Polls whereismytrain for the run immediately, ignoring the poll window, its start time and the error thresholds.",
+		Response:    poller.CycleResult{},
+		Scope:       auth.ScopeWrite,
+	})
+	d.Add("GET", "/admin/poller", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Poller state",
+		Description: "Whether the poller of this process is paused and the settings it currently works to.",
+		Response:    poller.ControlStatus{},
+		Scope:       auth.ScopeAdmin,
+	})
+	d.Add("POST", "/admin/poller/pause", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Pause polling",
+		Description: "No new cycles start until resumed, the one in progress finishes. 409 when no poller runs in this process.",
+		Response:    poller.ControlStatus{},
+		Scope:       auth.ScopeAdmin,
+	})
+	d.Add("POST", "/admin/poller/resume", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Resume polling",
+		Description: "Starts a cycle straight away.",
+		Response:    poller.ControlStatus{},
+		Scope:       auth.ScopeAdmin,
+	})
+	d.Add("PATCH", "/admin/poller/config", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Retune the poller",
+		Description: "Changes the given settings until the next restart. Durations are Go durations such as \"90s\"; max_runs_per_cycle 0 polls every due run.",
+		Body: openapi.Object{
+			"concurrency": int16(0), "pre_departure_workers": int16(0), "window": "1m", "static_error_threshold": int8(0), "stall_threshold": "20m",
+			"max_runs_per_cycle": 0, "backoff_base": "2m", "backoff_max": "1h",
+		},
+		Response: poller.ControlStatus{},
+		Scope:    auth.ScopeAdmin,
+	})
+	d.Add("GET", "/admin/tracked-trains", openapi.Op{
+		Tag:      "admin",
+		Summary:  "Train pages the IRI sync covers",
+		Response: openapi.Object{"total": 0, "enabled": 0, "trains": []handlers.TrackedTrain{}},
+		Scope:    auth.ScopeWrite,
+	})
+	d.Add("POST", "/admin/tracked-trains", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Track a train page",
+		Description: "Adding a url that is already tracked updates it. The train is picked up by the next sync.",
+		Body:        openapi.Object{"source_url": "", "train_no": int64(0), "enabled": true, "note": ""},
+		Response:    handlers.TrackedTrain{},
+		Status:      http.StatusCreated,
+		Scope:       auth.ScopeWrite,
+	})
+	d.Add("PATCH", "/admin/tracked-trains/{tracked_id}", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Enable, disable or relabel a tracked train",
+		Description: "Fields left out keep their value.",
+		Body:        openapi.Object{"enabled": true, "train_no": int64(0), "note": ""},
+		Response:    handlers.TrackedTrain{},
+		Scope:       auth.ScopeWrite,
+	})
+	d.Add("DELETE", "/admin/tracked-trains/{tracked_id}", openapi.Op{
+		Tag:     "admin",
+		Summary: "Stop tracking a train",
+		Status:  http.StatusNoContent,
+		Scope:   auth.ScopeWrite,
+	})
+	d.Add("GET", "/admin/webhooks", openapi.Op{
+		Tag:      "admin",
+		Summary:  "Webhook subscriptions with their delivery counts",
+		Response: openapi.Object{"total": 0, "subscriptions": []handlers.WebhookSubscription{}},
+		Scope:    auth.ScopeWrite,
+	})
+	d.Add("POST", "/admin/webhooks", openapi.Op{
+		Tag:     "admin",
+		Summary: "Subscribe a URL to run events",
+		Description: "Events are run.started, run.delay_changed, run.cancelled and run.arrived, or * for all. " +
+			"run.delay_changed fires once the delay has moved by delay_threshold_min (default 15) from the delay last sent. " +
+			"Each event is POSTed as JSON with X-Trano-Event, X-Trano-Delivery, X-Trano-Timestamp and X-Trano-Signature, " +
+			"the latter \"sha256=\" and the hex HMAC-SHA256 of \"<timestamp>.<body>\" keyed with the secret, which is only in this response. " +
+			"Anything but a 2xx is retried with exponential backoff until WEBHOOK_MAX_ATTEMPTS.",
+		Body:     openapi.Object{"url": "", "events": []string{"run.started"}, "train_no": int64(0), "delay_threshold_min": int64(15), "active": true, "note": ""},
+		Response: openapi.Object{"id": int64(0), "url": "", "events": []string{}, "secret": "", "created_at": ""},
+		Status:   http.StatusCreated,
+		Scope:    auth.ScopeWrite,
+	})
+	d.Add("PATCH", "/admin/webhooks/{webhook_id}", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Change or pause a webhook subscription",
+		Description: "Fields left out keep their value. Events that fire while a subscription is paused are not sent later.",
+		Body:        openapi.Object{"url": "", "events": []string{"run.started"}, "train_no": int64(0), "delay_threshold_min": int64(15), "active": true, "note": ""},
+		Response:    handlers.WebhookSubscription{},
+		Scope:       auth.ScopeWrite,
+	})
+	d.Add("DELETE", "/admin/webhooks/{webhook_id}", openapi.Op{
+		Tag:     "admin",
+		Summary: "Remove a webhook subscription and its pending deliveries",
+		Status:  http.StatusNoContent,
+		Scope:   auth.ScopeWrite,
+	})
+	d.Add("GET", "/admin/webhooks/{webhook_id}/deliveries", openapi.Op{
+		Tag:      "admin",
+		Summary:  "Latest deliveries of a webhook subscription",
+		Params:   []openapi.Parameter{openapi.Query("limit", "integer", "Deliveries to return, newest first, 1 to 500 (default 50).")},
+		Response: openapi.Object{"webhook_id": int64(0), "total": 0, "deliveries": []handlers.WebhookDelivery{}},
+		Scope:    auth.ScopeWrite,
+	})
+	d.Add("GET", "/admin/keys", openapi.Op{
+		Tag:      "admin",
+		Summary:  "API keys, without the keys themselves",
+		Response: openapi.Object{"total": 0, "keys": []handlers.APIKey{}},
+		Scope:    auth.ScopeKeys,
+	})
+	d.Add("POST", "/admin/keys", openapi.Op{
+		Tag:         "admin",
+		Summary:     "Issue an API key",
+		Description: "The key is only part of this response.",
+		Body:        openapi.Object{"name": "", "scopes": []string{}},
+		Response: openapi.Object{
+			"id": int64(0), "name": "", "key": "", "key_prefix": "", "scopes": []string{}, "created_at": "",
+		},
+		Status: http.StatusCreated,
+		Scope:  auth.ScopeKeys,
+	})
+	d.Add("DELETE", "/admin/keys/{key_id}", openapi.Op{
+		Tag:     "admin",
+		Summary: "Revoke an API key",
+		Status:  http.StatusNoContent,
+		Scope:   auth.ScopeKeys,
+	})
+
+	return d
+}
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+)
+
+// serveSpec answers GET /openapi.json, the document is built once
+func (s *Server) serveSpec(w http.ResponseWriter, r *http.Request) {
+	specOnce.Do(func() {
+		var err error
+		if specJSON, err = json.Marshal(spec()); err != nil {
+			s.logger.Printf("api: failed to encode openapi spec: %v", err)
+		}
+	})
+	if specJSON == nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(specJSON)
+}
+
+const swaggerVersion = "5.17.14"
+
+const swaggerPage = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Trano API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerVersion + `/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@` + swaggerVersion + `/swagger-ui-bundle.js"></script>
+<script src="/docs/init.js"></script>
+</body>
+</html>
+`
+
+// kept out of the page so the CSP needs no 'unsafe-inline' for scripts
+const swaggerInit = `window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+`
+
+// serveDocs answers GET /docs with Swagger UI over /openapi.json
+func (s *Server) serveDocs(w http.ResponseWriter, r *http.Request) {
+	// loosens the Security middleware's CSP for this page only
+	w.Header().Set("Content-Security-Policy",
+		"default-src 'none'; script-src 'self' https://unpkg.com; style-src https://unpkg.com; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'; base-uri 'none';")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerPage))
+}
+
+func (s *Server) serveDocsInit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerInit))
+}
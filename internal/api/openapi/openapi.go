@@ -0,0 +1,383 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Document is an OpenAPI 3.0 description of the API. Response schemas are derived
+// from the Go values the handlers encode, so the spec follows the code.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	types      map[reflect.Type]string
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case methods to operations
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Object is an ad hoc JSON object, the map[string]any payloads of the handlers. Each
+// value is an example of its field's Go type.
+type Object map[string]any
+
+// OneOf is a response whose shape depends on the request
+type OneOf []any
+
+// Op describes one route for Add
+type Op struct {
+	Tag         string
+	Summary     string
+	Description string
+	Params      []Parameter
+	Body        any // example request body, nil for none
+	Response    any // example response value, nil for no body
+	Status      int // success status, 200 when zero
+	ContentType string
+	CSV         bool   // format=csv is supported
+	GeoJSON     bool   // format=geojson is supported
+	Protobuf    bool   // protobuf by default, its JSON mapping on request
+	Cursor      bool   // paginated with limit and cursor
+	Scope       string // API key scope required, empty for open routes
+}
+
+// fixed point integer encodings, recognised by the field name suffix
+var encodings = []struct {
+	suffix, description string
+}{
+	{"_u6", "Fixed point micro-degrees (u6): divide by 1e6 for decimal degrees."},
+	{"_u4", "Fixed point in units of 1e-4 (u4): divide by 1e4, distances are then in km and fractions in 0..1."},
+}
+
+var pathParam = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", Description: "API key as a bearer token"},
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+		types: map[reflect.Type]string{},
+	}
+}
+
+func (d *Document) AddTag(name, description string) {
+	d.Tags = append(d.Tags, Tag{Name: name, Description: description})
+}
+
+// Add registers a route, path parameters are taken from the path
+func (d *Document) Add(method, path string, op Op) {
+	o := &Operation{
+		Summary:     op.Summary,
+		Description: op.Description,
+		OperationID: operationID(method, path),
+		Responses:   map[string]Response{},
+	}
+	if op.Tag != "" {
+		o.Tags = []string{op.Tag}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		o.Parameters = append(o.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	o.Parameters = append(o.Parameters, op.Params...)
+	if op.Cursor {
+		o.Parameters = append(o.Parameters,
+			Query("limit", "integer", "Page size."),
+			Query("cursor", "string", "next_cursor of the previous page."),
+		)
+	}
+	var formats []string
+	if op.Protobuf {
+		formats = append(formats, "json for the JSON mapping of the protobuf message, also chosen by Accept: application/json.")
+	}
+	if op.CSV {
+		formats = append(formats, "csv for a CSV download of the same data.")
+	}
+	if op.GeoJSON {
+		formats = append(formats, "geojson for a GeoJSON FeatureCollection, also chosen by Accept: application/geo+json.")
+	}
+	if len(formats) > 0 {
+		o.Parameters = append(o.Parameters, Query("format", "string", strings.Join(formats, " ")))
+	}
+
+	if op.Body != nil {
+		o.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: d.Schema(op.Body)},
+		}}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := Response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		ct := op.ContentType
+		if ct == "" {
+			ct = "application/json"
+		}
+		ok.Content = map[string]MediaType{ct: {Schema: d.Schema(op.Response)}}
+		if op.Protobuf {
+			ok.Content["application/x-protobuf"] = ok.Content[ct]
+			ok.Content["application/json"] = ok.Content[ct]
+		}
+		if op.CSV {
+			ok.Content["text/csv"] = MediaType{Schema: &Schema{Type: "string"}}
+		}
+		if op.GeoJSON {
+			ok.Content["application/geo+json"] = MediaType{Schema: &Schema{Type: "object", Description: "GeoJSON FeatureCollection"}}
+		}
+	}
+	if op.Cursor {
+		ok.Headers = map[string]Header{
+			"X-Next-Cursor": {Description: "Cursor of the next page, absent on the last one.", Schema: &Schema{Type: "string"}},
+		}
+	}
+	o.Responses[fmt.Sprint(status)] = ok
+	o.Responses["400"] = Response{Description: "Invalid parameters"}
+	if op.Scope != "" {
+		o.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+		o.Description = strings.TrimSpace(o.Description + "\n\nRequires an API key with the `" + op.Scope + "` scope.")
+		o.Responses["401"] = Response{Description: "Missing or invalid API key"}
+		o.Responses["403"] = Response{Description: "API key lacks the scope"}
+	}
+
+	item := d.Paths[path]
+	if item == nil {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = o
+}
+
+// Query is an optional query parameter of an OpenAPI primitive type
+func Query(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: typ}}
+}
+
+// Required is a query parameter that must be given
+func Required(name, typ, description string) Parameter {
+	p := Query(name, typ, description)
+	p.Required = true
+	return p
+}
+
+// Schema describes the JSON encoding of v, named structs become components
+func (d *Document) Schema(v any) *Schema {
+	switch v := v.(type) {
+	case Object:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for name, field := range v {
+			s.Properties[name] = d.field(name, d.Schema(field))
+		}
+		return s
+	case OneOf:
+		s := &Schema{}
+		for _, alt := range v {
+			s.OneOf = append(s.OneOf, d.Schema(alt))
+		}
+		return s
+	case nil:
+		return &Schema{}
+	}
+	return d.typeSchema(reflect.TypeOf(v))
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (d *Document) typeSchema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := d.typeSchema(t.Elem())
+		if s.Ref != "" {
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.typeSchema(t.Elem())}
+	case reflect.Struct:
+		return d.structSchema(t)
+	}
+	// interfaces and anything else can hold any JSON value
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return d.properties(t)
+	}
+	if name, ok := d.types[t]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	name := t.Name()
+	if _, taken := d.Components.Schemas[name]; taken {
+		name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+	}
+	// registered before the fields so recursive types end in a reference
+	d.types[t] = name
+	d.Components.Schemas[name] = &Schema{}
+	*d.Components.Schemas[name] = *d.properties(t)
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (d *Document) properties(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range d.properties(f.Type).Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.field(name, d.typeSchema(f.Type))
+	}
+	return s
+}
+
+// field adds the description of a fixed point encoding to integer fields named after it
+func (d *Document) field(name string, s *Schema) *Schema {
+	if s.Type != "integer" {
+		return s
+	}
+	for _, e := range encodings {
+		if strings.HasSuffix(name, e.suffix) {
+			s.Description = e.description
+		}
+	}
+	return s
+}
+
+// operationID turns GET /v1/runs/{run_id}/eta into get_v1_runs_run_id_eta
+func operationID(method, path string) string {
+	id := strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_", ".", "_").Replace(path)
+	return strings.TrimSuffix(id, "_")
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"trano/internal/api/handlers"
+	"trano/internal/auth"
+	"trano/internal/metrics"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// registerRoutes mounts the unversioned service endpoints and one group per API
+// version. Every group shares the stack of setupMiddleware, a version that needs more
+// adds it in its own group. A /v2 would be mounted next to /v1 with its own routesV2,
+// reusing the v1 handlers wherever the response did not change.
+func (s *Server) registerRoutes(r chi.Router) {
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"status":    "ok",
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+		})
+	})
+
+	r.Get("/healthz/detail", s.serveHealthDetail)
+
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	r.Get("/openapi.json", s.serveSpec)
+	r.Get("/docs", s.serveDocs)
+	r.Get("/docs/init.js", s.serveDocsInit)
+
+	if s.graphQLHandler != nil {
+		r.Get("/graphql", s.graphQLHandler.ServeGraphQL)
+		r.Post("/graphql", s.graphQLHandler.ServeGraphQL)
+	}
+
+	r.Route("/v1", s.routesV1)
+	// operator endpoints are not part of the versioned API
+	r.Route("/admin", s.adminRoutes)
+}
+
+// routesV1 is the public v1 API and its CSV mirrors
+func (s *Server) routesV1(r chi.Router) {
+	r.Get("/trains/live", s.trainHandler.GetLiveTrains)
+	r.Get("/trains/nearby", s.trainHandler.ListNearbyTrains)
+	r.Get("/live/ws", s.trainHandler.StreamLiveTrains)
+	r.Get("/live/delta", s.trainHandler.GetLiveDelta)
+	r.Get("/live/wait", s.trainHandler.WaitLiveDelta)
+	r.Get("/tiles/live/{z}/{x}/{y}.mvt", s.trainHandler.GetLiveTile)
+
+	r.Get("/runs", s.runHandler.ListRuns)
+	r.Post("/runs/batch", s.runHandler.BatchRunStatus)
+	if s.cfg.Push {
+		r.Post("/push/subscriptions", s.runHandler.SubscribePush)
+		r.Delete("/push/subscriptions", s.runHandler.UnsubscribePush)
+	}
+	r.Get("/runs/{run_id}/locations", s.runHandler.GetRunLocations)
+	r.Get("/runs/{run_id}/delays", s.runHandler.GetRunDelays)
+	r.Get("/runs/{run_id}/eta", s.runHandler.GetRunETA)
+	r.Get("/runs/{run_id}/encounters", s.runHandler.GetRunEncounters)
+	r.Get("/runs/{run_id}/distance-time", s.runHandler.GetRunDistanceTime)
+	r.Get("/runs/{train_no}/{run_date}/events", s.runHandler.StreamRunEvents)
+	r.Get("/runs/{train_no}/{run_date}/replay", s.runHandler.StreamRunReplay)
+	r.Get("/runs/{train_no}/{run_date}/timeline", s.runHandler.GetRunTimeline)
+	r.Get("/runs/{train_no}/{run_date}/compare", s.runHandler.CompareRun)
+	r.Get("/runs/{train_no}/{run_date}/eta/{station_code}", s.runHandler.GetRunStationETA)
+
+	r.Get("/trains/{train_no}/timetable", s.trainHandler.GetTrainTimetable)
+	r.Get("/trains/{train_no}/calendar", s.runHandler.GetTrainCalendar)
+	r.Get("/trains/{train_no}/rake", s.trainHandler.GetTrainRake)
+	r.Get("/schedules/{schedule_id}/shape", s.trainHandler.GetScheduleShape)
+
+	r.Get("/anomalies", s.runHandler.ListAnomalies)
+
+	r.Get("/history/{date}/snapshot", s.runHandler.GetHistorySnapshot)
+	r.Get("/history/positions", s.runHandler.GetHistoryPositions)
+
+	r.Get("/stations/search", s.stationHandler.SearchStations)
+	r.Get("/stations/nearby", s.stationHandler.ListNearbyStations)
+	r.Get("/journeys", s.stationHandler.ListJourneys)
+	r.Get("/departures/nearby", s.stationHandler.ListNearbyDepartures)
+	r.Get("/stations/{station_code}/board", s.stationHandler.GetStationBoard)
+	r.Get("/stations/{station_code}/live", s.stationHandler.ListTrainsAtStation)
+	r.Get("/stations/{station_code}/congestion", s.analyticsHandler.GetStationCongestion)
+	r.Get("/stations/{station_code}/headways", s.analyticsHandler.GetStationHeadways)
+
+	r.Get("/segments/slowest", s.analyticsHandler.ListSlowestSegments)
+	r.Get("/segments/{from}/{to}", s.analyticsHandler.GetSegmentSpeed)
+
+	r.Get("/sections/occupancy", s.analyticsHandler.ListSectionOccupancy)
+
+	r.Get("/stats/delays", s.analyticsHandler.ListMostDelayedRuns)
+
+	r.Get("/reports/leaderboard", s.analyticsHandler.GetLeaderboard)
+	r.Get("/reports/delay-heatmap", s.analyticsHandler.GetDelayHeatmap)
+	r.Get("/reports/congestion", s.analyticsHandler.ListCongestedStations)
+	r.Get("/reports/daily", s.analyticsHandler.GetDailySummary)
+	r.Get("/reports/zones", s.analyticsHandler.GetZonePunctuality)
+	r.Get("/reports/headways", s.analyticsHandler.ListBunchedHeadways)
+	r.Get("/reports/delay-propagation", s.analyticsHandler.GetDelayPropagation)
+	r.Get("/reports/weather", s.analyticsHandler.GetWeatherDelays)
+	r.Get("/reports/journey-time", s.analyticsHandler.GetJourneyTime)
+	r.Get("/reports/coverage", s.analyticsHandler.GetCoverage)
+
+	// admin used to live here, 308 keeps the method and body on the way over
+	r.HandleFunc("/admin/*", func(w http.ResponseWriter, r *http.Request) {
+		target := "/admin/" + chi.URLParam(r, "*")
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+	// CSV-only mirrors of the list endpoints for spreadsheet/pandas use
+	r.Route("/export", s.exportRoutes)
+}
+
+// adminRoutes need an API key, each group with the scope its actions call for
+func (s *Server) adminRoutes(r chi.Router) {
+	r.With(s.requireScope(auth.ScopeAdmin)).Get("/gtfs.zip", s.adminHandler.ExportGTFS)
+
+	r.Route("/sync", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeWrite))
+		r.Post("/", s.adminHandler.StartSync)
+		r.Get("/{job_id}", s.adminHandler.GetSync)
+	})
+
+	r.With(s.requireScope(auth.ScopeWrite)).Post("/runs/{run_id}/poll", s.adminHandler.PollRun)
+
+	r.Route("/poller", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeAdmin))
+		r.Get("/", s.adminHandler.GetPoller)
+		r.Post("/pause", s.adminHandler.PausePoller)
+		r.Post("/resume", s.adminHandler.ResumePoller)
+		r.Patch("/config", s.adminHandler.TunePoller)
+	})
+
+	r.Route("/tracked-trains", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeWrite))
+		r.Get("/", s.adminHandler.ListTrackedTrains)
+		r.Post("/", s.adminHandler.AddTrackedTrain)
+		r.Patch("/{tracked_id}", s.adminHandler.UpdateTrackedTrain)
+		r.Delete("/{tracked_id}", s.adminHandler.DeleteTrackedTrain)
+	})
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeWrite))
+		r.Get("/", s.adminHandler.ListWebhooks)
+		r.Post("/", s.adminHandler.CreateWebhook)
+		r.Patch("/{webhook_id}", s.adminHandler.UpdateWebhook)
+		r.Delete("/{webhook_id}", s.adminHandler.DeleteWebhook)
+		r.Get("/{webhook_id}/deliveries", s.adminHandler.ListWebhookDeliveries)
+	})
+
+	r.Route("/keys", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeKeys))
+		r.Get("/", s.adminHandler.ListAPIKeys)
+		r.Post("/", s.adminHandler.CreateAPIKey)
+		r.Delete("/{key_id}", s.adminHandler.RevokeAPIKey)
+	})
+}
+
+func (s *Server) exportRoutes(r chi.Router) {
+	r.Get("/runs", handlers.ExportCSV(s.runHandler.ListRuns))
+	r.Get("/runs/{run_id}/locations", handlers.ExportCSV(s.runHandler.GetRunLocations))
+	r.Get("/runs/{run_id}/delays", handlers.ExportCSV(s.runHandler.GetRunDelays))
+	r.Get("/runs/{run_id}/eta", handlers.ExportCSV(s.runHandler.GetRunETA))
+	r.Get("/runs/{run_id}/encounters", handlers.ExportCSV(s.runHandler.GetRunEncounters))
+	r.Get("/runs/{run_id}/distance-time", handlers.ExportCSV(s.runHandler.GetRunDistanceTime))
+	r.Get("/runs/{train_no}/{run_date}/timeline", handlers.ExportCSV(s.runHandler.GetRunTimeline))
+	r.Get("/runs/{train_no}/{run_date}/compare", handlers.ExportCSV(s.runHandler.CompareRun))
+	r.Get("/trains/{train_no}/timetable", handlers.ExportCSV(s.trainHandler.GetTrainTimetable))
+	r.Get("/trains/{train_no}/calendar", handlers.ExportCSV(s.runHandler.GetTrainCalendar))
+	r.Get("/trains/{train_no}/rake", handlers.ExportCSV(s.trainHandler.GetTrainRake))
+	r.Get("/anomalies", handlers.ExportCSV(s.runHandler.ListAnomalies))
+	r.Get("/history/{date}/snapshot", handlers.ExportCSV(s.runHandler.GetHistorySnapshot))
+	r.Get("/history/positions", handlers.ExportCSV(s.runHandler.GetHistoryPositions))
+	r.Get("/stations/search", handlers.ExportCSV(s.stationHandler.SearchStations))
+	r.Get("/stations/nearby", handlers.ExportCSV(s.stationHandler.ListNearbyStations))
+	r.Get("/journeys", handlers.ExportCSV(s.stationHandler.ListJourneys))
+	r.Get("/departures/nearby", handlers.ExportCSV(s.stationHandler.ListNearbyDepartures))
+	r.Get("/stations/{station_code}/board", handlers.ExportCSV(s.stationHandler.GetStationBoard))
+	r.Get("/stations/{station_code}/live", handlers.ExportCSV(s.stationHandler.ListTrainsAtStation))
+	r.Get("/stations/{station_code}/congestion", handlers.ExportCSV(s.analyticsHandler.GetStationCongestion))
+	r.Get("/stations/{station_code}/headways", handlers.ExportCSV(s.analyticsHandler.GetStationHeadways))
+	r.Get("/segments/slowest", handlers.ExportCSV(s.analyticsHandler.ListSlowestSegments))
+	r.Get("/sections/occupancy", handlers.ExportCSV(s.analyticsHandler.ListSectionOccupancy))
+	r.Get("/stats/delays", handlers.ExportCSV(s.analyticsHandler.ListMostDelayedRuns))
+	r.Get("/reports/leaderboard", handlers.ExportCSV(s.analyticsHandler.GetLeaderboard))
+	r.Get("/reports/delay-heatmap", handlers.ExportCSV(s.analyticsHandler.GetDelayHeatmap))
+	r.Get("/reports/congestion", handlers.ExportCSV(s.analyticsHandler.ListCongestedStations))
+	r.Get("/reports/daily", handlers.ExportCSV(s.analyticsHandler.GetDailySummary))
+	r.Get("/reports/zones", handlers.ExportCSV(s.analyticsHandler.GetZonePunctuality))
+	r.Get("/reports/headways", handlers.ExportCSV(s.analyticsHandler.ListBunchedHeadways))
+	r.Get("/reports/delay-propagation", handlers.ExportCSV(s.analyticsHandler.GetDelayPropagation))
+	r.Get("/reports/weather", handlers.ExportCSV(s.analyticsHandler.GetWeatherDelays))
+	r.Get("/reports/journey-time", handlers.ExportCSV(s.analyticsHandler.GetJourneyTime))
+	r.Get("/reports/coverage", handlers.ExportCSV(s.analyticsHandler.GetCoverage))
+}
@@ -0,0 +1,306 @@
+// Package rpc serves gRPC over net/http's HTTP/2 server. It covers what the API needs,
+// unary and server streaming methods with uncompressed protobuf messages, without
+// pulling in grpc-go.
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// maxMessageSize bounds a request message, every request the API takes is a few fields
+const maxMessageSize = 1 << 20
+
+// Code is a gRPC status code
+type Code uint32
+
+const (
+	OK                Code = 0
+	Canceled          Code = 1
+	Unknown           Code = 2
+	InvalidArgument   Code = 3
+	DeadlineExceeded  Code = 4
+	NotFound          Code = 5
+	ResourceExhausted Code = 8
+	Unimplemented     Code = 12
+	Internal          Code = 13
+	Unavailable       Code = 14
+)
+
+// Error is a status other than OK, handlers return one to pick the code clients see
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", e.Code, e.Message)
+}
+
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Stream sends the messages of a server streaming call
+type Stream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// Send writes one message and flushes it to the client
+func (s *Stream) Send(msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.SendRaw(data)
+}
+
+// SendRaw writes a message that is already marshalled
+func (s *Stream) SendRaw(data []byte) error {
+	if err := writeMessage(s.w, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// SetWriteDeadline bounds the next sends, a zero time removes the bound
+func (s *Stream) SetWriteDeadline(t time.Time) {
+	_ = s.rc.SetWriteDeadline(t)
+}
+
+type method struct {
+	newRequest func() proto.Message
+	unary      func(ctx context.Context, req proto.Message) (proto.Message, error)
+	stream     func(ctx context.Context, req proto.Message, s *Stream) error
+}
+
+// Server dispatches /<service>/<method> requests to the registered methods
+type Server struct {
+	service string
+	logger  *log.Logger
+	methods map[string]method
+}
+
+// NewServer serves the methods of one service, named with its proto package
+// (trano.api.v1.Trains)
+func NewServer(service string, logger *log.Logger) *Server {
+	return &Server{
+		service: service,
+		logger:  logger,
+		methods: map[string]method{},
+	}
+}
+
+// Unary registers a method taking and returning one message
+func Unary[Req, Resp proto.Message](s *Server, name string, fn func(context.Context, Req) (Resp, error)) {
+	s.methods[name] = method{
+		newRequest: newMessage[Req],
+		unary: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return fn(ctx, req.(Req))
+		},
+	}
+}
+
+// ServerStream registers a method taking one message and sending any number back
+func ServerStream[Req proto.Message](s *Server, name string, fn func(context.Context, Req, *Stream) error) {
+	s.methods[name] = method{
+		newRequest: newMessage[Req],
+		stream: func(ctx context.Context, req proto.Message, st *Stream) error {
+			return fn(ctx, req.(Req), st)
+		},
+	}
+}
+
+func newMessage[M proto.Message]() proto.Message {
+	var zero M
+	return zero.ProtoReflect().New().Interface()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "application/grpc" && contentType != "application/grpc+proto" {
+		http.Error(w, "unsupported content type, expected application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	service, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	m, ok := s.methods[name]
+	if service != s.service || !ok {
+		writeStatus(w, false, Errorf(Unimplemented, "unknown method %s", r.URL.Path))
+		return
+	}
+
+	ctx := r.Context()
+	if raw := r.Header.Get("Grpc-Timeout"); raw != "" {
+		timeout, err := parseTimeout(raw)
+		if err != nil {
+			writeStatus(w, false, Errorf(InvalidArgument, "%v", err))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req := m.newRequest()
+	if err := readMessage(r.Body, req); err != nil {
+		writeStatus(w, false, err)
+		return
+	}
+
+	if m.unary != nil {
+		resp, err := m.unary(ctx, req)
+		if err != nil {
+			writeStatus(w, false, s.status(r, err))
+			return
+		}
+		data, err := proto.Marshal(resp)
+		if err != nil {
+			writeStatus(w, false, s.status(r, err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if err := writeMessage(w, data); err != nil {
+			return
+		}
+		writeStatus(w, true, nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	st := &Stream{w: w, rc: http.NewResponseController(w)}
+	// the headers go out now, clients wait for them before the first message
+	_ = st.rc.Flush()
+	writeStatus(w, true, s.status(r, m.stream(ctx, req, st)))
+}
+
+// status maps a handler error to the status sent to the client, errors that are not
+// an *Error are logged and hidden behind Internal
+func (s *Server) status(r *http.Request, err error) error {
+	var rpcErr *Error
+	switch {
+	case err == nil, errors.As(err, &rpcErr):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return Errorf(DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return Errorf(Canceled, "canceled")
+	}
+	s.logger.Printf("rpc: %s failed: %v", r.URL.Path, err)
+	return Errorf(Internal, "internal server error")
+}
+
+// writeStatus ends the call, as trailers once the headers are out or as a
+// trailers-only response before that
+func writeStatus(w http.ResponseWriter, headersSent bool, err error) {
+	code, msg := OK, ""
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: Unknown, Message: err.Error()}
+		}
+		code, msg = rpcErr.Code, rpcErr.Message
+	}
+
+	prefix := ""
+	if headersSent {
+		prefix = http.TrailerPrefix
+	}
+	w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(int(code)))
+	if msg != "" {
+		w.Header().Set(prefix+"Grpc-Message", encodeMessage(msg))
+	}
+	if !headersSent {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// encodeMessage percent-encodes grpc-message, everything but printable ASCII and '%'
+// passes through
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// readMessage reads the single length-prefixed message of a request
+func readMessage(body io.Reader, msg proto.Message) error {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return Errorf(InvalidArgument, "missing request message")
+	}
+	if prefix[0] != 0 {
+		return Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessageSize {
+		return Errorf(ResourceExhausted, "request message larger than %d bytes", maxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return Errorf(InvalidArgument, "truncated request message")
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return Errorf(InvalidArgument, "invalid request message: %v", err)
+	}
+	return nil
+}
+
+func writeMessage(w io.Writer, data []byte) error {
+	frame := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// parseTimeout reads grpc-timeout, up to eight digits and a unit
+func parseTimeout(raw string) (time.Duration, error) {
+	if len(raw) < 2 || len(raw) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", raw)
+	}
+	n, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", raw)
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[raw[len(raw)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid grpc-timeout unit in %q", raw)
+	}
+	return time.Duration(n) * unit, nil
+}
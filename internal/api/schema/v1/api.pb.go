@@ -126,16 +126,21 @@ func (x *TrainStatus) GetStatus() string {
 }
 
 type LiveTrain struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	TrainNo       uint32                 `protobuf:"varint,1,opt,name=train_no,json=trainNo,proto3" json:"train_no,omitempty"`
-	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	TypeId        uint32                 `protobuf:"varint,3,opt,name=type_id,json=typeId,proto3" json:"type_id,omitempty"`
-	LatU6         uint32                 `protobuf:"varint,4,opt,name=lat_u6,json=latU6,proto3" json:"lat_u6,omitempty"`
-	LngU6         uint32                 `protobuf:"varint,5,opt,name=lng_u6,json=lngU6,proto3" json:"lng_u6,omitempty"`
-	BearingDeg    uint32                 `protobuf:"varint,6,opt,name=bearing_deg,json=bearingDeg,proto3" json:"bearing_deg,omitempty"`
-	StatusId      uint32                 `protobuf:"varint,7,opt,name=status_id,json=statusId,proto3" json:"status_id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	TrainNo        uint32                 `protobuf:"varint,1,opt,name=train_no,json=trainNo,proto3" json:"train_no,omitempty"`
+	Name           string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	TypeId         uint32                 `protobuf:"varint,3,opt,name=type_id,json=typeId,proto3" json:"type_id,omitempty"`
+	LatU6          uint32                 `protobuf:"varint,4,opt,name=lat_u6,json=latU6,proto3" json:"lat_u6,omitempty"`
+	LngU6          uint32                 `protobuf:"varint,5,opt,name=lng_u6,json=lngU6,proto3" json:"lng_u6,omitempty"`
+	BearingDeg     uint32                 `protobuf:"varint,6,opt,name=bearing_deg,json=bearingDeg,proto3" json:"bearing_deg,omitempty"`
+	StatusId       uint32                 `protobuf:"varint,7,opt,name=status_id,json=statusId,proto3" json:"status_id,omitempty"`
+	LinkedTrainNos []uint32               `protobuf:"varint,8,rep,packed,name=linked_train_nos,json=linkedTrainNos,proto3" json:"linked_train_nos,omitempty"`
+	DelayMin       *int32                 `protobuf:"zigzag32,9,opt,name=delay_min,json=delayMin,proto3,oneof" json:"delay_min,omitempty"`
+	Extrapolated   bool                   `protobuf:"varint,10,opt,name=extrapolated,proto3" json:"extrapolated,omitempty"`
+	SpeedKmh       *float32               `protobuf:"fixed32,11,opt,name=speed_kmh,json=speedKmh,proto3,oneof" json:"speed_kmh,omitempty"`
+	AvgSpeedKmh    *float32               `protobuf:"fixed32,12,opt,name=avg_speed_kmh,json=avgSpeedKmh,proto3,oneof" json:"avg_speed_kmh,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *LiveTrain) Reset() {
@@ -217,15 +222,53 @@ func (x *LiveTrain) GetStatusId() uint32 {
 	return 0
 }
 
+func (x *LiveTrain) GetLinkedTrainNos() []uint32 {
+	if x != nil {
+		return x.LinkedTrainNos
+	}
+	return nil
+}
+
+func (x *LiveTrain) GetDelayMin() int32 {
+	if x != nil && x.DelayMin != nil {
+		return *x.DelayMin
+	}
+	return 0
+}
+
+func (x *LiveTrain) GetExtrapolated() bool {
+	if x != nil {
+		return x.Extrapolated
+	}
+	return false
+}
+
+func (x *LiveTrain) GetSpeedKmh() float32 {
+	if x != nil && x.SpeedKmh != nil {
+		return *x.SpeedKmh
+	}
+	return 0
+}
+
+func (x *LiveTrain) GetAvgSpeedKmh() float32 {
+	if x != nil && x.AvgSpeedKmh != nil {
+		return *x.AvgSpeedKmh
+	}
+	return 0
+}
+
 type LiveTrainsResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Statuses      []*TrainStatus         `protobuf:"bytes,1,rep,name=statuses,proto3" json:"statuses,omitempty"`
-	Types         []*TrainType           `protobuf:"bytes,2,rep,name=types,proto3" json:"types,omitempty"`
-	Trains        []*LiveTrain           `protobuf:"bytes,3,rep,name=trains,proto3" json:"trains,omitempty"`
-	Total         uint32                 `protobuf:"varint,4,opt,name=total,proto3" json:"total,omitempty"`
-	Timestamp     string                 `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Statuses        []*TrainStatus         `protobuf:"bytes,1,rep,name=statuses,proto3" json:"statuses,omitempty"`
+	Types           []*TrainType           `protobuf:"bytes,2,rep,name=types,proto3" json:"types,omitempty"`
+	Trains          []*LiveTrain           `protobuf:"bytes,3,rep,name=trains,proto3" json:"trains,omitempty"`
+	Total           uint32                 `protobuf:"varint,4,opt,name=total,proto3" json:"total,omitempty"`
+	Timestamp       string                 `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	RemovedTrainNos []uint32               `protobuf:"varint,6,rep,packed,name=removed_train_nos,json=removedTrainNos,proto3" json:"removed_train_nos,omitempty"`
+	Clusters        []*TrainCluster        `protobuf:"bytes,7,rep,name=clusters,proto3" json:"clusters,omitempty"`
+	TerminalRunIds  []string               `protobuf:"bytes,8,rep,name=terminal_run_ids,json=terminalRunIds,proto3" json:"terminal_run_ids,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
 func (x *LiveTrainsResponse) Reset() {
@@ -293,6 +336,27 @@ func (x *LiveTrainsResponse) GetTimestamp() string {
 	return ""
 }
 
+func (x *LiveTrainsResponse) GetRemovedTrainNos() []uint32 {
+	if x != nil {
+		return x.RemovedTrainNos
+	}
+	return nil
+}
+
+func (x *LiveTrainsResponse) GetClusters() []*TrainCluster {
+	if x != nil {
+		return x.Clusters
+	}
+	return nil
+}
+
+func (x *LiveTrainsResponse) GetTerminalRunIds() []string {
+	if x != nil {
+		return x.TerminalRunIds
+	}
+	return nil
+}
+
 type TrainRun struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RunId         string                 `protobuf:"bytes,1,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
@@ -409,6 +473,106 @@ func (x *TrainRun) GetUpdatedAt() string {
 	return ""
 }
 
+type TrainCluster struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LatU6         uint32                 `protobuf:"varint,1,opt,name=lat_u6,json=latU6,proto3" json:"lat_u6,omitempty"`
+	LngU6         uint32                 `protobuf:"varint,2,opt,name=lng_u6,json=lngU6,proto3" json:"lng_u6,omitempty"`
+	Count         uint32                 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	TypeId        uint32                 `protobuf:"varint,4,opt,name=type_id,json=typeId,proto3" json:"type_id,omitempty"`
+	MinLatU6      uint32                 `protobuf:"varint,5,opt,name=min_lat_u6,json=minLatU6,proto3" json:"min_lat_u6,omitempty"`
+	MinLngU6      uint32                 `protobuf:"varint,6,opt,name=min_lng_u6,json=minLngU6,proto3" json:"min_lng_u6,omitempty"`
+	MaxLatU6      uint32                 `protobuf:"varint,7,opt,name=max_lat_u6,json=maxLatU6,proto3" json:"max_lat_u6,omitempty"`
+	MaxLngU6      uint32                 `protobuf:"varint,8,opt,name=max_lng_u6,json=maxLngU6,proto3" json:"max_lng_u6,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TrainCluster) Reset() {
+	*x = TrainCluster{}
+	mi := &file_v1_api_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TrainCluster) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrainCluster) ProtoMessage() {}
+
+func (x *TrainCluster) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrainCluster.ProtoReflect.Descriptor instead.
+func (*TrainCluster) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TrainCluster) GetLatU6() uint32 {
+	if x != nil {
+		return x.LatU6
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetLngU6() uint32 {
+	if x != nil {
+		return x.LngU6
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetTypeId() uint32 {
+	if x != nil {
+		return x.TypeId
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetMinLatU6() uint32 {
+	if x != nil {
+		return x.MinLatU6
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetMinLngU6() uint32 {
+	if x != nil {
+		return x.MinLngU6
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetMaxLatU6() uint32 {
+	if x != nil {
+		return x.MaxLatU6
+	}
+	return 0
+}
+
+func (x *TrainCluster) GetMaxLngU6() uint32 {
+	if x != nil {
+		return x.MaxLngU6
+	}
+	return 0
+}
+
 var File_v1_api_proto protoreflect.FileDescriptor
 
 const file_v1_api_proto_rawDesc = "" +
@@ -419,7 +583,7 @@ const file_v1_api_proto_rawDesc = "" +
 	"\x04type\x18\x02 \x01(\tR\x04type\"5\n" +
 	"\vTrainStatus\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\rR\x02id\x12\x16\n" +
-	"\x06status\x18\x02 \x01(\tR\x06status\"\xbf\x01\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"\xa8\x03\n" +
 	"\tLiveTrain\x12\x19\n" +
 	"\btrain_no\x18\x01 \x01(\rR\atrainNo\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x17\n" +
@@ -428,13 +592,27 @@ const file_v1_api_proto_rawDesc = "" +
 	"\x06lng_u6\x18\x05 \x01(\rR\x05lngU6\x12\x1f\n" +
 	"\vbearing_deg\x18\x06 \x01(\rR\n" +
 	"bearingDeg\x12\x1b\n" +
-	"\tstatus_id\x18\a \x01(\rR\bstatusId\"\xdf\x01\n" +
+	"\tstatus_id\x18\a \x01(\rR\bstatusId\x12(\n" +
+	"\x10linked_train_nos\x18\b \x03(\rR\x0elinkedTrainNos\x12 \n" +
+	"\tdelay_min\x18\t \x01(\x11H\x00R\bdelayMin\x88\x01\x01\x12\"\n" +
+	"\fextrapolated\x18\n" +
+	" \x01(\bR\fextrapolated\x12 \n" +
+	"\tspeed_kmh\x18\v \x01(\x02H\x01R\bspeedKmh\x88\x01\x01\x12'\n" +
+	"\ravg_speed_kmh\x18\f \x01(\x02H\x02R\vavgSpeedKmh\x88\x01\x01B\f\n" +
+	"\n" +
+	"_delay_minB\f\n" +
+	"\n" +
+	"_speed_kmhB\x10\n" +
+	"\x0e_avg_speed_kmh\"\xed\x02\n" +
 	"\x12LiveTrainsResponse\x125\n" +
 	"\bstatuses\x18\x01 \x03(\v2\x19.trano.api.v1.TrainStatusR\bstatuses\x12-\n" +
 	"\x05types\x18\x02 \x03(\v2\x17.trano.api.v1.TrainTypeR\x05types\x12/\n" +
 	"\x06trains\x18\x03 \x03(\v2\x17.trano.api.v1.LiveTrainR\x06trains\x12\x14\n" +
 	"\x05total\x18\x04 \x01(\rR\x05total\x12\x1c\n" +
-	"\ttimestamp\x18\x05 \x01(\tR\ttimestamp\"\x9f\x02\n" +
+	"\ttimestamp\x18\x05 \x01(\tR\ttimestamp\x12*\n" +
+	"\x11removed_train_nos\x18\x06 \x03(\rR\x0fremovedTrainNos\x126\n" +
+	"\bclusters\x18\a \x03(\v2\x1a.trano.api.v1.TrainClusterR\bclusters\x12(\n" +
+	"\x10terminal_run_ids\x18\b \x03(\tR\x0eterminalRunIds\"\x9f\x02\n" +
 	"\bTrainRun\x12\x15\n" +
 	"\x06run_id\x18\x01 \x01(\tR\x05runId\x12\x19\n" +
 	"\btrain_no\x18\x02 \x01(\x03R\atrainNo\x12\x19\n" +
@@ -450,7 +628,20 @@ const file_v1_api_proto_rawDesc = "" +
 	"bearingDeg\x12\x1d\n" +
 	"\n" +
 	"updated_at\x18\n" +
-	" \x01(\tR\tupdatedAtB\x1eZ\x1ctrano/internal/api/schema/v1b\x06proto3"
+	" \x01(\tR\tupdatedAt\"\xe3\x01\n" +
+	"\fTrainCluster\x12\x15\n" +
+	"\x06lat_u6\x18\x01 \x01(\rR\x05latU6\x12\x15\n" +
+	"\x06lng_u6\x18\x02 \x01(\rR\x05lngU6\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\rR\x05count\x12\x17\n" +
+	"\atype_id\x18\x04 \x01(\rR\x06typeId\x12\x1c\n" +
+	"\n" +
+	"min_lat_u6\x18\x05 \x01(\rR\bminLatU6\x12\x1c\n" +
+	"\n" +
+	"min_lng_u6\x18\x06 \x01(\rR\bminLngU6\x12\x1c\n" +
+	"\n" +
+	"max_lat_u6\x18\a \x01(\rR\bmaxLatU6\x12\x1c\n" +
+	"\n" +
+	"max_lng_u6\x18\b \x01(\rR\bmaxLngU6B\x1eZ\x1ctrano/internal/api/schema/v1b\x06proto3"
 
 var (
 	file_v1_api_proto_rawDescOnce sync.Once
@@ -464,23 +655,25 @@ func file_v1_api_proto_rawDescGZIP() []byte {
 	return file_v1_api_proto_rawDescData
 }
 
-var file_v1_api_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_v1_api_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_v1_api_proto_goTypes = []any{
 	(*TrainType)(nil),          // 0: trano.api.v1.TrainType
 	(*TrainStatus)(nil),        // 1: trano.api.v1.TrainStatus
 	(*LiveTrain)(nil),          // 2: trano.api.v1.LiveTrain
 	(*LiveTrainsResponse)(nil), // 3: trano.api.v1.LiveTrainsResponse
 	(*TrainRun)(nil),           // 4: trano.api.v1.TrainRun
+	(*TrainCluster)(nil),       // 5: trano.api.v1.TrainCluster
 }
 var file_v1_api_proto_depIdxs = []int32{
 	1, // 0: trano.api.v1.LiveTrainsResponse.statuses:type_name -> trano.api.v1.TrainStatus
 	0, // 1: trano.api.v1.LiveTrainsResponse.types:type_name -> trano.api.v1.TrainType
 	2, // 2: trano.api.v1.LiveTrainsResponse.trains:type_name -> trano.api.v1.LiveTrain
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	5, // 3: trano.api.v1.LiveTrainsResponse.clusters:type_name -> trano.api.v1.TrainCluster
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_v1_api_proto_init() }
@@ -488,13 +681,14 @@ func file_v1_api_proto_init() {
 	if File_v1_api_proto != nil {
 		return
 	}
+	file_v1_api_proto_msgTypes[2].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v1_api_proto_rawDesc), len(file_v1_api_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
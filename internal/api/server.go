@@ -4,46 +4,82 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"trano/internal/api/handlers"
 	"trano/internal/api/middleware"
+	"trano/internal/api/rpc"
+	"trano/internal/auth"
 	"trano/internal/config"
 	dbutil "trano/internal/db"
 	db "trano/internal/db/sqlc"
+	"trano/internal/iri"
+	"trano/internal/metrics"
 	"trano/internal/poller"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 )
 
 type Server struct {
-	cfg    config.ServerConfig
-	logger *log.Logger
-	db     *sql.DB
-	srv    *http.Server
+	cfg     config.ServerConfig
+	logger  *log.Logger
+	db      *sql.DB
+	queries *db.Queries
+	srv     *http.Server
+	grpcSrv *http.Server // nil unless enabled
 
 	// Handlers
-	trainHandler *handlers.TrainHandler
+	trainHandler     *handlers.TrainHandler
+	runHandler       *handlers.RunHandler
+	stationHandler   *handlers.StationHandler
+	analyticsHandler *handlers.AnalyticsHandler
+	adminHandler     *handlers.AdminHandler
+	graphQLHandler   *handlers.GraphQLHandler // nil unless enabled
 }
 
-func NewServer(cfg config.ServerConfig, dbCfg config.DatabaseConfig, pollerCfg poller.Config, logger *log.Logger) (*Server, error) {
+func NewServer(cfg config.ServerConfig, dbCfg config.DatabaseConfig, pollerCfg poller.Config, syncJobs *iri.Jobs, loc *time.Location, logger *log.Logger) (*Server, error) {
 	dbConn, err := dbutil.OpenDatabase(dbCfg, dbutil.DefaultDatabaseOptions(), logger)
 	if err != nil {
 		return nil, err
 	}
-	queries := db.New(dbConn)
+	queries := db.New(dbutil.LogQueries(dbConn, logger, dbCfg.SlowQueryThreshold))
+	metrics.RegisterDB("api", dbConn)
+
+	if cfg.BootstrapAPIKey != "" {
+		if err := queries.EnsureAPIKey(context.Background(), db.EnsureAPIKeyParams{
+			Name:      "bootstrap",
+			KeyHash:   auth.Hash(cfg.BootstrapAPIKey),
+			KeyPrefix: auth.Display(cfg.BootstrapAPIKey),
+			Scopes:    auth.ScopeAll,
+		}); err != nil {
+			dbConn.Close()
+			return nil, fmt.Errorf("bootstrap api key: %w", err)
+		}
+	}
 
-	trainHandler := handlers.NewTrainHandler(queries, dbConn, logger)
+	trainHandler := handlers.NewTrainHandler(queries, dbConn, pollerCfg.Cycles, logger)
+	runHandler := handlers.NewRunHandler(queries, dbConn, logger, loc)
+	stationHandler := handlers.NewStationHandler(queries, dbConn, logger, loc)
+	analyticsHandler := handlers.NewAnalyticsHandler(queries, dbConn, logger, loc)
+	adminHandler := handlers.NewAdminHandler(queries, dbConn, syncJobs, poller.NewOnDemand(queries, dbConn, logger, pollerCfg, loc), pollerCfg.Control, logger, loc)
 
 	s := &Server{
-		cfg:          cfg,
-		logger:       logger,
-		db:           dbConn,
-		trainHandler: trainHandler,
+		cfg:              cfg,
+		logger:           logger,
+		db:               dbConn,
+		queries:          queries,
+		trainHandler:     trainHandler,
+		runHandler:       runHandler,
+		stationHandler:   stationHandler,
+		analyticsHandler: analyticsHandler,
+		adminHandler:     adminHandler,
+	}
+	if cfg.GraphQL {
+		s.graphQLHandler = handlers.NewGraphQLHandler(queries, logger, loc)
 	}
 
 	r := chi.NewRouter()
@@ -58,6 +94,23 @@ func NewServer(cfg config.ServerConfig, dbCfg config.DatabaseConfig, pollerCfg p
 		IdleTimeout:  cfg.IdleTimeout,
 	}
 
+	if cfg.GRPCAddr != "" {
+		svc := rpc.NewServer("trano.api.v1.Trains", logger)
+		handlers.NewTrainsService(queries, trainHandler, logger, loc).Register(svc)
+
+		// gRPC is HTTP/2 only, clients talk it without TLS so h2c is the one protocol
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		s.grpcSrv = &http.Server{
+			Addr:              cfg.GRPCAddr,
+			Handler:           middleware.Logging(logger)(svc),
+			Protocols:         &protocols,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			// StreamPositions runs for as long as the client stays, so no write timeout
+		}
+	}
+
 	return s, nil
 }
 
@@ -67,33 +120,23 @@ func (s *Server) setupMiddleware(r chi.Router) {
 	r.Use(chiMiddleware.RealIP)
 
 	r.Use(middleware.Logging(s.logger))
+	r.Use(middleware.Metrics)
 	r.Use(middleware.Security)
-
-	// CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:3000", "https://trano-frontend.vercel.app"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Request-ID"},
-		ExposedHeaders:   []string{"Link", "X-Request-ID", "X-Processing-Time"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
-}
-
-func (s *Server) registerRoutes(r chi.Router) {
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		s.writeJSON(w, http.StatusOK, map[string]string{
-			"status":    "ok",
-			"timestamp": time.Now().UTC().Format(time.RFC3339),
-		})
-	})
-
-	r.Route("/v1", func(r chi.Router) {
-		r.Get("/trains/live", s.trainHandler.GetLiveTrains)
-	})
+	// after Security so preflights answered here still carry its headers
+	r.Use(middleware.CORS(s.cfg.CORS))
+	r.Use(middleware.Gzip(s.cfg.GzipMinSize))
 }
 
 func (s *Server) Start() error {
+	if s.grpcSrv != nil {
+		go func() {
+			s.logger.Printf("api: starting gRPC server on %s", s.grpcSrv.Addr)
+			if err := s.grpcSrv.ListenAndServe(); err != http.ErrServerClosed {
+				s.logger.Printf("api: gRPC server failed: %v", err)
+			}
+		}()
+	}
+
 	s.logger.Printf("api: starting server on %s", s.srv.Addr)
 	if err := s.srv.ListenAndServe(); err != http.ErrServerClosed {
 		return err
@@ -107,6 +150,13 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	if err := s.srv.Shutdown(ctx); err != nil {
 		s.logger.Printf("api: server shutdown error: %v", err)
 	}
+	s.trainHandler.Close()
+	// after the live stream is closed, open StreamPositions calls would hold it up
+	if s.grpcSrv != nil {
+		if err := s.grpcSrv.Shutdown(ctx); err != nil {
+			s.logger.Printf("api: gRPC server shutdown error: %v", err)
+		}
+	}
 
 	if s.db != nil {
 		if err := s.db.Close(); err != nil {
@@ -119,6 +169,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// requireScope guards admin and write routes, everything else stays open
+func (s *Server) requireScope(scope string) func(http.Handler) http.Handler {
+	return middleware.RequireScope(s.queries, s.logger, scope)
+}
+
 func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes an API key can hold. Read endpoints are open and need none.
+const (
+	ScopeAdmin = "admin" // admin reads such as exports
+	ScopeWrite = "write" // changes to stored data and to the poller
+	ScopeKeys  = "keys"  // issuing and revoking keys
+
+	// ScopeAll grants every scope, for the bootstrap key
+	ScopeAll = "*"
+)
+
+var knownScopes = []string{ScopeAdmin, ScopeWrite, ScopeKeys, ScopeAll}
+
+const (
+	keyPrefix = "trano_"
+	// characters of a key kept in the clear to tell keys apart
+	displayLen = len(keyPrefix) + 6
+)
+
+// Key is the authenticated key of a request
+type Key struct {
+	ID     int64
+	Name   string
+	Scopes []string
+}
+
+func (k Key) Has(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAll)
+}
+
+// NewKey returns a fresh random key, it is only ever shown to whoever creates it
+func NewKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash is what gets stored and looked up in place of the key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Display is the start of a key, enough to recognise it in a listing
+func Display(key string) string {
+	if len(key) <= displayLen {
+		return key
+	}
+	return key[:displayLen]
+}
+
+// ParseScopes splits a space or comma separated scope list and rejects unknown scopes
+func ParseScopes(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	scopes := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !slices.Contains(knownScopes, f) {
+			return nil, fmt.Errorf("unknown scope %q", f)
+		}
+		if !slices.Contains(scopes, f) {
+			scopes = append(scopes, f)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("no scopes")
+	}
+	return scopes, nil
+}
+
+type ctxKey struct{}
+
+func WithKey(ctx context.Context, k Key) context.Context {
+	return context.WithValue(ctx, ctxKey{}, k)
+}
+
+// FromContext returns the key the request was authenticated with
+func FromContext(ctx context.Context) (Key, bool) {
+	k, ok := ctx.Value(ctxKey{}).(Key)
+	return k, ok
+}
@@ -3,15 +3,21 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Poller   PollerConfig
-	Syncer   SyncerConfig
-	Server   ServerConfig
-	Timezone string
+	Database   DatabaseConfig
+	Poller     PollerConfig
+	Syncer     SyncerConfig
+	Server     ServerConfig
+	Analytics  AnalyticsConfig
+	Simulation SimulationConfig
+	RateLimit  RateLimitConfig
+	Webhooks   WebhooksConfig
+	Push       PushConfig
+	Timezone   string
 }
 
 type DatabaseConfig struct {
@@ -20,29 +26,124 @@ type DatabaseConfig struct {
 	MaxIdleConnections    int
 	ConnectionMaxLifetime time.Duration
 	ConnectionMaxIdleTime time.Duration
+	SlowQueryThreshold    time.Duration // API queries slower than this are logged, 0 logs failures only
 }
 
 type PollerConfig struct {
 	Concurrency          int16
+	PreDepartureWorkers  int16
 	Window               time.Duration
 	ProxyURL             string
 	StaticErrorThreshold int8
-	TotalErrorThreshold  int8
+	StallThreshold       time.Duration
+	RecordDir            string
+	OriginInterval       time.Duration
+	DormantInterval      time.Duration
+	DormantAfter         time.Duration
+	TypeIntervals        string
+	MaxRunsPerCycle      int
+	BackoffBase          time.Duration
+	BackoffMax           time.Duration
+	BreakerFailureRate   float64
+	BreakerMinRequests   int
+	BreakerWindow        time.Duration
+	BreakerCooldown      time.Duration
+	BreakerProbes        int
+	FallbackURL          string
+	FallbackAPIKey       string
+	ArchiveRetention     time.Duration
+	KeepSchedules        bool
+	ScheduleRetention    time.Duration
+	PositionSmoothing    float64
+	NoDataAfter          time.Duration
+	OverdueAfter         time.Duration
+	ExtrapolateAfter     time.Duration
+	ExtrapolateFor       time.Duration
+	TransientRetries     int
+	TransientRetryDelay  time.Duration
+	LocationBatchSize    int
+	LocationFlush        time.Duration
+	LeaseTTL             time.Duration
+	LeaseMaxRuns         int
+	InstanceID           string
+	Sweeps               bool
 }
 
 type SyncerConfig struct {
 	Concurrency int16
 }
 
+type AnalyticsConfig struct {
+	RunHour            int
+	SegmentWindowDays  int
+	SegmentMaxSpeedKmh float64
+	SummaryWindowDays  int
+	ApproachMin        int
+	ProfileWindowDays  int
+	CoverageGapMin     int
+	WeatherProvider    string
+	WeatherURL         string
+	WeatherWindowDays  int
+}
+
+type SimulationConfig struct {
+	Enabled bool
+	Addr    string
+}
+
+type RateLimitConfig struct {
+	WIMTPerMinute float64
+	WIMTBurst     int
+	BlockCooldown time.Duration
+	SaveInterval  time.Duration
+}
+
+type WebhooksConfig struct {
+	Interval    time.Duration // how often due deliveries are sent
+	Timeout     time.Duration
+	MaxAttempts int
+	Concurrency int
+}
+
+type PushConfig struct {
+	CredentialsFile   string        // Firebase service account key, empty disables push notifications
+	Interval          time.Duration // how often runs queued by the poller are sent
+	Timeout           time.Duration
+	Concurrency       int
+	DelayThresholdMin int // delay movement since a device's last push that is worth another
+}
+
 type ServerConfig struct {
 	Addr            string
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	IdleTimeout     time.Duration
 	ShutdownTimeout time.Duration
+	GzipMinSize     int // bytes, smaller responses are sent uncompressed, negative disables gzip
+	CORS            CORSConfig
+	// DebugAddr serves pprof and expvar on a separate listener, empty disables it
+	DebugAddr string
+	// BootstrapAPIKey is kept as an all-scopes key so the first real keys can be issued
+	BootstrapAPIKey string
+	// GraphQL serves the read-only /graphql endpoint next to the REST API
+	GraphQL bool
+	// GRPCAddr serves the trano.api.v1.Trains gRPC service over cleartext HTTP/2, empty
+	// disables it
+	GRPCAddr string
+	// Push serves device registration for push notifications, on when FCM is configured
+	Push bool
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string // "*" allows any origin
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache a preflight
 }
 
 func Load() *Config {
+	pushCredentials := getEnv("PUSH_FCM_CREDENTIALS", "")
 	return &Config{
 		Database: DatabaseConfig{
 			Path:                  getEnv("DB_PATH", "./data/trano.db"),
@@ -50,13 +151,46 @@ func Load() *Config {
 			MaxIdleConnections:    getEnvAsInt("DB_MAX_IDLE_CONNS", 5),
 			ConnectionMaxLifetime: getEnvAsDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
 			ConnectionMaxIdleTime: getEnvAsDuration("DB_CONN_MAX_IDLE_TIME", 1*time.Minute),
+			SlowQueryThreshold:    getEnvAsDuration("DB_SLOW_QUERY_THRESHOLD", 250*time.Millisecond),
 		},
 		Poller: PollerConfig{
 			Concurrency:          int16(getEnvAsInt("POLLER_CONCURRENCY", 50)),
+			PreDepartureWorkers:  int16(getEnvAsInt("POLLER_PRE_DEPARTURE_WORKERS", 5)),
 			Window:               getEnvAsDuration("POLLER_WINDOW", 1*time.Minute),
 			ProxyURL:             getEnv("PROXY_URL", "socks5://127.0.0.1:40000"),
 			StaticErrorThreshold: int8(getEnvAsInt("POLLER_STATIC_ERROR_THRESHOLD", 10)),
-			TotalErrorThreshold:  int8(getEnvAsInt("POLLER_TOTAL_ERROR_THRESHOLD", 5)),
+			StallThreshold:       getEnvAsDuration("POLLER_STALL_THRESHOLD", 20*time.Minute),
+			RecordDir:            getEnv("POLLER_RECORD_DIR", ""),
+			OriginInterval:       getEnvAsDuration("POLLER_ORIGIN_INTERVAL", 10*time.Minute),
+			DormantInterval:      getEnvAsDuration("POLLER_DORMANT_INTERVAL", 20*time.Minute),
+			DormantAfter:         getEnvAsDuration("POLLER_DORMANT_AFTER", 3*time.Hour),
+			TypeIntervals:        getEnv("POLLER_TYPE_INTERVALS", ""),
+			MaxRunsPerCycle:      getEnvAsInt("POLLER_MAX_RUNS_PER_CYCLE", 0),
+			BackoffBase:          getEnvAsDuration("POLLER_BACKOFF_BASE", 2*time.Minute),
+			BackoffMax:           getEnvAsDuration("POLLER_BACKOFF_MAX", time.Hour),
+			BreakerFailureRate:   getEnvAsFloat("POLLER_BREAKER_FAILURE_RATE", 0.5),
+			BreakerMinRequests:   getEnvAsInt("POLLER_BREAKER_MIN_REQUESTS", 50),
+			BreakerWindow:        getEnvAsDuration("POLLER_BREAKER_WINDOW", time.Minute),
+			BreakerCooldown:      getEnvAsDuration("POLLER_BREAKER_COOLDOWN", 2*time.Minute),
+			BreakerProbes:        getEnvAsInt("POLLER_BREAKER_PROBES", 5),
+			FallbackURL:          getEnv("POLLER_FALLBACK_URL", ""),
+			FallbackAPIKey:       getEnv("POLLER_FALLBACK_API_KEY", ""),
+			ArchiveRetention:     getEnvAsDuration("POLLER_ARCHIVE_RETENTION", 7*24*time.Hour),
+			KeepSchedules:        getEnvAsBool("POLLER_KEEP_SCHEDULES", false),
+			ScheduleRetention:    getEnvAsDuration("POLLER_SCHEDULE_RETENTION", 72*time.Hour),
+			PositionSmoothing:    getEnvAsFloat("POLLER_POSITION_SMOOTHING", 0),
+			NoDataAfter:          getEnvAsDuration("POLLER_NO_DATA_AFTER", 6*time.Hour),
+			OverdueAfter:         getEnvAsDuration("POLLER_OVERDUE_AFTER", 12*time.Hour),
+			ExtrapolateAfter:     getEnvAsDuration("POLLER_EXTRAPOLATE_AFTER", 2*time.Minute),
+			ExtrapolateFor:       getEnvAsDuration("POLLER_EXTRAPOLATE_FOR", 10*time.Minute),
+			TransientRetries:     getEnvAsInt("POLLER_TRANSIENT_RETRIES", 2),
+			TransientRetryDelay:  getEnvAsDuration("POLLER_TRANSIENT_RETRY_DELAY", 500*time.Millisecond),
+			LocationBatchSize:    getEnvAsInt("POLLER_LOCATION_BATCH_SIZE", 200),
+			LocationFlush:        getEnvAsDuration("POLLER_LOCATION_FLUSH", 5*time.Second),
+			LeaseTTL:             getEnvAsDuration("POLLER_LEASE_TTL", 0),
+			LeaseMaxRuns:         getEnvAsInt("POLLER_LEASE_MAX_RUNS", 1000),
+			InstanceID:           getEnv("POLLER_INSTANCE_ID", ""),
+			Sweeps:               getEnvAsBool("POLLER_SWEEPS", true),
 		},
 		Syncer: SyncerConfig{
 			Concurrency: int16(getEnvAsInt("SYNCER_CONCURRENCY", 2)),
@@ -67,6 +201,54 @@ func Load() *Config {
 			WriteTimeout:    getEnvAsDuration("SERVER_WRITE_TIMEOUT", 10*time.Second),
 			IdleTimeout:     getEnvAsDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
 			ShutdownTimeout: getEnvAsDuration("SERVER_SHUTDOWN_TIMEOUT", 10*time.Second),
+			GzipMinSize:     getEnvAsInt("SERVER_GZIP_MIN_SIZE", 1400),
+			CORS: CORSConfig{
+				AllowedOrigins:   getEnvAsList("CORS_ALLOWED_ORIGINS", []string{"http://localhost:5173", "http://localhost:3000", "https://trano-frontend.vercel.app"}),
+				AllowedMethods:   getEnvAsList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+				AllowedHeaders:   getEnvAsList("CORS_ALLOWED_HEADERS", []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-CSRF-Token", "X-Request-ID"}),
+				AllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", true),
+				MaxAge:           getEnvAsDuration("CORS_MAX_AGE", 5*time.Minute),
+			},
+			BootstrapAPIKey: getEnv("API_BOOTSTRAP_KEY", ""),
+			DebugAddr:       getEnv("SERVER_DEBUG_ADDR", ""),
+			GraphQL:         getEnvAsBool("SERVER_GRAPHQL", false),
+			GRPCAddr:        getEnv("SERVER_GRPC_ADDR", ""),
+			Push:            pushCredentials != "",
+		},
+		Analytics: AnalyticsConfig{
+			RunHour:            getEnvAsInt("ANALYTICS_RUN_HOUR", 2),
+			SegmentWindowDays:  getEnvAsInt("ANALYTICS_SEGMENT_WINDOW_DAYS", 30),
+			SegmentMaxSpeedKmh: getEnvAsFloat("ANALYTICS_SEGMENT_MAX_SPEED_KMH", 200),
+			SummaryWindowDays:  getEnvAsInt("ANALYTICS_SUMMARY_WINDOW_DAYS", 3),
+			ApproachMin:        getEnvAsInt("ANALYTICS_CONGESTION_APPROACH_MIN", 10),
+			ProfileWindowDays:  getEnvAsInt("ANALYTICS_PROFILE_WINDOW_DAYS", 90),
+			CoverageGapMin:     getEnvAsInt("ANALYTICS_COVERAGE_GAP_MIN", 15),
+			WeatherProvider:    getEnv("ANALYTICS_WEATHER_PROVIDER", ""),
+			WeatherURL:         getEnv("ANALYTICS_WEATHER_URL", ""),
+			WeatherWindowDays:  getEnvAsInt("ANALYTICS_WEATHER_WINDOW_DAYS", 7),
+		},
+		Simulation: SimulationConfig{
+			Enabled: getEnvAsBool("SIM_MODE", false),
+			Addr:    getEnv("SIM_ADDR", "127.0.0.1:8091"),
+		},
+		RateLimit: RateLimitConfig{
+			WIMTPerMinute: getEnvAsFloat("RATELIMIT_WIMT_PER_MIN", 3000),
+			WIMTBurst:     getEnvAsInt("RATELIMIT_WIMT_BURST", 100),
+			BlockCooldown: getEnvAsDuration("RATELIMIT_BLOCK_COOLDOWN", 15*time.Minute),
+			SaveInterval:  getEnvAsDuration("RATELIMIT_SAVE_INTERVAL", 30*time.Second),
+		},
+		Webhooks: WebhooksConfig{
+			Interval:    getEnvAsDuration("WEBHOOK_INTERVAL", 10*time.Second),
+			Timeout:     getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts: getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 10),
+			Concurrency: getEnvAsInt("WEBHOOK_CONCURRENCY", 4),
+		},
+		Push: PushConfig{
+			CredentialsFile:   pushCredentials,
+			Interval:          getEnvAsDuration("PUSH_INTERVAL", 15*time.Second),
+			Timeout:           getEnvAsDuration("PUSH_TIMEOUT", 10*time.Second),
+			Concurrency:       getEnvAsInt("PUSH_CONCURRENCY", 8),
+			DelayThresholdMin: getEnvAsInt("PUSH_DELAY_THRESHOLD_MIN", 10),
 		},
 		Timezone: getEnv("TIMEZONE", "Asia/Kolkata"),
 	}
@@ -88,6 +270,39 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if valueStr := os.Getenv(key); valueStr != "" {
+		if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if valueStr := os.Getenv(key); valueStr != "" {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList reads a comma separated list, blank entries are dropped
+func getEnvAsList(key string, defaultValue []string) []string {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, v := range strings.Split(valueStr, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	if valueStr := os.Getenv(key); valueStr != "" {
 		if value, err := time.ParseDuration(valueStr); err == nil {
@@ -23,6 +23,56 @@ const (
 //go:embed schema/*.sql
 var migrationFiles embed.FS
 
+// columns added to tables after they first shipped; CREATE TABLE IF NOT EXISTS leaves
+// existing tables alone, so these are added with ALTER TABLE where missing. The schema
+// files must not index them, that runs before the column exists on older databases.
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"train_runs", "quality_score", "INTEGER"},
+	{"train_runs", "current_delay_min", "INTEGER"},
+	{"train_runs", "next_poll_at", "TEXT"},
+	{"train_runs", "extrapolated_lat_u6", "INTEGER"},
+	{"train_runs", "extrapolated_lng_u6", "INTEGER"},
+	{"train_runs", "extrapolated_at", "TEXT"},
+	{"train_runs", "lease_owner", "TEXT"},
+	{"train_runs", "lease_expires_at", "TEXT"},
+	{"train_runs", "revised_departure_min", "INTEGER"},
+	{"train_runs", "speed_kmh", "REAL"},
+	{"train_runs", "avg_speed_kmh", "REAL"},
+	{"train_run_locations", "offset_m", "INTEGER"},
+	{"train_run_locations", "speed_kmh", "REAL"},
+	{"train_run_locations", "avg_speed_kmh", "REAL"},
+	{"train_run_locations", "smoothed_lat_u6", "INTEGER"},
+	{"train_run_locations", "smoothed_lng_u6", "INTEGER"},
+	{"trains", "priority", `INTEGER GENERATED ALWAYS AS (
+		CASE
+			WHEN train_type LIKE '%rajdhani%' OR train_type LIKE '%shatabdi%'
+			  OR train_type LIKE '%vande%' OR train_type LIKE '%duronto%'
+			  OR train_name LIKE '%rajdhani%' OR train_name LIKE '%shatabdi%'
+			  OR train_name LIKE '%vande bharat%' THEN 0
+			WHEN train_type LIKE '%passenger%' OR train_type LIKE '%emu%'
+			  OR train_type LIKE '%suburban%' OR train_type LIKE '%freight%'
+			  OR train_type LIKE '%parcel%' THEN 2
+			ELSE 1
+		END
+	) VIRTUAL`},
+}
+
+// one-off repairs of existing data, each applied once and recorded in schema_fixes so
+// later starts don't scan for it again. They run after addedColumns.
+var dataFixes = []struct {
+	name string
+	stmt string
+}{
+	// partial status updates used to reset has_started on runs that were reporting
+	{"runs_reset_has_started", `UPDATE train_runs
+		SET has_started = 1
+		WHERE has_started = 0 AND last_update_timestamp_ISO IS NOT NULL`},
+}
+
 type DatabaseOptions struct {
 	ForeignKeysEnabled bool
 	JournalMode        string
@@ -161,10 +211,85 @@ func applyMigrations(dbConn *sql.DB, logger *log.Logger) error {
 		}
 	}
 
+	if err := applyAddedColumns(dbConn, logger); err != nil {
+		return err
+	}
+	if err := applyDataFixes(dbConn, logger); err != nil {
+		return err
+	}
+
 	logger.Println("all migrations applied successfully")
 	return nil
 }
 
+func applyAddedColumns(dbConn *sql.DB, logger *log.Logger) error {
+	for _, col := range addedColumns {
+		var exists int
+		err := dbConn.QueryRow(
+			// xinfo, table_info leaves out generated columns
+			"SELECT COUNT(*) FROM pragma_table_xinfo(?) WHERE name = ?", col.table, col.column,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s.%s: %w", col.table, col.column, err)
+		}
+		if exists > 0 {
+			continue
+		}
+
+		logger.Printf("adding column: %s.%s", col.table, col.column)
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)
+		if _, err := dbConn.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+func applyDataFixes(dbConn *sql.DB, logger *log.Logger) error {
+	if _, err := dbConn.Exec(`CREATE TABLE IF NOT EXISTS schema_fixes (
+		name TEXT PRIMARY KEY,
+		applied_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_fixes: %w", err)
+	}
+
+	for _, fix := range dataFixes {
+		if err := applyDataFix(dbConn, logger, fix.name, fix.stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyDataFix records the fix and runs it in one transaction, so a fix that fails is
+// tried again on the next start
+func applyDataFix(dbConn *sql.DB, logger *log.Logger, name, stmt string) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin data fix %s: %w", name, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT OR IGNORE INTO schema_fixes (name) VALUES (?)", name)
+	if err != nil {
+		return fmt.Errorf("failed to record data fix %s: %w", name, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	res, err = tx.Exec(stmt)
+	if err != nil {
+		return fmt.Errorf("failed to apply data fix %s: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit data fix %s: %w", name, err)
+	}
+	n, _ := res.RowsAffected()
+	logger.Printf("data fix applied: %s | rows: %d", name, n)
+	return nil
+}
+
 func verifyJournalMode(dbConn *sql.DB, logger *log.Logger) error {
 	var journalMode string
 	if err := dbConn.QueryRow("PRAGMA journal_mode;").Scan(&journalMode); err != nil {
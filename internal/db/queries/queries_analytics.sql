@@ -0,0 +1,849 @@
+-- name: RefreshSegmentStats :exec
+-- Recomputes per-segment speeds from station events of runs since the given date
+INSERT INTO segment_stats (
+    from_station_code,
+    to_station_code,
+    distance_km,
+    samples,
+    avg_speed_kmh,
+    min_speed_kmh,
+    max_speed_kmh,
+    avg_runtime_min,
+    updated_at
+)
+SELECT
+    from_station_code,
+    to_station_code,
+    AVG(distance_km),
+    COUNT(*),
+    AVG(speed_kmh),
+    MIN(speed_kmh),
+    MAX(speed_kmh),
+    AVG(runtime_min),
+    CURRENT_TIMESTAMP
+FROM (
+    SELECT
+        prev_station_code AS from_station_code,
+        station_code AS to_station_code,
+        (distance_km_u4 - prev_distance_km_u4) / 10000.0 AS distance_km,
+        (act_arrival_tm - prev_act_departure_tm) / 60.0 AS runtime_min,
+        ((distance_km_u4 - prev_distance_km_u4) / 10000.0)
+            / ((act_arrival_tm - prev_act_departure_tm) / 3600.0) AS speed_kmh
+    FROM (
+        SELECT
+            e.station_code,
+            e.distance_km_u4,
+            e.act_arrival_tm,
+            LAG(e.station_code) OVER w AS prev_station_code,
+            LAG(e.distance_km_u4) OVER w AS prev_distance_km_u4,
+            LAG(e.act_departure_tm) OVER w AS prev_act_departure_tm
+        FROM train_run_station_events e
+        JOIN train_runs tr ON e.run_id = tr.run_id
+        WHERE tr.run_date >= @since_date
+        WINDOW w AS (PARTITION BY e.run_id ORDER BY e.sno)
+    )
+    WHERE prev_station_code IS NOT NULL
+      AND prev_act_departure_tm IS NOT NULL
+      AND act_arrival_tm > prev_act_departure_tm
+      AND distance_km_u4 > prev_distance_km_u4
+)
+-- drop physically implausible samples (bad timestamps)
+WHERE speed_kmh <= @max_speed_kmh
+GROUP BY from_station_code, to_station_code
+ON CONFLICT(from_station_code, to_station_code) DO UPDATE SET
+    distance_km = excluded.distance_km,
+    samples = excluded.samples,
+    avg_speed_kmh = excluded.avg_speed_kmh,
+    min_speed_kmh = excluded.min_speed_kmh,
+    max_speed_kmh = excluded.max_speed_kmh,
+    avg_runtime_min = excluded.avg_runtime_min,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: DeleteStaleSegmentStats :execrows
+-- Drops segments RefreshSegmentStats found no samples for, the ones it last refreshed
+-- before refreshed_at (UTC)
+DELETE FROM segment_stats
+WHERE updated_at < @refreshed_at;
+
+-- name: RefreshRunDelaySummaries :exec
+-- Rebuilds per-run delay summaries for runs since the given date
+INSERT INTO run_delay_summaries (
+    run_id,
+    train_no,
+    run_date,
+    stations_observed,
+    avg_delay_min,
+    max_delay_min,
+    terminal_delay_min,
+    updated_at
+)
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    COUNT(*),
+    AVG(COALESCE(e.delay_departure_min, e.delay_arrival_min)),
+    MAX(COALESCE(e.delay_departure_min, e.delay_arrival_min)),
+    MAX(CASE WHEN e.station_code = ts.terminus_station_code THEN e.delay_arrival_min END),
+    CURRENT_TIMESTAMP
+FROM train_runs tr
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+JOIN train_run_station_events e ON e.run_id = tr.run_id
+WHERE tr.run_date >= @since_date
+GROUP BY tr.run_id
+ON CONFLICT(run_id) DO UPDATE SET
+    stations_observed = excluded.stations_observed,
+    avg_delay_min = excluded.avg_delay_min,
+    max_delay_min = excluded.max_delay_min,
+    terminal_delay_min = excluded.terminal_delay_min,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshStationCongestion :exec
+-- Rebuilds hourly station occupancy from station events since the given unix time.
+-- A train counts as present from approach_sec before arrival until departure.
+WITH RECURSIVE presence AS (
+    SELECT station_code, run_id, start_tm, end_tm
+    FROM (
+        SELECT
+            station_code,
+            run_id,
+            COALESCE(act_arrival_tm, act_departure_tm) - @approach_sec AS start_tm,
+            -- terminus or not yet departed: count the train for one minute after arrival
+            COALESCE(act_departure_tm, act_arrival_tm + 60) AS end_tm
+        FROM train_run_station_events
+        WHERE COALESCE(act_arrival_tm, act_departure_tm) >= @since_tm
+    )
+    -- drop implausible dwells (bad timestamps)
+    WHERE end_tm > start_tm
+      AND end_tm - start_tm <= 21600
+),
+hours AS (
+    SELECT
+        station_code,
+        run_id,
+        start_tm,
+        end_tm,
+        ((start_tm + @tz_offset_sec) / 3600) * 3600 - @tz_offset_sec AS hour_start_tm
+    FROM presence
+    UNION ALL
+    SELECT station_code, run_id, start_tm, end_tm, hour_start_tm + 3600
+    FROM hours
+    WHERE hour_start_tm + 3600 < end_tm
+),
+sweep AS (
+    -- departures sort before arrivals at the same instant so handovers are not double counted
+    SELECT
+        station_code,
+        tm,
+        SUM(delta) OVER (PARTITION BY station_code ORDER BY tm, delta ROWS UNBOUNDED PRECEDING) AS present
+    FROM (
+        SELECT station_code, start_tm AS tm, 1 AS delta FROM presence
+        UNION ALL
+        SELECT station_code, end_tm AS tm, -1 AS delta FROM presence
+    )
+),
+sweep_peaks AS (
+    SELECT
+        station_code,
+        ((tm + @tz_offset_sec) / 3600) * 3600 - @tz_offset_sec AS hour_start_tm,
+        MAX(present) AS peak
+    FROM sweep
+    GROUP BY 1, 2
+)
+INSERT INTO station_congestion_hourly (
+    station_code,
+    hour_start_tm,
+    obs_date,
+    hour,
+    trains,
+    peak_trains,
+    avg_trains,
+    updated_at
+)
+SELECT
+    h.station_code,
+    h.hour_start_tm,
+    date(h.hour_start_tm + @tz_offset_sec, 'unixepoch'),
+    CAST(strftime('%H', h.hour_start_tm + @tz_offset_sec, 'unixepoch') AS INTEGER),
+    COUNT(DISTINCT h.run_id),
+    -- trains carried over from the previous hour are present even without an event in this one
+    MAX(COALESCE(MAX(sp.peak), 0), SUM(h.start_tm < h.hour_start_tm)),
+    SUM(MIN(h.end_tm, h.hour_start_tm + 3600) - MAX(h.start_tm, h.hour_start_tm)) / 3600.0,
+    CURRENT_TIMESTAMP
+FROM hours h
+LEFT JOIN sweep_peaks sp ON sp.station_code = h.station_code AND sp.hour_start_tm = h.hour_start_tm
+GROUP BY h.station_code, h.hour_start_tm
+ON CONFLICT(station_code, hour_start_tm) DO UPDATE SET
+    trains = excluded.trains,
+    peak_trains = excluded.peak_trains,
+    avg_trains = excluded.avg_trains,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshTrainStationDelayProfiles :exec
+-- Rebuilds per-train, per-weekday station delay percentiles (nearest rank) from runs since the given date
+INSERT INTO train_station_delay_profiles (
+    train_no,
+    weekday,
+    station_code,
+    samples,
+    avg_delay_min,
+    p10_delay_min,
+    p50_delay_min,
+    p90_delay_min,
+    updated_at
+)
+SELECT
+    train_no,
+    weekday,
+    station_code,
+    COUNT(*),
+    AVG(delay_min),
+    MIN(CASE WHEN rn * 10 >= cnt THEN delay_min END),
+    MIN(CASE WHEN rn * 2 >= cnt THEN delay_min END),
+    MIN(CASE WHEN rn * 10 >= cnt * 9 THEN delay_min END),
+    CURRENT_TIMESTAMP
+FROM (
+    SELECT
+        train_no,
+        weekday,
+        station_code,
+        delay_min,
+        ROW_NUMBER() OVER w AS rn,
+        COUNT(*) OVER (PARTITION BY train_no, weekday, station_code) AS cnt
+    FROM (
+        SELECT
+            tr.train_no,
+            CAST(strftime('%w', tr.run_date) AS INTEGER) AS weekday,
+            e.station_code,
+            COALESCE(e.delay_arrival_min, e.delay_departure_min) AS delay_min
+        FROM train_run_station_events e
+        JOIN train_runs tr ON e.run_id = tr.run_id
+        WHERE tr.run_date >= @since_date
+          AND COALESCE(e.delay_arrival_min, e.delay_departure_min) IS NOT NULL
+        UNION ALL
+        SELECT
+            tr.train_no,
+            -1 AS weekday,
+            e.station_code,
+            COALESCE(e.delay_arrival_min, e.delay_departure_min) AS delay_min
+        FROM train_run_station_events e
+        JOIN train_runs tr ON e.run_id = tr.run_id
+        WHERE tr.run_date >= @since_date
+          AND COALESCE(e.delay_arrival_min, e.delay_departure_min) IS NOT NULL
+    )
+    WINDOW w AS (PARTITION BY train_no, weekday, station_code ORDER BY delay_min)
+)
+GROUP BY train_no, weekday, station_code
+ON CONFLICT(train_no, weekday, station_code) DO UPDATE SET
+    samples = excluded.samples,
+    avg_delay_min = excluded.avg_delay_min,
+    p10_delay_min = excluded.p10_delay_min,
+    p50_delay_min = excluded.p50_delay_min,
+    p90_delay_min = excluded.p90_delay_min,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshDailyTrainSummaries :exec
+-- Rebuilds per-train daily aggregates for run dates in [since_date, until_date), needs run_delay_summaries
+INSERT INTO daily_train_summaries (
+    summary_date,
+    train_no,
+    runs,
+    completed_runs,
+    cancelled_runs,
+    tracked_runs,
+    on_time_runs,
+    avg_delay_min,
+    avg_terminal_delay_min,
+    coverage_pct,
+    updated_at
+)
+SELECT
+    tr.run_date,
+    tr.train_no,
+    COUNT(*),
+    SUM(tr.current_status = 'completed'),
+    SUM(tr.current_status = 'cancelled'),
+    SUM(COALESCE(ds.stations_observed, 0) > 0),
+    SUM(COALESCE(ds.terminal_delay_min <= @on_time_threshold_min, 0)),
+    AVG(ds.avg_delay_min),
+    AVG(ds.terminal_delay_min),
+    AVG(MIN(100.0, 100.0 * COALESCE(ds.stations_observed, 0) / MAX(COALESCE(rs.stops, 0), 1))),
+    CURRENT_TIMESTAMP
+FROM train_runs tr
+LEFT JOIN run_delay_summaries ds ON ds.run_id = tr.run_id
+LEFT JOIN (
+    SELECT schedule_id, COUNT(*) AS stops
+    FROM train_routes
+    WHERE stops = 1
+    GROUP BY schedule_id
+) rs ON rs.schedule_id = tr.schedule_id
+WHERE tr.run_date >= @since_date
+  AND tr.run_date < @until_date
+GROUP BY tr.run_date, tr.train_no
+ON CONFLICT(summary_date, train_no) DO UPDATE SET
+    runs = excluded.runs,
+    completed_runs = excluded.completed_runs,
+    cancelled_runs = excluded.cancelled_runs,
+    tracked_runs = excluded.tracked_runs,
+    on_time_runs = excluded.on_time_runs,
+    avg_delay_min = excluded.avg_delay_min,
+    avg_terminal_delay_min = excluded.avg_terminal_delay_min,
+    coverage_pct = excluded.coverage_pct,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshDailyStationSummaries :exec
+-- Rebuilds per-station daily aggregates for actual times in [since_tm, until_tm), dated in local time
+INSERT INTO daily_station_summaries (
+    summary_date,
+    station_code,
+    trains,
+    on_time_trains,
+    avg_delay_min,
+    max_delay_min,
+    updated_at
+)
+SELECT
+    date(COALESCE(act_arrival_tm, act_departure_tm) + @tz_offset_sec, 'unixepoch') AS summary_date,
+    station_code,
+    COUNT(DISTINCT run_id),
+    SUM(COALESCE(delay_arrival_min, delay_departure_min) <= @on_time_threshold_min),
+    AVG(COALESCE(delay_arrival_min, delay_departure_min)),
+    MAX(COALESCE(delay_arrival_min, delay_departure_min)),
+    CURRENT_TIMESTAMP
+FROM train_run_station_events
+WHERE COALESCE(act_arrival_tm, act_departure_tm) >= @since_tm
+  AND COALESCE(act_arrival_tm, act_departure_tm) < @until_tm
+GROUP BY 1, 2
+ON CONFLICT(summary_date, station_code) DO UPDATE SET
+    trains = excluded.trains,
+    on_time_trains = excluded.on_time_trains,
+    avg_delay_min = excluded.avg_delay_min,
+    max_delay_min = excluded.max_delay_min,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshDailyZoneSummaries :exec
+-- Rolls daily train summaries since the given date up to the rake zone
+INSERT INTO daily_zone_summaries (
+    summary_date,
+    zone,
+    trains,
+    runs,
+    completed_runs,
+    cancelled_runs,
+    tracked_runs,
+    on_time_runs,
+    avg_delay_min,
+    avg_terminal_delay_min,
+    coverage_pct,
+    updated_at
+)
+SELECT
+    d.summary_date,
+    COALESCE(NULLIF(TRIM(t.zone), ''), 'UNKNOWN') AS zone,
+    COUNT(*),
+    SUM(d.runs),
+    SUM(d.completed_runs),
+    SUM(d.cancelled_runs),
+    SUM(d.tracked_runs),
+    SUM(d.on_time_runs),
+    AVG(d.avg_delay_min),
+    AVG(d.avg_terminal_delay_min),
+    AVG(d.coverage_pct),
+    CURRENT_TIMESTAMP
+FROM daily_train_summaries d
+JOIN trains t ON d.train_no = t.train_no
+WHERE d.summary_date >= @since_date
+GROUP BY 1, 2
+ON CONFLICT(summary_date, zone) DO UPDATE SET
+    trains = excluded.trains,
+    runs = excluded.runs,
+    completed_runs = excluded.completed_runs,
+    cancelled_runs = excluded.cancelled_runs,
+    tracked_runs = excluded.tracked_runs,
+    on_time_runs = excluded.on_time_runs,
+    avg_delay_min = excluded.avg_delay_min,
+    avg_terminal_delay_min = excluded.avg_terminal_delay_min,
+    coverage_pct = excluded.coverage_pct,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshMonthlyTrainSummaries :exec
+-- Folds daily train summaries into calendar months, for every month from the one containing
+-- since_date (which must be the first of a month so whole months are rebuilt)
+INSERT INTO monthly_train_summaries (
+    month,
+    train_no,
+    days,
+    runs,
+    completed_runs,
+    cancelled_runs,
+    tracked_runs,
+    on_time_runs,
+    avg_delay_min,
+    avg_terminal_delay_min,
+    coverage_pct,
+    updated_at
+)
+SELECT
+    substr(summary_date, 1, 7),
+    train_no,
+    COUNT(*),
+    SUM(runs),
+    SUM(completed_runs),
+    SUM(cancelled_runs),
+    SUM(tracked_runs),
+    SUM(on_time_runs),
+    SUM(avg_delay_min * tracked_runs) / SUM(CASE WHEN avg_delay_min IS NOT NULL THEN tracked_runs END),
+    SUM(avg_terminal_delay_min * tracked_runs) / SUM(CASE WHEN avg_terminal_delay_min IS NOT NULL THEN tracked_runs END),
+    AVG(coverage_pct),
+    CURRENT_TIMESTAMP
+FROM daily_train_summaries
+WHERE summary_date >= @since_date
+GROUP BY 1, 2
+ON CONFLICT(month, train_no) DO UPDATE SET
+    days = excluded.days,
+    runs = excluded.runs,
+    completed_runs = excluded.completed_runs,
+    cancelled_runs = excluded.cancelled_runs,
+    tracked_runs = excluded.tracked_runs,
+    on_time_runs = excluded.on_time_runs,
+    avg_delay_min = excluded.avg_delay_min,
+    avg_terminal_delay_min = excluded.avg_terminal_delay_min,
+    coverage_pct = excluded.coverage_pct,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshMonthlyStationSummaries :exec
+-- Folds daily station summaries into calendar months from the month starting at since_date
+INSERT INTO monthly_station_summaries (
+    month,
+    station_code,
+    days,
+    trains,
+    on_time_trains,
+    avg_delay_min,
+    max_delay_min,
+    updated_at
+)
+SELECT
+    substr(summary_date, 1, 7),
+    station_code,
+    COUNT(*),
+    SUM(trains),
+    SUM(on_time_trains),
+    SUM(avg_delay_min * trains) / SUM(CASE WHEN avg_delay_min IS NOT NULL THEN trains END),
+    MAX(max_delay_min),
+    CURRENT_TIMESTAMP
+FROM daily_station_summaries
+WHERE summary_date >= @since_date
+GROUP BY 1, 2
+ON CONFLICT(month, station_code) DO UPDATE SET
+    days = excluded.days,
+    trains = excluded.trains,
+    on_time_trains = excluded.on_time_trains,
+    avg_delay_min = excluded.avg_delay_min,
+    max_delay_min = excluded.max_delay_min,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshMonthlyZoneSummaries :exec
+-- Folds daily zone summaries into calendar months from the month starting at since_date
+INSERT INTO monthly_zone_summaries (
+    month,
+    zone,
+    days,
+    trains,
+    runs,
+    completed_runs,
+    cancelled_runs,
+    tracked_runs,
+    on_time_runs,
+    avg_delay_min,
+    avg_terminal_delay_min,
+    coverage_pct,
+    updated_at
+)
+SELECT
+    substr(summary_date, 1, 7),
+    zone,
+    COUNT(*),
+    MAX(trains),
+    SUM(runs),
+    SUM(completed_runs),
+    SUM(cancelled_runs),
+    SUM(tracked_runs),
+    SUM(on_time_runs),
+    SUM(avg_delay_min * tracked_runs) / SUM(CASE WHEN avg_delay_min IS NOT NULL THEN tracked_runs END),
+    SUM(avg_terminal_delay_min * tracked_runs) / SUM(CASE WHEN avg_terminal_delay_min IS NOT NULL THEN tracked_runs END),
+    AVG(coverage_pct),
+    CURRENT_TIMESTAMP
+FROM daily_zone_summaries
+WHERE summary_date >= @since_date
+GROUP BY 1, 2
+ON CONFLICT(month, zone) DO UPDATE SET
+    days = excluded.days,
+    trains = excluded.trains,
+    runs = excluded.runs,
+    completed_runs = excluded.completed_runs,
+    cancelled_runs = excluded.cancelled_runs,
+    tracked_runs = excluded.tracked_runs,
+    on_time_runs = excluded.on_time_runs,
+    avg_delay_min = excluded.avg_delay_min,
+    avg_terminal_delay_min = excluded.avg_terminal_delay_min,
+    coverage_pct = excluded.coverage_pct,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: DetectRunEncounters :exec
+-- Finds overtakes (same segment, order swapped) and crossings (reverse segment, times
+-- overlapping) between runs since the given date; the meeting time assumes constant speed
+WITH segments AS (
+    SELECT run_id, from_code, to_code, dep_tm, arr_tm
+    FROM (
+        SELECT
+            e.run_id,
+            LAG(e.station_code) OVER w AS from_code,
+            e.station_code AS to_code,
+            LAG(e.act_departure_tm) OVER w AS dep_tm,
+            e.act_arrival_tm AS arr_tm
+        FROM train_run_station_events e
+        JOIN train_runs tr ON e.run_id = tr.run_id
+        WHERE tr.run_date >= @since_date
+        WINDOW w AS (PARTITION BY e.run_id ORDER BY e.sno)
+    )
+    WHERE from_code IS NOT NULL
+      AND dep_tm IS NOT NULL
+      AND arr_tm > dep_tm
+)
+INSERT INTO run_encounters (
+    kind,
+    run_id_a,
+    run_id_b,
+    from_station_code,
+    to_station_code,
+    encounter_tm
+)
+SELECT
+    'overtake',
+    a.run_id,
+    b.run_id,
+    a.from_code,
+    a.to_code,
+    CAST((1.0 * a.dep_tm / (a.arr_tm - a.dep_tm) - 1.0 * b.dep_tm / (b.arr_tm - b.dep_tm))
+        / (1.0 / (a.arr_tm - a.dep_tm) - 1.0 / (b.arr_tm - b.dep_tm)) AS INTEGER)
+FROM segments a
+JOIN segments b ON a.from_code = b.from_code AND a.to_code = b.to_code AND a.run_id <> b.run_id
+WHERE a.dep_tm > b.dep_tm
+  AND a.arr_tm < b.arr_tm
+UNION ALL
+SELECT
+    'crossing',
+    a.run_id,
+    b.run_id,
+    a.from_code,
+    a.to_code,
+    CAST((1.0 + 1.0 * a.dep_tm / (a.arr_tm - a.dep_tm) + 1.0 * b.dep_tm / (b.arr_tm - b.dep_tm))
+        / (1.0 / (a.arr_tm - a.dep_tm) + 1.0 / (b.arr_tm - b.dep_tm)) AS INTEGER)
+FROM segments a
+JOIN segments b ON a.from_code = b.to_code AND a.to_code = b.from_code
+WHERE a.run_id < b.run_id
+  AND a.dep_tm < b.arr_tm
+  AND b.dep_tm < a.arr_tm
+ON CONFLICT(kind, run_id_a, run_id_b, from_station_code, to_station_code) DO UPDATE SET
+    encounter_tm = excluded.encounter_tm;
+
+-- name: RefreshHeadwayStats :exec
+-- Recomputes headways at every station per direction from runs since the given date;
+-- gaps of max_headway_min or more (overnight, timetable holes) are not headways
+WITH passes AS (
+    SELECT
+        e.station_code,
+        LEAD(e.station_code) OVER (PARTITION BY e.run_id ORDER BY e.sno) AS next_station_code,
+        COALESCE(e.act_departure_tm, e.act_arrival_tm) AS tm
+    FROM train_run_station_events e
+    JOIN train_runs tr ON e.run_id = tr.run_id
+    WHERE tr.run_date >= @since_date
+),
+gaps AS (
+    SELECT
+        station_code,
+        next_station_code,
+        (tm - LAG(tm) OVER (PARTITION BY station_code, next_station_code ORDER BY tm)) / 60.0 AS headway_min
+    FROM passes
+    WHERE next_station_code IS NOT NULL
+      AND tm IS NOT NULL
+)
+INSERT INTO headway_stats (
+    station_code,
+    next_station_code,
+    samples,
+    min_headway_min,
+    avg_headway_min,
+    max_headway_min,
+    bunched,
+    updated_at
+)
+SELECT
+    station_code,
+    next_station_code,
+    COUNT(*),
+    MIN(headway_min),
+    AVG(headway_min),
+    MAX(headway_min),
+    SUM(headway_min < @bunching_min),
+    CURRENT_TIMESTAMP
+FROM gaps
+WHERE headway_min IS NOT NULL
+  AND headway_min < @max_headway_min
+GROUP BY station_code, next_station_code
+ON CONFLICT(station_code, next_station_code) DO UPDATE SET
+    samples = excluded.samples,
+    min_headway_min = excluded.min_headway_min,
+    avg_headway_min = excluded.avg_headway_min,
+    max_headway_min = excluded.max_headway_min,
+    bunched = excluded.bunched,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshRunDelayAttribution :exec
+-- Splits delay gained per segment into inherited and own for runs since the given date.
+-- A gain is inherited when the run left within max_gap_sec of the train ahead on the same
+-- segment and arrived no more than follow_sec after it, i.e. it was running on its tail.
+WITH segments AS (
+    SELECT run_id, from_code, to_code, dep_tm, arr_tm, gain_min
+    FROM (
+        SELECT
+            e.run_id,
+            LAG(e.station_code) OVER w AS from_code,
+            e.station_code AS to_code,
+            LAG(e.act_departure_tm) OVER w AS dep_tm,
+            e.act_arrival_tm AS arr_tm,
+            COALESCE(e.delay_arrival_min, e.delay_departure_min)
+                - LAG(COALESCE(e.delay_departure_min, e.delay_arrival_min)) OVER w AS gain_min
+        FROM train_run_station_events e
+        JOIN train_runs tr ON e.run_id = tr.run_id
+        WHERE tr.run_date >= @since_date
+        WINDOW w AS (PARTITION BY e.run_id ORDER BY e.sno)
+    )
+    WHERE from_code IS NOT NULL
+      AND dep_tm IS NOT NULL
+      AND arr_tm IS NOT NULL
+      AND gain_min IS NOT NULL
+),
+followed AS (
+    SELECT
+        run_id,
+        gain_min,
+        dep_tm - LAG(dep_tm) OVER s AS dep_gap_sec,
+        arr_tm - LAG(arr_tm) OVER s AS arr_gap_sec
+    FROM segments
+    WINDOW s AS (PARTITION BY from_code, to_code ORDER BY dep_tm)
+)
+INSERT INTO run_delay_attribution (
+    run_id,
+    segments,
+    gained_min,
+    inherited_min,
+    own_min,
+    updated_at
+)
+SELECT
+    run_id,
+    COUNT(*),
+    SUM(MAX(gain_min, 0)),
+    SUM(inherited),
+    SUM(MAX(gain_min, 0)) - SUM(inherited),
+    CURRENT_TIMESTAMP
+FROM (
+    SELECT
+        run_id,
+        gain_min,
+        CASE
+            WHEN gain_min > 0
+             AND dep_gap_sec <= @max_gap_sec
+             AND arr_gap_sec BETWEEN 0 AND @follow_sec
+            THEN gain_min
+            ELSE 0
+        END AS inherited
+    FROM followed
+)
+GROUP BY run_id
+ON CONFLICT(run_id) DO UPDATE SET
+    segments = excluded.segments,
+    gained_min = excluded.gained_min,
+    inherited_min = excluded.inherited_min,
+    own_min = excluded.own_min,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: ListDivisionCentroids :many
+-- Returns the mean position of each division's stations, the point its weather is looked up at
+SELECT
+    division,
+    CAST(AVG(lat) AS REAL) AS lat,
+    CAST(AVG(lng) AS REAL) AS lng
+FROM stations
+WHERE division IS NOT NULL
+  AND division != ''
+  AND lat IS NOT NULL
+  AND lng IS NOT NULL
+GROUP BY division
+ORDER BY division;
+
+-- name: UpsertDivisionWeather :exec
+INSERT INTO division_weather_daily (
+    division,
+    weather_date,
+    condition,
+    weather_code,
+    temp_max_c,
+    temp_min_c,
+    precipitation_mm,
+    provider,
+    updated_at
+) VALUES (
+    @division,
+    @weather_date,
+    @condition,
+    @weather_code,
+    @temp_max_c,
+    @temp_min_c,
+    @precipitation_mm,
+    @provider,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT(division, weather_date) DO UPDATE SET
+    condition = excluded.condition,
+    weather_code = excluded.weather_code,
+    temp_max_c = excluded.temp_max_c,
+    temp_min_c = excluded.temp_min_c,
+    precipitation_mm = excluded.precipitation_mm,
+    provider = excluded.provider,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshRunCoverage :exec
+-- Rebuilds per-run coverage metrics for runs since the given date
+WITH fixes AS (
+    SELECT
+        l.run_id,
+        CAST(strftime('%s', l.timestamp_ISO) AS INTEGER) AS ts,
+        CAST(strftime('%s', l.timestamp_ISO) AS INTEGER)
+            - LAG(CAST(strftime('%s', l.timestamp_ISO) AS INTEGER)) OVER (PARTITION BY l.run_id ORDER BY l.timestamp_ISO) AS gap_sec
+    FROM train_run_locations l
+    JOIN train_runs tr ON l.run_id = tr.run_id
+    WHERE tr.run_date >= @since_date
+),
+located AS (
+    SELECT
+        run_id,
+        COUNT(*) AS points,
+        MAX(ts) - MIN(ts) AS span_sec,
+        SUM(gap_sec > @gap_sec) AS gaps,
+        MAX(gap_sec) AS longest_gap_sec
+    FROM fixes
+    GROUP BY run_id
+),
+observed AS (
+    SELECT
+        e.run_id,
+        SUM(e.act_arrival_tm IS NOT NULL OR e.act_departure_tm IS NOT NULL) AS stations
+    FROM train_run_station_events e
+    JOIN train_runs tr ON e.run_id = tr.run_id
+    WHERE tr.run_date >= @since_date
+    GROUP BY e.run_id
+),
+scheduled AS (
+    SELECT schedule_id, COUNT(*) AS stops
+    FROM train_routes
+    WHERE stops = 1
+    GROUP BY schedule_id
+)
+INSERT INTO run_coverage_stats (
+    run_id,
+    train_no,
+    run_date,
+    polls,
+    successful_polls,
+    expected_polls,
+    location_points,
+    points_per_hour,
+    gaps,
+    longest_gap_min,
+    scheduled_stops,
+    stations_with_actuals,
+    station_actuals_pct,
+    updated_at
+)
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    COALESCE(p.polls, 0),
+    COALESCE(p.successful_polls, 0),
+    COALESCE((strftime('%s', p.last_poll_at) - strftime('%s', p.first_poll_at)) / p.window_sec + 1, 0),
+    COALESCE(l.points, 0),
+    CASE WHEN l.span_sec > 0 THEN l.points * 3600.0 / l.span_sec END,
+    COALESCE(l.gaps, 0),
+    l.longest_gap_sec / 60.0,
+    COALESCE(s.stops, 0),
+    COALESCE(o.stations, 0),
+    MIN(100.0, 100.0 * COALESCE(o.stations, 0) / MAX(COALESCE(s.stops, 0), 1)),
+    CURRENT_TIMESTAMP
+FROM train_runs tr
+LEFT JOIN run_poll_stats p ON p.run_id = tr.run_id
+LEFT JOIN located l ON l.run_id = tr.run_id
+LEFT JOIN observed o ON o.run_id = tr.run_id
+LEFT JOIN scheduled s ON s.schedule_id = tr.schedule_id
+WHERE tr.run_date >= @since_date
+  AND (p.run_id IS NOT NULL OR l.run_id IS NOT NULL OR o.run_id IS NOT NULL)
+ON CONFLICT(run_id) DO UPDATE SET
+    polls = excluded.polls,
+    successful_polls = excluded.successful_polls,
+    expected_polls = excluded.expected_polls,
+    location_points = excluded.location_points,
+    points_per_hour = excluded.points_per_hour,
+    gaps = excluded.gaps,
+    longest_gap_min = excluded.longest_gap_min,
+    scheduled_stops = excluded.scheduled_stops,
+    stations_with_actuals = excluded.stations_with_actuals,
+    station_actuals_pct = excluded.station_actuals_pct,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: RefreshRunQualityScores :exec
+-- Scores arrived runs since the given date out of 100 from their coverage: 40 for fixes
+-- per expected poll, 40 for stations with actuals and 20 for polls that succeeded.
+-- Runs without poll counters are left unscored.
+UPDATE train_runs
+SET
+    quality_score = CAST(ROUND(
+        40 * MIN(1.0, 1.0 * c.location_points / MAX(c.expected_polls, 1))
+        + 40 * c.station_actuals_pct / 100
+        + 20 * 1.0 * c.successful_polls / c.polls
+    ) AS INTEGER),
+    updated_at = CURRENT_TIMESTAMP
+FROM run_coverage_stats c
+WHERE c.run_id = train_runs.run_id
+  AND c.polls > 0
+  AND train_runs.has_arrived = 1
+  AND train_runs.run_date >= @since_date;
+
+-- name: ListMostDelayedRuns :many
+-- Returns runs by the delay stored on their last poll, most delayed first. An empty
+-- run_date takes the trains running now, otherwise every run of that date.
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    t.zone,
+    tr.run_date,
+    tr.has_arrived,
+    tr.current_status,
+    CAST(tr.current_delay_min AS INTEGER) AS delay_min,
+    tr.last_updated_sno,
+    tr.last_update_timestamp_ISO
+FROM train_runs tr
+JOIN trains t ON t.train_no = tr.train_no
+WHERE tr.current_delay_min IS NOT NULL
+  AND (
+    (@run_date = ''
+        AND tr.has_arrived = 0
+        AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes'))
+    OR tr.run_date = @run_date
+  )
+ORDER BY tr.current_delay_min DESC, tr.train_no
+LIMIT @limit;
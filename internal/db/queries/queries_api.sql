@@ -1,18 +1,1270 @@
 -- name: GetLiveTrains :many
--- Returns data for active trains within viewport bounds
+-- Returns data for active trains, the viewport is applied by the caller
+-- Linked trains riding a live carrier are folded into the carrier's row as linked_train_nos,
+-- alias runs are hidden behind their canonical run
+WITH live AS (
+    SELECT
+        tr.run_id,
+        tr.train_no,
+        tr.run_date,
+        tr.schedule_id,
+        tr.last_known_snapped_lat_u6,
+        tr.last_known_snapped_lng_u6,
+        tr.extrapolated_lat_u6,
+        tr.extrapolated_lng_u6,
+        tr.last_known_distance_km_u4,
+        tr.last_bearing_deg,
+        tr.current_status,
+        tr.current_delay_min,
+        tr.speed_kmh,
+        tr.avg_speed_kmh,
+        tr.last_update_timestamp_iso
+    FROM train_runs tr
+    WHERE tr.has_arrived = 0
+      AND tr.last_known_snapped_lat_u6 IS NOT NULL
+      AND tr.last_known_snapped_lng_u6 IS NOT NULL
+      -- Only recent updates (avoid stale data)
+      AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+),
+carried AS (
+    -- the carrier is between the link's stations on its own route
+    SELECT
+        c.run_id AS carrier_run_id,
+        c.run_date,
+        l.linked_train_no
+    FROM live c
+    JOIN train_links l ON l.train_no = c.train_no
+    LEFT JOIN train_routes rf
+        ON rf.schedule_id = c.schedule_id
+        AND rf.station_code = l.from_station_code
+    LEFT JOIN train_routes rt
+        ON rt.schedule_id = c.schedule_id
+        AND rt.station_code = l.to_station_code
+    WHERE c.last_known_distance_km_u4 >= CAST(COALESCE(rf.distance_km, 0) * 10000 AS INTEGER)
+      AND (rt.distance_km IS NULL OR c.last_known_distance_km_u4 <= CAST(rt.distance_km * 10000 AS INTEGER))
+)
 SELECT 
     t.train_name,
     t.train_type,
+    t.zone,
     tr.train_no,
-    tr.last_known_snapped_lat_u6 AS lat_u6,
-    tr.last_known_snapped_lng_u6 AS lng_u6,
+    -- the dead reckoned position while there is one, see ExtrapolateRunPositions
+    COALESCE(tr.extrapolated_lat_u6, tr.last_known_snapped_lat_u6) AS lat_u6,
+    COALESCE(tr.extrapolated_lng_u6, tr.last_known_snapped_lng_u6) AS lng_u6,
     tr.last_bearing_deg AS bearing_deg,
     tr.current_status,
-    tr.last_update_timestamp_iso
-FROM train_runs tr
+    tr.current_delay_min,
+    tr.speed_kmh,
+    tr.avg_speed_kmh,
+    tr.last_update_timestamp_iso,
+    CAST(tr.extrapolated_lat_u6 IS NOT NULL AS INTEGER) AS extrapolated,
+    CAST(COALESCE((
+        SELECT group_concat(cr.linked_train_no)
+        FROM carried cr
+        WHERE cr.carrier_run_id = tr.run_id
+    ), '') AS TEXT) AS linked_train_nos
+FROM live tr
 JOIN trains t ON tr.train_no = t.train_no
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM carried cr
+    WHERE cr.linked_train_no = tr.train_no
+      AND cr.run_date = tr.run_date
+)
+  -- alias runs are merged into the canonical run, only that one is shown
+  AND NOT EXISTS (
+    SELECT 1
+    FROM train_aliases ta
+    JOIN train_runs cr
+        ON cr.train_no = ta.train_no
+        AND cr.run_date = tr.run_date
+    WHERE ta.alias_train_no = tr.train_no
+)
+-- a stable order, so limits and pagination by clients cut the same trains every time
+ORDER BY tr.train_no, tr.run_date;
+
+
+-- name: ListNearbyTrains :many
+-- Returns live trains within radius_m metres of a point, nearest first. The box is a
+-- cheap prefilter around the circle, the distance is geodesic.
+WITH near AS (
+    SELECT
+        tr.run_id,
+        tr.train_no,
+        tr.run_date,
+        tr.last_known_snapped_lat_u6,
+        tr.last_known_snapped_lng_u6,
+        tr.last_known_distance_km_u4,
+        tr.last_bearing_deg,
+        tr.current_status,
+        tr.current_delay_min,
+        tr.last_update_timestamp_iso,
+        ST_Distance(
+            MakePoint(tr.last_known_snapped_lng_u6 / 1000000.0, tr.last_known_snapped_lat_u6 / 1000000.0, 4326),
+            MakePoint(@lng, @lat, 4326),
+            1
+        ) AS distance_m
+    FROM train_runs tr
+    WHERE tr.has_arrived = 0
+      AND tr.last_known_snapped_lat_u6 BETWEEN @min_lat_u6 AND @max_lat_u6
+      AND tr.last_known_snapped_lng_u6 BETWEEN @min_lng_u6 AND @max_lng_u6
+      AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+)
+SELECT
+    n.run_id,
+    n.train_no,
+    t.train_name,
+    t.train_type,
+    n.last_known_snapped_lat_u6 AS lat_u6,
+    n.last_known_snapped_lng_u6 AS lng_u6,
+    n.last_known_distance_km_u4 AS distance_km_u4,
+    n.last_bearing_deg AS bearing_deg,
+    n.current_status,
+    n.current_delay_min,
+    n.last_update_timestamp_iso,
+    CAST(n.distance_m AS REAL) AS distance_m
+FROM near n
+JOIN trains t ON n.train_no = t.train_no
+WHERE n.distance_m <= @radius_m
+  -- alias runs are merged into the canonical run, only that one is shown
+  AND NOT EXISTS (
+    SELECT 1
+    FROM train_aliases ta
+    JOIN train_runs cr
+        ON cr.train_no = ta.train_no
+        AND cr.run_date = n.run_date
+    WHERE ta.alias_train_no = n.train_no
+)
+ORDER BY n.distance_m, n.train_no
+LIMIT @limit;
+
+-- name: ListLiveChangesSince :many
+-- Runs written since @since (UTC, CURRENT_TIMESTAMP format) and live runs that went stale
+-- in the meantime, for working out a delta against a client's last snapshot
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.has_arrived,
+    0 AS went_stale
+FROM train_runs tr
+WHERE tr.updated_at >= @since
+UNION ALL
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.has_arrived,
+    1 AS went_stale
+FROM train_runs tr
+WHERE tr.has_arrived = 0
+  AND datetime(tr.last_update_timestamp_iso) > datetime(@since, '-15 minutes')
+  AND datetime(tr.last_update_timestamp_iso) <= datetime('now', '-15 minutes')
+ORDER BY 2, 1;
+
+-- name: GetLiveVersion :one
+-- Cheap fingerprint of the live set for ETags: the latest run write plus the count and a
+-- position checksum of live runs, so trains dropping out of the window change it too
+SELECT
+    CAST(COALESCE((SELECT MAX(updated_at) FROM train_runs), '') AS TEXT) AS max_updated_at,
+    CAST(COUNT(*) AS INTEGER) AS live_runs,
+    CAST(COALESCE(SUM(
+        COALESCE(tr.extrapolated_lat_u6, tr.last_known_snapped_lat_u6)
+        + COALESCE(tr.extrapolated_lng_u6, tr.last_known_snapped_lng_u6)
+    ), 0) AS INTEGER) AS position_sum
+FROM train_runs tr
 WHERE tr.has_arrived = 0
   AND tr.last_known_snapped_lat_u6 IS NOT NULL
   AND tr.last_known_snapped_lng_u6 IS NOT NULL
-  -- Only recent updates (avoid stale data)
+  AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes');
+
+-- name: ListLiveRouteShapes :many
+-- Returns the stops with coordinates, in route order, of live runs whose route
+-- overlaps the given box
+WITH live AS (
+    SELECT tr.train_no, tr.schedule_id
+    FROM train_runs tr
+    WHERE tr.has_arrived = 0
+      AND tr.last_known_snapped_lat_u6 IS NOT NULL
+      AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+),
+overlapping AS (
+    SELECT l.train_no, l.schedule_id
+    FROM live l
+    JOIN train_routes rt ON rt.schedule_id = l.schedule_id
+    JOIN stations s ON s.station_code = rt.station_code
+    WHERE s.lat IS NOT NULL AND s.lng IS NOT NULL
+    GROUP BY l.train_no, l.schedule_id
+    HAVING MAX(s.lat) >= @min_lat AND MIN(s.lat) <= @max_lat
+       AND MAX(s.lng) >= @min_lng AND MIN(s.lng) <= @max_lng
+)
+SELECT
+    o.train_no,
+    CAST(s.lat AS REAL) AS lat,
+    CAST(s.lng AS REAL) AS lng
+FROM overlapping o
+JOIN train_routes rt ON rt.schedule_id = o.schedule_id
+JOIN stations s ON s.station_code = rt.station_code
+WHERE s.lat IS NOT NULL AND s.lng IS NOT NULL
+ORDER BY o.train_no, rt.distance_km;
+
+-- name: ListRunsByIDs :many
+-- Returns the current state of the given runs, ids that do not exist are left out
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    tr.run_date,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    tr.last_known_snapped_lat_u6 AS lat_u6,
+    tr.last_known_snapped_lng_u6 AS lng_u6,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    tr.last_update_timestamp_ISO,
+    (
+        SELECT a.kind
+        FROM run_anomalies a
+        WHERE a.run_id = tr.run_id
+          AND a.resolved_at IS NULL
+        ORDER BY a.detected_at DESC
+        LIMIT 1
+    ) AS anomaly,
+    tr.quality_score
+FROM train_runs tr
+JOIN trains t ON tr.train_no = t.train_no
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+WHERE tr.run_id IN (sqlc.slice('run_ids'));
+
+-- name: ListRunsByDate :many
+-- Returns a page of runs scheduled to start on the given date after after_train_no,
+-- min_quality 0 includes unscored runs, an empty status and has_started -1 include all
+-- Linked runs riding a live carrier report the carrier's position and its run as carried_by,
+-- runs under an alias number are left out when the canonical run exists
+WITH carried AS (
+    SELECT
+        lr.run_id,
+        MIN(c.run_id) AS carrier_run_id
+    FROM train_runs c
+    JOIN train_links l ON l.train_no = c.train_no
+    JOIN train_runs lr
+        ON lr.train_no = l.linked_train_no
+        AND lr.run_date = c.run_date
+    LEFT JOIN train_routes rf
+        ON rf.schedule_id = c.schedule_id
+        AND rf.station_code = l.from_station_code
+    LEFT JOIN train_routes rt
+        ON rt.schedule_id = c.schedule_id
+        AND rt.station_code = l.to_station_code
+    WHERE c.run_date = @run_date
+      AND c.has_arrived = 0
+      AND datetime(c.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+      AND c.last_known_distance_km_u4 >= CAST(COALESCE(rf.distance_km, 0) * 10000 AS INTEGER)
+      AND (rt.distance_km IS NULL OR c.last_known_distance_km_u4 <= CAST(rt.distance_km * 10000 AS INTEGER))
+    GROUP BY lr.run_id
+)
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    tr.run_date,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    COALESCE(c.last_known_snapped_lat_u6, tr.last_known_snapped_lat_u6) AS lat_u6,
+    COALESCE(c.last_known_snapped_lng_u6, tr.last_known_snapped_lng_u6) AS lng_u6,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    tr.last_update_timestamp_ISO,
+    (
+        SELECT a.kind
+        FROM run_anomalies a
+        WHERE a.run_id = tr.run_id
+          AND a.resolved_at IS NULL
+        ORDER BY a.detected_at DESC
+        LIMIT 1
+    ) AS anomaly,
+    tr.quality_score,
+    cr.carrier_run_id AS carried_by
+FROM train_runs tr
+JOIN trains t ON tr.train_no = t.train_no
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+LEFT JOIN carried cr ON cr.run_id = tr.run_id
+LEFT JOIN train_runs c ON c.run_id = cr.carrier_run_id
+WHERE tr.run_date = @run_date
+  AND (@min_quality = 0 OR tr.quality_score >= @min_quality)
+  AND (
+    @status = ''
+    OR (@status = 'scheduled' AND tr.has_started = 0 AND tr.has_arrived = 0)
+    OR (@status = 'running' AND tr.has_started = 1 AND tr.has_arrived = 0)
+    OR (@status = 'completed' AND tr.has_arrived = 1 AND tr.current_status NOT IN ('cancelled', 'not_running_today', 'no_data', 'timed_out'))
+    OR (@status = 'cancelled' AND tr.current_status IN ('cancelled', 'not_running_today'))
+    OR (@status = 'no_data' AND tr.current_status IN ('no_data', 'timed_out'))
+  )
+  AND (@has_started = -1 OR tr.has_started = @has_started)
+  AND NOT EXISTS (
+    SELECT 1
+    FROM train_aliases ta
+    JOIN train_runs ca
+        ON ca.train_no = ta.train_no
+        AND ca.run_date = tr.run_date
+    WHERE ta.alias_train_no = tr.train_no
+  )
+  AND tr.train_no > @after_train_no
+ORDER BY tr.train_no
+LIMIT @limit;
+
+-- name: ListRunLocations :many
+-- Returns the logged location history of a run in chronological order
+SELECT
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = @run_id
+ORDER BY timestamp_ISO;
+
+-- name: ListRunLocationsPage :many
+-- Returns a page of the location history of a run after the (timestamp, id) cursor,
+-- an empty after_timestamp starts from the beginning
+SELECT
+    id,
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = @run_id
+  AND (timestamp_ISO > @after_timestamp OR (timestamp_ISO = @after_timestamp AND id > @after_id))
+ORDER BY timestamp_ISO, id
+LIMIT @limit;
+
+-- name: GetStationBoard :many
+-- Returns runs calling at a station with a scheduled departure on the given date
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_arrival_min_from_start)) AS TEXT) AS sch_arrival,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) AS TEXT) AS sch_departure,
+    rt.distance_km,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    p.platform,
+    p.platform_info
+FROM train_routes rt
+JOIN train_schedules ts ON rt.schedule_id = ts.schedule_id
+JOIN train_runs tr ON tr.schedule_id = ts.schedule_id
+JOIN trains t ON tr.train_no = t.train_no
+LEFT JOIN train_run_platforms p ON p.run_id = tr.run_id AND p.station_code = rt.station_code
+WHERE rt.station_code = @station_code
+  AND rt.stops = 1
+  AND tr.run_date BETWEEN date(@board_date, '-3 days') AND @board_date
+  AND date(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) = @board_date
+ORDER BY sch_departure;
+
+-- name: GetStationLiveBoard :many
+-- Returns runs calling at a station scheduled to depart between from_time and to_time
+-- (local, YYYY-MM-DD HH:MM:SS) with what is known live: the actuals recorded at this
+-- station and the run's latest reported delay
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_arrival_min_from_start)) AS TEXT) AS sch_arrival,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) AS TEXT) AS sch_departure,
+    rt.distance_km,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    e.act_arrival_tm,
+    e.act_departure_tm,
+    CAST(COALESCE(e.departed, 0) AS INTEGER) AS departed,
+    (
+        SELECT COALESCE(d.delay_departure_min, d.delay_arrival_min)
+        FROM train_run_station_events d
+        WHERE d.run_id = tr.run_id
+          AND COALESCE(d.delay_departure_min, d.delay_arrival_min) IS NOT NULL
+        ORDER BY d.sno DESC
+        LIMIT 1
+    ) AS current_delay_min,
+    p.platform,
+    p.platform_info
+FROM train_routes rt
+JOIN train_schedules ts ON rt.schedule_id = ts.schedule_id
+JOIN train_runs tr ON tr.schedule_id = ts.schedule_id
+JOIN trains t ON tr.train_no = t.train_no
+LEFT JOIN train_run_station_events e ON e.run_id = tr.run_id AND e.station_code = rt.station_code
+LEFT JOIN train_run_platforms p ON p.run_id = tr.run_id AND p.station_code = rt.station_code
+WHERE rt.station_code = @station_code
+  AND rt.stops = 1
+  AND tr.run_date BETWEEN date(@from_time, '-3 days') AND date(@to_time)
+  AND datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) BETWEEN @from_time AND @to_time
+ORDER BY sch_departure;
+
+-- name: ListSchedulesBetween :many
+-- Returns schedules stopping at from_code and later at to_code, with the minutes from
+-- origin departure at both so callers can place them on a date
+SELECT
+    ts.schedule_id,
+    ts.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    ts.origin_sch_departure_min,
+    ts.running_days_bitmap,
+    a.sch_departure_min_from_start AS from_departure_min,
+    b.sch_arrival_min_from_start AS to_arrival_min,
+    CAST(b.distance_km - a.distance_km AS REAL) AS distance_km
+FROM train_routes a
+JOIN train_routes b ON b.schedule_id = a.schedule_id
+JOIN train_schedules ts ON ts.schedule_id = a.schedule_id
+JOIN trains t ON t.train_no = ts.train_no
+WHERE a.station_code = @from_code
+  AND b.station_code = @to_code
+  AND a.stops = 1
+  AND b.stops = 1
+  AND b.distance_km > a.distance_km
+ORDER BY (ts.origin_sch_departure_min + a.sch_departure_min_from_start) % 1440, ts.train_no;
+
+-- name: ListRunStationEvents :many
+-- Returns the recorded per-station actuals and delays of a run along the route
+SELECT
+    e.sno,
+    e.station_code,
+    s.station_name,
+    e.distance_km_u4,
+    e.sch_arrival_tm,
+    e.act_arrival_tm,
+    e.sch_departure_tm,
+    e.act_departure_tm,
+    e.delay_arrival_min,
+    e.delay_departure_min,
+    e.departed
+FROM train_run_station_events e
+LEFT JOIN stations s ON e.station_code = s.station_code
+WHERE e.run_id = @run_id
+ORDER BY e.sno;
+
+-- name: ListTrainStationDelayHistory :many
+-- Returns the average delays per station over the last runs of a train before a date
+-- that have actuals recorded, runs being how many of them were found
+WITH recent AS (
+    SELECT tr.run_id
+    FROM train_runs tr
+    WHERE tr.train_no = @train_no
+      AND tr.run_date < @before_date
+      AND EXISTS (SELECT 1 FROM train_run_station_events e WHERE e.run_id = tr.run_id)
+    ORDER BY tr.run_date DESC
+    LIMIT @runs
+)
+SELECT
+    e.station_code,
+    (SELECT COUNT(*) FROM recent) AS runs,
+    COUNT(*) AS samples,
+    CAST(AVG(e.delay_arrival_min) AS REAL) AS avg_delay_arrival_min,
+    CAST(AVG(e.delay_departure_min) AS REAL) AS avg_delay_departure_min
+FROM train_run_station_events e
+JOIN recent ON recent.run_id = e.run_id
+WHERE COALESCE(e.delay_departure_min, e.delay_arrival_min) IS NOT NULL
+GROUP BY e.station_code;
+
+-- name: GetSegmentStats :one
+SELECT
+    from_station_code,
+    to_station_code,
+    distance_km,
+    samples,
+    avg_speed_kmh,
+    min_speed_kmh,
+    max_speed_kmh,
+    avg_runtime_min,
+    updated_at
+FROM segment_stats
+WHERE from_station_code = @from_station_code
+  AND to_station_code = @to_station_code;
+
+-- name: ListSlowestSegments :many
+-- Returns segments ordered by observed average speed, slowest first
+SELECT
+    from_station_code,
+    to_station_code,
+    distance_km,
+    samples,
+    avg_speed_kmh,
+    min_speed_kmh,
+    max_speed_kmh,
+    avg_runtime_min,
+    updated_at
+FROM segment_stats
+WHERE samples >= @min_samples
+ORDER BY avg_speed_kmh ASC
+LIMIT @limit;
+
+-- name: ListTrainPunctuality :many
+-- Aggregates terminal punctuality per train over completed runs since the given date
+SELECT
+    s.train_no,
+    t.train_name,
+    t.train_type,
+    COUNT(*) AS runs,
+    CAST(SUM(CASE WHEN s.terminal_delay_min <= @on_time_threshold_min THEN 1 ELSE 0 END) AS INTEGER) AS on_time_runs,
+    CAST(AVG(s.terminal_delay_min) AS REAL) AS avg_terminal_delay_min
+FROM run_delay_summaries s
+JOIN trains t ON s.train_no = t.train_no
+JOIN train_runs tr ON s.run_id = tr.run_id
+WHERE s.run_date >= @since_date
+  AND s.terminal_delay_min IS NOT NULL
+  AND (@min_quality = 0 OR tr.quality_score >= @min_quality)
+GROUP BY s.train_no
+HAVING COUNT(*) >= @min_runs;
+
+-- name: ListStationDelayBuckets :many
+-- Aggregates observed delays and delay gained per station for runs in a date range
+SELECT
+    d.station_code,
+    s.station_name,
+    s.lat,
+    s.lng,
+    COUNT(*) AS samples,
+    CAST(AVG(d.delay_min) AS REAL) AS avg_delay_min,
+    CAST(MAX(d.delay_min) AS INTEGER) AS max_delay_min,
+    CAST(COALESCE(AVG(d.gain_min), 0) AS REAL) AS avg_delay_gain_min
+FROM (
+    SELECT
+        e.station_code,
+        COALESCE(e.delay_departure_min, e.delay_arrival_min) AS delay_min,
+        COALESCE(e.delay_arrival_min, e.delay_departure_min)
+            - LAG(COALESCE(e.delay_departure_min, e.delay_arrival_min)) OVER (PARTITION BY e.run_id ORDER BY e.sno) AS gain_min
+    FROM train_run_station_events e
+    JOIN train_runs tr ON e.run_id = tr.run_id
+    WHERE tr.run_date BETWEEN @from_date AND @to_date
+) d
+JOIN stations s ON d.station_code = s.station_code
+WHERE d.delay_min IS NOT NULL
+GROUP BY d.station_code;
+
+-- name: ListStationCongestionByHour :many
+-- Returns occupancy of a station per local hour of day over days since the given date
+SELECT
+    hour,
+    COUNT(*) AS days_observed,
+    CAST(AVG(trains) AS REAL) AS avg_trains_seen,
+    CAST(AVG(avg_trains) AS REAL) AS avg_trains,
+    CAST(AVG(peak_trains) AS REAL) AS avg_peak_trains,
+    CAST(MAX(peak_trains) AS INTEGER) AS peak_trains
+FROM station_congestion_hourly
+WHERE station_code = @station_code
+  AND obs_date >= @since_date
+GROUP BY hour
+ORDER BY hour;
+
+-- name: ListCongestedStations :many
+-- Ranks stations by peak and average occupancy since the given date
+SELECT
+    c.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    CAST(MAX(c.peak_trains) AS INTEGER) AS peak_trains,
+    CAST(AVG(c.avg_trains) AS REAL) AS avg_trains,
+    CAST(SUM(c.trains) AS INTEGER) AS train_hours
+FROM station_congestion_hourly c
+LEFT JOIN stations s ON c.station_code = s.station_code
+WHERE c.obs_date >= @since_date
+GROUP BY c.station_code
+ORDER BY peak_trains DESC, avg_trains DESC
+LIMIT @limit;
+
+-- name: CountTrainsAtStation :one
+-- Counts active runs whose latest fix has them standing at the station
+SELECT COUNT(*)
+FROM train_runs tr
+JOIN train_run_locations l ON l.run_id = tr.run_id AND l.timestamp_ISO = tr.last_update_timestamp_ISO
+WHERE tr.has_arrived = 0
+  AND l.segment_station_code = @station_code
+  AND l.at_station = 1
+  AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes');
+
+-- name: ListTrainsAtStation :many
+-- Returns the active runs CountTrainsAtStation counts, with the schedule at the station
+-- when it is on their route, the actual arrival recorded there and the first fix that
+-- had them standing at it
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    CASE WHEN rt.schedule_id IS NOT NULL
+        THEN CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_arrival_min_from_start)) AS TEXT)
+    END AS sch_arrival,
+    CASE WHEN rt.schedule_id IS NOT NULL
+        THEN CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) AS TEXT)
+    END AS sch_departure,
+    tr.current_status,
+    tr.current_delay_min,
+    e.act_arrival_tm,
+    CAST((
+        SELECT MIN(l2.timestamp_ISO)
+        FROM train_run_locations l2
+        WHERE l2.run_id = tr.run_id
+          AND l2.segment_station_code = l.segment_station_code
+          AND l2.at_station = 1
+    ) AS TEXT) AS first_seen_at
+FROM train_runs tr
+JOIN train_run_locations l ON l.run_id = tr.run_id AND l.timestamp_ISO = tr.last_update_timestamp_ISO
+JOIN train_schedules ts ON ts.schedule_id = tr.schedule_id
+JOIN trains t ON t.train_no = tr.train_no
+LEFT JOIN train_routes rt ON rt.schedule_id = tr.schedule_id AND rt.station_code = l.segment_station_code
+LEFT JOIN train_run_station_events e ON e.run_id = tr.run_id AND e.station_code = l.segment_station_code
+WHERE tr.has_arrived = 0
+  AND l.segment_station_code = @station_code
+  AND l.at_station = 1
   AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+ORDER BY first_seen_at, tr.run_id;
+
+-- name: GetRunPredictionContext :one
+-- Returns what the ETA prediction needs to know about a run
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    tr.schedule_id,
+    ts.origin_sch_departure_min,
+    tr.has_started,
+    tr.has_arrived,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    tr.last_update_timestamp_ISO
+FROM train_runs tr
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+WHERE tr.run_id = @run_id;
+
+-- name: GetRunState :one
+-- Returns the live fields of one run, watched by the run event stream
+SELECT
+    run_id,
+    has_started,
+    has_arrived,
+    current_status,
+    last_updated_sno,
+    last_known_lat_u6 AS lat_u6,
+    last_known_lng_u6 AS lng_u6,
+    last_known_snapped_lat_u6 AS snapped_lat_u6,
+    last_known_snapped_lng_u6 AS snapped_lng_u6,
+    last_known_distance_km_u4 AS distance_km_u4,
+    last_bearing_deg AS bearing_deg,
+    last_update_timestamp_ISO
+FROM train_runs
+WHERE run_id = @run_id;
+
+-- name: ListScheduleRoute :many
+-- Returns the static route of a schedule in running order
+SELECT
+    rt.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    rt.distance_km,
+    rt.sch_arrival_min_from_start,
+    rt.sch_departure_min_from_start,
+    rt.stops,
+    s.lat,
+    s.lng
+FROM train_routes rt
+LEFT JOIN stations s ON rt.station_code = s.station_code
+WHERE rt.schedule_id = @schedule_id
+ORDER BY rt.distance_km, rt.sch_arrival_min_from_start;
+
+-- name: GetScheduleShape :one
+-- Returns the snapping geometry of a schedule as GeoJSON in WGS84, NULL when it has none
+SELECT
+    ts.schedule_id,
+    ts.train_no,
+    AsGeoJSON(ST_Transform(trg.route_geom, 4326), 6) AS geojson
+FROM train_schedules ts
+LEFT JOIN train_route_geometries trg ON trg.schedule_id = ts.schedule_id
+WHERE ts.schedule_id = @schedule_id;
+
+-- name: ListTrainTimetable :many
+-- Returns every stop of every schedule of a train, schedules in departure order
+SELECT
+    t.train_name,
+    t.train_type,
+    ts.schedule_id,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    ts.origin_sch_departure_min,
+    ts.total_distance_km,
+    ts.total_runtime_min,
+    ts.running_days_bitmap,
+    rt.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    rt.distance_km,
+    rt.sch_arrival_min_from_start,
+    rt.sch_departure_min_from_start,
+    rt.stops
+FROM train_schedules ts
+JOIN trains t ON t.train_no = ts.train_no
+JOIN train_routes rt ON rt.schedule_id = ts.schedule_id
+LEFT JOIN stations s ON s.station_code = rt.station_code
+WHERE ts.train_no = @train_no
+ORDER BY ts.origin_sch_departure_min, ts.schedule_id, rt.distance_km, rt.sch_arrival_min_from_start;
+
+-- name: ListTrainSchedules :many
+-- Returns the schedules of a train with their running days, as the poller left them
+SELECT
+    schedule_id,
+    origin_station_code,
+    terminus_station_code,
+    origin_sch_departure_min,
+    running_days_bitmap
+FROM train_schedules
+WHERE train_no = @train_no
+ORDER BY origin_sch_departure_min, schedule_id;
+
+-- name: ListTrainRunDates :many
+-- Returns the runs of a train with a run date in [from_date, to_date]
+SELECT
+    run_id,
+    run_date,
+    schedule_id,
+    current_status,
+    has_started,
+    has_arrived
+FROM train_runs
+WHERE train_no = @train_no
+  AND run_date BETWEEN @from_date AND @to_date
+ORDER BY run_date;
+
+-- name: ListTrainDelayProfiles :many
+-- Returns the station delay profiles of a train for one weekday plus the all-days fallback
+SELECT
+    weekday,
+    station_code,
+    samples,
+    avg_delay_min,
+    p10_delay_min,
+    p50_delay_min,
+    p90_delay_min
+FROM train_station_delay_profiles
+WHERE train_no = @train_no
+  AND weekday IN (@weekday, -1);
+
+-- name: ListOpenAnomalies :many
+-- Returns unresolved anomalies, longest running first
+SELECT
+    a.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    a.kind,
+    a.station_code,
+    s.station_name,
+    tr.last_known_snapped_lat_u6 AS lat_u6,
+    tr.last_known_snapped_lng_u6 AS lng_u6,
+    a.distance_km_u4,
+    a.since_ts,
+    a.detected_at
+FROM run_anomalies a
+JOIN train_runs tr ON a.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+LEFT JOIN stations s ON a.station_code = s.station_code
+WHERE a.resolved_at IS NULL
+ORDER BY datetime(a.since_ts);
+
+-- name: ListDailyTrainSummaries :many
+SELECT
+    d.summary_date,
+    d.train_no,
+    t.train_name,
+    t.train_type,
+    d.runs,
+    d.completed_runs,
+    d.cancelled_runs,
+    d.tracked_runs,
+    d.on_time_runs,
+    d.avg_delay_min,
+    d.avg_terminal_delay_min,
+    d.coverage_pct
+FROM daily_train_summaries d
+JOIN trains t ON d.train_no = t.train_no
+WHERE d.summary_date = @summary_date
+ORDER BY d.train_no;
+
+-- name: ListDailyStationSummaries :many
+SELECT
+    d.summary_date,
+    d.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    d.trains,
+    d.on_time_trains,
+    d.avg_delay_min,
+    d.max_delay_min
+FROM daily_station_summaries d
+LEFT JOIN stations s ON d.station_code = s.station_code
+WHERE d.summary_date = @summary_date
+ORDER BY d.trains DESC, d.station_code;
+
+-- name: ListDailyZoneSummaries :many
+SELECT
+    summary_date,
+    zone,
+    trains,
+    runs,
+    completed_runs,
+    cancelled_runs,
+    tracked_runs,
+    on_time_runs,
+    avg_delay_min,
+    avg_terminal_delay_min,
+    coverage_pct
+FROM daily_zone_summaries
+WHERE summary_date = @summary_date
+ORDER BY zone;
+
+-- name: ListLocationsBetween :many
+-- Returns every logged fix in [from_ts, to_ts] grouped by run, timestamps compared as text
+SELECT
+    l.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    l.lat_u6,
+    l.lng_u6,
+    l.snapped_lat_u6,
+    l.snapped_lng_u6,
+    l.distance_km_u4,
+    l.segment_station_code,
+    l.at_station,
+    l.timestamp_ISO
+FROM train_run_locations l
+JOIN train_runs tr ON l.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE l.timestamp_ISO BETWEEN @from_ts AND @to_ts
+  AND (@min_quality = 0 OR tr.quality_score >= @min_quality)
+ORDER BY l.run_id, l.timestamp_ISO;
+
+-- name: ListPositionsAt :many
+-- Returns the latest fix of every run logged in [from_ts, at_ts], timestamps compared as text
+WITH latest AS (
+    SELECT
+        l.*,
+        ROW_NUMBER() OVER (PARTITION BY l.run_id ORDER BY l.timestamp_ISO DESC) AS rn
+    FROM train_run_locations l
+    WHERE l.timestamp_ISO BETWEEN @from_ts AND @at_ts
+)
+SELECT
+    l.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    l.lat_u6,
+    l.lng_u6,
+    l.snapped_lat_u6,
+    l.snapped_lng_u6,
+    l.distance_km_u4,
+    l.segment_station_code,
+    l.at_station,
+    l.timestamp_ISO
+FROM latest l
+JOIN train_runs tr ON l.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE l.rn = 1
+  AND (@min_quality = 0 OR tr.quality_score >= @min_quality)
+ORDER BY tr.train_no;
+
+-- name: ListStationGroupPunctuality :many
+-- Aggregates station summaries since the given date by station zone or division. Days from
+-- rollup_from (the first of a month) on are read from the monthly rollups, an empty
+-- rollup_from reads daily summaries only.
+SELECT
+    COALESCE(NULLIF(TRIM(CASE WHEN @group_by = 'division' THEN s.division ELSE s.zone END), ''), 'UNKNOWN') AS group_key,
+    COALESCE(MAX(s.zone), '') AS zone,
+    COUNT(DISTINCT d.station_code) AS stations,
+    CAST(SUM(d.trains) AS INTEGER) AS arrivals,
+    CAST(SUM(d.on_time_trains) AS INTEGER) AS on_time_arrivals,
+    CAST(SUM(COALESCE(d.avg_delay_min, 0) * d.trains) / MAX(SUM(d.trains), 1) AS REAL) AS avg_delay_min,
+    CAST(COALESCE(MAX(d.max_delay_min), 0) AS INTEGER) AS max_delay_min
+FROM (
+    SELECT station_code, trains, on_time_trains, avg_delay_min, max_delay_min
+    FROM daily_station_summaries
+    WHERE summary_date >= @since_date
+      AND (@rollup_from = '' OR summary_date < @rollup_from)
+    UNION ALL
+    SELECT station_code, trains, on_time_trains, avg_delay_min, max_delay_min
+    FROM monthly_station_summaries
+    WHERE @rollup_from != ''
+      AND month >= substr(@rollup_from, 1, 7)
+) d
+JOIN stations s ON d.station_code = s.station_code
+GROUP BY 1
+ORDER BY 1;
+
+-- name: ListRakeZonePunctuality :many
+-- Aggregates zone summaries (by the zone owning the rake) since the given date, reading
+-- the monthly rollups from rollup_from on like ListStationGroupPunctuality
+SELECT
+    zone,
+    CAST(MAX(trains) AS INTEGER) AS trains,
+    CAST(SUM(runs) AS INTEGER) AS runs,
+    CAST(SUM(cancelled_runs) AS INTEGER) AS cancelled_runs,
+    CAST(SUM(tracked_runs) AS INTEGER) AS tracked_runs,
+    CAST(SUM(on_time_runs) AS INTEGER) AS on_time_runs,
+    CAST(SUM(COALESCE(avg_terminal_delay_min, 0) * tracked_runs) / MAX(SUM(tracked_runs), 1) AS REAL) AS avg_terminal_delay_min,
+    CAST(SUM(coverage_pct * days) / SUM(days) AS REAL) AS coverage_pct
+FROM (
+    SELECT zone, 1 AS days, trains, runs, cancelled_runs, tracked_runs, on_time_runs, avg_terminal_delay_min, coverage_pct
+    FROM daily_zone_summaries
+    WHERE summary_date >= @since_date
+      AND (@rollup_from = '' OR summary_date < @rollup_from)
+    UNION ALL
+    SELECT zone, days, trains, runs, cancelled_runs, tracked_runs, on_time_runs, avg_terminal_delay_min, coverage_pct
+    FROM monthly_zone_summaries
+    WHERE @rollup_from != ''
+      AND month >= substr(@rollup_from, 1, 7)
+)
+GROUP BY zone
+ORDER BY zone;
+
+-- name: ListSectionOccupancy :many
+-- Counts live runs per track section, a section being two adjacent stations of a run's
+-- route (direction independent) so schedules sharing track share the section
+SELECT
+    p.station_a,
+    COALESCE(sa.station_name, '') AS station_a_name,
+    sa.lat AS station_a_lat,
+    sa.lng AS station_a_lng,
+    p.station_b,
+    COALESCE(sb.station_name, '') AS station_b_name,
+    sb.lat AS station_b_lat,
+    sb.lng AS station_b_lng,
+    COUNT(*) AS trains,
+    CAST(SUM(p.from_code = p.station_a) AS INTEGER) AS trains_a_to_b,
+    CAST(GROUP_CONCAT(p.train_no) AS TEXT) AS train_nos
+FROM (
+    SELECT
+        run_id,
+        train_no,
+        from_code,
+        to_code,
+        CAST(MIN(from_code, to_code) AS TEXT) AS station_a,
+        CAST(MAX(from_code, to_code) AS TEXT) AS station_b
+    FROM (
+        SELECT
+            tr.run_id,
+            tr.train_no,
+            (
+                SELECT r.station_code
+                FROM train_routes r
+                WHERE r.schedule_id = tr.schedule_id
+                  AND r.distance_km <= tr.last_known_distance_km_u4 / 10000.0
+                ORDER BY r.distance_km DESC
+                LIMIT 1
+            ) AS from_code,
+            (
+                SELECT r.station_code
+                FROM train_routes r
+                WHERE r.schedule_id = tr.schedule_id
+                  AND r.distance_km > tr.last_known_distance_km_u4 / 10000.0
+                ORDER BY r.distance_km
+                LIMIT 1
+            ) AS to_code
+        FROM train_runs tr
+        WHERE tr.has_started = 1
+          AND tr.has_arrived = 0
+          AND tr.last_known_distance_km_u4 IS NOT NULL
+          AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+    )
+    WHERE from_code IS NOT NULL
+      AND to_code IS NOT NULL
+) p
+LEFT JOIN stations sa ON p.station_a = sa.station_code
+LEFT JOIN stations sb ON p.station_b = sb.station_code
+GROUP BY p.station_a, p.station_b
+HAVING COUNT(*) >= @min_trains
+ORDER BY trains DESC, p.station_a, p.station_b
+LIMIT @limit;
+
+-- name: ListRunEncounters :many
+-- Returns overtakes and crossings involving a run, from its own point of view
+SELECT
+    x.kind,
+    x.is_a,
+    x.other_run_id,
+    tr.train_no AS other_train_no,
+    t.train_name AS other_train_name,
+    t.train_type AS other_train_type,
+    x.from_station_code,
+    x.to_station_code,
+    x.encounter_tm
+FROM (
+    SELECT kind, 1 AS is_a, run_id_b AS other_run_id, from_station_code, to_station_code, encounter_tm
+    FROM run_encounters
+    WHERE run_id_a = @run_id
+    UNION ALL
+    SELECT kind, 0 AS is_a, run_id_a AS other_run_id, from_station_code, to_station_code, encounter_tm
+    FROM run_encounters
+    WHERE run_id_b = @run_id
+) x
+JOIN train_runs tr ON x.other_run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+ORDER BY x.encounter_tm;
+
+-- name: ListStationHeadways :many
+-- Returns headway stats of a station per direction
+SELECT
+    h.station_code,
+    h.next_station_code,
+    COALESCE(s.station_name, '') AS next_station_name,
+    h.samples,
+    h.min_headway_min,
+    h.avg_headway_min,
+    h.max_headway_min,
+    h.bunched,
+    h.updated_at
+FROM headway_stats h
+LEFT JOIN stations s ON h.next_station_code = s.station_code
+WHERE h.station_code = @station_code
+ORDER BY h.samples DESC;
+
+-- name: ListBunchedHeadways :many
+-- Ranks busy station directions by share of bunched headways
+SELECT
+    h.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    h.next_station_code,
+    h.samples,
+    h.min_headway_min,
+    h.avg_headway_min,
+    h.max_headway_min,
+    h.bunched,
+    CAST(100.0 * h.bunched / h.samples AS REAL) AS bunched_pct
+FROM headway_stats h
+LEFT JOIN stations s ON h.station_code = s.station_code
+WHERE h.samples >= @min_samples
+ORDER BY bunched_pct DESC, h.avg_headway_min
+LIMIT @limit;
+
+-- name: ListRunDelayAttribution :many
+-- Returns the inherited vs own delay breakdown of runs since the given date, optionally for one train
+SELECT
+    a.run_id,
+    tr.train_no,
+    t.train_name,
+    tr.run_date,
+    a.segments,
+    a.gained_min,
+    a.inherited_min,
+    a.own_min
+FROM run_delay_attribution a
+JOIN train_runs tr ON a.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE tr.run_date >= @since_date
+  AND (@train_no = 0 OR tr.train_no = @train_no)
+ORDER BY a.inherited_min DESC, a.gained_min DESC
+LIMIT @limit;
+
+-- name: ListWeatherDelays :many
+-- Returns station delay aggregates since the given date grouped by the weather of the
+-- station's division that day, optionally for one division
+SELECT
+    w.condition,
+    COUNT(DISTINCT w.division || ' ' || w.weather_date) AS division_days,
+    CAST(SUM(ds.trains) AS INTEGER) AS trains,
+    CAST(SUM(ds.on_time_trains) AS INTEGER) AS on_time_trains,
+    CAST(SUM(COALESCE(ds.avg_delay_min, 0) * ds.trains) / MAX(SUM(ds.trains), 1) AS REAL) AS avg_delay_min,
+    CAST(COALESCE(MAX(ds.max_delay_min), 0) AS INTEGER) AS max_delay_min
+FROM daily_station_summaries ds
+JOIN stations s ON ds.station_code = s.station_code
+JOIN division_weather_daily w ON w.division = s.division AND w.weather_date = ds.summary_date
+WHERE ds.summary_date >= @since_date
+  AND (@division = '' OR s.division = @division)
+GROUP BY w.condition
+ORDER BY avg_delay_min DESC;
+
+-- name: ListJourneyTimes :many
+-- Returns observed and scheduled journey times between two stations for runs since the
+-- given date that departed the first and later arrived at the second, optionally for one train
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    tr.run_date,
+    CAST(b.act_arrival_tm - a.act_departure_tm AS INTEGER) AS journey_sec,
+    CAST(b.sch_arrival_tm - a.sch_departure_tm AS INTEGER) AS scheduled_sec
+FROM train_run_station_events a
+JOIN train_run_station_events b ON b.run_id = a.run_id AND b.sno > a.sno
+JOIN train_runs tr ON a.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE a.station_code = @from_code
+  AND b.station_code = @to_code
+  AND tr.run_date >= @since_date
+  AND (@train_no = 0 OR tr.train_no = @train_no)
+  AND (@min_quality = 0 OR tr.quality_score >= @min_quality)
+  AND a.act_departure_tm IS NOT NULL
+  AND b.act_arrival_tm > a.act_departure_tm
+  AND a.sch_departure_tm IS NOT NULL
+  AND b.sch_arrival_tm IS NOT NULL
+ORDER BY tr.train_no, tr.run_date;
+
+-- name: ListRunCoverage :many
+-- Aggregates run coverage since the given date per run date, train or run, optionally for one train
+SELECT
+    CASE @group_by
+        WHEN 'train' THEN CAST(c.train_no AS TEXT)
+        WHEN 'run' THEN c.run_id
+        ELSE c.run_date
+    END AS group_key,
+    CAST(COUNT(*) AS INTEGER) AS runs,
+    CAST(SUM(c.polls) AS INTEGER) AS polls,
+    CAST(SUM(c.successful_polls) AS INTEGER) AS successful_polls,
+    CAST(SUM(c.expected_polls) AS INTEGER) AS expected_polls,
+    CAST(SUM(c.location_points) AS INTEGER) AS location_points,
+    CAST(AVG(c.points_per_hour) AS REAL) AS avg_points_per_hour,
+    CAST(SUM(c.gaps) AS INTEGER) AS gaps,
+    CAST(MAX(c.longest_gap_min) AS REAL) AS longest_gap_min,
+    CAST(AVG(c.station_actuals_pct) AS REAL) AS station_actuals_pct
+FROM run_coverage_stats c
+WHERE c.run_date >= @since_date
+  AND (@train_no = 0 OR c.train_no = @train_no)
+GROUP BY 1
+ORDER BY MIN(c.run_date), MIN(c.train_no), 1;
+
+-- name: SearchStations :many
+-- Ranks stations matching an FTS5 expression, an exact station code first, then by
+-- bm25 with code and name weighted above the address
+SELECT
+    s.station_code,
+    s.station_name,
+    s.zone,
+    s.division,
+    s.address,
+    s.lat,
+    s.lng,
+    s.station_type,
+    CAST(bm25(stations_fts, 10.0, 5.0, 1.0) AS REAL) AS rank
+FROM stations_fts
+JOIN stations s ON s.rowid = stations_fts.rowid
+WHERE stations_fts MATCH @match
+ORDER BY s.station_code = @station_code DESC, rank
+LIMIT @limit;
+
+-- name: ListNearbyStations :many
+-- Returns stations within radius_m metres of a point, nearest first. The spatial index
+-- narrows the search to the box around the circle, the distance is geodesic.
+WITH near AS (
+    SELECT
+        s.station_code,
+        s.station_name,
+        s.zone,
+        s.division,
+        s.lat,
+        s.lng,
+        s.number_of_platforms,
+        s.station_type,
+        s.station_category,
+        ST_Distance(s.geom, MakePoint(@lng, @lat, 4326), 1) AS distance_m
+    FROM stations s
+    WHERE s.rowid IN (
+        SELECT rowid
+        FROM SpatialIndex
+        WHERE f_table_name = 'stations'
+          AND f_geometry_column = 'geom'
+          AND search_frame = BuildMbr(@min_lng, @min_lat, @max_lng, @max_lat, 4326)
+    )
+)
+SELECT
+    station_code,
+    station_name,
+    zone,
+    division,
+    lat,
+    lng,
+    number_of_platforms,
+    station_type,
+    station_category,
+    CAST(distance_m AS REAL) AS distance_m
+FROM near
+WHERE distance_m <= @radius_m
+ORDER BY distance_m, station_code
+LIMIT @limit;
+
+-- name: GetTrain :one
+-- Returns one train by number
+SELECT
+    train_no,
+    train_name,
+    train_type,
+    zone,
+    return_train_no
+FROM trains
+WHERE train_no = @train_no;
+
+-- name: GetStation :one
+-- Returns one station by code
+SELECT
+    station_code,
+    station_name,
+    zone,
+    division,
+    address,
+    elevation_m,
+    lat,
+    lng,
+    number_of_platforms,
+    station_type,
+    station_category,
+    track_type
+FROM stations
+WHERE station_code = @station_code;
+
+-- name: GetTrainRake :one
+-- Returns a train with its scraped coach composition
+SELECT
+    train_no,
+    train_name,
+    train_type,
+    coachComposition,
+    updated_at
+FROM trains
+WHERE train_no = @train_no;
+
+-- name: ListTrainCoaches :many
+-- Returns the parsed rake of a train from the locomotive end
+SELECT
+    position,
+    coach_code,
+    class,
+    kind
+FROM train_coaches
+WHERE train_no = @train_no
+ORDER BY position;
+
+-- name: GetTrainSourceURL :one
+-- tracked pages first, a train added there may not have been synced yet
+SELECT source_url
+FROM (
+    SELECT source_url, 0 AS pref FROM tracked_trains WHERE train_no = @train_no
+    UNION ALL
+    SELECT source_url, 1 AS pref FROM trains WHERE train_no = @train_no
+)
+ORDER BY pref
+LIMIT 1;
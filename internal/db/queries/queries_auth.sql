@@ -0,0 +1,61 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+    name,
+    key_hash,
+    key_prefix,
+    scopes
+) VALUES (
+    @name,
+    @key_hash,
+    @key_prefix,
+    @scopes
+)
+RETURNING id, created_at;
+
+-- name: EnsureAPIKey :exec
+-- keeps a configured key present across restarts, a revoked one stays revoked
+INSERT INTO api_keys (
+    name,
+    key_hash,
+    key_prefix,
+    scopes
+) VALUES (
+    @name,
+    @key_hash,
+    @key_prefix,
+    @scopes
+)
+ON CONFLICT (key_hash) DO NOTHING;
+
+-- name: GetActiveAPIKey :one
+SELECT
+    id,
+    name,
+    scopes
+FROM api_keys
+WHERE key_hash = @key_hash
+  AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = @used_at
+WHERE id = @id
+  AND (last_used_at IS NULL OR datetime(last_used_at) < datetime(@used_at, '-1 minute'));
+
+-- name: ListAPIKeys :many
+SELECT
+    id,
+    name,
+    key_prefix,
+    scopes,
+    created_at,
+    last_used_at,
+    revoked_at
+FROM api_keys
+ORDER BY id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = @revoked_at
+WHERE id = @id
+  AND revoked_at IS NULL;
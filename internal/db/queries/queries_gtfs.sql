@@ -0,0 +1,48 @@
+-- name: ListGTFSStops :many
+-- Returns stations with coordinates that are a scheduled stop on some route
+SELECT
+    s.station_code,
+    s.station_name,
+    CAST(s.lat AS REAL) AS lat,
+    CAST(s.lng AS REAL) AS lng
+FROM stations s
+WHERE s.lat IS NOT NULL
+  AND s.lng IS NOT NULL
+  AND EXISTS (
+    SELECT 1
+    FROM train_routes rt
+    WHERE rt.station_code = s.station_code
+      AND rt.stops = 1
+)
+ORDER BY s.station_code;
+
+-- name: ListGTFSTrips :many
+-- Returns every schedule that runs on at least one weekday, with its train and headsign
+SELECT
+    ts.schedule_id,
+    ts.train_no,
+    t.train_name,
+    t.train_type,
+    ts.running_days_bitmap,
+    CAST(COALESCE(s.station_name, ts.terminus_station_code) AS TEXT) AS headsign
+FROM train_schedules ts
+JOIN trains t ON t.train_no = ts.train_no
+LEFT JOIN stations s ON s.station_code = ts.terminus_station_code
+WHERE ts.running_days_bitmap > 0
+ORDER BY ts.train_no, ts.schedule_id;
+
+-- name: ListGTFSStopTimes :many
+-- Returns the scheduled stops of every route at stations with coordinates, in route order
+SELECT
+    rt.schedule_id,
+    rt.station_code,
+    rt.distance_km,
+    ts.origin_sch_departure_min + rt.sch_arrival_min_from_start AS arrival_min,
+    ts.origin_sch_departure_min + rt.sch_departure_min_from_start AS departure_min
+FROM train_routes rt
+JOIN train_schedules ts ON ts.schedule_id = rt.schedule_id
+JOIN stations s ON s.station_code = rt.station_code
+WHERE rt.stops = 1
+  AND s.lat IS NOT NULL
+  AND s.lng IS NOT NULL
+ORDER BY rt.schedule_id, rt.distance_km;
@@ -1,5 +1,7 @@
 -- name: ListRunsToPoll :many
--- Fetch active runs with error threshold and start-time gating
+-- Fetch active runs with static response threshold and start-time gating, started runs
+-- first and then by priority tier. Runs failing with errors are backed off through
+-- next_poll_at instead.
 SELECT
     tr.run_id,
     tr.train_no,
@@ -9,40 +11,231 @@ SELECT
     tr.last_updated_sno,
     tr.last_update_timestamp_ISO,
     COALESCE(tr.errors, '{}') AS errors,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.has_started,
     ts.schedule_id,
     ts.origin_station_code AS source_station,
-    ts.terminus_station_code AS destination_station
+    ts.terminus_station_code AS destination_station,
+    COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) AS origin_sch_departure_min,
+    CAST(t.priority AS INTEGER) AS priority,
+    t.train_type
 FROM train_runs tr
 JOIN train_schedules ts
     ON tr.schedule_id = ts.schedule_id
+JOIN trains t
+    ON t.train_no = tr.train_no
 WHERE tr.has_arrived = 0
   AND date(tr.run_date) <= date(@now_ts)
   AND date(tr.run_date) >= date(@now_ts, '-5 days')
   AND COALESCE(json_extract(tr.errors, '$.static_response.count'), 0)
         < CAST(@static_response_threshold AS INTEGER)
-  AND (
-        COALESCE(json_extract(tr.errors, '$.static_response.count'), 0) +
-        COALESCE(json_extract(tr.errors, '$.api_error.count'), 0) +
-        COALESCE(json_extract(tr.errors, '$.unknown.count'), 0)
-      ) < CAST(@total_error_threshold AS INTEGER)
+  -- a rescheduled run waits for its revised departure
   AND datetime(
-        tr.run_date || ' ' ||
-        printf(
-            '%02d:%02d',
-            ts.origin_sch_departure_min / 60,
-            ts.origin_sch_departure_min % 60
-        )
+        tr.run_date,
+        '+' || COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) || ' minutes'
       ) <= datetime(@now_ts)
-ORDER BY tr.last_update_timestamp_ISO ASC NULLS FIRST;
+  -- while upstream reports the run under an alias the canonical number is left alone,
+  -- polling it would only bring back not_running_today
+  AND NOT EXISTS (
+        SELECT 1
+        FROM train_aliases ta
+        JOIN train_runs ar
+            ON ar.train_no = ta.alias_train_no
+            AND ar.run_date = tr.run_date
+        WHERE ta.train_no = tr.train_no
+          AND datetime(ar.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+      )
+  -- runs not worth polling every cycle or backing off are put off, see poller.nextPoll
+  AND (tr.next_poll_at IS NULL OR tr.next_poll_at <= @now_utc)
+  -- with leases each instance polls its own runs, an empty owner polls every run
+  AND (@lease_owner = '' OR (tr.lease_owner = @lease_owner AND tr.lease_expires_at >= @now_utc))
+-- moving runs before ones yet to start, then premium trains first, so a cycle that
+-- cannot fit every run leaves out pre-departure checks and then the local ones. The
+-- first cycle after a restart puts moving runs not heard from since catch_up_before
+-- (UTC) ahead of the rest, an empty value orders them as usual.
+ORDER BY tr.has_started DESC,
+    CASE
+        WHEN @catch_up_before = '' THEN 0
+        WHEN tr.last_update_timestamp_ISO IS NULL
+          OR datetime(tr.last_update_timestamp_ISO) < datetime(@catch_up_before) THEN 0
+        ELSE 1
+    END,
+    priority,
+    tr.last_update_timestamp_ISO ASC NULLS FIRST;
+
+-- name: RenewRunLeases :execrows
+-- Heartbeat: extends the leases lease_owner holds on runs ListRunsToPoll would still
+-- pick, backed off runs only while they come due before expires_at (UTC)
+UPDATE train_runs
+SET lease_expires_at = @expires_at
+WHERE lease_owner = @lease_owner
+  AND lease_expires_at >= @now_utc
+  AND run_id IN (
+    SELECT tr.run_id
+    FROM train_runs tr
+    WHERE tr.lease_owner = @lease_owner
+      AND tr.has_arrived = 0
+      AND date(tr.run_date) >= date(@now_ts, '-5 days')
+      AND COALESCE(json_extract(tr.errors, '$.static_response.count'), 0)
+            < CAST(@static_response_threshold AS INTEGER)
+      AND NOT EXISTS (
+            SELECT 1
+            FROM train_aliases ta
+            JOIN train_runs ar
+                ON ar.train_no = ta.alias_train_no
+                AND ar.run_date = tr.run_date
+            WHERE ta.train_no = tr.train_no
+              AND datetime(ar.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+          )
+      AND (tr.next_poll_at IS NULL OR tr.next_poll_at <= @expires_at)
+  );
+
+-- name: ReleaseUnrenewedRunLeases :execrows
+-- Hands back the leases of lease_owner the last RenewRunLeases did not extend to
+-- expires_at, so runs it will not poll stop counting towards its share
+UPDATE train_runs
+SET lease_owner = NULL,
+    lease_expires_at = NULL
+WHERE lease_owner = @lease_owner
+  AND lease_expires_at < @expires_at;
+
+-- name: ClaimRuns :execrows
+-- Leases runs ListRunsToPoll would pick that nobody holds, or whose lease ran out, to
+-- lease_owner until expires_at (UTC), topping its share up to max_runs in the order
+-- ListRunsToPoll polls them. Backed off runs are left to whoever holds them when they
+-- come due. One statement, so instances claiming at the same time never get the same
+-- run.
+UPDATE train_runs
+SET lease_owner = @lease_owner,
+    lease_expires_at = @expires_at
+WHERE run_id IN (
+    SELECT tr.run_id
+    FROM train_runs tr
+    JOIN train_schedules ts
+        ON tr.schedule_id = ts.schedule_id
+    JOIN trains t
+        ON t.train_no = tr.train_no
+    WHERE tr.has_arrived = 0
+      AND date(tr.run_date) <= date(@now_ts)
+      AND date(tr.run_date) >= date(@now_ts, '-5 days')
+      AND COALESCE(json_extract(tr.errors, '$.static_response.count'), 0)
+            < CAST(@static_response_threshold AS INTEGER)
+      AND datetime(
+            tr.run_date,
+            '+' || COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) || ' minutes'
+          ) <= datetime(@now_ts)
+      AND NOT EXISTS (
+            SELECT 1
+            FROM train_aliases ta
+            JOIN train_runs ar
+                ON ar.train_no = ta.alias_train_no
+                AND ar.run_date = tr.run_date
+            WHERE ta.train_no = tr.train_no
+              AND datetime(ar.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+          )
+      AND (tr.next_poll_at IS NULL OR tr.next_poll_at <= @expires_at)
+      AND (
+            tr.lease_owner IS NULL
+            OR tr.lease_expires_at IS NULL
+            OR tr.lease_expires_at < @now_utc
+          )
+    ORDER BY tr.has_started DESC,
+        t.priority,
+        tr.last_update_timestamp_ISO ASC NULLS FIRST
+    LIMIT MAX(
+        CAST(@max_runs AS INTEGER) - (
+            SELECT COUNT(*)
+            FROM train_runs o
+            WHERE o.lease_owner = @lease_owner
+              AND o.has_arrived = 0
+              AND o.lease_expires_at >= @now_utc
+        ),
+        0
+    )
+);
+
+-- name: ReleaseRunLeases :execrows
+-- Hands lease_owner's runs back, for other instances to claim straight away
+UPDATE train_runs
+SET lease_owner = NULL,
+    lease_expires_at = NULL
+WHERE lease_owner = @lease_owner;
+
+-- name: GetRunToPoll :one
+-- Same shape as ListRunsToPoll for a single run without gating, used by replay
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    tr.last_known_lat_u6,
+    tr.last_known_lng_u6,
+    tr.last_updated_sno,
+    tr.last_update_timestamp_ISO,
+    COALESCE(tr.errors, '{}') AS errors,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.has_started,
+    ts.schedule_id,
+    ts.origin_station_code AS source_station,
+    ts.terminus_station_code AS destination_station,
+    COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) AS origin_sch_departure_min,
+    CAST(t.priority AS INTEGER) AS priority,
+    t.train_type
+FROM train_runs tr
+JOIN train_schedules ts
+    ON tr.schedule_id = ts.schedule_id
+JOIN trains t
+    ON t.train_no = tr.train_no
+WHERE tr.run_id = @run_id;
+
+-- name: ListRunsToBackfill :many
+-- Runs in [from_date, to_date] that never recorded a station, skipping runs upstream said were not running
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    tr.last_known_lat_u6,
+    tr.last_known_lng_u6,
+    tr.last_updated_sno,
+    tr.last_update_timestamp_ISO,
+    COALESCE(tr.errors, '{}') AS errors,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.has_started,
+    ts.schedule_id,
+    ts.origin_station_code AS source_station,
+    ts.terminus_station_code AS destination_station,
+    COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) AS origin_sch_departure_min,
+    CAST(t.priority AS INTEGER) AS priority,
+    t.train_type
+FROM train_runs tr
+JOIN train_schedules ts
+    ON tr.schedule_id = ts.schedule_id
+JOIN trains t
+    ON t.train_no = tr.train_no
+WHERE tr.run_date BETWEEN @from_date AND @to_date
+  AND tr.current_status NOT IN ('not_running_today', 'cancelled')
+  AND NOT EXISTS (
+      SELECT 1
+      FROM train_run_station_events e
+      WHERE e.run_id = tr.run_id
+  )
+ORDER BY tr.run_date, tr.train_no;
 
 -- name: GetRunSnap :one
--- Snap raw GPS to route and compute linear reference bearing
+-- Snap raw GPS to route and compute linear reference bearing, offset_m is how far the
+-- raw fix is from the route
 WITH snapped AS (
   SELECT
     ST_ClosestPoint(
       trg.route_geom,
       ST_Transform(MakePoint(@lng, @lat, 4326), 7755)
     ) AS snappt,
+    ST_Distance(
+      trg.route_geom,
+      ST_Transform(MakePoint(@lng, @lat, 4326), 7755)
+    ) AS offset_m,
     trg.route_geom
   FROM train_runs tr
   JOIN train_route_geometries trg
@@ -53,6 +246,7 @@ WITH snapped AS (
 fraccalc AS (
   SELECT
     snappt,
+    offset_m,
     route_geom,
     Line_Locate_Point(route_geom, snappt) AS frac
   FROM snapped
@@ -60,6 +254,7 @@ fraccalc AS (
 bearingcalc AS (
   SELECT
     snappt,
+    offset_m,
     route_geom,
     frac,
     CASE
@@ -80,29 +275,59 @@ SELECT
   CAST(X(ST_Transform(snappt, 4326)) * 1000000 AS INTEGER) AS snapped_lng_u6,
   CAST(Y(ST_Transform(snappt, 4326)) * 1000000 AS INTEGER) AS snapped_lat_u6,
   CAST(frac * 10000 AS INTEGER) AS route_frac_u4,
-  CAST(ROUND(Degrees(bearing_rad)) % 360 AS INTEGER) AS bearing_deg
+  CAST(ROUND(Degrees(bearing_rad)) % 360 AS INTEGER) AS bearing_deg,
+  CAST(offset_m AS INTEGER) AS offset_m
 FROM bearingcalc;
 
 -- name: UpdateRunStatus :exec
 -- Partial, idempotent update of run state
 UPDATE train_runs
 SET
-    has_started = COALESCE(@has_started, has_started),
-    has_arrived = COALESCE(@has_arrived, has_arrived),
+    has_started = COALESCE(sqlc.narg(has_started), has_started),
+    has_arrived = COALESCE(sqlc.narg(has_arrived), has_arrived),
     current_status = COALESCE(@current_status, current_status),
     last_known_lat_u6 = COALESCE(@lat_u6, last_known_lat_u6),
     last_known_lng_u6 = COALESCE(@lng_u6, last_known_lng_u6),
     last_known_snapped_lat_u6 = COALESCE(@snapped_lat_u6, last_known_snapped_lat_u6),
     last_known_snapped_lng_u6 = COALESCE(@snapped_lng_u6, last_known_snapped_lng_u6),
-    last_route_frac_u4 = COALESCE(@route_frac_u4, last_route_frac_u4),
+    -- the route position of a diverted run means nothing until it is back on its route
+    last_route_frac_u4 = CASE
+        WHEN @current_status = 'diverted' THEN NULL
+        ELSE COALESCE(@route_frac_u4, last_route_frac_u4)
+    END,
     last_bearing_deg = COALESCE(@bearing_deg, last_bearing_deg),
+    -- a new snapped fix replaces any dead reckoned position
+    extrapolated_lat_u6 = CASE WHEN @snapped_lat_u6 IS NULL THEN extrapolated_lat_u6 END,
+    extrapolated_lng_u6 = CASE WHEN @snapped_lat_u6 IS NULL THEN extrapolated_lng_u6 END,
+    extrapolated_at = CASE WHEN @snapped_lat_u6 IS NULL THEN extrapolated_at END,
+    -- speeds belong to the fix they were worked out for
+    speed_kmh = CASE WHEN @snapped_lat_u6 IS NULL THEN speed_kmh ELSE @speed_kmh END,
+    avg_speed_kmh = CASE WHEN @snapped_lat_u6 IS NULL THEN avg_speed_kmh ELSE @avg_speed_kmh END,
     last_known_distance_km_u4 = COALESCE(@distance_km_u4, last_known_distance_km_u4),
+    current_delay_min = COALESCE(@current_delay_min, current_delay_min),
     errors = COALESCE(@errors, errors),
     last_updated_sno = COALESCE(@last_updated_sno, last_updated_sno),
     last_update_timestamp_ISO = COALESCE(@last_update_iso, last_update_timestamp_ISO),
     updated_at = CURRENT_TIMESTAMP
 WHERE run_id = @run_id;
 
+-- name: SetRunRevisedDeparture :exec
+-- Records the origin departure upstream rescheduled the run to, in minutes after
+-- midnight of run_date
+UPDATE train_runs
+SET revised_departure_min = @revised_departure_min,
+    updated_at = CURRENT_TIMESTAMP
+WHERE run_id = @run_id
+  AND revised_departure_min IS NOT @revised_departure_min;
+
+-- name: ScheduleRunPoll :exec
+-- Sets when the poller next looks at a run, NULL for every cycle. Leaves updated_at
+-- alone, nothing a client sees changed.
+UPDATE train_runs
+SET next_poll_at = @next_poll_at
+WHERE run_id = @run_id
+  AND next_poll_at IS NOT @next_poll_at;
+
 -- name: LogRunLocation :exec
 INSERT INTO train_run_locations (
     run_id,
@@ -113,6 +338,11 @@ INSERT INTO train_run_locations (
     distance_km_u4,
     segment_station_code,
     at_station,
+    offset_m,
+    speed_kmh,
+    avg_speed_kmh,
+    smoothed_lat_u6,
+    smoothed_lng_u6,
     timestamp_ISO
 ) VALUES (
     @run_id,
@@ -123,10 +353,37 @@ INSERT INTO train_run_locations (
     @distance_km_u4,
     @segment_station_code,
     @at_station,
+    @offset_m,
+    @speed_kmh,
+    @avg_speed_kmh,
+    @smoothed_lat_u6,
+    @smoothed_lng_u6,
     @timestamp_iso
 )
 ON CONFLICT(run_id, timestamp_ISO) DO NOTHING;
 
+-- name: ListRecentRunFixes :many
+-- The run's last fixes, newest first, smoothed positions fall back to the raw ones
+SELECT
+    lat_u6,
+    lng_u6,
+    COALESCE(smoothed_lat_u6, lat_u6) AS smoothed_lat_u6,
+    COALESCE(smoothed_lng_u6, lng_u6) AS smoothed_lng_u6,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = @run_id
+ORDER BY timestamp_ISO DESC
+LIMIT @limit;
+
+-- name: ListRecentRunOffsets :many
+-- Distances from the route of the run's last snapped fixes, newest first
+SELECT CAST(offset_m AS INTEGER) AS offset_m
+FROM train_run_locations
+WHERE run_id = @run_id
+  AND offset_m IS NOT NULL
+ORDER BY timestamp_ISO DESC
+LIMIT @limit;
+
 -- name: ClearRunningDayBitForDate :exec
 UPDATE train_schedules
 SET
@@ -139,3 +396,587 @@ WHERE schedule_id = @schedule_id
         running_days_bitmap &
         (1 << CAST(strftime('%w', @run_date) AS INTEGER))
       ) <> 0;
+
+-- name: UpsertRunStationEvent :execrows
+-- Records actuals for a station the run has reached; known values are never cleared.
+-- Upstream corrections replace what was stored, a station that reports nothing new is
+-- left alone and counts no row.
+INSERT INTO train_run_station_events (
+    run_id,
+    sno,
+    station_code,
+    distance_km_u4,
+    sch_arrival_tm,
+    act_arrival_tm,
+    sch_departure_tm,
+    act_departure_tm,
+    delay_arrival_min,
+    delay_departure_min,
+    departed
+) VALUES (
+    @run_id,
+    @sno,
+    @station_code,
+    @distance_km_u4,
+    @sch_arrival_tm,
+    @act_arrival_tm,
+    @sch_departure_tm,
+    @act_departure_tm,
+    @delay_arrival_min,
+    @delay_departure_min,
+    @departed
+)
+ON CONFLICT(run_id, station_code) DO UPDATE SET
+    sno = excluded.sno,
+    sch_arrival_tm = COALESCE(excluded.sch_arrival_tm, sch_arrival_tm),
+    act_arrival_tm = COALESCE(excluded.act_arrival_tm, act_arrival_tm),
+    sch_departure_tm = COALESCE(excluded.sch_departure_tm, sch_departure_tm),
+    act_departure_tm = COALESCE(excluded.act_departure_tm, act_departure_tm),
+    delay_arrival_min = COALESCE(excluded.delay_arrival_min, delay_arrival_min),
+    delay_departure_min = COALESCE(excluded.delay_departure_min, delay_departure_min),
+    departed = MAX(excluded.departed, departed),
+    updated_at = CURRENT_TIMESTAMP
+WHERE excluded.sno IS NOT sno
+   OR COALESCE(excluded.sch_arrival_tm, sch_arrival_tm) IS NOT sch_arrival_tm
+   OR COALESCE(excluded.act_arrival_tm, act_arrival_tm) IS NOT act_arrival_tm
+   OR COALESCE(excluded.sch_departure_tm, sch_departure_tm) IS NOT sch_departure_tm
+   OR COALESCE(excluded.act_departure_tm, act_departure_tm) IS NOT act_departure_tm
+   OR COALESCE(excluded.delay_arrival_min, delay_arrival_min) IS NOT delay_arrival_min
+   OR COALESCE(excluded.delay_departure_min, delay_departure_min) IS NOT delay_departure_min
+   OR excluded.departed > departed;
+
+-- name: UpsertRunPlatforms :exec
+-- Records the platforms of a run from a JSON array of {station_code, platform,
+-- platform_info} in one statement; known values are never cleared and unchanged rows
+-- are left alone
+INSERT INTO train_run_platforms (
+    run_id,
+    station_code,
+    platform,
+    platform_info
+)
+SELECT
+    @run_id,
+    json_extract(p.value, '$.station_code'),
+    json_extract(p.value, '$.platform'),
+    json_extract(p.value, '$.platform_info')
+FROM json_each(@platforms) p
+WHERE true
+ON CONFLICT(run_id, station_code) DO UPDATE SET
+    platform = COALESCE(excluded.platform, platform),
+    platform_info = COALESCE(excluded.platform_info, platform_info),
+    updated_at = CURRENT_TIMESTAMP
+WHERE COALESCE(excluded.platform, platform) IS NOT platform
+   OR COALESCE(excluded.platform_info, platform_info) IS NOT platform_info;
+
+-- name: SetStationCoordinates :exec
+-- Fills in station coordinates from live status data where the timetable source had none
+UPDATE stations
+SET
+    lat = @lat,
+    lng = @lng,
+    updated_at = CURRENT_TIMESTAMP
+WHERE station_code = @station_code
+  AND (lat IS NULL OR lng IS NULL);
+
+-- name: ListStalledRuns :many
+-- Returns running, still reporting runs that first reached their current distance before stalled_before (UTC)
+SELECT
+    tr.run_id,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    (
+        SELECT l2.segment_station_code
+        FROM train_run_locations l2
+        WHERE l2.run_id = tr.run_id
+        ORDER BY l2.timestamp_ISO DESC
+        LIMIT 1
+    ) AS station_code,
+    CAST(MIN(l.timestamp_ISO) AS TEXT) AS stalled_since
+FROM train_runs tr
+JOIN train_run_locations l ON l.run_id = tr.run_id
+WHERE tr.has_started = 1
+  AND tr.has_arrived = 0
+  AND tr.last_known_distance_km_u4 IS NOT NULL
+  AND datetime(tr.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+  AND l.distance_km_u4 >= tr.last_known_distance_km_u4 - @tolerance_u4
+GROUP BY tr.run_id
+HAVING datetime(MIN(l.timestamp_ISO)) <= datetime(@stalled_before);
+
+-- name: OpenRunAnomaly :execrows
+-- Records a new anomaly episode unless one of the same kind is already open for the run
+INSERT INTO run_anomalies (
+    run_id,
+    kind,
+    station_code,
+    distance_km_u4,
+    since_ts
+) VALUES (
+    @run_id,
+    @kind,
+    @station_code,
+    @distance_km_u4,
+    @since_ts
+)
+ON CONFLICT(run_id, kind) WHERE resolved_at IS NULL DO NOTHING;
+
+-- name: ResolveRunAnomaly :execrows
+-- Closes the run's open episode of kind, if any
+UPDATE run_anomalies
+SET resolved_at = CURRENT_TIMESTAMP
+WHERE run_id = @run_id
+  AND kind = @kind
+  AND resolved_at IS NULL;
+
+-- name: ResolveStalledAnomalies :execrows
+-- Closes stalled episodes whose run has moved on or arrived
+UPDATE run_anomalies
+SET resolved_at = CURRENT_TIMESTAMP
+WHERE kind = 'stalled'
+  AND resolved_at IS NULL
+  AND EXISTS (
+      SELECT 1
+      FROM train_runs tr
+      WHERE tr.run_id = run_anomalies.run_id
+        AND (
+            tr.has_arrived = 1
+            OR tr.last_known_distance_km_u4 > run_anomalies.distance_km_u4 + @tolerance_u4
+        )
+  );
+
+-- name: CloseNeverStartedRuns :execrows
+-- Gives up on runs upstream never reported on once their scheduled arrival, from a
+-- rescheduled departure where there is one, is before arrived_before (local time)
+UPDATE train_runs
+SET has_arrived = 1,
+    current_status = 'no_data',
+    next_poll_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE has_arrived = 0
+  AND has_started = 0
+  AND last_update_timestamp_ISO IS NULL
+  AND EXISTS (
+      SELECT 1
+      FROM train_schedules ts
+      WHERE ts.schedule_id = train_runs.schedule_id
+        AND datetime(
+              train_runs.run_date,
+              '+' || (
+                  COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min)
+                  + ts.total_runtime_min
+              ) || ' minutes'
+            ) < datetime(@arrived_before)
+  );
+
+-- name: CloseOverdueRuns :execrows
+-- Closes running runs whose scheduled arrival, pushed back by their last known delay
+-- or a rescheduled departure, is before arrived_before (local time) and that have been silent since quiet_before (UTC)
+UPDATE train_runs
+SET has_arrived = 1,
+    current_status = 'timed_out',
+    next_poll_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE has_arrived = 0
+  AND has_started = 1
+  AND (
+        last_update_timestamp_ISO IS NULL
+        OR datetime(last_update_timestamp_ISO) < datetime(@quiet_before)
+      )
+  AND EXISTS (
+      SELECT 1
+      FROM train_schedules ts
+      WHERE ts.schedule_id = train_runs.schedule_id
+        AND datetime(
+              train_runs.run_date,
+              '+' || (
+                  MAX(
+                      COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min),
+                      ts.origin_sch_departure_min + MAX(COALESCE(train_runs.current_delay_min, 0), 0)
+                  ) + ts.total_runtime_min
+              ) || ' minutes'
+            ) < datetime(@arrived_before)
+  );
+
+-- name: CloseRunsFinishedOffline :execrows
+-- Closes running runs whose scheduled arrival, pushed back by their last known delay
+-- or a rescheduled departure, is before arrived_before (local time) and that were last heard from before that
+-- arrival. Run at startup for runs that finished while nothing polled them;
+-- tz_offset_sec turns the local arrival into UTC to compare with the last update.
+UPDATE train_runs
+SET has_arrived = 1,
+    current_status = 'timed_out',
+    next_poll_at = NULL,
+    extrapolated_lat_u6 = NULL,
+    extrapolated_lng_u6 = NULL,
+    extrapolated_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE has_arrived = 0
+  AND has_started = 1
+  AND EXISTS (
+      SELECT 1
+      FROM train_schedules ts
+      WHERE ts.schedule_id = train_runs.schedule_id
+        AND datetime(
+              train_runs.run_date,
+              '+' || (
+                  MAX(
+                      COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min),
+                      ts.origin_sch_departure_min + MAX(COALESCE(train_runs.current_delay_min, 0), 0)
+                  ) + ts.total_runtime_min
+              ) || ' minutes'
+            ) < datetime(@arrived_before)
+        AND (
+              train_runs.last_update_timestamp_ISO IS NULL
+              OR datetime(train_runs.last_update_timestamp_ISO) < datetime(
+                  train_runs.run_date,
+                  '+' || (
+                      MAX(
+                          COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min),
+                          ts.origin_sch_departure_min + MAX(COALESCE(train_runs.current_delay_min, 0), 0)
+                      ) + ts.total_runtime_min
+                  ) || ' minutes',
+                  (-CAST(@tz_offset_sec AS INTEGER)) || ' seconds'
+                )
+            )
+  );
+
+-- name: ResetStaleRuns :execrows
+-- Makes running runs not heard from since stale_before (UTC) due straight away and
+-- drops their dead reckoned position, which would be extrapolated from a fix long gone
+UPDATE train_runs
+SET next_poll_at = NULL,
+    extrapolated_lat_u6 = NULL,
+    extrapolated_lng_u6 = NULL,
+    extrapolated_at = NULL
+WHERE has_arrived = 0
+  AND has_started = 1
+  AND (
+        last_update_timestamp_ISO IS NULL
+        OR datetime(last_update_timestamp_ISO) < datetime(@stale_before)
+      );
+
+-- name: ExtrapolateRunPositions :execrows
+-- Dead reckoning for running runs whose last fix is older than quiet_before and newer
+-- than fix_after (both UTC): the train is moved along its route geometry by the time
+-- since that fix at the speed it made since the fix before, at most max_speed_kmh.
+-- Runs last seen standing at a station, or not making progress, stay where they are.
+WITH quiet AS (
+  SELECT
+    tr.run_id,
+    tr.schedule_id,
+    tr.last_route_frac_u4,
+    tr.last_update_timestamp_ISO,
+    (
+      SELECT l.id
+      FROM train_run_locations l
+      WHERE l.run_id = tr.run_id
+      ORDER BY l.timestamp_ISO DESC
+      LIMIT 1
+    ) AS fix_id
+  FROM train_runs tr
+  WHERE tr.has_started = 1
+    AND tr.has_arrived = 0
+    AND tr.last_route_frac_u4 IS NOT NULL
+    AND datetime(tr.last_update_timestamp_ISO) < datetime(@quiet_before)
+    AND datetime(tr.last_update_timestamp_ISO) > datetime(@fix_after)
+),
+moving AS (
+  SELECT
+    q.run_id,
+    q.schedule_id,
+    q.last_route_frac_u4,
+    q.last_update_timestamp_ISO,
+    MIN(
+      (l.distance_km_u4 - p.distance_km_u4) / 10000.0
+        / ((julianday(l.timestamp_ISO) - julianday(p.timestamp_ISO)) * 24),
+      @max_speed_kmh
+    ) AS speed_kmh
+  FROM quiet q
+  JOIN train_run_locations l ON l.id = q.fix_id
+  JOIN train_run_locations p ON p.id = (
+      SELECT p2.id
+      FROM train_run_locations p2
+      WHERE p2.run_id = q.run_id
+        AND p2.timestamp_ISO < l.timestamp_ISO
+      ORDER BY p2.timestamp_ISO DESC
+      LIMIT 1
+  )
+  WHERE l.at_station = 0
+    AND l.distance_km_u4 > p.distance_km_u4
+    -- fixes half an hour apart say little about the current speed
+    AND julianday(l.timestamp_ISO) - julianday(p.timestamp_ISO) <= 30.0 / 1440
+),
+projected AS (
+  SELECT
+    m.run_id,
+    ST_Transform(
+      ST_Line_Interpolate_Point(
+        trg.route_geom,
+        MIN(
+          1.0,
+          m.last_route_frac_u4 / 10000.0
+            + m.speed_kmh * (julianday('now') - julianday(m.last_update_timestamp_ISO)) * 24 * 1000
+              / ST_Length(trg.route_geom)
+        )
+      ),
+      4326
+    ) AS pt
+  FROM moving m
+  JOIN train_route_geometries trg
+    ON trg.schedule_id = m.schedule_id
+  WHERE ST_IsValid(trg.route_geom) = 1
+    AND ST_Length(trg.route_geom) > 0
+)
+UPDATE train_runs
+SET extrapolated_lat_u6 = CAST(Y(p.pt) * 1000000 AS INTEGER),
+    extrapolated_lng_u6 = CAST(X(p.pt) * 1000000 AS INTEGER),
+    extrapolated_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+FROM projected p
+WHERE train_runs.run_id = p.run_id;
+
+-- name: RecordRunPoll :exec
+-- Counts one poll attempt for the run
+INSERT INTO run_poll_stats (
+    run_id,
+    polls,
+    successful_polls,
+    window_sec,
+    first_poll_at,
+    last_poll_at
+) VALUES (
+    @run_id,
+    1,
+    @successful,
+    @window_sec,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT(run_id) DO UPDATE SET
+    polls = polls + 1,
+    successful_polls = successful_polls + excluded.successful_polls,
+    window_sec = excluded.window_sec,
+    last_poll_at = CURRENT_TIMESTAMP;
+
+-- name: GetScheduleByEndpoints :one
+-- Resolves the schedule a live status request refers to, used by the simulator
+SELECT
+    schedule_id,
+    origin_sch_departure_min,
+    total_distance_km
+FROM train_schedules
+WHERE train_no = @train_no
+  AND origin_station_code = @origin_station_code
+  AND terminus_station_code = @terminus_station_code
+ORDER BY updated_at DESC
+LIMIT 1;
+
+-- name: GetUpstreamBudget :one
+SELECT
+    tokens,
+    saved_at,
+    blocked_until,
+    last_blocked_at,
+    blocks
+FROM upstream_budgets
+WHERE name = @name;
+
+-- name: SaveUpstreamBudget :exec
+INSERT INTO upstream_budgets (
+    name,
+    tokens,
+    saved_at,
+    blocked_until,
+    last_blocked_at,
+    blocks
+) VALUES (
+    @name,
+    @tokens,
+    @saved_at,
+    @blocked_until,
+    @last_blocked_at,
+    @blocks
+)
+ON CONFLICT(name) DO UPDATE SET
+    tokens = excluded.tokens,
+    saved_at = excluded.saved_at,
+    blocked_until = excluded.blocked_until,
+    last_blocked_at = excluded.last_blocked_at,
+    blocks = excluded.blocks,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: ArchiveFailedResponse :exec
+INSERT INTO upstream_failed_responses (
+    run_id,
+    kind,
+    error,
+    body_gzip,
+    body_bytes
+) VALUES (
+    @run_id,
+    @kind,
+    @error,
+    @body_gzip,
+    @body_bytes
+);
+
+-- name: PruneFailedResponses :execrows
+DELETE FROM upstream_failed_responses
+WHERE created_at < @before;
+
+-- name: UpsertRunDaySchedule :exec
+-- Keeps the run's latest days_schedule, replacing the one before
+INSERT INTO upstream_day_schedules (
+    run_id,
+    body_gzip,
+    body_bytes,
+    stations
+) VALUES (
+    @run_id,
+    @body_gzip,
+    @body_bytes,
+    @stations
+)
+ON CONFLICT(run_id) DO UPDATE SET
+    body_gzip = excluded.body_gzip,
+    body_bytes = excluded.body_bytes,
+    stations = excluded.stations,
+    polled_at = CURRENT_TIMESTAMP;
+
+-- name: GetRunDaySchedule :one
+SELECT body_gzip, stations, polled_at
+FROM upstream_day_schedules
+WHERE run_id = @run_id;
+
+-- name: PruneRunDaySchedules :execrows
+DELETE FROM upstream_day_schedules
+WHERE polled_at < @before;
+
+-- name: ListAliasRunsToMerge :many
+-- Alias runs holding data that belongs to the canonical run of the same date
+SELECT
+    ar.run_id AS alias_run_id,
+    cr.run_id AS canonical_run_id
+FROM train_aliases ta
+JOIN train_runs ar
+    ON ar.train_no = ta.alias_train_no
+JOIN train_runs cr
+    ON cr.train_no = ta.train_no
+    AND cr.run_date = ar.run_date
+WHERE date(ar.run_date) >= date('now', '-5 days')
+  AND (
+        EXISTS (SELECT 1 FROM train_run_locations l WHERE l.run_id = ar.run_id)
+        OR EXISTS (SELECT 1 FROM train_run_station_events e WHERE e.run_id = ar.run_id)
+        OR (
+            ar.last_update_timestamp_ISO IS NOT NULL
+            AND (
+                cr.last_update_timestamp_ISO IS NULL
+                OR datetime(ar.last_update_timestamp_ISO) > datetime(cr.last_update_timestamp_ISO)
+            )
+        )
+      );
+
+-- name: CopyRunLocations :exec
+INSERT OR IGNORE INTO train_run_locations (
+    run_id,
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+)
+SELECT
+    @canonical_run_id,
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = @alias_run_id;
+
+-- name: DeleteRunLocations :exec
+DELETE FROM train_run_locations
+WHERE run_id = @run_id;
+
+-- name: CopyRunStationEvents :exec
+-- The more recently updated event wins where both runs passed a station
+INSERT INTO train_run_station_events (
+    run_id,
+    sno,
+    station_code,
+    distance_km_u4,
+    sch_arrival_tm,
+    act_arrival_tm,
+    sch_departure_tm,
+    act_departure_tm,
+    delay_arrival_min,
+    delay_departure_min,
+    departed,
+    created_at,
+    updated_at
+)
+SELECT
+    @canonical_run_id,
+    sno,
+    station_code,
+    distance_km_u4,
+    sch_arrival_tm,
+    act_arrival_tm,
+    sch_departure_tm,
+    act_departure_tm,
+    delay_arrival_min,
+    delay_departure_min,
+    departed,
+    created_at,
+    updated_at
+FROM train_run_station_events
+WHERE run_id = @alias_run_id
+ON CONFLICT(run_id, station_code) DO UPDATE SET
+    sno = excluded.sno,
+    distance_km_u4 = excluded.distance_km_u4,
+    sch_arrival_tm = excluded.sch_arrival_tm,
+    act_arrival_tm = excluded.act_arrival_tm,
+    sch_departure_tm = excluded.sch_departure_tm,
+    act_departure_tm = excluded.act_departure_tm,
+    delay_arrival_min = excluded.delay_arrival_min,
+    delay_departure_min = excluded.delay_departure_min,
+    departed = excluded.departed,
+    updated_at = excluded.updated_at
+WHERE excluded.updated_at > train_run_station_events.updated_at;
+
+-- name: DeleteRunStationEvents :exec
+DELETE FROM train_run_station_events
+WHERE run_id = @run_id;
+
+-- name: MergeRunStatus :exec
+-- Takes the alias run's live state when it is newer, a not_running_today the canonical
+-- number got after the renumbering is overwritten this way
+UPDATE train_runs
+SET
+    has_started = ar.has_started,
+    has_arrived = ar.has_arrived,
+    current_status = ar.current_status,
+    last_known_lat_u6 = ar.last_known_lat_u6,
+    last_known_lng_u6 = ar.last_known_lng_u6,
+    last_known_snapped_lat_u6 = ar.last_known_snapped_lat_u6,
+    last_known_snapped_lng_u6 = ar.last_known_snapped_lng_u6,
+    last_route_frac_u4 = ar.last_route_frac_u4,
+    last_bearing_deg = ar.last_bearing_deg,
+    last_known_distance_km_u4 = ar.last_known_distance_km_u4,
+    last_updated_sno = ar.last_updated_sno,
+    last_update_timestamp_ISO = ar.last_update_timestamp_ISO,
+    updated_at = CURRENT_TIMESTAMP
+FROM train_runs ar
+WHERE train_runs.run_id = @canonical_run_id
+  AND ar.run_id = @alias_run_id
+  AND ar.last_update_timestamp_ISO IS NOT NULL
+  AND (
+        train_runs.last_update_timestamp_ISO IS NULL
+        OR datetime(ar.last_update_timestamp_ISO) > datetime(train_runs.last_update_timestamp_ISO)
+      );
@@ -0,0 +1,94 @@
+-- name: AddDeviceSubscription :exec
+-- Starts from the run as it is now, so the device is only told about later changes
+INSERT INTO device_subscriptions (
+    token,
+    train_no,
+    run_date,
+    notified_status,
+    notified_delay_min
+) VALUES (
+    @token,
+    @train_no,
+    @run_date,
+    (SELECT current_status FROM train_runs WHERE train_no = @train_no AND run_date = @run_date),
+    (SELECT current_delay_min FROM train_runs WHERE train_no = @train_no AND run_date = @run_date)
+)
+ON CONFLICT (token, train_no, run_date) DO NOTHING;
+
+-- name: CountDeviceSubscriptions :one
+SELECT COUNT(*)
+FROM device_subscriptions
+WHERE token = @token;
+
+-- name: DeleteDeviceSubscription :execrows
+DELETE FROM device_subscriptions
+WHERE token = @token
+  AND train_no = @train_no
+  AND run_date = @run_date;
+
+-- name: DeleteDeviceToken :execrows
+-- Drops every subscription of a token FCM no longer accepts
+DELETE FROM device_subscriptions
+WHERE token = @token;
+
+-- name: QueuePushChange :exec
+-- Marks a run for the push worker when a device follows it, a run already queued gets
+-- the later time so the worker cannot clear a change it has not seen
+INSERT INTO push_pending (run_id)
+SELECT tr.run_id
+FROM train_runs tr
+WHERE tr.run_id = @run_id
+  AND EXISTS (
+      SELECT 1
+      FROM device_subscriptions ds
+      WHERE ds.train_no = tr.train_no
+        AND ds.run_date = tr.run_date
+  )
+ON CONFLICT (run_id) DO UPDATE SET queued_at = CURRENT_TIMESTAMP;
+
+-- name: ListPushTargets :many
+-- Subscriptions of queued runs whose status changed or whose delay moved by at least
+-- delay_threshold_min since their last push, grouped by run
+SELECT
+    ds.id,
+    ds.token,
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    tr.run_date,
+    tr.current_status,
+    tr.current_delay_min,
+    ds.notified_status,
+    ds.notified_delay_min
+FROM push_pending p
+JOIN train_runs tr ON tr.run_id = p.run_id
+JOIN trains t ON t.train_no = tr.train_no
+JOIN device_subscriptions ds
+    ON ds.train_no = tr.train_no
+    AND ds.run_date = tr.run_date
+WHERE COALESCE(ds.notified_status, 'unknown') <> tr.current_status
+   OR abs(COALESCE(tr.current_delay_min, 0) - COALESCE(ds.notified_delay_min, 0)) >= @delay_threshold_min
+ORDER BY p.queued_at, tr.run_id, ds.id
+LIMIT @limit;
+
+-- name: ListPushPending :many
+SELECT run_id
+FROM push_pending
+WHERE queued_at < @before;
+
+-- name: MarkDeviceNotified :exec
+UPDATE device_subscriptions
+SET notified_status = @notified_status,
+    notified_delay_min = @notified_delay_min
+WHERE id = @id;
+
+-- name: ClearPushPending :exec
+-- Only clears the run if it was queued before the worker listed its targets
+DELETE FROM push_pending
+WHERE run_id = @run_id
+  AND queued_at < @before;
+
+-- name: PruneDeviceSubscriptions :execrows
+-- Runs are followed for the day of travel and a little after, older subscriptions go
+DELETE FROM device_subscriptions
+WHERE run_date < @before_date;
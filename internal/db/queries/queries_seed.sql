@@ -65,14 +65,46 @@ ON CONFLICT(station_code) DO UPDATE SET
     division = excluded.division,
     address = excluded.address,
     elevation_m = excluded.elevation_m,
-    lat = excluded.lat,
-    lng = excluded.lng,
+    -- IRI has no coordinates, keep the ones learned from live status
+    lat = COALESCE(excluded.lat, lat),
+    lng = COALESCE(excluded.lng, lng),
     number_of_platforms = excluded.number_of_platforms,
     station_type = excluded.station_type,
     station_category = excluded.station_category,
     track_type = excluded.track_type,
     updated_at = CURRENT_TIMESTAMP;
 
+-- name: UpsertTrainLink :exec
+INSERT INTO train_links (
+    train_no,
+    linked_train_no,
+    kind,
+    from_station_code,
+    to_station_code
+) VALUES (
+    @train_no,
+    @linked_train_no,
+    @kind,
+    @from_station_code,
+    @to_station_code
+)
+ON CONFLICT(train_no, linked_train_no) DO UPDATE SET
+    kind = excluded.kind,
+    from_station_code = excluded.from_station_code,
+    to_station_code = excluded.to_station_code,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: UpsertTrainAlias :exec
+INSERT INTO train_aliases (
+    alias_train_no,
+    train_no
+) VALUES (
+    @alias_train_no,
+    @train_no
+)
+ON CONFLICT(alias_train_no) DO UPDATE SET
+    train_no = excluded.train_no;
+
 -- name: UpsertTrainSchedule :one
 INSERT INTO train_schedules (
     train_no,
@@ -167,3 +199,70 @@ JOIN trains t
     ON ts.train_no = t.train_no
 WHERE (ts.running_days_bitmap & (1 << @weekday)) <> 0
 ON CONFLICT (train_no, run_date) DO NOTHING;
+
+-- name: DeleteTrainCoaches :exec
+DELETE FROM train_coaches
+WHERE train_no = @train_no;
+
+-- name: InsertTrainCoach :exec
+INSERT INTO train_coaches (train_no, position, coach_code, class, kind)
+VALUES (@train_no, @position, @coach_code, @class, @kind);
+
+-- name: UpsertTrackedTrain :one
+INSERT INTO tracked_trains (
+    source_url,
+    train_no,
+    enabled,
+    note
+) VALUES (
+    @source_url,
+    @train_no,
+    @enabled,
+    @note
+)
+ON CONFLICT(source_url) DO UPDATE SET
+    train_no = COALESCE(excluded.train_no, tracked_trains.train_no),
+    enabled = excluded.enabled,
+    note = COALESCE(excluded.note, tracked_trains.note),
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, source_url, train_no, enabled, note, created_at, updated_at;
+
+-- name: GetTrackedTrain :one
+SELECT id, source_url, train_no, enabled, note, created_at, updated_at
+FROM tracked_trains
+WHERE id = @id;
+
+-- name: ListTrackedTrains :many
+SELECT id, source_url, train_no, enabled, note, created_at, updated_at
+FROM tracked_trains
+ORDER BY id;
+
+-- name: ListTrackedTrainURLs :many
+SELECT source_url
+FROM tracked_trains
+WHERE enabled = 1
+ORDER BY id;
+
+-- name: CountTrackedTrains :one
+SELECT COUNT(*) AS total
+FROM tracked_trains;
+
+-- name: UpdateTrackedTrain :execrows
+UPDATE tracked_trains
+SET enabled = COALESCE(@enabled, enabled),
+    train_no = COALESCE(@train_no, train_no),
+    note = COALESCE(@note, note),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = @id;
+
+-- name: DeleteTrackedTrain :execrows
+DELETE FROM tracked_trains
+WHERE id = @id;
+
+-- name: FillTrackedTrainNo :exec
+-- pages added without a number learn it from their first sync
+UPDATE tracked_trains
+SET train_no = @train_no,
+    updated_at = CURRENT_TIMESTAMP
+WHERE source_url = @source_url
+  AND train_no IS NULL;
@@ -0,0 +1,141 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (
+    url,
+    secret,
+    events,
+    train_no,
+    delay_threshold_min,
+    active,
+    note
+) VALUES (
+    @url,
+    @secret,
+    @events,
+    @train_no,
+    @delay_threshold_min,
+    @active,
+    @note
+)
+RETURNING id, url, secret, events, train_no, delay_threshold_min, active, note, created_at, updated_at;
+
+-- name: GetWebhookSubscription :one
+SELECT id, url, secret, events, train_no, delay_threshold_min, active, note, created_at, updated_at
+FROM webhook_subscriptions
+WHERE id = @id;
+
+-- name: ListWebhookSubscriptions :many
+-- Every subscription with how its deliveries stand
+SELECT
+    s.id,
+    s.url,
+    s.events,
+    s.train_no,
+    s.delay_threshold_min,
+    s.active,
+    s.note,
+    s.created_at,
+    s.updated_at,
+    CAST(COALESCE(SUM(d.id IS NOT NULL AND d.delivered_at IS NULL AND d.abandoned_at IS NULL), 0) AS INTEGER) AS pending,
+    CAST(COALESCE(SUM(d.delivered_at IS NOT NULL), 0) AS INTEGER) AS delivered,
+    CAST(COALESCE(SUM(d.abandoned_at IS NOT NULL), 0) AS INTEGER) AS abandoned
+FROM webhook_subscriptions s
+LEFT JOIN webhook_deliveries d ON d.subscription_id = s.id
+GROUP BY s.id
+ORDER BY s.id;
+
+-- name: UpdateWebhookSubscription :execrows
+UPDATE webhook_subscriptions
+SET url = COALESCE(@url, url),
+    events = COALESCE(@events, events),
+    train_no = COALESCE(@train_no, train_no),
+    delay_threshold_min = COALESCE(@delay_threshold_min, delay_threshold_min),
+    active = COALESCE(@active, active),
+    note = COALESCE(@note, note),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = @id;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = @id;
+
+-- name: ListWebhookDeliveries :many
+-- Latest deliveries of a subscription, newest first
+SELECT
+    id,
+    event,
+    run_id,
+    delay_min,
+    previous_delay_min,
+    attempts,
+    next_attempt_at,
+    last_status,
+    last_error,
+    delivered_at,
+    abandoned_at,
+    created_at
+FROM webhook_deliveries
+WHERE subscription_id = @subscription_id
+ORDER BY id DESC
+LIMIT @limit;
+
+-- name: ListDueWebhookDeliveries :many
+-- Deliveries of active subscriptions whose next attempt is due, with the run as it is now
+SELECT
+    d.id,
+    d.subscription_id,
+    d.event,
+    d.run_id,
+    d.delay_min,
+    d.previous_delay_min,
+    d.attempts,
+    d.created_at,
+    s.url,
+    s.secret,
+    tr.train_no,
+    t.train_name,
+    tr.run_date,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.last_known_lat_u6,
+    tr.last_known_lng_u6,
+    tr.last_update_timestamp_ISO
+FROM webhook_deliveries d
+JOIN webhook_subscriptions s ON s.id = d.subscription_id
+JOIN train_runs tr ON tr.run_id = d.run_id
+JOIN trains t ON t.train_no = tr.train_no
+WHERE d.delivered_at IS NULL
+  AND d.abandoned_at IS NULL
+  AND d.next_attempt_at <= CURRENT_TIMESTAMP
+  AND s.active = 1
+ORDER BY d.id
+LIMIT @limit;
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    last_status = @last_status,
+    last_error = NULL,
+    delivered_at = CURRENT_TIMESTAMP
+WHERE id = @id;
+
+-- name: RetryWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    last_status = @last_status,
+    last_error = @last_error,
+    next_attempt_at = @next_attempt_at
+WHERE id = @id;
+
+-- name: AbandonWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    last_status = @last_status,
+    last_error = @last_error,
+    abandoned_at = CURRENT_TIMESTAMP
+WHERE id = @id;
+
+-- name: PruneWebhookDeliveries :execrows
+-- Finished deliveries are kept a while for the admin listing
+DELETE FROM webhook_deliveries
+WHERE (delivered_at IS NOT NULL OR abandoned_at IS NOT NULL)
+  AND created_at < @before;
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"trano/internal/requestid"
+)
+
+// QueryLogger wraps a connection for the generated queries, logging the ones that fail
+// or take longer than a threshold, tagged with the request ID of their context
+type QueryLogger struct {
+	db     *sql.DB
+	logger *log.Logger
+	slow   time.Duration // zero logs failures only
+}
+
+func LogQueries(dbConn *sql.DB, logger *log.Logger, slow time.Duration) *QueryLogger {
+	return &QueryLogger{db: dbConn, logger: logger, slow: slow}
+}
+
+func (q *QueryLogger) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := q.db.ExecContext(ctx, query, args...)
+	q.log(ctx, query, start, err)
+	return res, err
+}
+
+func (q *QueryLogger) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return q.db.PrepareContext(ctx, query)
+}
+
+func (q *QueryLogger) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	q.log(ctx, query, start, err)
+	return rows, err
+}
+
+// QueryRowContext cannot see the error, that surfaces on Scan
+func (q *QueryLogger) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := q.db.QueryRowContext(ctx, query, args...)
+	q.log(ctx, query, start, nil)
+	return row
+}
+
+func (q *QueryLogger) log(ctx context.Context, query string, start time.Time, err error) {
+	took := time.Since(start)
+	id := requestid.From(ctx)
+	if id == "" {
+		id = "-"
+	}
+	switch {
+	case err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded):
+		q.logger.Printf("[%s] db: %s failed after %s: %v", id, queryName(query), took.Round(time.Millisecond), err)
+	case q.slow > 0 && took >= q.slow:
+		q.logger.Printf("[%s] db: slow query %s took %s", id, queryName(query), took.Round(time.Millisecond))
+	}
+}
+
+// queryName is the name of a generated query, its first line reads "-- name: X :kind"
+func queryName(query string) string {
+	line, _, _ := strings.Cut(query, "\n")
+	if name, ok := strings.CutPrefix(line, "-- name: "); ok {
+		name, _, _ = strings.Cut(name, " ")
+		return name
+	}
+	return "query"
+}
@@ -18,3 +18,54 @@ CREATE TABLE
         created_at TEXT DEFAULT (CURRENT_TIMESTAMP),
         updated_at TEXT DEFAULT (CURRENT_TIMESTAMP)
     );
+
+-- (SpatiaLite)
+-- Station position as a POINT for radius searches, kept in step with lat/lng by the
+-- triggers below
+SELECT
+    CASE
+        WHEN NOT EXISTS (
+            SELECT
+                1
+            FROM
+                pragma_table_info ('stations')
+            WHERE
+                name = 'geom'
+        ) THEN AddGeometryColumn ('stations', 'geom', 4326, 'POINT', 'XY')
+    END;
+
+SELECT
+    CASE
+        WHEN NOT EXISTS (
+            SELECT 1
+            FROM sqlite_master
+            WHERE type = 'table'
+                AND name = 'idx_stations_geom'
+            )
+            THEN CreateSpatialIndex('stations', 'geom')
+        END;
+
+CREATE TRIGGER IF NOT EXISTS stations_geom_insert
+AFTER INSERT ON stations
+WHEN NEW.lat IS NOT NULL AND NEW.lng IS NOT NULL
+BEGIN
+    UPDATE stations SET geom = MakePoint(NEW.lng, NEW.lat, 4326) WHERE station_code = NEW.station_code;
+END;
+
+CREATE TRIGGER IF NOT EXISTS stations_geom_update
+AFTER UPDATE OF lat, lng ON stations
+BEGIN
+    UPDATE stations
+    SET geom = CASE
+        WHEN NEW.lat IS NULL OR NEW.lng IS NULL THEN NULL
+        ELSE MakePoint(NEW.lng, NEW.lat, 4326)
+    END
+    WHERE station_code = NEW.station_code;
+END;
+
+-- stations with coordinates from before the column existed
+UPDATE stations
+SET geom = MakePoint(lng, lat, 4326)
+WHERE geom IS NULL
+    AND lat IS NOT NULL
+    AND lng IS NOT NULL;
@@ -11,9 +11,66 @@ CREATE TABLE
         coachComposition TEXT, -- comma seperated: "L,EOG,B1,B2,B3,S1,S2,S3,S4,GEN,SLR"
         source_url TEXT NOT NULL,
         created_at TEXT DEFAULT (CURRENT_TIMESTAMP), -- ISO: YYYY-MM-DD HH:MM:SS
-        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) -- ISO: YYYY-MM-DD HH:MM:SS
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP), -- ISO: YYYY-MM-DD HH:MM:SS
+        -- polling tier, 0 premium, 1 regular, 2 local and goods; keep in step with addedColumns
+        priority INTEGER GENERATED ALWAYS AS (
+            CASE
+                WHEN train_type LIKE '%rajdhani%' OR train_type LIKE '%shatabdi%'
+                  OR train_type LIKE '%vande%' OR train_type LIKE '%duronto%'
+                  OR train_name LIKE '%rajdhani%' OR train_name LIKE '%shatabdi%'
+                  OR train_name LIKE '%vande bharat%' THEN 0
+                WHEN train_type LIKE '%passenger%' OR train_type LIKE '%emu%'
+                  OR train_type LIKE '%suburban%' OR train_type LIKE '%freight%'
+                  OR train_type LIKE '%parcel%' THEN 2
+                ELSE 1
+            END
+        ) VIRTUAL
+    );
+
+-- TRAIN COACHES (the rake parsed out of trains.coachComposition, replaced on every sync)
+CREATE TABLE
+    IF NOT EXISTS train_coaches (
+        train_no INTEGER NOT NULL,
+        position INTEGER NOT NULL, -- from 1, in the order IRI lists them from the locomotive
+        coach_code TEXT NOT NULL, -- e.g. 'B1', 'GEN'
+        class TEXT, -- e.g. '3A', 'SL', NULL for non passenger coaches
+        kind TEXT NOT NULL, -- 'passenger', 'loco', 'generator', 'luggage', 'pantry', 'postal', 'other'
+        PRIMARY KEY (train_no, position),
+        FOREIGN KEY (train_no) REFERENCES trains (train_no) ON DELETE CASCADE
+    );
+
+-- TRAIN LINKS (numbers that travel on another train's rake for part or all of the way)
+-- train_no carries linked_train_no between from/to on train_no's route, NULL meaning
+-- its origin/terminus. Links are one way, a pair sharing a rake is entered once.
+CREATE TABLE
+    IF NOT EXISTS train_links (
+        train_no INTEGER NOT NULL,
+        linked_train_no INTEGER NOT NULL,
+        kind TEXT NOT NULL CHECK (kind IN ('slip', 'combined', 'shared_rake')),
+        from_station_code TEXT,
+        to_station_code TEXT,
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (train_no, linked_train_no),
+        CHECK (train_no <> linked_train_no),
+        FOREIGN KEY (train_no) REFERENCES trains (train_no) ON DELETE CASCADE
     );
 
+CREATE INDEX IF NOT EXISTS idx_train_links_linked ON train_links (linked_train_no);
+
+-- TRAIN ALIASES (other numbers upstream may report a train under, e.g. after a
+-- renumbering). Runs of the alias are merged into the run of train_no for the same date.
+CREATE TABLE
+    IF NOT EXISTS train_aliases (
+        alias_train_no INTEGER PRIMARY KEY,
+        train_no INTEGER NOT NULL, -- canonical number
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        CHECK (alias_train_no <> train_no),
+        FOREIGN KEY (train_no) REFERENCES trains (train_no) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_train_aliases_train ON train_aliases (train_no);
+
 -- TRAIN SCHEDULE
 CREATE TABLE
     IF NOT EXISTS train_schedules (
@@ -101,3 +158,18 @@ SELECT
         END;
 
 CREATE INDEX IF NOT EXISTS idx_train_route_geometries_train_no ON train_route_geometries (schedule_id);
+
+-- TRACKED TRAINS (IRI train pages the sync covers, replacing data/train_urls.csv)
+-- train_no is known up front for most pages, otherwise filled in by the first sync
+CREATE TABLE
+    IF NOT EXISTS tracked_trains (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        source_url TEXT UNIQUE NOT NULL,
+        train_no INTEGER,
+        enabled INTEGER DEFAULT 1 NOT NULL CHECK (enabled IN (0, 1)),
+        note TEXT,
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_tracked_trains_train_no ON tracked_trains (train_no);
@@ -20,11 +20,24 @@ CREATE TABLE
         last_route_frac_u4 INTEGER,
         last_bearing_deg INTEGER,
 
+        -- dead reckoned position while upstream is quiet, cleared by the next fix
+        extrapolated_lat_u6 INTEGER,
+        extrapolated_lng_u6 INTEGER,
+        extrapolated_at TEXT, -- YYYY-MM-DD HH:MM:SS (UTC)
+
         last_known_distance_km_u4 INTEGER,
+        speed_kmh REAL, -- between the last two fixes
+        avg_speed_kmh REAL, -- over the last few fixes
         last_updated_sno TEXT,
+        current_delay_min INTEGER, -- late at the current station as of the last poll, negative when early
+        revised_departure_min INTEGER, -- origin departure after a reschedule, minutes after run_date midnight
 
         errors TEXT DEFAULT '{}',
         last_update_timestamp_ISO TEXT,
+        quality_score INTEGER, -- 0..100, scored nightly once the run has arrived
+        next_poll_at TEXT, -- YYYY-MM-DD HH:MM:SS (UTC), NULL to poll every cycle
+        lease_owner TEXT, -- poller instance the run is leased to when several share the database
+        lease_expires_at TEXT, -- YYYY-MM-DD HH:MM:SS (UTC), free to claim after this
         created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
         updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
         FOREIGN KEY (schedule_id) REFERENCES train_schedules (schedule_id) ON DELETE CASCADE,
@@ -36,6 +49,9 @@ CREATE INDEX IF NOT EXISTS idx_train_runs_schedule_date ON train_runs (schedule_
 
 CREATE INDEX IF NOT EXISTS idx_train_runs_poll ON train_runs (has_arrived, run_date, last_update_timestamp_ISO);
 
+-- delta updates of the live map look up runs written since a client's last snapshot
+CREATE INDEX IF NOT EXISTS idx_train_runs_updated ON train_runs (updated_at);
+
 CREATE INDEX IF NOT EXISTS idx_train_runs_active_map 
 ON train_runs (has_arrived, last_known_snapped_lat_u6, last_known_snapped_lng_u6) 
 WHERE has_arrived = 0 AND last_known_snapped_lat_u6 IS NOT NULL AND last_known_snapped_lng_u6 IS NOT NULL;
@@ -54,8 +70,28 @@ CREATE TABLE
         distance_km_u4 INTEGER NOT NULL,
         segment_station_code TEXT NOT NULL,
         at_station INTEGER NOT NULL DEFAULT 0,
+        offset_m INTEGER, -- distance of the raw fix from the route, NULL when it did not snap
+        speed_kmh REAL, -- since the fix before, NULL for the first fix or after a long gap
+        avg_speed_kmh REAL, -- over the last few fixes
+        smoothed_lat_u6 INTEGER, -- the fix after smoothing, NULL while smoothing is off
+        smoothed_lng_u6 INTEGER,
 
         timestamp_ISO TEXT NOT NULL,
         FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE,
         UNIQUE (run_id, timestamp_ISO)
     );
+
+-- timestamps are written as RFC3339 in the configured timezone, so they sort as text
+CREATE INDEX IF NOT EXISTS idx_train_run_locations_ts ON train_run_locations (timestamp_ISO);
+
+-- POLL COUNTERS (one row per run, bumped by the poller on every attempt)
+CREATE TABLE
+    IF NOT EXISTS run_poll_stats (
+        run_id TEXT PRIMARY KEY,
+        polls INTEGER NOT NULL,
+        successful_polls INTEGER NOT NULL, -- attempts that returned a live status
+        window_sec INTEGER NOT NULL, -- poller window at the last attempt
+        first_poll_at TEXT NOT NULL, -- ISO: YYYY-MM-DD HH:MM:SS (UTC)
+        last_poll_at TEXT NOT NULL,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
@@ -0,0 +1,57 @@
+PRAGMA foreign_keys = ON;
+
+-- PER-STATION EVENTS (actuals and delays as the run passes each station)
+CREATE TABLE
+    IF NOT EXISTS train_run_station_events (
+        run_id TEXT NOT NULL,
+        sno INTEGER NOT NULL, -- position on the route as reported by WIMT
+        station_code TEXT NOT NULL,
+        distance_km_u4 INTEGER NOT NULL, -- from origin station
+
+        -- unix seconds, NULL when not yet known
+        sch_arrival_tm INTEGER,
+        act_arrival_tm INTEGER,
+        sch_departure_tm INTEGER,
+        act_departure_tm INTEGER,
+
+        delay_arrival_min INTEGER,
+        delay_departure_min INTEGER,
+        departed INTEGER NOT NULL DEFAULT 0 CHECK (departed IN (0, 1)),
+
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (run_id, station_code),
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_train_run_station_events_station ON train_run_station_events (station_code);
+
+-- RUN PLATFORMS (platform per stop as last reported, for stations ahead of the train too,
+-- which is why it is not part of the station events)
+CREATE TABLE
+    IF NOT EXISTS train_run_platforms (
+        run_id TEXT NOT NULL,
+        station_code TEXT NOT NULL,
+        platform TEXT, -- as published, NULL while only riders have reported one
+        platform_info TEXT, -- JSON: [{"platform": "3", "percentage": 80, "feedback_count": 12}]
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (run_id, station_code),
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+-- RUN ENCOUNTERS (two runs passing each other between adjacent stations)
+CREATE TABLE
+    IF NOT EXISTS run_encounters (
+        kind TEXT NOT NULL CHECK (kind IN ('overtake', 'crossing')),
+        run_id_a TEXT NOT NULL, -- overtaking run for overtakes
+        run_id_b TEXT NOT NULL,
+        from_station_code TEXT NOT NULL, -- segment as travelled by run a
+        to_station_code TEXT NOT NULL,
+        encounter_tm INTEGER NOT NULL, -- unix seconds, interpolated
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (kind, run_id_a, run_id_b, from_station_code, to_station_code),
+        FOREIGN KEY (run_id_a) REFERENCES train_runs (run_id) ON DELETE CASCADE,
+        FOREIGN KEY (run_id_b) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_run_encounters_b ON run_encounters (run_id_b);
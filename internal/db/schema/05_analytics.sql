@@ -0,0 +1,210 @@
+PRAGMA foreign_keys = ON;
+
+-- SEGMENT STATS (observed running between consecutive recorded stations)
+CREATE TABLE
+    IF NOT EXISTS segment_stats (
+        from_station_code TEXT NOT NULL,
+        to_station_code TEXT NOT NULL,
+        distance_km REAL NOT NULL,
+        samples INTEGER NOT NULL,
+        avg_speed_kmh REAL NOT NULL,
+        min_speed_kmh REAL NOT NULL,
+        max_speed_kmh REAL NOT NULL,
+        avg_runtime_min REAL NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (from_station_code, to_station_code)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_segment_stats_speed ON segment_stats (avg_speed_kmh);
+
+-- RUN DELAY SUMMARIES (one row per run, rebuilt nightly from station events)
+CREATE TABLE
+    IF NOT EXISTS run_delay_summaries (
+        run_id TEXT PRIMARY KEY,
+        train_no INTEGER NOT NULL,
+        run_date TEXT NOT NULL,
+        stations_observed INTEGER NOT NULL,
+        avg_delay_min REAL,
+        max_delay_min INTEGER,
+        terminal_delay_min INTEGER, -- NULL until the run reaches its terminus
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_run_delay_summaries_date ON run_delay_summaries (run_date, train_no);
+
+-- STATION CONGESTION (trains present at or approaching a station, per local clock hour)
+CREATE TABLE
+    IF NOT EXISTS station_congestion_hourly (
+        station_code TEXT NOT NULL,
+        hour_start_tm INTEGER NOT NULL, -- unix seconds
+        obs_date TEXT NOT NULL, -- local YYYY-MM-DD
+        hour INTEGER NOT NULL CHECK (hour BETWEEN 0 AND 23), -- local hour of day
+        trains INTEGER NOT NULL, -- distinct runs seen during the hour
+        peak_trains INTEGER NOT NULL, -- max simultaneously present
+        avg_trains REAL NOT NULL, -- time-weighted average present
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (station_code, hour_start_tm)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_station_congestion_date ON station_congestion_hourly (obs_date, station_code);
+
+-- TRAIN STATION DELAY PROFILES (historical delay distribution per train, weekday and station)
+CREATE TABLE
+    IF NOT EXISTS train_station_delay_profiles (
+        train_no INTEGER NOT NULL,
+        weekday INTEGER NOT NULL CHECK (weekday BETWEEN -1 AND 6), -- run_date weekday (Sun = 0), -1 = all days
+        station_code TEXT NOT NULL,
+        samples INTEGER NOT NULL,
+        avg_delay_min REAL NOT NULL,
+        p10_delay_min INTEGER NOT NULL,
+        p50_delay_min INTEGER NOT NULL,
+        p90_delay_min INTEGER NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (train_no, weekday, station_code)
+    );
+
+-- DAILY SUMMARIES (closed days, rebuilt nightly for the summary window)
+CREATE TABLE
+    IF NOT EXISTS daily_train_summaries (
+        summary_date TEXT NOT NULL, -- run_date
+        train_no INTEGER NOT NULL,
+        runs INTEGER NOT NULL,
+        completed_runs INTEGER NOT NULL,
+        cancelled_runs INTEGER NOT NULL,
+        tracked_runs INTEGER NOT NULL, -- runs with at least one station event
+        on_time_runs INTEGER NOT NULL,
+        avg_delay_min REAL,
+        avg_terminal_delay_min REAL,
+        coverage_pct REAL NOT NULL, -- stations observed vs scheduled stops
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (summary_date, train_no)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_daily_train_summaries_train ON daily_train_summaries (train_no, summary_date);
+
+CREATE TABLE
+    IF NOT EXISTS daily_station_summaries (
+        summary_date TEXT NOT NULL, -- local date of the actual time
+        station_code TEXT NOT NULL,
+        trains INTEGER NOT NULL,
+        on_time_trains INTEGER NOT NULL,
+        avg_delay_min REAL,
+        max_delay_min INTEGER,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (summary_date, station_code)
+    );
+
+CREATE TABLE
+    IF NOT EXISTS daily_zone_summaries (
+        summary_date TEXT NOT NULL,
+        zone TEXT NOT NULL, -- rake zone of the train, "UNKNOWN" when not published
+        trains INTEGER NOT NULL,
+        runs INTEGER NOT NULL,
+        completed_runs INTEGER NOT NULL,
+        cancelled_runs INTEGER NOT NULL,
+        tracked_runs INTEGER NOT NULL,
+        on_time_runs INTEGER NOT NULL,
+        avg_delay_min REAL,
+        avg_terminal_delay_min REAL,
+        coverage_pct REAL NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (summary_date, zone)
+    );
+
+-- MONTHLY ROLLUPS (daily summaries folded per calendar month, months touched by the summary window are rebuilt nightly)
+CREATE TABLE
+    IF NOT EXISTS monthly_train_summaries (
+        month TEXT NOT NULL, -- YYYY-MM
+        train_no INTEGER NOT NULL,
+        days INTEGER NOT NULL, -- daily summaries folded in
+        runs INTEGER NOT NULL,
+        completed_runs INTEGER NOT NULL,
+        cancelled_runs INTEGER NOT NULL,
+        tracked_runs INTEGER NOT NULL,
+        on_time_runs INTEGER NOT NULL,
+        avg_delay_min REAL,
+        avg_terminal_delay_min REAL,
+        coverage_pct REAL NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (month, train_no)
+    );
+
+CREATE TABLE
+    IF NOT EXISTS monthly_station_summaries (
+        month TEXT NOT NULL,
+        station_code TEXT NOT NULL,
+        days INTEGER NOT NULL,
+        trains INTEGER NOT NULL,
+        on_time_trains INTEGER NOT NULL,
+        avg_delay_min REAL,
+        max_delay_min INTEGER,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (month, station_code)
+    );
+
+CREATE TABLE
+    IF NOT EXISTS monthly_zone_summaries (
+        month TEXT NOT NULL,
+        zone TEXT NOT NULL,
+        days INTEGER NOT NULL,
+        trains INTEGER NOT NULL, -- most trains seen on a single day
+        runs INTEGER NOT NULL,
+        completed_runs INTEGER NOT NULL,
+        cancelled_runs INTEGER NOT NULL,
+        tracked_runs INTEGER NOT NULL,
+        on_time_runs INTEGER NOT NULL,
+        avg_delay_min REAL,
+        avg_terminal_delay_min REAL,
+        coverage_pct REAL NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (month, zone)
+    );
+
+-- HEADWAY STATS (gap between consecutive trains leaving a station towards the same next station)
+CREATE TABLE
+    IF NOT EXISTS headway_stats (
+        station_code TEXT NOT NULL,
+        next_station_code TEXT NOT NULL, -- direction
+        samples INTEGER NOT NULL,
+        min_headway_min REAL NOT NULL,
+        avg_headway_min REAL NOT NULL,
+        max_headway_min REAL NOT NULL,
+        bunched INTEGER NOT NULL, -- headways under the bunching threshold
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (station_code, next_station_code)
+    );
+
+-- RUN DELAY ATTRIBUTION (delay gained on segments, split into inherited from the train ahead vs own)
+CREATE TABLE
+    IF NOT EXISTS run_delay_attribution (
+        run_id TEXT PRIMARY KEY,
+        segments INTEGER NOT NULL,
+        gained_min INTEGER NOT NULL,
+        inherited_min INTEGER NOT NULL, -- gained while following closely behind another train
+        own_min INTEGER NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+-- RUN COVERAGE (how completely each run was observed, rebuilt nightly for the summary window)
+CREATE TABLE
+    IF NOT EXISTS run_coverage_stats (
+        run_id TEXT PRIMARY KEY,
+        train_no INTEGER NOT NULL,
+        run_date TEXT NOT NULL,
+        polls INTEGER NOT NULL,
+        successful_polls INTEGER NOT NULL,
+        expected_polls INTEGER NOT NULL, -- one per poller window between the first and last attempt
+        location_points INTEGER NOT NULL,
+        points_per_hour REAL, -- over the span between the first and last fix
+        gaps INTEGER NOT NULL, -- consecutive fixes further apart than the gap threshold
+        longest_gap_min REAL,
+        scheduled_stops INTEGER NOT NULL,
+        stations_with_actuals INTEGER NOT NULL,
+        station_actuals_pct REAL NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_run_coverage_stats_date ON run_coverage_stats (run_date, train_no);
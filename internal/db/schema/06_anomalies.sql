@@ -0,0 +1,19 @@
+PRAGMA foreign_keys = ON;
+
+-- RUN ANOMALIES (one row per detected episode, resolved_at stays NULL while it lasts)
+CREATE TABLE
+    IF NOT EXISTS run_anomalies (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        run_id TEXT NOT NULL,
+        kind TEXT NOT NULL, -- e.g. "stalled", "diverted"
+        station_code TEXT,
+        distance_km_u4 INTEGER,
+        since_ts TEXT NOT NULL, -- ISO: when the condition started
+        detected_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        resolved_at TEXT,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_run_anomalies_open ON run_anomalies (run_id, kind) WHERE resolved_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_run_anomalies_detected ON run_anomalies (detected_at);
@@ -0,0 +1,18 @@
+PRAGMA foreign_keys = ON;
+
+-- DIVISION WEATHER (daily observed weather at the centroid of each division's stations)
+CREATE TABLE
+    IF NOT EXISTS division_weather_daily (
+        division TEXT NOT NULL,
+        weather_date TEXT NOT NULL, -- local date
+        condition TEXT NOT NULL, -- "fog", "rain", "heat" or "clear"
+        weather_code INTEGER, -- WMO code
+        temp_max_c REAL,
+        temp_min_c REAL,
+        precipitation_mm REAL,
+        provider TEXT NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        PRIMARY KEY (division, weather_date)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_division_weather_daily_date ON division_weather_daily (weather_date);
@@ -0,0 +1,42 @@
+PRAGMA foreign_keys = ON;
+
+-- UPSTREAM BUDGETS (request limiter state per upstream identity, kept across restarts)
+CREATE TABLE
+    IF NOT EXISTS upstream_budgets (
+        name TEXT PRIMARY KEY, -- e.g. "iri" or "wimt:<proxy>"
+        tokens REAL NOT NULL, -- left in the bucket at saved_at
+        saved_at TEXT NOT NULL, -- ISO
+        blocked_until TEXT, -- ISO: no requests before this after upstream pushed back
+        last_blocked_at TEXT, -- ISO
+        blocks INTEGER DEFAULT 0 NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL
+    );
+
+-- UPSTREAM FAILED RESPONSES (raw live status bodies the poller could not make sense of)
+CREATE TABLE
+    IF NOT EXISTS upstream_failed_responses (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        run_id TEXT NOT NULL,
+        kind TEXT NOT NULL, -- unknown_short_response | unparseable
+        error TEXT,
+        body_gzip BLOB NOT NULL, -- gzip of at most the first 256 KiB
+        body_bytes INTEGER NOT NULL, -- size as received
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_upstream_failed_responses_run ON upstream_failed_responses (run_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_upstream_failed_responses_created ON upstream_failed_responses (created_at);
+
+-- UPSTREAM DAY SCHEDULES (the latest full days_schedule of a run, kept when enabled)
+CREATE TABLE
+    IF NOT EXISTS upstream_day_schedules (
+        run_id TEXT PRIMARY KEY,
+        body_gzip BLOB NOT NULL, -- gzip of the days_schedule JSON array
+        body_bytes INTEGER NOT NULL, -- size before compressing
+        stations INTEGER NOT NULL,
+        polled_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_upstream_day_schedules_polled ON upstream_day_schedules (polled_at);
@@ -0,0 +1,33 @@
+PRAGMA foreign_keys = ON;
+
+-- STATION SEARCH (FTS5 over stations, the binary must be built with -tags sqlite_fts5)
+CREATE VIRTUAL TABLE
+    IF NOT EXISTS stations_fts USING fts5 (
+        station_code,
+        station_name,
+        address,
+        content = 'stations',
+        content_rowid = 'rowid',
+        tokenize = 'unicode61 remove_diacritics 2',
+        prefix = '1 2 3'
+    );
+
+CREATE TRIGGER IF NOT EXISTS stations_fts_ai AFTER INSERT ON stations BEGIN
+    INSERT INTO stations_fts (rowid, station_code, station_name, address)
+    VALUES (new.rowid, new.station_code, new.station_name, new.address);
+END;
+
+CREATE TRIGGER IF NOT EXISTS stations_fts_ad AFTER DELETE ON stations BEGIN
+    INSERT INTO stations_fts (stations_fts, rowid, station_code, station_name, address)
+    VALUES ('delete', old.rowid, old.station_code, old.station_name, old.address);
+END;
+
+CREATE TRIGGER IF NOT EXISTS stations_fts_au AFTER UPDATE ON stations BEGIN
+    INSERT INTO stations_fts (stations_fts, rowid, station_code, station_name, address)
+    VALUES ('delete', old.rowid, old.station_code, old.station_name, old.address);
+    INSERT INTO stations_fts (rowid, station_code, station_name, address)
+    VALUES (new.rowid, new.station_code, new.station_name, new.address);
+END;
+
+-- stations written before the index existed; a few thousand rows, cheap on every start
+INSERT INTO stations_fts (stations_fts) VALUES ('rebuild');
@@ -0,0 +1,14 @@
+PRAGMA foreign_keys = ON;
+
+-- API KEYS (only the SHA-256 of a key is stored, the key itself is shown once on creation)
+CREATE TABLE
+    IF NOT EXISTS api_keys (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL, -- who or what the key was issued to
+        key_hash TEXT UNIQUE NOT NULL, -- hex SHA-256 of the key
+        key_prefix TEXT NOT NULL, -- first characters of the key, to tell keys apart in listings
+        scopes TEXT NOT NULL, -- space separated, e.g. "admin write", "*" for all
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        last_used_at TEXT, -- ISO, updated at most once a minute
+        revoked_at TEXT -- ISO: key no longer accepted
+    );
@@ -0,0 +1,100 @@
+PRAGMA foreign_keys = ON;
+
+-- WEBHOOK SUBSCRIPTIONS (external URLs that get a signed POST on run events)
+CREATE TABLE
+    IF NOT EXISTS webhook_subscriptions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL, -- HMAC-SHA256 key for the signature header, shown once on creation
+        events TEXT NOT NULL, -- space separated, e.g. "run.started run.arrived", "*" for all
+        train_no INTEGER, -- NULL for every train
+        delay_threshold_min INTEGER NOT NULL DEFAULT 15 CHECK (delay_threshold_min > 0),
+        active INTEGER NOT NULL DEFAULT 1 CHECK (active IN (0, 1)),
+        note TEXT,
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        updated_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL
+    );
+
+-- WEBHOOK DELIVERIES (one row per event and subscription, written by the triggers below
+-- in the same transaction as the run update, sent and retried by the webhook worker)
+CREATE TABLE
+    IF NOT EXISTS webhook_deliveries (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        subscription_id INTEGER NOT NULL,
+        event TEXT NOT NULL CHECK (event IN ('run.started', 'run.delay_changed', 'run.cancelled', 'run.arrived')),
+        run_id TEXT NOT NULL,
+        delay_min INTEGER, -- delay of the run when the event fired
+        previous_delay_min INTEGER, -- run.delay_changed: the delay last sent to this subscription, 0 before any
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL, -- same format as CURRENT_TIMESTAMP
+        last_status INTEGER, -- HTTP status of the last attempt, NULL when it got no response
+        last_error TEXT,
+        delivered_at TEXT,
+        abandoned_at TEXT, -- gave up after the last retry
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at)
+WHERE delivered_at IS NULL AND abandoned_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_sub_run ON webhook_deliveries (subscription_id, run_id);
+
+CREATE TRIGGER IF NOT EXISTS train_runs_webhook_started
+AFTER UPDATE OF has_started ON train_runs
+WHEN OLD.has_started = 0 AND NEW.has_started = 1
+BEGIN
+    INSERT INTO webhook_deliveries (subscription_id, event, run_id, delay_min)
+    SELECT s.id, 'run.started', NEW.run_id, NEW.current_delay_min
+    FROM webhook_subscriptions s
+    WHERE s.active = 1
+      AND (s.train_no IS NULL OR s.train_no = NEW.train_no)
+      AND (s.events = '*' OR instr(' ' || s.events || ' ', ' run.started ') > 0);
+END;
+
+-- not running today comes from the short response and means the same as cancelled,
+-- every other terminal status is the end of the journey
+CREATE TRIGGER IF NOT EXISTS train_runs_webhook_ended
+AFTER UPDATE OF has_arrived ON train_runs
+WHEN OLD.has_arrived = 0 AND NEW.has_arrived = 1
+  AND NEW.current_status IN ('completed', 'terminated', 'cancelled', 'not_running_today')
+BEGIN
+    INSERT INTO webhook_deliveries (subscription_id, event, run_id, delay_min)
+    SELECT s.id, e.event, NEW.run_id, NEW.current_delay_min
+    FROM webhook_subscriptions s,
+         (SELECT CASE WHEN NEW.current_status IN ('cancelled', 'not_running_today')
+                      THEN 'run.cancelled' ELSE 'run.arrived' END AS event) e
+    WHERE s.active = 1
+      AND (s.train_no IS NULL OR s.train_no = NEW.train_no)
+      AND (s.events = '*' OR instr(' ' || s.events || ' ', ' ' || e.event || ' ') > 0);
+END;
+
+-- fires once the delay has moved by the subscription's threshold from the delay it was
+-- last told about, so slow drift is reported as well as sudden jumps
+CREATE TRIGGER IF NOT EXISTS train_runs_webhook_delay
+AFTER UPDATE OF current_delay_min ON train_runs
+WHEN NEW.current_delay_min IS NOT NULL AND NEW.current_delay_min IS NOT OLD.current_delay_min
+BEGIN
+    INSERT INTO webhook_deliveries (subscription_id, event, run_id, delay_min, previous_delay_min)
+    SELECT id, 'run.delay_changed', NEW.run_id, NEW.current_delay_min, last_delay_min
+    FROM (
+        SELECT
+            s.id,
+            s.delay_threshold_min,
+            COALESCE((
+                SELECT d.delay_min
+                FROM webhook_deliveries d
+                WHERE d.subscription_id = s.id
+                  AND d.run_id = NEW.run_id
+                  AND d.event = 'run.delay_changed'
+                ORDER BY d.id DESC
+                LIMIT 1
+            ), 0) AS last_delay_min
+        FROM webhook_subscriptions s
+        WHERE s.active = 1
+          AND (s.train_no IS NULL OR s.train_no = NEW.train_no)
+          AND (s.events = '*' OR instr(' ' || s.events || ' ', ' run.delay_changed ') > 0)
+    )
+    WHERE abs(NEW.current_delay_min - last_delay_min) >= delay_threshold_min;
+END;
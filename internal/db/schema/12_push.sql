@@ -0,0 +1,26 @@
+PRAGMA foreign_keys = ON;
+
+-- DEVICE SUBSCRIPTIONS (FCM registration tokens following one run of a train)
+CREATE TABLE
+    IF NOT EXISTS device_subscriptions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        token TEXT NOT NULL, -- FCM registration token of the device
+        train_no INTEGER NOT NULL,
+        run_date TEXT NOT NULL, -- YYYY-MM-DD, the run does not have to exist yet
+        notified_status TEXT, -- status and delay of the last push sent, NULL before any
+        notified_delay_min INTEGER,
+        created_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        UNIQUE (token, train_no, run_date),
+        FOREIGN KEY (train_no) REFERENCES trains (train_no) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_device_subscriptions_run ON device_subscriptions (train_no, run_date);
+
+-- PUSH PENDING (runs whose status or delay changed since the push worker last looked,
+-- queued by the poller only while some device follows the run)
+CREATE TABLE
+    IF NOT EXISTS push_pending (
+        run_id TEXT PRIMARY KEY,
+        queued_at TEXT DEFAULT (CURRENT_TIMESTAMP) NOT NULL,
+        FOREIGN KEY (run_id) REFERENCES train_runs (run_id) ON DELETE CASCADE
+    );
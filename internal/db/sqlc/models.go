@@ -10,6 +10,215 @@ import (
 	"trano/internal/db"
 )
 
+type ApiKey struct {
+	ID         int64          `json:"id"`
+	Name       string         `json:"name"`
+	KeyHash    string         `json:"key_hash"`
+	KeyPrefix  string         `json:"key_prefix"`
+	Scopes     string         `json:"scopes"`
+	CreatedAt  string         `json:"created_at"`
+	LastUsedAt sql.NullString `json:"last_used_at"`
+	RevokedAt  sql.NullString `json:"revoked_at"`
+}
+
+type DailyStationSummary struct {
+	SummaryDate  string          `json:"summary_date"`
+	StationCode  string          `json:"station_code"`
+	Trains       int64           `json:"trains"`
+	OnTimeTrains int64           `json:"on_time_trains"`
+	AvgDelayMin  sql.NullFloat64 `json:"avg_delay_min"`
+	MaxDelayMin  sql.NullInt64   `json:"max_delay_min"`
+	UpdatedAt    string          `json:"updated_at"`
+}
+
+type DailyTrainSummary struct {
+	SummaryDate         string          `json:"summary_date"`
+	TrainNo             int64           `json:"train_no"`
+	Runs                int64           `json:"runs"`
+	CompletedRuns       int64           `json:"completed_runs"`
+	CancelledRuns       int64           `json:"cancelled_runs"`
+	TrackedRuns         int64           `json:"tracked_runs"`
+	OnTimeRuns          int64           `json:"on_time_runs"`
+	AvgDelayMin         sql.NullFloat64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin sql.NullFloat64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64         `json:"coverage_pct"`
+	UpdatedAt           string          `json:"updated_at"`
+}
+
+type DailyZoneSummary struct {
+	SummaryDate         string          `json:"summary_date"`
+	Zone                string          `json:"zone"`
+	Trains              int64           `json:"trains"`
+	Runs                int64           `json:"runs"`
+	CompletedRuns       int64           `json:"completed_runs"`
+	CancelledRuns       int64           `json:"cancelled_runs"`
+	TrackedRuns         int64           `json:"tracked_runs"`
+	OnTimeRuns          int64           `json:"on_time_runs"`
+	AvgDelayMin         sql.NullFloat64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin sql.NullFloat64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64         `json:"coverage_pct"`
+	UpdatedAt           string          `json:"updated_at"`
+}
+
+type DeviceSubscription struct {
+	ID               int64          `json:"id"`
+	Token            string         `json:"token"`
+	TrainNo          int64          `json:"train_no"`
+	RunDate          string         `json:"run_date"`
+	NotifiedStatus   sql.NullString `json:"notified_status"`
+	NotifiedDelayMin sql.NullInt64  `json:"notified_delay_min"`
+	CreatedAt        string         `json:"created_at"`
+}
+
+type DivisionWeatherDaily struct {
+	Division        string          `json:"division"`
+	WeatherDate     string          `json:"weather_date"`
+	Condition       string          `json:"condition"`
+	WeatherCode     sql.NullInt64   `json:"weather_code"`
+	TempMaxC        sql.NullFloat64 `json:"temp_max_c"`
+	TempMinC        sql.NullFloat64 `json:"temp_min_c"`
+	PrecipitationMm sql.NullFloat64 `json:"precipitation_mm"`
+	Provider        string          `json:"provider"`
+	UpdatedAt       string          `json:"updated_at"`
+}
+
+type HeadwayStat struct {
+	StationCode     string  `json:"station_code"`
+	NextStationCode string  `json:"next_station_code"`
+	Samples         int64   `json:"samples"`
+	MinHeadwayMin   float64 `json:"min_headway_min"`
+	AvgHeadwayMin   float64 `json:"avg_headway_min"`
+	MaxHeadwayMin   float64 `json:"max_headway_min"`
+	Bunched         int64   `json:"bunched"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
+type MonthlyStationSummary struct {
+	Month        string          `json:"month"`
+	StationCode  string          `json:"station_code"`
+	Days         int64           `json:"days"`
+	Trains       int64           `json:"trains"`
+	OnTimeTrains int64           `json:"on_time_trains"`
+	AvgDelayMin  sql.NullFloat64 `json:"avg_delay_min"`
+	MaxDelayMin  sql.NullInt64   `json:"max_delay_min"`
+	UpdatedAt    string          `json:"updated_at"`
+}
+
+type MonthlyTrainSummary struct {
+	Month               string          `json:"month"`
+	TrainNo             int64           `json:"train_no"`
+	Days                int64           `json:"days"`
+	Runs                int64           `json:"runs"`
+	CompletedRuns       int64           `json:"completed_runs"`
+	CancelledRuns       int64           `json:"cancelled_runs"`
+	TrackedRuns         int64           `json:"tracked_runs"`
+	OnTimeRuns          int64           `json:"on_time_runs"`
+	AvgDelayMin         sql.NullFloat64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin sql.NullFloat64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64         `json:"coverage_pct"`
+	UpdatedAt           string          `json:"updated_at"`
+}
+
+type MonthlyZoneSummary struct {
+	Month               string          `json:"month"`
+	Zone                string          `json:"zone"`
+	Days                int64           `json:"days"`
+	Trains              int64           `json:"trains"`
+	Runs                int64           `json:"runs"`
+	CompletedRuns       int64           `json:"completed_runs"`
+	CancelledRuns       int64           `json:"cancelled_runs"`
+	TrackedRuns         int64           `json:"tracked_runs"`
+	OnTimeRuns          int64           `json:"on_time_runs"`
+	AvgDelayMin         sql.NullFloat64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin sql.NullFloat64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64         `json:"coverage_pct"`
+	UpdatedAt           string          `json:"updated_at"`
+}
+
+type PushPending struct {
+	RunID    string `json:"run_id"`
+	QueuedAt string `json:"queued_at"`
+}
+
+type RunAnomaly struct {
+	ID           int64          `json:"id"`
+	RunID        string         `json:"run_id"`
+	Kind         string         `json:"kind"`
+	StationCode  sql.NullString `json:"station_code"`
+	DistanceKmU4 sql.NullInt64  `json:"distance_km_u4"`
+	SinceTs      string         `json:"since_ts"`
+	DetectedAt   string         `json:"detected_at"`
+	ResolvedAt   sql.NullString `json:"resolved_at"`
+}
+
+type RunCoverageStat struct {
+	RunID               string          `json:"run_id"`
+	TrainNo             int64           `json:"train_no"`
+	RunDate             string          `json:"run_date"`
+	Polls               int64           `json:"polls"`
+	SuccessfulPolls     int64           `json:"successful_polls"`
+	ExpectedPolls       int64           `json:"expected_polls"`
+	LocationPoints      int64           `json:"location_points"`
+	PointsPerHour       sql.NullFloat64 `json:"points_per_hour"`
+	Gaps                int64           `json:"gaps"`
+	LongestGapMin       sql.NullFloat64 `json:"longest_gap_min"`
+	ScheduledStops      int64           `json:"scheduled_stops"`
+	StationsWithActuals int64           `json:"stations_with_actuals"`
+	StationActualsPct   float64         `json:"station_actuals_pct"`
+	UpdatedAt           string          `json:"updated_at"`
+}
+
+type RunDelayAttribution struct {
+	RunID        string `json:"run_id"`
+	Segments     int64  `json:"segments"`
+	GainedMin    int64  `json:"gained_min"`
+	InheritedMin int64  `json:"inherited_min"`
+	OwnMin       int64  `json:"own_min"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type RunDelaySummary struct {
+	RunID            string          `json:"run_id"`
+	TrainNo          int64           `json:"train_no"`
+	RunDate          string          `json:"run_date"`
+	StationsObserved int64           `json:"stations_observed"`
+	AvgDelayMin      sql.NullFloat64 `json:"avg_delay_min"`
+	MaxDelayMin      sql.NullInt64   `json:"max_delay_min"`
+	TerminalDelayMin sql.NullInt64   `json:"terminal_delay_min"`
+	UpdatedAt        string          `json:"updated_at"`
+}
+
+type RunEncounter struct {
+	Kind            string `json:"kind"`
+	RunIDA          string `json:"run_id_a"`
+	RunIDB          string `json:"run_id_b"`
+	FromStationCode string `json:"from_station_code"`
+	ToStationCode   string `json:"to_station_code"`
+	EncounterTm     int64  `json:"encounter_tm"`
+	CreatedAt       string `json:"created_at"`
+}
+
+type RunPollStat struct {
+	RunID           string `json:"run_id"`
+	Polls           int64  `json:"polls"`
+	SuccessfulPolls int64  `json:"successful_polls"`
+	WindowSec       int64  `json:"window_sec"`
+	FirstPollAt     string `json:"first_poll_at"`
+	LastPollAt      string `json:"last_poll_at"`
+}
+
+type SegmentStat struct {
+	FromStationCode string  `json:"from_station_code"`
+	ToStationCode   string  `json:"to_station_code"`
+	DistanceKm      float64 `json:"distance_km"`
+	Samples         int64   `json:"samples"`
+	AvgSpeedKmh     float64 `json:"avg_speed_kmh"`
+	MinSpeedKmh     float64 `json:"min_speed_kmh"`
+	MaxSpeedKmh     float64 `json:"max_speed_kmh"`
+	AvgRuntimeMin   float64 `json:"avg_runtime_min"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
 type Station struct {
 	StationCode       string          `json:"station_code"`
 	StationName       string          `json:"station_name"`
@@ -27,6 +236,27 @@ type Station struct {
 	UpdatedAt         sql.NullString  `json:"updated_at"`
 }
 
+type StationCongestionHourly struct {
+	StationCode string  `json:"station_code"`
+	HourStartTm int64   `json:"hour_start_tm"`
+	ObsDate     string  `json:"obs_date"`
+	Hour        int64   `json:"hour"`
+	Trains      int64   `json:"trains"`
+	PeakTrains  int64   `json:"peak_trains"`
+	AvgTrains   float64 `json:"avg_trains"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+type TrackedTrain struct {
+	ID        int64          `json:"id"`
+	SourceUrl string         `json:"source_url"`
+	TrainNo   sql.NullInt64  `json:"train_no"`
+	Enabled   int64          `json:"enabled"`
+	Note      sql.NullString `json:"note"`
+	CreatedAt string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
+}
+
 type Train struct {
 	TrainNo          int64          `json:"train_no"`
 	TrainName        string         `json:"train_name"`
@@ -37,6 +267,31 @@ type Train struct {
 	SourceUrl        string         `json:"source_url"`
 	CreatedAt        sql.NullString `json:"created_at"`
 	UpdatedAt        sql.NullString `json:"updated_at"`
+	Priority         sql.NullInt64  `json:"priority"`
+}
+
+type TrainAlias struct {
+	AliasTrainNo int64  `json:"alias_train_no"`
+	TrainNo      int64  `json:"train_no"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type TrainCoache struct {
+	TrainNo   int64          `json:"train_no"`
+	Position  int64          `json:"position"`
+	CoachCode string         `json:"coach_code"`
+	Class     sql.NullString `json:"class"`
+	Kind      string         `json:"kind"`
+}
+
+type TrainLink struct {
+	TrainNo         int64          `json:"train_no"`
+	LinkedTrainNo   int64          `json:"linked_train_no"`
+	Kind            string         `json:"kind"`
+	FromStationCode sql.NullString `json:"from_station_code"`
+	ToStationCode   sql.NullString `json:"to_station_code"`
+	CreatedAt       string         `json:"created_at"`
+	UpdatedAt       string         `json:"updated_at"`
 }
 
 type TrainRoute struct {
@@ -54,38 +309,78 @@ type TrainRouteGeometry struct {
 }
 
 type TrainRun struct {
-	RunID                  string         `json:"run_id"`
-	ScheduleID             int64          `json:"schedule_id"`
-	TrainNo                int64          `json:"train_no"`
-	RunDate                string         `json:"run_date"`
-	HasStarted             int64          `json:"has_started"`
-	HasArrived             int64          `json:"has_arrived"`
-	CurrentStatus          interface{}    `json:"current_status"`
-	LastKnownLatU6         sql.NullInt64  `json:"last_known_lat_u6"`
-	LastKnownLngU6         sql.NullInt64  `json:"last_known_lng_u6"`
-	LastKnownSnappedLatU6  sql.NullInt64  `json:"last_known_snapped_lat_u6"`
-	LastKnownSnappedLngU6  sql.NullInt64  `json:"last_known_snapped_lng_u6"`
-	LastRouteFracU4        sql.NullInt64  `json:"last_route_frac_u4"`
-	LastBearingDeg         sql.NullInt64  `json:"last_bearing_deg"`
-	LastKnownDistanceKmU4  sql.NullInt64  `json:"last_known_distance_km_u4"`
-	LastUpdatedSno         sql.NullString `json:"last_updated_sno"`
-	Errors                 db.RunErrors   `json:"errors"`
-	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
-	CreatedAt              string         `json:"created_at"`
-	UpdatedAt              string         `json:"updated_at"`
+	RunID                  string          `json:"run_id"`
+	ScheduleID             int64           `json:"schedule_id"`
+	TrainNo                int64           `json:"train_no"`
+	RunDate                string          `json:"run_date"`
+	HasStarted             int64           `json:"has_started"`
+	HasArrived             int64           `json:"has_arrived"`
+	CurrentStatus          interface{}     `json:"current_status"`
+	LastKnownLatU6         sql.NullInt64   `json:"last_known_lat_u6"`
+	LastKnownLngU6         sql.NullInt64   `json:"last_known_lng_u6"`
+	LastKnownSnappedLatU6  sql.NullInt64   `json:"last_known_snapped_lat_u6"`
+	LastKnownSnappedLngU6  sql.NullInt64   `json:"last_known_snapped_lng_u6"`
+	LastRouteFracU4        sql.NullInt64   `json:"last_route_frac_u4"`
+	LastBearingDeg         sql.NullInt64   `json:"last_bearing_deg"`
+	ExtrapolatedLatU6      sql.NullInt64   `json:"extrapolated_lat_u6"`
+	ExtrapolatedLngU6      sql.NullInt64   `json:"extrapolated_lng_u6"`
+	ExtrapolatedAt         sql.NullString  `json:"extrapolated_at"`
+	LastKnownDistanceKmU4  sql.NullInt64   `json:"last_known_distance_km_u4"`
+	SpeedKmh               sql.NullFloat64 `json:"speed_kmh"`
+	AvgSpeedKmh            sql.NullFloat64 `json:"avg_speed_kmh"`
+	LastUpdatedSno         sql.NullString  `json:"last_updated_sno"`
+	CurrentDelayMin        sql.NullInt64   `json:"current_delay_min"`
+	RevisedDepartureMin    sql.NullInt64   `json:"revised_departure_min"`
+	Errors                 db.RunErrors    `json:"errors"`
+	LastUpdateTimestampIso sql.NullString  `json:"last_update_timestamp_iso"`
+	QualityScore           sql.NullInt64   `json:"quality_score"`
+	NextPollAt             sql.NullString  `json:"next_poll_at"`
+	LeaseOwner             sql.NullString  `json:"lease_owner"`
+	LeaseExpiresAt         sql.NullString  `json:"lease_expires_at"`
+	CreatedAt              string          `json:"created_at"`
+	UpdatedAt              string          `json:"updated_at"`
 }
 
 type TrainRunLocation struct {
-	ID                 int64         `json:"id"`
-	RunID              string        `json:"run_id"`
-	LatU6              int64         `json:"lat_u6"`
-	LngU6              int64         `json:"lng_u6"`
-	SnappedLatU6       sql.NullInt64 `json:"snapped_lat_u6"`
-	SnappedLngU6       sql.NullInt64 `json:"snapped_lng_u6"`
-	DistanceKmU4       int64         `json:"distance_km_u4"`
-	SegmentStationCode string        `json:"segment_station_code"`
-	AtStation          int64         `json:"at_station"`
-	TimestampIso       string        `json:"timestamp_iso"`
+	ID                 int64           `json:"id"`
+	RunID              string          `json:"run_id"`
+	LatU6              int64           `json:"lat_u6"`
+	LngU6              int64           `json:"lng_u6"`
+	SnappedLatU6       sql.NullInt64   `json:"snapped_lat_u6"`
+	SnappedLngU6       sql.NullInt64   `json:"snapped_lng_u6"`
+	DistanceKmU4       int64           `json:"distance_km_u4"`
+	SegmentStationCode string          `json:"segment_station_code"`
+	AtStation          int64           `json:"at_station"`
+	OffsetM            sql.NullInt64   `json:"offset_m"`
+	SpeedKmh           sql.NullFloat64 `json:"speed_kmh"`
+	AvgSpeedKmh        sql.NullFloat64 `json:"avg_speed_kmh"`
+	SmoothedLatU6      sql.NullInt64   `json:"smoothed_lat_u6"`
+	SmoothedLngU6      sql.NullInt64   `json:"smoothed_lng_u6"`
+	TimestampIso       string          `json:"timestamp_iso"`
+}
+
+type TrainRunPlatform struct {
+	RunID        string         `json:"run_id"`
+	StationCode  string         `json:"station_code"`
+	Platform     sql.NullString `json:"platform"`
+	PlatformInfo sql.NullString `json:"platform_info"`
+	UpdatedAt    string         `json:"updated_at"`
+}
+
+type TrainRunStationEvent struct {
+	RunID             string        `json:"run_id"`
+	Sno               int64         `json:"sno"`
+	StationCode       string        `json:"station_code"`
+	DistanceKmU4      int64         `json:"distance_km_u4"`
+	SchArrivalTm      sql.NullInt64 `json:"sch_arrival_tm"`
+	ActArrivalTm      sql.NullInt64 `json:"act_arrival_tm"`
+	SchDepartureTm    sql.NullInt64 `json:"sch_departure_tm"`
+	ActDepartureTm    sql.NullInt64 `json:"act_departure_tm"`
+	DelayArrivalMin   sql.NullInt64 `json:"delay_arrival_min"`
+	DelayDepartureMin sql.NullInt64 `json:"delay_departure_min"`
+	Departed          int64         `json:"departed"`
+	CreatedAt         string        `json:"created_at"`
+	UpdatedAt         string        `json:"updated_at"`
 }
 
 type TrainSchedule struct {
@@ -100,3 +395,72 @@ type TrainSchedule struct {
 	CreatedAt             sql.NullString `json:"created_at"`
 	UpdatedAt             sql.NullString `json:"updated_at"`
 }
+
+type TrainStationDelayProfile struct {
+	TrainNo     int64   `json:"train_no"`
+	Weekday     int64   `json:"weekday"`
+	StationCode string  `json:"station_code"`
+	Samples     int64   `json:"samples"`
+	AvgDelayMin float64 `json:"avg_delay_min"`
+	P10DelayMin int64   `json:"p10_delay_min"`
+	P50DelayMin int64   `json:"p50_delay_min"`
+	P90DelayMin int64   `json:"p90_delay_min"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+type UpstreamBudget struct {
+	Name          string         `json:"name"`
+	Tokens        float64        `json:"tokens"`
+	SavedAt       string         `json:"saved_at"`
+	BlockedUntil  sql.NullString `json:"blocked_until"`
+	LastBlockedAt sql.NullString `json:"last_blocked_at"`
+	Blocks        int64          `json:"blocks"`
+	UpdatedAt     string         `json:"updated_at"`
+}
+
+type UpstreamDaySchedule struct {
+	RunID     string `json:"run_id"`
+	BodyGzip  []byte `json:"body_gzip"`
+	BodyBytes int64  `json:"body_bytes"`
+	Stations  int64  `json:"stations"`
+	PolledAt  string `json:"polled_at"`
+}
+
+type UpstreamFailedResponse struct {
+	ID        int64          `json:"id"`
+	RunID     string         `json:"run_id"`
+	Kind      string         `json:"kind"`
+	Error     sql.NullString `json:"error"`
+	BodyGzip  []byte         `json:"body_gzip"`
+	BodyBytes int64          `json:"body_bytes"`
+	CreatedAt string         `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID               int64          `json:"id"`
+	SubscriptionID   int64          `json:"subscription_id"`
+	Event            string         `json:"event"`
+	RunID            string         `json:"run_id"`
+	DelayMin         sql.NullInt64  `json:"delay_min"`
+	PreviousDelayMin sql.NullInt64  `json:"previous_delay_min"`
+	Attempts         int64          `json:"attempts"`
+	NextAttemptAt    string         `json:"next_attempt_at"`
+	LastStatus       sql.NullInt64  `json:"last_status"`
+	LastError        sql.NullString `json:"last_error"`
+	DeliveredAt      sql.NullString `json:"delivered_at"`
+	AbandonedAt      sql.NullString `json:"abandoned_at"`
+	CreatedAt        string         `json:"created_at"`
+}
+
+type WebhookSubscription struct {
+	ID                int64          `json:"id"`
+	Url               string         `json:"url"`
+	Secret            string         `json:"secret"`
+	Events            string         `json:"events"`
+	TrainNo           sql.NullInt64  `json:"train_no"`
+	DelayThresholdMin int64          `json:"delay_threshold_min"`
+	Active            int64          `json:"active"`
+	Note              sql.NullString `json:"note"`
+	CreatedAt         string         `json:"created_at"`
+	UpdatedAt         string         `json:"updated_at"`
+}
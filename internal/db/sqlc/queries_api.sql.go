@@ -8,39 +8,130 @@ package db
 import (
 	"context"
 	"database/sql"
+	"strings"
 )
 
+const countTrainsAtStation = `-- name: CountTrainsAtStation :one
+SELECT COUNT(*)
+FROM train_runs tr
+JOIN train_run_locations l ON l.run_id = tr.run_id AND l.timestamp_ISO = tr.last_update_timestamp_ISO
+WHERE tr.has_arrived = 0
+  AND l.segment_station_code = ?1
+  AND l.at_station = 1
+  AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+`
+
+// Counts active runs whose latest fix has them standing at the station
+func (q *Queries) CountTrainsAtStation(ctx context.Context, stationCode string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTrainsAtStation, stationCode)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const getLiveTrains = `-- name: GetLiveTrains :many
+WITH live AS (
+    SELECT
+        tr.run_id,
+        tr.train_no,
+        tr.run_date,
+        tr.schedule_id,
+        tr.last_known_snapped_lat_u6,
+        tr.last_known_snapped_lng_u6,
+        tr.extrapolated_lat_u6,
+        tr.extrapolated_lng_u6,
+        tr.last_known_distance_km_u4,
+        tr.last_bearing_deg,
+        tr.current_status,
+        tr.current_delay_min,
+        tr.speed_kmh,
+        tr.avg_speed_kmh,
+        tr.last_update_timestamp_iso
+    FROM train_runs tr
+    WHERE tr.has_arrived = 0
+      AND tr.last_known_snapped_lat_u6 IS NOT NULL
+      AND tr.last_known_snapped_lng_u6 IS NOT NULL
+      -- Only recent updates (avoid stale data)
+      AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+),
+carried AS (
+    -- the carrier is between the link's stations on its own route
+    SELECT
+        c.run_id AS carrier_run_id,
+        c.run_date,
+        l.linked_train_no
+    FROM live c
+    JOIN train_links l ON l.train_no = c.train_no
+    LEFT JOIN train_routes rf
+        ON rf.schedule_id = c.schedule_id
+        AND rf.station_code = l.from_station_code
+    LEFT JOIN train_routes rt
+        ON rt.schedule_id = c.schedule_id
+        AND rt.station_code = l.to_station_code
+    WHERE c.last_known_distance_km_u4 >= CAST(COALESCE(rf.distance_km, 0) * 10000 AS INTEGER)
+      AND (rt.distance_km IS NULL OR c.last_known_distance_km_u4 <= CAST(rt.distance_km * 10000 AS INTEGER))
+)
 SELECT 
     t.train_name,
     t.train_type,
+    t.zone,
     tr.train_no,
-    tr.last_known_snapped_lat_u6 AS lat_u6,
-    tr.last_known_snapped_lng_u6 AS lng_u6,
+    -- the dead reckoned position while there is one, see ExtrapolateRunPositions
+    COALESCE(tr.extrapolated_lat_u6, tr.last_known_snapped_lat_u6) AS lat_u6,
+    COALESCE(tr.extrapolated_lng_u6, tr.last_known_snapped_lng_u6) AS lng_u6,
     tr.last_bearing_deg AS bearing_deg,
     tr.current_status,
-    tr.last_update_timestamp_iso
-FROM train_runs tr
+    tr.current_delay_min,
+    tr.speed_kmh,
+    tr.avg_speed_kmh,
+    tr.last_update_timestamp_iso,
+    CAST(tr.extrapolated_lat_u6 IS NOT NULL AS INTEGER) AS extrapolated,
+    CAST(COALESCE((
+        SELECT group_concat(cr.linked_train_no)
+        FROM carried cr
+        WHERE cr.carrier_run_id = tr.run_id
+    ), '') AS TEXT) AS linked_train_nos
+FROM live tr
 JOIN trains t ON tr.train_no = t.train_no
-WHERE tr.has_arrived = 0
-  AND tr.last_known_snapped_lat_u6 IS NOT NULL
-  AND tr.last_known_snapped_lng_u6 IS NOT NULL
-  -- Only recent updates (avoid stale data)
-  AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM carried cr
+    WHERE cr.linked_train_no = tr.train_no
+      AND cr.run_date = tr.run_date
+)
+  -- alias runs are merged into the canonical run, only that one is shown
+  AND NOT EXISTS (
+    SELECT 1
+    FROM train_aliases ta
+    JOIN train_runs cr
+        ON cr.train_no = ta.train_no
+        AND cr.run_date = tr.run_date
+    WHERE ta.alias_train_no = tr.train_no
+)
+-- a stable order, so limits and pagination by clients cut the same trains every time
+ORDER BY tr.train_no, tr.run_date
 `
 
 type GetLiveTrainsRow struct {
-	TrainName              string         `json:"train_name"`
-	TrainType              string         `json:"train_type"`
-	TrainNo                int64          `json:"train_no"`
-	LatU6                  sql.NullInt64  `json:"lat_u6"`
-	LngU6                  sql.NullInt64  `json:"lng_u6"`
-	BearingDeg             sql.NullInt64  `json:"bearing_deg"`
-	CurrentStatus          interface{}    `json:"current_status"`
-	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+	TrainName              string          `json:"train_name"`
+	TrainType              string          `json:"train_type"`
+	Zone                   sql.NullString  `json:"zone"`
+	TrainNo                int64           `json:"train_no"`
+	LatU6                  sql.NullInt64   `json:"lat_u6"`
+	LngU6                  sql.NullInt64   `json:"lng_u6"`
+	BearingDeg             sql.NullInt64   `json:"bearing_deg"`
+	CurrentStatus          interface{}     `json:"current_status"`
+	CurrentDelayMin        sql.NullInt64   `json:"current_delay_min"`
+	SpeedKmh               sql.NullFloat64 `json:"speed_kmh"`
+	AvgSpeedKmh            sql.NullFloat64 `json:"avg_speed_kmh"`
+	LastUpdateTimestampIso sql.NullString  `json:"last_update_timestamp_iso"`
+	Extrapolated           int64           `json:"extrapolated"`
+	LinkedTrainNos         string          `json:"linked_train_nos"`
 }
 
-// Returns data for active trains within viewport bounds
+// Returns data for active trains, the viewport is applied by the caller
+// Linked trains riding a live carrier are folded into the carrier's row as linked_train_nos,
+// alias runs are hidden behind their canonical run
 func (q *Queries) GetLiveTrains(ctx context.Context) ([]GetLiveTrainsRow, error) {
 	rows, err := q.db.QueryContext(ctx, getLiveTrains)
 	if err != nil {
@@ -53,12 +144,3569 @@ func (q *Queries) GetLiveTrains(ctx context.Context) ([]GetLiveTrainsRow, error)
 		if err := rows.Scan(
 			&i.TrainName,
 			&i.TrainType,
+			&i.Zone,
 			&i.TrainNo,
 			&i.LatU6,
 			&i.LngU6,
 			&i.BearingDeg,
 			&i.CurrentStatus,
+			&i.CurrentDelayMin,
+			&i.SpeedKmh,
+			&i.AvgSpeedKmh,
 			&i.LastUpdateTimestampIso,
+			&i.Extrapolated,
+			&i.LinkedTrainNos,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLiveVersion = `-- name: GetLiveVersion :one
+SELECT
+    CAST(COALESCE((SELECT MAX(updated_at) FROM train_runs), '') AS TEXT) AS max_updated_at,
+    CAST(COUNT(*) AS INTEGER) AS live_runs,
+    CAST(COALESCE(SUM(
+        COALESCE(tr.extrapolated_lat_u6, tr.last_known_snapped_lat_u6)
+        + COALESCE(tr.extrapolated_lng_u6, tr.last_known_snapped_lng_u6)
+    ), 0) AS INTEGER) AS position_sum
+FROM train_runs tr
+WHERE tr.has_arrived = 0
+  AND tr.last_known_snapped_lat_u6 IS NOT NULL
+  AND tr.last_known_snapped_lng_u6 IS NOT NULL
+  AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+`
+
+type GetLiveVersionRow struct {
+	MaxUpdatedAt string `json:"max_updated_at"`
+	LiveRuns     int64  `json:"live_runs"`
+	PositionSum  int64  `json:"position_sum"`
+}
+
+// Cheap fingerprint of the live set for ETags: the latest run write plus the count and a
+// position checksum of live runs, so trains dropping out of the window change it too
+func (q *Queries) GetLiveVersion(ctx context.Context) (GetLiveVersionRow, error) {
+	row := q.db.QueryRowContext(ctx, getLiveVersion)
+	var i GetLiveVersionRow
+	err := row.Scan(
+		&i.MaxUpdatedAt,
+		&i.LiveRuns,
+		&i.PositionSum,
+	)
+	return i, err
+}
+
+const getRunPredictionContext = `-- name: GetRunPredictionContext :one
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    tr.schedule_id,
+    ts.origin_sch_departure_min,
+    tr.has_started,
+    tr.has_arrived,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    tr.last_update_timestamp_ISO
+FROM train_runs tr
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+WHERE tr.run_id = ?1
+`
+
+type GetRunPredictionContextRow struct {
+	RunID                  string         `json:"run_id"`
+	TrainNo                int64          `json:"train_no"`
+	RunDate                string         `json:"run_date"`
+	ScheduleID             int64          `json:"schedule_id"`
+	OriginSchDepartureMin  int64          `json:"origin_sch_departure_min"`
+	HasStarted             int64          `json:"has_started"`
+	HasArrived             int64          `json:"has_arrived"`
+	DistanceKmU4           sql.NullInt64  `json:"distance_km_u4"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+}
+
+// Returns what the ETA prediction needs to know about a run
+func (q *Queries) GetRunPredictionContext(ctx context.Context, runID string) (GetRunPredictionContextRow, error) {
+	row := q.db.QueryRowContext(ctx, getRunPredictionContext, runID)
+	var i GetRunPredictionContextRow
+	err := row.Scan(
+		&i.RunID,
+		&i.TrainNo,
+		&i.RunDate,
+		&i.ScheduleID,
+		&i.OriginSchDepartureMin,
+		&i.HasStarted,
+		&i.HasArrived,
+		&i.DistanceKmU4,
+		&i.LastUpdateTimestampIso,
+	)
+	return i, err
+}
+
+const getRunState = `-- name: GetRunState :one
+SELECT
+    run_id,
+    has_started,
+    has_arrived,
+    current_status,
+    last_updated_sno,
+    last_known_lat_u6 AS lat_u6,
+    last_known_lng_u6 AS lng_u6,
+    last_known_snapped_lat_u6 AS snapped_lat_u6,
+    last_known_snapped_lng_u6 AS snapped_lng_u6,
+    last_known_distance_km_u4 AS distance_km_u4,
+    last_bearing_deg AS bearing_deg,
+    last_update_timestamp_ISO
+FROM train_runs
+WHERE run_id = ?1
+`
+
+type GetRunStateRow struct {
+	RunID                  string         `json:"run_id"`
+	HasStarted             int64          `json:"has_started"`
+	HasArrived             int64          `json:"has_arrived"`
+	CurrentStatus          string         `json:"current_status"`
+	LastUpdatedSno         sql.NullString `json:"last_updated_sno"`
+	LatU6                  sql.NullInt64  `json:"lat_u6"`
+	LngU6                  sql.NullInt64  `json:"lng_u6"`
+	SnappedLatU6           sql.NullInt64  `json:"snapped_lat_u6"`
+	SnappedLngU6           sql.NullInt64  `json:"snapped_lng_u6"`
+	DistanceKmU4           sql.NullInt64  `json:"distance_km_u4"`
+	BearingDeg             sql.NullInt64  `json:"bearing_deg"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+}
+
+// Returns the live fields of one run, watched by the run event stream
+func (q *Queries) GetRunState(ctx context.Context, runID string) (GetRunStateRow, error) {
+	row := q.db.QueryRowContext(ctx, getRunState, runID)
+	var i GetRunStateRow
+	err := row.Scan(
+		&i.RunID,
+		&i.HasStarted,
+		&i.HasArrived,
+		&i.CurrentStatus,
+		&i.LastUpdatedSno,
+		&i.LatU6,
+		&i.LngU6,
+		&i.SnappedLatU6,
+		&i.SnappedLngU6,
+		&i.DistanceKmU4,
+		&i.BearingDeg,
+		&i.LastUpdateTimestampIso,
+	)
+	return i, err
+}
+
+const getScheduleShape = `-- name: GetScheduleShape :one
+SELECT
+    ts.schedule_id,
+    ts.train_no,
+    AsGeoJSON(ST_Transform(trg.route_geom, 4326), 6) AS geojson
+FROM train_schedules ts
+LEFT JOIN train_route_geometries trg ON trg.schedule_id = ts.schedule_id
+WHERE ts.schedule_id = ?1
+`
+
+type GetScheduleShapeRow struct {
+	ScheduleID int64          `json:"schedule_id"`
+	TrainNo    int64          `json:"train_no"`
+	Geojson    sql.NullString `json:"geojson"`
+}
+
+// Returns the snapping geometry of a schedule as GeoJSON in WGS84, NULL when it has none
+func (q *Queries) GetScheduleShape(ctx context.Context, scheduleID int64) (GetScheduleShapeRow, error) {
+	row := q.db.QueryRowContext(ctx, getScheduleShape, scheduleID)
+	var i GetScheduleShapeRow
+	err := row.Scan(
+		&i.ScheduleID,
+		&i.TrainNo,
+		&i.Geojson,
+	)
+	return i, err
+}
+
+const getSegmentStats = `-- name: GetSegmentStats :one
+SELECT
+    from_station_code,
+    to_station_code,
+    distance_km,
+    samples,
+    avg_speed_kmh,
+    min_speed_kmh,
+    max_speed_kmh,
+    avg_runtime_min,
+    updated_at
+FROM segment_stats
+WHERE from_station_code = ?1
+  AND to_station_code = ?2
+`
+
+type GetSegmentStatsParams struct {
+	FromStationCode string `json:"from_station_code"`
+	ToStationCode   string `json:"to_station_code"`
+}
+
+func (q *Queries) GetSegmentStats(ctx context.Context, arg GetSegmentStatsParams) (SegmentStat, error) {
+	row := q.db.QueryRowContext(ctx, getSegmentStats, arg.FromStationCode, arg.ToStationCode)
+	var i SegmentStat
+	err := row.Scan(
+		&i.FromStationCode,
+		&i.ToStationCode,
+		&i.DistanceKm,
+		&i.Samples,
+		&i.AvgSpeedKmh,
+		&i.MinSpeedKmh,
+		&i.MaxSpeedKmh,
+		&i.AvgRuntimeMin,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getStation = `-- name: GetStation :one
+SELECT
+    station_code,
+    station_name,
+    zone,
+    division,
+    address,
+    elevation_m,
+    lat,
+    lng,
+    number_of_platforms,
+    station_type,
+    station_category,
+    track_type
+FROM stations
+WHERE station_code = ?1
+`
+
+type GetStationRow struct {
+	StationCode       string          `json:"station_code"`
+	StationName       string          `json:"station_name"`
+	Zone              sql.NullString  `json:"zone"`
+	Division          sql.NullString  `json:"division"`
+	Address           sql.NullString  `json:"address"`
+	ElevationM        sql.NullFloat64 `json:"elevation_m"`
+	Lat               sql.NullFloat64 `json:"lat"`
+	Lng               sql.NullFloat64 `json:"lng"`
+	NumberOfPlatforms sql.NullInt64   `json:"number_of_platforms"`
+	StationType       sql.NullString  `json:"station_type"`
+	StationCategory   sql.NullString  `json:"station_category"`
+	TrackType         sql.NullString  `json:"track_type"`
+}
+
+// Returns one station by code
+func (q *Queries) GetStation(ctx context.Context, stationCode string) (GetStationRow, error) {
+	row := q.db.QueryRowContext(ctx, getStation, stationCode)
+	var i GetStationRow
+	err := row.Scan(
+		&i.StationCode,
+		&i.StationName,
+		&i.Zone,
+		&i.Division,
+		&i.Address,
+		&i.ElevationM,
+		&i.Lat,
+		&i.Lng,
+		&i.NumberOfPlatforms,
+		&i.StationType,
+		&i.StationCategory,
+		&i.TrackType,
+	)
+	return i, err
+}
+
+const getStationBoard = `-- name: GetStationBoard :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_arrival_min_from_start)) AS TEXT) AS sch_arrival,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) AS TEXT) AS sch_departure,
+    rt.distance_km,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    p.platform,
+    p.platform_info
+FROM train_routes rt
+JOIN train_schedules ts ON rt.schedule_id = ts.schedule_id
+JOIN train_runs tr ON tr.schedule_id = ts.schedule_id
+JOIN trains t ON tr.train_no = t.train_no
+LEFT JOIN train_run_platforms p ON p.run_id = tr.run_id AND p.station_code = rt.station_code
+WHERE rt.station_code = ?1
+  AND rt.stops = 1
+  AND tr.run_date BETWEEN date(?2, '-3 days') AND ?2
+  AND date(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) = ?2
+ORDER BY sch_departure
+`
+
+type GetStationBoardParams struct {
+	StationCode string      `json:"station_code"`
+	BoardDate   interface{} `json:"board_date"`
+}
+
+type GetStationBoardRow struct {
+	RunID               string         `json:"run_id"`
+	TrainNo             int64          `json:"train_no"`
+	TrainName           string         `json:"train_name"`
+	TrainType           string         `json:"train_type"`
+	OriginStationCode   string         `json:"origin_station_code"`
+	TerminusStationCode string         `json:"terminus_station_code"`
+	SchArrival          string         `json:"sch_arrival"`
+	SchDeparture        string         `json:"sch_departure"`
+	DistanceKm          float64        `json:"distance_km"`
+	HasStarted          int64          `json:"has_started"`
+	HasArrived          int64          `json:"has_arrived"`
+	CurrentStatus       interface{}    `json:"current_status"`
+	Platform            sql.NullString `json:"platform"`
+	PlatformInfo        sql.NullString `json:"platform_info"`
+}
+
+// Returns runs calling at a station with a scheduled departure on the given date
+func (q *Queries) GetStationBoard(ctx context.Context, arg GetStationBoardParams) ([]GetStationBoardRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStationBoard, arg.StationCode, arg.BoardDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetStationBoardRow{}
+	for rows.Next() {
+		var i GetStationBoardRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.SchArrival,
+			&i.SchDeparture,
+			&i.DistanceKm,
+			&i.HasStarted,
+			&i.HasArrived,
+			&i.CurrentStatus,
+			&i.Platform,
+			&i.PlatformInfo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStationLiveBoard = `-- name: GetStationLiveBoard :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_arrival_min_from_start)) AS TEXT) AS sch_arrival,
+    CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) AS TEXT) AS sch_departure,
+    rt.distance_km,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    e.act_arrival_tm,
+    e.act_departure_tm,
+    CAST(COALESCE(e.departed, 0) AS INTEGER) AS departed,
+    (
+        SELECT COALESCE(d.delay_departure_min, d.delay_arrival_min)
+        FROM train_run_station_events d
+        WHERE d.run_id = tr.run_id
+          AND COALESCE(d.delay_departure_min, d.delay_arrival_min) IS NOT NULL
+        ORDER BY d.sno DESC
+        LIMIT 1
+    ) AS current_delay_min,
+    p.platform,
+    p.platform_info
+FROM train_routes rt
+JOIN train_schedules ts ON rt.schedule_id = ts.schedule_id
+JOIN train_runs tr ON tr.schedule_id = ts.schedule_id
+JOIN trains t ON tr.train_no = t.train_no
+LEFT JOIN train_run_station_events e ON e.run_id = tr.run_id AND e.station_code = rt.station_code
+LEFT JOIN train_run_platforms p ON p.run_id = tr.run_id AND p.station_code = rt.station_code
+WHERE rt.station_code = ?1
+  AND rt.stops = 1
+  AND tr.run_date BETWEEN date(?2, '-3 days') AND date(?3)
+  AND datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) BETWEEN ?2 AND ?3
+ORDER BY sch_departure
+`
+
+type GetStationLiveBoardParams struct {
+	StationCode string `json:"station_code"`
+	FromTime    string `json:"from_time"`
+	ToTime      string `json:"to_time"`
+}
+
+type GetStationLiveBoardRow struct {
+	RunID               string         `json:"run_id"`
+	TrainNo             int64          `json:"train_no"`
+	TrainName           string         `json:"train_name"`
+	TrainType           string         `json:"train_type"`
+	OriginStationCode   string         `json:"origin_station_code"`
+	TerminusStationCode string         `json:"terminus_station_code"`
+	SchArrival          string         `json:"sch_arrival"`
+	SchDeparture        string         `json:"sch_departure"`
+	DistanceKm          float64        `json:"distance_km"`
+	HasStarted          int64          `json:"has_started"`
+	HasArrived          int64          `json:"has_arrived"`
+	CurrentStatus       interface{}    `json:"current_status"`
+	ActArrivalTm        sql.NullInt64  `json:"act_arrival_tm"`
+	ActDepartureTm      sql.NullInt64  `json:"act_departure_tm"`
+	Departed            int64          `json:"departed"`
+	CurrentDelayMin     sql.NullInt64  `json:"current_delay_min"`
+	Platform            sql.NullString `json:"platform"`
+	PlatformInfo        sql.NullString `json:"platform_info"`
+}
+
+// Returns runs calling at a station scheduled to depart between from_time and to_time
+// (local, YYYY-MM-DD HH:MM:SS) with what is known live: the actuals recorded at this
+// station and the run's latest reported delay
+func (q *Queries) GetStationLiveBoard(ctx context.Context, arg GetStationLiveBoardParams) ([]GetStationLiveBoardRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStationLiveBoard, arg.StationCode, arg.FromTime, arg.ToTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetStationLiveBoardRow{}
+	for rows.Next() {
+		var i GetStationLiveBoardRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.SchArrival,
+			&i.SchDeparture,
+			&i.DistanceKm,
+			&i.HasStarted,
+			&i.HasArrived,
+			&i.CurrentStatus,
+			&i.ActArrivalTm,
+			&i.ActDepartureTm,
+			&i.Departed,
+			&i.CurrentDelayMin,
+			&i.Platform,
+			&i.PlatformInfo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrain = `-- name: GetTrain :one
+SELECT
+    train_no,
+    train_name,
+    train_type,
+    zone,
+    return_train_no
+FROM trains
+WHERE train_no = ?1
+`
+
+type GetTrainRow struct {
+	TrainNo       int64          `json:"train_no"`
+	TrainName     string         `json:"train_name"`
+	TrainType     string         `json:"train_type"`
+	Zone          sql.NullString `json:"zone"`
+	ReturnTrainNo sql.NullInt64  `json:"return_train_no"`
+}
+
+// Returns one train by number
+func (q *Queries) GetTrain(ctx context.Context, trainNo int64) (GetTrainRow, error) {
+	row := q.db.QueryRowContext(ctx, getTrain, trainNo)
+	var i GetTrainRow
+	err := row.Scan(
+		&i.TrainNo,
+		&i.TrainName,
+		&i.TrainType,
+		&i.Zone,
+		&i.ReturnTrainNo,
+	)
+	return i, err
+}
+
+const getTrainRake = `-- name: GetTrainRake :one
+SELECT
+    train_no,
+    train_name,
+    train_type,
+    coachComposition,
+    updated_at
+FROM trains
+WHERE train_no = ?1
+`
+
+type GetTrainRakeRow struct {
+	TrainNo          int64          `json:"train_no"`
+	TrainName        string         `json:"train_name"`
+	TrainType        string         `json:"train_type"`
+	Coachcomposition sql.NullString `json:"coachcomposition"`
+	UpdatedAt        sql.NullString `json:"updated_at"`
+}
+
+// Returns a train with its scraped coach composition
+func (q *Queries) GetTrainRake(ctx context.Context, trainNo int64) (GetTrainRakeRow, error) {
+	row := q.db.QueryRowContext(ctx, getTrainRake, trainNo)
+	var i GetTrainRakeRow
+	err := row.Scan(
+		&i.TrainNo,
+		&i.TrainName,
+		&i.TrainType,
+		&i.Coachcomposition,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getTrainSourceURL = `-- name: GetTrainSourceURL :one
+SELECT source_url
+FROM (
+    SELECT source_url, 0 AS pref FROM tracked_trains WHERE train_no = ?1
+    UNION ALL
+    SELECT source_url, 1 AS pref FROM trains WHERE train_no = ?1
+)
+ORDER BY pref
+LIMIT 1
+`
+
+// tracked pages first, a train added there may not have been synced yet
+func (q *Queries) GetTrainSourceURL(ctx context.Context, trainNo int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, getTrainSourceURL, trainNo)
+	var source_url string
+	err := row.Scan(&source_url)
+	return source_url, err
+}
+
+const listBunchedHeadways = `-- name: ListBunchedHeadways :many
+SELECT
+    h.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    h.next_station_code,
+    h.samples,
+    h.min_headway_min,
+    h.avg_headway_min,
+    h.max_headway_min,
+    h.bunched,
+    CAST(100.0 * h.bunched / h.samples AS REAL) AS bunched_pct
+FROM headway_stats h
+LEFT JOIN stations s ON h.station_code = s.station_code
+WHERE h.samples >= ?1
+ORDER BY bunched_pct DESC, h.avg_headway_min
+LIMIT ?2
+`
+
+type ListBunchedHeadwaysParams struct {
+	MinSamples int64 `json:"min_samples"`
+	Limit      int64 `json:"limit"`
+}
+
+type ListBunchedHeadwaysRow struct {
+	StationCode     string  `json:"station_code"`
+	StationName     string  `json:"station_name"`
+	NextStationCode string  `json:"next_station_code"`
+	Samples         int64   `json:"samples"`
+	MinHeadwayMin   float64 `json:"min_headway_min"`
+	AvgHeadwayMin   float64 `json:"avg_headway_min"`
+	MaxHeadwayMin   float64 `json:"max_headway_min"`
+	Bunched         int64   `json:"bunched"`
+	BunchedPct      float64 `json:"bunched_pct"`
+}
+
+// Ranks busy station directions by share of bunched headways
+func (q *Queries) ListBunchedHeadways(ctx context.Context, arg ListBunchedHeadwaysParams) ([]ListBunchedHeadwaysRow, error) {
+	rows, err := q.db.QueryContext(ctx, listBunchedHeadways, arg.MinSamples, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListBunchedHeadwaysRow{}
+	for rows.Next() {
+		var i ListBunchedHeadwaysRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.StationName,
+			&i.NextStationCode,
+			&i.Samples,
+			&i.MinHeadwayMin,
+			&i.AvgHeadwayMin,
+			&i.MaxHeadwayMin,
+			&i.Bunched,
+			&i.BunchedPct,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCongestedStations = `-- name: ListCongestedStations :many
+SELECT
+    c.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    CAST(MAX(c.peak_trains) AS INTEGER) AS peak_trains,
+    CAST(AVG(c.avg_trains) AS REAL) AS avg_trains,
+    CAST(SUM(c.trains) AS INTEGER) AS train_hours
+FROM station_congestion_hourly c
+LEFT JOIN stations s ON c.station_code = s.station_code
+WHERE c.obs_date >= ?1
+GROUP BY c.station_code
+ORDER BY peak_trains DESC, avg_trains DESC
+LIMIT ?2
+`
+
+type ListCongestedStationsParams struct {
+	SinceDate string `json:"since_date"`
+	Limit     int64  `json:"limit"`
+}
+
+type ListCongestedStationsRow struct {
+	StationCode string  `json:"station_code"`
+	StationName string  `json:"station_name"`
+	PeakTrains  int64   `json:"peak_trains"`
+	AvgTrains   float64 `json:"avg_trains"`
+	TrainHours  int64   `json:"train_hours"`
+}
+
+// Ranks stations by peak and average occupancy since the given date
+func (q *Queries) ListCongestedStations(ctx context.Context, arg ListCongestedStationsParams) ([]ListCongestedStationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listCongestedStations, arg.SinceDate, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListCongestedStationsRow{}
+	for rows.Next() {
+		var i ListCongestedStationsRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.StationName,
+			&i.PeakTrains,
+			&i.AvgTrains,
+			&i.TrainHours,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDailyStationSummaries = `-- name: ListDailyStationSummaries :many
+SELECT
+    d.summary_date,
+    d.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    d.trains,
+    d.on_time_trains,
+    d.avg_delay_min,
+    d.max_delay_min
+FROM daily_station_summaries d
+LEFT JOIN stations s ON d.station_code = s.station_code
+WHERE d.summary_date = ?1
+ORDER BY d.trains DESC, d.station_code
+`
+
+type ListDailyStationSummariesRow struct {
+	SummaryDate  string          `json:"summary_date"`
+	StationCode  string          `json:"station_code"`
+	StationName  string          `json:"station_name"`
+	Trains       int64           `json:"trains"`
+	OnTimeTrains int64           `json:"on_time_trains"`
+	AvgDelayMin  sql.NullFloat64 `json:"avg_delay_min"`
+	MaxDelayMin  sql.NullInt64   `json:"max_delay_min"`
+}
+
+func (q *Queries) ListDailyStationSummaries(ctx context.Context, summaryDate string) ([]ListDailyStationSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDailyStationSummaries, summaryDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListDailyStationSummariesRow{}
+	for rows.Next() {
+		var i ListDailyStationSummariesRow
+		if err := rows.Scan(
+			&i.SummaryDate,
+			&i.StationCode,
+			&i.StationName,
+			&i.Trains,
+			&i.OnTimeTrains,
+			&i.AvgDelayMin,
+			&i.MaxDelayMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDailyTrainSummaries = `-- name: ListDailyTrainSummaries :many
+SELECT
+    d.summary_date,
+    d.train_no,
+    t.train_name,
+    t.train_type,
+    d.runs,
+    d.completed_runs,
+    d.cancelled_runs,
+    d.tracked_runs,
+    d.on_time_runs,
+    d.avg_delay_min,
+    d.avg_terminal_delay_min,
+    d.coverage_pct
+FROM daily_train_summaries d
+JOIN trains t ON d.train_no = t.train_no
+WHERE d.summary_date = ?1
+ORDER BY d.train_no
+`
+
+type ListDailyTrainSummariesRow struct {
+	SummaryDate         string          `json:"summary_date"`
+	TrainNo             int64           `json:"train_no"`
+	TrainName           string          `json:"train_name"`
+	TrainType           string          `json:"train_type"`
+	Runs                int64           `json:"runs"`
+	CompletedRuns       int64           `json:"completed_runs"`
+	CancelledRuns       int64           `json:"cancelled_runs"`
+	TrackedRuns         int64           `json:"tracked_runs"`
+	OnTimeRuns          int64           `json:"on_time_runs"`
+	AvgDelayMin         sql.NullFloat64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin sql.NullFloat64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64         `json:"coverage_pct"`
+}
+
+func (q *Queries) ListDailyTrainSummaries(ctx context.Context, summaryDate string) ([]ListDailyTrainSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDailyTrainSummaries, summaryDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListDailyTrainSummariesRow{}
+	for rows.Next() {
+		var i ListDailyTrainSummariesRow
+		if err := rows.Scan(
+			&i.SummaryDate,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.Runs,
+			&i.CompletedRuns,
+			&i.CancelledRuns,
+			&i.TrackedRuns,
+			&i.OnTimeRuns,
+			&i.AvgDelayMin,
+			&i.AvgTerminalDelayMin,
+			&i.CoveragePct,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDailyZoneSummaries = `-- name: ListDailyZoneSummaries :many
+SELECT
+    summary_date,
+    zone,
+    trains,
+    runs,
+    completed_runs,
+    cancelled_runs,
+    tracked_runs,
+    on_time_runs,
+    avg_delay_min,
+    avg_terminal_delay_min,
+    coverage_pct
+FROM daily_zone_summaries
+WHERE summary_date = ?1
+ORDER BY zone
+`
+
+type ListDailyZoneSummariesRow struct {
+	SummaryDate         string          `json:"summary_date"`
+	Zone                string          `json:"zone"`
+	Trains              int64           `json:"trains"`
+	Runs                int64           `json:"runs"`
+	CompletedRuns       int64           `json:"completed_runs"`
+	CancelledRuns       int64           `json:"cancelled_runs"`
+	TrackedRuns         int64           `json:"tracked_runs"`
+	OnTimeRuns          int64           `json:"on_time_runs"`
+	AvgDelayMin         sql.NullFloat64 `json:"avg_delay_min"`
+	AvgTerminalDelayMin sql.NullFloat64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64         `json:"coverage_pct"`
+}
+
+func (q *Queries) ListDailyZoneSummaries(ctx context.Context, summaryDate string) ([]ListDailyZoneSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDailyZoneSummaries, summaryDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListDailyZoneSummariesRow{}
+	for rows.Next() {
+		var i ListDailyZoneSummariesRow
+		if err := rows.Scan(
+			&i.SummaryDate,
+			&i.Zone,
+			&i.Trains,
+			&i.Runs,
+			&i.CompletedRuns,
+			&i.CancelledRuns,
+			&i.TrackedRuns,
+			&i.OnTimeRuns,
+			&i.AvgDelayMin,
+			&i.AvgTerminalDelayMin,
+			&i.CoveragePct,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listJourneyTimes = `-- name: ListJourneyTimes :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    tr.run_date,
+    CAST(b.act_arrival_tm - a.act_departure_tm AS INTEGER) AS journey_sec,
+    CAST(b.sch_arrival_tm - a.sch_departure_tm AS INTEGER) AS scheduled_sec
+FROM train_run_station_events a
+JOIN train_run_station_events b ON b.run_id = a.run_id AND b.sno > a.sno
+JOIN train_runs tr ON a.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE a.station_code = ?1
+  AND b.station_code = ?2
+  AND tr.run_date >= ?3
+  AND (?4 = 0 OR tr.train_no = ?4)
+  AND (?5 = 0 OR tr.quality_score >= ?5)
+  AND a.act_departure_tm IS NOT NULL
+  AND b.act_arrival_tm > a.act_departure_tm
+  AND a.sch_departure_tm IS NOT NULL
+  AND b.sch_arrival_tm IS NOT NULL
+ORDER BY tr.train_no, tr.run_date
+`
+
+type ListJourneyTimesParams struct {
+	FromCode   string      `json:"from_code"`
+	ToCode     string      `json:"to_code"`
+	SinceDate  string      `json:"since_date"`
+	TrainNo    interface{} `json:"train_no"`
+	MinQuality interface{} `json:"min_quality"`
+}
+
+type ListJourneyTimesRow struct {
+	RunID        string `json:"run_id"`
+	TrainNo      int64  `json:"train_no"`
+	TrainName    string `json:"train_name"`
+	RunDate      string `json:"run_date"`
+	JourneySec   int64  `json:"journey_sec"`
+	ScheduledSec int64  `json:"scheduled_sec"`
+}
+
+// Returns observed and scheduled journey times between two stations for runs since the
+// given date that departed the first and later arrived at the second, optionally for one train
+func (q *Queries) ListJourneyTimes(ctx context.Context, arg ListJourneyTimesParams) ([]ListJourneyTimesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listJourneyTimes,
+		arg.FromCode,
+		arg.ToCode,
+		arg.SinceDate,
+		arg.TrainNo,
+		arg.MinQuality,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListJourneyTimesRow{}
+	for rows.Next() {
+		var i ListJourneyTimesRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.RunDate,
+			&i.JourneySec,
+			&i.ScheduledSec,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLiveChangesSince = `-- name: ListLiveChangesSince :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.has_arrived,
+    0 AS went_stale
+FROM train_runs tr
+WHERE tr.updated_at >= ?1
+UNION ALL
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.has_arrived,
+    1 AS went_stale
+FROM train_runs tr
+WHERE tr.has_arrived = 0
+  AND datetime(tr.last_update_timestamp_iso) > datetime(?1, '-15 minutes')
+  AND datetime(tr.last_update_timestamp_iso) <= datetime('now', '-15 minutes')
+ORDER BY 2, 1
+`
+
+type ListLiveChangesSinceRow struct {
+	RunID      string `json:"run_id"`
+	TrainNo    int64  `json:"train_no"`
+	HasArrived int64  `json:"has_arrived"`
+	WentStale  int64  `json:"went_stale"`
+}
+
+// Runs written since @since (UTC, CURRENT_TIMESTAMP format) and live runs that went stale
+// in the meantime, for working out a delta against a client's last snapshot
+func (q *Queries) ListLiveChangesSince(ctx context.Context, since string) ([]ListLiveChangesSinceRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLiveChangesSince, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListLiveChangesSinceRow{}
+	for rows.Next() {
+		var i ListLiveChangesSinceRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.HasArrived,
+			&i.WentStale,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLiveRouteShapes = `-- name: ListLiveRouteShapes :many
+WITH live AS (
+    SELECT tr.train_no, tr.schedule_id
+    FROM train_runs tr
+    WHERE tr.has_arrived = 0
+      AND tr.last_known_snapped_lat_u6 IS NOT NULL
+      AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+),
+overlapping AS (
+    SELECT l.train_no, l.schedule_id
+    FROM live l
+    JOIN train_routes rt ON rt.schedule_id = l.schedule_id
+    JOIN stations s ON s.station_code = rt.station_code
+    WHERE s.lat IS NOT NULL AND s.lng IS NOT NULL
+    GROUP BY l.train_no, l.schedule_id
+    HAVING MAX(s.lat) >= ?1 AND MIN(s.lat) <= ?2
+       AND MAX(s.lng) >= ?3 AND MIN(s.lng) <= ?4
+)
+SELECT
+    o.train_no,
+    CAST(s.lat AS REAL) AS lat,
+    CAST(s.lng AS REAL) AS lng
+FROM overlapping o
+JOIN train_routes rt ON rt.schedule_id = o.schedule_id
+JOIN stations s ON s.station_code = rt.station_code
+WHERE s.lat IS NOT NULL AND s.lng IS NOT NULL
+ORDER BY o.train_no, rt.distance_km
+`
+
+type ListLiveRouteShapesParams struct {
+	MinLat float64 `json:"min_lat"`
+	MaxLat float64 `json:"max_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+type ListLiveRouteShapesRow struct {
+	TrainNo int64   `json:"train_no"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+}
+
+// Returns the stops with coordinates, in route order, of live runs whose route
+// overlaps the given box
+func (q *Queries) ListLiveRouteShapes(ctx context.Context, arg ListLiveRouteShapesParams) ([]ListLiveRouteShapesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLiveRouteShapes,
+		arg.MinLat,
+		arg.MaxLat,
+		arg.MinLng,
+		arg.MaxLng,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListLiveRouteShapesRow{}
+	for rows.Next() {
+		var i ListLiveRouteShapesRow
+		if err := rows.Scan(
+			&i.TrainNo,
+			&i.Lat,
+			&i.Lng,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLocationsBetween = `-- name: ListLocationsBetween :many
+SELECT
+    l.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    l.lat_u6,
+    l.lng_u6,
+    l.snapped_lat_u6,
+    l.snapped_lng_u6,
+    l.distance_km_u4,
+    l.segment_station_code,
+    l.at_station,
+    l.timestamp_ISO
+FROM train_run_locations l
+JOIN train_runs tr ON l.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE l.timestamp_ISO BETWEEN ?1 AND ?2
+  AND (?3 = 0 OR tr.quality_score >= ?3)
+ORDER BY l.run_id, l.timestamp_ISO
+`
+
+type ListLocationsBetweenParams struct {
+	FromTs     string      `json:"from_ts"`
+	ToTs       string      `json:"to_ts"`
+	MinQuality interface{} `json:"min_quality"`
+}
+
+type ListLocationsBetweenRow struct {
+	RunID              string        `json:"run_id"`
+	TrainNo            int64         `json:"train_no"`
+	TrainName          string        `json:"train_name"`
+	TrainType          string        `json:"train_type"`
+	LatU6              int64         `json:"lat_u6"`
+	LngU6              int64         `json:"lng_u6"`
+	SnappedLatU6       sql.NullInt64 `json:"snapped_lat_u6"`
+	SnappedLngU6       sql.NullInt64 `json:"snapped_lng_u6"`
+	DistanceKmU4       int64         `json:"distance_km_u4"`
+	SegmentStationCode string        `json:"segment_station_code"`
+	AtStation          int64         `json:"at_station"`
+	TimestampIso       string        `json:"timestamp_iso"`
+}
+
+// Returns every logged fix in [from_ts, to_ts] grouped by run, timestamps compared as text
+func (q *Queries) ListLocationsBetween(ctx context.Context, arg ListLocationsBetweenParams) ([]ListLocationsBetweenRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLocationsBetween, arg.FromTs, arg.ToTs, arg.MinQuality)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListLocationsBetweenRow{}
+	for rows.Next() {
+		var i ListLocationsBetweenRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.LatU6,
+			&i.LngU6,
+			&i.SnappedLatU6,
+			&i.SnappedLngU6,
+			&i.DistanceKmU4,
+			&i.SegmentStationCode,
+			&i.AtStation,
+			&i.TimestampIso,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listNearbyStations = `-- name: ListNearbyStations :many
+WITH near AS (
+    SELECT
+        s.station_code,
+        s.station_name,
+        s.zone,
+        s.division,
+        s.lat,
+        s.lng,
+        s.number_of_platforms,
+        s.station_type,
+        s.station_category,
+        ST_Distance(s.geom, MakePoint(?1, ?2, 4326), 1) AS distance_m
+    FROM stations s
+    WHERE s.rowid IN (
+        SELECT rowid
+        FROM SpatialIndex
+        WHERE f_table_name = 'stations'
+          AND f_geometry_column = 'geom'
+          AND search_frame = BuildMbr(?3, ?4, ?5, ?6, 4326)
+    )
+)
+SELECT
+    station_code,
+    station_name,
+    zone,
+    division,
+    lat,
+    lng,
+    number_of_platforms,
+    station_type,
+    station_category,
+    CAST(distance_m AS REAL) AS distance_m
+FROM near
+WHERE distance_m <= ?7
+ORDER BY distance_m, station_code
+LIMIT ?8
+`
+
+type ListNearbyStationsParams struct {
+	Lng     float64 `json:"lng"`
+	Lat     float64 `json:"lat"`
+	MinLng  float64 `json:"min_lng"`
+	MinLat  float64 `json:"min_lat"`
+	MaxLng  float64 `json:"max_lng"`
+	MaxLat  float64 `json:"max_lat"`
+	RadiusM float64 `json:"radius_m"`
+	Limit   int64   `json:"limit"`
+}
+
+type ListNearbyStationsRow struct {
+	StationCode       string          `json:"station_code"`
+	StationName       string          `json:"station_name"`
+	Zone              sql.NullString  `json:"zone"`
+	Division          sql.NullString  `json:"division"`
+	Lat               sql.NullFloat64 `json:"lat"`
+	Lng               sql.NullFloat64 `json:"lng"`
+	NumberOfPlatforms sql.NullInt64   `json:"number_of_platforms"`
+	StationType       sql.NullString  `json:"station_type"`
+	StationCategory   sql.NullString  `json:"station_category"`
+	DistanceM         float64         `json:"distance_m"`
+}
+
+// Returns stations within radius_m metres of a point, nearest first. The spatial index
+// narrows the search to the box around the circle, the distance is geodesic.
+func (q *Queries) ListNearbyStations(ctx context.Context, arg ListNearbyStationsParams) ([]ListNearbyStationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listNearbyStations,
+		arg.Lng,
+		arg.Lat,
+		arg.MinLng,
+		arg.MinLat,
+		arg.MaxLng,
+		arg.MaxLat,
+		arg.RadiusM,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListNearbyStationsRow{}
+	for rows.Next() {
+		var i ListNearbyStationsRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.StationName,
+			&i.Zone,
+			&i.Division,
+			&i.Lat,
+			&i.Lng,
+			&i.NumberOfPlatforms,
+			&i.StationType,
+			&i.StationCategory,
+			&i.DistanceM,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listNearbyTrains = `-- name: ListNearbyTrains :many
+WITH near AS (
+    SELECT
+        tr.run_id,
+        tr.train_no,
+        tr.run_date,
+        tr.last_known_snapped_lat_u6,
+        tr.last_known_snapped_lng_u6,
+        tr.last_known_distance_km_u4,
+        tr.last_bearing_deg,
+        tr.current_status,
+        tr.current_delay_min,
+        tr.last_update_timestamp_iso,
+        ST_Distance(
+            MakePoint(tr.last_known_snapped_lng_u6 / 1000000.0, tr.last_known_snapped_lat_u6 / 1000000.0, 4326),
+            MakePoint(?1, ?2, 4326),
+            1
+        ) AS distance_m
+    FROM train_runs tr
+    WHERE tr.has_arrived = 0
+      AND tr.last_known_snapped_lat_u6 BETWEEN ?3 AND ?4
+      AND tr.last_known_snapped_lng_u6 BETWEEN ?5 AND ?6
+      AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+)
+SELECT
+    n.run_id,
+    n.train_no,
+    t.train_name,
+    t.train_type,
+    n.last_known_snapped_lat_u6 AS lat_u6,
+    n.last_known_snapped_lng_u6 AS lng_u6,
+    n.last_known_distance_km_u4 AS distance_km_u4,
+    n.last_bearing_deg AS bearing_deg,
+    n.current_status,
+    n.current_delay_min,
+    n.last_update_timestamp_iso,
+    CAST(n.distance_m AS REAL) AS distance_m
+FROM near n
+JOIN trains t ON n.train_no = t.train_no
+WHERE n.distance_m <= ?7
+  -- alias runs are merged into the canonical run, only that one is shown
+  AND NOT EXISTS (
+    SELECT 1
+    FROM train_aliases ta
+    JOIN train_runs cr
+        ON cr.train_no = ta.train_no
+        AND cr.run_date = n.run_date
+    WHERE ta.alias_train_no = n.train_no
+)
+ORDER BY n.distance_m, n.train_no
+LIMIT ?8
+`
+
+type ListNearbyTrainsParams struct {
+	Lng      float64 `json:"lng"`
+	Lat      float64 `json:"lat"`
+	MinLatU6 int64   `json:"min_lat_u6"`
+	MaxLatU6 int64   `json:"max_lat_u6"`
+	MinLngU6 int64   `json:"min_lng_u6"`
+	MaxLngU6 int64   `json:"max_lng_u6"`
+	RadiusM  float64 `json:"radius_m"`
+	Limit    int64   `json:"limit"`
+}
+
+type ListNearbyTrainsRow struct {
+	RunID                  string         `json:"run_id"`
+	TrainNo                int64          `json:"train_no"`
+	TrainName              string         `json:"train_name"`
+	TrainType              string         `json:"train_type"`
+	LatU6                  sql.NullInt64  `json:"lat_u6"`
+	LngU6                  sql.NullInt64  `json:"lng_u6"`
+	DistanceKmU4           sql.NullInt64  `json:"distance_km_u4"`
+	BearingDeg             sql.NullInt64  `json:"bearing_deg"`
+	CurrentStatus          string         `json:"current_status"`
+	CurrentDelayMin        sql.NullInt64  `json:"current_delay_min"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+	DistanceM              float64        `json:"distance_m"`
+}
+
+// Returns live trains within radius_m metres of a point, nearest first. The box is a
+// cheap prefilter around the circle, the distance is geodesic.
+func (q *Queries) ListNearbyTrains(ctx context.Context, arg ListNearbyTrainsParams) ([]ListNearbyTrainsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listNearbyTrains,
+		arg.Lng,
+		arg.Lat,
+		arg.MinLatU6,
+		arg.MaxLatU6,
+		arg.MinLngU6,
+		arg.MaxLngU6,
+		arg.RadiusM,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListNearbyTrainsRow{}
+	for rows.Next() {
+		var i ListNearbyTrainsRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.LatU6,
+			&i.LngU6,
+			&i.DistanceKmU4,
+			&i.BearingDeg,
+			&i.CurrentStatus,
+			&i.CurrentDelayMin,
+			&i.LastUpdateTimestampIso,
+			&i.DistanceM,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOpenAnomalies = `-- name: ListOpenAnomalies :many
+SELECT
+    a.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    a.kind,
+    a.station_code,
+    s.station_name,
+    tr.last_known_snapped_lat_u6 AS lat_u6,
+    tr.last_known_snapped_lng_u6 AS lng_u6,
+    a.distance_km_u4,
+    a.since_ts,
+    a.detected_at
+FROM run_anomalies a
+JOIN train_runs tr ON a.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+LEFT JOIN stations s ON a.station_code = s.station_code
+WHERE a.resolved_at IS NULL
+ORDER BY datetime(a.since_ts)
+`
+
+type ListOpenAnomaliesRow struct {
+	RunID        string         `json:"run_id"`
+	TrainNo      int64          `json:"train_no"`
+	TrainName    string         `json:"train_name"`
+	TrainType    string         `json:"train_type"`
+	Kind         string         `json:"kind"`
+	StationCode  sql.NullString `json:"station_code"`
+	StationName  sql.NullString `json:"station_name"`
+	LatU6        sql.NullInt64  `json:"lat_u6"`
+	LngU6        sql.NullInt64  `json:"lng_u6"`
+	DistanceKmU4 sql.NullInt64  `json:"distance_km_u4"`
+	SinceTs      string         `json:"since_ts"`
+	DetectedAt   string         `json:"detected_at"`
+}
+
+// Returns unresolved anomalies, longest running first
+func (q *Queries) ListOpenAnomalies(ctx context.Context) ([]ListOpenAnomaliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listOpenAnomalies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListOpenAnomaliesRow{}
+	for rows.Next() {
+		var i ListOpenAnomaliesRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.Kind,
+			&i.StationCode,
+			&i.StationName,
+			&i.LatU6,
+			&i.LngU6,
+			&i.DistanceKmU4,
+			&i.SinceTs,
+			&i.DetectedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPositionsAt = `-- name: ListPositionsAt :many
+WITH latest AS (
+    SELECT
+        l.*,
+        ROW_NUMBER() OVER (PARTITION BY l.run_id ORDER BY l.timestamp_ISO DESC) AS rn
+    FROM train_run_locations l
+    WHERE l.timestamp_ISO BETWEEN ?1 AND ?2
+)
+SELECT
+    l.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    l.lat_u6,
+    l.lng_u6,
+    l.snapped_lat_u6,
+    l.snapped_lng_u6,
+    l.distance_km_u4,
+    l.segment_station_code,
+    l.at_station,
+    l.timestamp_ISO
+FROM latest l
+JOIN train_runs tr ON l.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE l.rn = 1
+  AND (?3 = 0 OR tr.quality_score >= ?3)
+ORDER BY tr.train_no
+`
+
+type ListPositionsAtParams struct {
+	FromTs     string      `json:"from_ts"`
+	AtTs       string      `json:"at_ts"`
+	MinQuality interface{} `json:"min_quality"`
+}
+
+type ListPositionsAtRow struct {
+	RunID              string        `json:"run_id"`
+	TrainNo            int64         `json:"train_no"`
+	TrainName          string        `json:"train_name"`
+	TrainType          string        `json:"train_type"`
+	LatU6              int64         `json:"lat_u6"`
+	LngU6              int64         `json:"lng_u6"`
+	SnappedLatU6       sql.NullInt64 `json:"snapped_lat_u6"`
+	SnappedLngU6       sql.NullInt64 `json:"snapped_lng_u6"`
+	DistanceKmU4       int64         `json:"distance_km_u4"`
+	SegmentStationCode string        `json:"segment_station_code"`
+	AtStation          int64         `json:"at_station"`
+	TimestampIso       string        `json:"timestamp_iso"`
+}
+
+// Returns the latest fix of every run logged in [from_ts, at_ts], timestamps compared as text
+func (q *Queries) ListPositionsAt(ctx context.Context, arg ListPositionsAtParams) ([]ListPositionsAtRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPositionsAt, arg.FromTs, arg.AtTs, arg.MinQuality)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListPositionsAtRow{}
+	for rows.Next() {
+		var i ListPositionsAtRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.LatU6,
+			&i.LngU6,
+			&i.SnappedLatU6,
+			&i.SnappedLngU6,
+			&i.DistanceKmU4,
+			&i.SegmentStationCode,
+			&i.AtStation,
+			&i.TimestampIso,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRakeZonePunctuality = `-- name: ListRakeZonePunctuality :many
+SELECT
+    zone,
+    CAST(MAX(trains) AS INTEGER) AS trains,
+    CAST(SUM(runs) AS INTEGER) AS runs,
+    CAST(SUM(cancelled_runs) AS INTEGER) AS cancelled_runs,
+    CAST(SUM(tracked_runs) AS INTEGER) AS tracked_runs,
+    CAST(SUM(on_time_runs) AS INTEGER) AS on_time_runs,
+    CAST(SUM(COALESCE(avg_terminal_delay_min, 0) * tracked_runs) / MAX(SUM(tracked_runs), 1) AS REAL) AS avg_terminal_delay_min,
+    CAST(SUM(coverage_pct * days) / SUM(days) AS REAL) AS coverage_pct
+FROM (
+    SELECT zone, 1 AS days, trains, runs, cancelled_runs, tracked_runs, on_time_runs, avg_terminal_delay_min, coverage_pct
+    FROM daily_zone_summaries
+    WHERE summary_date >= ?1
+      AND (?2 = '' OR summary_date < ?2)
+    UNION ALL
+    SELECT zone, days, trains, runs, cancelled_runs, tracked_runs, on_time_runs, avg_terminal_delay_min, coverage_pct
+    FROM monthly_zone_summaries
+    WHERE ?2 != ''
+      AND month >= substr(?2, 1, 7)
+)
+GROUP BY zone
+ORDER BY zone
+`
+
+type ListRakeZonePunctualityParams struct {
+	SinceDate  string      `json:"since_date"`
+	RollupFrom interface{} `json:"rollup_from"`
+}
+
+type ListRakeZonePunctualityRow struct {
+	Zone                string  `json:"zone"`
+	Trains              int64   `json:"trains"`
+	Runs                int64   `json:"runs"`
+	CancelledRuns       int64   `json:"cancelled_runs"`
+	TrackedRuns         int64   `json:"tracked_runs"`
+	OnTimeRuns          int64   `json:"on_time_runs"`
+	AvgTerminalDelayMin float64 `json:"avg_terminal_delay_min"`
+	CoveragePct         float64 `json:"coverage_pct"`
+}
+
+// Aggregates zone summaries (by the zone owning the rake) since the given date, reading
+// the monthly rollups from rollup_from on like ListStationGroupPunctuality
+func (q *Queries) ListRakeZonePunctuality(ctx context.Context, arg ListRakeZonePunctualityParams) ([]ListRakeZonePunctualityRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRakeZonePunctuality, arg.SinceDate, arg.RollupFrom)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRakeZonePunctualityRow{}
+	for rows.Next() {
+		var i ListRakeZonePunctualityRow
+		if err := rows.Scan(
+			&i.Zone,
+			&i.Trains,
+			&i.Runs,
+			&i.CancelledRuns,
+			&i.TrackedRuns,
+			&i.OnTimeRuns,
+			&i.AvgTerminalDelayMin,
+			&i.CoveragePct,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunCoverage = `-- name: ListRunCoverage :many
+SELECT
+    CASE ?1
+        WHEN 'train' THEN CAST(c.train_no AS TEXT)
+        WHEN 'run' THEN c.run_id
+        ELSE c.run_date
+    END AS group_key,
+    CAST(COUNT(*) AS INTEGER) AS runs,
+    CAST(SUM(c.polls) AS INTEGER) AS polls,
+    CAST(SUM(c.successful_polls) AS INTEGER) AS successful_polls,
+    CAST(SUM(c.expected_polls) AS INTEGER) AS expected_polls,
+    CAST(SUM(c.location_points) AS INTEGER) AS location_points,
+    CAST(AVG(c.points_per_hour) AS REAL) AS avg_points_per_hour,
+    CAST(SUM(c.gaps) AS INTEGER) AS gaps,
+    CAST(MAX(c.longest_gap_min) AS REAL) AS longest_gap_min,
+    CAST(AVG(c.station_actuals_pct) AS REAL) AS station_actuals_pct
+FROM run_coverage_stats c
+WHERE c.run_date >= ?2
+  AND (?3 = 0 OR c.train_no = ?3)
+GROUP BY 1
+ORDER BY MIN(c.run_date), MIN(c.train_no), 1
+`
+
+type ListRunCoverageParams struct {
+	GroupBy   interface{} `json:"group_by"`
+	SinceDate string      `json:"since_date"`
+	TrainNo   interface{} `json:"train_no"`
+}
+
+type ListRunCoverageRow struct {
+	GroupKey          string          `json:"group_key"`
+	Runs              int64           `json:"runs"`
+	Polls             int64           `json:"polls"`
+	SuccessfulPolls   int64           `json:"successful_polls"`
+	ExpectedPolls     int64           `json:"expected_polls"`
+	LocationPoints    int64           `json:"location_points"`
+	AvgPointsPerHour  sql.NullFloat64 `json:"avg_points_per_hour"`
+	Gaps              int64           `json:"gaps"`
+	LongestGapMin     sql.NullFloat64 `json:"longest_gap_min"`
+	StationActualsPct float64         `json:"station_actuals_pct"`
+}
+
+// Aggregates run coverage since the given date per run date, train or run, optionally for one train
+func (q *Queries) ListRunCoverage(ctx context.Context, arg ListRunCoverageParams) ([]ListRunCoverageRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunCoverage, arg.GroupBy, arg.SinceDate, arg.TrainNo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunCoverageRow{}
+	for rows.Next() {
+		var i ListRunCoverageRow
+		if err := rows.Scan(
+			&i.GroupKey,
+			&i.Runs,
+			&i.Polls,
+			&i.SuccessfulPolls,
+			&i.ExpectedPolls,
+			&i.LocationPoints,
+			&i.AvgPointsPerHour,
+			&i.Gaps,
+			&i.LongestGapMin,
+			&i.StationActualsPct,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunDelayAttribution = `-- name: ListRunDelayAttribution :many
+SELECT
+    a.run_id,
+    tr.train_no,
+    t.train_name,
+    tr.run_date,
+    a.segments,
+    a.gained_min,
+    a.inherited_min,
+    a.own_min
+FROM run_delay_attribution a
+JOIN train_runs tr ON a.run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+WHERE tr.run_date >= ?1
+  AND (?2 = 0 OR tr.train_no = ?2)
+ORDER BY a.inherited_min DESC, a.gained_min DESC
+LIMIT ?3
+`
+
+type ListRunDelayAttributionParams struct {
+	SinceDate string      `json:"since_date"`
+	TrainNo   interface{} `json:"train_no"`
+	Limit     int64       `json:"limit"`
+}
+
+type ListRunDelayAttributionRow struct {
+	RunID        string `json:"run_id"`
+	TrainNo      int64  `json:"train_no"`
+	TrainName    string `json:"train_name"`
+	RunDate      string `json:"run_date"`
+	Segments     int64  `json:"segments"`
+	GainedMin    int64  `json:"gained_min"`
+	InheritedMin int64  `json:"inherited_min"`
+	OwnMin       int64  `json:"own_min"`
+}
+
+// Returns the inherited vs own delay breakdown of runs since the given date, optionally for one train
+func (q *Queries) ListRunDelayAttribution(ctx context.Context, arg ListRunDelayAttributionParams) ([]ListRunDelayAttributionRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunDelayAttribution, arg.SinceDate, arg.TrainNo, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunDelayAttributionRow{}
+	for rows.Next() {
+		var i ListRunDelayAttributionRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.RunDate,
+			&i.Segments,
+			&i.GainedMin,
+			&i.InheritedMin,
+			&i.OwnMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunEncounters = `-- name: ListRunEncounters :many
+SELECT
+    x.kind,
+    x.is_a,
+    x.other_run_id,
+    tr.train_no AS other_train_no,
+    t.train_name AS other_train_name,
+    t.train_type AS other_train_type,
+    x.from_station_code,
+    x.to_station_code,
+    x.encounter_tm
+FROM (
+    SELECT kind, 1 AS is_a, run_id_b AS other_run_id, from_station_code, to_station_code, encounter_tm
+    FROM run_encounters
+    WHERE run_id_a = ?1
+    UNION ALL
+    SELECT kind, 0 AS is_a, run_id_a AS other_run_id, from_station_code, to_station_code, encounter_tm
+    FROM run_encounters
+    WHERE run_id_b = ?1
+) x
+JOIN train_runs tr ON x.other_run_id = tr.run_id
+JOIN trains t ON tr.train_no = t.train_no
+ORDER BY x.encounter_tm
+`
+
+type ListRunEncountersRow struct {
+	Kind            string `json:"kind"`
+	IsA             int64  `json:"is_a"`
+	OtherRunID      string `json:"other_run_id"`
+	OtherTrainNo    int64  `json:"other_train_no"`
+	OtherTrainName  string `json:"other_train_name"`
+	OtherTrainType  string `json:"other_train_type"`
+	FromStationCode string `json:"from_station_code"`
+	ToStationCode   string `json:"to_station_code"`
+	EncounterTm     int64  `json:"encounter_tm"`
+}
+
+// Returns overtakes and crossings involving a run, from its own point of view
+func (q *Queries) ListRunEncounters(ctx context.Context, runID string) ([]ListRunEncountersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunEncounters, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunEncountersRow{}
+	for rows.Next() {
+		var i ListRunEncountersRow
+		if err := rows.Scan(
+			&i.Kind,
+			&i.IsA,
+			&i.OtherRunID,
+			&i.OtherTrainNo,
+			&i.OtherTrainName,
+			&i.OtherTrainType,
+			&i.FromStationCode,
+			&i.ToStationCode,
+			&i.EncounterTm,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunLocations = `-- name: ListRunLocations :many
+SELECT
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = ?1
+ORDER BY timestamp_ISO
+`
+
+type ListRunLocationsRow struct {
+	LatU6              int64         `json:"lat_u6"`
+	LngU6              int64         `json:"lng_u6"`
+	SnappedLatU6       sql.NullInt64 `json:"snapped_lat_u6"`
+	SnappedLngU6       sql.NullInt64 `json:"snapped_lng_u6"`
+	DistanceKmU4       int64         `json:"distance_km_u4"`
+	SegmentStationCode string        `json:"segment_station_code"`
+	AtStation          int64         `json:"at_station"`
+	TimestampIso       string        `json:"timestamp_iso"`
+}
+
+// Returns the logged location history of a run in chronological order
+func (q *Queries) ListRunLocations(ctx context.Context, runID string) ([]ListRunLocationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunLocations, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunLocationsRow{}
+	for rows.Next() {
+		var i ListRunLocationsRow
+		if err := rows.Scan(
+			&i.LatU6,
+			&i.LngU6,
+			&i.SnappedLatU6,
+			&i.SnappedLngU6,
+			&i.DistanceKmU4,
+			&i.SegmentStationCode,
+			&i.AtStation,
+			&i.TimestampIso,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunLocationsPage = `-- name: ListRunLocationsPage :many
+SELECT
+    id,
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = ?1
+  AND (timestamp_ISO > ?2 OR (timestamp_ISO = ?2 AND id > ?3))
+ORDER BY timestamp_ISO, id
+LIMIT ?4
+`
+
+type ListRunLocationsPageParams struct {
+	RunID          string `json:"run_id"`
+	AfterTimestamp string `json:"after_timestamp"`
+	AfterID        int64  `json:"after_id"`
+	Limit          int64  `json:"limit"`
+}
+
+type ListRunLocationsPageRow struct {
+	ID                 int64         `json:"id"`
+	LatU6              int64         `json:"lat_u6"`
+	LngU6              int64         `json:"lng_u6"`
+	SnappedLatU6       sql.NullInt64 `json:"snapped_lat_u6"`
+	SnappedLngU6       sql.NullInt64 `json:"snapped_lng_u6"`
+	DistanceKmU4       int64         `json:"distance_km_u4"`
+	SegmentStationCode string        `json:"segment_station_code"`
+	AtStation          int64         `json:"at_station"`
+	TimestampIso       string        `json:"timestamp_iso"`
+}
+
+// Returns a page of the location history of a run after the (timestamp, id) cursor,
+// an empty after_timestamp starts from the beginning
+func (q *Queries) ListRunLocationsPage(ctx context.Context, arg ListRunLocationsPageParams) ([]ListRunLocationsPageRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunLocationsPage,
+		arg.RunID,
+		arg.AfterTimestamp,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunLocationsPageRow{}
+	for rows.Next() {
+		var i ListRunLocationsPageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.LatU6,
+			&i.LngU6,
+			&i.SnappedLatU6,
+			&i.SnappedLngU6,
+			&i.DistanceKmU4,
+			&i.SegmentStationCode,
+			&i.AtStation,
+			&i.TimestampIso,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunStationEvents = `-- name: ListRunStationEvents :many
+SELECT
+    e.sno,
+    e.station_code,
+    s.station_name,
+    e.distance_km_u4,
+    e.sch_arrival_tm,
+    e.act_arrival_tm,
+    e.sch_departure_tm,
+    e.act_departure_tm,
+    e.delay_arrival_min,
+    e.delay_departure_min,
+    e.departed
+FROM train_run_station_events e
+LEFT JOIN stations s ON e.station_code = s.station_code
+WHERE e.run_id = ?1
+ORDER BY e.sno
+`
+
+type ListRunStationEventsRow struct {
+	Sno               int64          `json:"sno"`
+	StationCode       string         `json:"station_code"`
+	StationName       sql.NullString `json:"station_name"`
+	DistanceKmU4      int64          `json:"distance_km_u4"`
+	SchArrivalTm      sql.NullInt64  `json:"sch_arrival_tm"`
+	ActArrivalTm      sql.NullInt64  `json:"act_arrival_tm"`
+	SchDepartureTm    sql.NullInt64  `json:"sch_departure_tm"`
+	ActDepartureTm    sql.NullInt64  `json:"act_departure_tm"`
+	DelayArrivalMin   sql.NullInt64  `json:"delay_arrival_min"`
+	DelayDepartureMin sql.NullInt64  `json:"delay_departure_min"`
+	Departed          int64          `json:"departed"`
+}
+
+// Returns the recorded per-station actuals and delays of a run along the route
+func (q *Queries) ListRunStationEvents(ctx context.Context, runID string) ([]ListRunStationEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunStationEvents, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunStationEventsRow{}
+	for rows.Next() {
+		var i ListRunStationEventsRow
+		if err := rows.Scan(
+			&i.Sno,
+			&i.StationCode,
+			&i.StationName,
+			&i.DistanceKmU4,
+			&i.SchArrivalTm,
+			&i.ActArrivalTm,
+			&i.SchDepartureTm,
+			&i.ActDepartureTm,
+			&i.DelayArrivalMin,
+			&i.DelayDepartureMin,
+			&i.Departed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunsByDate = `-- name: ListRunsByDate :many
+WITH carried AS (
+    SELECT
+        lr.run_id,
+        MIN(c.run_id) AS carrier_run_id
+    FROM train_runs c
+    JOIN train_links l ON l.train_no = c.train_no
+    JOIN train_runs lr
+        ON lr.train_no = l.linked_train_no
+        AND lr.run_date = c.run_date
+    LEFT JOIN train_routes rf
+        ON rf.schedule_id = c.schedule_id
+        AND rf.station_code = l.from_station_code
+    LEFT JOIN train_routes rt
+        ON rt.schedule_id = c.schedule_id
+        AND rt.station_code = l.to_station_code
+    WHERE c.run_date = ?1
+      AND c.has_arrived = 0
+      AND datetime(c.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+      AND c.last_known_distance_km_u4 >= CAST(COALESCE(rf.distance_km, 0) * 10000 AS INTEGER)
+      AND (rt.distance_km IS NULL OR c.last_known_distance_km_u4 <= CAST(rt.distance_km * 10000 AS INTEGER))
+    GROUP BY lr.run_id
+)
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    tr.run_date,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    COALESCE(c.last_known_snapped_lat_u6, tr.last_known_snapped_lat_u6) AS lat_u6,
+    COALESCE(c.last_known_snapped_lng_u6, tr.last_known_snapped_lng_u6) AS lng_u6,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    tr.last_update_timestamp_ISO,
+    (
+        SELECT a.kind
+        FROM run_anomalies a
+        WHERE a.run_id = tr.run_id
+          AND a.resolved_at IS NULL
+        ORDER BY a.detected_at DESC
+        LIMIT 1
+    ) AS anomaly,
+    tr.quality_score,
+    cr.carrier_run_id AS carried_by
+FROM train_runs tr
+JOIN trains t ON tr.train_no = t.train_no
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+LEFT JOIN carried cr ON cr.run_id = tr.run_id
+LEFT JOIN train_runs c ON c.run_id = cr.carrier_run_id
+WHERE tr.run_date = ?1
+  AND (?2 = 0 OR tr.quality_score >= ?2)
+  AND (
+    ?3 = ''
+    OR (?3 = 'scheduled' AND tr.has_started = 0 AND tr.has_arrived = 0)
+    OR (?3 = 'running' AND tr.has_started = 1 AND tr.has_arrived = 0)
+    OR (?3 = 'completed' AND tr.has_arrived = 1 AND tr.current_status NOT IN ('cancelled', 'not_running_today', 'no_data', 'timed_out'))
+    OR (?3 = 'cancelled' AND tr.current_status IN ('cancelled', 'not_running_today'))
+    OR (?3 = 'no_data' AND tr.current_status IN ('no_data', 'timed_out'))
+  )
+  AND (?4 = -1 OR tr.has_started = ?4)
+  AND NOT EXISTS (
+    SELECT 1
+    FROM train_aliases ta
+    JOIN train_runs ca
+        ON ca.train_no = ta.train_no
+        AND ca.run_date = tr.run_date
+    WHERE ta.alias_train_no = tr.train_no
+  )
+  AND tr.train_no > ?5
+ORDER BY tr.train_no
+LIMIT ?6
+`
+
+type ListRunsByDateParams struct {
+	RunDate      string      `json:"run_date"`
+	MinQuality   interface{} `json:"min_quality"`
+	Status       string      `json:"status"`
+	HasStarted   int64       `json:"has_started"`
+	AfterTrainNo int64       `json:"after_train_no"`
+	Limit        int64       `json:"limit"`
+}
+
+type ListRunsByDateRow struct {
+	RunID                  string         `json:"run_id"`
+	TrainNo                int64          `json:"train_no"`
+	TrainName              string         `json:"train_name"`
+	TrainType              string         `json:"train_type"`
+	RunDate                string         `json:"run_date"`
+	OriginStationCode      string         `json:"origin_station_code"`
+	TerminusStationCode    string         `json:"terminus_station_code"`
+	HasStarted             int64          `json:"has_started"`
+	HasArrived             int64          `json:"has_arrived"`
+	CurrentStatus          interface{}    `json:"current_status"`
+	LatU6                  sql.NullInt64  `json:"lat_u6"`
+	LngU6                  sql.NullInt64  `json:"lng_u6"`
+	DistanceKmU4           sql.NullInt64  `json:"distance_km_u4"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+	Anomaly                sql.NullString `json:"anomaly"`
+	QualityScore           sql.NullInt64  `json:"quality_score"`
+	CarriedBy              sql.NullString `json:"carried_by"`
+}
+
+// Returns a page of runs scheduled to start on the given date after after_train_no,
+// min_quality 0 includes unscored runs, an empty status and has_started -1 include all
+// Linked runs riding a live carrier report the carrier's position and its run as carried_by,
+// runs under an alias number are left out when the canonical run exists
+func (q *Queries) ListRunsByDate(ctx context.Context, arg ListRunsByDateParams) ([]ListRunsByDateRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunsByDate,
+		arg.RunDate,
+		arg.MinQuality,
+		arg.Status,
+		arg.HasStarted,
+		arg.AfterTrainNo,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunsByDateRow{}
+	for rows.Next() {
+		var i ListRunsByDateRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.RunDate,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.HasStarted,
+			&i.HasArrived,
+			&i.CurrentStatus,
+			&i.LatU6,
+			&i.LngU6,
+			&i.DistanceKmU4,
+			&i.LastUpdateTimestampIso,
+			&i.Anomaly,
+			&i.QualityScore,
+			&i.CarriedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunsByIDs = `-- name: ListRunsByIDs :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    tr.run_date,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    tr.has_started,
+    tr.has_arrived,
+    tr.current_status,
+    tr.last_known_snapped_lat_u6 AS lat_u6,
+    tr.last_known_snapped_lng_u6 AS lng_u6,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    tr.last_update_timestamp_ISO,
+    (
+        SELECT a.kind
+        FROM run_anomalies a
+        WHERE a.run_id = tr.run_id
+          AND a.resolved_at IS NULL
+        ORDER BY a.detected_at DESC
+        LIMIT 1
+    ) AS anomaly,
+    tr.quality_score
+FROM train_runs tr
+JOIN trains t ON tr.train_no = t.train_no
+JOIN train_schedules ts ON tr.schedule_id = ts.schedule_id
+WHERE tr.run_id IN (/*SLICE:run_ids*/?)
+`
+
+type ListRunsByIDsRow struct {
+	RunID                  string         `json:"run_id"`
+	TrainNo                int64          `json:"train_no"`
+	TrainName              string         `json:"train_name"`
+	TrainType              string         `json:"train_type"`
+	RunDate                string         `json:"run_date"`
+	OriginStationCode      string         `json:"origin_station_code"`
+	TerminusStationCode    string         `json:"terminus_station_code"`
+	HasStarted             int64          `json:"has_started"`
+	HasArrived             int64          `json:"has_arrived"`
+	CurrentStatus          interface{}    `json:"current_status"`
+	LatU6                  sql.NullInt64  `json:"lat_u6"`
+	LngU6                  sql.NullInt64  `json:"lng_u6"`
+	DistanceKmU4           sql.NullInt64  `json:"distance_km_u4"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+	Anomaly                sql.NullString `json:"anomaly"`
+	QualityScore           sql.NullInt64  `json:"quality_score"`
+}
+
+// Returns the current state of the given runs, ids that do not exist are left out
+func (q *Queries) ListRunsByIDs(ctx context.Context, runIds []string) ([]ListRunsByIDsRow, error) {
+	query := listRunsByIDs
+	var queryParams []interface{}
+	if len(runIds) > 0 {
+		for _, v := range runIds {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:run_ids*/?", strings.Repeat(",?", len(runIds))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:run_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunsByIDsRow{}
+	for rows.Next() {
+		var i ListRunsByIDsRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.RunDate,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.HasStarted,
+			&i.HasArrived,
+			&i.CurrentStatus,
+			&i.LatU6,
+			&i.LngU6,
+			&i.DistanceKmU4,
+			&i.LastUpdateTimestampIso,
+			&i.Anomaly,
+			&i.QualityScore,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScheduleRoute = `-- name: ListScheduleRoute :many
+SELECT
+    rt.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    rt.distance_km,
+    rt.sch_arrival_min_from_start,
+    rt.sch_departure_min_from_start,
+    rt.stops,
+    s.lat,
+    s.lng
+FROM train_routes rt
+LEFT JOIN stations s ON rt.station_code = s.station_code
+WHERE rt.schedule_id = ?1
+ORDER BY rt.distance_km, rt.sch_arrival_min_from_start
+`
+
+type ListScheduleRouteRow struct {
+	StationCode              string          `json:"station_code"`
+	StationName              string          `json:"station_name"`
+	DistanceKm               float64         `json:"distance_km"`
+	SchArrivalMinFromStart   int64           `json:"sch_arrival_min_from_start"`
+	SchDepartureMinFromStart int64           `json:"sch_departure_min_from_start"`
+	Stops                    int64           `json:"stops"`
+	Lat                      sql.NullFloat64 `json:"lat"`
+	Lng                      sql.NullFloat64 `json:"lng"`
+}
+
+// Returns the static route of a schedule in running order
+func (q *Queries) ListScheduleRoute(ctx context.Context, scheduleID int64) ([]ListScheduleRouteRow, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduleRoute, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListScheduleRouteRow{}
+	for rows.Next() {
+		var i ListScheduleRouteRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.StationName,
+			&i.DistanceKm,
+			&i.SchArrivalMinFromStart,
+			&i.SchDepartureMinFromStart,
+			&i.Stops,
+			&i.Lat,
+			&i.Lng,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSchedulesBetween = `-- name: ListSchedulesBetween :many
+SELECT
+    ts.schedule_id,
+    ts.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    ts.origin_sch_departure_min,
+    ts.running_days_bitmap,
+    a.sch_departure_min_from_start AS from_departure_min,
+    b.sch_arrival_min_from_start AS to_arrival_min,
+    CAST(b.distance_km - a.distance_km AS REAL) AS distance_km
+FROM train_routes a
+JOIN train_routes b ON b.schedule_id = a.schedule_id
+JOIN train_schedules ts ON ts.schedule_id = a.schedule_id
+JOIN trains t ON t.train_no = ts.train_no
+WHERE a.station_code = ?1
+  AND b.station_code = ?2
+  AND a.stops = 1
+  AND b.stops = 1
+  AND b.distance_km > a.distance_km
+ORDER BY (ts.origin_sch_departure_min + a.sch_departure_min_from_start) % 1440, ts.train_no
+`
+
+type ListSchedulesBetweenParams struct {
+	FromCode string `json:"from_code"`
+	ToCode   string `json:"to_code"`
+}
+
+type ListSchedulesBetweenRow struct {
+	ScheduleID            int64   `json:"schedule_id"`
+	TrainNo               int64   `json:"train_no"`
+	TrainName             string  `json:"train_name"`
+	TrainType             string  `json:"train_type"`
+	OriginStationCode     string  `json:"origin_station_code"`
+	TerminusStationCode   string  `json:"terminus_station_code"`
+	OriginSchDepartureMin int64   `json:"origin_sch_departure_min"`
+	RunningDaysBitmap     int64   `json:"running_days_bitmap"`
+	FromDepartureMin      int64   `json:"from_departure_min"`
+	ToArrivalMin          int64   `json:"to_arrival_min"`
+	DistanceKm            float64 `json:"distance_km"`
+}
+
+// Returns schedules stopping at from_code and later at to_code, with the minutes from
+// origin departure at both so callers can place them on a date
+func (q *Queries) ListSchedulesBetween(ctx context.Context, arg ListSchedulesBetweenParams) ([]ListSchedulesBetweenRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSchedulesBetween, arg.FromCode, arg.ToCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListSchedulesBetweenRow{}
+	for rows.Next() {
+		var i ListSchedulesBetweenRow
+		if err := rows.Scan(
+			&i.ScheduleID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.OriginSchDepartureMin,
+			&i.RunningDaysBitmap,
+			&i.FromDepartureMin,
+			&i.ToArrivalMin,
+			&i.DistanceKm,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSectionOccupancy = `-- name: ListSectionOccupancy :many
+SELECT
+    p.station_a,
+    COALESCE(sa.station_name, '') AS station_a_name,
+    sa.lat AS station_a_lat,
+    sa.lng AS station_a_lng,
+    p.station_b,
+    COALESCE(sb.station_name, '') AS station_b_name,
+    sb.lat AS station_b_lat,
+    sb.lng AS station_b_lng,
+    COUNT(*) AS trains,
+    CAST(SUM(p.from_code = p.station_a) AS INTEGER) AS trains_a_to_b,
+    CAST(GROUP_CONCAT(p.train_no) AS TEXT) AS train_nos
+FROM (
+    SELECT
+        run_id,
+        train_no,
+        from_code,
+        to_code,
+        CAST(MIN(from_code, to_code) AS TEXT) AS station_a,
+        CAST(MAX(from_code, to_code) AS TEXT) AS station_b
+    FROM (
+        SELECT
+            tr.run_id,
+            tr.train_no,
+            (
+                SELECT r.station_code
+                FROM train_routes r
+                WHERE r.schedule_id = tr.schedule_id
+                  AND r.distance_km <= tr.last_known_distance_km_u4 / 10000.0
+                ORDER BY r.distance_km DESC
+                LIMIT 1
+            ) AS from_code,
+            (
+                SELECT r.station_code
+                FROM train_routes r
+                WHERE r.schedule_id = tr.schedule_id
+                  AND r.distance_km > tr.last_known_distance_km_u4 / 10000.0
+                ORDER BY r.distance_km
+                LIMIT 1
+            ) AS to_code
+        FROM train_runs tr
+        WHERE tr.has_started = 1
+          AND tr.has_arrived = 0
+          AND tr.last_known_distance_km_u4 IS NOT NULL
+          AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+    )
+    WHERE from_code IS NOT NULL
+      AND to_code IS NOT NULL
+) p
+LEFT JOIN stations sa ON p.station_a = sa.station_code
+LEFT JOIN stations sb ON p.station_b = sb.station_code
+GROUP BY p.station_a, p.station_b
+HAVING COUNT(*) >= ?1
+ORDER BY trains DESC, p.station_a, p.station_b
+LIMIT ?2
+`
+
+type ListSectionOccupancyParams struct {
+	MinTrains interface{} `json:"min_trains"`
+	Limit     int64       `json:"limit"`
+}
+
+type ListSectionOccupancyRow struct {
+	StationA     string          `json:"station_a"`
+	StationAName string          `json:"station_a_name"`
+	StationALat  sql.NullFloat64 `json:"station_a_lat"`
+	StationALng  sql.NullFloat64 `json:"station_a_lng"`
+	StationB     string          `json:"station_b"`
+	StationBName string          `json:"station_b_name"`
+	StationBLat  sql.NullFloat64 `json:"station_b_lat"`
+	StationBLng  sql.NullFloat64 `json:"station_b_lng"`
+	Trains       int64           `json:"trains"`
+	TrainsAToB   int64           `json:"trains_a_to_b"`
+	TrainNos     string          `json:"train_nos"`
+}
+
+// Counts live runs per track section, a section being two adjacent stations of a run's
+// route (direction independent) so schedules sharing track share the section
+func (q *Queries) ListSectionOccupancy(ctx context.Context, arg ListSectionOccupancyParams) ([]ListSectionOccupancyRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSectionOccupancy, arg.MinTrains, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListSectionOccupancyRow{}
+	for rows.Next() {
+		var i ListSectionOccupancyRow
+		if err := rows.Scan(
+			&i.StationA,
+			&i.StationAName,
+			&i.StationALat,
+			&i.StationALng,
+			&i.StationB,
+			&i.StationBName,
+			&i.StationBLat,
+			&i.StationBLng,
+			&i.Trains,
+			&i.TrainsAToB,
+			&i.TrainNos,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSlowestSegments = `-- name: ListSlowestSegments :many
+SELECT
+    from_station_code,
+    to_station_code,
+    distance_km,
+    samples,
+    avg_speed_kmh,
+    min_speed_kmh,
+    max_speed_kmh,
+    avg_runtime_min,
+    updated_at
+FROM segment_stats
+WHERE samples >= ?1
+ORDER BY avg_speed_kmh ASC
+LIMIT ?2
+`
+
+type ListSlowestSegmentsParams struct {
+	MinSamples int64 `json:"min_samples"`
+	Limit      int64 `json:"limit"`
+}
+
+// Returns segments ordered by observed average speed, slowest first
+func (q *Queries) ListSlowestSegments(ctx context.Context, arg ListSlowestSegmentsParams) ([]SegmentStat, error) {
+	rows, err := q.db.QueryContext(ctx, listSlowestSegments, arg.MinSamples, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SegmentStat{}
+	for rows.Next() {
+		var i SegmentStat
+		if err := rows.Scan(
+			&i.FromStationCode,
+			&i.ToStationCode,
+			&i.DistanceKm,
+			&i.Samples,
+			&i.AvgSpeedKmh,
+			&i.MinSpeedKmh,
+			&i.MaxSpeedKmh,
+			&i.AvgRuntimeMin,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStationCongestionByHour = `-- name: ListStationCongestionByHour :many
+SELECT
+    hour,
+    COUNT(*) AS days_observed,
+    CAST(AVG(trains) AS REAL) AS avg_trains_seen,
+    CAST(AVG(avg_trains) AS REAL) AS avg_trains,
+    CAST(AVG(peak_trains) AS REAL) AS avg_peak_trains,
+    CAST(MAX(peak_trains) AS INTEGER) AS peak_trains
+FROM station_congestion_hourly
+WHERE station_code = ?1
+  AND obs_date >= ?2
+GROUP BY hour
+ORDER BY hour
+`
+
+type ListStationCongestionByHourParams struct {
+	StationCode string `json:"station_code"`
+	SinceDate   string `json:"since_date"`
+}
+
+type ListStationCongestionByHourRow struct {
+	Hour          int64   `json:"hour"`
+	DaysObserved  int64   `json:"days_observed"`
+	AvgTrainsSeen float64 `json:"avg_trains_seen"`
+	AvgTrains     float64 `json:"avg_trains"`
+	AvgPeakTrains float64 `json:"avg_peak_trains"`
+	PeakTrains    int64   `json:"peak_trains"`
+}
+
+// Returns occupancy of a station per local hour of day over days since the given date
+func (q *Queries) ListStationCongestionByHour(ctx context.Context, arg ListStationCongestionByHourParams) ([]ListStationCongestionByHourRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStationCongestionByHour, arg.StationCode, arg.SinceDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStationCongestionByHourRow{}
+	for rows.Next() {
+		var i ListStationCongestionByHourRow
+		if err := rows.Scan(
+			&i.Hour,
+			&i.DaysObserved,
+			&i.AvgTrainsSeen,
+			&i.AvgTrains,
+			&i.AvgPeakTrains,
+			&i.PeakTrains,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStationDelayBuckets = `-- name: ListStationDelayBuckets :many
+SELECT
+    d.station_code,
+    s.station_name,
+    s.lat,
+    s.lng,
+    COUNT(*) AS samples,
+    CAST(AVG(d.delay_min) AS REAL) AS avg_delay_min,
+    CAST(MAX(d.delay_min) AS INTEGER) AS max_delay_min,
+    CAST(COALESCE(AVG(d.gain_min), 0) AS REAL) AS avg_delay_gain_min
+FROM (
+    SELECT
+        e.station_code,
+        COALESCE(e.delay_departure_min, e.delay_arrival_min) AS delay_min,
+        COALESCE(e.delay_arrival_min, e.delay_departure_min)
+            - LAG(COALESCE(e.delay_departure_min, e.delay_arrival_min)) OVER (PARTITION BY e.run_id ORDER BY e.sno) AS gain_min
+    FROM train_run_station_events e
+    JOIN train_runs tr ON e.run_id = tr.run_id
+    WHERE tr.run_date BETWEEN ?1 AND ?2
+) d
+JOIN stations s ON d.station_code = s.station_code
+WHERE d.delay_min IS NOT NULL
+GROUP BY d.station_code
+`
+
+type ListStationDelayBucketsParams struct {
+	FromDate string `json:"from_date"`
+	ToDate   string `json:"to_date"`
+}
+
+type ListStationDelayBucketsRow struct {
+	StationCode     string          `json:"station_code"`
+	StationName     string          `json:"station_name"`
+	Lat             sql.NullFloat64 `json:"lat"`
+	Lng             sql.NullFloat64 `json:"lng"`
+	Samples         int64           `json:"samples"`
+	AvgDelayMin     float64         `json:"avg_delay_min"`
+	MaxDelayMin     int64           `json:"max_delay_min"`
+	AvgDelayGainMin float64         `json:"avg_delay_gain_min"`
+}
+
+// Aggregates observed delays and delay gained per station for runs in a date range
+func (q *Queries) ListStationDelayBuckets(ctx context.Context, arg ListStationDelayBucketsParams) ([]ListStationDelayBucketsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStationDelayBuckets, arg.FromDate, arg.ToDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStationDelayBucketsRow{}
+	for rows.Next() {
+		var i ListStationDelayBucketsRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.StationName,
+			&i.Lat,
+			&i.Lng,
+			&i.Samples,
+			&i.AvgDelayMin,
+			&i.MaxDelayMin,
+			&i.AvgDelayGainMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStationGroupPunctuality = `-- name: ListStationGroupPunctuality :many
+SELECT
+    COALESCE(NULLIF(TRIM(CASE WHEN ?1 = 'division' THEN s.division ELSE s.zone END), ''), 'UNKNOWN') AS group_key,
+    COALESCE(MAX(s.zone), '') AS zone,
+    COUNT(DISTINCT d.station_code) AS stations,
+    CAST(SUM(d.trains) AS INTEGER) AS arrivals,
+    CAST(SUM(d.on_time_trains) AS INTEGER) AS on_time_arrivals,
+    CAST(SUM(COALESCE(d.avg_delay_min, 0) * d.trains) / MAX(SUM(d.trains), 1) AS REAL) AS avg_delay_min,
+    CAST(COALESCE(MAX(d.max_delay_min), 0) AS INTEGER) AS max_delay_min
+FROM (
+    SELECT station_code, trains, on_time_trains, avg_delay_min, max_delay_min
+    FROM daily_station_summaries
+    WHERE summary_date >= ?2
+      AND (?3 = '' OR summary_date < ?3)
+    UNION ALL
+    SELECT station_code, trains, on_time_trains, avg_delay_min, max_delay_min
+    FROM monthly_station_summaries
+    WHERE ?3 != ''
+      AND month >= substr(?3, 1, 7)
+) d
+JOIN stations s ON d.station_code = s.station_code
+GROUP BY 1
+ORDER BY 1
+`
+
+type ListStationGroupPunctualityParams struct {
+	GroupBy    interface{} `json:"group_by"`
+	SinceDate  string      `json:"since_date"`
+	RollupFrom interface{} `json:"rollup_from"`
+}
+
+type ListStationGroupPunctualityRow struct {
+	GroupKey       string  `json:"group_key"`
+	Zone           string  `json:"zone"`
+	Stations       int64   `json:"stations"`
+	Arrivals       int64   `json:"arrivals"`
+	OnTimeArrivals int64   `json:"on_time_arrivals"`
+	AvgDelayMin    float64 `json:"avg_delay_min"`
+	MaxDelayMin    int64   `json:"max_delay_min"`
+}
+
+// Aggregates station summaries since the given date by station zone or division. Days from
+// rollup_from (the first of a month) on are read from the monthly rollups, an empty
+// rollup_from reads daily summaries only.
+func (q *Queries) ListStationGroupPunctuality(ctx context.Context, arg ListStationGroupPunctualityParams) ([]ListStationGroupPunctualityRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStationGroupPunctuality, arg.GroupBy, arg.SinceDate, arg.RollupFrom)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStationGroupPunctualityRow{}
+	for rows.Next() {
+		var i ListStationGroupPunctualityRow
+		if err := rows.Scan(
+			&i.GroupKey,
+			&i.Zone,
+			&i.Stations,
+			&i.Arrivals,
+			&i.OnTimeArrivals,
+			&i.AvgDelayMin,
+			&i.MaxDelayMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStationHeadways = `-- name: ListStationHeadways :many
+SELECT
+    h.station_code,
+    h.next_station_code,
+    COALESCE(s.station_name, '') AS next_station_name,
+    h.samples,
+    h.min_headway_min,
+    h.avg_headway_min,
+    h.max_headway_min,
+    h.bunched,
+    h.updated_at
+FROM headway_stats h
+LEFT JOIN stations s ON h.next_station_code = s.station_code
+WHERE h.station_code = ?1
+ORDER BY h.samples DESC
+`
+
+type ListStationHeadwaysRow struct {
+	StationCode     string  `json:"station_code"`
+	NextStationCode string  `json:"next_station_code"`
+	NextStationName string  `json:"next_station_name"`
+	Samples         int64   `json:"samples"`
+	MinHeadwayMin   float64 `json:"min_headway_min"`
+	AvgHeadwayMin   float64 `json:"avg_headway_min"`
+	MaxHeadwayMin   float64 `json:"max_headway_min"`
+	Bunched         int64   `json:"bunched"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
+// Returns headway stats of a station per direction
+func (q *Queries) ListStationHeadways(ctx context.Context, stationCode string) ([]ListStationHeadwaysRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStationHeadways, stationCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStationHeadwaysRow{}
+	for rows.Next() {
+		var i ListStationHeadwaysRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.NextStationCode,
+			&i.NextStationName,
+			&i.Samples,
+			&i.MinHeadwayMin,
+			&i.AvgHeadwayMin,
+			&i.MaxHeadwayMin,
+			&i.Bunched,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainCoaches = `-- name: ListTrainCoaches :many
+SELECT
+    position,
+    coach_code,
+    class,
+    kind
+FROM train_coaches
+WHERE train_no = ?1
+ORDER BY position
+`
+
+type ListTrainCoachesRow struct {
+	Position  int64          `json:"position"`
+	CoachCode string         `json:"coach_code"`
+	Class     sql.NullString `json:"class"`
+	Kind      string         `json:"kind"`
+}
+
+// Returns the parsed rake of a train from the locomotive end
+func (q *Queries) ListTrainCoaches(ctx context.Context, trainNo int64) ([]ListTrainCoachesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainCoaches, trainNo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainCoachesRow{}
+	for rows.Next() {
+		var i ListTrainCoachesRow
+		if err := rows.Scan(
+			&i.Position,
+			&i.CoachCode,
+			&i.Class,
+			&i.Kind,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainDelayProfiles = `-- name: ListTrainDelayProfiles :many
+SELECT
+    weekday,
+    station_code,
+    samples,
+    avg_delay_min,
+    p10_delay_min,
+    p50_delay_min,
+    p90_delay_min
+FROM train_station_delay_profiles
+WHERE train_no = ?1
+  AND weekday IN (?2, -1)
+`
+
+type ListTrainDelayProfilesParams struct {
+	TrainNo int64 `json:"train_no"`
+	Weekday int64 `json:"weekday"`
+}
+
+type ListTrainDelayProfilesRow struct {
+	Weekday     int64   `json:"weekday"`
+	StationCode string  `json:"station_code"`
+	Samples     int64   `json:"samples"`
+	AvgDelayMin float64 `json:"avg_delay_min"`
+	P10DelayMin int64   `json:"p10_delay_min"`
+	P50DelayMin int64   `json:"p50_delay_min"`
+	P90DelayMin int64   `json:"p90_delay_min"`
+}
+
+// Returns the station delay profiles of a train for one weekday plus the all-days fallback
+func (q *Queries) ListTrainDelayProfiles(ctx context.Context, arg ListTrainDelayProfilesParams) ([]ListTrainDelayProfilesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainDelayProfiles, arg.TrainNo, arg.Weekday)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainDelayProfilesRow{}
+	for rows.Next() {
+		var i ListTrainDelayProfilesRow
+		if err := rows.Scan(
+			&i.Weekday,
+			&i.StationCode,
+			&i.Samples,
+			&i.AvgDelayMin,
+			&i.P10DelayMin,
+			&i.P50DelayMin,
+			&i.P90DelayMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainPunctuality = `-- name: ListTrainPunctuality :many
+SELECT
+    s.train_no,
+    t.train_name,
+    t.train_type,
+    COUNT(*) AS runs,
+    CAST(SUM(CASE WHEN s.terminal_delay_min <= ?1 THEN 1 ELSE 0 END) AS INTEGER) AS on_time_runs,
+    CAST(AVG(s.terminal_delay_min) AS REAL) AS avg_terminal_delay_min
+FROM run_delay_summaries s
+JOIN trains t ON s.train_no = t.train_no
+JOIN train_runs tr ON s.run_id = tr.run_id
+WHERE s.run_date >= ?2
+  AND s.terminal_delay_min IS NOT NULL
+  AND (?3 = 0 OR tr.quality_score >= ?3)
+GROUP BY s.train_no
+HAVING COUNT(*) >= ?4
+`
+
+type ListTrainPunctualityParams struct {
+	OnTimeThresholdMin sql.NullInt64 `json:"on_time_threshold_min"`
+	SinceDate          string        `json:"since_date"`
+	MinQuality         interface{}   `json:"min_quality"`
+	MinRuns            int64         `json:"min_runs"`
+}
+
+type ListTrainPunctualityRow struct {
+	TrainNo             int64   `json:"train_no"`
+	TrainName           string  `json:"train_name"`
+	TrainType           string  `json:"train_type"`
+	Runs                int64   `json:"runs"`
+	OnTimeRuns          int64   `json:"on_time_runs"`
+	AvgTerminalDelayMin float64 `json:"avg_terminal_delay_min"`
+}
+
+// Aggregates terminal punctuality per train over completed runs since the given date
+func (q *Queries) ListTrainPunctuality(ctx context.Context, arg ListTrainPunctualityParams) ([]ListTrainPunctualityRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainPunctuality,
+		arg.OnTimeThresholdMin,
+		arg.SinceDate,
+		arg.MinQuality,
+		arg.MinRuns,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainPunctualityRow{}
+	for rows.Next() {
+		var i ListTrainPunctualityRow
+		if err := rows.Scan(
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.Runs,
+			&i.OnTimeRuns,
+			&i.AvgTerminalDelayMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainRunDates = `-- name: ListTrainRunDates :many
+SELECT
+    run_id,
+    run_date,
+    schedule_id,
+    current_status,
+    has_started,
+    has_arrived
+FROM train_runs
+WHERE train_no = ?1
+  AND run_date BETWEEN ?2 AND ?3
+ORDER BY run_date
+`
+
+type ListTrainRunDatesParams struct {
+	TrainNo  int64  `json:"train_no"`
+	FromDate string `json:"from_date"`
+	ToDate   string `json:"to_date"`
+}
+
+type ListTrainRunDatesRow struct {
+	RunID         string `json:"run_id"`
+	RunDate       string `json:"run_date"`
+	ScheduleID    int64  `json:"schedule_id"`
+	CurrentStatus string `json:"current_status"`
+	HasStarted    int64  `json:"has_started"`
+	HasArrived    int64  `json:"has_arrived"`
+}
+
+// Returns the runs of a train with a run date in [from_date, to_date]
+func (q *Queries) ListTrainRunDates(ctx context.Context, arg ListTrainRunDatesParams) ([]ListTrainRunDatesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainRunDates, arg.TrainNo, arg.FromDate, arg.ToDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainRunDatesRow{}
+	for rows.Next() {
+		var i ListTrainRunDatesRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.RunDate,
+			&i.ScheduleID,
+			&i.CurrentStatus,
+			&i.HasStarted,
+			&i.HasArrived,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainSchedules = `-- name: ListTrainSchedules :many
+SELECT
+    schedule_id,
+    origin_station_code,
+    terminus_station_code,
+    origin_sch_departure_min,
+    running_days_bitmap
+FROM train_schedules
+WHERE train_no = ?1
+ORDER BY origin_sch_departure_min, schedule_id
+`
+
+type ListTrainSchedulesRow struct {
+	ScheduleID            int64  `json:"schedule_id"`
+	OriginStationCode     string `json:"origin_station_code"`
+	TerminusStationCode   string `json:"terminus_station_code"`
+	OriginSchDepartureMin int64  `json:"origin_sch_departure_min"`
+	RunningDaysBitmap     int64  `json:"running_days_bitmap"`
+}
+
+// Returns the schedules of a train with their running days, as the poller left them
+func (q *Queries) ListTrainSchedules(ctx context.Context, trainNo int64) ([]ListTrainSchedulesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainSchedules, trainNo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainSchedulesRow{}
+	for rows.Next() {
+		var i ListTrainSchedulesRow
+		if err := rows.Scan(
+			&i.ScheduleID,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.OriginSchDepartureMin,
+			&i.RunningDaysBitmap,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainStationDelayHistory = `-- name: ListTrainStationDelayHistory :many
+WITH recent AS (
+    SELECT tr.run_id
+    FROM train_runs tr
+    WHERE tr.train_no = ?1
+      AND tr.run_date < ?2
+      AND EXISTS (SELECT 1 FROM train_run_station_events e WHERE e.run_id = tr.run_id)
+    ORDER BY tr.run_date DESC
+    LIMIT ?3
+)
+SELECT
+    e.station_code,
+    (SELECT COUNT(*) FROM recent) AS runs,
+    COUNT(*) AS samples,
+    CAST(AVG(e.delay_arrival_min) AS REAL) AS avg_delay_arrival_min,
+    CAST(AVG(e.delay_departure_min) AS REAL) AS avg_delay_departure_min
+FROM train_run_station_events e
+JOIN recent ON recent.run_id = e.run_id
+WHERE COALESCE(e.delay_departure_min, e.delay_arrival_min) IS NOT NULL
+GROUP BY e.station_code
+`
+
+type ListTrainStationDelayHistoryParams struct {
+	TrainNo    int64  `json:"train_no"`
+	BeforeDate string `json:"before_date"`
+	Runs       int64  `json:"runs"`
+}
+
+type ListTrainStationDelayHistoryRow struct {
+	StationCode          string          `json:"station_code"`
+	Runs                 int64           `json:"runs"`
+	Samples              int64           `json:"samples"`
+	AvgDelayArrivalMin   sql.NullFloat64 `json:"avg_delay_arrival_min"`
+	AvgDelayDepartureMin sql.NullFloat64 `json:"avg_delay_departure_min"`
+}
+
+// Returns the average delays per station over the last runs of a train before a date
+// that have actuals recorded, runs being how many of them were found
+func (q *Queries) ListTrainStationDelayHistory(ctx context.Context, arg ListTrainStationDelayHistoryParams) ([]ListTrainStationDelayHistoryRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainStationDelayHistory, arg.TrainNo, arg.BeforeDate, arg.Runs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainStationDelayHistoryRow{}
+	for rows.Next() {
+		var i ListTrainStationDelayHistoryRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.Runs,
+			&i.Samples,
+			&i.AvgDelayArrivalMin,
+			&i.AvgDelayDepartureMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainTimetable = `-- name: ListTrainTimetable :many
+SELECT
+    t.train_name,
+    t.train_type,
+    ts.schedule_id,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    ts.origin_sch_departure_min,
+    ts.total_distance_km,
+    ts.total_runtime_min,
+    ts.running_days_bitmap,
+    rt.station_code,
+    COALESCE(s.station_name, '') AS station_name,
+    rt.distance_km,
+    rt.sch_arrival_min_from_start,
+    rt.sch_departure_min_from_start,
+    rt.stops
+FROM train_schedules ts
+JOIN trains t ON t.train_no = ts.train_no
+JOIN train_routes rt ON rt.schedule_id = ts.schedule_id
+LEFT JOIN stations s ON s.station_code = rt.station_code
+WHERE ts.train_no = ?1
+ORDER BY ts.origin_sch_departure_min, ts.schedule_id, rt.distance_km, rt.sch_arrival_min_from_start
+`
+
+type ListTrainTimetableRow struct {
+	TrainName                string  `json:"train_name"`
+	TrainType                string  `json:"train_type"`
+	ScheduleID               int64   `json:"schedule_id"`
+	OriginStationCode        string  `json:"origin_station_code"`
+	TerminusStationCode      string  `json:"terminus_station_code"`
+	OriginSchDepartureMin    int64   `json:"origin_sch_departure_min"`
+	TotalDistanceKm          float64 `json:"total_distance_km"`
+	TotalRuntimeMin          int64   `json:"total_runtime_min"`
+	RunningDaysBitmap        int64   `json:"running_days_bitmap"`
+	StationCode              string  `json:"station_code"`
+	StationName              string  `json:"station_name"`
+	DistanceKm               float64 `json:"distance_km"`
+	SchArrivalMinFromStart   int64   `json:"sch_arrival_min_from_start"`
+	SchDepartureMinFromStart int64   `json:"sch_departure_min_from_start"`
+	Stops                    int64   `json:"stops"`
+}
+
+// Returns every stop of every schedule of a train, schedules in departure order
+func (q *Queries) ListTrainTimetable(ctx context.Context, trainNo int64) ([]ListTrainTimetableRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainTimetable, trainNo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainTimetableRow{}
+	for rows.Next() {
+		var i ListTrainTimetableRow
+		if err := rows.Scan(
+			&i.TrainName,
+			&i.TrainType,
+			&i.ScheduleID,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.OriginSchDepartureMin,
+			&i.TotalDistanceKm,
+			&i.TotalRuntimeMin,
+			&i.RunningDaysBitmap,
+			&i.StationCode,
+			&i.StationName,
+			&i.DistanceKm,
+			&i.SchArrivalMinFromStart,
+			&i.SchDepartureMinFromStart,
+			&i.Stops,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrainsAtStation = `-- name: ListTrainsAtStation :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    t.train_name,
+    t.train_type,
+    ts.origin_station_code,
+    ts.terminus_station_code,
+    CASE WHEN rt.schedule_id IS NOT NULL
+        THEN CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_arrival_min_from_start)) AS TEXT)
+    END AS sch_arrival,
+    CASE WHEN rt.schedule_id IS NOT NULL
+        THEN CAST(datetime(tr.run_date, printf('+%d minutes', ts.origin_sch_departure_min + rt.sch_departure_min_from_start)) AS TEXT)
+    END AS sch_departure,
+    tr.current_status,
+    tr.current_delay_min,
+    e.act_arrival_tm,
+    CAST((
+        SELECT MIN(l2.timestamp_ISO)
+        FROM train_run_locations l2
+        WHERE l2.run_id = tr.run_id
+          AND l2.segment_station_code = l.segment_station_code
+          AND l2.at_station = 1
+    ) AS TEXT) AS first_seen_at
+FROM train_runs tr
+JOIN train_run_locations l ON l.run_id = tr.run_id AND l.timestamp_ISO = tr.last_update_timestamp_ISO
+JOIN train_schedules ts ON ts.schedule_id = tr.schedule_id
+JOIN trains t ON t.train_no = tr.train_no
+LEFT JOIN train_routes rt ON rt.schedule_id = tr.schedule_id AND rt.station_code = l.segment_station_code
+LEFT JOIN train_run_station_events e ON e.run_id = tr.run_id AND e.station_code = l.segment_station_code
+WHERE tr.has_arrived = 0
+  AND l.segment_station_code = ?1
+  AND l.at_station = 1
+  AND datetime(tr.last_update_timestamp_iso) > datetime('now', '-15 minutes')
+ORDER BY first_seen_at, tr.run_id
+`
+
+type ListTrainsAtStationRow struct {
+	RunID               string         `json:"run_id"`
+	TrainNo             int64          `json:"train_no"`
+	TrainName           string         `json:"train_name"`
+	TrainType           string         `json:"train_type"`
+	OriginStationCode   string         `json:"origin_station_code"`
+	TerminusStationCode string         `json:"terminus_station_code"`
+	SchArrival          sql.NullString `json:"sch_arrival"`
+	SchDeparture        sql.NullString `json:"sch_departure"`
+	CurrentStatus       string         `json:"current_status"`
+	CurrentDelayMin     sql.NullInt64  `json:"current_delay_min"`
+	ActArrivalTm        sql.NullInt64  `json:"act_arrival_tm"`
+	FirstSeenAt         string         `json:"first_seen_at"`
+}
+
+// Returns the active runs CountTrainsAtStation counts, with the schedule at the station
+// when it is on their route, the actual arrival recorded there and the first fix that
+// had them standing at it
+func (q *Queries) ListTrainsAtStation(ctx context.Context, stationCode string) ([]ListTrainsAtStationRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTrainsAtStation, stationCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTrainsAtStationRow{}
+	for rows.Next() {
+		var i ListTrainsAtStationRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.TrainName,
+			&i.TrainType,
+			&i.OriginStationCode,
+			&i.TerminusStationCode,
+			&i.SchArrival,
+			&i.SchDeparture,
+			&i.CurrentStatus,
+			&i.CurrentDelayMin,
+			&i.ActArrivalTm,
+			&i.FirstSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWeatherDelays = `-- name: ListWeatherDelays :many
+SELECT
+    w.condition,
+    COUNT(DISTINCT w.division || ' ' || w.weather_date) AS division_days,
+    CAST(SUM(ds.trains) AS INTEGER) AS trains,
+    CAST(SUM(ds.on_time_trains) AS INTEGER) AS on_time_trains,
+    CAST(SUM(COALESCE(ds.avg_delay_min, 0) * ds.trains) / MAX(SUM(ds.trains), 1) AS REAL) AS avg_delay_min,
+    CAST(COALESCE(MAX(ds.max_delay_min), 0) AS INTEGER) AS max_delay_min
+FROM daily_station_summaries ds
+JOIN stations s ON ds.station_code = s.station_code
+JOIN division_weather_daily w ON w.division = s.division AND w.weather_date = ds.summary_date
+WHERE ds.summary_date >= ?1
+  AND (?2 = '' OR s.division = ?2)
+GROUP BY w.condition
+ORDER BY avg_delay_min DESC
+`
+
+type ListWeatherDelaysParams struct {
+	SinceDate string      `json:"since_date"`
+	Division  interface{} `json:"division"`
+}
+
+type ListWeatherDelaysRow struct {
+	Condition    string  `json:"condition"`
+	DivisionDays int64   `json:"division_days"`
+	Trains       int64   `json:"trains"`
+	OnTimeTrains int64   `json:"on_time_trains"`
+	AvgDelayMin  float64 `json:"avg_delay_min"`
+	MaxDelayMin  int64   `json:"max_delay_min"`
+}
+
+// Returns station delay aggregates since the given date grouped by the weather of the
+// station's division that day, optionally for one division
+func (q *Queries) ListWeatherDelays(ctx context.Context, arg ListWeatherDelaysParams) ([]ListWeatherDelaysRow, error) {
+	rows, err := q.db.QueryContext(ctx, listWeatherDelays, arg.SinceDate, arg.Division)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListWeatherDelaysRow{}
+	for rows.Next() {
+		var i ListWeatherDelaysRow
+		if err := rows.Scan(
+			&i.Condition,
+			&i.DivisionDays,
+			&i.Trains,
+			&i.OnTimeTrains,
+			&i.AvgDelayMin,
+			&i.MaxDelayMin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchStations = `-- name: SearchStations :many
+SELECT
+    s.station_code,
+    s.station_name,
+    s.zone,
+    s.division,
+    s.address,
+    s.lat,
+    s.lng,
+    s.station_type,
+    CAST(bm25(stations_fts, 10.0, 5.0, 1.0) AS REAL) AS rank
+FROM stations_fts
+JOIN stations s ON s.rowid = stations_fts.rowid
+WHERE stations_fts MATCH ?1
+ORDER BY s.station_code = ?2 DESC, rank
+LIMIT ?3
+`
+
+type SearchStationsParams struct {
+	Match       string `json:"match"`
+	StationCode string `json:"station_code"`
+	Limit       int64  `json:"limit"`
+}
+
+type SearchStationsRow struct {
+	StationCode string          `json:"station_code"`
+	StationName string          `json:"station_name"`
+	Zone        sql.NullString  `json:"zone"`
+	Division    sql.NullString  `json:"division"`
+	Address     sql.NullString  `json:"address"`
+	Lat         sql.NullFloat64 `json:"lat"`
+	Lng         sql.NullFloat64 `json:"lng"`
+	StationType sql.NullString  `json:"station_type"`
+	Rank        float64         `json:"rank"`
+}
+
+// Ranks stations matching an FTS5 expression, an exact station code first, then by
+// bm25 with code and name weighted above the address
+func (q *Queries) SearchStations(ctx context.Context, arg SearchStationsParams) ([]SearchStationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchStations, arg.Match, arg.StationCode, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchStationsRow{}
+	for rows.Next() {
+		var i SearchStationsRow
+		if err := rows.Scan(
+			&i.StationCode,
+			&i.StationName,
+			&i.Zone,
+			&i.Division,
+			&i.Address,
+			&i.Lat,
+			&i.Lng,
+			&i.StationType,
+			&i.Rank,
 		); err != nil {
 			return nil, err
 		}
@@ -12,6 +12,121 @@ import (
 	"trano/internal/db"
 )
 
+const archiveFailedResponse = `-- name: ArchiveFailedResponse :exec
+INSERT INTO upstream_failed_responses (
+    run_id,
+    kind,
+    error,
+    body_gzip,
+    body_bytes
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5
+)
+`
+
+type ArchiveFailedResponseParams struct {
+	RunID     string         `json:"run_id"`
+	Kind      string         `json:"kind"`
+	Error     sql.NullString `json:"error"`
+	BodyGzip  []byte         `json:"body_gzip"`
+	BodyBytes int64          `json:"body_bytes"`
+}
+
+func (q *Queries) ArchiveFailedResponse(ctx context.Context, arg ArchiveFailedResponseParams) error {
+	_, err := q.db.ExecContext(ctx, archiveFailedResponse,
+		arg.RunID,
+		arg.Kind,
+		arg.Error,
+		arg.BodyGzip,
+		arg.BodyBytes,
+	)
+	return err
+}
+
+const claimRuns = `-- name: ClaimRuns :execrows
+UPDATE train_runs
+SET lease_owner = ?1,
+    lease_expires_at = ?2
+WHERE run_id IN (
+    SELECT tr.run_id
+    FROM train_runs tr
+    JOIN train_schedules ts
+        ON tr.schedule_id = ts.schedule_id
+    JOIN trains t
+        ON t.train_no = tr.train_no
+    WHERE tr.has_arrived = 0
+      AND date(tr.run_date) <= date(?3)
+      AND date(tr.run_date) >= date(?3, '-5 days')
+      AND COALESCE(json_extract(tr.errors, '$.static_response.count'), 0)
+            < CAST(?4 AS INTEGER)
+      AND datetime(
+            tr.run_date,
+            '+' || COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) || ' minutes'
+          ) <= datetime(?3)
+      AND NOT EXISTS (
+            SELECT 1
+            FROM train_aliases ta
+            JOIN train_runs ar
+                ON ar.train_no = ta.alias_train_no
+                AND ar.run_date = tr.run_date
+            WHERE ta.train_no = tr.train_no
+              AND datetime(ar.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+          )
+      AND (tr.next_poll_at IS NULL OR tr.next_poll_at <= ?2)
+      AND (
+            tr.lease_owner IS NULL
+            OR tr.lease_expires_at IS NULL
+            OR tr.lease_expires_at < ?5
+          )
+    ORDER BY tr.has_started DESC,
+        t.priority,
+        tr.last_update_timestamp_ISO ASC NULLS FIRST
+    LIMIT MAX(
+        CAST(?6 AS INTEGER) - (
+            SELECT COUNT(*)
+            FROM train_runs o
+            WHERE o.lease_owner = ?1
+              AND o.has_arrived = 0
+              AND o.lease_expires_at >= ?5
+        ),
+        0
+    )
+)
+`
+
+type ClaimRunsParams struct {
+	LeaseOwner              string `json:"lease_owner"`
+	ExpiresAt               string `json:"expires_at"`
+	NowTs                   string `json:"now_ts"`
+	StaticResponseThreshold int64  `json:"static_response_threshold"`
+	NowUtc                  string `json:"now_utc"`
+	MaxRuns                 int64  `json:"max_runs"`
+}
+
+// Leases runs ListRunsToPoll would pick that nobody holds, or whose lease ran out, to
+// lease_owner until expires_at (UTC), topping its share up to max_runs in the order
+// ListRunsToPoll polls them. Backed off runs are left to whoever holds them when they
+// come due. One statement, so instances claiming at the same time never get the same
+// run.
+func (q *Queries) ClaimRuns(ctx context.Context, arg ClaimRunsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimRuns,
+		arg.LeaseOwner,
+		arg.ExpiresAt,
+		arg.NowTs,
+		arg.StaticResponseThreshold,
+		arg.NowUtc,
+		arg.MaxRuns,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const clearRunningDayBitForDate = `-- name: ClearRunningDayBitForDate :exec
 UPDATE train_schedules
 SET
@@ -36,6 +151,370 @@ func (q *Queries) ClearRunningDayBitForDate(ctx context.Context, arg ClearRunnin
 	return err
 }
 
+const closeNeverStartedRuns = `-- name: CloseNeverStartedRuns :execrows
+UPDATE train_runs
+SET has_arrived = 1,
+    current_status = 'no_data',
+    next_poll_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE has_arrived = 0
+  AND has_started = 0
+  AND last_update_timestamp_ISO IS NULL
+  AND EXISTS (
+      SELECT 1
+      FROM train_schedules ts
+      WHERE ts.schedule_id = train_runs.schedule_id
+        AND datetime(
+              train_runs.run_date,
+              '+' || (
+                  COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min)
+                  + ts.total_runtime_min
+              ) || ' minutes'
+            ) < datetime(?1)
+  )
+`
+
+// Gives up on runs upstream never reported on once their scheduled arrival, from a
+// rescheduled departure where there is one, is before arrived_before (local time)
+func (q *Queries) CloseNeverStartedRuns(ctx context.Context, arrivedBefore string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, closeNeverStartedRuns, arrivedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const closeOverdueRuns = `-- name: CloseOverdueRuns :execrows
+UPDATE train_runs
+SET has_arrived = 1,
+    current_status = 'timed_out',
+    next_poll_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE has_arrived = 0
+  AND has_started = 1
+  AND (
+        last_update_timestamp_ISO IS NULL
+        OR datetime(last_update_timestamp_ISO) < datetime(?1)
+      )
+  AND EXISTS (
+      SELECT 1
+      FROM train_schedules ts
+      WHERE ts.schedule_id = train_runs.schedule_id
+        AND datetime(
+              train_runs.run_date,
+              '+' || (
+                  MAX(
+                      COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min),
+                      ts.origin_sch_departure_min + MAX(COALESCE(train_runs.current_delay_min, 0), 0)
+                  ) + ts.total_runtime_min
+              ) || ' minutes'
+            ) < datetime(?2)
+  )
+`
+
+type CloseOverdueRunsParams struct {
+	QuietBefore   string `json:"quiet_before"`
+	ArrivedBefore string `json:"arrived_before"`
+}
+
+// Closes running runs whose scheduled arrival, pushed back by their last known delay
+// or a rescheduled departure, is before arrived_before (local time) and that have been silent since quiet_before (UTC)
+func (q *Queries) CloseOverdueRuns(ctx context.Context, arg CloseOverdueRunsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, closeOverdueRuns, arg.QuietBefore, arg.ArrivedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const closeRunsFinishedOffline = `-- name: CloseRunsFinishedOffline :execrows
+UPDATE train_runs
+SET has_arrived = 1,
+    current_status = 'timed_out',
+    next_poll_at = NULL,
+    extrapolated_lat_u6 = NULL,
+    extrapolated_lng_u6 = NULL,
+    extrapolated_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE has_arrived = 0
+  AND has_started = 1
+  AND EXISTS (
+      SELECT 1
+      FROM train_schedules ts
+      WHERE ts.schedule_id = train_runs.schedule_id
+        AND datetime(
+              train_runs.run_date,
+              '+' || (
+                  MAX(
+                      COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min),
+                      ts.origin_sch_departure_min + MAX(COALESCE(train_runs.current_delay_min, 0), 0)
+                  ) + ts.total_runtime_min
+              ) || ' minutes'
+            ) < datetime(?1)
+        AND (
+              train_runs.last_update_timestamp_ISO IS NULL
+              OR datetime(train_runs.last_update_timestamp_ISO) < datetime(
+                  train_runs.run_date,
+                  '+' || (
+                      MAX(
+                          COALESCE(train_runs.revised_departure_min, ts.origin_sch_departure_min),
+                          ts.origin_sch_departure_min + MAX(COALESCE(train_runs.current_delay_min, 0), 0)
+                      ) + ts.total_runtime_min
+                  ) || ' minutes',
+                  (-CAST(?2 AS INTEGER)) || ' seconds'
+                )
+            )
+  )
+`
+
+type CloseRunsFinishedOfflineParams struct {
+	ArrivedBefore string `json:"arrived_before"`
+	TzOffsetSec   int64  `json:"tz_offset_sec"`
+}
+
+// Closes running runs whose scheduled arrival, pushed back by their last known delay
+// or a rescheduled departure, is before arrived_before (local time) and that were last heard from before that
+// arrival. Run at startup for runs that finished while nothing polled them;
+// tz_offset_sec turns the local arrival into UTC to compare with the last update.
+func (q *Queries) CloseRunsFinishedOffline(ctx context.Context, arg CloseRunsFinishedOfflineParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, closeRunsFinishedOffline, arg.ArrivedBefore, arg.TzOffsetSec)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const copyRunLocations = `-- name: CopyRunLocations :exec
+INSERT OR IGNORE INTO train_run_locations (
+    run_id,
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+)
+SELECT
+    ?1,
+    lat_u6,
+    lng_u6,
+    snapped_lat_u6,
+    snapped_lng_u6,
+    distance_km_u4,
+    segment_station_code,
+    at_station,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = ?2
+`
+
+type CopyRunLocationsParams struct {
+	CanonicalRunID string `json:"canonical_run_id"`
+	AliasRunID     string `json:"alias_run_id"`
+}
+
+func (q *Queries) CopyRunLocations(ctx context.Context, arg CopyRunLocationsParams) error {
+	_, err := q.db.ExecContext(ctx, copyRunLocations, arg.CanonicalRunID, arg.AliasRunID)
+	return err
+}
+
+const copyRunStationEvents = `-- name: CopyRunStationEvents :exec
+INSERT INTO train_run_station_events (
+    run_id,
+    sno,
+    station_code,
+    distance_km_u4,
+    sch_arrival_tm,
+    act_arrival_tm,
+    sch_departure_tm,
+    act_departure_tm,
+    delay_arrival_min,
+    delay_departure_min,
+    departed,
+    created_at,
+    updated_at
+)
+SELECT
+    ?1,
+    sno,
+    station_code,
+    distance_km_u4,
+    sch_arrival_tm,
+    act_arrival_tm,
+    sch_departure_tm,
+    act_departure_tm,
+    delay_arrival_min,
+    delay_departure_min,
+    departed,
+    created_at,
+    updated_at
+FROM train_run_station_events
+WHERE run_id = ?2
+ON CONFLICT(run_id, station_code) DO UPDATE SET
+    sno = excluded.sno,
+    distance_km_u4 = excluded.distance_km_u4,
+    sch_arrival_tm = excluded.sch_arrival_tm,
+    act_arrival_tm = excluded.act_arrival_tm,
+    sch_departure_tm = excluded.sch_departure_tm,
+    act_departure_tm = excluded.act_departure_tm,
+    delay_arrival_min = excluded.delay_arrival_min,
+    delay_departure_min = excluded.delay_departure_min,
+    departed = excluded.departed,
+    updated_at = excluded.updated_at
+WHERE excluded.updated_at > train_run_station_events.updated_at
+`
+
+type CopyRunStationEventsParams struct {
+	CanonicalRunID string `json:"canonical_run_id"`
+	AliasRunID     string `json:"alias_run_id"`
+}
+
+// The more recently updated event wins where both runs passed a station
+func (q *Queries) CopyRunStationEvents(ctx context.Context, arg CopyRunStationEventsParams) error {
+	_, err := q.db.ExecContext(ctx, copyRunStationEvents, arg.CanonicalRunID, arg.AliasRunID)
+	return err
+}
+
+const deleteRunLocations = `-- name: DeleteRunLocations :exec
+DELETE FROM train_run_locations
+WHERE run_id = ?1
+`
+
+func (q *Queries) DeleteRunLocations(ctx context.Context, runID string) error {
+	_, err := q.db.ExecContext(ctx, deleteRunLocations, runID)
+	return err
+}
+
+const deleteRunStationEvents = `-- name: DeleteRunStationEvents :exec
+DELETE FROM train_run_station_events
+WHERE run_id = ?1
+`
+
+func (q *Queries) DeleteRunStationEvents(ctx context.Context, runID string) error {
+	_, err := q.db.ExecContext(ctx, deleteRunStationEvents, runID)
+	return err
+}
+
+const extrapolateRunPositions = `-- name: ExtrapolateRunPositions :execrows
+WITH quiet AS (
+  SELECT
+    tr.run_id,
+    tr.schedule_id,
+    tr.last_route_frac_u4,
+    tr.last_update_timestamp_ISO,
+    (
+      SELECT l.id
+      FROM train_run_locations l
+      WHERE l.run_id = tr.run_id
+      ORDER BY l.timestamp_ISO DESC
+      LIMIT 1
+    ) AS fix_id
+  FROM train_runs tr
+  WHERE tr.has_started = 1
+    AND tr.has_arrived = 0
+    AND tr.last_route_frac_u4 IS NOT NULL
+    AND datetime(tr.last_update_timestamp_ISO) < datetime(?1)
+    AND datetime(tr.last_update_timestamp_ISO) > datetime(?2)
+),
+moving AS (
+  SELECT
+    q.run_id,
+    q.schedule_id,
+    q.last_route_frac_u4,
+    q.last_update_timestamp_ISO,
+    MIN(
+      (l.distance_km_u4 - p.distance_km_u4) / 10000.0
+        / ((julianday(l.timestamp_ISO) - julianday(p.timestamp_ISO)) * 24),
+      ?3
+    ) AS speed_kmh
+  FROM quiet q
+  JOIN train_run_locations l ON l.id = q.fix_id
+  JOIN train_run_locations p ON p.id = (
+      SELECT p2.id
+      FROM train_run_locations p2
+      WHERE p2.run_id = q.run_id
+        AND p2.timestamp_ISO < l.timestamp_ISO
+      ORDER BY p2.timestamp_ISO DESC
+      LIMIT 1
+  )
+  WHERE l.at_station = 0
+    AND l.distance_km_u4 > p.distance_km_u4
+    -- fixes half an hour apart say little about the current speed
+    AND julianday(l.timestamp_ISO) - julianday(p.timestamp_ISO) <= 30.0 / 1440
+),
+projected AS (
+  SELECT
+    m.run_id,
+    ST_Transform(
+      ST_Line_Interpolate_Point(
+        trg.route_geom,
+        MIN(
+          1.0,
+          m.last_route_frac_u4 / 10000.0
+            + m.speed_kmh * (julianday('now') - julianday(m.last_update_timestamp_ISO)) * 24 * 1000
+              / ST_Length(trg.route_geom)
+        )
+      ),
+      4326
+    ) AS pt
+  FROM moving m
+  JOIN train_route_geometries trg
+    ON trg.schedule_id = m.schedule_id
+  WHERE ST_IsValid(trg.route_geom) = 1
+    AND ST_Length(trg.route_geom) > 0
+)
+UPDATE train_runs
+SET extrapolated_lat_u6 = CAST(Y(p.pt) * 1000000 AS INTEGER),
+    extrapolated_lng_u6 = CAST(X(p.pt) * 1000000 AS INTEGER),
+    extrapolated_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+FROM projected p
+WHERE train_runs.run_id = p.run_id
+`
+
+type ExtrapolateRunPositionsParams struct {
+	QuietBefore string  `json:"quiet_before"`
+	FixAfter    string  `json:"fix_after"`
+	MaxSpeedKmh float64 `json:"max_speed_kmh"`
+}
+
+// Dead reckoning for running runs whose last fix is older than quiet_before and newer
+// than fix_after (both UTC): the train is moved along its route geometry by the time
+// since that fix at the speed it made since the fix before, at most max_speed_kmh.
+// Runs last seen standing at a station, or not making progress, stay where they are.
+func (q *Queries) ExtrapolateRunPositions(ctx context.Context, arg ExtrapolateRunPositionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, extrapolateRunPositions, arg.QuietBefore, arg.FixAfter, arg.MaxSpeedKmh)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getRunDaySchedule = `-- name: GetRunDaySchedule :one
+SELECT body_gzip, stations, polled_at
+FROM upstream_day_schedules
+WHERE run_id = ?1
+`
+
+type GetRunDayScheduleRow struct {
+	BodyGzip []byte `json:"body_gzip"`
+	Stations int64  `json:"stations"`
+	PolledAt string `json:"polled_at"`
+}
+
+func (q *Queries) GetRunDaySchedule(ctx context.Context, runID string) (GetRunDayScheduleRow, error) {
+	row := q.db.QueryRowContext(ctx, getRunDaySchedule, runID)
+	var i GetRunDayScheduleRow
+	err := row.Scan(
+		&i.BodyGzip,
+		&i.Stations,
+		&i.PolledAt,
+	)
+	return i, err
+}
+
 const getRunSnap = `-- name: GetRunSnap :one
 WITH snapped AS (
   SELECT
@@ -43,6 +522,10 @@ WITH snapped AS (
       trg.route_geom,
       ST_Transform(MakePoint(?1, ?2, 4326), 7755)
     ) AS snappt,
+    ST_Distance(
+      trg.route_geom,
+      ST_Transform(MakePoint(?1, ?2, 4326), 7755)
+    ) AS offset_m,
     trg.route_geom
   FROM train_runs tr
   JOIN train_route_geometries trg
@@ -53,6 +536,7 @@ WITH snapped AS (
 fraccalc AS (
   SELECT
     snappt,
+    offset_m,
     route_geom,
     Line_Locate_Point(route_geom, snappt) AS frac
   FROM snapped
@@ -60,6 +544,7 @@ fraccalc AS (
 bearingcalc AS (
   SELECT
     snappt,
+    offset_m,
     route_geom,
     frac,
     CASE
@@ -80,7 +565,8 @@ SELECT
   CAST(X(ST_Transform(snappt, 4326)) * 1000000 AS INTEGER) AS snapped_lng_u6,
   CAST(Y(ST_Transform(snappt, 4326)) * 1000000 AS INTEGER) AS snapped_lat_u6,
   CAST(frac * 10000 AS INTEGER) AS route_frac_u4,
-  CAST(ROUND(Degrees(bearing_rad)) % 360 AS INTEGER) AS bearing_deg
+  CAST(ROUND(Degrees(bearing_rad)) % 360 AS INTEGER) AS bearing_deg,
+  CAST(offset_m AS INTEGER) AS offset_m
 FROM bearingcalc
 `
 
@@ -95,9 +581,11 @@ type GetRunSnapRow struct {
 	SnappedLatU6 int64 `json:"snapped_lat_u6"`
 	RouteFracU4  int64 `json:"route_frac_u4"`
 	BearingDeg   int64 `json:"bearing_deg"`
+	OffsetM      int64 `json:"offset_m"`
 }
 
-// Snap raw GPS to route and compute linear reference bearing
+// Snap raw GPS to route and compute linear reference bearing, offset_m is how far the
+// raw fix is from the route
 func (q *Queries) GetRunSnap(ctx context.Context, arg GetRunSnapParams) (GetRunSnapRow, error) {
 	row := q.db.QueryRowContext(ctx, getRunSnap, arg.Lng, arg.Lat, arg.RunID)
 	var i GetRunSnapRow
@@ -106,10 +594,404 @@ func (q *Queries) GetRunSnap(ctx context.Context, arg GetRunSnapParams) (GetRunS
 		&i.SnappedLatU6,
 		&i.RouteFracU4,
 		&i.BearingDeg,
+		&i.OffsetM,
 	)
 	return i, err
 }
 
+const getRunToPoll = `-- name: GetRunToPoll :one
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    tr.last_known_lat_u6,
+    tr.last_known_lng_u6,
+    tr.last_updated_sno,
+    tr.last_update_timestamp_ISO,
+    COALESCE(tr.errors, '{}') AS errors,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.has_started,
+    ts.schedule_id,
+    ts.origin_station_code AS source_station,
+    ts.terminus_station_code AS destination_station,
+    COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) AS origin_sch_departure_min,
+    CAST(t.priority AS INTEGER) AS priority,
+    t.train_type
+FROM train_runs tr
+JOIN train_schedules ts
+    ON tr.schedule_id = ts.schedule_id
+JOIN trains t
+    ON t.train_no = tr.train_no
+WHERE tr.run_id = ?1
+`
+
+type GetRunToPollRow struct {
+	RunID                  string         `json:"run_id"`
+	TrainNo                int64          `json:"train_no"`
+	RunDate                string         `json:"run_date"`
+	LastKnownLatU6         sql.NullInt64  `json:"last_known_lat_u6"`
+	LastKnownLngU6         sql.NullInt64  `json:"last_known_lng_u6"`
+	LastUpdatedSno         sql.NullString `json:"last_updated_sno"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+	Errors                 db.RunErrors   `json:"errors"`
+	CurrentStatus          string         `json:"current_status"`
+	CurrentDelayMin        sql.NullInt64  `json:"current_delay_min"`
+	HasStarted             int64          `json:"has_started"`
+	ScheduleID             int64          `json:"schedule_id"`
+	SourceStation          string         `json:"source_station"`
+	DestinationStation     string         `json:"destination_station"`
+	OriginSchDepartureMin  int64          `json:"origin_sch_departure_min"`
+	Priority               int64          `json:"priority"`
+	TrainType              string         `json:"train_type"`
+}
+
+// Same shape as ListRunsToPoll for a single run without gating, used by replay
+func (q *Queries) GetRunToPoll(ctx context.Context, runID string) (GetRunToPollRow, error) {
+	row := q.db.QueryRowContext(ctx, getRunToPoll, runID)
+	var i GetRunToPollRow
+	err := row.Scan(
+		&i.RunID,
+		&i.TrainNo,
+		&i.RunDate,
+		&i.LastKnownLatU6,
+		&i.LastKnownLngU6,
+		&i.LastUpdatedSno,
+		&i.LastUpdateTimestampIso,
+		&i.Errors,
+		&i.CurrentStatus,
+		&i.CurrentDelayMin,
+		&i.HasStarted,
+		&i.ScheduleID,
+		&i.SourceStation,
+		&i.DestinationStation,
+		&i.OriginSchDepartureMin,
+		&i.Priority,
+		&i.TrainType,
+	)
+	return i, err
+}
+
+const getScheduleByEndpoints = `-- name: GetScheduleByEndpoints :one
+SELECT
+    schedule_id,
+    origin_sch_departure_min,
+    total_distance_km
+FROM train_schedules
+WHERE train_no = ?1
+  AND origin_station_code = ?2
+  AND terminus_station_code = ?3
+ORDER BY updated_at DESC
+LIMIT 1
+`
+
+type GetScheduleByEndpointsParams struct {
+	TrainNo             int64  `json:"train_no"`
+	OriginStationCode   string `json:"origin_station_code"`
+	TerminusStationCode string `json:"terminus_station_code"`
+}
+
+type GetScheduleByEndpointsRow struct {
+	ScheduleID            int64   `json:"schedule_id"`
+	OriginSchDepartureMin int64   `json:"origin_sch_departure_min"`
+	TotalDistanceKm       float64 `json:"total_distance_km"`
+}
+
+// Resolves the schedule a live status request refers to, used by the simulator
+func (q *Queries) GetScheduleByEndpoints(ctx context.Context, arg GetScheduleByEndpointsParams) (GetScheduleByEndpointsRow, error) {
+	row := q.db.QueryRowContext(ctx, getScheduleByEndpoints, arg.TrainNo, arg.OriginStationCode, arg.TerminusStationCode)
+	var i GetScheduleByEndpointsRow
+	err := row.Scan(
+		&i.ScheduleID,
+		&i.OriginSchDepartureMin,
+		&i.TotalDistanceKm,
+	)
+	return i, err
+}
+
+const getUpstreamBudget = `-- name: GetUpstreamBudget :one
+SELECT
+    tokens,
+    saved_at,
+    blocked_until,
+    last_blocked_at,
+    blocks
+FROM upstream_budgets
+WHERE name = ?1
+`
+
+type GetUpstreamBudgetRow struct {
+	Tokens        float64        `json:"tokens"`
+	SavedAt       string         `json:"saved_at"`
+	BlockedUntil  sql.NullString `json:"blocked_until"`
+	LastBlockedAt sql.NullString `json:"last_blocked_at"`
+	Blocks        int64          `json:"blocks"`
+}
+
+func (q *Queries) GetUpstreamBudget(ctx context.Context, name string) (GetUpstreamBudgetRow, error) {
+	row := q.db.QueryRowContext(ctx, getUpstreamBudget, name)
+	var i GetUpstreamBudgetRow
+	err := row.Scan(
+		&i.Tokens,
+		&i.SavedAt,
+		&i.BlockedUntil,
+		&i.LastBlockedAt,
+		&i.Blocks,
+	)
+	return i, err
+}
+
+const listAliasRunsToMerge = `-- name: ListAliasRunsToMerge :many
+SELECT
+    ar.run_id AS alias_run_id,
+    cr.run_id AS canonical_run_id
+FROM train_aliases ta
+JOIN train_runs ar
+    ON ar.train_no = ta.alias_train_no
+JOIN train_runs cr
+    ON cr.train_no = ta.train_no
+    AND cr.run_date = ar.run_date
+WHERE date(ar.run_date) >= date('now', '-5 days')
+  AND (
+        EXISTS (SELECT 1 FROM train_run_locations l WHERE l.run_id = ar.run_id)
+        OR EXISTS (SELECT 1 FROM train_run_station_events e WHERE e.run_id = ar.run_id)
+        OR (
+            ar.last_update_timestamp_ISO IS NOT NULL
+            AND (
+                cr.last_update_timestamp_ISO IS NULL
+                OR datetime(ar.last_update_timestamp_ISO) > datetime(cr.last_update_timestamp_ISO)
+            )
+        )
+      )
+`
+
+type ListAliasRunsToMergeRow struct {
+	AliasRunID     string `json:"alias_run_id"`
+	CanonicalRunID string `json:"canonical_run_id"`
+}
+
+// Alias runs holding data that belongs to the canonical run of the same date
+func (q *Queries) ListAliasRunsToMerge(ctx context.Context) ([]ListAliasRunsToMergeRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAliasRunsToMerge)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListAliasRunsToMergeRow{}
+	for rows.Next() {
+		var i ListAliasRunsToMergeRow
+		if err := rows.Scan(
+			&i.AliasRunID,
+			&i.CanonicalRunID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentRunFixes = `-- name: ListRecentRunFixes :many
+SELECT
+    lat_u6,
+    lng_u6,
+    COALESCE(smoothed_lat_u6, lat_u6) AS smoothed_lat_u6,
+    COALESCE(smoothed_lng_u6, lng_u6) AS smoothed_lng_u6,
+    timestamp_ISO
+FROM train_run_locations
+WHERE run_id = ?1
+ORDER BY timestamp_ISO DESC
+LIMIT ?2
+`
+
+type ListRecentRunFixesParams struct {
+	RunID string `json:"run_id"`
+	Limit int64  `json:"limit"`
+}
+
+type ListRecentRunFixesRow struct {
+	LatU6         int64  `json:"lat_u6"`
+	LngU6         int64  `json:"lng_u6"`
+	SmoothedLatU6 int64  `json:"smoothed_lat_u6"`
+	SmoothedLngU6 int64  `json:"smoothed_lng_u6"`
+	TimestampIso  string `json:"timestamp_iso"`
+}
+
+// The run's last fixes, newest first, smoothed positions fall back to the raw ones
+func (q *Queries) ListRecentRunFixes(ctx context.Context, arg ListRecentRunFixesParams) ([]ListRecentRunFixesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentRunFixes, arg.RunID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRecentRunFixesRow{}
+	for rows.Next() {
+		var i ListRecentRunFixesRow
+		if err := rows.Scan(
+			&i.LatU6,
+			&i.LngU6,
+			&i.SmoothedLatU6,
+			&i.SmoothedLngU6,
+			&i.TimestampIso,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentRunOffsets = `-- name: ListRecentRunOffsets :many
+SELECT CAST(offset_m AS INTEGER) AS offset_m
+FROM train_run_locations
+WHERE run_id = ?1
+  AND offset_m IS NOT NULL
+ORDER BY timestamp_ISO DESC
+LIMIT ?2
+`
+
+type ListRecentRunOffsetsParams struct {
+	RunID string `json:"run_id"`
+	Limit int64  `json:"limit"`
+}
+
+// Distances from the route of the run's last snapped fixes, newest first
+func (q *Queries) ListRecentRunOffsets(ctx context.Context, arg ListRecentRunOffsetsParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentRunOffsets, arg.RunID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var offset_m int64
+		if err := rows.Scan(&offset_m); err != nil {
+			return nil, err
+		}
+		items = append(items, offset_m)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRunsToBackfill = `-- name: ListRunsToBackfill :many
+SELECT
+    tr.run_id,
+    tr.train_no,
+    tr.run_date,
+    tr.last_known_lat_u6,
+    tr.last_known_lng_u6,
+    tr.last_updated_sno,
+    tr.last_update_timestamp_ISO,
+    COALESCE(tr.errors, '{}') AS errors,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.has_started,
+    ts.schedule_id,
+    ts.origin_station_code AS source_station,
+    ts.terminus_station_code AS destination_station,
+    COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) AS origin_sch_departure_min,
+    CAST(t.priority AS INTEGER) AS priority,
+    t.train_type
+FROM train_runs tr
+JOIN train_schedules ts
+    ON tr.schedule_id = ts.schedule_id
+JOIN trains t
+    ON t.train_no = tr.train_no
+WHERE tr.run_date BETWEEN ?1 AND ?2
+  AND tr.current_status NOT IN ('not_running_today', 'cancelled')
+  AND NOT EXISTS (
+      SELECT 1
+      FROM train_run_station_events e
+      WHERE e.run_id = tr.run_id
+  )
+ORDER BY tr.run_date, tr.train_no
+`
+
+type ListRunsToBackfillParams struct {
+	FromDate string `json:"from_date"`
+	ToDate   string `json:"to_date"`
+}
+
+type ListRunsToBackfillRow struct {
+	RunID                  string         `json:"run_id"`
+	TrainNo                int64          `json:"train_no"`
+	RunDate                string         `json:"run_date"`
+	LastKnownLatU6         sql.NullInt64  `json:"last_known_lat_u6"`
+	LastKnownLngU6         sql.NullInt64  `json:"last_known_lng_u6"`
+	LastUpdatedSno         sql.NullString `json:"last_updated_sno"`
+	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
+	Errors                 db.RunErrors   `json:"errors"`
+	CurrentStatus          string         `json:"current_status"`
+	CurrentDelayMin        sql.NullInt64  `json:"current_delay_min"`
+	HasStarted             int64          `json:"has_started"`
+	ScheduleID             int64          `json:"schedule_id"`
+	SourceStation          string         `json:"source_station"`
+	DestinationStation     string         `json:"destination_station"`
+	OriginSchDepartureMin  int64          `json:"origin_sch_departure_min"`
+	Priority               int64          `json:"priority"`
+	TrainType              string         `json:"train_type"`
+}
+
+// Runs in [from_date, to_date] that never recorded a station, skipping runs upstream said were not running
+func (q *Queries) ListRunsToBackfill(ctx context.Context, arg ListRunsToBackfillParams) ([]ListRunsToBackfillRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRunsToBackfill, arg.FromDate, arg.ToDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRunsToBackfillRow{}
+	for rows.Next() {
+		var i ListRunsToBackfillRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.TrainNo,
+			&i.RunDate,
+			&i.LastKnownLatU6,
+			&i.LastKnownLngU6,
+			&i.LastUpdatedSno,
+			&i.LastUpdateTimestampIso,
+			&i.Errors,
+			&i.CurrentStatus,
+			&i.CurrentDelayMin,
+			&i.HasStarted,
+			&i.ScheduleID,
+			&i.SourceStation,
+			&i.DestinationStation,
+			&i.OriginSchDepartureMin,
+			&i.Priority,
+			&i.TrainType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listRunsToPoll = `-- name: ListRunsToPoll :many
 SELECT
     tr.run_id,
@@ -120,37 +1002,66 @@ SELECT
     tr.last_updated_sno,
     tr.last_update_timestamp_ISO,
     COALESCE(tr.errors, '{}') AS errors,
+    tr.current_status,
+    tr.current_delay_min,
+    tr.has_started,
     ts.schedule_id,
     ts.origin_station_code AS source_station,
-    ts.terminus_station_code AS destination_station
+    ts.terminus_station_code AS destination_station,
+    COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) AS origin_sch_departure_min,
+    CAST(t.priority AS INTEGER) AS priority,
+    t.train_type
 FROM train_runs tr
 JOIN train_schedules ts
     ON tr.schedule_id = ts.schedule_id
+JOIN trains t
+    ON t.train_no = tr.train_no
 WHERE tr.has_arrived = 0
   AND date(tr.run_date) <= date(?1)
   AND date(tr.run_date) >= date(?1, '-5 days')
   AND COALESCE(json_extract(tr.errors, '$.static_response.count'), 0)
         < CAST(?2 AS INTEGER)
-  AND (
-        COALESCE(json_extract(tr.errors, '$.static_response.count'), 0) +
-        COALESCE(json_extract(tr.errors, '$.api_error.count'), 0) +
-        COALESCE(json_extract(tr.errors, '$.unknown.count'), 0)
-      ) < CAST(?3 AS INTEGER)
+  -- a rescheduled run waits for its revised departure
   AND datetime(
-        tr.run_date || ' ' ||
-        printf(
-            '%02d:%02d',
-            ts.origin_sch_departure_min / 60,
-            ts.origin_sch_departure_min % 60
-        )
+        tr.run_date,
+        '+' || COALESCE(tr.revised_departure_min, ts.origin_sch_departure_min) || ' minutes'
       ) <= datetime(?1)
-ORDER BY tr.last_update_timestamp_ISO ASC NULLS FIRST
+  -- while upstream reports the run under an alias the canonical number is left alone,
+  -- polling it would only bring back not_running_today
+  AND NOT EXISTS (
+        SELECT 1
+        FROM train_aliases ta
+        JOIN train_runs ar
+            ON ar.train_no = ta.alias_train_no
+            AND ar.run_date = tr.run_date
+        WHERE ta.train_no = tr.train_no
+          AND datetime(ar.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+      )
+  -- runs not worth polling every cycle or backing off are put off, see poller.nextPoll
+  AND (tr.next_poll_at IS NULL OR tr.next_poll_at <= ?3)
+  -- with leases each instance polls its own runs, an empty owner polls every run
+  AND (?4 = '' OR (tr.lease_owner = ?4 AND tr.lease_expires_at >= ?3))
+-- moving runs before ones yet to start, then premium trains first, so a cycle that
+-- cannot fit every run leaves out pre-departure checks and then the local ones. The
+-- first cycle after a restart puts moving runs not heard from since catch_up_before
+-- (UTC) ahead of the rest, an empty value orders them as usual.
+ORDER BY tr.has_started DESC,
+    CASE
+        WHEN ?5 = '' THEN 0
+        WHEN tr.last_update_timestamp_ISO IS NULL
+          OR datetime(tr.last_update_timestamp_ISO) < datetime(?5) THEN 0
+        ELSE 1
+    END,
+    priority,
+    tr.last_update_timestamp_ISO ASC NULLS FIRST
 `
 
 type ListRunsToPollParams struct {
 	NowTs                   interface{} `json:"now_ts"`
 	StaticResponseThreshold int64       `json:"static_response_threshold"`
-	TotalErrorThreshold     int64       `json:"total_error_threshold"`
+	NowUtc                  string      `json:"now_utc"`
+	LeaseOwner              string      `json:"lease_owner"`
+	CatchUpBefore           string      `json:"catch_up_before"`
 }
 
 type ListRunsToPollRow struct {
@@ -162,14 +1073,28 @@ type ListRunsToPollRow struct {
 	LastUpdatedSno         sql.NullString `json:"last_updated_sno"`
 	LastUpdateTimestampIso sql.NullString `json:"last_update_timestamp_iso"`
 	Errors                 db.RunErrors   `json:"errors"`
+	CurrentStatus          string         `json:"current_status"`
+	CurrentDelayMin        sql.NullInt64  `json:"current_delay_min"`
+	HasStarted             int64          `json:"has_started"`
 	ScheduleID             int64          `json:"schedule_id"`
 	SourceStation          string         `json:"source_station"`
 	DestinationStation     string         `json:"destination_station"`
+	OriginSchDepartureMin  int64          `json:"origin_sch_departure_min"`
+	Priority               int64          `json:"priority"`
+	TrainType              string         `json:"train_type"`
 }
 
-// Fetch active runs with error threshold and start-time gating
+// Fetch active runs with static response threshold and start-time gating, started runs
+// first and then by priority tier. Runs failing with errors are backed off through
+// next_poll_at instead.
 func (q *Queries) ListRunsToPoll(ctx context.Context, arg ListRunsToPollParams) ([]ListRunsToPollRow, error) {
-	rows, err := q.db.QueryContext(ctx, listRunsToPoll, arg.NowTs, arg.StaticResponseThreshold, arg.TotalErrorThreshold)
+	rows, err := q.db.QueryContext(ctx, listRunsToPoll,
+		arg.NowTs,
+		arg.StaticResponseThreshold,
+		arg.NowUtc,
+		arg.LeaseOwner,
+		arg.CatchUpBefore,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -186,9 +1111,79 @@ func (q *Queries) ListRunsToPoll(ctx context.Context, arg ListRunsToPollParams)
 			&i.LastUpdatedSno,
 			&i.LastUpdateTimestampIso,
 			&i.Errors,
+			&i.CurrentStatus,
+			&i.CurrentDelayMin,
+			&i.HasStarted,
 			&i.ScheduleID,
 			&i.SourceStation,
 			&i.DestinationStation,
+			&i.OriginSchDepartureMin,
+			&i.Priority,
+			&i.TrainType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStalledRuns = `-- name: ListStalledRuns :many
+SELECT
+    tr.run_id,
+    tr.last_known_distance_km_u4 AS distance_km_u4,
+    (
+        SELECT l2.segment_station_code
+        FROM train_run_locations l2
+        WHERE l2.run_id = tr.run_id
+        ORDER BY l2.timestamp_ISO DESC
+        LIMIT 1
+    ) AS station_code,
+    CAST(MIN(l.timestamp_ISO) AS TEXT) AS stalled_since
+FROM train_runs tr
+JOIN train_run_locations l ON l.run_id = tr.run_id
+WHERE tr.has_started = 1
+  AND tr.has_arrived = 0
+  AND tr.last_known_distance_km_u4 IS NOT NULL
+  AND datetime(tr.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+  AND l.distance_km_u4 >= tr.last_known_distance_km_u4 - ?1
+GROUP BY tr.run_id
+HAVING datetime(MIN(l.timestamp_ISO)) <= datetime(?2)
+`
+
+type ListStalledRunsParams struct {
+	ToleranceU4   interface{} `json:"tolerance_u4"`
+	StalledBefore interface{} `json:"stalled_before"`
+}
+
+type ListStalledRunsRow struct {
+	RunID        string         `json:"run_id"`
+	DistanceKmU4 sql.NullInt64  `json:"distance_km_u4"`
+	StationCode  sql.NullString `json:"station_code"`
+	StalledSince string         `json:"stalled_since"`
+}
+
+// Returns running, still reporting runs that first reached their current distance before stalled_before (UTC)
+func (q *Queries) ListStalledRuns(ctx context.Context, arg ListStalledRunsParams) ([]ListStalledRunsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStalledRuns, arg.ToleranceU4, arg.StalledBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStalledRunsRow{}
+	for rows.Next() {
+		var i ListStalledRunsRow
+		if err := rows.Scan(
+			&i.RunID,
+			&i.DistanceKmU4,
+			&i.StationCode,
+			&i.StalledSince,
 		); err != nil {
 			return nil, err
 		}
@@ -213,6 +1208,11 @@ INSERT INTO train_run_locations (
     distance_km_u4,
     segment_station_code,
     at_station,
+    offset_m,
+    speed_kmh,
+    avg_speed_kmh,
+    smoothed_lat_u6,
+    smoothed_lng_u6,
     timestamp_ISO
 ) VALUES (
     ?1,
@@ -223,21 +1223,31 @@ INSERT INTO train_run_locations (
     ?6,
     ?7,
     ?8,
-    ?9
+    ?9,
+    ?10,
+    ?11,
+    ?12,
+    ?13,
+    ?14
 )
 ON CONFLICT(run_id, timestamp_ISO) DO NOTHING
 `
 
 type LogRunLocationParams struct {
-	RunID              string        `json:"run_id"`
-	LatU6              int64         `json:"lat_u6"`
-	LngU6              int64         `json:"lng_u6"`
-	SnappedLatU6       sql.NullInt64 `json:"snapped_lat_u6"`
-	SnappedLngU6       sql.NullInt64 `json:"snapped_lng_u6"`
-	DistanceKmU4       int64         `json:"distance_km_u4"`
-	SegmentStationCode string        `json:"segment_station_code"`
-	AtStation          int64         `json:"at_station"`
-	TimestampIso       string        `json:"timestamp_iso"`
+	RunID              string          `json:"run_id"`
+	LatU6              int64           `json:"lat_u6"`
+	LngU6              int64           `json:"lng_u6"`
+	SnappedLatU6       sql.NullInt64   `json:"snapped_lat_u6"`
+	SnappedLngU6       sql.NullInt64   `json:"snapped_lng_u6"`
+	DistanceKmU4       int64           `json:"distance_km_u4"`
+	SegmentStationCode string          `json:"segment_station_code"`
+	AtStation          int64           `json:"at_station"`
+	OffsetM            sql.NullInt64   `json:"offset_m"`
+	SpeedKmh           sql.NullFloat64 `json:"speed_kmh"`
+	AvgSpeedKmh        sql.NullFloat64 `json:"avg_speed_kmh"`
+	SmoothedLatU6      sql.NullInt64   `json:"smoothed_lat_u6"`
+	SmoothedLngU6      sql.NullInt64   `json:"smoothed_lng_u6"`
+	TimestampIso       string          `json:"timestamp_iso"`
 }
 
 func (q *Queries) LogRunLocation(ctx context.Context, arg LogRunLocationParams) error {
@@ -250,11 +1260,422 @@ func (q *Queries) LogRunLocation(ctx context.Context, arg LogRunLocationParams)
 		arg.DistanceKmU4,
 		arg.SegmentStationCode,
 		arg.AtStation,
+		arg.OffsetM,
+		arg.SpeedKmh,
+		arg.AvgSpeedKmh,
+		arg.SmoothedLatU6,
+		arg.SmoothedLngU6,
 		arg.TimestampIso,
 	)
 	return err
 }
 
+const mergeRunStatus = `-- name: MergeRunStatus :exec
+UPDATE train_runs
+SET
+    has_started = ar.has_started,
+    has_arrived = ar.has_arrived,
+    current_status = ar.current_status,
+    last_known_lat_u6 = ar.last_known_lat_u6,
+    last_known_lng_u6 = ar.last_known_lng_u6,
+    last_known_snapped_lat_u6 = ar.last_known_snapped_lat_u6,
+    last_known_snapped_lng_u6 = ar.last_known_snapped_lng_u6,
+    last_route_frac_u4 = ar.last_route_frac_u4,
+    last_bearing_deg = ar.last_bearing_deg,
+    last_known_distance_km_u4 = ar.last_known_distance_km_u4,
+    last_updated_sno = ar.last_updated_sno,
+    last_update_timestamp_ISO = ar.last_update_timestamp_ISO,
+    updated_at = CURRENT_TIMESTAMP
+FROM train_runs ar
+WHERE train_runs.run_id = ?1
+  AND ar.run_id = ?2
+  AND ar.last_update_timestamp_ISO IS NOT NULL
+  AND (
+        train_runs.last_update_timestamp_ISO IS NULL
+        OR datetime(ar.last_update_timestamp_ISO) > datetime(train_runs.last_update_timestamp_ISO)
+      )
+`
+
+type MergeRunStatusParams struct {
+	CanonicalRunID string `json:"canonical_run_id"`
+	AliasRunID     string `json:"alias_run_id"`
+}
+
+// Takes the alias run's live state when it is newer, a not_running_today the canonical
+// number got after the renumbering is overwritten this way
+func (q *Queries) MergeRunStatus(ctx context.Context, arg MergeRunStatusParams) error {
+	_, err := q.db.ExecContext(ctx, mergeRunStatus, arg.CanonicalRunID, arg.AliasRunID)
+	return err
+}
+
+const openRunAnomaly = `-- name: OpenRunAnomaly :execrows
+INSERT INTO run_anomalies (
+    run_id,
+    kind,
+    station_code,
+    distance_km_u4,
+    since_ts
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5
+)
+ON CONFLICT(run_id, kind) WHERE resolved_at IS NULL DO NOTHING
+`
+
+type OpenRunAnomalyParams struct {
+	RunID        string         `json:"run_id"`
+	Kind         string         `json:"kind"`
+	StationCode  sql.NullString `json:"station_code"`
+	DistanceKmU4 sql.NullInt64  `json:"distance_km_u4"`
+	SinceTs      string         `json:"since_ts"`
+}
+
+// Records a new anomaly episode unless one of the same kind is already open for the run
+func (q *Queries) OpenRunAnomaly(ctx context.Context, arg OpenRunAnomalyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, openRunAnomaly,
+		arg.RunID,
+		arg.Kind,
+		arg.StationCode,
+		arg.DistanceKmU4,
+		arg.SinceTs,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pruneFailedResponses = `-- name: PruneFailedResponses :execrows
+DELETE FROM upstream_failed_responses
+WHERE created_at < ?1
+`
+
+func (q *Queries) PruneFailedResponses(ctx context.Context, before string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneFailedResponses, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pruneRunDaySchedules = `-- name: PruneRunDaySchedules :execrows
+DELETE FROM upstream_day_schedules
+WHERE polled_at < ?1
+`
+
+func (q *Queries) PruneRunDaySchedules(ctx context.Context, before string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneRunDaySchedules, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recordRunPoll = `-- name: RecordRunPoll :exec
+INSERT INTO run_poll_stats (
+    run_id,
+    polls,
+    successful_polls,
+    window_sec,
+    first_poll_at,
+    last_poll_at
+) VALUES (
+    ?1,
+    1,
+    ?2,
+    ?3,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT(run_id) DO UPDATE SET
+    polls = polls + 1,
+    successful_polls = successful_polls + excluded.successful_polls,
+    window_sec = excluded.window_sec,
+    last_poll_at = CURRENT_TIMESTAMP
+`
+
+type RecordRunPollParams struct {
+	RunID      string `json:"run_id"`
+	Successful int64  `json:"successful"`
+	WindowSec  int64  `json:"window_sec"`
+}
+
+// Counts one poll attempt for the run
+func (q *Queries) RecordRunPoll(ctx context.Context, arg RecordRunPollParams) error {
+	_, err := q.db.ExecContext(ctx, recordRunPoll, arg.RunID, arg.Successful, arg.WindowSec)
+	return err
+}
+
+const releaseRunLeases = `-- name: ReleaseRunLeases :execrows
+UPDATE train_runs
+SET lease_owner = NULL,
+    lease_expires_at = NULL
+WHERE lease_owner = ?1
+`
+
+// Hands lease_owner's runs back, for other instances to claim straight away
+func (q *Queries) ReleaseRunLeases(ctx context.Context, leaseOwner string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, releaseRunLeases, leaseOwner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const releaseUnrenewedRunLeases = `-- name: ReleaseUnrenewedRunLeases :execrows
+UPDATE train_runs
+SET lease_owner = NULL,
+    lease_expires_at = NULL
+WHERE lease_owner = ?1
+  AND lease_expires_at < ?2
+`
+
+type ReleaseUnrenewedRunLeasesParams struct {
+	LeaseOwner string `json:"lease_owner"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+// Hands back the leases of lease_owner the last RenewRunLeases did not extend to
+// expires_at, so runs it will not poll stop counting towards its share
+func (q *Queries) ReleaseUnrenewedRunLeases(ctx context.Context, arg ReleaseUnrenewedRunLeasesParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, releaseUnrenewedRunLeases, arg.LeaseOwner, arg.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const renewRunLeases = `-- name: RenewRunLeases :execrows
+UPDATE train_runs
+SET lease_expires_at = ?1
+WHERE lease_owner = ?2
+  AND lease_expires_at >= ?3
+  AND run_id IN (
+    SELECT tr.run_id
+    FROM train_runs tr
+    WHERE tr.lease_owner = ?2
+      AND tr.has_arrived = 0
+      AND date(tr.run_date) >= date(?4, '-5 days')
+      AND COALESCE(json_extract(tr.errors, '$.static_response.count'), 0)
+            < CAST(?5 AS INTEGER)
+      AND NOT EXISTS (
+            SELECT 1
+            FROM train_aliases ta
+            JOIN train_runs ar
+                ON ar.train_no = ta.alias_train_no
+                AND ar.run_date = tr.run_date
+            WHERE ta.train_no = tr.train_no
+              AND datetime(ar.last_update_timestamp_ISO) > datetime('now', '-15 minutes')
+          )
+      AND (tr.next_poll_at IS NULL OR tr.next_poll_at <= ?1)
+  )
+`
+
+type RenewRunLeasesParams struct {
+	ExpiresAt               string `json:"expires_at"`
+	LeaseOwner              string `json:"lease_owner"`
+	NowUtc                  string `json:"now_utc"`
+	NowTs                   string `json:"now_ts"`
+	StaticResponseThreshold int64  `json:"static_response_threshold"`
+}
+
+// Heartbeat: extends the leases lease_owner holds on runs ListRunsToPoll would still
+// pick, backed off runs only while they come due before expires_at (UTC)
+func (q *Queries) RenewRunLeases(ctx context.Context, arg RenewRunLeasesParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, renewRunLeases,
+		arg.ExpiresAt,
+		arg.LeaseOwner,
+		arg.NowUtc,
+		arg.NowTs,
+		arg.StaticResponseThreshold,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resetStaleRuns = `-- name: ResetStaleRuns :execrows
+UPDATE train_runs
+SET next_poll_at = NULL,
+    extrapolated_lat_u6 = NULL,
+    extrapolated_lng_u6 = NULL,
+    extrapolated_at = NULL
+WHERE has_arrived = 0
+  AND has_started = 1
+  AND (
+        last_update_timestamp_ISO IS NULL
+        OR datetime(last_update_timestamp_ISO) < datetime(?1)
+      )
+`
+
+// Makes running runs not heard from since stale_before (UTC) due straight away and
+// drops their dead reckoned position, which would be extrapolated from a fix long gone
+func (q *Queries) ResetStaleRuns(ctx context.Context, staleBefore string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, resetStaleRuns, staleBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resolveRunAnomaly = `-- name: ResolveRunAnomaly :execrows
+UPDATE run_anomalies
+SET resolved_at = CURRENT_TIMESTAMP
+WHERE run_id = ?1
+  AND kind = ?2
+  AND resolved_at IS NULL
+`
+
+type ResolveRunAnomalyParams struct {
+	RunID string `json:"run_id"`
+	Kind  string `json:"kind"`
+}
+
+// Closes the run's open episode of kind, if any
+func (q *Queries) ResolveRunAnomaly(ctx context.Context, arg ResolveRunAnomalyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, resolveRunAnomaly, arg.RunID, arg.Kind)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resolveStalledAnomalies = `-- name: ResolveStalledAnomalies :execrows
+UPDATE run_anomalies
+SET resolved_at = CURRENT_TIMESTAMP
+WHERE kind = 'stalled'
+  AND resolved_at IS NULL
+  AND EXISTS (
+      SELECT 1
+      FROM train_runs tr
+      WHERE tr.run_id = run_anomalies.run_id
+        AND (
+            tr.has_arrived = 1
+            OR tr.last_known_distance_km_u4 > run_anomalies.distance_km_u4 + ?1
+        )
+  )
+`
+
+// Closes stalled episodes whose run has moved on or arrived
+func (q *Queries) ResolveStalledAnomalies(ctx context.Context, toleranceU4 interface{}) (int64, error) {
+	result, err := q.db.ExecContext(ctx, resolveStalledAnomalies, toleranceU4)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const saveUpstreamBudget = `-- name: SaveUpstreamBudget :exec
+INSERT INTO upstream_budgets (
+    name,
+    tokens,
+    saved_at,
+    blocked_until,
+    last_blocked_at,
+    blocks
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6
+)
+ON CONFLICT(name) DO UPDATE SET
+    tokens = excluded.tokens,
+    saved_at = excluded.saved_at,
+    blocked_until = excluded.blocked_until,
+    last_blocked_at = excluded.last_blocked_at,
+    blocks = excluded.blocks,
+    updated_at = CURRENT_TIMESTAMP
+`
+
+type SaveUpstreamBudgetParams struct {
+	Name          string         `json:"name"`
+	Tokens        float64        `json:"tokens"`
+	SavedAt       string         `json:"saved_at"`
+	BlockedUntil  sql.NullString `json:"blocked_until"`
+	LastBlockedAt sql.NullString `json:"last_blocked_at"`
+	Blocks        int64          `json:"blocks"`
+}
+
+func (q *Queries) SaveUpstreamBudget(ctx context.Context, arg SaveUpstreamBudgetParams) error {
+	_, err := q.db.ExecContext(ctx, saveUpstreamBudget,
+		arg.Name,
+		arg.Tokens,
+		arg.SavedAt,
+		arg.BlockedUntil,
+		arg.LastBlockedAt,
+		arg.Blocks,
+	)
+	return err
+}
+
+const scheduleRunPoll = `-- name: ScheduleRunPoll :exec
+UPDATE train_runs
+SET next_poll_at = ?1
+WHERE run_id = ?2
+  AND next_poll_at IS NOT ?1
+`
+
+type ScheduleRunPollParams struct {
+	NextPollAt sql.NullString `json:"next_poll_at"`
+	RunID      string         `json:"run_id"`
+}
+
+// Sets when the poller next looks at a run, NULL for every cycle. Leaves updated_at
+// alone, nothing a client sees changed.
+func (q *Queries) ScheduleRunPoll(ctx context.Context, arg ScheduleRunPollParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleRunPoll, arg.NextPollAt, arg.RunID)
+	return err
+}
+
+const setRunRevisedDeparture = `-- name: SetRunRevisedDeparture :exec
+UPDATE train_runs
+SET revised_departure_min = ?1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE run_id = ?2
+  AND revised_departure_min IS NOT ?1
+`
+
+type SetRunRevisedDepartureParams struct {
+	RevisedDepartureMin int64  `json:"revised_departure_min"`
+	RunID               string `json:"run_id"`
+}
+
+// Records the origin departure upstream rescheduled the run to, in minutes after
+// midnight of run_date
+func (q *Queries) SetRunRevisedDeparture(ctx context.Context, arg SetRunRevisedDepartureParams) error {
+	_, err := q.db.ExecContext(ctx, setRunRevisedDeparture, arg.RevisedDepartureMin, arg.RunID)
+	return err
+}
+
+const setStationCoordinates = `-- name: SetStationCoordinates :exec
+UPDATE stations
+SET
+    lat = ?1,
+    lng = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE station_code = ?3
+  AND (lat IS NULL OR lng IS NULL)
+`
+
+type SetStationCoordinatesParams struct {
+	Lat         sql.NullFloat64 `json:"lat"`
+	Lng         sql.NullFloat64 `json:"lng"`
+	StationCode string          `json:"station_code"`
+}
+
+// Fills in station coordinates from live status data where the timetable source had none
+func (q *Queries) SetStationCoordinates(ctx context.Context, arg SetStationCoordinatesParams) error {
+	_, err := q.db.ExecContext(ctx, setStationCoordinates, arg.Lat, arg.Lng, arg.StationCode)
+	return err
+}
+
 const updateRunStatus = `-- name: UpdateRunStatus :exec
 UPDATE train_runs
 SET
@@ -265,31 +1686,46 @@ SET
     last_known_lng_u6 = COALESCE(?5, last_known_lng_u6),
     last_known_snapped_lat_u6 = COALESCE(?6, last_known_snapped_lat_u6),
     last_known_snapped_lng_u6 = COALESCE(?7, last_known_snapped_lng_u6),
-    last_route_frac_u4 = COALESCE(?8, last_route_frac_u4),
+    -- the route position of a diverted run means nothing until it is back on its route
+    last_route_frac_u4 = CASE
+        WHEN ?3 = 'diverted' THEN NULL
+        ELSE COALESCE(?8, last_route_frac_u4)
+    END,
     last_bearing_deg = COALESCE(?9, last_bearing_deg),
-    last_known_distance_km_u4 = COALESCE(?10, last_known_distance_km_u4),
-    errors = COALESCE(?11, errors),
-    last_updated_sno = COALESCE(?12, last_updated_sno),
-    last_update_timestamp_ISO = COALESCE(?13, last_update_timestamp_ISO),
+    -- a new snapped fix replaces any dead reckoned position
+    extrapolated_lat_u6 = CASE WHEN ?6 IS NULL THEN extrapolated_lat_u6 END,
+    extrapolated_lng_u6 = CASE WHEN ?6 IS NULL THEN extrapolated_lng_u6 END,
+    extrapolated_at = CASE WHEN ?6 IS NULL THEN extrapolated_at END,
+    -- speeds belong to the fix they were worked out for
+    speed_kmh = CASE WHEN ?6 IS NULL THEN speed_kmh ELSE ?10 END,
+    avg_speed_kmh = CASE WHEN ?6 IS NULL THEN avg_speed_kmh ELSE ?11 END,
+    last_known_distance_km_u4 = COALESCE(?12, last_known_distance_km_u4),
+    current_delay_min = COALESCE(?13, current_delay_min),
+    errors = COALESCE(?14, errors),
+    last_updated_sno = COALESCE(?15, last_updated_sno),
+    last_update_timestamp_ISO = COALESCE(?16, last_update_timestamp_ISO),
     updated_at = CURRENT_TIMESTAMP
-WHERE run_id = ?14
+WHERE run_id = ?17
 `
 
 type UpdateRunStatusParams struct {
-	HasStarted     int64          `json:"has_started"`
-	HasArrived     int64          `json:"has_arrived"`
-	CurrentStatus  interface{}    `json:"current_status"`
-	LatU6          sql.NullInt64  `json:"lat_u6"`
-	LngU6          sql.NullInt64  `json:"lng_u6"`
-	SnappedLatU6   sql.NullInt64  `json:"snapped_lat_u6"`
-	SnappedLngU6   sql.NullInt64  `json:"snapped_lng_u6"`
-	RouteFracU4    sql.NullInt64  `json:"route_frac_u4"`
-	BearingDeg     sql.NullInt64  `json:"bearing_deg"`
-	DistanceKmU4   sql.NullInt64  `json:"distance_km_u4"`
-	Errors         db.RunErrors   `json:"errors"`
-	LastUpdatedSno sql.NullString `json:"last_updated_sno"`
-	LastUpdateIso  sql.NullString `json:"last_update_iso"`
-	RunID          string         `json:"run_id"`
+	HasStarted      sql.NullInt64   `json:"has_started"`
+	HasArrived      sql.NullInt64   `json:"has_arrived"`
+	CurrentStatus   interface{}     `json:"current_status"`
+	LatU6           sql.NullInt64   `json:"lat_u6"`
+	LngU6           sql.NullInt64   `json:"lng_u6"`
+	SnappedLatU6    sql.NullInt64   `json:"snapped_lat_u6"`
+	SnappedLngU6    sql.NullInt64   `json:"snapped_lng_u6"`
+	RouteFracU4     sql.NullInt64   `json:"route_frac_u4"`
+	BearingDeg      sql.NullInt64   `json:"bearing_deg"`
+	SpeedKmh        sql.NullFloat64 `json:"speed_kmh"`
+	AvgSpeedKmh     sql.NullFloat64 `json:"avg_speed_kmh"`
+	DistanceKmU4    sql.NullInt64   `json:"distance_km_u4"`
+	CurrentDelayMin sql.NullInt64   `json:"current_delay_min"`
+	Errors          db.RunErrors    `json:"errors"`
+	LastUpdatedSno  sql.NullString  `json:"last_updated_sno"`
+	LastUpdateIso   sql.NullString  `json:"last_update_iso"`
+	RunID           string          `json:"run_id"`
 }
 
 // Partial, idempotent update of run state
@@ -304,7 +1740,10 @@ func (q *Queries) UpdateRunStatus(ctx context.Context, arg UpdateRunStatusParams
 		arg.SnappedLngU6,
 		arg.RouteFracU4,
 		arg.BearingDeg,
+		arg.SpeedKmh,
+		arg.AvgSpeedKmh,
 		arg.DistanceKmU4,
+		arg.CurrentDelayMin,
 		arg.Errors,
 		arg.LastUpdatedSno,
 		arg.LastUpdateIso,
@@ -312,3 +1751,158 @@ func (q *Queries) UpdateRunStatus(ctx context.Context, arg UpdateRunStatusParams
 	)
 	return err
 }
+
+const upsertRunDaySchedule = `-- name: UpsertRunDaySchedule :exec
+INSERT INTO upstream_day_schedules (
+    run_id,
+    body_gzip,
+    body_bytes,
+    stations
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4
+)
+ON CONFLICT(run_id) DO UPDATE SET
+    body_gzip = excluded.body_gzip,
+    body_bytes = excluded.body_bytes,
+    stations = excluded.stations,
+    polled_at = CURRENT_TIMESTAMP
+`
+
+type UpsertRunDayScheduleParams struct {
+	RunID     string `json:"run_id"`
+	BodyGzip  []byte `json:"body_gzip"`
+	BodyBytes int64  `json:"body_bytes"`
+	Stations  int64  `json:"stations"`
+}
+
+// Keeps the run's latest days_schedule, replacing the one before
+func (q *Queries) UpsertRunDaySchedule(ctx context.Context, arg UpsertRunDayScheduleParams) error {
+	_, err := q.db.ExecContext(ctx, upsertRunDaySchedule,
+		arg.RunID,
+		arg.BodyGzip,
+		arg.BodyBytes,
+		arg.Stations,
+	)
+	return err
+}
+
+const upsertRunPlatforms = `-- name: UpsertRunPlatforms :exec
+INSERT INTO train_run_platforms (
+    run_id,
+    station_code,
+    platform,
+    platform_info
+)
+SELECT
+    ?1,
+    json_extract(p.value, '$.station_code'),
+    json_extract(p.value, '$.platform'),
+    json_extract(p.value, '$.platform_info')
+FROM json_each(?2) p
+WHERE true
+ON CONFLICT(run_id, station_code) DO UPDATE SET
+    platform = COALESCE(excluded.platform, platform),
+    platform_info = COALESCE(excluded.platform_info, platform_info),
+    updated_at = CURRENT_TIMESTAMP
+WHERE COALESCE(excluded.platform, platform) IS NOT platform
+   OR COALESCE(excluded.platform_info, platform_info) IS NOT platform_info
+`
+
+type UpsertRunPlatformsParams struct {
+	RunID     string `json:"run_id"`
+	Platforms string `json:"platforms"`
+}
+
+// Records the platforms of a run from a JSON array of {station_code, platform,
+// platform_info} in one statement; known values are never cleared and unchanged rows
+// are left alone
+func (q *Queries) UpsertRunPlatforms(ctx context.Context, arg UpsertRunPlatformsParams) error {
+	_, err := q.db.ExecContext(ctx, upsertRunPlatforms, arg.RunID, arg.Platforms)
+	return err
+}
+
+const upsertRunStationEvent = `-- name: UpsertRunStationEvent :execrows
+INSERT INTO train_run_station_events (
+    run_id,
+    sno,
+    station_code,
+    distance_km_u4,
+    sch_arrival_tm,
+    act_arrival_tm,
+    sch_departure_tm,
+    act_departure_tm,
+    delay_arrival_min,
+    delay_departure_min,
+    departed
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    ?7,
+    ?8,
+    ?9,
+    ?10,
+    ?11
+)
+ON CONFLICT(run_id, station_code) DO UPDATE SET
+    sno = excluded.sno,
+    sch_arrival_tm = COALESCE(excluded.sch_arrival_tm, sch_arrival_tm),
+    act_arrival_tm = COALESCE(excluded.act_arrival_tm, act_arrival_tm),
+    sch_departure_tm = COALESCE(excluded.sch_departure_tm, sch_departure_tm),
+    act_departure_tm = COALESCE(excluded.act_departure_tm, act_departure_tm),
+    delay_arrival_min = COALESCE(excluded.delay_arrival_min, delay_arrival_min),
+    delay_departure_min = COALESCE(excluded.delay_departure_min, delay_departure_min),
+    departed = MAX(excluded.departed, departed),
+    updated_at = CURRENT_TIMESTAMP
+WHERE excluded.sno IS NOT sno
+   OR COALESCE(excluded.sch_arrival_tm, sch_arrival_tm) IS NOT sch_arrival_tm
+   OR COALESCE(excluded.act_arrival_tm, act_arrival_tm) IS NOT act_arrival_tm
+   OR COALESCE(excluded.sch_departure_tm, sch_departure_tm) IS NOT sch_departure_tm
+   OR COALESCE(excluded.act_departure_tm, act_departure_tm) IS NOT act_departure_tm
+   OR COALESCE(excluded.delay_arrival_min, delay_arrival_min) IS NOT delay_arrival_min
+   OR COALESCE(excluded.delay_departure_min, delay_departure_min) IS NOT delay_departure_min
+   OR excluded.departed > departed
+`
+
+type UpsertRunStationEventParams struct {
+	RunID             string        `json:"run_id"`
+	Sno               int64         `json:"sno"`
+	StationCode       string        `json:"station_code"`
+	DistanceKmU4      int64         `json:"distance_km_u4"`
+	SchArrivalTm      sql.NullInt64 `json:"sch_arrival_tm"`
+	ActArrivalTm      sql.NullInt64 `json:"act_arrival_tm"`
+	SchDepartureTm    sql.NullInt64 `json:"sch_departure_tm"`
+	ActDepartureTm    sql.NullInt64 `json:"act_departure_tm"`
+	DelayArrivalMin   sql.NullInt64 `json:"delay_arrival_min"`
+	DelayDepartureMin sql.NullInt64 `json:"delay_departure_min"`
+	Departed          int64         `json:"departed"`
+}
+
+// Records actuals for a station the run has reached; known values are never cleared.
+// Upstream corrections replace what was stored, a station that reports nothing new is
+// left alone and counts no row.
+func (q *Queries) UpsertRunStationEvent(ctx context.Context, arg UpsertRunStationEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upsertRunStationEvent,
+		arg.RunID,
+		arg.Sno,
+		arg.StationCode,
+		arg.DistanceKmU4,
+		arg.SchArrivalTm,
+		arg.ActArrivalTm,
+		arg.SchDepartureTm,
+		arg.ActDepartureTm,
+		arg.DelayArrivalMin,
+		arg.DelayDepartureMin,
+		arg.Departed,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
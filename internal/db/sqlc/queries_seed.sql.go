@@ -10,6 +10,60 @@ import (
 	"database/sql"
 )
 
+const countTrackedTrains = `-- name: CountTrackedTrains :one
+SELECT COUNT(*) AS total
+FROM tracked_trains
+`
+
+func (q *Queries) CountTrackedTrains(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTrackedTrains)
+	var total int64
+	err := row.Scan(&total)
+	return total, err
+}
+
+const deleteTrackedTrain = `-- name: DeleteTrackedTrain :execrows
+DELETE FROM tracked_trains
+WHERE id = ?1
+`
+
+func (q *Queries) DeleteTrackedTrain(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTrackedTrain, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteTrainCoaches = `-- name: DeleteTrainCoaches :exec
+DELETE FROM train_coaches
+WHERE train_no = ?1
+`
+
+func (q *Queries) DeleteTrainCoaches(ctx context.Context, trainNo int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTrainCoaches, trainNo)
+	return err
+}
+
+const fillTrackedTrainNo = `-- name: FillTrackedTrainNo :exec
+UPDATE tracked_trains
+SET train_no = ?1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE source_url = ?2
+  AND train_no IS NULL
+`
+
+type FillTrackedTrainNoParams struct {
+	TrainNo   int64  `json:"train_no"`
+	SourceUrl string `json:"source_url"`
+}
+
+// pages added without a number learn it from their first sync
+func (q *Queries) FillTrackedTrainNo(ctx context.Context, arg FillTrackedTrainNoParams) error {
+	_, err := q.db.ExecContext(ctx, fillTrackedTrainNo, arg.TrainNo, arg.SourceUrl)
+	return err
+}
+
 const generateRunsForDate = `-- name: GenerateRunsForDate :exec
 INSERT INTO train_runs (
     run_id,
@@ -40,6 +94,147 @@ func (q *Queries) GenerateRunsForDate(ctx context.Context, arg GenerateRunsForDa
 	return err
 }
 
+const getTrackedTrain = `-- name: GetTrackedTrain :one
+SELECT id, source_url, train_no, enabled, note, created_at, updated_at
+FROM tracked_trains
+WHERE id = ?1
+`
+
+func (q *Queries) GetTrackedTrain(ctx context.Context, id int64) (TrackedTrain, error) {
+	row := q.db.QueryRowContext(ctx, getTrackedTrain, id)
+	var i TrackedTrain
+	err := row.Scan(
+		&i.ID,
+		&i.SourceUrl,
+		&i.TrainNo,
+		&i.Enabled,
+		&i.Note,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const insertTrainCoach = `-- name: InsertTrainCoach :exec
+INSERT INTO train_coaches (train_no, position, coach_code, class, kind)
+VALUES (?1, ?2, ?3, ?4, ?5)
+`
+
+type InsertTrainCoachParams struct {
+	TrainNo   int64          `json:"train_no"`
+	Position  int64          `json:"position"`
+	CoachCode string         `json:"coach_code"`
+	Class     sql.NullString `json:"class"`
+	Kind      string         `json:"kind"`
+}
+
+func (q *Queries) InsertTrainCoach(ctx context.Context, arg InsertTrainCoachParams) error {
+	_, err := q.db.ExecContext(ctx, insertTrainCoach,
+		arg.TrainNo,
+		arg.Position,
+		arg.CoachCode,
+		arg.Class,
+		arg.Kind,
+	)
+	return err
+}
+
+const listTrackedTrainURLs = `-- name: ListTrackedTrainURLs :many
+SELECT source_url
+FROM tracked_trains
+WHERE enabled = 1
+ORDER BY id
+`
+
+func (q *Queries) ListTrackedTrainURLs(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listTrackedTrainURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var source_url string
+		if err := rows.Scan(&source_url); err != nil {
+			return nil, err
+		}
+		items = append(items, source_url)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrackedTrains = `-- name: ListTrackedTrains :many
+SELECT id, source_url, train_no, enabled, note, created_at, updated_at
+FROM tracked_trains
+ORDER BY id
+`
+
+func (q *Queries) ListTrackedTrains(ctx context.Context) ([]TrackedTrain, error) {
+	rows, err := q.db.QueryContext(ctx, listTrackedTrains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []TrackedTrain{}
+	for rows.Next() {
+		var i TrackedTrain
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceUrl,
+			&i.TrainNo,
+			&i.Enabled,
+			&i.Note,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateTrackedTrain = `-- name: UpdateTrackedTrain :execrows
+UPDATE tracked_trains
+SET enabled = COALESCE(?1, enabled),
+    train_no = COALESCE(?2, train_no),
+    note = COALESCE(?3, note),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?4
+`
+
+type UpdateTrackedTrainParams struct {
+	Enabled sql.NullInt64  `json:"enabled"`
+	TrainNo sql.NullInt64  `json:"train_no"`
+	Note    sql.NullString `json:"note"`
+	ID      int64          `json:"id"`
+}
+
+func (q *Queries) UpdateTrackedTrain(ctx context.Context, arg UpdateTrackedTrainParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateTrackedTrain,
+		arg.Enabled,
+		arg.TrainNo,
+		arg.Note,
+		arg.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const upsertStation = `-- name: UpsertStation :exec
 INSERT INTO stations (
     station_code,
@@ -76,8 +271,9 @@ ON CONFLICT(station_code) DO UPDATE SET
     division = excluded.division,
     address = excluded.address,
     elevation_m = excluded.elevation_m,
-    lat = excluded.lat,
-    lng = excluded.lng,
+    -- IRI has no coordinates, keep the ones learned from live status
+    lat = COALESCE(excluded.lat, lat),
+    lng = COALESCE(excluded.lng, lng),
     number_of_platforms = excluded.number_of_platforms,
     station_type = excluded.station_type,
     station_category = excluded.station_category,
@@ -118,6 +314,53 @@ func (q *Queries) UpsertStation(ctx context.Context, arg UpsertStationParams) er
 	return err
 }
 
+const upsertTrackedTrain = `-- name: UpsertTrackedTrain :one
+INSERT INTO tracked_trains (
+    source_url,
+    train_no,
+    enabled,
+    note
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4
+)
+ON CONFLICT(source_url) DO UPDATE SET
+    train_no = COALESCE(excluded.train_no, tracked_trains.train_no),
+    enabled = excluded.enabled,
+    note = COALESCE(excluded.note, tracked_trains.note),
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, source_url, train_no, enabled, note, created_at, updated_at
+`
+
+type UpsertTrackedTrainParams struct {
+	SourceUrl string         `json:"source_url"`
+	TrainNo   sql.NullInt64  `json:"train_no"`
+	Enabled   int64          `json:"enabled"`
+	Note      sql.NullString `json:"note"`
+}
+
+func (q *Queries) UpsertTrackedTrain(ctx context.Context, arg UpsertTrackedTrainParams) (TrackedTrain, error) {
+	row := q.db.QueryRowContext(ctx, upsertTrackedTrain,
+		arg.SourceUrl,
+		arg.TrainNo,
+		arg.Enabled,
+		arg.Note,
+	)
+	var i TrackedTrain
+	err := row.Scan(
+		&i.ID,
+		&i.SourceUrl,
+		&i.TrainNo,
+		&i.Enabled,
+		&i.Note,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const upsertTrain = `-- name: UpsertTrain :exec
 INSERT INTO trains (
     train_no,
@@ -175,6 +418,68 @@ func (q *Queries) UpsertTrain(ctx context.Context, arg UpsertTrainParams) error
 	return err
 }
 
+const upsertTrainAlias = `-- name: UpsertTrainAlias :exec
+INSERT INTO train_aliases (
+    alias_train_no,
+    train_no
+) VALUES (
+    ?1,
+    ?2
+)
+ON CONFLICT(alias_train_no) DO UPDATE SET
+    train_no = excluded.train_no
+`
+
+type UpsertTrainAliasParams struct {
+	AliasTrainNo int64 `json:"alias_train_no"`
+	TrainNo      int64 `json:"train_no"`
+}
+
+func (q *Queries) UpsertTrainAlias(ctx context.Context, arg UpsertTrainAliasParams) error {
+	_, err := q.db.ExecContext(ctx, upsertTrainAlias, arg.AliasTrainNo, arg.TrainNo)
+	return err
+}
+
+const upsertTrainLink = `-- name: UpsertTrainLink :exec
+INSERT INTO train_links (
+    train_no,
+    linked_train_no,
+    kind,
+    from_station_code,
+    to_station_code
+) VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5
+)
+ON CONFLICT(train_no, linked_train_no) DO UPDATE SET
+    kind = excluded.kind,
+    from_station_code = excluded.from_station_code,
+    to_station_code = excluded.to_station_code,
+    updated_at = CURRENT_TIMESTAMP
+`
+
+type UpsertTrainLinkParams struct {
+	TrainNo         int64          `json:"train_no"`
+	LinkedTrainNo   int64          `json:"linked_train_no"`
+	Kind            string         `json:"kind"`
+	FromStationCode sql.NullString `json:"from_station_code"`
+	ToStationCode   sql.NullString `json:"to_station_code"`
+}
+
+func (q *Queries) UpsertTrainLink(ctx context.Context, arg UpsertTrainLinkParams) error {
+	_, err := q.db.ExecContext(ctx, upsertTrainLink,
+		arg.TrainNo,
+		arg.LinkedTrainNo,
+		arg.Kind,
+		arg.FromStationCode,
+		arg.ToStationCode,
+	)
+	return err
+}
+
 const upsertTrainRoute = `-- name: UpsertTrainRoute :exec
 INSERT INTO train_routes (
     schedule_id,
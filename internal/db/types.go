@@ -61,3 +61,11 @@ func (r RunErrors) Value() (driver.Value, error) {
 	}
 	return string(b), nil
 }
+
+// PlatformShare is one platform riders reported a run at, train_run_platforms keeps a
+// JSON array of them per station
+type PlatformShare struct {
+	Platform      string   `json:"platform"`
+	Percentage    *float64 `json:"percentage"` // of the reports for this station
+	FeedbackCount *int     `json:"feedback_count"`
+}
@@ -0,0 +1,377 @@
+// Package graphql runs GraphQL queries against a schema of resolver functions. It
+// covers what clients send for reads: fields with arguments and aliases, variables,
+// fragments and @skip/@include. Mutations, subscriptions and introspection are not
+// supported; the schema is published as SDL instead.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// maxDepth bounds how deep a query may nest, so one request cannot fan out unbounded
+const maxDepth = 12
+
+// Object is an object type. Fields keep their order in the SDL.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+// Field is a field of an object. Type is written as in SDL ("Int!", "[Stop!]!"),
+// Object is set for fields of object or list of object type. A nil Resolve reads
+// the field from the source by its json name.
+type Field struct {
+	Name        string
+	Type        string
+	Description string
+	Args        []Arg
+	Object      *Object
+	Resolve     func(p Params) (any, error)
+}
+
+// Arg is a field argument, Default is used when the query leaves it out
+type Arg struct {
+	Name        string
+	Type        string
+	Default     any
+	Description string
+}
+
+// Params is what a resolver gets: the value of the parent object and the coerced
+// arguments (int64, float64, string, bool or []any, nil when null or left out)
+type Params struct {
+	Ctx    context.Context
+	Source any
+	Args   map[string]any
+}
+
+// Schema is the entry point of queries
+type Schema struct {
+	Query *Object
+}
+
+// Request is a query as POSTed, or as the query and variables URL params
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Response is written back as it is. Data is left out when the query never ran.
+type Response struct {
+	Data   *orderedMap `json:"data,omitempty"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Execute validates and runs a query. A query that does not parse or validate has
+// no data, resolver errors null their field and are listed next to the data.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	if op.kind != "query" {
+		return Response{Errors: []Error{{Message: op.kind + " operations are not supported"}}}
+	}
+	vars, err := coerceVariables(op.variables, req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	e := &executor{ctx: ctx, doc: doc, vars: vars}
+	if errs := e.validate(s.Query, op.selection, 1); len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+	data := e.object(s.Query, nil, op.selection, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, errors.New("operationName is required for a document with several operations")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+type executor struct {
+	ctx    context.Context
+	doc    *document
+	vars   map[string]any
+	errors []Error
+}
+
+// collect flattens fragments and drops skipped selections, keeping the first field
+// of each response key with the sub-selections of its repeats merged in
+func (e *executor) collect(obj *Object, sels []selection) ([]selection, error) {
+	var out []selection
+	index := map[string]int{}
+	var walk func(sels []selection, seen map[string]bool) error
+	walk = func(sels []selection, seen map[string]bool) error {
+		for _, sel := range sels {
+			include, err := e.included(sel.directives)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			switch {
+			case sel.spread != "":
+				frag, ok := e.doc.fragments[sel.spread]
+				if !ok {
+					return fmt.Errorf("line %d: unknown fragment %q", sel.line, sel.spread)
+				}
+				if seen[sel.spread] {
+					return fmt.Errorf("line %d: fragment %q spreads itself", sel.line, sel.spread)
+				}
+				if frag.typeCond != obj.Name {
+					return fmt.Errorf("line %d: fragment %q on %s cannot be spread in %s", sel.line, sel.spread, frag.typeCond, obj.Name)
+				}
+				seen[sel.spread] = true
+				if err := walk(frag.selection, seen); err != nil {
+					return err
+				}
+				delete(seen, sel.spread)
+			case sel.inline:
+				if sel.typeCond != "" && sel.typeCond != obj.Name {
+					return fmt.Errorf("line %d: fragment on %s cannot be spread in %s", sel.line, sel.typeCond, obj.Name)
+				}
+				if err := walk(sel.selection, seen); err != nil {
+					return err
+				}
+			default:
+				key := sel.responseKey()
+				if i, ok := index[key]; ok {
+					if out[i].name != sel.name {
+						return fmt.Errorf("line %d: %q selects both %s and %s", sel.line, key, out[i].name, sel.name)
+					}
+					out[i].selection = append(append([]selection{}, out[i].selection...), sel.selection...)
+					continue
+				}
+				index[key] = len(out)
+				out = append(out, sel)
+			}
+		}
+		return nil
+	}
+	return out, walk(sels, map[string]bool{})
+}
+
+func (e *executor) included(dirs []directive) (bool, error) {
+	for _, d := range dirs {
+		if d.name != "skip" && d.name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", d.name)
+		}
+		v, err := e.argValue(d.args["if"], "Boolean!")
+		if err != nil {
+			return false, fmt.Errorf("@%s: %w", d.name, err)
+		}
+		if v.(bool) == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s selection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// validate checks the whole query against the schema before anything is resolved
+func (e *executor) validate(obj *Object, sels []selection, depth int) []Error {
+	if depth > maxDepth {
+		return []Error{{Message: fmt.Sprintf("query is nested deeper than %d levels", maxDepth)}}
+	}
+	fields, err := e.collect(obj, sels)
+	if err != nil {
+		return []Error{{Message: err.Error()}}
+	}
+	var errs []Error
+	for _, sel := range fields {
+		if sel.name == "__typename" {
+			continue
+		}
+		f := obj.field(sel.name)
+		if f == nil {
+			errs = append(errs, Error{Message: fmt.Sprintf("line %d: cannot query field %q on type %s", sel.line, sel.name, obj.Name)})
+			continue
+		}
+		if _, err := e.args(f, sel); err != nil {
+			errs = append(errs, Error{Message: fmt.Sprintf("line %d: %s: %v", sel.line, sel.name, err)})
+		}
+		switch {
+		case f.Object == nil && sel.selection != nil:
+			errs = append(errs, Error{Message: fmt.Sprintf("line %d: field %q of type %s has no subfields", sel.line, sel.name, f.Type)})
+		case f.Object != nil && sel.selection == nil:
+			errs = append(errs, Error{Message: fmt.Sprintf("line %d: field %q of type %s needs a selection of subfields", sel.line, sel.name, f.Type)})
+		case f.Object != nil:
+			errs = append(errs, e.validate(f.Object, sel.selection, depth+1)...)
+		}
+	}
+	return errs
+}
+
+func (o *Object) field(name string) *Field {
+	for _, f := range o.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// object resolves the selected fields of one object value
+func (e *executor) object(obj *Object, source any, sels []selection, path []any) *orderedMap {
+	fields, _ := e.collect(obj, sels) // validated already
+	out := &orderedMap{}
+	for _, sel := range fields {
+		key := sel.responseKey()
+		if sel.name == "__typename" {
+			out.set(key, obj.Name)
+			continue
+		}
+		f := obj.field(sel.name)
+		fieldPath := append(append([]any{}, path...), key)
+
+		var value any
+		var err error
+		args, _ := e.args(f, sel)
+		if f.Resolve != nil {
+			value, err = f.Resolve(Params{Ctx: e.ctx, Source: source, Args: args})
+		} else {
+			value = defaultResolve(source, f.Name)
+		}
+		if err != nil {
+			e.errors = append(e.errors, Error{Message: err.Error(), Path: fieldPath})
+			out.set(key, nil)
+			continue
+		}
+		out.set(key, e.complete(f, value, sel.selection, fieldPath))
+	}
+	return out
+}
+
+// complete turns a resolved value into its response, descending into objects
+func (e *executor) complete(f *Field, value any, sels []selection, path []any) any {
+	if f.Object == nil || isNil(value) {
+		return value
+	}
+	if !strings.HasPrefix(f.Type, "[") {
+		return e.object(f.Object, value, sels, path)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if rv.Kind() != reflect.Slice {
+		e.errors = append(e.errors, Error{Message: fmt.Sprintf("%s resolved to %T, not a list", f.Name, value), Path: path})
+		return nil
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		item := rv.Index(i)
+		if item.CanAddr() && item.Kind() == reflect.Struct {
+			item = item.Addr()
+		}
+		list[i] = e.object(f.Object, item.Interface(), sels, append(append([]any{}, path...), i))
+	}
+	return list
+}
+
+// defaultResolve reads name from a map or the struct field with that json name
+func defaultResolve(source any, name string) any {
+	if m, ok := source.(map[string]any); ok {
+		return m[name]
+	}
+	rv := reflect.Indirect(reflect.ValueOf(source))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	return structField(rv, name)
+}
+
+func structField(rv reflect.Value, name string) any {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.Anonymous {
+			if v := structField(reflect.Indirect(rv.Field(i)), name); v != nil {
+				return v
+			}
+			continue
+		}
+		tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if tag == name || (tag == "" && sf.Name == name) {
+			return rv.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// orderedMap keeps the response fields in the order they were selected, as the
+// spec asks of a serialised response
+type orderedMap struct {
+	keys   []string
+	values []any
+}
+
+func (m *orderedMap) set(key string, value any) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
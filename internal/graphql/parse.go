@@ -0,0 +1,528 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the parsed document, only what queries use: operations, fields with aliases and
+// arguments, fragments and the @skip and @include directives
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind      string // query, mutation or subscription
+	name      string
+	variables []variableDef
+	selection []selection
+}
+
+type variableDef struct {
+	name  string
+	typ   string // as written, e.g. "Int!"
+	value any    // default, nil for none
+}
+
+type fragment struct {
+	typeCond  string
+	selection []selection
+}
+
+// selection is a field, a fragment spread (spread set) or an inline fragment
+// (inline set, typeCond optional)
+type selection struct {
+	alias      string
+	name       string
+	args       map[string]any
+	directives []directive
+	selection  []selection
+	spread     string
+	inline     bool
+	typeCond   string
+	line       int
+}
+
+type directive struct {
+	name string
+	args map[string]any
+}
+
+// variable is a $name reference inside an argument value
+type variable string
+
+// enum is a bare name used as a value
+type enum string
+
+type token struct {
+	kind  byte // 'n' name, 'i' int, 'f' float, 's' string, 'p' punctuator, 0 end
+	value string
+	line  int
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+	tok  token
+}
+
+func parse(src string) (*document, error) {
+	p := &parser{src: src, line: 1}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != 0 {
+		switch {
+		case p.is('p', "{"):
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selection: sel})
+		case p.is('n', "query"), p.is('n', "mutation"), p.is('n', "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.is('n', "fragment"):
+			name, frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[name]; ok {
+				return nil, fmt.Errorf("line %d: fragment %q defined twice", p.tok.line, name)
+			}
+			doc.fragments[name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.tok.value}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == 'n' {
+		op.name = p.tok.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is('p', "(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for !p.is('p', ")") {
+			if err := p.expect('p', "$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect('p', ":"); err != nil {
+				return nil, err
+			}
+			typ, err := p.typeRef()
+			if err != nil {
+				return nil, err
+			}
+			def := variableDef{name: name, typ: typ}
+			if p.is('p', "=") {
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+				if def.value, err = p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			op.variables = append(op.variables, def)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selection = sel
+	return op, nil
+}
+
+func (p *parser) fragment() (string, *fragment, error) {
+	if err := p.next(); err != nil {
+		return "", nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := p.expect('n', "on"); err != nil {
+		return "", nil, err
+	}
+	typeCond, err := p.name()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return "", nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return "", nil, err
+	}
+	return name, &fragment{typeCond: typeCond, selection: sel}, nil
+}
+
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.is('p', "[") {
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect('p', "]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.is('p', "!") {
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect('p', "{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.is('p', "}") {
+		sel := selection{line: p.tok.line}
+		if p.is('p', "...") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			switch {
+			case p.is('n', "on"):
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				sel.inline, sel.typeCond = true, name
+			case p.tok.kind == 'n':
+				sel.spread = p.tok.value
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+			default:
+				sel.inline = true
+			}
+			var err error
+			if sel.directives, err = p.directives(); err != nil {
+				return nil, err
+			}
+			if sel.inline {
+				if sel.selection, err = p.selectionSet(); err != nil {
+					return nil, err
+				}
+			}
+			sels = append(sels, sel)
+			continue
+		}
+
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		sel.name = name
+		if p.is('p', ":") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if sel.name, err = p.name(); err != nil {
+				return nil, err
+			}
+			sel.alias = name
+		}
+		if sel.args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+		if sel.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if p.is('p', "{") {
+			if sel.selection, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("line %d: empty selection set", p.tok.line)
+	}
+	return sels, p.next()
+}
+
+func (p *parser) arguments() (map[string]any, error) {
+	if !p.is('p', "(") {
+		return nil, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	args := map[string]any{}
+	for !p.is('p', ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('p', ":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.next()
+}
+
+func (p *parser) directives() ([]directive, error) {
+	var dirs []directive
+	for p.is('p', "@") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, directive{name: name, args: args})
+	}
+	return dirs, nil
+}
+
+// value parses an argument value, const ones (variable defaults) cannot hold variables
+func (p *parser) value(isConst bool) (any, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == 'p' && tok.value == "$" && !isConst:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case tok.kind == 'i':
+		v, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid int %s", tok.line, tok.value)
+		}
+		return v, p.next()
+	case tok.kind == 'f':
+		v, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid float %s", tok.line, tok.value)
+		}
+		return v, p.next()
+	case tok.kind == 's':
+		return tok.value, p.next()
+	case tok.kind == 'n':
+		var v any
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = enum(tok.value)
+		}
+		return v, p.next()
+	case p.is('p', "["):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.is('p', "]") {
+			v, err := p.value(isConst)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.next()
+	case p.is('p', "{"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := map[string]any{}
+		for !p.is('p', "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect('p', ":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(isConst); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.next()
+	}
+	return nil, p.unexpected()
+}
+
+func (p *parser) is(kind byte, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) expect(kind byte, value string) error {
+	if !p.is(kind, value) {
+		return fmt.Errorf("line %d: expected %q, found %s", p.tok.line, value, p.describe())
+	}
+	return p.next()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != 'n' {
+		return "", fmt.Errorf("line %d: expected a name, found %s", p.tok.line, p.describe())
+	}
+	name := p.tok.value
+	return name, p.next()
+}
+
+func (p *parser) unexpected() error {
+	return fmt.Errorf("line %d: unexpected %s", p.tok.line, p.describe())
+}
+
+func (p *parser) describe() string {
+	if p.tok.kind == 0 {
+		return "end of document"
+	}
+	return strconv.Quote(p.tok.value)
+}
+
+// next reads the following token, skipping whitespace, commas and comments
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return p.lex()
+		}
+	}
+	p.tok = token{line: p.line}
+	return nil
+}
+
+func (p *parser) lex() error {
+	start, c := p.pos, p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: 'p', value: "...", line: p.line}
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		p.pos++
+		p.tok = token{kind: 'p', value: string(c), line: p.line}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: 'n', value: p.src[start:p.pos], line: p.line}
+	case c == '-' || isDigit(c):
+		p.pos++
+		kind := byte('i')
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c == '.' || c == 'e' || c == 'E' || ((c == '+' || c == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+				kind = 'f'
+			} else if !isDigit(c) {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: kind, value: p.src[start:p.pos], line: p.line}
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return fmt.Errorf("line %d: block strings are not supported", p.line)
+		}
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			if p.pos < len(p.src) && p.src[p.pos] == '\n' {
+				return fmt.Errorf("line %d: unterminated string", p.line)
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return fmt.Errorf("line %d: unterminated string", p.line)
+		}
+		p.pos++
+		// GraphQL string escapes are the JSON ones
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			return fmt.Errorf("line %d: invalid string %s", p.line, p.src[start:p.pos])
+		}
+		p.tok = token{kind: 's', value: s, line: p.line}
+	default:
+		return fmt.Errorf("line %d: unexpected character %q", p.line, c)
+	}
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,64 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SDL prints the schema as GraphQL type definitions, the query type first and the
+// others in the order they are first reached
+func (s *Schema) SDL() string {
+	var objects []*Object
+	seen := map[*Object]bool{}
+	var visit func(o *Object)
+	visit = func(o *Object) {
+		if seen[o] {
+			return
+		}
+		seen[o] = true
+		objects = append(objects, o)
+		for _, f := range o.Fields {
+			if f.Object != nil {
+				visit(f.Object)
+			}
+		}
+	}
+	visit(s.Query)
+
+	var b strings.Builder
+	for i, o := range objects {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if o.Description != "" {
+			fmt.Fprintf(&b, "%s\n", describe(o.Description))
+		}
+		fmt.Fprintf(&b, "type %s {\n", o.Name)
+		for _, f := range o.Fields {
+			if f.Description != "" {
+				fmt.Fprintf(&b, "  %s\n", describe(f.Description))
+			}
+			b.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for j, a := range f.Args {
+					args[j] = a.Name + ": " + a.Type
+					if a.Default != nil {
+						def, _ := json.Marshal(a.Default)
+						args[j] += " = " + string(def)
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func describe(s string) string {
+	q, _ := json.Marshal(s)
+	return string(q)
+}
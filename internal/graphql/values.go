@@ -0,0 +1,171 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// args coerces the arguments a field was given against the ones it declares
+func (e *executor) args(f *Field, sel selection) (map[string]any, error) {
+	for name := range sel.args {
+		if !f.hasArg(name) {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+	}
+	args := make(map[string]any, len(f.Args))
+	for _, a := range f.Args {
+		raw, ok := sel.args[a.Name]
+		if !ok {
+			if a.Default == nil && strings.HasSuffix(a.Type, "!") {
+				return nil, fmt.Errorf("argument %q of type %s is required", a.Name, a.Type)
+			}
+			args[a.Name] = a.Default
+			continue
+		}
+		v, err := e.argValue(raw, a.Type)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %w", a.Name, err)
+		}
+		args[a.Name] = v
+	}
+	return args, nil
+}
+
+func (f *Field) hasArg(name string) bool {
+	for _, a := range f.Args {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *executor) argValue(raw any, typ string) (any, error) {
+	return coerce(e.substitute(raw), typ)
+}
+
+// substitute replaces variable references with their values
+func (e *executor) substitute(raw any) any {
+	switch v := raw.(type) {
+	case variable:
+		return e.vars[string(v)]
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = e.substitute(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = e.substitute(item)
+		}
+		return out
+	}
+	return raw
+}
+
+// coerceVariables applies the declared types and defaults to the request variables
+func coerceVariables(defs []variableDef, provided map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(defs))
+	for _, def := range defs {
+		v, ok := provided[def.name]
+		if !ok {
+			v = def.value
+		}
+		c, err := coerce(v, def.typ)
+		if err != nil {
+			return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+		}
+		vars[def.name] = c
+	}
+	return vars, nil
+}
+
+// coerce checks a literal or JSON value against a type, turning JSON numbers into
+// int64 for Int and a single value into a list of one for list types
+func coerce(v any, typ string) (any, error) {
+	nonNull := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+	if v == nil {
+		if nonNull {
+			return nil, fmt.Errorf("expected %s!, found null", typ)
+		}
+		return nil, nil
+	}
+
+	if strings.HasPrefix(typ, "[") {
+		inner := typ[1 : len(typ)-1]
+		items, ok := v.([]any)
+		if !ok {
+			items = []any{v}
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			c, err := coerce(item, inner)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+
+	switch typ {
+	case "Int":
+		switch n := v.(type) {
+		case int64:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+				return int64(n), nil
+			}
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		}
+	case "Float":
+		switch n := v.(type) {
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		case json.Number:
+			if f, err := n.Float64(); err == nil {
+				return f, nil
+			}
+		}
+	case "String":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case "ID":
+		switch id := v.(type) {
+		case string:
+			return id, nil
+		case int64:
+			return strconv.FormatInt(id, 10), nil
+		}
+	case "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown input type %s", typ)
+	}
+	return nil, fmt.Errorf("expected %s, found %v", typ, describeValue(v))
+}
+
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case enum:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
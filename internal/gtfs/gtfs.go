@@ -0,0 +1,225 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	agencyID = "IR"
+
+	// GTFS route_type for long distance rail
+	routeTypeRail = 2
+)
+
+type Options struct {
+	AgencyName string
+	AgencyURL  string
+	Timezone   string    // IANA name, every time in the feed is local to it
+	Start      time.Time // first service date
+	Days       int       // calendar length from Start
+}
+
+func DefaultOptions(loc *time.Location) Options {
+	now := time.Now().In(loc)
+	return Options{
+		AgencyName: "Indian Railways",
+		AgencyURL:  "https://indianrailways.gov.in",
+		Timezone:   loc.String(),
+		Start:      time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc),
+		Days:       365,
+	}
+}
+
+type Stats struct {
+	Stops     int
+	Routes    int
+	Trips     int
+	StopTimes int
+	Services  int
+}
+
+type stopTime struct {
+	stationCode  string
+	distanceKm   float64
+	arrivalMin   int64
+	departureMin int64
+}
+
+// Write builds a static GTFS feed from the timetable and writes it to w as a zip.
+// Every train is a route and every schedule a trip, running on the service of its
+// running days bitmap. Stations without coordinates are left out of stops and
+// stop_times, trips left with fewer than two stops are dropped.
+func Write(ctx context.Context, queries *db.Queries, w io.Writer, opts Options) (Stats, error) {
+	var stats Stats
+
+	stops, err := queries.ListGTFSStops(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("list stops: %w", err)
+	}
+	trips, err := queries.ListGTFSTrips(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("list trips: %w", err)
+	}
+	timeRows, err := queries.ListGTFSStopTimes(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("list stop times: %w", err)
+	}
+
+	stopTimes := map[int64][]stopTime{}
+	for _, row := range timeRows {
+		stopTimes[row.ScheduleID] = append(stopTimes[row.ScheduleID], stopTime{
+			stationCode:  row.StationCode,
+			distanceKm:   row.DistanceKm,
+			arrivalMin:   row.ArrivalMin,
+			departureMin: row.DepartureMin,
+		})
+	}
+
+	zw := zip.NewWriter(w)
+
+	if err := writeFile(zw, "agency.txt",
+		[]string{"agency_id", "agency_name", "agency_url", "agency_timezone"},
+		[][]string{{agencyID, opts.AgencyName, opts.AgencyURL, opts.Timezone}},
+	); err != nil {
+		return stats, err
+	}
+
+	stopRows := make([][]string, 0, len(stops))
+	for _, s := range stops {
+		stopRows = append(stopRows, []string{
+			s.StationCode,
+			s.StationCode,
+			s.StationName,
+			strconv.FormatFloat(s.Lat, 'f', 6, 64),
+			strconv.FormatFloat(s.Lng, 'f', 6, 64),
+		})
+	}
+	if err := writeFile(zw, "stops.txt",
+		[]string{"stop_id", "stop_code", "stop_name", "stop_lat", "stop_lon"}, stopRows,
+	); err != nil {
+		return stats, err
+	}
+	stats.Stops = len(stopRows)
+
+	var routeRows, tripRows, timeOut [][]string
+	services := map[int64]bool{}
+	lastTrain := int64(-1)
+	for _, t := range trips {
+		times := stopTimes[t.ScheduleID]
+		if len(times) < 2 {
+			continue
+		}
+
+		if t.TrainNo != lastTrain {
+			routeRows = append(routeRows, []string{
+				strconv.FormatInt(t.TrainNo, 10),
+				agencyID,
+				strconv.FormatInt(t.TrainNo, 10),
+				t.TrainName,
+				t.TrainType,
+				strconv.Itoa(routeTypeRail),
+			})
+			lastTrain = t.TrainNo
+		}
+
+		tripID := fmt.Sprintf("%d_%d", t.TrainNo, t.ScheduleID)
+		tripRows = append(tripRows, []string{
+			strconv.FormatInt(t.TrainNo, 10),
+			serviceID(t.RunningDaysBitmap),
+			tripID,
+			t.Headsign,
+			strconv.FormatInt(t.TrainNo, 10),
+		})
+		services[t.RunningDaysBitmap] = true
+
+		for i, st := range times {
+			timeOut = append(timeOut, []string{
+				tripID,
+				gtfsTime(st.arrivalMin),
+				gtfsTime(st.departureMin),
+				st.stationCode,
+				strconv.Itoa(i + 1),
+				strconv.FormatFloat(st.distanceKm, 'f', -1, 64),
+			})
+		}
+	}
+
+	if err := writeFile(zw, "routes.txt",
+		[]string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_desc", "route_type"}, routeRows,
+	); err != nil {
+		return stats, err
+	}
+	if err := writeFile(zw, "trips.txt",
+		[]string{"route_id", "service_id", "trip_id", "trip_headsign", "trip_short_name"}, tripRows,
+	); err != nil {
+		return stats, err
+	}
+	if err := writeFile(zw, "stop_times.txt",
+		[]string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence", "shape_dist_traveled"}, timeOut,
+	); err != nil {
+		return stats, err
+	}
+	stats.Routes, stats.Trips, stats.StopTimes = len(routeRows), len(tripRows), len(timeOut)
+
+	start := opts.Start.Format("20060102")
+	end := opts.Start.AddDate(0, 0, max(opts.Days, 1)-1).Format("20060102")
+	var calendarRows [][]string
+	for bitmap := range int64(128) {
+		if !services[bitmap] {
+			continue
+		}
+		row := []string{serviceID(bitmap)}
+		// GTFS lists monday first, the bitmap is Sun to Sat in bits 0 to 6
+		for _, day := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+			row = append(row, strconv.FormatInt((bitmap>>int(day))&1, 10))
+		}
+		calendarRows = append(calendarRows, append(row, start, end))
+	}
+	if err := writeFile(zw, "calendar.txt",
+		[]string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"},
+		calendarRows,
+	); err != nil {
+		return stats, err
+	}
+	stats.Services = len(calendarRows)
+
+	if err := zw.Close(); err != nil {
+		return stats, fmt.Errorf("close zip: %w", err)
+	}
+	return stats, nil
+}
+
+// serviceID names the service of one running days bitmap, schedules sharing their
+// running days share the service
+func serviceID(bitmap int64) string {
+	return "days_" + strconv.FormatInt(bitmap, 10)
+}
+
+// gtfsTime renders minutes after midnight of the service day, past 24:00:00 for
+// stops on later days as GTFS expects
+func gtfsTime(min int64) string {
+	return fmt.Sprintf("%02d:%02d:00", min/60, min%60)
+}
+
+func writeFile(zw *zip.Writer, name string, header []string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
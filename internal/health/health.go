@@ -0,0 +1,108 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded" // the last run failed or nothing has succeeded for too long
+	StatusDown     = "down"
+	StatusUnknown  = "unknown" // not run yet since the process started
+)
+
+// Component is a snapshot of one background service
+type Component struct {
+	Status      string     `json:"status"`
+	LastRun     *time.Time `json:"last_run"`
+	LastSuccess *time.Time `json:"last_success"`
+	LastError   string     `json:"last_error,omitempty"`
+	Detail      string     `json:"detail,omitempty"`
+}
+
+// Tracker records the outcome of each run of a service
+type Tracker struct {
+	staleAfter time.Duration
+
+	mu          sync.Mutex
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	detail      string
+}
+
+var (
+	mu       sync.Mutex
+	trackers = map[string]*Tracker{}
+)
+
+// Register adds a tracker under name. A service that has not succeeded within
+// staleAfter is degraded, zero never goes stale.
+func Register(name string, staleAfter time.Duration) *Tracker {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := trackers[name]; ok {
+		panic("health: duplicate component " + name)
+	}
+	t := &Tracker{staleAfter: staleAfter}
+	trackers[name] = t
+	return t
+}
+
+// Success records a run that worked, detail says what it did
+func (t *Tracker) Success(detail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.lastRun, t.lastSuccess = now, now
+	t.lastError, t.detail = "", detail
+}
+
+// Failure records a run that did not
+func (t *Tracker) Failure(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastRun = time.Now()
+	t.lastError = err.Error()
+}
+
+func (t *Tracker) snapshot(now time.Time) Component {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := Component{Status: StatusOK, LastError: t.lastError, Detail: t.detail}
+	if !t.lastRun.IsZero() {
+		lastRun := t.lastRun.UTC()
+		c.LastRun = &lastRun
+	}
+	if !t.lastSuccess.IsZero() {
+		lastSuccess := t.lastSuccess.UTC()
+		c.LastSuccess = &lastSuccess
+	}
+	switch {
+	case t.lastRun.IsZero():
+		c.Status = StatusUnknown
+	case t.lastError != "":
+		c.Status = StatusDegraded
+	case t.staleAfter > 0 && now.Sub(t.lastSuccess) > t.staleAfter:
+		c.Status = StatusDegraded
+	}
+	return c
+}
+
+// Snapshot returns every registered component by name
+func Snapshot() map[string]Component {
+	mu.Lock()
+	all := make(map[string]*Tracker, len(trackers))
+	for name, t := range trackers {
+		all[name] = t
+	}
+	mu.Unlock()
+
+	now := time.Now()
+	out := make(map[string]Component, len(all))
+	for name, t := range all {
+		out[name] = t.snapshot(now)
+	}
+	return out
+}
@@ -0,0 +1,165 @@
+package iri
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+
+	// finished jobs kept for GET after they end
+	keptJobs = 20
+	// per job, the rest are only counted
+	keptJobErrors = 50
+)
+
+// ErrSyncRunning is returned by Jobs.Start while another sync is still going, two at
+// once would only share the same IRI budget
+var ErrSyncRunning = errors.New("a sync is already running")
+
+type JobError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// Job is a snapshot of an on demand sync
+type Job struct {
+	ID         string     `json:"id"`
+	State      string     `json:"state"`
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	Failed     int        `json:"failed"`
+	Errors     []JobError `json:"errors"`
+	Error      string     `json:"error,omitempty"` // why the job stopped early
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// Jobs runs sync cycles on demand, outside the weekly ticker, one at a time
+type Jobs struct {
+	client  *Client
+	dbConn  *sql.DB
+	logger  *log.Logger
+	allURLs func() []string
+	ctx     context.Context // jobs outlive the request that started them
+
+	mu          sync.Mutex
+	concurrency int
+	jobs        map[string]*Job
+	order       []string
+	running     bool
+}
+
+// NewJobs takes the train urls the weekly sync covers as allURLs, read on each Start
+// that names no trains
+func NewJobs(ctx context.Context, client *Client, dbConn *sql.DB, logger *log.Logger, concurrency int, allURLs func() []string) *Jobs {
+	return &Jobs{
+		client:      client,
+		dbConn:      dbConn,
+		logger:      logger,
+		concurrency: max(concurrency, 1),
+		allURLs:     allURLs,
+		ctx:         ctx,
+		jobs:        map[string]*Job{},
+	}
+}
+
+// SetConcurrency applies to jobs started from now on
+func (j *Jobs) SetConcurrency(concurrency int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.concurrency = max(concurrency, 1)
+}
+
+// Start begins syncing urls in the background, every train when urls is empty, and
+// returns the new job
+func (j *Jobs) Start(urls []string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.running {
+		return Job{}, ErrSyncRunning
+	}
+	if len(urls) == 0 {
+		urls = j.allURLs()
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	job := &Job{
+		ID:        hex.EncodeToString(b),
+		State:     JobRunning,
+		Total:     len(urls),
+		Errors:    []JobError{},
+		StartedAt: time.Now().UTC(),
+	}
+	j.jobs[job.ID] = job
+	j.order = append(j.order, job.ID)
+	for len(j.order) > keptJobs {
+		delete(j.jobs, j.order[0])
+		j.order = j.order[1:]
+	}
+	j.running = true
+
+	go j.run(job, urls, j.concurrency)
+	return j.snapshot(job), nil
+}
+
+// Get returns the job with id, false once it has aged out
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot(job), true
+}
+
+func (j *Jobs) run(job *Job, urls []string, concurrency int) {
+	j.logger.Printf("iri_sync: job %s started with %d trains", job.ID, len(urls))
+
+	err := j.client.SyncURLs(j.ctx, j.dbConn, j.logger, concurrency, urls, func(url string, err error) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job.Done++
+		if err != nil {
+			job.Failed++
+			if len(job.Errors) < keptJobErrors {
+				job.Errors = append(job.Errors, JobError{URL: url, Error: err.Error()})
+			}
+		}
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	switch {
+	case j.ctx.Err() != nil:
+		job.State = JobCanceled
+	case err != nil:
+		job.State = JobFailed
+		job.Error = err.Error()
+	default:
+		job.State = JobDone
+	}
+	j.running = false
+	j.logger.Printf("iri_sync: job %s %s | done: %d/%d | failed: %d", job.ID, job.State, job.Done, job.Total, job.Failed)
+}
+
+// snapshot copies job so callers can read it without the lock, j.mu held
+func (j *Jobs) snapshot(job *Job) Job {
+	c := *job
+	c.Errors = append([]JobError{}, job.Errors...)
+	return c
+}
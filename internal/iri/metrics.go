@@ -0,0 +1,21 @@
+package iri
+
+import "trano/internal/metrics"
+
+var (
+	fetchTotal = metrics.NewCounter("trano_iri_fetch_total",
+		"Timetable page fetches by outcome: ok, request_error, blocked or bad_status.", "outcome")
+	fetchDuration = metrics.NewHistogram("trano_iri_fetch_duration_seconds",
+		"Time to download a timetable page, rate limiter wait excluded.", metrics.DefBuckets)
+	parseTotal = metrics.NewCounter("trano_iri_parse_total",
+		"Timetable pages parsed by outcome.", "outcome")
+	saveTotal = metrics.NewCounter("trano_iri_save_total",
+		"Rows saved from parsed pages by kind (train, station, schedule) and outcome.", "kind", "outcome")
+)
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
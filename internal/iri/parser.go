@@ -2,30 +2,25 @@ package iri
 
 import (
 	"context"
-	"database/sql"
-	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
-	db "trano/internal/db/sqlc"
+	"trano/internal/ratelimit"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/imroc/req/v3"
-	"golang.org/x/sync/errgroup"
-	"golang.org/x/time/rate"
 )
 
 type Client struct {
-	limiter    *rate.Limiter
+	limiter    *ratelimit.Budget
 	httpClient *http.Client
 }
 
-func NewClient(limiter *rate.Limiter, httpClient *http.Client) *Client {
+func NewClient(limiter *ratelimit.Budget, httpClient *http.Client) *Client {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
@@ -199,6 +194,7 @@ func (c *Client) FetchTrainData(
 	}
 
 	// Timetable page request
+	fetchStart := time.Now()
 	resp, err := client.R().
 		SetHeaders(map[string]string{
 			"Accept": "text/html",
@@ -220,13 +216,22 @@ func (c *Client) FetchTrainData(
 		}).
 		Get(timetableURL)
 	if err != nil {
+		fetchTotal.With("request_error").Inc()
 		return nil, nil, nil, fmt.Errorf("timetable request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	fetchDuration.With().Observe(time.Since(fetchStart).Seconds())
 
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		fetchTotal.With("blocked").Inc()
+		c.limiter.Block(ctx)
+		return nil, nil, nil, fmt.Errorf("timetable unexpected status %d", resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
+		fetchTotal.With("bad_status").Inc()
 		return nil, nil, nil, fmt.Errorf("timetable unexpected status %d", resp.StatusCode)
 	}
+	fetchTotal.With("ok").Inc()
 
 	// Save the response body to a file
 	// bodyBytes, err := io.ReadAll(resp.Body)
@@ -239,10 +244,12 @@ func (c *Client) FetchTrainData(
 
 	docTimetable, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
+		parseTotal.With("error").Inc()
 		return nil, nil, nil, fmt.Errorf("timetable html parse failed: %w", err)
 	}
 
 	trainData, stationData, scheduleData, err := c.parseTrainData(docTimetable, targetURL)
+	parseTotal.With(outcome(err)).Inc()
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -625,56 +632,3 @@ func parseStationDetails(title1 string) (division, stationType, category, trackT
 	}
 	return
 }
-
-func (c *Client) ExecuteSyncCycle(ctx context.Context, dbConn *sql.DB, logger *log.Logger, concurrency int, urls []string) error {
-	queries := db.New(dbConn)
-	saver := NewSaver(queries, logger)
-	g, gctx := errgroup.WithContext(ctx)
-	g.SetLimit(concurrency)
-	for _, url := range urls {
-		url := url
-		g.Go(func() error {
-			train, stations, schedule, err := c.FetchTrainData(gctx, url)
-			if err != nil {
-				if !errors.Is(err, context.Canceled) {
-					logger.Printf("failed to fetch %s : %v", url, err)
-				}
-				return nil
-				// return err
-			}
-			// logger.Println("Got the data yey", url, train.TrainName, len(stations))
-			if err := saver.SaveTrainData(gctx, train); err != nil {
-				logger.Printf("failed to save train %s: %v", url, err)
-				return err
-			}
-			for _, station := range stations {
-				if err := saver.SaveStationData(gctx, station); err != nil {
-					logger.Printf("failed to save station %s: %v", station.StationCode, err)
-					return err
-				}
-			}
-			if err := saver.SaveScheduleData(gctx, schedule); err != nil {
-				logger.Printf("failed to save schedule %s: %v", url, err)
-				logger.Printf("Schedule Details:\n")
-				logger.Printf("  ID: %d\n", schedule.ScheduleID)
-				logger.Printf("  Train No: %d\n", schedule.TrainNo)
-				logger.Printf("  Origin: %s\n", schedule.OriginStationCode)
-				logger.Printf("  Terminus: %s\n", schedule.TerminusStationCode)
-				logger.Printf("  Origin Departure: %d min\n", schedule.OriginSchDepartureMin)
-				logger.Printf("  Total Distance: %.2f km\n", schedule.TotalDistanceKm)
-				logger.Printf("  Total Runtime: %d min\n", schedule.TotalRuntimeMin)
-				logger.Printf("  Running Days Bitmap: %d\n", schedule.RunningDaysBitmap)
-				logger.Printf("  Number of Route Stops: %d\n", len(schedule.Route))
-				logger.Printf("Routes:\n")
-				for i, route := range schedule.Route {
-					logger.Printf("  %d. Station: %s, Distance: %.2f km, Arr: %d min, Dep: %d min, Stops: %d\n",
-						i+1, route.StationCode, route.DistanceKm, route.SchArrivalMinFromStart, route.SchDepartureMinFromStart, route.Stops)
-				}
-				return err
-			}
-			logger.Println("Processed ", url)
-			return nil
-		})
-	}
-	return g.Wait()
-}
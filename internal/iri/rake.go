@@ -0,0 +1,87 @@
+package iri
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	CoachPassenger = "passenger"
+	CoachLoco      = "loco"
+	CoachGenerator = "generator"
+	CoachLuggage   = "luggage"
+	CoachPantry    = "pantry"
+	CoachPostal    = "postal"
+	CoachOther     = "other"
+)
+
+// Coach is one vehicle of a rake, in the order IRI lists them from the locomotive
+type Coach struct {
+	Position int    `json:"position"` // from 1
+	Code     string `json:"code"`     // as scraped, e.g. "B1" or "GEN"
+	Class    string `json:"class"`    // travel class such as "3A" or "SL", empty for non passenger coaches
+	Kind     string `json:"kind"`
+}
+
+// coach codes without a number, by the whole code
+var coachCodes = map[string]struct{ class, kind string }{
+	"L":     {"", CoachLoco},
+	"LOCO":  {"", CoachLoco},
+	"ENG":   {"", CoachLoco},
+	"EOG":   {"", CoachGenerator},
+	"PP":    {"", CoachGenerator},
+	"SLR":   {"", CoachLuggage},
+	"SLRD":  {"", CoachLuggage},
+	"LSLRD": {"", CoachLuggage},
+	"LR":    {"", CoachLuggage},
+	"LPR":   {"", CoachLuggage},
+	"PC":    {"", CoachPantry},
+	"RMS":   {"", CoachPostal},
+	"GEN":   {"GN", CoachPassenger},
+	"GN":    {"GN", CoachPassenger},
+	"GS":    {"GN", CoachPassenger},
+	"UR":    {"GN", CoachPassenger},
+}
+
+// passenger coach prefixes, the letters before the coach number
+var coachClasses = map[string]string{
+	"H":  "1A",
+	"HA": "1A", // 1A and 2A composite, booked as 1A
+	"HB": "1A",
+	"A":  "2A",
+	"B":  "3A",
+	"G":  "3A", // Garib Rath
+	"M":  "3E",
+	"C":  "CC",
+	"E":  "EC",
+	"EV": "EV", // Vistadome
+	"K":  "EA", // Anubhuti
+	"S":  "SL",
+	"D":  "2S",
+	"F":  "FC",
+	"FC": "FC",
+}
+
+// ParseRake splits a comma separated coachComposition ("L,EOG,B1,B2,S1,GEN,SLR") into
+// coaches with their class. Codes it does not know are kept as other.
+func ParseRake(composition string) []Coach {
+	coaches := []Coach{}
+	for _, raw := range strings.Split(composition, ",") {
+		code := strings.ToUpper(strings.TrimSpace(raw))
+		if code == "" {
+			continue
+		}
+		c := Coach{Position: len(coaches) + 1, Code: code, Kind: CoachOther}
+		if known, ok := coachCodes[code]; ok {
+			c.Class, c.Kind = known.class, known.kind
+		} else if prefix := strings.TrimRightFunc(code, unicode.IsDigit); prefix != code {
+			if class, ok := coachClasses[prefix]; ok {
+				c.Class, c.Kind = class, CoachPassenger
+			} else if known, ok := coachCodes[prefix]; ok {
+				c.Class, c.Kind = known.class, known.kind
+			}
+		}
+		coaches = append(coaches, c)
+	}
+	return coaches
+}
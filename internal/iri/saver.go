@@ -27,7 +27,35 @@ func (s *Saver) SaveTrainData(ctx context.Context, train *TrainData) error {
 		CoachComposition: sql.NullString{String: train.CoachComposition, Valid: train.CoachComposition != ""},
 		SourceUrl:        train.SourceURL,
 	}
-	return s.queries.UpsertTrain(ctx, params)
+	if err := s.queries.UpsertTrain(ctx, params); err != nil {
+		return err
+	}
+	if err := s.saveRake(ctx, train.TrainNo, train.CoachComposition); err != nil {
+		return err
+	}
+	return s.queries.FillTrackedTrainNo(ctx, db.FillTrackedTrainNoParams{
+		TrainNo:   train.TrainNo,
+		SourceUrl: train.SourceURL,
+	})
+}
+
+// saveRake replaces the stored coaches of a train with its current composition
+func (s *Saver) saveRake(ctx context.Context, trainNo int64, composition string) error {
+	if err := s.queries.DeleteTrainCoaches(ctx, trainNo); err != nil {
+		return err
+	}
+	for _, coach := range ParseRake(composition) {
+		if err := s.queries.InsertTrainCoach(ctx, db.InsertTrainCoachParams{
+			TrainNo:   trainNo,
+			Position:  int64(coach.Position),
+			CoachCode: coach.Code,
+			Class:     sql.NullString{String: coach.Class, Valid: coach.Class != ""},
+			Kind:      coach.Kind,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *Saver) SaveStationData(ctx context.Context, station *StationData) error {
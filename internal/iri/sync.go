@@ -0,0 +1,107 @@
+package iri
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/health"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// errFetch marks failures to get or parse a page, they skip the train but do not stop
+// the cycle the way a failing save does
+var errFetch = errors.New("fetch failed")
+
+// the sync runs weekly, a day over that and it has been missed
+var syncHealth = health.Register("iri_sync", 8*24*time.Hour)
+
+func (c *Client) ExecuteSyncCycle(ctx context.Context, dbConn *sql.DB, logger *log.Logger, concurrency int, urls []string) error {
+	var failed atomic.Int64
+	err := c.SyncURLs(ctx, dbConn, logger, concurrency, urls, func(_ string, err error) {
+		if err != nil {
+			failed.Add(1)
+		}
+	})
+	if err != nil {
+		syncHealth.Failure(err)
+		return err
+	}
+	syncHealth.Success(fmt.Sprintf("%d trains, %d failed", len(urls), failed.Load()))
+	return nil
+}
+
+// SyncURLs fetches and saves every url, calling progress (when not nil) as each one
+// finishes. A failed save cancels the rest and is returned.
+func (c *Client) SyncURLs(ctx context.Context, dbConn *sql.DB, logger *log.Logger, concurrency int, urls []string, progress func(url string, err error)) error {
+	saver := NewSaver(db.New(dbConn), logger)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, url := range urls {
+		g.Go(func() error {
+			err := c.syncURL(gctx, saver, logger, url)
+			if progress != nil {
+				progress(url, err)
+			}
+			if errors.Is(err, errFetch) {
+				return nil
+			}
+			return err
+		})
+	}
+	return g.Wait()
+}
+
+func (c *Client) syncURL(ctx context.Context, saver *Saver, logger *log.Logger, url string) error {
+	train, stations, schedule, err := c.FetchTrainData(ctx, url)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			logger.Printf("failed to fetch %s : %v", url, err)
+		}
+		return fmt.Errorf("%w: %w", errFetch, err)
+	}
+
+	err = saver.SaveTrainData(ctx, train)
+	saveTotal.With("train", outcome(err)).Inc()
+	if err != nil {
+		logger.Printf("failed to save train %s: %v", url, err)
+		return err
+	}
+	for _, station := range stations {
+		err := saver.SaveStationData(ctx, station)
+		saveTotal.With("station", outcome(err)).Inc()
+		if err != nil {
+			logger.Printf("failed to save station %s: %v", station.StationCode, err)
+			return err
+		}
+	}
+	err = saver.SaveScheduleData(ctx, schedule)
+	saveTotal.With("schedule", outcome(err)).Inc()
+	if err != nil {
+		logger.Printf("failed to save schedule %s: %v", url, err)
+		logger.Printf("Schedule Details:\n")
+		logger.Printf("  ID: %d\n", schedule.ScheduleID)
+		logger.Printf("  Train No: %d\n", schedule.TrainNo)
+		logger.Printf("  Origin: %s\n", schedule.OriginStationCode)
+		logger.Printf("  Terminus: %s\n", schedule.TerminusStationCode)
+		logger.Printf("  Origin Departure: %d min\n", schedule.OriginSchDepartureMin)
+		logger.Printf("  Total Distance: %.2f km\n", schedule.TotalDistanceKm)
+		logger.Printf("  Total Runtime: %d min\n", schedule.TotalRuntimeMin)
+		logger.Printf("  Running Days Bitmap: %d\n", schedule.RunningDaysBitmap)
+		logger.Printf("  Number of Route Stops: %d\n", len(schedule.Route))
+		logger.Printf("Routes:\n")
+		for i, route := range schedule.Route {
+			logger.Printf("  %d. Station: %s, Distance: %.2f km, Arr: %d min, Dep: %d min, Stops: %d\n",
+				i+1, route.StationCode, route.DistanceKm, route.SchArrivalMinFromStart, route.SchDepartureMinFromStart, route.Stops)
+		}
+		return err
+	}
+	logger.Println("Processed ", url)
+	return nil
+}
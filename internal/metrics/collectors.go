@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"bufio"
+	"database/sql"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+var startTime = time.Now()
+
+func init() {
+	NewGaugeFunc("go_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	NewGaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	})
+	NewGaugeFunc("process_start_time_seconds", "Start time of the process since the unix epoch.", func() float64 {
+		return float64(startTime.Unix())
+	})
+}
+
+// dbPools reads sql.DB pool stats at scrape time, one series per registered pool
+type dbPools struct {
+	mu    sync.Mutex
+	pools map[string]*sql.DB
+}
+
+var pools = &dbPools{pools: map[string]*sql.DB{}}
+
+var dbPoolsOnce sync.Once
+
+// RegisterDB exports the connection pool stats of db under pool, e.g. "api" or "poller"
+func RegisterDB(pool string, db *sql.DB) {
+	dbPoolsOnce.Do(func() { Default.register(pools) })
+	pools.mu.Lock()
+	pools.pools[pool] = db
+	pools.mu.Unlock()
+}
+
+func (p *dbPools) name() string { return "trano_db" }
+
+var dbStats = []struct {
+	name, help, typ string
+	value           func(sql.DBStats) float64
+}{
+	{"trano_db_max_open_connections", "Maximum number of open connections to the database.", "gauge",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+	{"trano_db_open_connections", "Established connections, in use and idle.", "gauge",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+	{"trano_db_in_use_connections", "Connections currently in use.", "gauge",
+		func(s sql.DBStats) float64 { return float64(s.InUse) }},
+	{"trano_db_idle_connections", "Idle connections.", "gauge",
+		func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	{"trano_db_wait_count_total", "Connections waited for.", "counter",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+	{"trano_db_wait_duration_seconds_total", "Time blocked waiting for a connection.", "counter",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	{"trano_db_max_idle_closed_total", "Connections closed due to the idle connection limit.", "counter",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+	{"trano_db_max_lifetime_closed_total", "Connections closed due to the connection lifetime limit.", "counter",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+}
+
+func (p *dbPools) write(w *bufio.Writer) {
+	p.mu.Lock()
+	names := make([]string, 0, len(p.pools))
+	for name := range p.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats := make([]sql.DBStats, len(names))
+	for i, name := range names {
+		stats[i] = p.pools[name].Stats()
+	}
+	p.mu.Unlock()
+
+	for _, s := range dbStats {
+		d := desc{fqName: s.name, help: s.help}
+		d.header(w, s.typ)
+		for i, name := range names {
+			writeSample(w, s.name, `pool="`+escapeLabel(name)+`"`, s.value(stats[i]))
+		}
+	}
+}
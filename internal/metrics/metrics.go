@@ -0,0 +1,330 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds metric families and writes them in the Prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+}
+
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// Default is the registry the package level constructors register with
+var Default = NewRegistry()
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name()] {
+		panic("metrics: duplicate metric " + f.name())
+	}
+	r.names[f.name()] = true
+	r.families = append(r.families, f)
+}
+
+// Handler serves the registry for a Prometheus scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		families := append([]family(nil), r.families...)
+		r.mu.Unlock()
+		sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bw := bufio.NewWriter(w)
+		for _, f := range families {
+			f.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+type desc struct {
+	fqName string
+	help   string
+	labels []string
+}
+
+func (d *desc) name() string { return d.fqName }
+
+func (d *desc) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.fqName, escapeHelp(d.help), d.fqName, typ)
+}
+
+// series keeps one value per label combination
+type series[T any] struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*T
+	keys   map[string][]string
+	create func() *T
+}
+
+func (s *series[T]) with(values []string) *T {
+	if len(values) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", s.fqName, len(s.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	if !ok {
+		v = s.create()
+		s.values[key] = v
+		s.keys[key] = append([]string(nil), values...)
+	}
+	return v
+}
+
+// each calls fn for every series in label order
+func (s *series[T]) each(fn func(labels string, v *T)) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		labels string
+		v      *T
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = entry{labelPairs(s.labels, s.keys[k]), s.values[k]}
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		fn(e.labels, e.v)
+	}
+}
+
+func newSeries[T any](name, help string, labels []string, create func() *T) series[T] {
+	return series[T]{
+		desc:   desc{fqName: name, help: help, labels: labels},
+		values: map[string]*T{},
+		keys:   map[string][]string{},
+		create: create,
+	}
+}
+
+// value is a float64 updated atomically
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) add(d float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+func (v *value) load() float64 {
+	return math.Float64frombits(v.bits.Load())
+}
+
+// Counter only goes up
+type Counter struct{ v value }
+
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add panics on negative d, counters never go down
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		panic("metrics: counter decreased")
+	}
+	c.v.add(d)
+}
+
+type CounterVec struct {
+	series[Counter]
+}
+
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newSeries(name, help, labels, func() *Counter { return &Counter{} })}
+	Default.register(c)
+	return c
+}
+
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.with(labelValues)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.each(func(labels string, v *Counter) {
+		writeSample(w, c.fqName, labels, v.v.load())
+	})
+}
+
+// Gauge goes up and down
+type Gauge struct{ v value }
+
+func (g *Gauge) Set(x float64) { g.v.bits.Store(math.Float64bits(x)) }
+func (g *Gauge) Add(d float64) { g.v.add(d) }
+func (g *Gauge) Inc()          { g.v.add(1) }
+func (g *Gauge) Dec()          { g.v.add(-1) }
+
+type GaugeVec struct {
+	series[Gauge]
+}
+
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newSeries(name, help, labels, func() *Gauge { return &Gauge{} })}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeVec) With(labelValues ...string) *Gauge {
+	return g.with(labelValues)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	g.each(func(labels string, v *Gauge) {
+		writeSample(w, g.fqName, labels, v.v.load())
+	})
+}
+
+// DefBuckets suit latencies from a millisecond to ten seconds
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64 // per bucket, cumulated when written
+	sum    value
+	count  atomic.Uint64
+}
+
+func (h *Histogram) Observe(x float64) {
+	i := sort.SearchFloat64s(h.upper, x)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.sum.add(x)
+	h.count.Add(1)
+}
+
+type HistogramVec struct {
+	series[Histogram]
+	buckets []float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{buckets: buckets}
+	h.series = newSeries(name, help, labels, func() *Histogram {
+		return &Histogram{upper: buckets, counts: make([]atomic.Uint64, len(buckets))}
+	})
+	Default.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.each(func(labels string, v *Histogram) {
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += v.counts[i].Load()
+			writeSample(w, h.fqName+"_bucket", joinLabels(labels, `le="`+formatFloat(le)+`"`), float64(cum))
+		}
+		count := v.count.Load()
+		writeSample(w, h.fqName+"_bucket", joinLabels(labels, `le="+Inf"`), float64(count))
+		writeSample(w, h.fqName+"_sum", labels, v.sum.load())
+		writeSample(w, h.fqName+"_count", labels, float64(count))
+	})
+}
+
+// GaugeFunc is read when scraped, for values owned elsewhere
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{fqName: name, help: help}, fn: fn}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	writeSample(w, g.fqName, "", g.fn())
+}
+
+func writeSample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func labelPairs(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = n + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,71 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	db "trano/internal/db/sqlc"
+)
+
+// mergeAliasRuns moves what was polled under an alias number into the canonical run of
+// the same date. The alias run stays behind empty so it keeps being polled while
+// upstream reports the train under that number.
+func mergeAliasRuns(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.Logger) {
+	pairs, err := queries.ListAliasRunsToMerge(ctx)
+	if err != nil {
+		logger.Printf("failed to list alias runs: %v", err)
+		return
+	}
+
+	merged := 0
+	for _, pair := range pairs {
+		if err := mergeRun(ctx, queries, sqlDB, pair); err != nil {
+			logger.Printf("failed to merge %s into %s: %v", pair.AliasRunID, pair.CanonicalRunID, err)
+			continue
+		}
+		merged++
+	}
+
+	if merged > 0 {
+		logger.Printf("aliases | merged: %d/%d", merged, len(pairs))
+	}
+}
+
+func mergeRun(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, pair db.ListAliasRunsToMergeRow) error {
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txq := queries.WithTx(tx)
+
+	// status first, it compares against the canonical run before anything else moves
+	if err := txq.MergeRunStatus(ctx, db.MergeRunStatusParams{
+		CanonicalRunID: pair.CanonicalRunID,
+		AliasRunID:     pair.AliasRunID,
+	}); err != nil {
+		return err
+	}
+	if err := txq.CopyRunLocations(ctx, db.CopyRunLocationsParams{
+		CanonicalRunID: pair.CanonicalRunID,
+		AliasRunID:     pair.AliasRunID,
+	}); err != nil {
+		return err
+	}
+	if err := txq.DeleteRunLocations(ctx, pair.AliasRunID); err != nil {
+		return err
+	}
+	if err := txq.CopyRunStationEvents(ctx, db.CopyRunStationEventsParams{
+		CanonicalRunID: pair.CanonicalRunID,
+		AliasRunID:     pair.AliasRunID,
+	}); err != nil {
+		return err
+	}
+	if err := txq.DeleteRunStationEvents(ctx, pair.AliasRunID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,68 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	AnomalyStalled = "stalled"
+
+	// GPS jitter around a halt must not count as progress (0.2 km in u4)
+	stallToleranceU4 = 2000
+)
+
+// detectStalledRuns flags runs whose distance has not advanced for cfg.StallThreshold
+// while they are still reporting, and resolves episodes of runs that moved on.
+// Each newly opened episode is logged as an anomaly event.
+func detectStalledRuns(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config) {
+	resolved, err := queries.ResolveStalledAnomalies(ctx, stallToleranceU4)
+	if err != nil {
+		logger.Printf("failed to resolve stalled anomalies: %v", err)
+		return
+	}
+
+	stalled, err := queries.ListStalledRuns(ctx, db.ListStalledRunsParams{
+		ToleranceU4:   stallToleranceU4,
+		StalledBefore: time.Now().UTC().Add(-cfg.StallThreshold).Format(time.DateTime),
+	})
+	if err != nil {
+		logger.Printf("failed to list stalled runs: %v", err)
+		return
+	}
+
+	opened := 0
+	for _, run := range stalled {
+		n, err := queries.OpenRunAnomaly(ctx, db.OpenRunAnomalyParams{
+			RunID:        run.RunID,
+			Kind:         AnomalyStalled,
+			StationCode:  run.StationCode,
+			DistanceKmU4: run.DistanceKmU4,
+			SinceTs:      run.StalledSince,
+		})
+		if err != nil {
+			logger.Printf("failed to record stalled anomaly for %s: %v", run.RunID, err)
+			continue
+		}
+		if n > 0 {
+			opened++
+			logger.Printf("anomaly event | kind: %s | run: %s | station: %s | since: %s",
+				AnomalyStalled, run.RunID, nullStationCode(run.StationCode), run.StalledSince)
+		}
+	}
+
+	if opened > 0 || resolved > 0 {
+		logger.Printf("anomalies | stalled: %d | opened: %d | resolved: %d", len(stalled), opened, resolved)
+	}
+}
+
+func nullStationCode(code sql.NullString) string {
+	if !code.Valid || code.String == "" {
+		return "-"
+	}
+	return code.String
+}
@@ -0,0 +1,59 @@
+package poller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// bodies past this are cut before compressing, the start is what a parser fix needs
+const maxArchivedBody = 256 << 10
+
+// kind of an archived body that is not JSON the poller understands, short bodies
+// nobody recognises are archived as statusUnknown
+const archiveUnparseable = "unparseable"
+
+// archiveResponse keeps a body the poller could not make sense of, so a parser bug
+// leaves evidence behind. Failing to archive is logged and otherwise ignored.
+func archiveResponse(ctx context.Context, queries *db.Queries, logger *log.Logger, runID, kind string, body []byte, reason error) {
+	size := len(body)
+	if len(body) > maxArchivedBody {
+		body = body[:maxArchivedBody]
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(body)
+	if err := zw.Close(); err != nil {
+		logger.Printf("failed to compress %s response for %s: %v", kind, runID, err)
+		return
+	}
+
+	var errText sql.NullString
+	if reason != nil {
+		errText = sql.NullString{String: reason.Error(), Valid: true}
+	}
+	if err := queries.ArchiveFailedResponse(ctx, db.ArchiveFailedResponseParams{
+		RunID:     runID,
+		Kind:      kind,
+		Error:     errText,
+		BodyGzip:  buf.Bytes(),
+		BodyBytes: int64(size),
+	}); err != nil {
+		logger.Printf("failed to archive %s response for %s: %v", kind, runID, err)
+	}
+}
+
+// pruneArchive drops archived responses older than retention
+func pruneArchive(ctx context.Context, queries *db.Queries, logger *log.Logger, retention time.Duration) {
+	before := time.Now().UTC().Add(-retention).Format(time.DateTime)
+	if n, err := queries.PruneFailedResponses(ctx, before); err != nil {
+		logger.Printf("failed to prune archived responses: %v", err)
+	} else if n > 0 {
+		logger.Printf("pruned %d archived responses", n)
+	}
+}
@@ -0,0 +1,64 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+// Backfill fetches the final status of runs between from and to that never reported,
+// e.g. because the poller was down while they ran. Upstream keeps serving recently
+// completed journeys for a few days, so this only helps shortly after an outage.
+// Runs the scheduler missed are generated first. Requests are sent one at a time,
+// delay apart.
+func Backfill(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.Logger, cfg Config, loc *time.Location, from, to time.Time, delay time.Duration) ([]CycleResult, error) {
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if err := queries.GenerateRunsForDate(ctx, db.GenerateRunsForDateParams{
+			RunDate: d.Format(time.DateOnly),
+			Weekday: int64(d.Weekday()),
+		}); err != nil {
+			return nil, fmt.Errorf("generate runs for %s: %w", d.Format(time.DateOnly), err)
+		}
+	}
+
+	runs, err := queries.ListRunsToBackfill(ctx, db.ListRunsToBackfillParams{
+		FromDate: from.Format(time.DateOnly),
+		ToDate:   to.Format(time.DateOnly),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list runs to backfill: %w", err)
+	}
+	logger.Printf("backfill: %d runs without data between %s and %s", len(runs), from.Format(time.DateOnly), to.Format(time.DateOnly))
+
+	api := newFetcher(cfg, logger)
+	results := make([]CycleResult, 0, len(runs))
+	for i, run := range runs {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return results, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		result := processRun(ctx, db.ListRunsToPollRow(run), queries, sqlDB, api, nil, cfg.storeOptions(), logger, loc)
+		if result.CircuitOpen {
+			logResults(logger, "backfill results", results)
+			return results, fmt.Errorf("backfill stopped after %d runs: %w", i, wimt.ErrCircuitOpen)
+		}
+		recordPoll(ctx, queries, logger, result, cfg.Window)
+		results = append(results, result)
+
+		if (i+1)%100 == 0 {
+			logger.Printf("backfill: %d/%d runs", i+1, len(runs))
+		}
+	}
+
+	logResults(logger, "backfill results", results)
+	return results, nil
+}
@@ -0,0 +1,41 @@
+package poller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// catchUp brings the runs left behind by downtime up to date before the first cycle.
+// Runs last heard from before their expected arrival, and due more than overdueQuiet
+// ago, are closed by their schedule. Moving runs silent for a few windows are made due
+// and their dead reckoning dropped; the returned time, UTC, puts them at the front of
+// the first cycle. Without it a restart leaves ghost positions on the map until the
+// runs come round again.
+func catchUp(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config, loc *time.Location) string {
+	now := time.Now()
+	_, offset := now.In(loc).Zone()
+
+	finished, err := queries.CloseRunsFinishedOffline(ctx, db.CloseRunsFinishedOfflineParams{
+		ArrivedBefore: now.In(loc).Add(-overdueQuiet).Format(time.DateTime),
+		TzOffsetSec:   int64(offset),
+	})
+	if err != nil {
+		logger.Printf("failed to close runs finished while down: %v", err)
+	}
+
+	staleBefore := now.UTC().Add(-max(3*cfg.Window, 5*time.Minute)).Format(time.DateTime)
+	stale, err := queries.ResetStaleRuns(ctx, staleBefore)
+	if err != nil {
+		logger.Printf("failed to reset stale runs: %v", err)
+		return ""
+	}
+
+	logger.Printf("startup catch-up | finished while down: %d | stale: %d", finished, stale)
+	if stale == 0 {
+		return ""
+	}
+	return staleBefore
+}
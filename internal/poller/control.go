@@ -0,0 +1,212 @@
+package poller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tuning is the part of Config that can be changed while the poller runs
+type Tuning struct {
+	Concurrency          int16         `json:"concurrency"`
+	PreDepartureWorkers  int16         `json:"pre_departure_workers"`
+	Window               time.Duration `json:"-"`
+	StaticErrorThreshold int8          `json:"static_error_threshold"`
+	StallThreshold       time.Duration `json:"-"`
+	MaxRunsPerCycle      int           `json:"max_runs_per_cycle"`
+	BackoffBase          time.Duration `json:"-"`
+	BackoffMax           time.Duration `json:"-"`
+	ProxyURL             string        `json:"-"` // may hold credentials, only changed by Reload
+}
+
+func (t Tuning) validate() error {
+	switch {
+	case t.Concurrency <= 0:
+		return errors.New("concurrency must be positive")
+	case t.PreDepartureWorkers <= 0:
+		return errors.New("pre_departure_workers must be positive")
+	case t.Window < time.Second:
+		return errors.New("window must be at least 1s")
+	case t.StaticErrorThreshold <= 0:
+		return errors.New("static_error_threshold must be positive")
+	case t.StallThreshold <= 0:
+		return errors.New("stall_threshold must be positive")
+	case t.MaxRunsPerCycle < 0:
+		return errors.New("max_runs_per_cycle can't be negative")
+	case t.BackoffBase <= 0 || t.BackoffMax < t.BackoffBase:
+		return errors.New("backoff_base must be positive and at most backoff_max")
+	}
+	return nil
+}
+
+// ErrNotRunning is returned by Control while no poller has started in this process
+var ErrNotRunning = errors.New("poller is not running")
+
+// Control lets the API pause, resume and retune the poller of the same process
+// without a restart. Changes reach the loop between cycles, a paused or sleeping
+// poller wakes up for them straight away. A nil *Control changes nothing.
+type Control struct {
+	mu       sync.Mutex
+	started  bool
+	paused   bool
+	pausedAt time.Time
+	tuning   Tuning
+	changed  chan struct{} // closed on every change
+}
+
+type ControlStatus struct {
+	Running  bool       `json:"running"`
+	Paused   bool       `json:"paused"`
+	PausedAt *time.Time `json:"paused_at"`
+	Tuning
+	Window         string `json:"window"`
+	StallThreshold string `json:"stall_threshold"`
+	BackoffBase    string `json:"backoff_base"`
+	BackoffMax     string `json:"backoff_max"`
+}
+
+func NewControl() *Control {
+	return &Control{changed: make(chan struct{})}
+}
+
+// Status is the state the loop works to, retuned values included
+func (c *Control) Status() ControlStatus {
+	if c == nil {
+		return ControlStatus{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := ControlStatus{
+		Running:        c.started,
+		Paused:         c.paused,
+		Tuning:         c.tuning,
+		Window:         c.tuning.Window.String(),
+		StallThreshold: c.tuning.StallThreshold.String(),
+		BackoffBase:    c.tuning.BackoffBase.String(),
+		BackoffMax:     c.tuning.BackoffMax.String(),
+	}
+	if c.paused {
+		at := c.pausedAt
+		s.PausedAt = &at
+	}
+	return s
+}
+
+// Pause stops new cycles once the current one is done, false if already paused
+func (c *Control) Pause() (bool, error) {
+	return c.update(func() bool {
+		if c.paused {
+			return false
+		}
+		c.paused, c.pausedAt = true, time.Now()
+		return true
+	})
+}
+
+// Resume starts a cycle straight away, false if the poller was not paused
+func (c *Control) Resume() (bool, error) {
+	return c.update(func() bool {
+		if !c.paused {
+			return false
+		}
+		c.paused, c.pausedAt = false, time.Time{}
+		return true
+	})
+}
+
+// Tune applies change to the current tuning, a result that fails validation is
+// rejected as a whole
+func (c *Control) Tune(change func(*Tuning)) (Tuning, error) {
+	var err error
+	var tuning Tuning
+	_, notRunning := c.update(func() bool {
+		next := c.tuning
+		change(&next)
+		if err = next.validate(); err != nil {
+			return false
+		}
+		changed := next != c.tuning
+		c.tuning = next
+		tuning = next
+		return changed
+	})
+	if notRunning != nil {
+		return Tuning{}, notRunning
+	}
+	return tuning, err
+}
+
+// Reload replaces every setting with the ones cfg holds, for a configuration that
+// was read again. Settings changed through Tune are lost.
+func (c *Control) Reload(cfg Config) (Tuning, error) {
+	return c.Tune(func(t *Tuning) { *t = cfg.tuning() })
+}
+
+func (c *Control) update(apply func() bool) (bool, error) {
+	if c == nil {
+		return false, ErrNotRunning
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		return false, ErrNotRunning
+	}
+	changed := apply()
+	if changed {
+		close(c.changed)
+		c.changed = make(chan struct{})
+	}
+	return changed, nil
+}
+
+// start hands the configured tuning to the control, called once by Start
+func (c *Control) start(cfg Config) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = true
+	c.tuning = cfg.tuning()
+}
+
+// apply returns cfg with the current tuning, whether the poller is paused and a
+// channel closed on the next change
+func (c *Control) apply(cfg Config) (Config, bool, <-chan struct{}) {
+	if c == nil {
+		return cfg, false, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.tuning
+	cfg.Concurrency = t.Concurrency
+	cfg.PreDepartureWorkers = t.PreDepartureWorkers
+	cfg.Window = t.Window
+	cfg.StaticErrorThreshold = t.StaticErrorThreshold
+	cfg.StallThreshold = t.StallThreshold
+	cfg.MaxRunsPerCycle = t.MaxRunsPerCycle
+	cfg.BackoffBase = t.BackoffBase
+	cfg.BackoffMax = t.BackoffMax
+	cfg.ProxyURL = t.ProxyURL
+	return cfg, c.paused, c.changed
+}
+
+func (cfg Config) tuning() Tuning {
+	return Tuning{
+		Concurrency:          cfg.Concurrency,
+		PreDepartureWorkers:  cfg.PreDepartureWorkers,
+		Window:               cfg.Window,
+		StaticErrorThreshold: cfg.StaticErrorThreshold,
+		StallThreshold:       cfg.StallThreshold,
+		MaxRunsPerCycle:      cfg.MaxRunsPerCycle,
+		BackoffBase:          cfg.BackoffBase,
+		BackoffMax:           cfg.BackoffMax,
+		ProxyURL:             cfg.ProxyURL,
+	}
+}
+
+func (t Tuning) String() string {
+	return fmt.Sprintf("workers: %d+%d | window: %v | static_error_thres: %d | stall: %v | max_runs: %d | backoff: %v..%v",
+		t.Concurrency, t.PreDepartureWorkers, t.Window, t.StaticErrorThreshold, t.StallThreshold, t.MaxRunsPerCycle, t.BackoffBase, t.BackoffMax)
+}
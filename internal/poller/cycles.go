@@ -0,0 +1,50 @@
+package poller
+
+import (
+	"sync"
+	"time"
+)
+
+// Cycles announces finished poller cycles to whoever waits in the same process, such as
+// long-polling clients that want fresh positions as soon as they land
+type Cycles struct {
+	mu   sync.Mutex
+	last time.Time     // when the latest cycle finished, zero before the first
+	next chan struct{} // closed when the cycle in progress finishes
+}
+
+var closedCycle = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func NewCycles() *Cycles {
+	return &Cycles{next: make(chan struct{})}
+}
+
+// After returns a channel that is closed once a cycle has finished at or after t,
+// straight away if one already has. A nil *Cycles never announces anything.
+func (c *Cycles) After(t time.Time) <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.IsZero() && !c.last.Before(t) {
+		return closedCycle
+	}
+	return c.next
+}
+
+// finish wakes everyone waiting for the cycle in progress
+func (c *Cycles) finish() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = time.Now()
+	close(c.next)
+	c.next = make(chan struct{})
+}
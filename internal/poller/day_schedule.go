@@ -0,0 +1,76 @@
+package poller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+// recordDaySchedule keeps the full days_schedule of a live answer, so timelines and
+// trip updates can be built from the last poll without asking upstream again. Only the
+// latest one per run is kept.
+func recordDaySchedule(ctx context.Context, queries *db.Queries, logger *log.Logger, runID string, schedule []wimt.DaySchedule) {
+	if len(schedule) == 0 {
+		return
+	}
+	body, err := json.Marshal(schedule)
+	if err != nil {
+		logger.Printf("failed to encode days_schedule for %s: %v", runID, err)
+		return
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(body)
+	if err := zw.Close(); err != nil {
+		logger.Printf("failed to compress days_schedule for %s: %v", runID, err)
+		return
+	}
+	if err := queries.UpsertRunDaySchedule(ctx, db.UpsertRunDayScheduleParams{
+		RunID:     runID,
+		BodyGzip:  buf.Bytes(),
+		BodyBytes: int64(len(body)),
+		Stations:  int64(len(schedule)),
+	}); err != nil {
+		logger.Printf("failed to record days_schedule for %s: %v", runID, err)
+	}
+}
+
+// RunDaySchedule is the days_schedule last kept for a run and when it was polled (UTC),
+// sql.ErrNoRows when none is
+func RunDaySchedule(ctx context.Context, queries *db.Queries, runID string) ([]wimt.DaySchedule, string, error) {
+	row, err := queries.GetRunDaySchedule(ctx, runID)
+	if err != nil {
+		return nil, "", err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(row.BodyGzip))
+	if err != nil {
+		return nil, "", fmt.Errorf("decompress days_schedule: %w", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, "", fmt.Errorf("decompress days_schedule: %w", err)
+	}
+	schedule := make([]wimt.DaySchedule, 0, row.Stations)
+	if err := json.Unmarshal(body, &schedule); err != nil {
+		return nil, "", fmt.Errorf("decode days_schedule: %w", err)
+	}
+	return schedule, row.PolledAt, nil
+}
+
+// pruneDaySchedules drops kept days_schedules last polled before retention
+func pruneDaySchedules(ctx context.Context, queries *db.Queries, logger *log.Logger, retention time.Duration) {
+	before := time.Now().UTC().Add(-retention).Format(time.DateTime)
+	if n, err := queries.PruneRunDaySchedules(ctx, before); err != nil {
+		logger.Printf("failed to prune days_schedules: %v", err)
+	} else if n > 0 {
+		logger.Printf("pruned %d days_schedules", n)
+	}
+}
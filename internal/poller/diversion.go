@@ -0,0 +1,71 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	AnomalyDiverted = "diverted"
+	statusDiverted  = "diverted"
+
+	// fixes further than this from the route are off it, GPS noise and parallel
+	// lines stay well inside
+	divertedOffsetM = 1500
+	// consecutive off route fixes, each further out than the one before, that flag a
+	// run as diverted
+	divertedFixes = 3
+)
+
+// checkDiversion tells whether a run whose fix is offsetM from its route is running
+// somewhere else. A run already diverted stays so while its fixes are off the route,
+// otherwise it takes divertedFixes fixes drifting away in a row. Opening and closing
+// the diverted anomaly episode is done here too.
+func checkDiversion(ctx context.Context, queries *db.Queries, logger *log.Logger, run db.ListRunsToPollRow, offsetM int64, stationCode string, distanceU4 int64, ts string) bool {
+	wasDiverted := run.CurrentStatus == statusDiverted
+	if offsetM < divertedOffsetM {
+		if wasDiverted {
+			if _, err := queries.ResolveRunAnomaly(ctx, db.ResolveRunAnomalyParams{RunID: run.RunID, Kind: AnomalyDiverted}); err != nil {
+				logger.Printf("failed to resolve diverted anomaly for %s: %v", run.RunID, err)
+			}
+			logger.Printf("run %s is back on its route", run.RunID)
+		}
+		return false
+	}
+	if wasDiverted {
+		return true
+	}
+
+	recent, err := queries.ListRecentRunOffsets(ctx, db.ListRecentRunOffsetsParams{RunID: run.RunID, Limit: divertedFixes - 1})
+	if err != nil {
+		logger.Printf("failed to list route offsets for %s: %v", run.RunID, err)
+		return false
+	}
+	if len(recent) < divertedFixes-1 {
+		return false
+	}
+	next := offsetM
+	for _, off := range recent {
+		if off < divertedOffsetM || off >= next {
+			return false
+		}
+		next = off
+	}
+
+	station := sql.NullString{String: stationCode, Valid: stationCode != ""}
+	if _, err := queries.OpenRunAnomaly(ctx, db.OpenRunAnomalyParams{
+		RunID:        run.RunID,
+		Kind:         AnomalyDiverted,
+		StationCode:  station,
+		DistanceKmU4: sql.NullInt64{Int64: distanceU4, Valid: true},
+		SinceTs:      ts,
+	}); err != nil {
+		logger.Printf("failed to record diverted anomaly for %s: %v", run.RunID, err)
+	}
+	logger.Printf("anomaly event | kind: %s | run: %s | station: %s | offset: %dm",
+		AnomalyDiverted, run.RunID, nullStationCode(station), offsetM)
+	return true
+}
@@ -0,0 +1,34 @@
+package poller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// no train in the country is faster, a higher speed between two fixes is GPS noise
+const maxExtrapolatedSpeed = 160.0
+
+// extrapolatePositions moves trains upstream has gone quiet on along their route at
+// their last speed, so the map doesn't show them parked between fixes. The real
+// position is kept, the next fix replaces the estimate.
+func extrapolatePositions(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config) {
+	if cfg.ExtrapolateFor <= 0 {
+		return
+	}
+	now := time.Now().UTC()
+	n, err := queries.ExtrapolateRunPositions(ctx, db.ExtrapolateRunPositionsParams{
+		QuietBefore: now.Add(-cfg.ExtrapolateAfter).Format(time.DateTime),
+		FixAfter:    now.Add(-cfg.ExtrapolateFor).Format(time.DateTime),
+		MaxSpeedKmh: maxExtrapolatedSpeed,
+	})
+	if err != nil {
+		logger.Printf("failed to extrapolate positions: %v", err)
+		return
+	}
+	if n > 0 {
+		logger.Printf("extrapolated %d positions", n)
+	}
+}
@@ -0,0 +1,87 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// instanceID names this process among pollers sharing the database
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "trano"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// leaseRuns is the heartbeat of a poller sharing the database with others: it extends
+// the leases it holds and claims free runs up to cfg.LeaseMaxRuns. Runs of an instance
+// that stopped heartbeating are free again once their leases expire. Returns the
+// owner ListRunsToPoll should poll for, empty while leases are off.
+func leaseRuns(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config, loc *time.Location) string {
+	if cfg.LeaseTTL <= 0 {
+		return ""
+	}
+	now := time.Now()
+	nowUTC := now.UTC().Format(time.DateTime)
+	expires := now.UTC().Add(cfg.LeaseTTL).Format(time.DateTime)
+
+	nowTs := now.In(loc).Format(time.DateTime)
+
+	var released int64
+	renewed, err := queries.RenewRunLeases(ctx, db.RenewRunLeasesParams{
+		ExpiresAt:               expires,
+		LeaseOwner:              cfg.InstanceID,
+		NowUtc:                  nowUTC,
+		NowTs:                   nowTs,
+		StaticResponseThreshold: int64(cfg.StaticErrorThreshold),
+	})
+	if err != nil {
+		logger.Printf("failed to renew run leases: %v", err)
+	} else {
+		// what was not renewed will not be polled here, it must not fill the share
+		released, err = queries.ReleaseUnrenewedRunLeases(ctx, db.ReleaseUnrenewedRunLeasesParams{
+			LeaseOwner: cfg.InstanceID,
+			ExpiresAt:  expires,
+		})
+		if err != nil {
+			logger.Printf("failed to release unrenewed run leases: %v", err)
+		}
+	}
+	claimed, err := queries.ClaimRuns(ctx, db.ClaimRunsParams{
+		LeaseOwner:              cfg.InstanceID,
+		ExpiresAt:               expires,
+		NowTs:                   nowTs,
+		StaticResponseThreshold: int64(cfg.StaticErrorThreshold),
+		NowUtc:                  nowUTC,
+		MaxRuns:                 int64(cfg.LeaseMaxRuns),
+	})
+	if err != nil {
+		logger.Printf("failed to claim runs: %v", err)
+	}
+	if claimed > 0 || released > 0 {
+		logger.Printf("run leases | instance: %s | renewed: %d | released: %d | claimed: %d", cfg.InstanceID, renewed, released, claimed)
+	}
+	return cfg.InstanceID
+}
+
+// releaseLeases gives this instance's runs back on shutdown, so the others don't wait
+// out the lease
+func releaseLeases(queries *db.Queries, logger *log.Logger, cfg Config) {
+	if cfg.LeaseTTL <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n, err := queries.ReleaseRunLeases(ctx, cfg.InstanceID)
+	if err != nil {
+		logger.Printf("failed to release run leases: %v", err)
+		return
+	}
+	logger.Printf("released %d run leases", n)
+}
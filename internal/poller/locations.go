@@ -0,0 +1,105 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// locationWrite is one run's new fix, update is nil when the fix did not snap
+type locationWrite struct {
+	log    db.LogRunLocationParams
+	update *db.UpdateRunStatusParams
+}
+
+// locationBatch gathers the fixes of a cycle and writes many per transaction, at a
+// thousand runs a BEGIN/COMMIT each is most of the cycle and keeps the database busy.
+// A batch is written once it holds size fixes or its oldest waited maxAge, so the
+// map never lags far behind, the rest by flush at the end of the cycle. A nil batch
+// writes each fix in a transaction of its own.
+type locationBatch struct {
+	sqlDB   *sql.DB
+	queries *db.Queries
+	logger  *log.Logger
+	size    int
+	maxAge  time.Duration
+
+	mu      sync.Mutex
+	pending []locationWrite
+	since   time.Time
+}
+
+func newLocationBatch(sqlDB *sql.DB, queries *db.Queries, logger *log.Logger, size int, maxAge time.Duration) *locationBatch {
+	return &locationBatch{sqlDB: sqlDB, queries: queries, logger: logger, size: size, maxAge: maxAge}
+}
+
+func (b *locationBatch) add(ctx context.Context, w locationWrite) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) == 0 {
+		b.since = time.Now()
+	}
+	b.pending = append(b.pending, w)
+	if len(b.pending) >= b.size || time.Since(b.since) >= b.maxAge {
+		b.write(ctx)
+	}
+}
+
+// flush writes whatever is pending
+func (b *locationBatch) flush(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.write(ctx)
+}
+
+// write must be called with mu held, writes are serialised on purpose
+func (b *locationBatch) write(ctx context.Context) {
+	if len(b.pending) == 0 {
+		return
+	}
+	start := time.Now()
+	n := writeLocations(ctx, b.sqlDB, b.queries, b.logger, b.pending)
+	locationBatchDuration.With().Observe(time.Since(start).Seconds())
+	if n < len(b.pending) {
+		b.logger.Printf("location batch | written: %d of %d", n, len(b.pending))
+	}
+	b.pending = b.pending[:0]
+}
+
+// writeLocations logs each fix and moves its run there in one transaction. A write
+// that fails is logged and skipped, the others still go in. Returns how many were
+// logged.
+func writeLocations(ctx context.Context, sqlDB *sql.DB, queries *db.Queries, logger *log.Logger, writes []locationWrite) int {
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Printf("begin location tx failed for %d fixes: %v", len(writes), err)
+		return 0
+	}
+	defer tx.Rollback()
+	txq := queries.WithTx(tx)
+
+	logged := 0
+	for _, w := range writes {
+		if err := txq.LogRunLocation(ctx, w.log); err != nil {
+			logger.Printf("failed to log location for %s: %v", w.log.RunID, err)
+			continue
+		}
+		logged++
+		if w.update == nil {
+			continue
+		}
+		if err := txq.UpdateRunStatus(ctx, *w.update); err != nil {
+			logger.Printf("failed to update run location for %s: %v", w.log.RunID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Printf("commit location tx failed for %d fixes: %v", len(writes), err)
+		return 0
+	}
+	return logged
+}
@@ -0,0 +1,76 @@
+package poller
+
+import (
+	"errors"
+	"time"
+
+	"trano/internal/health"
+	"trano/internal/metrics"
+)
+
+var (
+	cycleDuration = metrics.NewHistogram("trano_poller_cycle_duration_seconds",
+		"Time to poll every due run once, before sleeping out the window.",
+		[]float64{1, 5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600})
+	cycleTargets = metrics.NewGauge("trano_poller_cycle_targets",
+		"Runs due for polling in the latest cycle.")
+	cycleDeferred = metrics.NewGauge("trano_poller_cycle_deferred",
+		"Due runs the latest cycle left for the next, over POLLER_MAX_RUNS_PER_CYCLE.")
+	pollResults = metrics.NewCounter("trano_poller_results_total",
+		"Polls by outcome.", "result")
+	coordsLogged = metrics.NewCounter("trano_poller_coords_logged_total",
+		"Successful polls that stored a new position fix.")
+	outlierFixes = metrics.NewCounter("trano_poller_outlier_fixes_total",
+		"Position fixes dropped as impossible for the train, by reason.", "reason")
+	stationEvents = metrics.NewCounter("trano_poller_station_events_total",
+		"Arrivals and departures recorded from polls.")
+	locationBatchDuration = metrics.NewHistogram("trano_poller_location_batch_seconds",
+		"Time to write one batch of position fixes.",
+		[]float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10})
+
+	cycleHealth = health.Register("poller", 15*time.Minute)
+	// no polls are due overnight, so WIMT only goes degraded on a failed request
+	upstreamHealth = health.Register("wimt", 0)
+)
+
+var errUpstream = errors.New("live status request failed")
+
+// outcome names the result for the trano_poller_results_total label
+func (r CycleResult) outcome() string {
+	switch {
+	case r.Success:
+		return "success"
+	case r.ShortResponse != "":
+		return r.ShortResponse
+	case r.StaticResponse:
+		return "static_response"
+	case r.APIError:
+		return "api_error"
+	case r.UnknownError:
+		return "unknown_error"
+	case r.CircuitOpen:
+		return "circuit_open"
+	}
+	return "skipped"
+}
+
+func observeResult(r CycleResult) {
+	pollResults.With(r.outcome()).Inc()
+	if r.CoordsLogged {
+		coordsLogged.With().Inc()
+	}
+	if r.OutlierFix != "" {
+		outlierFixes.With(r.OutlierFix).Inc()
+	}
+	if r.StationEvents > 0 {
+		stationEvents.With().Add(float64(r.StationEvents))
+	}
+
+	// any answer, even a short or static one, means WIMT is reachable
+	switch {
+	case r.APIError || r.CircuitOpen:
+		upstreamHealth.Failure(errUpstream)
+	case r.Success || r.ShortResponse != "" || r.StaticResponse:
+		upstreamHealth.Success("")
+	}
+}
@@ -0,0 +1,48 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+// OnDemand polls single runs outside the cycle, for finding out why a run stopped
+// updating. It shares the live status source and budget of the poller.
+type OnDemand struct {
+	queries *db.Queries
+	sqlDB   *sql.DB
+	api     wimt.Fetcher
+	opts    storeOptions
+	logger  *log.Logger
+	loc     *time.Location
+}
+
+func NewOnDemand(queries *db.Queries, sqlDB *sql.DB, logger *log.Logger, cfg Config, loc *time.Location) *OnDemand {
+	return &OnDemand{
+		queries: queries,
+		sqlDB:   sqlDB,
+		api:     newFetcher(cfg, logger),
+		opts:    cfg.storeOptions(),
+		logger:  logger,
+		loc:     loc,
+	}
+}
+
+// Poll runs processRun for runID now, whatever its start time, arrival or error
+// counts. The poll shows up in the poller metrics but not in the run's coverage, which
+// measures the scheduled polls. sql.ErrNoRows means there is no such run.
+func (o *OnDemand) Poll(ctx context.Context, runID string) (CycleResult, error) {
+	row, err := o.queries.GetRunToPoll(ctx, runID)
+	if err != nil {
+		return CycleResult{}, err
+	}
+
+	result := processRun(ctx, db.ListRunsToPollRow(row), o.queries, o.sqlDB, o.api, nil, o.opts, o.logger, o.loc)
+	observeResult(result)
+	logResults(o.logger, "forced poll "+runID, []CycleResult{result})
+	return result, nil
+}
@@ -0,0 +1,29 @@
+package poller
+
+import (
+	"database/sql"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// no train gets between two fixes faster than this, upstream sometimes hands out
+	// another user's fix and the train jumps across the country
+	maxFixSpeedKmh = 200
+	// a fix this far from the route is not the train's, unless it is diverted
+	corridorM = 50_000
+)
+
+// outlierFix names why a fix can't be the train's, empty for a plausible one. A run
+// keeps its previous position in place of an outlier, which is not logged either, so
+// the next fix is measured against the last good one. After speedMaxGap without a
+// good fix a jump is taken as it is.
+func outlierFix(run db.ListRunsToPollRow, speed sql.NullFloat64, offsetM sql.NullInt64) string {
+	switch {
+	case speed.Valid && speed.Float64 > maxFixSpeedKmh:
+		return "speed"
+	case offsetM.Valid && offsetM.Int64 > corridorM && run.CurrentStatus != statusDiverted:
+		return "corridor"
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	dbtypes "trano/internal/db"
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+type stationPlatform struct {
+	StationCode  string                  `json:"station_code"`
+	Platform     *string                 `json:"platform"`
+	PlatformInfo []dbtypes.PlatformShare `json:"platform_info"`
+}
+
+// recordPlatforms keeps the platform of every stop upstream has one for, the stations
+// ahead included since that is where riders need it
+func recordPlatforms(ctx context.Context, queries *db.Queries, run db.ListRunsToPollRow, data *wimt.APIResponse, logger *log.Logger) {
+	var platforms []stationPlatform
+	for i := range data.DaysSchedule {
+		stn := &data.DaysSchedule[i]
+		if stn.StationCode == "" {
+			continue
+		}
+		p := stationPlatform{StationCode: stn.StationCode}
+		if platform := strings.TrimSpace(stn.Platform); platform != "" && platform != "-" {
+			p.Platform = &platform
+		}
+		for _, info := range stn.PlatformInfo {
+			if info.PlatformNumber == "" {
+				continue
+			}
+			p.PlatformInfo = append(p.PlatformInfo, dbtypes.PlatformShare{
+				Platform:      info.PlatformNumber,
+				Percentage:    parsePercentage(info.Percentage),
+				FeedbackCount: info.FeedbackCount,
+			})
+		}
+		if p.Platform != nil || p.PlatformInfo != nil {
+			platforms = append(platforms, p)
+		}
+	}
+	if len(platforms) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(platforms)
+	if err != nil {
+		logger.Printf("failed to encode platforms for %s: %v", run.RunID, err)
+		return
+	}
+	if err := queries.UpsertRunPlatforms(ctx, db.UpsertRunPlatformsParams{
+		RunID:     run.RunID,
+		Platforms: string(b),
+	}); err != nil {
+		logger.Printf("failed to record platforms for %s: %v", run.RunID, err)
+	}
+}
+
+// parsePercentage reads "80" or "80%"
+func parsePercentage(s *string) *float64 {
+	if s == nil {
+		return nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(*s), "%"), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,15 +15,48 @@ import (
 
 	dbtypes "trano/internal/db"
 	db "trano/internal/db/sqlc"
+	"trano/internal/ratelimit"
 	"trano/internal/wimt"
 )
 
 type Config struct {
-	Concurrency          int16
+	Concurrency          int16 // workers for runs on the move
 	Window               time.Duration
 	ProxyURL             string
 	StaticErrorThreshold int8
-	TotalErrorThreshold  int8
+	StallThreshold       time.Duration           // no progress for this long while running flags the run as stalled
+	Fetcher              wimt.Fetcher            // live status source, nil uses whereismytrain through ProxyURL
+	RecordDir            string                  // when set every live status exchange is written here for replay
+	Budget               *ratelimit.Budget       // paces whereismytrain requests across restarts, nil leaves them to the cycle spacing
+	Breaker              *wimt.Breaker           // stops requests for the whole fleet while upstream is down, may be nil
+	Fallback             wimt.LiveStatusProvider // asked while the circuit is open or upstream answers without live data, may be nil
+	Cycles               *Cycles                 // told about every finished cycle, may be nil
+	Control              *Control                // pauses and retunes the loop from the API, may be nil
+	PreDepartureWorkers  int16                   // separate workers for runs that have not started, so they never hold up moving ones
+	OriginInterval       time.Duration           // between polls of a run still at its origin after its scheduled departure
+	DormantInterval      time.Duration           // between polls of a run that has not left its origin DormantAfter past departure
+	DormantAfter         time.Duration
+	TypeIntervals        []TypeInterval // poll intervals of moving trains by train type, every cycle for the rest
+	MaxRunsPerCycle      int            // due runs beyond this wait for the next cycle, lowest priority first; 0 polls all
+	BackoffBase          time.Duration  // wait after a run's first failed poll, doubling with every further one
+	BackoffMax           time.Duration
+	ArchiveRetention     time.Duration // how long bodies the poller could not parse are kept
+	KeepSchedules        bool          // keep the latest full days_schedule of every run polled
+	ScheduleRetention    time.Duration // how long a kept days_schedule outlives its last poll
+	PositionSmoothing    float64       // weight of a new fix in the position shown, 0 shows fixes as they come
+	NoDataAfter          time.Duration // a run never reported on is closed as no_data this long after its scheduled arrival
+	OverdueAfter         time.Duration // a silent running run is closed as timed_out this long after its expected arrival
+	ExtrapolateAfter     time.Duration // a moving run without a fix for this long is dead reckoned along its route
+	ExtrapolateFor       time.Duration // and for at most this long past its last fix, 0 turns dead reckoning off
+	TransientRetries     int           // times a timed out or dropped request is sent again within the cycle
+	TransientRetryDelay  time.Duration // around this long before the first retry, growing with each further one
+	LocationBatchSize    int           // position fixes written per transaction
+	LocationFlush        time.Duration // longest a fix waits for its batch
+	LeaseTTL             time.Duration // instances sharing the database poll runs they lease for this long, 0 polls every run
+	LeaseMaxRuns         int           // most runs this instance leases at once
+	InstanceID           string        // lease owner, hostname and pid by default
+	Sweeps               bool          // run the sweeps over every run, leased or not, see sweep
+	catchUpBefore        string        // set by Start for the first cycle, see catchUp
 }
 
 type ErrorEntry struct {
@@ -39,15 +74,29 @@ type LastStationSnapshot struct {
 }
 
 type CycleResult struct {
-	RunID          string
-	Success        bool
-	ShortResponse  string
-	StaticResponse bool
-	APIError       bool
-	UnknownError   bool
-	NoCoords       bool
-	CoordsLogged   bool
-	BecameArrived  bool
+	RunID          string `json:"run_id"`
+	Success        bool   `json:"success"`
+	ShortResponse  string `json:"short_response"`
+	StaticResponse bool   `json:"static_response"`
+	APIError       bool   `json:"api_error"`
+	UnknownError   bool   `json:"unknown_error"`
+	NoCoords       bool   `json:"no_coords"`
+	CoordsLogged   bool   `json:"coords_logged"`
+	OutlierFix     string `json:"outlier_fix"` // why the fix was dropped as not the train's
+	BecameArrived  bool   `json:"became_arrived"`
+	AtOrigin       bool   `json:"at_origin"`    // upstream has it at its origin, not departed yet
+	CircuitOpen    bool   `json:"circuit_open"` // not sent, upstream is considered down
+	StationEvents  int    `json:"station_events"`
+}
+
+// storeOptions are the settings for storing what a poll brought back
+type storeOptions struct {
+	keepSchedule bool    // see recordDaySchedule
+	smoothing    float64 // weight of a new fix in the shown position, see smoothFix
+}
+
+func (cfg Config) storeOptions() storeOptions {
+	return storeOptions{keepSchedule: cfg.KeepSchedules, smoothing: cfg.PositionSmoothing}
 }
 
 // Start blocks until ctx is cancelled
@@ -56,21 +105,99 @@ func Start(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.
 	if cfg.Concurrency <= 0 {
 		cfg.Concurrency = 1
 	}
+	if cfg.PreDepartureWorkers <= 0 {
+		cfg.PreDepartureWorkers = 1
+	}
 	if cfg.Window <= 0 {
 		cfg.Window = 1 * time.Minute
 	}
 	if cfg.StaticErrorThreshold <= 0 {
 		cfg.StaticErrorThreshold = 10
 	}
-	if cfg.TotalErrorThreshold < 0 {
-		cfg.TotalErrorThreshold = 5
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = 2 * time.Minute
+	}
+	if cfg.BackoffMax <= 0 {
+		cfg.BackoffMax = time.Hour
+	}
+	if cfg.StallThreshold <= 0 {
+		cfg.StallThreshold = 20 * time.Minute
+	}
+	if cfg.OriginInterval <= 0 {
+		cfg.OriginInterval = 10 * time.Minute
+	}
+	if cfg.DormantInterval <= 0 {
+		cfg.DormantInterval = 20 * time.Minute
+	}
+	if cfg.DormantAfter <= 0 {
+		cfg.DormantAfter = 3 * time.Hour
+	}
+	if cfg.ArchiveRetention <= 0 {
+		cfg.ArchiveRetention = 7 * 24 * time.Hour
+	}
+	if cfg.ScheduleRetention <= 0 {
+		cfg.ScheduleRetention = 72 * time.Hour
+	}
+	if cfg.NoDataAfter <= 0 {
+		cfg.NoDataAfter = 6 * time.Hour
+	}
+	if cfg.OverdueAfter <= 0 {
+		cfg.OverdueAfter = 12 * time.Hour
+	}
+	if cfg.LocationBatchSize <= 0 {
+		cfg.LocationBatchSize = 200
+	}
+	if cfg.LocationFlush <= 0 {
+		cfg.LocationFlush = 5 * time.Second
+	}
+	if cfg.LeaseMaxRuns <= 0 {
+		cfg.LeaseMaxRuns = 1000
+	}
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = instanceID()
+	}
+	if cfg.LeaseTTL > 0 && cfg.LeaseTTL < 2*cfg.Window {
+		logger.Printf("warning: POLLER_LEASE_TTL %v is under two windows, leases may lapse between cycles", cfg.LeaseTTL)
+	}
+	if cfg.ExtrapolateAfter <= 0 {
+		cfg.ExtrapolateAfter = 2 * time.Minute
 	}
 
-	api := wimt.NewAPIClient(cfg.ProxyURL)
-	logger.Printf("poller started | workers: %d | window: %v | static_error_thres: %d | totol_error_thres: %d",
-		cfg.Concurrency, cfg.Window, cfg.StaticErrorThreshold, cfg.TotalErrorThreshold)
+	api := newFetcher(cfg, logger)
+	logger.Printf("poller started | %s", cfg.tuning())
+	if cfg.Fallback != nil {
+		logger.Printf("poller falling back to %s while wimt is degraded", cfg.Fallback.Name())
+	}
+	cfg.Control.start(cfg)
+	defer releaseLeases(queries, logger, cfg)
+	if cfg.Sweeps {
+		cfg.catchUpBefore = catchUp(ctx, queries, logger, cfg, loc)
+	} else {
+		logger.Println("poller sweeps off, another instance runs them")
+	}
+	lastPrune := time.Time{}
 
 	for {
+		var paused bool
+		var changed <-chan struct{}
+		proxyURL := cfg.ProxyURL
+		cfg, paused, changed = cfg.Control.apply(cfg)
+		if cfg.ProxyURL != proxyURL {
+			// reloadConfig moves the request budget over to the new proxy's name
+			api = newFetcher(cfg, logger)
+			logger.Println("poller switched proxy")
+		}
+		if paused {
+			logger.Println("poller paused")
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				logger.Println("poller shutting down")
+				return
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			logger.Println("poller shutting down")
@@ -78,7 +205,13 @@ func Start(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.
 		default:
 			start := time.Now()
 			count := executeCycle(ctx, queries, sqlDB, api, logger, cfg, loc)
+			cfg.catchUpBefore = ""
+			if cfg.Sweeps {
+				lastPrune = sweep(ctx, queries, sqlDB, logger, cfg, loc, lastPrune)
+			}
+			cfg.Cycles.finish()
 			elapsed := time.Since(start)
+			cycleDuration.With().Observe(elapsed.Seconds())
 
 			// ensure each cycle is at least cfg.Window
 			if elapsed < cfg.Window {
@@ -86,6 +219,9 @@ func Start(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.
 				select {
 				case <-time.After(sleep):
 					logger.Printf("cycle completed | processed: %d | elapsed: %v | sleeping: %v", count, elapsed, sleep)
+				case <-changed:
+					// a pause takes effect now, new settings with the next cycle which starts straight away
+					logger.Printf("cycle completed | processed: %d | elapsed: %v | poller settings changed", count, elapsed)
 				case <-ctx.Done():
 					logger.Println("poller shutting down")
 					return
@@ -97,53 +233,145 @@ func Start(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.
 	}
 }
 
-func executeCycle(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, api *wimt.APIClient, logger *log.Logger, cfg Config, loc *time.Location) int {
+// sweep is the upkeep after a cycle. It works on every run, not only the ones this
+// instance leases, so instances sharing a database leave it to one of them through
+// cfg.Sweeps. Returns when the archive was last pruned.
+func sweep(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.Logger, cfg Config, loc *time.Location, lastPrune time.Time) time.Time {
+	mergeAliasRuns(ctx, queries, sqlDB, logger)
+	detectStalledRuns(ctx, queries, logger, cfg)
+	closeStaleRuns(ctx, queries, logger, cfg, loc)
+	extrapolatePositions(ctx, queries, logger, cfg)
+	if time.Since(lastPrune) >= time.Hour {
+		pruneArchive(ctx, queries, logger, cfg.ArchiveRetention)
+		pruneDaySchedules(ctx, queries, logger, cfg.ScheduleRetention)
+		lastPrune = time.Now()
+	}
+	return lastPrune
+}
+
+func newFetcher(cfg Config, logger *log.Logger) wimt.Fetcher {
+	api := cfg.Fetcher
+	if api == nil {
+		api = wimt.NewAPIClient(cfg.ProxyURL, cfg.Budget)
+	}
+	// inside the recorder and breaker, both see one outcome per poll
+	api = wimt.Retry(api, cfg.TransientRetries, cfg.TransientRetryDelay)
+	if cfg.RecordDir != "" {
+		api = wimt.NewRecorder(api, cfg.RecordDir, logger)
+		logger.Printf("poller recording live status to %s", cfg.RecordDir)
+	}
+	// outermost, requests held back by an open circuit are not recorded
+	api = cfg.Breaker.Wrap(api)
+	// around the breaker, which then only ever counts whereismytrain's answers
+	return wimt.Fallback(api, cfg.Fallback)
+}
+
+func executeCycle(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, api wimt.Fetcher, logger *log.Logger, cfg Config, loc *time.Location) int {
+	// sit out the cooldown rather than fail every due run against a dead upstream, unless
+	// the fallback can answer for it
+	if until := cfg.Breaker.OpenUntil(); !until.IsZero() {
+		if cfg.Fallback == nil {
+			logger.Printf("cycle paused | wimt circuit open until %s", until.Format(time.RFC3339))
+			cycleHealth.Success("paused, wimt circuit open")
+			return 0
+		}
+		logger.Printf("wimt circuit open until %s | polling through %s", until.Format(time.RFC3339), cfg.Fallback.Name())
+	}
+
+	owner := leaseRuns(ctx, queries, logger, cfg, loc)
 	runs, err := queries.ListRunsToPoll(ctx, db.ListRunsToPollParams{
 		NowTs:                   time.Now().In(loc).Format(time.DateTime),
+		NowUtc:                  time.Now().UTC().Format(time.DateTime),
 		StaticResponseThreshold: int64(cfg.StaticErrorThreshold),
-		TotalErrorThreshold:     int64(cfg.TotalErrorThreshold),
+		LeaseOwner:              owner,
+		CatchUpBefore:           cfg.catchUpBefore,
 	})
 	if err != nil {
 		logger.Printf("failed to list runs to poll: %v", err)
+		cycleHealth.Failure(err)
 		return 0
 	}
+	cycleTargets.With().Set(float64(len(runs)))
+	deferred := 0
+	if cfg.MaxRunsPerCycle > 0 && len(runs) > cfg.MaxRunsPerCycle {
+		// runs come by priority, the cut leaves the lowest tiers waiting
+		deferred = len(runs) - cfg.MaxRunsPerCycle
+		runs = runs[:cfg.MaxRunsPerCycle]
+		logger.Printf("cycle over capacity | deferred: %d | lowest priority polled: %d", deferred, runs[len(runs)-1].Priority)
+	}
+	cycleDeferred.With().Set(float64(deferred))
 	if len(runs) == 0 {
+		cycleHealth.Success("no runs due")
 		return 0
 	}
 
 	// rate limit: spread work across the window with minimum inter-request delay
 	delay := max(cfg.Window/time.Duration(len(runs)), 20*time.Millisecond)
 	delay = delay.Round(time.Millisecond)
-	logger.Printf("cycle start | targets: %d | rate_delay: %v", len(runs), delay)
+	// started runs come first, everything after the first one yet to start is pre-departure
+	active := len(runs)
+	if i := slices.IndexFunc(runs, func(r db.ListRunsToPollRow) bool { return r.HasStarted == 0 }); i >= 0 {
+		active = i
+	}
+	logger.Printf("cycle start | targets: %d | active: %d | pre_departure: %d | rate_delay: %v", len(runs), active, len(runs)-active, delay)
 
 	resultsCh := make(chan CycleResult, len(runs))
 
+	locs := newLocationBatch(sqlDB, queries, logger, cfg.LocationBatchSize, cfg.LocationFlush)
+
+	// the pools are separate, pre-departure checks waiting on their workers never
+	// take one from a moving train
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, cfg.Concurrency)
+	activeSem := make(chan struct{}, cfg.Concurrency)
+	preDepartureSem := make(chan struct{}, cfg.PreDepartureWorkers)
 	ticker := time.NewTicker(delay)
 	defer ticker.Stop()
 
 loop:
-	for _, run := range runs {
+	for i, run := range runs {
 		select {
 		case <-ctx.Done():
 			break loop
 		case <-ticker.C:
+			if cfg.Fallback == nil && !cfg.Breaker.OpenUntil().IsZero() {
+				logger.Printf("cycle paused | wimt circuit opened | left for later: %d", len(runs)-i)
+				break loop
+			}
+			sem := activeSem
+			if run.HasStarted == 0 {
+				sem = preDepartureSem
+			}
 			sem <- struct{}{}
 			wg.Add(1)
 
 			go func(r db.ListRunsToPollRow) {
 				defer wg.Done()
 				defer func() { <-sem }()
-				result := processRun(ctx, r, queries, sqlDB, api, logger, loc)
+				result := processRun(ctx, r, queries, sqlDB, api, locs, cfg.storeOptions(), logger, loc)
+				if !result.CircuitOpen {
+					recordPoll(ctx, queries, logger, result, cfg.Window)
+					scheduleNextPoll(ctx, queries, logger, r, result, cfg, loc)
+				}
+				observeResult(result)
 				resultsCh <- result
 			}(run)
 		}
 	}
 
 	wg.Wait()
+	locs.flush(ctx)
 	close(resultsCh)
 
+	results := make([]CycleResult, 0, len(runs))
+	for result := range resultsCh {
+		results = append(results, result)
+	}
+	cycleHealth.Success(fmt.Sprintf("%d runs polled", len(results)))
+	return logResults(logger, "cycle results", results)
+}
+
+// logResults logs one aggregate line for a batch of results and returns how many there were
+func logResults(logger *log.Logger, label string, results []CycleResult) int {
 	agg := struct {
 		Processed       int
 		Success         int
@@ -155,22 +383,28 @@ loop:
 		UnknownError    int
 		NoCoords        int
 		CoordsLogged    int
+		OutlierFixes    int
 		BecameArrived   int
 		HasStarted      int
+		StationEvents   int
 	}{}
 
-	for result := range resultsCh {
+	for _, result := range results {
 		agg.Processed++
 		if result.Success {
 			agg.Success++
-			if result.CoordsLogged {
+			switch {
+			case result.CoordsLogged:
 				agg.CoordsLogged++
-			} else {
+			case result.OutlierFix != "":
+				agg.OutlierFixes++
+			default:
 				agg.NoCoords++
 			}
 			if result.BecameArrived {
 				agg.BecameArrived++
 			}
+			agg.StationEvents += result.StationEvents
 		}
 		switch result.ShortResponse {
 		case "not_running_today":
@@ -191,11 +425,14 @@ loop:
 		}
 	}
 
-	logger.Printf("cycle results | processed: %d | success: %d | short_resp: %d/%d/%d (not_run/timetable/unknown) | static_resp: %d | api_err: %d | unknown_err: %d | no_coords: %d | coords_logged: %d | became_arrived: %d | has_started: %d", agg.Processed, agg.Success, agg.ShortNotRunning, agg.ShortTimetable, agg.ShortUnknown, agg.StaticResponse, agg.APIError, agg.UnknownError, agg.NoCoords, agg.CoordsLogged, agg.BecameArrived, agg.HasStarted)
+	logger.Printf("%s | processed: %d | success: %d | short_resp: %d/%d/%d (not_run/timetable/unknown) | static_resp: %d | api_err: %d | unknown_err: %d | no_coords: %d | coords_logged: %d | outlier_fixes: %d | became_arrived: %d | has_started: %d | station_events: %d", label, agg.Processed, agg.Success, agg.ShortNotRunning, agg.ShortTimetable, agg.ShortUnknown, agg.StaticResponse, agg.APIError, agg.UnknownError, agg.NoCoords, agg.CoordsLogged, agg.OutlierFixes, agg.BecameArrived, agg.HasStarted, agg.StationEvents)
 	return agg.Processed
 }
 
-func processRun(ctx context.Context, run db.ListRunsToPollRow, queries *db.Queries, sqlDB *sql.DB, api *wimt.APIClient, logger *log.Logger, loc *time.Location) CycleResult {
+// processRun polls one run and stores what came back. Its position fix goes to locs
+// when given, written with other runs' later, and straight away otherwise. With
+// opts.keepSchedule the full days_schedule of a live answer is kept as well.
+func processRun(ctx context.Context, run db.ListRunsToPollRow, queries *db.Queries, sqlDB *sql.DB, api wimt.Fetcher, locs *locationBatch, opts storeOptions, logger *log.Logger, loc *time.Location) CycleResult {
 	var result CycleResult
 	result.RunID = run.RunID
 
@@ -209,32 +446,60 @@ func processRun(ctx context.Context, run db.ListRunsToPollRow, queries *db.Queri
 	trainNoStr := fmt.Sprintf("%05d", run.TrainNo)
 
 	body, err := api.FetchTrainStatus(ctx, trainNoStr, run.SourceStation, run.DestinationStation, runDate)
+	if errors.Is(err, wimt.ErrCircuitOpen) {
+		// nothing was asked, the run's error counters and backoff stay as they are
+		result.CircuitOpen = true
+		return result
+	}
 	if err != nil {
 		result = handleAPIError(ctx, queries, run, err, loc)
 		return result
 	}
 
 	bodyStr := string(body)
-	if len(body) < 150 {
+	if wimt.IsShort(body) {
 		result = handleShortResponse(ctx, queries, sqlDB, run, bodyStr, logger)
 		return result
 	}
 
-	if !strings.Contains(bodyStr, "running_status") && !strings.Contains(bodyStr, "running status") {
+	if wimt.IsStatic(body) {
 		result = handleStaticResponse(ctx, queries, run, logger, loc)
 		return result
 	}
 
 	var data wimt.APIResponse
 	if err := json.Unmarshal(body, &data); err != nil {
+		archiveResponse(ctx, queries, logger, run.RunID, archiveUnparseable, body, err)
 		result = handleUnknownError(ctx, queries, run, err, loc)
 		return result
 	}
 
-	result = processValidResponse(ctx, queries, sqlDB, run, &data, logger, loc)
+	result = processValidResponse(ctx, queries, sqlDB, run, &data, locs, opts.smoothing, logger, loc)
+	if opts.keepSchedule {
+		recordDaySchedule(ctx, queries, logger, run.RunID, data.DaysSchedule)
+	}
 	return result
 }
 
+// recordPoll counts the attempt towards the run's coverage, attempts cut short by
+// shutdown never reached upstream and are not counted
+func recordPoll(ctx context.Context, queries *db.Queries, logger *log.Logger, result CycleResult, window time.Duration) {
+	if ctx.Err() != nil {
+		return
+	}
+	successful := int64(0)
+	if result.Success {
+		successful = 1
+	}
+	if err := queries.RecordRunPoll(ctx, db.RecordRunPollParams{
+		RunID:      result.RunID,
+		Successful: successful,
+		WindowSec:  int64(window.Seconds()),
+	}); err != nil {
+		logger.Printf("failed to record poll for %s: %v", result.RunID, err)
+	}
+}
+
 const (
 	statusNotRunning = "not_running_today"
 	statusTimetable  = "timetable_update"
@@ -260,6 +525,7 @@ func handleShortResponse(
 	default:
 		result.ShortResponse = statusUnknown
 		logger.Printf("unexpected short response for %s: %s", run.RunID, bodyStr)
+		archiveResponse(ctx, queries, logger, run.RunID, statusUnknown, []byte(bodyStr), nil)
 	}
 
 	tx, err := sqlDB.BeginTx(ctx, nil)
@@ -273,11 +539,12 @@ func handleShortResponse(
 
 	if err := txQueries.UpdateRunStatus(ctx, db.UpdateRunStatusParams{
 		RunID:         run.RunID,
-		HasArrived:    1,
+		HasArrived:    sql.NullInt64{Int64: 1, Valid: true},
 		CurrentStatus: sql.NullString{String: result.ShortResponse, Valid: true},
 	}); err != nil {
 		return result
 	}
+	queuePush(ctx, txQueries, run, result.ShortResponse, sql.NullInt64{}, logger)
 
 	// update bitmap
 	if result.ShortResponse == statusNotRunning {
@@ -335,7 +602,7 @@ func handleAPIError(
 		run.Errors.APIError = &dbtypes.ErrorCounter{}
 	}
 	run.Errors.APIError.Count++
-	run.Errors.APIError.Reason = run.Errors.APIError.Reason + "; " + err.Error()
+	run.Errors.APIError.Reason = appendReason(run.Errors.APIError.Reason, err.Error())
 	run.Errors.APIError.LastSeen = time.Now().In(loc).Format(time.RFC3339)
 
 	if err := queries.UpdateRunStatus(ctx, db.UpdateRunStatusParams{
@@ -347,6 +614,18 @@ func handleAPIError(
 	return result
 }
 
+// failing runs are retried with backoff for as long as they stay active, only the
+// latest reasons are kept
+const maxReasonLen = 1024
+
+func appendReason(reasons, reason string) string {
+	reasons += "; " + reason
+	if len(reasons) > maxReasonLen {
+		reasons = reasons[len(reasons)-maxReasonLen:]
+	}
+	return reasons
+}
+
 func handleUnknownError(
 	ctx context.Context,
 	queries *db.Queries,
@@ -362,7 +641,7 @@ func handleUnknownError(
 		run.Errors.UnknownError = &dbtypes.ErrorCounter{}
 	}
 	run.Errors.UnknownError.Count++
-	run.Errors.UnknownError.Reason = run.Errors.UnknownError.Reason + "; " + reason.Error()
+	run.Errors.UnknownError.Reason = appendReason(run.Errors.UnknownError.Reason, reason.Error())
 	run.Errors.UnknownError.LastSeen = time.Now().In(loc).Format(time.RFC3339)
 
 	if err := queries.UpdateRunStatus(ctx, db.UpdateRunStatusParams{
@@ -380,6 +659,8 @@ func processValidResponse(
 	sqlDB *sql.DB,
 	run db.ListRunsToPollRow,
 	data *wimt.APIResponse,
+	locs *locationBatch,
+	smoothing float64,
 	logger *log.Logger,
 	loc *time.Location,
 ) CycleResult {
@@ -460,26 +741,44 @@ func processValidResponse(
 		}
 	}
 
+	result.AtOrigin = !status.IsTerminal && currStn != nil && currStn.StationCode == run.SourceStation && !data.DepartedCurStn
+
+	// a live answer ends any backoff
 	run.Errors.StaticResponse.Count = 0
+	run.Errors.APIError = nil
+	run.Errors.UnknownError = nil
 
 	hasArrived := int64(0)
 	if status.IsTerminal {
 		hasArrived = 1
 	}
 
-	// status-only update
+	// status-only update, a diverted run stays so until a fix puts it back on its route
+	delayMin := currentDelayMin(currStn, data.DepartedCurStn)
+	currentStatus := status.Canonical
+	if run.CurrentStatus == statusDiverted && !status.IsTerminal {
+		currentStatus = statusDiverted
+	}
 	if err := queries.UpdateRunStatus(ctx, db.UpdateRunStatusParams{
-		RunID:          run.RunID,
-		HasStarted:     1,
-		HasArrived:     hasArrived,
-		CurrentStatus:  status.Canonical,
-		LastUpdatedSno: finalSNO,
-		LastUpdateIso:  lastUpdateIso,
-		Errors:         run.Errors,
+		RunID:           run.RunID,
+		HasStarted:      sql.NullInt64{Int64: 1, Valid: true},
+		HasArrived:      sql.NullInt64{Int64: hasArrived, Valid: true},
+		CurrentStatus:   currentStatus,
+		LastUpdatedSno:  finalSNO,
+		LastUpdateIso:   lastUpdateIso,
+		CurrentDelayMin: delayMin,
+		Errors:          run.Errors,
 	}); err != nil {
 		logger.Printf("status update (tx1) failed for %s: %v", run.RunID, err)
 		return result
 	}
+	queuePush(ctx, queries, run, status.Canonical, delayMin, logger)
+	if status.Canonical == "rescheduled" {
+		recordRevisedDeparture(ctx, queries, logger, run, data, loc)
+	}
+
+	result.StationEvents = recordStationEvents(ctx, queries, sqlDB, run, data, currStn, logger)
+	recordPlatforms(ctx, queries, run, data, logger)
 
 	// Determine if the incoming API time is newer than the DB's last update timestamp
 	locationAllowed := false
@@ -532,12 +831,8 @@ func processValidResponse(
 	// Attempt snapping
 	var snappedLat sql.NullInt64
 	var snappedLng sql.NullInt64
-	var routeFrac sql.NullInt64
-	var bearing_deg sql.NullInt64
 	snappedLat.Valid = false
 	snappedLng.Valid = false
-	routeFrac.Valid = false
-	bearing_deg.Valid = false
 
 	snap, err := queries.GetRunSnap(ctx, db.GetRunSnapParams{
 		RunID: run.RunID,
@@ -549,8 +844,6 @@ func processValidResponse(
 		// returns integers already, wrap into sql.NullInt64
 		snappedLat = sql.NullInt64{Int64: snap.SnappedLatU6, Valid: true}
 		snappedLng = sql.NullInt64{Int64: snap.SnappedLngU6, Valid: true}
-		routeFrac = sql.NullInt64{Int64: snap.RouteFracU4, Valid: true}
-		bearing_deg = sql.NullInt64{Int64: snap.BearingDeg, Valid: true}
 	case sql.ErrNoRows:
 		// snapping not available for this run, no geometry or whatever
 		// logger.Printf("no snapping geometry for %s", run.RunID) // optional
@@ -559,14 +852,51 @@ func processValidResponse(
 		logger.Printf("snapping error for %s: %v", run.RunID, err)
 	}
 
-	tx, err := sqlDB.BeginTx(ctx, nil)
-	if err != nil {
-		logger.Printf("begin tx2 failed for %s: %v", run.RunID, err)
+	var offsetM sql.NullInt64
+	if snappedLat.Valid {
+		offsetM = sql.NullInt64{Int64: snap.OffsetM, Valid: true}
+	}
+	var fixes []db.ListRecentRunFixesRow
+	var speed, avgSpeed sql.NullFloat64
+	if apiTime != nil {
+		fixes = recentFixes(ctx, queries, logger, run.RunID)
+		speed, avgSpeed = fixSpeeds(fixes, latVal, lngVal, *apiTime)
+	}
+	if reason := outlierFix(run, speed, offsetM); reason != "" {
+		logger.Printf("outlier fix dropped for %s | reason: %s | at: %.5f,%.5f | speed: %.0f km/h | offset: %dm",
+			run.RunID, reason, latVal, lngVal, speed.Float64, offsetM.Int64)
+		result.OutlierFix = reason
+		if hasArrived == 1 {
+			result.BecameArrived = true
+		}
 		return result
 	}
-	defer tx.Rollback()
 
-	txq := queries.WithTx(tx)
+	// off its route the snapped point is somewhere the train is not, a diverted run is
+	// shown where it reports itself
+	diverted := false
+	if snappedLat.Valid {
+		diverted = checkDiversion(ctx, queries, logger, run, snap.OffsetM, segStn, distU4, lastUpdateIso.String)
+	}
+
+	// the run is shown at the smoothed fix, snapped on its own, while the log keeps
+	// the raw one and its snap as well
+	var smoothedLat, smoothedLng sql.NullInt64
+	shownLat, shownLng := sql.NullInt64{Int64: latU6, Valid: true}, sql.NullInt64{Int64: lngU6, Valid: true}
+	if smoothing > 0 && apiTime != nil {
+		sLat, sLng := smoothFix(fixes, latVal, lngVal, *apiTime, smoothing)
+		smoothedLat = sql.NullInt64{Int64: int64(sLat * 1e6), Valid: true}
+		smoothedLng = sql.NullInt64{Int64: int64(sLng * 1e6), Valid: true}
+		shownLat, shownLng = smoothedLat, smoothedLng
+		if snappedLat.Valid && (sLat != latVal || sLng != lngVal) {
+			s, err := queries.GetRunSnap(ctx, db.GetRunSnapParams{RunID: run.RunID, Lat: sLat, Lng: sLng})
+			if err != nil {
+				logger.Printf("snapping smoothed fix failed for %s: %v", run.RunID, err)
+			} else {
+				snap = s
+			}
+		}
+	}
 
 	var atStationInt int64
 	if !data.DepartedCurStn {
@@ -575,8 +905,8 @@ func processValidResponse(
 		atStationInt = 0
 	}
 
-	// Insert into time-series table (snapped fields may be null)
-	if err := txq.LogRunLocation(ctx, db.LogRunLocationParams{
+	// snapped fields may be null, the run only moves when the fix snapped
+	write := locationWrite{log: db.LogRunLocationParams{
 		RunID:              run.RunID,
 		LatU6:              latU6,
 		LngU6:              lngU6,
@@ -585,38 +915,43 @@ func processValidResponse(
 		DistanceKmU4:       distU4,
 		SegmentStationCode: segStn,
 		AtStation:          atStationInt,
+		OffsetM:            offsetM,
+		SpeedKmh:           speed,
+		AvgSpeedKmh:        avgSpeed,
+		SmoothedLatU6:      smoothedLat,
+		SmoothedLngU6:      smoothedLng,
 		TimestampIso:       lastUpdateIso.String,
-	}); err != nil {
-		logger.Printf("failed to log location for %s: %v", run.RunID, err)
-		return result
-	}
-	result.CoordsLogged = true
-
-	shouldUpdateRunLocation := snappedLat.Valid && snappedLng.Valid
-
-	if shouldUpdateRunLocation {
-		latNull := sql.NullInt64{Int64: latU6, Valid: true}
-		lngNull := sql.NullInt64{Int64: lngU6, Valid: true}
-
-		if err := txq.UpdateRunStatus(ctx, db.UpdateRunStatusParams{
+	}}
+	if snappedLat.Valid && snappedLng.Valid {
+		write.update = &db.UpdateRunStatusParams{
 			RunID:         run.RunID,
-			LatU6:         latNull,
-			LngU6:         lngNull,
-			SnappedLatU6:  snappedLat,
-			SnappedLngU6:  snappedLng,
-			RouteFracU4:   routeFrac,
-			BearingDeg:    bearing_deg,
+			LatU6:         sql.NullInt64{Int64: latU6, Valid: true},
+			LngU6:         sql.NullInt64{Int64: lngU6, Valid: true},
+			SnappedLatU6:  sql.NullInt64{Int64: snap.SnappedLatU6, Valid: true},
+			SnappedLngU6:  sql.NullInt64{Int64: snap.SnappedLngU6, Valid: true},
+			RouteFracU4:   sql.NullInt64{Int64: snap.RouteFracU4, Valid: true},
+			BearingDeg:    sql.NullInt64{Int64: snap.BearingDeg, Valid: true},
 			DistanceKmU4:  sql.NullInt64{Int64: distU4, Valid: true},
+			SpeedKmh:      speed,
+			AvgSpeedKmh:   avgSpeed,
 			LastUpdateIso: lastUpdateIso,
-		}); err != nil {
-			logger.Printf("failed to update run location for %s: %v", run.RunID, err)
-			return result
+		}
+		if diverted {
+			write.update.CurrentStatus = statusDiverted
+			write.update.SnappedLatU6 = shownLat
+			write.update.SnappedLngU6 = shownLng
+			write.update.RouteFracU4 = sql.NullInt64{}
+			write.update.BearingDeg = sql.NullInt64{}
+		} else if currentStatus == statusDiverted {
+			write.update.CurrentStatus = status.Canonical
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		logger.Printf("commit tx2 failed for %s: %v", run.RunID, err)
-		return result
+	if locs != nil {
+		locs.add(ctx, write)
+		result.CoordsLogged = true
+	} else {
+		result.CoordsLogged = writeLocations(ctx, sqlDB, queries, logger, []locationWrite{write}) == 1
 	}
 
 	if hasArrived == 1 {
@@ -0,0 +1,24 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	db "trano/internal/db/sqlc"
+)
+
+// queuePush hands the run to the push worker when this poll moved its status or delay.
+// Whether the move is large enough to notify about is decided there against what each
+// device was last sent, here only the cheap comparison with the previous poll is made.
+func queuePush(ctx context.Context, queries *db.Queries, run db.ListRunsToPollRow, status string, delayMin sql.NullInt64, logger *log.Logger) {
+	statusChanged := status != "" && status != run.CurrentStatus
+	// an unknown delay leaves the stored one in place, see UpdateRunStatus
+	delayChanged := delayMin.Valid && delayMin != run.CurrentDelayMin
+	if !statusChanged && !delayChanged {
+		return
+	}
+	if err := queries.QueuePushChange(ctx, run.RunID); err != nil {
+		logger.Printf("failed to queue push for %s: %v", run.RunID, err)
+	}
+}
@@ -0,0 +1,52 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+// Replay feeds recorded responses through processRun one at a time, oldest first, so
+// the same recordings against the same starting database always end in the same
+// state, apart from when error counters were last seen. Recordings of runs missing
+// from the database are skipped. Poll counters are left alone, they track the live
+// poller and not the data.
+func Replay(ctx context.Context, queries *db.Queries, sqlDB *sql.DB, logger *log.Logger, loc *time.Location, recs []wimt.Recording) ([]CycleResult, error) {
+	results := make([]CycleResult, 0, len(recs))
+	skipped := 0
+
+	for _, rec := range recs {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		runID, err := rec.RunID()
+		if err != nil {
+			return results, err
+		}
+
+		// re-read per recording so each poll sees what the previous one wrote
+		row, err := queries.GetRunToPoll(ctx, runID)
+		if errors.Is(err, sql.ErrNoRows) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return results, fmt.Errorf("load run %s: %w", runID, err)
+		}
+
+		results = append(results, processRun(ctx, db.ListRunsToPollRow(row), queries, sqlDB, wimt.NewReplay(rec), nil, storeOptions{}, logger, loc))
+	}
+
+	if skipped > 0 {
+		logger.Printf("replay: skipped %d recordings of unknown runs", skipped)
+	}
+	logResults(logger, "replay results", results)
+	return results, nil
+}
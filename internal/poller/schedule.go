@@ -0,0 +1,162 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	dbtypes "trano/internal/db"
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+// nextPoll is how long until a run is worth polling again. Moving runs are polled
+// every cycle, or at the interval cfg.TypeIntervals gives their train type. A run
+// upstream still has at its origin after its scheduled, or rescheduled, departure, or
+// that only gets timetable responses, is looked at every cfg.OriginInterval, and
+// every cfg.DormantInterval once it is cfg.DormantAfter late without leaving. Failed
+// polls back off instead.
+func nextPoll(run db.ListRunsToPollRow, result CycleResult, cfg Config, now time.Time, loc *time.Location) time.Duration {
+	if result.APIError || result.UnknownError {
+		// run still holds the counts from before this failure
+		return backoff(failures(run.Errors)+1, cfg)
+	}
+	if !result.AtOrigin && !result.StaticResponse {
+		return typeInterval(run.TrainType, cfg.TypeIntervals)
+	}
+	runDate, err := time.ParseInLocation(time.DateOnly, run.RunDate, loc)
+	if err != nil {
+		return 0
+	}
+	departure := runDate.Add(time.Duration(run.OriginSchDepartureMin) * time.Minute)
+	if now.Sub(departure) >= cfg.DormantAfter {
+		return cfg.DormantInterval
+	}
+	return cfg.OriginInterval
+}
+
+// TypeInterval is how often moving trains of a type are polled. Type matches any
+// train_type containing it, ignoring case.
+type TypeInterval struct {
+	Type     string
+	Interval time.Duration
+}
+
+// ParseTypeIntervals reads "emu=30s,express=1m,passenger=3m", earlier entries win
+// where several match a train type
+func ParseTypeIntervals(s string) ([]TypeInterval, error) {
+	var intervals []TypeInterval
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		typ, dur, ok := strings.Cut(entry, "=")
+		typ = strings.TrimSpace(typ)
+		if !ok || typ == "" {
+			return nil, fmt.Errorf("invalid type interval %q, want type=duration", entry)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(dur))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval for %s: %q", typ, dur)
+		}
+		intervals = append(intervals, TypeInterval{Type: strings.ToLower(typ), Interval: interval})
+	}
+	return intervals, nil
+}
+
+// typeInterval is the interval of the first entry matching trainType, 0 for none.
+// Intervals below the window still poll once a cycle, the window is the floor.
+func typeInterval(trainType string, intervals []TypeInterval) time.Duration {
+	trainType = strings.ToLower(trainType)
+	for _, ti := range intervals {
+		if strings.Contains(trainType, ti.Type) {
+			return ti.Interval
+		}
+	}
+	return 0
+}
+
+// scheduleNextPoll stores when the run is next due. Cycles start a window apart and
+// poll their runs spread across it, so a run is due a window early to be picked up by
+// the cycle closest to its interval rather than the one after.
+func scheduleNextPoll(ctx context.Context, queries *db.Queries, logger *log.Logger, run db.ListRunsToPollRow, result CycleResult, cfg Config, loc *time.Location) {
+	if ctx.Err() != nil || result.BecameArrived || result.ShortResponse != "" {
+		return
+	}
+	now := time.Now()
+	var next sql.NullString
+	if wait := nextPoll(run, result, cfg, now, loc) - cfg.Window; wait > 0 {
+		next = sql.NullString{String: now.Add(wait).UTC().Format(time.DateTime), Valid: true}
+	}
+	if err := queries.ScheduleRunPoll(ctx, db.ScheduleRunPollParams{
+		NextPollAt: next,
+		RunID:      run.RunID,
+	}); err != nil {
+		logger.Printf("failed to schedule next poll for %s: %v", run.RunID, err)
+	}
+}
+
+// failures is the run's streak of failed polls, the counters are cleared by the
+// first live answer
+func failures(errs dbtypes.RunErrors) int {
+	n := 0
+	if errs.APIError != nil {
+		n += errs.APIError.Count
+	}
+	if errs.UnknownError != nil {
+		n += errs.UnknownError.Count
+	}
+	return n
+}
+
+// backoff doubles cfg.BackoffBase per failure after the first up to cfg.BackoffMax,
+// then picks a point in its upper half so runs failing together do not retry together
+func backoff(failures int, cfg Config) time.Duration {
+	wait := cfg.BackoffBase
+	for i := 1; i < failures && wait < cfg.BackoffMax; i++ {
+		wait *= 2
+	}
+	wait = min(wait, cfg.BackoffMax)
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// recordRevisedDeparture stores the origin departure upstream moved a rescheduled run
+// to, read from start_date and start_time. Polling and closing the run then go by it
+// rather than by the timetable, which would have the run late from the start.
+func recordRevisedDeparture(ctx context.Context, queries *db.Queries, logger *log.Logger, run db.ListRunsToPollRow, data *wimt.APIResponse, loc *time.Location) {
+	startDate := strings.TrimSpace(data.StartDate)
+	if startDate == "" {
+		startDate = run.RunDate
+	}
+	runDate, err := time.ParseInLocation(time.DateOnly, run.RunDate, loc)
+	if err != nil {
+		return
+	}
+	var start time.Time
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if start, err = time.ParseInLocation(layout, startDate+" "+strings.TrimSpace(data.StartTime), loc); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		logger.Printf("rescheduled run %s without a usable start time: %q %q", run.RunID, data.StartDate, data.StartTime)
+		return
+	}
+
+	revised := int64(start.Sub(runDate) / time.Minute)
+	if revised == run.OriginSchDepartureMin {
+		return
+	}
+	if err := queries.SetRunRevisedDeparture(ctx, db.SetRunRevisedDepartureParams{
+		RevisedDepartureMin: revised,
+		RunID:               run.RunID,
+	}); err != nil {
+		logger.Printf("failed to record revised departure for %s: %v", run.RunID, err)
+		return
+	}
+	logger.Printf("run %s rescheduled to depart %s", run.RunID, start.Format(time.DateTime))
+}
@@ -0,0 +1,35 @@
+package poller
+
+import (
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// smoothFix damps the jitter of crowd-sourced GPS so markers don't wobble back and
+// forth along the route. The last two smoothed fixes give where the train should be
+// at `at`, and the new fix pulls that estimate towards itself by alpha, Holt's linear
+// smoothing with the trend taken from the smoothed positions. A moving train is
+// followed without lag that way, a stopped one settles. Without a recent fix, or with
+// alpha outside (0, 1), the fix is returned as it is.
+func smoothFix(fixes []db.ListRecentRunFixesRow, lat, lng float64, at time.Time, alpha float64) (float64, float64) {
+	if alpha <= 0 || alpha >= 1 || len(fixes) == 0 {
+		return lat, lng
+	}
+	t1, err := time.Parse(time.RFC3339, fixes[0].TimestampIso)
+	if err != nil || !t1.Before(at) || at.Sub(t1) > speedMaxGap {
+		return lat, lng
+	}
+	predLat, predLng := float64(fixes[0].SmoothedLatU6)/1e6, float64(fixes[0].SmoothedLngU6)/1e6
+
+	if len(fixes) > 1 {
+		t2, err := time.Parse(time.RFC3339, fixes[1].TimestampIso)
+		if err == nil && t2.Before(t1) && t1.Sub(t2) <= speedMaxGap {
+			// carried on at the pace between the two, for at most a few of those intervals
+			k := min(at.Sub(t1).Seconds()/t1.Sub(t2).Seconds(), 3)
+			predLat += (predLat - float64(fixes[1].SmoothedLatU6)/1e6) * k
+			predLng += (predLng - float64(fixes[1].SmoothedLngU6)/1e6) * k
+		}
+	}
+	return predLat + alpha*(lat-predLat), predLng + alpha*(lng-predLng)
+}
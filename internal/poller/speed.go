@@ -0,0 +1,70 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// fixes the rolling average spans, the new one included
+	speedWindow = 5
+	// fixes further apart than this say nothing about how fast the train is going
+	speedMaxGap = 30 * time.Minute
+
+	earthRadiusKm = 6371.0
+)
+
+// recentFixes are the run's fixes before a new one, newest first, as many as
+// speedWindow needs. Nil when they could not be read.
+func recentFixes(ctx context.Context, queries *db.Queries, logger *log.Logger, runID string) []db.ListRecentRunFixesRow {
+	fixes, err := queries.ListRecentRunFixes(ctx, db.ListRecentRunFixesParams{RunID: runID, Limit: speedWindow - 1})
+	if err != nil {
+		logger.Printf("failed to list recent fixes for %s: %v", runID, err)
+		return nil
+	}
+	return fixes
+}
+
+// fixSpeeds works out the speed of a run since its previous fix and the average over
+// its last speedWindow fixes, both great circle distance over elapsed time. The
+// average stops at the first gap longer than speedMaxGap; both are NULL without a fix
+// before at.
+func fixSpeeds(fixes []db.ListRecentRunFixesRow, lat, lng float64, at time.Time) (speed, avg sql.NullFloat64) {
+	km := 0.0
+	newer := at
+	var oldest time.Time
+	for _, f := range fixes {
+		t, err := time.Parse(time.RFC3339, f.TimestampIso)
+		if err != nil || !t.Before(newer) || newer.Sub(t) > speedMaxGap {
+			break
+		}
+		fLat, fLng := float64(f.LatU6)/1e6, float64(f.LngU6)/1e6
+		km += haversineKm(lat, lng, fLat, fLng)
+		if oldest.IsZero() {
+			speed = sql.NullFloat64{Float64: roundSpeed(km / at.Sub(t).Hours()), Valid: true}
+		}
+		lat, lng, newer, oldest = fLat, fLng, t, t
+	}
+	if !oldest.IsZero() {
+		avg = sql.NullFloat64{Float64: roundSpeed(km / at.Sub(oldest).Hours()), Valid: true}
+	}
+	return speed, avg
+}
+
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1, lat2 = lat1*math.Pi/180, lat2*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (lng2 - lng1) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// roundSpeed keeps a tenth of a km/h, GPS is not good for more
+func roundSpeed(kmh float64) float64 {
+	return math.Round(kmh*10) / 10
+}
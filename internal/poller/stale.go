@@ -0,0 +1,36 @@
+package poller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+// a run still reporting is never closed as overdue, however late
+const overdueQuiet = time.Hour
+
+// closeStaleRuns takes runs out of polling that will not produce anything anymore:
+// runs upstream never reported on, cfg.NoDataAfter past their scheduled arrival, and
+// running ones gone silent cfg.OverdueAfter past the arrival their last delay pointed
+// to. Left alone they stay due until they drop out of the five day window.
+func closeStaleRuns(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config, loc *time.Location) {
+	now := time.Now()
+
+	noData, err := queries.CloseNeverStartedRuns(ctx, now.In(loc).Add(-cfg.NoDataAfter).Format(time.DateTime))
+	if err != nil {
+		logger.Printf("failed to close never started runs: %v", err)
+	}
+	timedOut, err := queries.CloseOverdueRuns(ctx, db.CloseOverdueRunsParams{
+		QuietBefore:   now.UTC().Add(-overdueQuiet).Format(time.DateTime),
+		ArrivedBefore: now.In(loc).Add(-cfg.OverdueAfter).Format(time.DateTime),
+	})
+	if err != nil {
+		logger.Printf("failed to close overdue runs: %v", err)
+	}
+
+	if noData > 0 || timedOut > 0 {
+		logger.Printf("stale runs closed | no_data: %d | timed_out: %d", noData, timedOut)
+	}
+}
@@ -0,0 +1,141 @@
+package poller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+// recordStationEvents persists actual times and delays for every station of
+// days_schedule the run has reached, not only the ones since the last poll, so times
+// upstream corrects later replace the ones stored. Returns the number of stations
+// written or changed.
+func recordStationEvents(
+	ctx context.Context,
+	queries *db.Queries,
+	sqlDB *sql.DB,
+	run db.ListRunsToPollRow,
+	data *wimt.APIResponse,
+	currStn *wimt.DaySchedule,
+	logger *log.Logger,
+) int {
+	if currStn == nil || len(data.DaysSchedule) == 0 {
+		return 0
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Printf("begin station events tx failed for %s: %v", run.RunID, err)
+		return 0
+	}
+	defer tx.Rollback()
+
+	txq := queries.WithTx(tx)
+
+	written := 0
+	for i := range data.DaysSchedule {
+		stn := &data.DaysSchedule[i]
+		if stn.StationCode == "" || stn.Sno > currStn.Sno {
+			continue
+		}
+		if stn.ActualArrivalTm <= 0 && stn.ActualDepartureTm <= 0 {
+			continue
+		}
+
+		departed := int64(0)
+		if (stn.Departed != nil && *stn.Departed) || stn.Sno < currStn.Sno || (stn.Sno == currStn.Sno && data.DepartedCurStn) {
+			departed = 1
+		}
+
+		n, err := txq.UpsertRunStationEvent(ctx, db.UpsertRunStationEventParams{
+			RunID:             run.RunID,
+			Sno:               int64(stn.Sno),
+			StationCode:       stn.StationCode,
+			DistanceKmU4:      int64(stn.Distance * 1e4),
+			SchArrivalTm:      positiveTm(stn.SchArrivalTm),
+			ActArrivalTm:      positiveTm(stn.ActualArrivalTm),
+			SchDepartureTm:    positiveTm(stn.SchDepartureTm),
+			ActDepartureTm:    actualDepartureTm(stn, departed == 1),
+			DelayArrivalMin:   delayMin(stn.DelayInArrival, stn.ActualArrivalTm),
+			DelayDepartureMin: delayMin(stn.DelayInDeparture, actualDepartureTm(stn, departed == 1).Int64),
+			Departed:          departed,
+		})
+		if err != nil {
+			logger.Printf("failed to record station event %s@%s: %v", run.RunID, stn.StationCode, err)
+			return 0
+		}
+		if n == 0 {
+			continue
+		}
+		written++
+
+		if stn.Lat != 0 && stn.Lng != 0 {
+			if err := txq.SetStationCoordinates(ctx, db.SetStationCoordinatesParams{
+				Lat:         sql.NullFloat64{Float64: stn.Lat, Valid: true},
+				Lng:         sql.NullFloat64{Float64: stn.Lng, Valid: true},
+				StationCode: stn.StationCode,
+			}); err != nil {
+				logger.Printf("failed to set coordinates for station %s: %v", stn.StationCode, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Printf("commit station events failed for %s: %v", run.RunID, err)
+		return 0
+	}
+
+	return written
+}
+
+func positiveTm(tm int64) sql.NullInt64 {
+	if tm <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: tm, Valid: true}
+}
+
+// actual_departure_tm is only trusted once the station is departed,
+// before that it is an estimate
+func actualDepartureTm(stn *wimt.DaySchedule, departed bool) sql.NullInt64 {
+	if !departed {
+		return sql.NullInt64{}
+	}
+	return positiveTm(stn.ActualDepartureTm)
+}
+
+func delayMin(delay float64, actualTm int64) sql.NullInt64 {
+	if actualTm <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(math.Round(delay)), Valid: true}
+}
+
+// currentDelayMin is how late the run is at its current station, off the departure
+// once the train has left it and the arrival before that. Upstream's own delay wins
+// where it gives one, the schedule comparison covers stations it left it out for.
+func currentDelayMin(currStn *wimt.DaySchedule, departedCurStn bool) sql.NullInt64 {
+	if currStn == nil {
+		return sql.NullInt64{}
+	}
+	if departedCurStn && currStn.SchDepartureTm > 0 && currStn.ActualDepartureTm > 0 {
+		return reportedDelayMin(currStn.DelayInDeparture, currStn.SchDepartureTm, currStn.ActualDepartureTm)
+	}
+	if currStn.SchArrivalTm > 0 && currStn.ActualArrivalTm > 0 {
+		return reportedDelayMin(currStn.DelayInArrival, currStn.SchArrivalTm, currStn.ActualArrivalTm)
+	}
+	return sql.NullInt64{}
+}
+
+// reportedDelayMin takes upstream's delay like the station events do, absent and on
+// time look the same to the decoder so a zero falls back to the epoch times
+func reportedDelayMin(reported float64, schTm, actTm int64) sql.NullInt64 {
+	if reported != 0 {
+		return sql.NullInt64{Int64: int64(math.Round(reported)), Valid: true}
+	}
+	return sql.NullInt64{Int64: int64(math.Round(float64(actTm-schTm) / 60)), Valid: true}
+}
@@ -0,0 +1,319 @@
+package prediction
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// profiles with fewer samples are ignored, the all-days profile is tried next
+	minProfileSamples = 5
+
+	// the current delay dominates for nearby stations and fades towards the
+	// historical median over this many minutes of scheduled running
+	decayMin = 720.0
+
+	// without history the range widens by this fraction of the remaining running time
+	naiveSpreadPerMin = 0.05
+)
+
+const (
+	MethodHistory = "history"
+	MethodNaive   = "naive"
+)
+
+var (
+	ErrRunNotFound       = errors.New("run not found")
+	ErrStationNotOnRoute = errors.New("station is not on the route of the run")
+	ErrStationPassed     = errors.New("run has already reached the station")
+)
+
+// Profile is the historical delay distribution of a train at one station
+type Profile struct {
+	Samples int64
+	P10     float64
+	P50     float64
+	P90     float64
+}
+
+type StationETA struct {
+	StationCode       string    `json:"station_code"`
+	StationName       string    `json:"station_name"`
+	DistanceKm        float64   `json:"distance_km"`
+	Stops             bool      `json:"stops"`
+	ScheduledArrival  time.Time `json:"scheduled_arrival"`
+	PredictedArrival  time.Time `json:"predicted_arrival"`
+	EarliestArrival   time.Time `json:"earliest_arrival"`
+	LatestArrival     time.Time `json:"latest_arrival"`
+	PredictedDelayMin float64   `json:"predicted_delay_min"`
+	HistorySamples    int64     `json:"history_samples"`
+	Method            string    `json:"method"`
+}
+
+type RunPrediction struct {
+	RunID              string       `json:"run_id"`
+	TrainNo            int64        `json:"train_no"`
+	RunDate            string       `json:"run_date"`
+	CurrentStationCode string       `json:"current_station_code,omitempty"`
+	CurrentDelayMin    int64        `json:"current_delay_min"`
+	CurrentDistanceKm  *float64     `json:"current_distance_km"` // where the delay was measured
+	RouteFraction      *float64     `json:"route_fraction"`      // share of the route distance covered
+	Stations           []StationETA `json:"stations"`
+}
+
+// StationPrediction is the prediction of a run at a single station
+type StationPrediction struct {
+	RunID              string     `json:"run_id"`
+	TrainNo            int64      `json:"train_no"`
+	RunDate            string     `json:"run_date"`
+	CurrentStationCode string     `json:"current_station_code,omitempty"`
+	CurrentDelayMin    int64      `json:"current_delay_min"`
+	CurrentDistanceKm  *float64   `json:"current_distance_km"`
+	RouteFraction      *float64   `json:"route_fraction"`
+	Station            StationETA `json:"station"`
+}
+
+type Predictor struct {
+	queries *db.Queries
+	loc     *time.Location
+}
+
+func New(queries *db.Queries, loc *time.Location) *Predictor {
+	return &Predictor{
+		queries: queries,
+		loc:     loc,
+	}
+}
+
+// PredictRun predicts arrival at every station the run has not reached yet.
+// The current delay is carried forward with the delay the train usually gains or
+// recovers between here and each station on that weekday, blended into the
+// historical median as the station gets further away.
+func (p *Predictor) PredictRun(ctx context.Context, runID string) (*RunPrediction, error) {
+	prediction, _, err := p.predict(ctx, runID)
+	return prediction, err
+}
+
+// PredictStation predicts arrival of the run at one station ahead of it
+func (p *Predictor) PredictStation(ctx context.Context, runID, stationCode string) (*StationPrediction, error) {
+	prediction, route, err := p.predict(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, eta := range prediction.Stations {
+		if eta.StationCode == stationCode {
+			return &StationPrediction{
+				RunID:              prediction.RunID,
+				TrainNo:            prediction.TrainNo,
+				RunDate:            prediction.RunDate,
+				CurrentStationCode: prediction.CurrentStationCode,
+				CurrentDelayMin:    prediction.CurrentDelayMin,
+				CurrentDistanceKm:  prediction.CurrentDistanceKm,
+				RouteFraction:      prediction.RouteFraction,
+				Station:            eta,
+			}, nil
+		}
+	}
+	for _, stn := range route {
+		if stn.StationCode == stationCode {
+			return nil, ErrStationPassed
+		}
+	}
+	return nil, ErrStationNotOnRoute
+}
+
+func (p *Predictor) predict(ctx context.Context, runID string) (*RunPrediction, []db.ListScheduleRouteRow, error) {
+	run, err := p.queries.GetRunPredictionContext(ctx, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("load run: %w", err)
+	}
+
+	runDate, err := time.ParseInLocation(time.DateOnly, run.RunDate, p.loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse run date %q: %w", run.RunDate, err)
+	}
+	originDeparture := runDate.Add(time.Duration(run.OriginSchDepartureMin) * time.Minute)
+
+	prediction := &RunPrediction{
+		RunID:    run.RunID,
+		TrainNo:  run.TrainNo,
+		RunDate:  run.RunDate,
+		Stations: []StationETA{},
+	}
+
+	route, err := p.queries.ListScheduleRoute(ctx, run.ScheduleID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load route: %w", err)
+	}
+	if run.HasArrived == 1 {
+		return prediction, route, nil
+	}
+
+	events, err := p.queries.ListRunStationEvents(ctx, runID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load station events: %w", err)
+	}
+
+	profiles, err := p.loadProfiles(ctx, run.TrainNo, runDate.Weekday())
+	if err != nil {
+		return nil, nil, fmt.Errorf("load delay profiles: %w", err)
+	}
+
+	// latest station with a known delay is where the prediction starts from
+	var current *db.ListRunStationEventsRow
+	for i := range events {
+		if events[i].DelayDepartureMin.Valid || events[i].DelayArrivalMin.Valid {
+			current = &events[i]
+		}
+	}
+
+	currentDistKm := -1.0
+	currentMin := 0.0
+	live := current != nil
+	var currentProfile Profile
+	hasCurrentProfile := false
+	if current != nil {
+		prediction.CurrentStationCode = current.StationCode
+		prediction.CurrentDelayMin = current.DelayArrivalMin.Int64
+		if current.DelayDepartureMin.Valid {
+			prediction.CurrentDelayMin = current.DelayDepartureMin.Int64
+		}
+		currentDistKm = float64(current.DistanceKmU4) / 1e4
+		currentProfile, hasCurrentProfile = profiles[current.StationCode]
+		for _, stn := range route {
+			if stn.StationCode == current.StationCode {
+				currentMin = float64(stn.SchDepartureMinFromStart)
+				break
+			}
+		}
+	}
+
+	// a fix past the last reported station is fresher, the delay there is how far the
+	// train is behind the timetable at that distance
+	if run.DistanceKmU4.Valid && run.LastUpdateTimestampIso.Valid {
+		fixKm := float64(run.DistanceKmU4.Int64) / 1e4
+		fixAt, err := time.Parse(time.RFC3339, run.LastUpdateTimestampIso.String)
+		if schMin, ok := scheduledMinAt(route, fixKm); err == nil && ok && fixKm > currentDistKm {
+			prediction.CurrentDelayMin = int64(math.Round(fixAt.Sub(originDeparture).Minutes() - schMin))
+			currentDistKm = fixKm
+			currentMin = schMin
+			live = true
+		}
+	}
+	if live {
+		prediction.CurrentDistanceKm = &currentDistKm
+		if len(route) > 0 && route[len(route)-1].DistanceKm > 0 {
+			fraction := math.Min(1, currentDistKm/route[len(route)-1].DistanceKm)
+			prediction.RouteFraction = &fraction
+		}
+	}
+
+	for _, stn := range route {
+		if stn.DistanceKm <= currentDistKm {
+			continue
+		}
+
+		scheduled := originDeparture.Add(time.Duration(stn.SchArrivalMinFromStart) * time.Minute)
+		remainingMin := math.Max(0, float64(stn.SchArrivalMinFromStart)-currentMin)
+
+		eta := StationETA{
+			StationCode:      stn.StationCode,
+			StationName:      stn.StationName,
+			DistanceKm:       stn.DistanceKm,
+			Stops:            stn.Stops == 1,
+			ScheduledArrival: scheduled,
+		}
+
+		var delay, low, high float64
+		if profile, ok := profiles[stn.StationCode]; ok {
+			// weight of the live delay, 0 before the run has reported anything
+			alpha := 0.0
+			if live {
+				alpha = math.Exp(-remainingMin / decayMin)
+			}
+			shift := 0.0
+			if hasCurrentProfile {
+				shift = profile.P50 - currentProfile.P50
+			}
+			delay = alpha*(float64(prediction.CurrentDelayMin)+shift) + (1-alpha)*profile.P50
+			low = delay - math.Max(1, (1-alpha)*(profile.P50-profile.P10))
+			high = delay + math.Max(1, (1-alpha)*(profile.P90-profile.P50))
+			eta.HistorySamples = profile.Samples
+			eta.Method = MethodHistory
+		} else {
+			delay = float64(prediction.CurrentDelayMin)
+			spread := math.Max(1, remainingMin*naiveSpreadPerMin)
+			low, high = delay-spread, delay+spread
+			eta.Method = MethodNaive
+		}
+
+		eta.PredictedDelayMin = math.Round(delay*10) / 10
+		eta.PredictedArrival = scheduled.Add(minutes(delay))
+		eta.EarliestArrival = scheduled.Add(minutes(low))
+		eta.LatestArrival = scheduled.Add(minutes(high))
+		prediction.Stations = append(prediction.Stations, eta)
+	}
+
+	return prediction, route, nil
+}
+
+// loadProfiles returns the weekday profile per station, falling back to the
+// all-days profile when the weekday has too few samples
+func (p *Predictor) loadProfiles(ctx context.Context, trainNo int64, weekday time.Weekday) (map[string]Profile, error) {
+	rows, err := p.queries.ListTrainDelayProfiles(ctx, db.ListTrainDelayProfilesParams{
+		TrainNo: trainNo,
+		Weekday: int64(weekday),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]Profile, len(rows))
+	for _, row := range rows {
+		if row.Samples < minProfileSamples {
+			continue
+		}
+		if _, ok := profiles[row.StationCode]; ok && row.Weekday == -1 {
+			continue
+		}
+		profiles[row.StationCode] = Profile{
+			Samples: row.Samples,
+			P10:     float64(row.P10DelayMin),
+			P50:     float64(row.P50DelayMin),
+			P90:     float64(row.P90DelayMin),
+		}
+	}
+	return profiles, nil
+}
+
+// scheduledMinAt is the timetable minute from the origin departure at which the train
+// is due at km, interpolated between the departure from one station and the arrival at
+// the next. False off the ends of the route.
+func scheduledMinAt(route []db.ListScheduleRouteRow, km float64) (float64, bool) {
+	for i := 1; i < len(route); i++ {
+		prev, next := route[i-1], route[i]
+		if km < prev.DistanceKm || km > next.DistanceKm {
+			continue
+		}
+		dep, arr := float64(prev.SchDepartureMinFromStart), float64(next.SchArrivalMinFromStart)
+		if next.DistanceKm <= prev.DistanceKm {
+			return dep, true
+		}
+		return dep + (arr-dep)*(km-prev.DistanceKm)/(next.DistanceKm-prev.DistanceKm), true
+	}
+	return 0, false
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute)).Round(time.Second)
+}
@@ -0,0 +1,274 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fcmScope        = "https://www.googleapis.com/auth/firebase.messaging"
+	defaultTokenURI = "https://oauth2.googleapis.com/token"
+	sendURLFormat   = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+)
+
+// ErrUnregistered means FCM will never accept the token again, the app was removed or
+// the token rotated, its subscriptions can go
+var ErrUnregistered = errors.New("push: token is not registered")
+
+// Message is one notification for one device
+type Message struct {
+	Token string
+	Title string
+	Body  string
+	Data  map[string]string
+	// CollapseKey lets a newer notification replace an older one still waiting on the device
+	CollapseKey string
+}
+
+// fcmMessage is the message resource of the v1 send request
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *fcmAndroid       `json:"android,omitempty"`
+	APNS         *fcmAPNS          `json:"apns,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmAndroid struct {
+	CollapseKey string `json:"collapse_key"`
+}
+
+type fcmAPNS struct {
+	Headers map[string]string `json:"headers"`
+}
+
+// serviceAccount is the part of a Google service account key the client needs
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCM sends through the HTTP v1 API, authenticating as a service account with
+// short-lived OAuth tokens it mints and caches itself
+type FCM struct {
+	client   *http.Client
+	account  serviceAccount
+	key      *rsa.PrivateKey
+	sendURL  string
+	tokenURL string
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// NewFCM reads the service account key downloaded from the Firebase console
+func NewFCM(credentialsFile string, timeout time.Duration) (*FCM, error) {
+	raw, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("parse credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials %s are not a service account key", credentialsFile)
+	}
+	key, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	tokenURL := account.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURI
+	}
+	return &FCM{
+		client:   &http.Client{Timeout: timeout},
+		account:  account,
+		key:      key,
+		sendURL:  fmt.Sprintf(sendURLFormat, url.PathEscape(account.ProjectID)),
+		tokenURL: tokenURL,
+	}, nil
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return key, nil
+}
+
+// Send delivers m, ErrUnregistered when the token is gone for good
+func (f *FCM) Send(ctx context.Context, m Message) error {
+	token, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	msg := fcmMessage{
+		Token:        m.Token,
+		Notification: fcmNotification{Title: m.Title, Body: m.Body},
+		Data:         m.Data,
+	}
+	if m.CollapseKey != "" {
+		msg.Android = &fcmAndroid{CollapseKey: m.CollapseKey}
+		msg.APNS = &fcmAPNS{Headers: map[string]string{"apns-collapse-id": m.CollapseKey}}
+	}
+	payload, err := json.Marshal(map[string]fcmMessage{"message": msg})
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.sendURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	_ = json.Unmarshal(raw, &failure)
+
+	code := failure.Error.Status
+	for _, d := range failure.Error.Details {
+		if d.ErrorCode != "" {
+			code = d.ErrorCode
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		// revoked or expired early, mint a new one next time
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	case code == "UNREGISTERED" || code == "SENDER_ID_MISMATCH":
+		return ErrUnregistered
+	case code == "INVALID_ARGUMENT" && strings.Contains(strings.ToLower(failure.Error.Message), "token"):
+		// a malformed token, the rest of the message is ours and always the same shape
+		return ErrUnregistered
+	}
+	return fmt.Errorf("fcm answered %s: %s %s", resp.Status, code, failure.Error.Message)
+}
+
+// token returns a cached OAuth access token, exchanging a signed JWT for a new one a
+// minute before the old one expires
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Until(f.expires) > time.Minute {
+		return f.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := f.signJWT(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		hint, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("fetch access token: %s: %s", resp.Status, bytes.TrimSpace(hint))
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.AccessToken == "" {
+		return "", fmt.Errorf("fetch access token: unexpected response: %v", err)
+	}
+
+	f.accessToken = out.AccessToken
+	f.expires = now.Add(time.Duration(out.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+// signJWT builds the RS256 assertion of the OAuth 2.0 service account flow
+func (f *FCM) signJWT(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   f.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign assertion: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
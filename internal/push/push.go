@@ -0,0 +1,244 @@
+package push
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/metrics"
+)
+
+const (
+	// subscriptions looked at per tick, the rest wait for the next one
+	batchSize = 500
+	// subscriptions are dropped this long after their run date
+	keepDays = 2
+)
+
+var sends = metrics.NewCounter("trano_push_sends_total",
+	"FCM push notifications by outcome.", "result")
+
+type Config struct {
+	CredentialsFile   string        // Firebase service account key, empty disables push
+	Interval          time.Duration // how often queued runs are looked at
+	Timeout           time.Duration // per FCM request
+	Concurrency       int           // FCM requests in flight
+	DelayThresholdMin int           // how far the delay has to move from the last push to be worth another
+}
+
+// Start blocks until ctx is cancelled
+// Sends the runs the poller queued every cfg.Interval and prunes old subscriptions once an hour
+func Start(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 8
+	}
+	if cfg.DelayThresholdMin <= 0 {
+		cfg.DelayThresholdMin = 10
+	}
+
+	fcm, err := NewFCM(cfg.CredentialsFile, cfg.Timeout)
+	if err != nil {
+		logger.Printf("push: not started: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		sendQueued(ctx, queries, fcm, logger, cfg)
+
+		if time.Since(lastPrune) >= time.Hour {
+			before := time.Now().UTC().AddDate(0, 0, -keepDays).Format(time.DateOnly)
+			if n, err := queries.PruneDeviceSubscriptions(ctx, before); err != nil {
+				logger.Printf("push: prune failed: %v", err)
+			} else if n > 0 {
+				logger.Printf("push: pruned %d subscriptions of past runs", n)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendQueued sends one batch of pushes and clears the queued runs it covered. Runs with
+// a failed send stay queued and are retried on the next tick, the devices already told
+// are not told twice as their last push is recorded.
+func sendQueued(ctx context.Context, queries *db.Queries, fcm *FCM, logger *log.Logger, cfg Config) {
+	// rows queued in the same second as the listing below may not be in it, they are
+	// only cleared on a later tick
+	before := time.Now().UTC().Format(time.DateTime)
+	pending, err := queries.ListPushPending(ctx, before)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Printf("push: queued runs query failed: %v", err)
+		}
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	rows, err := queries.ListPushTargets(ctx, db.ListPushTargetsParams{
+		DelayThresholdMin: int64(cfg.DelayThresholdMin),
+		Limit:             batchSize,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Printf("push: targets query failed: %v", err)
+		}
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		failed  = map[string]bool{}
+		lastErr error
+		wg      sync.WaitGroup
+	)
+	sem := make(chan struct{}, cfg.Concurrency)
+	for _, row := range rows {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(row db.ListPushTargetsRow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := send(ctx, queries, fcm, logger, row); err != nil {
+				mu.Lock()
+				failed[row.RunID] = true
+				lastErr = err
+				mu.Unlock()
+			}
+		}(row)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+	if len(failed) > 0 {
+		logger.Printf("push: sends failed for %d runs, retrying next tick: %v", len(failed), lastErr)
+	}
+	// a full batch may have cut the last run's subscriptions short
+	if len(rows) == batchSize {
+		failed[rows[len(rows)-1].RunID] = true
+	}
+	for _, runID := range pending {
+		if failed[runID] {
+			continue
+		}
+		if err := queries.ClearPushPending(ctx, db.ClearPushPendingParams{
+			RunID:  runID,
+			Before: before,
+		}); err != nil {
+			logger.Printf("push: failed to clear queued run %s: %v", runID, err)
+		}
+	}
+}
+
+// send pushes the run's state to one subscription, a token FCM no longer knows loses
+// its subscriptions and is not an error
+func send(ctx context.Context, queries *db.Queries, fcm *FCM, logger *log.Logger, row db.ListPushTargetsRow) error {
+	err := fcm.Send(ctx, message(row))
+	switch {
+	case err == nil:
+		sends.With("sent").Inc()
+		if err := queries.MarkDeviceNotified(ctx, db.MarkDeviceNotifiedParams{
+			NotifiedStatus:   sql.NullString{String: row.CurrentStatus, Valid: true},
+			NotifiedDelayMin: row.CurrentDelayMin,
+			ID:               row.ID,
+		}); err != nil {
+			logger.Printf("push: failed to record push to subscription %d: %v", row.ID, err)
+		}
+		return nil
+	case errors.Is(err, ErrUnregistered):
+		sends.With("unregistered").Inc()
+		if _, err := queries.DeleteDeviceToken(ctx, row.Token); err != nil {
+			logger.Printf("push: failed to drop unregistered token of subscription %d: %v", row.ID, err)
+		}
+		return nil
+	case ctx.Err() != nil:
+		// cut short by shutdown, the run stays queued
+		return err
+	default:
+		sends.With("failed").Inc()
+		return err
+	}
+}
+
+func message(row db.ListPushTargetsRow) Message {
+	data := map[string]string{
+		"run_id":   row.RunID,
+		"train_no": strconv.FormatInt(row.TrainNo, 10),
+		"run_date": row.RunDate,
+		"status":   row.CurrentStatus,
+	}
+	if row.CurrentDelayMin.Valid {
+		data["delay_min"] = strconv.FormatInt(row.CurrentDelayMin.Int64, 10)
+	}
+	return Message{
+		Token:       row.Token,
+		Title:       fmt.Sprintf("%d %s", row.TrainNo, row.TrainName),
+		Body:        describe(row.CurrentStatus, row.CurrentDelayMin),
+		Data:        data,
+		CollapseKey: row.RunID,
+	}
+}
+
+// describe is the notification text for a run's status and delay
+func describe(status string, delayMin sql.NullInt64) string {
+	switch status {
+	case "cancelled":
+		return "Cancelled"
+	case "not_running_today":
+		return "Not running on this date"
+	case "terminated":
+		return "Terminated short of its destination"
+	}
+
+	delay := ""
+	switch {
+	case !delayMin.Valid:
+	case delayMin.Int64 > 0:
+		delay = fmt.Sprintf("%d min late", delayMin.Int64)
+	case delayMin.Int64 < 0:
+		delay = fmt.Sprintf("%d min early", -delayMin.Int64)
+	default:
+		delay = "on time"
+	}
+
+	var text string
+	switch status {
+	case "completed":
+		text = "Arrived at its destination"
+	case "rescheduled":
+		text = "Rescheduled"
+	default:
+		if delay == "" {
+			return "Status: " + status
+		}
+		return "Running " + delay
+	}
+	if delay != "" {
+		text += ", " + delay
+	}
+	return text
+}
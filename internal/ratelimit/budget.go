@@ -0,0 +1,226 @@
+// Package ratelimit keeps request budgets for upstream sources in the database. A
+// process that restarts picks up the bucket and any cooldown where the previous one
+// left them, so a crash loop or a quick redeploy can't turn into a burst of requests.
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	db "trano/internal/db/sqlc"
+
+	"golang.org/x/time/rate"
+)
+
+// Budget is a token bucket plus a cooldown started when upstream pushes back. A nil
+// Budget lets everything through.
+type Budget struct {
+	name     string
+	limiter  *rate.Limiter
+	cooldown time.Duration
+	queries  *db.Queries
+	logger   *log.Logger
+
+	mu            sync.Mutex
+	blockedUntil  time.Time
+	lastBlockedAt time.Time
+	blocks        int64
+}
+
+// Load restores the named budget, tokens refill for the time it sat unused and never
+// beyond burst. A budget that was never saved starts full.
+func Load(ctx context.Context, queries *db.Queries, logger *log.Logger, name string, limit rate.Limit, burst int, cooldown time.Duration) (*Budget, error) {
+	b := &Budget{
+		name:     name,
+		limiter:  rate.NewLimiter(limit, burst),
+		cooldown: cooldown,
+		queries:  queries,
+		logger:   logger,
+	}
+
+	row, err := queries.GetUpstreamBudget(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load budget %s: %w", name, err)
+	}
+
+	now := time.Now()
+	// the limiter starts full, take out what the last process used
+	if used := burst - int(math.Floor(savedTokens(row, limit, burst, now))); used > 0 {
+		b.limiter.ReserveN(now, used)
+	}
+
+	b.blockedUntil = parseTime(row.BlockedUntil)
+	b.lastBlockedAt = parseTime(row.LastBlockedAt)
+	b.blocks = row.Blocks
+	if now.Before(b.blockedUntil) {
+		logger.Printf("ratelimit: %s still cooling down until %s", name, b.blockedUntil.Format(time.RFC3339))
+	}
+	return b, nil
+}
+
+// Rekey moves the budget to another name, for an upstream identity that changed while
+// running. What was used so far is saved under the old name. The cooldown comes from
+// the new name's last save, and the bucket keeps the lower of the two token counts so
+// the switch never makes room for a burst.
+func (b *Budget) Rekey(ctx context.Context, name string) error {
+	if b == nil {
+		return nil
+	}
+	old := b.key()
+	if name == old {
+		return nil
+	}
+	if err := b.Save(ctx); err != nil {
+		return fmt.Errorf("save budget %s: %w", old, err)
+	}
+	row, err := b.queries.GetUpstreamBudget(ctx, name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("load budget %s: %w", name, err)
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.name = name
+	b.blockedUntil, b.lastBlockedAt, b.blocks = time.Time{}, time.Time{}, 0
+	if err != nil {
+		return nil
+	}
+	if used := b.limiter.TokensAt(now) - savedTokens(row, b.limiter.Limit(), b.limiter.Burst(), now); used > 0 {
+		b.limiter.ReserveN(now, int(math.Ceil(used)))
+	}
+	b.blockedUntil = parseTime(row.BlockedUntil)
+	b.lastBlockedAt = parseTime(row.LastBlockedAt)
+	b.blocks = row.Blocks
+	return nil
+}
+
+func (b *Budget) key() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.name
+}
+
+// savedTokens is what a saved bucket holds by now, refilled for the time since and
+// never beyond burst
+func savedTokens(row db.GetUpstreamBudgetRow, limit rate.Limit, burst int, now time.Time) float64 {
+	tokens := row.Tokens
+	if savedAt, err := time.Parse(time.RFC3339, row.SavedAt); err == nil && now.After(savedAt) {
+		tokens += now.Sub(savedAt).Seconds() * float64(limit)
+	}
+	return math.Max(0, math.Min(tokens, float64(burst)))
+}
+
+// Wait blocks through any cooldown and then until a token is free
+func (b *Budget) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	until := b.blockedUntil
+	b.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return b.limiter.Wait(ctx)
+}
+
+// Block starts a cooldown after upstream refused a request, e.g. with a 429. It is
+// saved straight away, a crash right after being blocked is exactly the case to cover.
+func (b *Budget) Block(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	b.lastBlockedAt = now
+	b.blocks++
+	if until := now.Add(b.cooldown); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	until := b.blockedUntil
+	name := b.name
+	b.mu.Unlock()
+
+	b.logger.Printf("ratelimit: %s blocked by upstream, cooling down until %s", name, until.Format(time.RFC3339))
+	if err := b.Save(ctx); err != nil {
+		b.logger.Printf("ratelimit: failed to save %s: %v", name, err)
+	}
+}
+
+// Save writes the current state
+func (b *Budget) Save(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	params := db.SaveUpstreamBudgetParams{
+		Name:          b.name,
+		Tokens:        b.limiter.TokensAt(now),
+		SavedAt:       now.Format(time.RFC3339),
+		BlockedUntil:  formatTime(b.blockedUntil),
+		LastBlockedAt: formatTime(b.lastBlockedAt),
+		Blocks:        b.blocks,
+	}
+	b.mu.Unlock()
+
+	return b.queries.SaveUpstreamBudget(ctx, params)
+}
+
+// Persist saves every budget each interval until ctx is cancelled, the final save on
+// shutdown is left to the caller since the database may already be closing
+func Persist(ctx context.Context, logger *log.Logger, interval time.Duration, budgets ...*Budget) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, b := range budgets {
+				if err := b.Save(ctx); err != nil && ctx.Err() == nil {
+					logger.Printf("ratelimit: failed to save %s: %v", b.key(), err)
+				}
+			}
+		}
+	}
+}
+
+func parseTime(s sql.NullString) time.Time {
+	if !s.Valid {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, s.String)
+	return t
+}
+
+func formatTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(time.RFC3339), Valid: true}
+}
@@ -0,0 +1,53 @@
+// Package requestid carries the X-Request-ID of an API request through its context, so
+// handlers and the query layer can tag their log lines with it
+package requestid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// longer or odd client IDs are replaced, they end up verbatim in log lines
+const maxLen = 64
+
+type ctxKey struct{}
+
+// With returns ctx carrying id
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// From returns the request ID of ctx, empty outside a request
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Sanitize keeps a client supplied ID that is safe to log and echo, or makes a new one
+func Sanitize(id string, now time.Time) string {
+	if id == "" || len(id) > maxLen {
+		return New(now)
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return New(now)
+		}
+	}
+	return id
+}
+
+// New makes an ID for a request that came without one
+func New(now time.Time) string {
+	return fmt.Sprintf("req_%d", now.UnixNano())
+}
+
+// Error is http.Error with the request ID appended, so an error a user reports can be
+// matched to its log lines
+func Error(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if id := From(r.Context()); id != "" {
+		msg += " (request " + id + ")"
+	}
+	http.Error(w, msg, code)
+}
@@ -0,0 +1,428 @@
+package sim
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	db "trano/internal/db/sqlc"
+)
+
+const (
+	// synthetic trains are numbered from here so they never collide with real ones
+	seedTrainBase = 50000
+	maxSeedTrains = 99999 - seedTrainBase
+
+	seedSourceURL = "sim://seed"
+	earthRadiusKm = 6371.0
+	// rail distance is longer than the great circle between two stations
+	trackFactor = 1.2
+)
+
+var (
+	seedZones      = []string{"NR", "WR", "CR", "ER", "SR", "NFR", "SCR", "SER", "ECR", "NWR"}
+	seedTrainTypes = []struct {
+		name     string
+		speedKmh float64
+	}{
+		{"Passenger", 40},
+		{"Express", 55},
+		{"Mail", 55},
+		{"Superfast", 70},
+		{"Rajdhani", 85},
+	}
+)
+
+type SeedOptions struct {
+	Trains   int
+	Days     int           // runs are generated for this many days up to and including today
+	Stations int           // size of the station network, 0 picks one from Trains
+	Interval time.Duration // spacing of the generated location fixes
+	Seed     uint64
+}
+
+// Seed fills the database with synthetic stations, trains, schedules, runs and
+// location history. Runs move exactly like they would in simulation mode, so a seeded
+// database and a live simulator agree. Everything is upserted, seeding twice with the
+// same options leaves the same data behind.
+func Seed(ctx context.Context, sqlDB *sql.DB, loc *time.Location, logger *log.Logger, opts SeedOptions) error {
+	if opts.Trains <= 0 || opts.Trains > maxSeedTrains {
+		return fmt.Errorf("trains must be between 1 and %d", maxSeedTrains)
+	}
+	if opts.Days <= 0 {
+		return fmt.Errorf("days must be positive")
+	}
+	if opts.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if opts.Stations <= 0 {
+		opts.Stations = max(200, opts.Trains/2)
+	}
+
+	queries := db.New(sqlDB)
+	rng := rand.New(rand.NewPCG(opts.Seed, 0))
+
+	stations, err := seedStations(ctx, sqlDB, queries, rng, opts.Stations)
+	if err != nil {
+		return fmt.Errorf("seed stations: %w", err)
+	}
+	logger.Printf("seed: %d stations", len(stations))
+	grid := newStationGrid(stations)
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	var runs, fixes int
+	for i := range opts.Trains {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		trainRuns, trainFixes, err := seedTrain(ctx, sqlDB, queries, rng, grid, stations, int64(seedTrainBase+i), today, now, opts)
+		if err != nil {
+			return fmt.Errorf("seed train %d: %w", seedTrainBase+i, err)
+		}
+		runs += trainRuns
+		fixes += trainFixes
+
+		if (i+1)%500 == 0 || i+1 == opts.Trains {
+			logger.Printf("seed: %d/%d trains | runs: %d | locations: %d", i+1, opts.Trains, runs, fixes)
+		}
+	}
+
+	return nil
+}
+
+type seedStation struct {
+	code     string
+	lat, lng float64
+}
+
+func seedStations(ctx context.Context, sqlDB *sql.DB, queries *db.Queries, rng *rand.Rand, n int) ([]seedStation, error) {
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	txq := queries.WithTx(tx)
+	stations := make([]seedStation, 0, n)
+	for i := range n {
+		st := seedStation{
+			code: fmt.Sprintf("SY%04d", i),
+			// inside the mainland, well within the poller's india bounds
+			lat: 10 + rng.Float64()*20,
+			lng: 72 + rng.Float64()*16,
+		}
+		zone := seedZones[i%len(seedZones)]
+		if err := txq.UpsertStation(ctx, db.UpsertStationParams{
+			StationCode:       st.code,
+			StationName:       fmt.Sprintf("Synthetic %04d", i),
+			Zone:              sql.NullString{String: zone, Valid: true},
+			Division:          sql.NullString{String: fmt.Sprintf("%s%d", zone, i%5), Valid: true},
+			Lat:               sql.NullFloat64{Float64: st.lat, Valid: true},
+			Lng:               sql.NullFloat64{Float64: st.lng, Valid: true},
+			NumberOfPlatforms: sql.NullInt64{Int64: int64(1 + rng.IntN(8)), Valid: true},
+			StationType:       sql.NullString{String: "Regular", Valid: true},
+		}); err != nil {
+			return nil, err
+		}
+		stations = append(stations, st)
+	}
+
+	return stations, tx.Commit()
+}
+
+// seedTrain writes one train with its schedule and every run in the window, in a
+// single transaction
+func seedTrain(
+	ctx context.Context,
+	sqlDB *sql.DB,
+	queries *db.Queries,
+	rng *rand.Rand,
+	grid stationGrid,
+	stations []seedStation,
+	trainNo int64,
+	today, now time.Time,
+	opts SeedOptions,
+) (int, int, error) {
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	txq := queries.WithTx(tx)
+	trainType := seedTrainTypes[rng.IntN(len(seedTrainTypes))]
+
+	if err := txq.UpsertTrain(ctx, db.UpsertTrainParams{
+		TrainNo:   trainNo,
+		TrainName: fmt.Sprintf("Synthetic %s %d", trainType.name, trainNo),
+		TrainType: trainType.name,
+		Zone:      sql.NullString{String: seedZones[rng.IntN(len(seedZones))], Valid: true},
+		SourceUrl: seedSourceURL,
+	}); err != nil {
+		return 0, 0, err
+	}
+
+	route := seedRoute(rng, grid, stations, trainType.speedKmh)
+	last := route[len(route)-1]
+
+	runningDays := int64(127)
+	if rng.Float64() < 0.4 {
+		runningDays = int64(1 + rng.IntN(127))
+	}
+	originDepMin := int64(rng.IntN(1440))
+
+	scheduleID, err := txq.UpsertTrainSchedule(ctx, db.UpsertTrainScheduleParams{
+		TrainNo:               trainNo,
+		OriginStationCode:     route[0].StationCode,
+		TerminusStationCode:   last.StationCode,
+		OriginSchDepartureMin: originDepMin,
+		TotalDistanceKm:       last.DistanceKm,
+		TotalRuntimeMin:       last.SchArrivalMinFromStart,
+		RunningDaysBitmap:     runningDays,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, rt := range route {
+		if err := txq.UpsertTrainRoute(ctx, db.UpsertTrainRouteParams{
+			ScheduleID:               scheduleID,
+			StationCode:              rt.StationCode,
+			DistanceKm:               rt.DistanceKm,
+			SchArrivalMinFromStart:   rt.SchArrivalMinFromStart,
+			SchDepartureMinFromStart: rt.SchDepartureMinFromStart,
+			Stops:                    rt.Stops,
+		}); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var runs, fixes int
+	for d := opts.Days - 1; d >= 0; d-- {
+		runDate := today.AddDate(0, 0, -d)
+		if runningDays&(1<<int(runDate.Weekday())) == 0 {
+			continue
+		}
+		n, err := seedRun(ctx, txq, trainNo, scheduleID, originDepMin, route, runDate, now, opts.Interval)
+		if err != nil {
+			return 0, 0, err
+		}
+		runs++
+		fixes += n
+	}
+
+	return runs, fixes, tx.Commit()
+}
+
+// seedRoute walks from a random origin to one of the closest unused stations at every
+// hop. Schedule times follow from the train's speed plus a short halt at every stop.
+func seedRoute(rng *rand.Rand, grid stationGrid, stations []seedStation, speedKmh float64) []db.ListScheduleRouteRow {
+	n := min(6+rng.IntN(25), len(stations))
+	used := make(map[int]bool, n)
+
+	at := rng.IntN(len(stations))
+	used[at] = true
+	route := []db.ListScheduleRouteRow{seedRouteRow(stations[at], 0, 0, 0, 1)}
+
+	var distance float64
+	var minutes int64
+	for len(route) < n {
+		next, hopKm := grid.near(rng, stations, at, used)
+		if next < 0 {
+			break
+		}
+
+		hopKm *= trackFactor
+		distance += hopKm
+		minutes += int64(math.Ceil(hopKm / speedKmh * 60))
+		arrival := minutes
+
+		stops := int64(1)
+		if rng.Float64() < 0.2 {
+			stops = 0
+		}
+		if stops == 1 && len(route) < n-1 {
+			minutes += int64(2 + rng.IntN(4))
+		}
+
+		at = next
+		used[at] = true
+		route = append(route, seedRouteRow(stations[at], distance, arrival, minutes, stops))
+	}
+
+	// the terminus is always a stop
+	route[len(route)-1].Stops = 1
+	return route
+}
+
+// stationGrid buckets stations into one degree cells
+type stationGrid map[[2]int][]int
+
+func newStationGrid(stations []seedStation) stationGrid {
+	grid := make(stationGrid)
+	for i, st := range stations {
+		cell := [2]int{int(st.lat), int(st.lng)}
+		grid[cell] = append(grid[cell], i)
+	}
+	return grid
+}
+
+// near picks one of the three closest unused stations around at, widening the search
+// until something turns up
+func (g stationGrid) near(rng *rand.Rand, stations []seedStation, at int, used map[int]bool) (int, float64) {
+	type candidate struct {
+		idx int
+		km  float64
+	}
+
+	from := stations[at]
+	for radius := 1; radius <= 4; radius++ {
+		var candidates []candidate
+		for dLat := -radius; dLat <= radius; dLat++ {
+			for dLng := -radius; dLng <= radius; dLng++ {
+				for _, c := range g[[2]int{int(from.lat) + dLat, int(from.lng) + dLng}] {
+					if !used[c] {
+						candidates = append(candidates, candidate{c, haversineKm(from, stations[c])})
+					}
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(a.km, b.km) })
+		pick := candidates[rng.IntN(min(3, len(candidates)))]
+		return pick.idx, pick.km
+	}
+	return -1, 0
+}
+
+func seedRouteRow(st seedStation, distanceKm float64, arrMin, depMin, stops int64) db.ListScheduleRouteRow {
+	return db.ListScheduleRouteRow{
+		StationCode:              st.code,
+		DistanceKm:               math.Round(distanceKm*10) / 10,
+		SchArrivalMinFromStart:   arrMin,
+		SchDepartureMinFromStart: depMin,
+		Stops:                    stops,
+		Lat:                      sql.NullFloat64{Float64: st.lat, Valid: true},
+		Lng:                      sql.NullFloat64{Float64: st.lng, Valid: true},
+	}
+}
+
+// seedRun writes what the poller would have recorded for the run by now, one fix per
+// interval from origin departure until arrival or now
+func seedRun(
+	ctx context.Context,
+	txq *db.Queries,
+	trainNo, scheduleID, originDepMin int64,
+	route []db.ListScheduleRouteRow,
+	runDate, now time.Time,
+	interval time.Duration,
+) (int, error) {
+	runID := fmt.Sprintf("%d_%s", trainNo, runDate.Format(time.DateOnly))
+	if err := txq.UpsertTrainRun(ctx, db.UpsertTrainRunParams{
+		RunID:      runID,
+		ScheduleID: scheduleID,
+		TrainNo:    trainNo,
+		RunDate:    runDate.Format(time.DateOnly),
+	}); err != nil {
+		return 0, err
+	}
+
+	stops := plan(trainNo, runDate, originDepMin, route)
+	start := stops[0].actDep
+	if now.Unix() < start {
+		return 0, nil
+	}
+	end := min(now.Unix(), stops[len(stops)-1].actArr)
+
+	var fixes int
+	var f fix
+	step := int64(interval / time.Second)
+	for t := start; ; t += step {
+		t = min(t, end)
+		f = locate(stops, t)
+		if err := txq.LogRunLocation(ctx, db.LogRunLocationParams{
+			RunID:              runID,
+			LatU6:              int64(f.lat * 1e6),
+			LngU6:              int64(f.lng * 1e6),
+			DistanceKmU4:       int64(f.distanceKm * 1e4),
+			SegmentStationCode: stops[f.cur].route.StationCode,
+			AtStation:          boolInt(!f.departedCur),
+			TimestampIso:       time.Unix(t, 0).In(now.Location()).Format(time.RFC3339),
+		}); err != nil {
+			return fixes, err
+		}
+		fixes++
+		if t == end {
+			break
+		}
+	}
+
+	for i, st := range stops[:f.cur+1] {
+		departed := i < f.cur || f.departedCur
+		delay := sql.NullInt64{Int64: int64(st.delayMin), Valid: true}
+		params := db.UpsertRunStationEventParams{
+			RunID:           runID,
+			Sno:             int64(i),
+			StationCode:     st.route.StationCode,
+			DistanceKmU4:    int64(st.route.DistanceKm * 1e4),
+			SchArrivalTm:    sql.NullInt64{Int64: st.schArr, Valid: true},
+			ActArrivalTm:    sql.NullInt64{Int64: st.actArr, Valid: true},
+			SchDepartureTm:  sql.NullInt64{Int64: st.schDep, Valid: true},
+			DelayArrivalMin: delay,
+			Departed:        boolInt(departed),
+		}
+		if departed {
+			params.ActDepartureTm = sql.NullInt64{Int64: st.actDep, Valid: true}
+			params.DelayDepartureMin = delay
+		}
+		if _, err := txq.UpsertRunStationEvent(ctx, params); err != nil {
+			return fixes, err
+		}
+	}
+
+	status := "running"
+	if f.arrived {
+		status = "completed"
+	}
+	cur := stops[f.cur]
+	return fixes, txq.UpdateRunStatus(ctx, db.UpdateRunStatusParams{
+		RunID:         runID,
+		HasStarted:    sql.NullInt64{Int64: 1, Valid: true},
+		HasArrived:    sql.NullInt64{Int64: boolInt(f.arrived), Valid: true},
+		CurrentStatus: status,
+		LatU6:         sql.NullInt64{Int64: int64(f.lat * 1e6), Valid: true},
+		LngU6:         sql.NullInt64{Int64: int64(f.lng * 1e6), Valid: true},
+		DistanceKmU4:  sql.NullInt64{Int64: int64(f.distanceKm * 1e4), Valid: true},
+		LastUpdatedSno: sql.NullString{
+			String: fmt.Sprintf("%d|%s|%d|%d|%d|%d", f.cur, cur.route.StationCode, cur.schArr, cur.actArr, cur.schDep, cur.actDep),
+			Valid:  true,
+		},
+		LastUpdateIso: sql.NullString{String: time.Unix(end, 0).In(now.Location()).Format(time.RFC3339), Valid: true},
+	})
+}
+
+func haversineKm(a, b seedStation) float64 {
+	lat1, lat2 := a.lat*math.Pi/180, b.lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.lng - a.lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,278 @@
+// Package sim is a stand-in for the whereismytrain live status api. It moves trains
+// along their stored schedules with a made-up but repeatable delay pattern, so the
+// poller, analytics and api can run without touching the real upstream. Schedules are
+// read from the database, so trains have to be synced or seeded beforehand.
+package sim
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/wimt"
+)
+
+const (
+	// path the real api serves live status on, so clients only swap the host
+	LiveStatusPath = "/cache/live_status"
+
+	maxDelayMin = 240
+)
+
+type Server struct {
+	queries *db.Queries
+	loc     *time.Location
+	logger  *log.Logger
+	now     func() time.Time
+}
+
+func New(queries *db.Queries, loc *time.Location, logger *log.Logger) *Server {
+	return &Server{
+		queries: queries,
+		loc:     loc,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Handler serves LiveStatusPath with the query parameters the real api takes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+LiveStatusPath, s.serveLiveStatus)
+	return mux
+}
+
+// ListenAndServe blocks until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) serveLiveStatus(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	trainNo, err := strconv.ParseInt(q.Get("train_no"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid train_no", http.StatusBadRequest)
+		return
+	}
+	runDate, err := time.ParseInLocation("02-01-2006", q.Get("date"), s.loc)
+	if err != nil {
+		http.Error(w, "invalid date", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.simulate(r.Context(), trainNo, q.Get("from"), q.Get("to"), runDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the real api answers unknown runs with a short body
+		_, _ = w.Write([]byte(`{"error":"not_running_today"}`))
+		return
+	}
+	if err != nil {
+		s.logger.Printf("sim: live status for %d failed: %v", trainNo, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Printf("sim: failed to write live status for %d: %v", trainNo, err)
+	}
+}
+
+// stop is one station of the simulated run with its actual times as unix seconds
+type stop struct {
+	route     db.ListScheduleRouteRow
+	schArr    int64
+	schDep    int64
+	actArr    int64
+	actDep    int64
+	delayMin  float64
+	hasCoords bool
+}
+
+func (s *Server) simulate(ctx context.Context, trainNo int64, from, to string, runDate time.Time) (*wimt.APIResponse, error) {
+	schedule, err := s.queries.GetScheduleByEndpoints(ctx, db.GetScheduleByEndpointsParams{
+		TrainNo:             trainNo,
+		OriginStationCode:   from,
+		TerminusStationCode: to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	route, err := s.queries.ListScheduleRoute(ctx, schedule.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(route) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	stops := plan(trainNo, runDate, schedule.OriginSchDepartureMin, route)
+	now := s.now().Unix()
+	f := locate(stops, now)
+	cur, departedCur := f.cur, f.departedCur
+
+	resp := &wimt.APIResponse{
+		Departed:           now >= stops[0].actDep,
+		RunningStatus:      "running",
+		SourceStation:      from,
+		DestinationStation: to,
+		CurStn:             stops[cur].route.StationCode,
+		DepartedCurStn:     departedCur,
+		Delay:              stops[cur].delayMin,
+		StartDate:          runDate.Format(time.DateOnly),
+		LastUpdateIsoDate:  time.Unix(now, 0).In(s.loc).Format(time.RFC3339),
+		Distance:           f.distanceKm,
+	}
+	if f.arrived {
+		resp.RunningStatus = "end"
+	}
+	if f.hasCoords {
+		resp.Lat, resp.Lng = &f.lat, &f.lng
+	}
+
+	resp.DaysSchedule = make([]wimt.DaySchedule, 0, len(stops))
+	for i, st := range stops {
+		day := wimt.DaySchedule{
+			Sno:              i,
+			StationCode:      st.route.StationCode,
+			Distance:         st.route.DistanceKm,
+			Stops:            st.route.Stops == 1,
+			SchArrivalTm:     st.schArr,
+			SchDepartureTm:   st.schDep,
+			Lat:              st.route.Lat.Float64,
+			Lng:              st.route.Lng.Float64,
+			DelayInArrival:   st.delayMin,
+			DelayInDeparture: st.delayMin,
+		}
+
+		reached := i < cur || (i == cur && now >= st.actArr)
+		left := i < cur || (i == cur && departedCur)
+		if reached {
+			day.ActualArrivalTm = st.actArr
+			day.ActualDepartureTm = st.actDep
+			day.Departed = &left
+		} else {
+			// like the real api, stations ahead carry the current delay as an estimate
+			day.ActualArrivalTm = st.schArr + int64(stops[cur].delayMin*60)
+			day.ActualDepartureTm = st.schDep + int64(stops[cur].delayMin*60)
+			day.DelayInArrival = stops[cur].delayMin
+			day.DelayInDeparture = stops[cur].delayMin
+		}
+		if i == cur {
+			isCur := true
+			day.CurStn = &isCur
+		}
+		resp.DaysSchedule = append(resp.DaysSchedule, day)
+	}
+
+	return resp, nil
+}
+
+// plan lays out actual times for every station. The delay starts small, drifts by a
+// few minutes per station and never goes negative; the seed makes a run look the
+// same on every poll.
+func plan(trainNo int64, runDate time.Time, originDepMin int64, route []db.ListScheduleRouteRow) []stop {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.FormatInt(trainNo, 10) + runDate.Format(time.DateOnly)))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+
+	originDeparture := runDate.Add(time.Duration(originDepMin) * time.Minute).Unix()
+
+	delay := float64(rng.IntN(16))
+	if rng.Float64() < 0.1 {
+		delay += float64(30 + rng.IntN(60))
+	}
+
+	stops := make([]stop, 0, len(route))
+	for i, rt := range route {
+		if i > 0 {
+			delay = math.Min(maxDelayMin, math.Max(0, delay+rng.NormFloat64()*3+0.5))
+		}
+		st := stop{
+			route:     rt,
+			schArr:    originDeparture + rt.SchArrivalMinFromStart*60,
+			schDep:    originDeparture + rt.SchDepartureMinFromStart*60,
+			delayMin:  math.Round(delay),
+			hasCoords: rt.Lat.Valid && rt.Lng.Valid,
+		}
+		st.actArr = st.schArr + int64(st.delayMin)*60
+		st.actDep = st.schDep + int64(st.delayMin)*60
+		stops = append(stops, st)
+	}
+	return stops
+}
+
+// fix is where a planned run is at a given moment
+type fix struct {
+	cur         int // last station reached, the origin until the train leaves
+	departedCur bool
+	arrived     bool
+	distanceKm  float64
+	lat, lng    float64
+	hasCoords   bool
+}
+
+func locate(stops []stop, now int64) fix {
+	cur := 0
+	for i := range stops {
+		if stops[i].actArr <= now {
+			cur = i
+		}
+	}
+	last := len(stops) - 1
+
+	f := fix{
+		cur:         cur,
+		departedCur: now >= stops[cur].actDep && cur < last,
+		arrived:     cur == last && now >= stops[last].actArr,
+		distanceKm:  stops[cur].route.DistanceKm,
+	}
+	f.lat, f.lng, f.hasCoords = stops[cur].position()
+	if f.departedCur {
+		// between cur and the next station, progress is linear in time
+		next := stops[cur+1]
+		frac := float64(now-stops[cur].actDep) / float64(max(next.actArr-stops[cur].actDep, 1))
+		f.distanceKm = lerp(stops[cur].route.DistanceKm, next.route.DistanceKm, frac)
+		nextLat, nextLng, nextOK := next.position()
+		f.lat, f.lng = lerp(f.lat, nextLat, frac), lerp(f.lng, nextLng, frac)
+		f.hasCoords = f.hasCoords && nextOK
+	}
+	return f
+}
+
+func (st stop) position() (float64, float64, bool) {
+	return st.route.Lat.Float64, st.route.Lng.Float64, st.hasCoords
+}
+
+func lerp(a, b, frac float64) float64 {
+	return a + (b-a)*frac
+}
@@ -0,0 +1,215 @@
+package tiles
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Mapbox Vector Tile 2.1 wire format, written directly with protowire since
+// there is no generated vector_tile.proto in the tree
+
+const (
+	geomPoint      = 1
+	geomLineString = 2
+
+	cmdMoveTo = 1
+	cmdLineTo = 2
+)
+
+type feature struct {
+	id       uint64
+	geomType uint64
+	tags     []uint64
+	geometry []uint64
+}
+
+// Layer collects features sharing one key/value dictionary
+type Layer struct {
+	name     string
+	features []feature
+	keys     []string
+	keyIdx   map[string]uint64
+	values   [][]byte // encoded Value messages
+	valueIdx map[string]uint64
+}
+
+func NewLayer(name string) *Layer {
+	return &Layer{
+		name:     name,
+		keyIdx:   map[string]uint64{},
+		valueIdx: map[string]uint64{},
+	}
+}
+
+// Len is the number of features added so far
+func (l *Layer) Len() int {
+	return len(l.features)
+}
+
+// AddPoint adds a point at tile coordinates x, y. Properties may be strings, bools,
+// integers or floats; nil values are left out.
+func (l *Layer) AddPoint(id uint64, x, y int64, props map[string]any) {
+	l.features = append(l.features, feature{
+		id:       id,
+		geomType: geomPoint,
+		tags:     l.tags(props),
+		geometry: []uint64{command(cmdMoveTo, 1), protowire.EncodeZigZag(x), protowire.EncodeZigZag(y)},
+	})
+}
+
+// AddLineString adds a line through pts in tile coordinates, skipping repeated
+// points. Lines left with fewer than two points are dropped.
+func (l *Layer) AddLineString(id uint64, pts [][2]int64, props map[string]any) {
+	var geom []uint64
+	var cx, cy int64
+	lineTo := 0
+	for i, p := range pts {
+		if i > 0 && p[0] == cx && p[1] == cy {
+			continue
+		}
+		if i == 0 {
+			geom = append(geom, command(cmdMoveTo, 1))
+		} else if lineTo == 0 {
+			// placeholder, the count is known once all points are in
+			geom = append(geom, 0)
+		}
+		geom = append(geom, protowire.EncodeZigZag(p[0]-cx), protowire.EncodeZigZag(p[1]-cy))
+		cx, cy = p[0], p[1]
+		if i > 0 {
+			lineTo++
+		}
+	}
+	if lineTo == 0 {
+		return
+	}
+	geom[3] = command(cmdLineTo, lineTo)
+
+	l.features = append(l.features, feature{
+		id:       id,
+		geomType: geomLineString,
+		tags:     l.tags(props),
+		geometry: geom,
+	})
+}
+
+// tags indexes props into the layer dictionary, in key order so tiles are reproducible
+func (l *Layer) tags(props map[string]any) []uint64 {
+	keys := make([]string, 0, len(props))
+	for k, v := range props {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	tags := make([]uint64, 0, 2*len(keys))
+	for _, k := range keys {
+		value, ok := encodeValue(props[k])
+		if !ok {
+			continue
+		}
+
+		ki, ok := l.keyIdx[k]
+		if !ok {
+			ki = uint64(len(l.keys))
+			l.keys = append(l.keys, k)
+			l.keyIdx[k] = ki
+		}
+		vi, ok := l.valueIdx[string(value)]
+		if !ok {
+			vi = uint64(len(l.values))
+			l.values = append(l.values, value)
+			l.valueIdx[string(value)] = vi
+		}
+		tags = append(tags, ki, vi)
+	}
+	return tags
+}
+
+func encodeValue(v any) ([]byte, bool) {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case float64:
+		b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case int:
+		return encodeValue(int64(v))
+	case uint32:
+		return encodeValue(int64(v))
+	case int64:
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+	case bool:
+		b = protowire.AppendTag(b, 7, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	default:
+		return nil, false
+	}
+	return b, true
+}
+
+// Encode writes a tile holding the non-empty layers
+func Encode(layers ...*Layer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		if l == nil || len(l.features) == 0 {
+			continue
+		}
+		tile = protowire.AppendTag(tile, 3, protowire.BytesType)
+		tile = protowire.AppendBytes(tile, l.encode())
+	}
+	return tile
+}
+
+func (l *Layer) encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	b = protowire.AppendVarint(b, 2)
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, l.name)
+
+	for _, f := range l.features {
+		var fb []byte
+		fb = protowire.AppendTag(fb, 1, protowire.VarintType)
+		fb = protowire.AppendVarint(fb, f.id)
+		if len(f.tags) > 0 {
+			fb = protowire.AppendTag(fb, 2, protowire.BytesType)
+			fb = protowire.AppendBytes(fb, packed(f.tags))
+		}
+		fb = protowire.AppendTag(fb, 3, protowire.VarintType)
+		fb = protowire.AppendVarint(fb, f.geomType)
+		fb = protowire.AppendTag(fb, 4, protowire.BytesType)
+		fb = protowire.AppendBytes(fb, packed(f.geometry))
+
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, fb)
+	}
+	for _, k := range l.keys {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, k)
+	}
+	for _, v := range l.values {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	b = protowire.AppendTag(b, 5, protowire.VarintType)
+	b = protowire.AppendVarint(b, Extent)
+	return b
+}
+
+func packed(vs []uint64) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = protowire.AppendVarint(b, v)
+	}
+	return b
+}
+
+func command(id, count int) uint64 {
+	return uint64(id&0x7) | uint64(count)<<3
+}
@@ -0,0 +1,79 @@
+package tiles
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// Extent is the size of a tile in its own coordinates
+	Extent = 4096
+	// Buffer is how far past the tile edge features are still encoded, so symbols on
+	// the edge are not cut in half
+	Buffer = 64
+
+	MaxZoom = 22
+)
+
+// Tile is a web mercator (XYZ) tile
+type Tile struct {
+	Z, X, Y uint32
+}
+
+func New(z, x, y uint32) (Tile, error) {
+	if z > MaxZoom {
+		return Tile{}, fmt.Errorf("zoom %d above %d", z, MaxZoom)
+	}
+	if n := uint32(1) << z; x >= n || y >= n {
+		return Tile{}, fmt.Errorf("tile %d/%d/%d out of range", z, x, y)
+	}
+	return Tile{Z: z, X: x, Y: y}, nil
+}
+
+// Bounds returns the lat/lng box the tile covers, widened by Buffer
+func (t Tile) Bounds() (minLat, minLng, maxLat, maxLng float64) {
+	n := float64(uint32(1) << t.Z)
+	pad := float64(Buffer) / Extent
+
+	minLng = (float64(t.X)-pad)/n*360 - 180
+	maxLng = (float64(t.X)+1+pad)/n*360 - 180
+	maxLat = tileYToLat(float64(t.Y)-pad, n)
+	minLat = tileYToLat(float64(t.Y)+1+pad, n)
+	return minLat, max(minLng, -180), maxLat, min(maxLng, 180)
+}
+
+// Project returns the position of lat/lng in tile coordinates, y grows southwards
+func (t Tile) Project(lat, lng float64) (x, y int64) {
+	n := float64(uint32(1) << t.Z)
+	lat = max(min(lat, 85.05112878), -85.05112878)
+	rad := lat * math.Pi / 180
+
+	wx := (lng + 180) / 360 * n
+	wy := (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n
+	return int64(math.Round((wx - float64(t.X)) * Extent)), int64(math.Round((wy - float64(t.Y)) * Extent))
+}
+
+// Contains reports whether tile coordinates fall inside the tile or its buffer
+func (t Tile) Contains(x, y int64) bool {
+	return x >= -Buffer && x <= Extent+Buffer && y >= -Buffer && y <= Extent+Buffer
+}
+
+// PointSpacing is the distance in tile coordinates kept between points at zoom z, so
+// a whole-country view carries a representative sample rather than every train
+// stacked on the same pixels. Zero keeps every point.
+func PointSpacing(z uint32) int64 {
+	switch {
+	case z <= 4:
+		return 64
+	case z <= 6:
+		return 32
+	case z <= 8:
+		return 8
+	default:
+		return 0
+	}
+}
+
+func tileYToLat(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
@@ -0,0 +1,147 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	ProviderOpenMeteo = "open-meteo"
+
+	// forecast endpoint serves roughly the last three months, point the url at
+	// archive-api.open-meteo.com/v1/archive for older backfills
+	defaultOpenMeteoURL = "https://api.open-meteo.com/v1/forecast"
+)
+
+const (
+	ConditionFog   = "fog"
+	ConditionRain  = "rain"
+	ConditionHeat  = "heat"
+	ConditionClear = "clear"
+
+	rainMinMm    = 2.5
+	heatMinTempC = 40.0
+)
+
+// Day is the observed weather of one local date at one point
+type Day struct {
+	Date            string // YYYY-MM-DD
+	WeatherCode     *int64 // WMO code
+	TempMaxC        *float64
+	TempMinC        *float64
+	PrecipitationMm *float64
+}
+
+// Condition reduces a day to the one condition most likely to affect running,
+// fog first since it slows trains the most
+func (d Day) Condition() string {
+	if d.WeatherCode != nil && (*d.WeatherCode == 45 || *d.WeatherCode == 48) {
+		return ConditionFog
+	}
+	if d.PrecipitationMm != nil && *d.PrecipitationMm >= rainMinMm {
+		return ConditionRain
+	}
+	if d.TempMaxC != nil && *d.TempMaxC >= heatMinTempC {
+		return ConditionHeat
+	}
+	return ConditionClear
+}
+
+type Provider interface {
+	Name() string
+	// Daily returns one Day per date in [from, to], both local dates in loc
+	Daily(ctx context.Context, lat, lng float64, from, to time.Time, loc *time.Location) ([]Day, error)
+}
+
+// New returns the named provider, nil when name is empty (enrichment disabled)
+func New(name, baseURL string) (Provider, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case ProviderOpenMeteo:
+		if baseURL == "" {
+			baseURL = defaultOpenMeteoURL
+		}
+		return &openMeteo{
+			client:  &http.Client{Timeout: 30 * time.Second},
+			baseURL: baseURL,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown weather provider %q", name)
+	}
+}
+
+type openMeteo struct {
+	client  *http.Client
+	baseURL string
+}
+
+type openMeteoResponse struct {
+	Daily struct {
+		Time             []string   `json:"time"`
+		WeatherCode      []*int64   `json:"weather_code"`
+		Temperature2mMax []*float64 `json:"temperature_2m_max"`
+		Temperature2mMin []*float64 `json:"temperature_2m_min"`
+		PrecipitationSum []*float64 `json:"precipitation_sum"`
+	} `json:"daily"`
+}
+
+func (p *openMeteo) Name() string {
+	return ProviderOpenMeteo
+}
+
+func (p *openMeteo) Daily(ctx context.Context, lat, lng float64, from, to time.Time, loc *time.Location) ([]Day, error) {
+	params := url.Values{}
+	params.Set("latitude", strconv.FormatFloat(lat, 'f', 4, 64))
+	params.Set("longitude", strconv.FormatFloat(lng, 'f', 4, 64))
+	params.Set("start_date", from.Format(time.DateOnly))
+	params.Set("end_date", to.Format(time.DateOnly))
+	params.Set("daily", "weather_code,temperature_2m_max,temperature_2m_min,precipitation_sum")
+	params.Set("timezone", loc.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var body openMeteoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	daily := body.Daily
+	days := make([]Day, 0, len(daily.Time))
+	for i, date := range daily.Time {
+		days = append(days, Day{
+			Date:            date,
+			WeatherCode:     at(daily.WeatherCode, i),
+			TempMaxC:        at(daily.Temperature2mMax, i),
+			TempMinC:        at(daily.Temperature2mMin, i),
+			PrecipitationMm: at(daily.PrecipitationSum, i),
+		})
+	}
+	return days, nil
+}
+
+// at tolerates series shorter than the time axis
+func at[T any](series []*T, i int) *T {
+	if i < len(series) {
+		return series[i]
+	}
+	return nil
+}
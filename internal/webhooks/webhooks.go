@@ -0,0 +1,338 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	db "trano/internal/db/sqlc"
+	"trano/internal/metrics"
+)
+
+// Events a subscription can ask for, the triggers in 11_webhooks.sql write them
+const (
+	EventStarted      = "run.started"
+	EventDelayChanged = "run.delay_changed"
+	EventCancelled    = "run.cancelled"
+	EventArrived      = "run.arrived"
+
+	// EventAll subscribes to every event, including ones added later
+	EventAll = "*"
+)
+
+var knownEvents = []string{EventStarted, EventDelayChanged, EventCancelled, EventArrived, EventAll}
+
+const (
+	secretPrefix = "whsec_"
+
+	// deliveries looked at per tick, the rest wait for the next one
+	batchSize = 200
+	// delivered and abandoned deliveries are kept this long for the admin listing
+	keepFinished = 7 * 24 * time.Hour
+	// first retry delay, doubled for every further attempt up to maxBackoff
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	// response bodies are only kept as an error hint
+	maxErrorBody = 256
+)
+
+var deliveries = metrics.NewCounter("trano_webhook_deliveries_total",
+	"Webhook delivery attempts by outcome.", "result")
+
+type Config struct {
+	Interval    time.Duration // how often due deliveries are looked for
+	Timeout     time.Duration // per request, a slow receiver counts as failed
+	MaxAttempts int           // attempts before a delivery is abandoned
+	Concurrency int           // subscriptions delivered to at once
+}
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	ID               int64  `json:"id"` // the same on every retry, receivers can drop repeats by it
+	Event            string `json:"event"`
+	CreatedAt        string `json:"created_at"` // when the event fired, UTC
+	DelayMin         *int64 `json:"delay_min"`  // delay of the run when the event fired
+	PreviousDelayMin *int64 `json:"previous_delay_min,omitempty"`
+	Run              Run    `json:"run"` // the run as it is at delivery time
+}
+
+type Run struct {
+	RunID      string   `json:"run_id"`
+	TrainNo    int64    `json:"train_no"`
+	TrainName  string   `json:"train_name"`
+	RunDate    string   `json:"run_date"`
+	Status     string   `json:"status"`
+	DelayMin   *int64   `json:"delay_min"`
+	Lat        *float64 `json:"lat"`
+	Lng        *float64 `json:"lng"`
+	LastUpdate *string  `json:"last_update"`
+}
+
+// ParseEvents checks event names and drops repeats
+func ParseEvents(names []string) ([]string, error) {
+	events := make([]string, 0, len(names))
+	for _, name := range names {
+		if !slices.Contains(knownEvents, name) {
+			return nil, fmt.Errorf("unknown event %q", name)
+		}
+		if !slices.Contains(events, name) {
+			events = append(events, name)
+		}
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no events")
+	}
+	if slices.Contains(events, EventAll) {
+		return []string{EventAll}, nil
+	}
+	return events, nil
+}
+
+// NewSecret returns a fresh signing secret, only shown to whoever creates the subscription
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sign is the X-Trano-Signature of a body sent at timestamp (unix seconds), the HMAC
+// covers the timestamp so a captured request cannot be replayed later as new
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start blocks until ctx is cancelled
+// Sends due deliveries every cfg.Interval and prunes old ones once an hour
+func Start(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		// a receiver that moved has to be updated, redirects are not followed
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		deliverDue(ctx, queries, client, logger, cfg)
+
+		if time.Since(lastPrune) >= time.Hour {
+			before := time.Now().UTC().Add(-keepFinished).Format(time.DateTime)
+			if n, err := queries.PruneWebhookDeliveries(ctx, before); err != nil {
+				logger.Printf("webhooks: prune failed: %v", err)
+			} else if n > 0 {
+				logger.Printf("webhooks: pruned %d finished deliveries", n)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends one batch, deliveries to the same subscription one after another
+// so a receiver sees its events in order while it keeps up
+func deliverDue(ctx context.Context, queries *db.Queries, client *http.Client, logger *log.Logger, cfg Config) {
+	rows, err := queries.ListDueWebhookDeliveries(ctx, batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Printf("webhooks: due deliveries query failed: %v", err)
+		}
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	bySub := map[int64][]db.ListDueWebhookDeliveriesRow{}
+	var order []int64
+	for _, row := range rows {
+		if _, ok := bySub[row.SubscriptionID]; !ok {
+			order = append(order, row.SubscriptionID)
+		}
+		bySub[row.SubscriptionID] = append(bySub[row.SubscriptionID], row)
+	}
+
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, subID := range order {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(rows []db.ListDueWebhookDeliveriesRow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			for _, row := range rows {
+				if ctx.Err() != nil {
+					return
+				}
+				status, err := deliver(ctx, client, row)
+				record(ctx, queries, logger, cfg, row, status, err)
+			}
+		}(bySub[subID])
+	}
+	wg.Wait()
+}
+
+// deliver POSTs the payload of row, status is 0 when no response came back
+func deliver(ctx context.Context, client *http.Client, row db.ListDueWebhookDeliveriesRow) (int, error) {
+	body, err := json.Marshal(payload(row))
+	if err != nil {
+		return 0, fmt.Errorf("encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, row.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "trano-webhooks/1")
+	req.Header.Set("X-Trano-Event", row.Event)
+	req.Header.Set("X-Trano-Delivery", strconv.FormatInt(row.ID, 10))
+	req.Header.Set("X-Trano-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Trano-Signature", Sign(row.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return resp.StatusCode, nil
+	}
+	hint, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return resp.StatusCode, fmt.Errorf("receiver answered %s: %s", resp.Status, bytes.TrimSpace(hint))
+}
+
+// record stores the outcome of an attempt, scheduling the next one or giving up
+func record(ctx context.Context, queries *db.Queries, logger *log.Logger, cfg Config, row db.ListDueWebhookDeliveriesRow, status int, deliverErr error) {
+	lastStatus := sql.NullInt64{Int64: int64(status), Valid: status != 0}
+	if deliverErr == nil {
+		deliveries.With("delivered").Inc()
+		if err := queries.MarkWebhookDelivered(ctx, db.MarkWebhookDeliveredParams{
+			LastStatus: lastStatus,
+			ID:         row.ID,
+		}); err != nil {
+			logger.Printf("webhooks: failed to mark delivery %d delivered: %v", row.ID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// cut short by shutdown, the attempt does not count
+		return
+	}
+
+	lastError := sql.NullString{String: deliverErr.Error(), Valid: true}
+	attempt := int(row.Attempts) + 1
+	if attempt >= cfg.MaxAttempts {
+		deliveries.With("abandoned").Inc()
+		logger.Printf("webhooks: giving up on delivery %d (%s for %s) to subscription %d after %d attempts: %v",
+			row.ID, row.Event, row.RunID, row.SubscriptionID, attempt, deliverErr)
+		if err := queries.AbandonWebhookDelivery(ctx, db.AbandonWebhookDeliveryParams{
+			LastStatus: lastStatus,
+			LastError:  lastError,
+			ID:         row.ID,
+		}); err != nil {
+			logger.Printf("webhooks: failed to abandon delivery %d: %v", row.ID, err)
+		}
+		return
+	}
+
+	deliveries.With("retry").Inc()
+	next := time.Now().UTC().Add(backoff(attempt))
+	if err := queries.RetryWebhookDelivery(ctx, db.RetryWebhookDeliveryParams{
+		LastStatus:    lastStatus,
+		LastError:     lastError,
+		NextAttemptAt: next.Format(time.DateTime),
+		ID:            row.ID,
+	}); err != nil {
+		logger.Printf("webhooks: failed to reschedule delivery %d: %v", row.ID, err)
+	}
+}
+
+// backoff is the wait after the given failed attempt, 30s, 1m, 2m, ... up to 6h
+func backoff(attempt int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+func payload(row db.ListDueWebhookDeliveriesRow) Payload {
+	p := Payload{
+		ID:        row.ID,
+		Event:     row.Event,
+		CreatedAt: row.CreatedAt,
+		DelayMin:  nullInt(row.DelayMin),
+		Run: Run{
+			RunID:     row.RunID,
+			TrainNo:   row.TrainNo,
+			TrainName: row.TrainName,
+			RunDate:   row.RunDate,
+			Status:    row.CurrentStatus,
+			DelayMin:  nullInt(row.CurrentDelayMin),
+		},
+	}
+	if row.Event == EventDelayChanged {
+		p.PreviousDelayMin = nullInt(row.PreviousDelayMin)
+	}
+	if row.LastKnownLatU6.Valid && row.LastKnownLngU6.Valid {
+		lat := float64(row.LastKnownLatU6.Int64) / 1e6
+		lng := float64(row.LastKnownLngU6.Int64) / 1e6
+		p.Run.Lat, p.Run.Lng = &lat, &lng
+	}
+	if row.LastUpdateTimestampIso.Valid {
+		p.Run.LastUpdate = &row.LastUpdateTimestampIso.String
+	}
+	return p
+}
+
+func nullInt(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
@@ -13,6 +13,8 @@ import (
 	"net/url"
 	"strconv"
 	"time"
+
+	"trano/internal/ratelimit"
 )
 
 const (
@@ -84,13 +86,21 @@ var userAgents = []string{
 	"Dalvik/2.1.0 (Linux; U; Android 14; Pixel 7 Build/UP1A.231005.007)",
 }
 
+// Fetcher returns the raw live status body of one run, the poller depends only on this
+type Fetcher interface {
+	FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error)
+}
+
 // handles requests to the whereismytrain api
 type APIClient struct {
 	client   *http.Client
 	proxyURL string
+	endpoint string
+	budget   *ratelimit.Budget
 }
 
-func NewAPIClient(proxyURL string) *APIClient {
+// NewAPIClient paces requests through budget, which may be nil
+func NewAPIClient(proxyURL string, budget *ratelimit.Budget) *APIClient {
 	transport := &http.Transport{}
 
 	if proxyURL != "" {
@@ -108,6 +118,17 @@ func NewAPIClient(proxyURL string) *APIClient {
 	return &APIClient{
 		client:   client,
 		proxyURL: proxyURL,
+		endpoint: baseURL,
+		budget:   budget,
+	}
+}
+
+// NewLocalAPIClient talks to a whereismytrain compatible server at endpoint without
+// a proxy, e.g. the simulator
+func NewLocalAPIClient(endpoint string) *APIClient {
+	return &APIClient{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		endpoint: endpoint,
 	}
 }
 
@@ -135,7 +156,7 @@ func (c *APIClient) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toSt
 	params.Set("flow", "regular")
 	params.Set("cb", strconv.FormatInt(time.Now().UnixNano(), 10))
 
-	fullURL := baseURL + "?" + params.Encode()
+	fullURL := c.endpoint + "?" + params.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
 	if err != nil {
@@ -145,6 +166,10 @@ func (c *APIClient) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toSt
 	req.Header.Set("User-Agent", userAgents[rand.IntN(len(userAgents))])
 	req.Header.Set("X-Requested-With", "com.whereismytrain.android")
 
+	if err := c.budget.Wait(ctx); err != nil {
+		return nil, err
+	}
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
@@ -156,6 +181,9 @@ func (c *APIClient) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toSt
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		c.budget.Block(ctx)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
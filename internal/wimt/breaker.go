@@ -0,0 +1,226 @@
+package wimt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without a request while upstream is considered down
+var ErrCircuitOpen = errors.New("wimt: circuit open")
+
+type BreakerConfig struct {
+	FailureRate float64       // share of failed requests in Window that opens the circuit, 0 disables
+	MinRequests int           // fewer requests than this in Window never open it
+	Window      time.Duration // failures are counted over this rolling span
+	Cooldown    time.Duration // how long the circuit stays open before probing
+	Probes      int           // requests let through half-open, all must succeed to close
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// number of buckets the rolling window is kept in
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// Breaker tracks request outcomes across every run polled through it, so a full
+// upstream outage stops requests for the fleet instead of failing each run in turn.
+// A nil Breaker lets everything through.
+type Breaker struct {
+	cfg    BreakerConfig
+	logger *log.Logger
+
+	mu        sync.Mutex
+	state     breakerState
+	openUntil time.Time
+	buckets   [breakerBuckets]breakerBucket
+	probing   int // probes in flight
+	probed    int // probes that succeeded since half-opening
+	opened    int64
+}
+
+func NewBreaker(cfg BreakerConfig, logger *log.Logger) *Breaker {
+	if cfg.FailureRate <= 0 {
+		return nil
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 1
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = time.Minute
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = 1
+	}
+	return &Breaker{cfg: cfg, logger: logger}
+}
+
+// Wrap sends requests to next only while the circuit allows them
+func (b *Breaker) Wrap(next Fetcher) Fetcher {
+	if b == nil {
+		return next
+	}
+	return &breakerFetcher{next: next, breaker: b}
+}
+
+// OpenUntil reports when an open circuit starts probing again, zero while requests
+// are allowed
+func (b *Breaker) OpenUntil() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Now().Before(b.openUntil) {
+		return b.openUntil
+	}
+	return time.Time{}
+}
+
+// State is closed, open or half-open, and how often the circuit has opened
+func (b *Breaker) State() (string, int64) {
+	if b == nil {
+		return breakerClosed.String(), 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state.String(), b.opened
+}
+
+// allow reports whether a request may go out and whether it is a probe
+func (b *Breaker) allow(now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if now.Before(b.openUntil) {
+			return false, false
+		}
+		b.state = breakerHalfOpen
+		b.probing, b.probed = 0, 0
+		b.logger.Printf("wimt: circuit half-open, probing with %d requests", b.cfg.Probes)
+	}
+	if b.state == breakerHalfOpen {
+		if b.probing+b.probed >= b.cfg.Probes {
+			return false, false
+		}
+		b.probing++
+		return true, true
+	}
+	return true, false
+}
+
+func (b *Breaker) record(now time.Time, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		if b.state != breakerHalfOpen {
+			return
+		}
+		b.probing--
+		if failed {
+			b.open(now, "probe failed")
+			return
+		}
+		b.probed++
+		if b.probed >= b.cfg.Probes {
+			b.state = breakerClosed
+			b.buckets = [breakerBuckets]breakerBucket{}
+			b.logger.Printf("wimt: circuit closed after %d successful probes", b.probed)
+		}
+		return
+	}
+	if b.state != breakerClosed {
+		return
+	}
+
+	span := max(b.cfg.Window/breakerBuckets, time.Millisecond)
+	bucket := &b.buckets[now.UnixNano()/int64(span)%breakerBuckets]
+	if start := now.Truncate(span); !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+
+	var requests, failures int
+	cutoff := now.Add(-b.cfg.Window)
+	for _, bk := range b.buckets {
+		if bk.start.After(cutoff) {
+			requests += bk.requests
+			failures += bk.failures
+		}
+	}
+	if requests >= b.cfg.MinRequests && float64(failures) >= b.cfg.FailureRate*float64(requests) {
+		b.open(now, fmt.Sprintf("%d of %d requests failed in the last %v", failures, requests, b.cfg.Window))
+	}
+}
+
+// release gives back a probe that never got an answer
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.probing--
+	}
+}
+
+// open must be called with mu held
+func (b *Breaker) open(now time.Time, reason string) {
+	b.state = breakerOpen
+	b.openUntil = now.Add(b.cfg.Cooldown)
+	b.buckets = [breakerBuckets]breakerBucket{}
+	b.opened++
+	b.logger.Printf("wimt: circuit open until %s, %s", b.openUntil.Format(time.RFC3339), reason)
+}
+
+type breakerFetcher struct {
+	next    Fetcher
+	breaker *Breaker
+}
+
+func (f *breakerFetcher) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error) {
+	ok, probe := f.breaker.allow(time.Now())
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+	body, err := f.next.FetchTrainStatus(ctx, trainNo, fromStn, toStn, startDate)
+	// requests cut short by shutdown say nothing about upstream
+	if ctx.Err() != nil {
+		if probe {
+			f.breaker.release()
+		}
+		return body, err
+	}
+	f.breaker.record(time.Now(), probe, err != nil)
+	return body, err
+}
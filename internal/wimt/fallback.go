@@ -0,0 +1,146 @@
+package wimt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"trano/internal/metrics"
+)
+
+var fallbackTotal = metrics.NewCounter("trano_wimt_fallback_total",
+	"Live status requests sent to the fallback provider, by why (circuit_open or static) and outcome (live, static or error).",
+	"reason", "outcome")
+
+// LiveStatusProvider is a live status source the poller can ask instead of
+// whereismytrain. Its bodies must be in whereismytrain's live_status shape, the poller
+// parses nothing else.
+type LiveStatusProvider interface {
+	Fetcher
+	Name() string
+}
+
+// bodies shorter than this are whereismytrain's one line messages, not a status
+const minStatusLen = 150
+
+// IsShort reports whether body is one of whereismytrain's one line messages, such as
+// "not running today", rather than a live status or timetable
+func IsShort(body []byte) bool {
+	return len(body) < minStatusLen
+}
+
+// IsStatic reports whether body is a timetable without live data, what whereismytrain
+// answers for runs it has lost track of. Short bodies are messages, not timetables.
+func IsStatic(body []byte) bool {
+	return !IsShort(body) &&
+		!bytes.Contains(body, []byte("running_status")) &&
+		!bytes.Contains(body, []byte("running status"))
+}
+
+// Relay is a LiveStatusProvider for a service standing in front of another source,
+// NTES enquiry or RailRadar, and answering in the whereismytrain shape. It is asked
+// GET endpoint?train_no=&from=&to=&date=YYYY-MM-DD, with the key as a bearer token.
+type Relay struct {
+	client   *http.Client
+	name     string
+	endpoint string
+	apiKey   string
+}
+
+// NewRelay names the relay after its host, apiKey may be empty
+func NewRelay(endpoint, apiKey string) *Relay {
+	name := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	return &Relay{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		name:     name,
+		endpoint: endpoint,
+		apiKey:   apiKey,
+	}
+}
+
+func (r *Relay) Name() string { return r.name }
+
+func (r *Relay) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error) {
+	params := url.Values{}
+	params.Set("train_no", trainNo)
+	params.Set("from", fromStn)
+	params.Set("to", toStn)
+	params.Set("date", startDate.Format(time.DateOnly))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	// the poller reads a short body as whereismytrain's "not running today" and closes
+	// the run, from a relay it is only ever an error message
+	if IsShort(body) {
+		return nil, fmt.Errorf("short response: %q", body)
+	}
+	return body, nil
+}
+
+// Fallback asks secondary when primary is held back by an open circuit or answers
+// with a static timetable. Only a live answer from secondary replaces primary's, so a
+// run both know nothing about is still counted as static. A nil secondary returns
+// primary as is.
+func Fallback(primary Fetcher, secondary LiveStatusProvider) Fetcher {
+	if secondary == nil {
+		return primary
+	}
+	return &fallbackFetcher{primary: primary, secondary: secondary}
+}
+
+type fallbackFetcher struct {
+	primary   Fetcher
+	secondary LiveStatusProvider
+}
+
+func (f *fallbackFetcher) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error) {
+	body, err := f.primary.FetchTrainStatus(ctx, trainNo, fromStn, toStn, startDate)
+	var reason string
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		reason = "circuit_open"
+	case err == nil && IsStatic(body):
+		reason = "static"
+	default:
+		return body, err
+	}
+
+	alt, altErr := f.secondary.FetchTrainStatus(ctx, trainNo, fromStn, toStn, startDate)
+	switch {
+	case altErr != nil || IsShort(alt):
+		fallbackTotal.With(reason, "error").Inc()
+	case IsStatic(alt):
+		fallbackTotal.With(reason, "static").Inc()
+	default:
+		fallbackTotal.With(reason, "live").Inc()
+		return alt, nil
+	}
+	return body, err
+}
@@ -0,0 +1,130 @@
+package wimt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Recording is one captured live status request and what came back
+type Recording struct {
+	TrainNo   string    `json:"train_no"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	StartDate string    `json:"start_date"` // YYYY-MM-DD
+	PolledAt  time.Time `json:"polled_at"`
+	Body      string    `json:"body,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// RunID matches train_runs.run_id
+func (r Recording) RunID() (string, error) {
+	trainNo, err := strconv.ParseInt(r.TrainNo, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid train_no %q: %w", r.TrainNo, err)
+	}
+	return fmt.Sprintf("%d_%s", trainNo, r.StartDate), nil
+}
+
+// Recorder passes requests through to next and writes every exchange to
+// dir/<train_no>_<start_date>/<polled_at_ms>.json
+type Recorder struct {
+	next   Fetcher
+	dir    string
+	logger *log.Logger
+}
+
+func NewRecorder(next Fetcher, dir string, logger *log.Logger) *Recorder {
+	return &Recorder{next: next, dir: dir, logger: logger}
+}
+
+func (r *Recorder) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error) {
+	polledAt := time.Now()
+	body, err := r.next.FetchTrainStatus(ctx, trainNo, fromStn, toStn, startDate)
+	// requests cut short by shutdown say nothing about upstream
+	if ctx.Err() != nil {
+		return body, err
+	}
+
+	rec := Recording{
+		TrainNo:   trainNo,
+		From:      fromStn,
+		To:        toStn,
+		StartDate: startDate.Format(time.DateOnly),
+		PolledAt:  polledAt,
+		Body:      string(body),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	// recording is best effort, the poll itself still goes through
+	if werr := r.write(rec); werr != nil {
+		r.logger.Printf("wimt: failed to record %s_%s: %v", trainNo, rec.StartDate, werr)
+	}
+	return body, err
+}
+
+func (r *Recorder) write(rec Recording) error {
+	dir := filepath.Join(r.dir, rec.TrainNo+"_"+rec.StartDate)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, strconv.FormatInt(rec.PolledAt.UnixMilli(), 10)+".json"), b, 0o644)
+}
+
+// LoadRecordings reads everything a Recorder wrote under dir, oldest poll first
+func LoadRecordings(dir string) ([]Recording, error) {
+	var recs []Recording
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var rec Recording
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(recs, func(a, b Recording) int { return a.PolledAt.Compare(b.PolledAt) })
+	return recs, nil
+}
+
+// Replay answers every request with a single recording, whatever is asked for
+type Replay struct {
+	rec Recording
+}
+
+func NewReplay(rec Recording) *Replay {
+	return &Replay{rec: rec}
+}
+
+func (r *Replay) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error) {
+	if r.rec.Error != "" {
+		return nil, errors.New(r.rec.Error)
+	}
+	return []byte(r.rec.Body), nil
+}
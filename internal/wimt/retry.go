@@ -0,0 +1,65 @@
+package wimt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// IsTransient reports whether err is a network hiccup worth asking again for straight
+// away: a timeout, or a connection refused, reset or dropped mid response. Answers
+// upstream gave, bad status codes included, are not.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// Retry asks next again up to retries times when a request fails with a transient
+// error, waiting around delay times the attempt in between. retries <= 0 returns
+// next as is.
+func Retry(next Fetcher, retries int, delay time.Duration) Fetcher {
+	if retries <= 0 {
+		return next
+	}
+	return &retryFetcher{next: next, retries: retries, delay: max(delay, 0)}
+}
+
+type retryFetcher struct {
+	next    Fetcher
+	retries int
+	delay   time.Duration
+}
+
+func (f *retryFetcher) FetchTrainStatus(ctx context.Context, trainNo, fromStn, toStn string, startDate time.Time) ([]byte, error) {
+	body, err := f.next.FetchTrainStatus(ctx, trainNo, fromStn, toStn, startDate)
+	for attempt := 1; attempt <= f.retries && IsTransient(err) && ctx.Err() == nil; attempt++ {
+		// jittered, so runs that failed together don't retry together
+		wait := time.Duration(attempt) * (f.delay/2 + rand.N(f.delay+1))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+		body, err = f.next.FetchTrainStatus(ctx, trainNo, fromStn, toStn, startDate)
+		if err != nil && (!IsTransient(err) || attempt == f.retries) {
+			err = fmt.Errorf("%w (after %d retries)", err, attempt)
+		}
+	}
+	return body, err
+}
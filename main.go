@@ -4,19 +4,36 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"trano/internal/analytics"
 	"trano/internal/api"
 	"trano/internal/config"
 	dbutil "trano/internal/db"
 	db "trano/internal/db/sqlc"
+	"trano/internal/gtfs"
+	"trano/internal/health"
 	"trano/internal/iri"
+	"trano/internal/metrics"
 	"trano/internal/poller"
+	"trano/internal/push"
+	"trano/internal/ratelimit"
+	"trano/internal/sim"
+	"trano/internal/weather"
+	"trano/internal/webhooks"
+	"trano/internal/wimt"
 
 	"golang.org/x/time/rate"
 )
@@ -29,6 +46,9 @@ const (
 	iriBurst          = 15
 )
 
+// a generation is due every schedulerInterval, give it a couple of hours of slack
+var schedulerHealth = health.Register("scheduler", schedulerInterval+2*time.Hour)
+
 type App struct {
 	cfg       *config.Config
 	logger    *log.Logger
@@ -36,6 +56,9 @@ type App struct {
 	queries   *db.Queries
 	loc       *time.Location
 	pollerCfg poller.Config
+	iriBudget *ratelimit.Budget
+
+	syncConcurrency atomic.Int32 // SYNCER_CONCURRENCY, reread on SIGHUP
 
 	apiManager *apiServerManager
 	wg         sync.WaitGroup
@@ -46,6 +69,36 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "seed":
+			if err := runSeed(ctx, logger, os.Args[2:]); err != nil {
+				logger.Fatalf("seed failed: %v", err)
+			}
+			return
+		case "backfill":
+			if err := runBackfill(ctx, logger, os.Args[2:]); err != nil {
+				logger.Fatalf("backfill failed: %v", err)
+			}
+			return
+		case "replay":
+			if err := runReplay(ctx, logger, os.Args[2:]); err != nil {
+				logger.Fatalf("replay failed: %v", err)
+			}
+			return
+		case "gtfs":
+			if err := runGTFS(ctx, logger, os.Args[2:]); err != nil {
+				logger.Fatalf("gtfs export failed: %v", err)
+			}
+			return
+		case "import-trains":
+			if err := runImportTrains(ctx, logger, os.Args[2:]); err != nil {
+				logger.Fatalf("train import failed: %v", err)
+			}
+			return
+		}
+	}
+
 	app, err := initializeApp(logger)
 	if err != nil {
 		logger.Fatalf("failed to initialize application: %v", err)
@@ -63,6 +116,9 @@ func main() {
 }
 
 func initializeApp(logger *log.Logger) (*App, error) {
+	if err := config.ApplyFile(); err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
 	cfg := config.Load()
 	logger.Printf("configuration loaded | db_path: %s | timezone: %s", cfg.Database.Path, cfg.Timezone)
 
@@ -72,6 +128,8 @@ func initializeApp(logger *log.Logger) (*App, error) {
 	}
 
 	queries := db.New(dbConn)
+	// shared by the poller, syncer and analytics, the API server has a pool of its own
+	metrics.RegisterDB("app", dbConn)
 
 	loc, err := time.LoadLocation(cfg.Timezone)
 	if err != nil {
@@ -79,47 +137,146 @@ func initializeApp(logger *log.Logger) (*App, error) {
 		return nil, err
 	}
 
+	typeIntervals, err := poller.ParseTypeIntervals(cfg.Poller.TypeIntervals)
+	if err != nil {
+		_ = dbConn.Close()
+		return nil, fmt.Errorf("POLLER_TYPE_INTERVALS: %w", err)
+	}
+
 	pollerCfg := poller.Config{
 		Concurrency:          cfg.Poller.Concurrency,
+		PreDepartureWorkers:  cfg.Poller.PreDepartureWorkers,
 		Window:               cfg.Poller.Window,
 		ProxyURL:             cfg.Poller.ProxyURL,
 		StaticErrorThreshold: cfg.Poller.StaticErrorThreshold,
-		TotalErrorThreshold:  cfg.Poller.TotalErrorThreshold,
+		StallThreshold:       cfg.Poller.StallThreshold,
+		RecordDir:            cfg.Poller.RecordDir,
+		OriginInterval:       cfg.Poller.OriginInterval,
+		DormantInterval:      cfg.Poller.DormantInterval,
+		DormantAfter:         cfg.Poller.DormantAfter,
+		TypeIntervals:        typeIntervals,
+		MaxRunsPerCycle:      cfg.Poller.MaxRunsPerCycle,
+		BackoffBase:          cfg.Poller.BackoffBase,
+		BackoffMax:           cfg.Poller.BackoffMax,
+		ArchiveRetention:     cfg.Poller.ArchiveRetention,
+		KeepSchedules:        cfg.Poller.KeepSchedules,
+		ScheduleRetention:    cfg.Poller.ScheduleRetention,
+		PositionSmoothing:    cfg.Poller.PositionSmoothing,
+		NoDataAfter:          cfg.Poller.NoDataAfter,
+		OverdueAfter:         cfg.Poller.OverdueAfter,
+		ExtrapolateAfter:     cfg.Poller.ExtrapolateAfter,
+		ExtrapolateFor:       cfg.Poller.ExtrapolateFor,
+		TransientRetries:     cfg.Poller.TransientRetries,
+		TransientRetryDelay:  cfg.Poller.TransientRetryDelay,
+		LocationBatchSize:    cfg.Poller.LocationBatchSize,
+		LocationFlush:        cfg.Poller.LocationFlush,
+		LeaseTTL:             cfg.Poller.LeaseTTL,
+		LeaseMaxRuns:         cfg.Poller.LeaseMaxRuns,
+		InstanceID:           cfg.Poller.InstanceID,
+		Sweeps:               cfg.Poller.Sweeps,
+		Cycles:               poller.NewCycles(),
+		Control:              poller.NewControl(),
+		Breaker: wimt.NewBreaker(wimt.BreakerConfig{
+			FailureRate: cfg.Poller.BreakerFailureRate,
+			MinRequests: cfg.Poller.BreakerMinRequests,
+			Window:      cfg.Poller.BreakerWindow,
+			Cooldown:    cfg.Poller.BreakerCooldown,
+			Probes:      cfg.Poller.BreakerProbes,
+		}, logger),
+	}
+	if cfg.Poller.FallbackURL != "" {
+		pollerCfg.Fallback = wimt.NewRelay(cfg.Poller.FallbackURL, cfg.Poller.FallbackAPIKey)
+	}
+	if cfg.Simulation.Enabled {
+		pollerCfg.Fetcher = wimt.NewLocalAPIClient("http://" + cfg.Simulation.Addr + sim.LiveStatusPath)
+		logger.Printf("simulation mode: polling fake live status at %s", cfg.Simulation.Addr)
+	}
+
+	// budgets are per upstream identity, requests through another proxy get their own
+	iriBudget, err := ratelimit.Load(context.Background(), queries, logger, "iri",
+		rate.Every(iriRateLimit), iriBurst, cfg.RateLimit.BlockCooldown)
+	if err != nil {
+		_ = dbConn.Close()
+		return nil, err
+	}
+	if !cfg.Simulation.Enabled {
+		pollerCfg.Budget, err = ratelimit.Load(context.Background(), queries, logger, wimtBudgetName(cfg.Poller.ProxyURL),
+			rate.Limit(cfg.RateLimit.WIMTPerMinute/60), cfg.RateLimit.WIMTBurst, cfg.RateLimit.BlockCooldown)
+		if err != nil {
+			_ = dbConn.Close()
+			return nil, err
+		}
 	}
 
-	return &App{
+	app := &App{
 		cfg:       cfg,
 		logger:    logger,
 		dbConn:    dbConn,
 		queries:   queries,
 		loc:       loc,
 		pollerCfg: pollerCfg,
-	}, nil
+		iriBudget: iriBudget,
+	}
+	app.syncConcurrency.Store(int32(cfg.Syncer.Concurrency))
+	return app, nil
+}
+
+// wimtBudgetName keys the budget by proxy, credentials left out
+func wimtBudgetName(proxyURL string) string {
+	if proxyURL == "" {
+		return "wimt:direct"
+	}
+	if u, err := url.Parse(proxyURL); err == nil {
+		return "wimt:" + u.Redacted()
+	}
+	return "wimt:" + proxyURL
 }
 
 func (app *App) cleanup() {
+	// last save before the database goes, a context that is already cancelled won't do
+	for _, b := range []*ratelimit.Budget{app.iriBudget, app.pollerCfg.Budget} {
+		if err := b.Save(context.Background()); err != nil {
+			app.logger.Printf("error saving rate limit state: %v", err)
+		}
+	}
 	if err := app.dbConn.Close(); err != nil {
 		app.logger.Printf("error closing database: %v", err)
 	}
 }
 
 func (app *App) runInitialSetup(ctx context.Context) error {
-	urls := loadTrainURLs(false)
-	if len(urls) == 0 {
-		app.logger.Println("warning: no train URLs loaded, skipping initial sync")
-		return nil
-	}
+	// the simulator works off schedules already in the database, so IRI is left alone
+	if !app.cfg.Simulation.Enabled {
+		if err := app.importLegacyTrainURLs(ctx); err != nil {
+			return err
+		}
 
-	client := iri.NewClient(
-		rate.NewLimiter(rate.Every(iriRateLimit), iriBurst),
-		nil,
-	)
+		urls := trackedTrainURLs(ctx, app.queries, app.logger)
+		if len(urls) == 0 {
+			app.logger.Println("warning: no train URLs loaded, skipping initial sync")
+			return nil
+		}
 
-	app.logger.Printf("running initial sync with %d trains", len(urls))
-	if err := client.ExecuteSyncCycle(ctx, app.dbConn, app.logger, int(app.cfg.Syncer.Concurrency), urls); err != nil {
-		return err
+		client := iri.NewClient(app.iriBudget, nil)
+
+		app.logger.Printf("running initial sync with %d trains", len(urls))
+		if err := client.ExecuteSyncCycle(ctx, app.dbConn, app.logger, int(app.cfg.Syncer.Concurrency), urls); err != nil {
+			return err
+		}
+		app.logger.Println("initial sync completed")
+	}
+
+	// links and aliases point at trains, so they go in once the trains exist
+	for _, link := range loadTrainLinks() {
+		if err := app.queries.UpsertTrainLink(ctx, link); err != nil {
+			app.logger.Printf("warning: failed to store link %d -> %d: %v", link.TrainNo, link.LinkedTrainNo, err)
+		}
+	}
+	for _, alias := range loadTrainAliases() {
+		if err := app.queries.UpsertTrainAlias(ctx, alias); err != nil {
+			app.logger.Printf("warning: failed to store alias %d -> %d: %v", alias.AliasTrainNo, alias.TrainNo, err)
+		}
 	}
-	app.logger.Println("initial sync completed")
 
 	startTime := time.Now().In(app.loc)
 	app.logger.Printf("running initial schedule generation for %s", startTime.Format(time.DateOnly))
@@ -128,16 +285,51 @@ func (app *App) runInitialSetup(ctx context.Context) error {
 		Weekday: int64(startTime.Weekday()),
 	}); err != nil {
 		app.logger.Printf("warning: initial schedule generation failed: %v", err)
+		schedulerHealth.Failure(err)
+	} else {
+		schedulerHealth.Success("generated " + startTime.Format(time.DateOnly))
 	}
 
 	return nil
 }
 
 func (app *App) startAllServices(ctx context.Context) {
+	app.startBudgetPersistence(ctx)
 	app.startScheduler(ctx)
-	app.startIRISyncManager(ctx)
+	if app.cfg.Simulation.Enabled {
+		app.startSimulator(ctx)
+	} else {
+		app.startIRISyncManager(ctx)
+	}
 	app.startPoller(ctx)
+	app.startAnalytics(ctx)
+	app.startWebhooks(ctx)
+	app.startPush(ctx)
 	app.startAPIServer(ctx)
+	app.startDebugServer(ctx)
+}
+
+// startDebugServer is independent of the API server so profiles can still be taken
+// while it restarts
+func (app *App) startDebugServer(ctx context.Context) {
+	if app.cfg.Server.DebugAddr == "" {
+		return
+	}
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		if err := api.NewDebugServer(app.cfg.Server.DebugAddr, app.logger).Run(ctx); err != nil {
+			app.logger.Printf("debug server failed: %v", err)
+		}
+	}()
+}
+
+func (app *App) startBudgetPersistence(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ratelimit.Persist(ctx, app.logger, app.cfg.RateLimit.SaveInterval, app.iriBudget, app.pollerCfg.Budget)
+	}()
 }
 
 func (app *App) startScheduler(ctx context.Context) {
@@ -151,26 +343,31 @@ func (app *App) startScheduler(ctx context.Context) {
 }
 
 func (app *App) startIRISyncManager(ctx context.Context) {
-	urls := loadTrainURLs(false)
-	if len(urls) == 0 {
-		app.logger.Println("warning: no train URLs loaded, IRI sync manager will not start")
-		return
-	}
-
-	client := iri.NewClient(
-		rate.NewLimiter(rate.Every(iriRateLimit), iriBurst),
-		nil,
-	)
+	client := iri.NewClient(app.iriBudget, nil)
 
 	app.wg.Add(1)
 	go func() {
 		defer app.wg.Done()
 		app.logger.Println("starting IRI sync manager")
-		runIRISyncManager(ctx, app.dbConn, app.logger, app.cfg, urls, client)
+		runIRISyncManager(ctx, app.dbConn, app.queries, app.logger, func() int { return int(app.syncConcurrency.Load()) }, client)
 		app.logger.Println("IRI sync manager stopped")
 	}()
 }
 
+func (app *App) startSimulator(ctx context.Context) {
+	srv := sim.New(app.queries, app.loc, app.logger)
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.logger.Printf("starting simulator on %s", app.cfg.Simulation.Addr)
+		if err := srv.ListenAndServe(ctx, app.cfg.Simulation.Addr); err != nil {
+			app.logger.Printf("simulator error: %v", err)
+		}
+		app.logger.Println("simulator stopped")
+	}()
+}
+
 func (app *App) startPoller(ctx context.Context) {
 	app.wg.Add(1)
 	go func() {
@@ -181,8 +378,83 @@ func (app *App) startPoller(ctx context.Context) {
 	}()
 }
 
+func (app *App) startAnalytics(ctx context.Context) {
+	analyticsCfg := analytics.Config{
+		RunHour:            app.cfg.Analytics.RunHour,
+		SegmentWindowDays:  app.cfg.Analytics.SegmentWindowDays,
+		SegmentMaxSpeedKmh: app.cfg.Analytics.SegmentMaxSpeedKmh,
+		SummaryWindowDays:  app.cfg.Analytics.SummaryWindowDays,
+		ApproachMin:        app.cfg.Analytics.ApproachMin,
+		ProfileWindowDays:  app.cfg.Analytics.ProfileWindowDays,
+		CoverageGapMin:     app.cfg.Analytics.CoverageGapMin,
+		WeatherWindowDays:  app.cfg.Analytics.WeatherWindowDays,
+	}
+
+	provider, err := weather.New(app.cfg.Analytics.WeatherProvider, app.cfg.Analytics.WeatherURL)
+	if err != nil {
+		app.logger.Printf("weather enrichment disabled: %v", err)
+	} else {
+		analyticsCfg.Weather = provider
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.logger.Println("starting analytics")
+		analytics.Start(ctx, app.queries, app.dbConn, app.logger, analyticsCfg, app.loc)
+		app.logger.Println("analytics stopped")
+	}()
+}
+
+func (app *App) startWebhooks(ctx context.Context) {
+	webhooksCfg := webhooks.Config{
+		Interval:    app.cfg.Webhooks.Interval,
+		Timeout:     app.cfg.Webhooks.Timeout,
+		MaxAttempts: app.cfg.Webhooks.MaxAttempts,
+		Concurrency: app.cfg.Webhooks.Concurrency,
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.logger.Println("starting webhook delivery")
+		webhooks.Start(ctx, app.queries, app.logger, webhooksCfg)
+		app.logger.Println("webhook delivery stopped")
+	}()
+}
+
+func (app *App) startPush(ctx context.Context) {
+	if app.cfg.Push.CredentialsFile == "" {
+		return
+	}
+	pushCfg := push.Config{
+		CredentialsFile:   app.cfg.Push.CredentialsFile,
+		Interval:          app.cfg.Push.Interval,
+		Timeout:           app.cfg.Push.Timeout,
+		Concurrency:       app.cfg.Push.Concurrency,
+		DelayThresholdMin: app.cfg.Push.DelayThresholdMin,
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.logger.Println("starting push notifications")
+		push.Start(ctx, app.queries, app.logger, pushCfg)
+		app.logger.Println("push notifications stopped")
+	}()
+}
+
 func (app *App) startAPIServer(ctx context.Context) {
-	app.apiManager = newAPIServerManager(app.cfg, app.pollerCfg, app.logger)
+	// on demand syncs share the IRI budget with the weekly one, the simulator has none
+	var syncJobs *iri.Jobs
+	if !app.cfg.Simulation.Enabled {
+		client := iri.NewClient(app.iriBudget, nil)
+		syncJobs = iri.NewJobs(ctx, client, app.dbConn, app.logger, int(app.cfg.Syncer.Concurrency), func() []string {
+			return trackedTrainURLs(ctx, app.queries, app.logger)
+		})
+	}
+
+	app.apiManager = newAPIServerManager(app.cfg, app.pollerCfg, app.loc, app.logger, syncJobs)
 	app.apiManager.start()
 
 	app.wg.Add(1)
@@ -202,12 +474,51 @@ func (app *App) handleSIGHUP(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-sighupCh:
-			app.logger.Println("SIGHUP received: restarting API server")
+			app.logger.Println("SIGHUP received: reloading configuration and restarting API server")
+			app.reloadConfig()
 			app.apiManager.restart()
 		}
 	}
 }
 
+// reloadConfig reads the configuration again and hands the settings that can change
+// while running to the poller and syncer. Everything else waits for a restart.
+func (app *App) reloadConfig() {
+	if err := config.ApplyFile(); err != nil {
+		app.logger.Printf("reload: CONFIG_FILE: %v, keeping the current configuration", err)
+		return
+	}
+	cfg := config.Load()
+
+	tuning, err := app.pollerCfg.Control.Reload(poller.Config{
+		Concurrency:          cfg.Poller.Concurrency,
+		PreDepartureWorkers:  cfg.Poller.PreDepartureWorkers,
+		Window:               cfg.Poller.Window,
+		ProxyURL:             cfg.Poller.ProxyURL,
+		StaticErrorThreshold: cfg.Poller.StaticErrorThreshold,
+		StallThreshold:       cfg.Poller.StallThreshold,
+		MaxRunsPerCycle:      cfg.Poller.MaxRunsPerCycle,
+		BackoffBase:          cfg.Poller.BackoffBase,
+		BackoffMax:           cfg.Poller.BackoffMax,
+	})
+	if err != nil {
+		app.logger.Printf("reload: poller settings not applied: %v", err)
+	} else {
+		app.logger.Printf("reload: poller | %s", tuning)
+		// requests through a new proxy count against that proxy's budget
+		name := wimtBudgetName(cfg.Poller.ProxyURL)
+		if err := app.pollerCfg.Budget.Rekey(context.Background(), name); err != nil {
+			app.logger.Printf("reload: wimt budget not moved to %s: %v", name, err)
+		}
+	}
+
+	app.syncConcurrency.Store(int32(cfg.Syncer.Concurrency))
+	if jobs := app.apiManager.syncJobs; jobs != nil {
+		jobs.SetConcurrency(int(cfg.Syncer.Concurrency))
+	}
+	app.logger.Printf("reload: syncer | concurrency: %d", cfg.Syncer.Concurrency)
+}
+
 func (app *App) shutdown() {
 	app.logger.Println("shutdown signal received, cleaning up...")
 
@@ -242,16 +553,20 @@ func (app *App) shutdown() {
 type apiServerManager struct {
 	cfg       *config.Config
 	pollerCfg poller.Config
+	loc       *time.Location
 	logger    *log.Logger
+	syncJobs  *iri.Jobs
 	mu        sync.Mutex
 	srv       *api.Server
 }
 
-func newAPIServerManager(cfg *config.Config, pollerCfg poller.Config, logger *log.Logger) *apiServerManager {
+func newAPIServerManager(cfg *config.Config, pollerCfg poller.Config, loc *time.Location, logger *log.Logger, syncJobs *iri.Jobs) *apiServerManager {
 	return &apiServerManager{
 		cfg:       cfg,
 		pollerCfg: pollerCfg,
+		loc:       loc,
 		logger:    logger,
+		syncJobs:  syncJobs,
 	}
 }
 
@@ -265,7 +580,7 @@ func (m *apiServerManager) start() {
 			m.shutdownExisting(old)
 		}
 
-		srv, err := api.NewServer(m.cfg.Server, m.cfg.Database, m.pollerCfg, m.logger)
+		srv, err := api.NewServer(m.cfg.Server, m.cfg.Database, m.pollerCfg, m.syncJobs, m.loc, m.logger)
 		if err != nil {
 			m.logger.Printf("api: failed to initialize server: %v", err)
 			return
@@ -346,10 +661,12 @@ func runScheduleGeneration(ctx context.Context, queries *db.Queries, logger *log
 
 	if err != nil {
 		logger.Printf("scheduler: generation failed: %v", err)
+		schedulerHealth.Failure(err)
 		return
 	}
 
 	logger.Printf("scheduler: generation completed for %s", runDate)
+	schedulerHealth.Success("generated " + runDate)
 }
 
 func calculateNextRunTime(loc *time.Location, hour int) time.Time {
@@ -362,7 +679,10 @@ func calculateNextRunTime(loc *time.Location, hour int) time.Time {
 }
 
 // IRI Sync Manager
-func runIRISyncManager(ctx context.Context, dbConn *sql.DB, logger *log.Logger, cfg *config.Config, urls []string, client *iri.Client) {
+// the tracked trains are read on every tick, so changes made through the admin API
+// are picked up by the next sync
+// runIRISyncManager reads concurrency for every weekly sync, it can change in between
+func runIRISyncManager(ctx context.Context, dbConn *sql.DB, queries *db.Queries, logger *log.Logger, concurrency func() int, client *iri.Client) {
 	ticker := time.NewTicker(syncInterval)
 	defer ticker.Stop()
 
@@ -371,15 +691,20 @@ func runIRISyncManager(ctx context.Context, dbConn *sql.DB, logger *log.Logger,
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			runIRISync(ctx, dbConn, logger, cfg, urls, client)
+			urls := trackedTrainURLs(ctx, queries, logger)
+			if len(urls) == 0 {
+				logger.Println("iri_sync: no tracked trains enabled, skipping sync")
+				continue
+			}
+			runIRISync(ctx, dbConn, logger, concurrency(), urls, client)
 		}
 	}
 }
 
-func runIRISync(ctx context.Context, dbConn *sql.DB, logger *log.Logger, cfg *config.Config, urls []string, client *iri.Client) {
+func runIRISync(ctx context.Context, dbConn *sql.DB, logger *log.Logger, concurrency int, urls []string, client *iri.Client) {
 	logger.Printf("iri_sync: starting sync with %d trains", len(urls))
 
-	if err := client.ExecuteSyncCycle(ctx, dbConn, logger, int(cfg.Syncer.Concurrency), urls); err != nil {
+	if err := client.ExecuteSyncCycle(ctx, dbConn, logger, concurrency, urls); err != nil {
 		logger.Printf("iri_sync: sync failed: %v", err)
 		return
 	}
@@ -387,20 +712,298 @@ func runIRISync(ctx context.Context, dbConn *sql.DB, logger *log.Logger, cfg *co
 	logger.Println("iri_sync: sync completed successfully")
 }
 
-// Train URLs Loader
-func loadTrainURLs(isTest bool) []string {
-	if isTest {
-		return []string{"https://indiarailinfo.com/train/7539"}
+// Seed Command
+// trano seed --trains 5000 --days 7 fills the configured database with synthetic data
+func runSeed(ctx context.Context, logger *log.Logger, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	trains := fs.Int("trains", 1000, "number of synthetic trains")
+	days := fs.Int("days", 7, "days of runs up to and including today")
+	stations := fs.Int("stations", 0, "size of the station network, 0 derives it from --trains")
+	interval := fs.Duration("interval", time.Minute, "spacing of generated location fixes")
+	seed := fs.Uint64("seed", 1, "random seed, the same seed generates the same data")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := config.Load()
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return err
 	}
 
-	file, err := os.Open("./data/train_urls.csv")
+	dbConn, err := dbutil.OpenDatabase(cfg.Database, dbutil.DefaultDatabaseOptions(), logger)
 	if err != nil {
-		log.Printf("failed to open train_urls.csv: %v", err)
+		return err
+	}
+	defer dbConn.Close()
+
+	logger.Printf("seed: %d trains over %d days into %s", *trains, *days, cfg.Database.Path)
+	start := time.Now()
+	if err := sim.Seed(ctx, dbConn, loc, logger, sim.SeedOptions{
+		Trains:   *trains,
+		Days:     *days,
+		Stations: *stations,
+		Interval: *interval,
+		Seed:     *seed,
+	}); err != nil {
+		return err
+	}
+	logger.Printf("seed: completed in %v", time.Since(start).Round(time.Second))
+	return nil
+}
+
+// Backfill Command
+// trano backfill --from 2025-05-08 --to 2025-05-10 fills in runs missed during an outage
+func runBackfill(ctx context.Context, logger *log.Logger, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fromStr := fs.String("from", "", "first run date, YYYY-MM-DD")
+	toStr := fs.String("to", "", "last run date, YYYY-MM-DD, defaults to yesterday")
+	delay := fs.Duration("delay", 2*time.Second, "pause between upstream requests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	app, err := initializeApp(logger)
+	if err != nil {
+		return err
+	}
+	defer app.cleanup()
+
+	from, err := time.ParseInLocation(time.DateOnly, *fromStr, app.loc)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	now := time.Now().In(app.loc)
+	to := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, app.loc)
+	if *toStr != "" {
+		if to, err = time.ParseInLocation(time.DateOnly, *toStr, app.loc); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return fmt.Errorf("--to is before --from")
+	}
+
+	_, err = poller.Backfill(ctx, app.queries, app.dbConn, logger, app.pollerCfg, app.loc, from, to, *delay)
+	return err
+}
+
+// Replay Command
+// trano replay --dir ./data/recordings runs captured live status through the poller
+// against the configured database, point DB_PATH at a copy
+func runReplay(ctx context.Context, logger *log.Logger, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory written by POLLER_RECORD_DIR")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("--dir is required")
+	}
+
+	cfg := config.Load()
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return err
+	}
+
+	recs, err := wimt.LoadRecordings(*dir)
+	if err != nil {
+		return err
+	}
+
+	dbConn, err := dbutil.OpenDatabase(cfg.Database, dbutil.DefaultDatabaseOptions(), logger)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	logger.Printf("replay: %d recordings from %s into %s", len(recs), *dir, cfg.Database.Path)
+	_, err = poller.Replay(ctx, db.New(dbConn), dbConn, logger, loc, recs)
+	return err
+}
+
+// GTFS Command
+// trano gtfs --out ./data/gtfs.zip writes the timetable as a static GTFS feed
+func runGTFS(ctx context.Context, logger *log.Logger, args []string) error {
+	fs := flag.NewFlagSet("gtfs", flag.ExitOnError)
+	out := fs.String("out", "./data/gtfs.zip", "zip file to write")
+	startStr := fs.String("start", "", "first service date, YYYY-MM-DD, defaults to today")
+	days := fs.Int("days", 365, "days of service from --start")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := config.Load()
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return err
+	}
+
+	opts := gtfs.DefaultOptions(loc)
+	opts.Days = *days
+	if *startStr != "" {
+		if opts.Start, err = time.ParseInLocation(time.DateOnly, *startStr, loc); err != nil {
+			return fmt.Errorf("invalid --start: %w", err)
+		}
+	}
+
+	dbConn, err := dbutil.OpenDatabase(cfg.Database, dbutil.DefaultDatabaseOptions(), logger)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	stats, err := gtfs.Write(ctx, db.New(dbConn), f, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(*out)
+		return err
+	}
+
+	logger.Printf("gtfs: wrote %s | stops: %d | routes: %d | trips: %d | stop_times: %d | services: %d",
+		*out, stats.Stops, stats.Routes, stats.Trips, stats.StopTimes, stats.Services)
+	return nil
+}
+
+// Import Trains Command
+// trano import-trains --file trains.csv adds the train pages in a train_no,url csv to the
+// tracked set, urls already tracked are updated
+func runImportTrains(ctx context.Context, logger *log.Logger, args []string) error {
+	fs := flag.NewFlagSet("import-trains", flag.ExitOnError)
+	file := fs.String("file", legacyTrainURLsPath, "csv of train_no,url with a header row")
+	disabled := fs.Bool("disabled", false, "import the trains disabled, to enable later through the admin API")
+	note := fs.String("note", "", "note stored with every imported train")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	trains, err := loadTrackedTrains(*file)
+	if err != nil {
+		return err
+	}
+	for i := range trains {
+		if *disabled {
+			trains[i].Enabled = 0
+		}
+		if *note != "" {
+			trains[i].Note = sql.NullString{String: *note, Valid: true}
+		}
+	}
+
+	cfg := config.Load()
+	dbConn, err := dbutil.OpenDatabase(cfg.Database, dbutil.DefaultDatabaseOptions(), logger)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	if err := importTrackedTrains(ctx, db.New(dbConn), trains); err != nil {
+		return err
+	}
+	logger.Printf("import-trains: %d trains from %s into %s", len(trains), *file, cfg.Database.Path)
+	return nil
+}
+
+// Tracked Trains
+// trackedTrainURLs returns the enabled train pages, nil when the database can't be read
+func trackedTrainURLs(ctx context.Context, queries *db.Queries, logger *log.Logger) []string {
+	urls, err := queries.ListTrackedTrainURLs(ctx)
+	if err != nil {
+		logger.Printf("failed to load tracked trains: %v", err)
+		return nil
+	}
+	return urls
+}
+
+// importLegacyTrainURLs fills an empty tracked_trains from data/train_urls.csv, the
+// file the train list used to live in. Once the table has rows the file is ignored.
+func (app *App) importLegacyTrainURLs(ctx context.Context) error {
+	total, err := app.queries.CountTrackedTrains(ctx)
+	if err != nil || total > 0 {
+		return err
+	}
+	trains, err := loadTrackedTrains(legacyTrainURLsPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := importTrackedTrains(ctx, app.queries, trains); err != nil {
+		return err
+	}
+	app.logger.Printf("imported %d tracked trains from %s", len(trains), legacyTrainURLsPath)
+	return nil
+}
+
+func importTrackedTrains(ctx context.Context, queries *db.Queries, trains []db.UpsertTrackedTrainParams) error {
+	for _, train := range trains {
+		if _, err := queries.UpsertTrackedTrain(ctx, train); err != nil {
+			return fmt.Errorf("track %s: %w", train.SourceUrl, err)
+		}
+	}
+	return nil
+}
+
+const legacyTrainURLsPath = "./data/train_urls.csv"
+
+// Tracked Trains Loader
+// train_urls.csv: train_no,url where train_no may be blank, the first sync fills it in
+func loadTrackedTrains(path string) ([]db.UpsertTrackedTrainParams, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var trains []db.UpsertTrackedTrainParams
+	scanner := bufio.NewScanner(file)
+
+	if scanner.Scan() {
+		// Skip header
+	}
+
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ",", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		sourceURL := strings.TrimSpace(fields[1])
+		if sourceURL == "" {
+			continue
+		}
+		train := db.UpsertTrackedTrainParams{SourceUrl: sourceURL, Enabled: 1}
+		if trainNo, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64); err == nil {
+			train.TrainNo = sql.NullInt64{Int64: trainNo, Valid: true}
+		}
+		trains = append(trains, train)
+	}
+
+	return trains, scanner.Err()
+}
+
+// Train Links Loader
+// train_links.csv: train_no,linked_train_no,kind,from_station_code,to_station_code
+// where train_no carries linked_train_no between the two stations, blank for the whole run
+func loadTrainLinks() []db.UpsertTrainLinkParams {
+	file, err := os.Open("./data/train_links.csv")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("failed to open train_links.csv: %v", err)
+		}
 		return nil
 	}
 	defer file.Close()
 
-	var urls []string
+	var links []db.UpsertTrainLinkParams
 	scanner := bufio.NewScanner(file)
 
 	if scanner.Scan() {
@@ -408,21 +1011,82 @@ func loadTrainURLs(isTest bool) []string {
 	}
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.SplitN(line, ",", 2)
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 5 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		trainNo, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		linkedTrainNo, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		links = append(links, db.UpsertTrainLinkParams{
+			TrainNo:         trainNo,
+			LinkedTrainNo:   linkedTrainNo,
+			Kind:            fields[2],
+			FromStationCode: sql.NullString{String: fields[3], Valid: fields[3] != ""},
+			ToStationCode:   sql.NullString{String: fields[4], Valid: fields[4] != ""},
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("error reading train_links.csv: %v", err)
+	}
+
+	return links
+}
+
+// Train Aliases Loader
+// train_aliases.csv: alias_train_no,train_no where train_no is the number runs are kept under
+func loadTrainAliases() []db.UpsertTrainAliasParams {
+	file, err := os.Open("./data/train_aliases.csv")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("failed to open train_aliases.csv: %v", err)
+		}
+		return nil
+	}
+	defer file.Close()
+
+	var aliases []db.UpsertTrainAliasParams
+	scanner := bufio.NewScanner(file)
+
+	if scanner.Scan() {
+		// Skip header
+	}
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
 		if len(fields) != 2 {
 			continue
 		}
 
-		url := strings.TrimSpace(fields[1])
-		if url != "" {
-			urls = append(urls, url)
+		aliasTrainNo, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+		if err != nil {
+			continue
 		}
+		trainNo, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		aliases = append(aliases, db.UpsertTrainAliasParams{
+			AliasTrainNo: aliasTrainNo,
+			TrainNo:      trainNo,
+		})
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("error reading train_urls.csv: %v", err)
+		log.Printf("error reading train_aliases.csv: %v", err)
 	}
 
-	return urls
+	return aliases
 }